@@ -23,24 +23,29 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
 	"time"
 
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
+	"google.golang.org/grpc"
 
 	"github.com/cectc/dbpack/pkg/config"
 	"github.com/cectc/dbpack/pkg/constant"
 	"github.com/cectc/dbpack/pkg/driver"
 	"github.com/cectc/dbpack/pkg/dt"
+	"github.com/cectc/dbpack/pkg/dt/api"
 	"github.com/cectc/dbpack/pkg/executor"
 	"github.com/cectc/dbpack/pkg/filter"
 	_ "github.com/cectc/dbpack/pkg/filter/audit_log"
 	_ "github.com/cectc/dbpack/pkg/filter/breaker"
 	_ "github.com/cectc/dbpack/pkg/filter/crypto"
 	_ "github.com/cectc/dbpack/pkg/filter/dt"
+	_ "github.com/cectc/dbpack/pkg/filter/firewall"
 	_ "github.com/cectc/dbpack/pkg/filter/metrics"
+	_ "github.com/cectc/dbpack/pkg/filter/privilege"
 	_ "github.com/cectc/dbpack/pkg/filter/rate"
 	dbpackHttp "github.com/cectc/dbpack/pkg/http"
 	"github.com/cectc/dbpack/pkg/listener"
@@ -82,7 +87,9 @@ var (
 				log.Fatal(err)
 			}
 
+			ctx, cancel := context.WithCancel(context.Background())
 			dbpack := server.NewServer()
+			grpcListeners := make(map[string]net.Listener)
 			for appid, dbpackConf := range conf.AppConfig {
 				for _, filterConf := range dbpackConf.Filters {
 					factory := filter.GetFilterFactory(filterConf.Kind)
@@ -121,7 +128,7 @@ var (
 						executors[executorConf.Name] = executor
 					}
 					if executorConf.Mode == config.SHD {
-						executor, err := executor.NewShardingExecutor(executorConf)
+						executor, err := executor.NewShardingExecutor(ctx, executorConf)
 						if err != nil {
 							log.Fatal(err)
 						}
@@ -157,10 +164,17 @@ var (
 				if dbpackConf.DistributedTransaction != nil {
 					dbpackHttp.AppendApplicationID(dbpackConf.AppID)
 					dt.RegisterTransactionManager(dbpackConf.DistributedTransaction)
+					if dbpackConf.DistributedTransaction.GrpcPort > 0 {
+						lis, err := net.Listen("tcp", net.JoinHostPort(dbpackConf.DistributedTransaction.GrpcBindAddress,
+							strconv.Itoa(dbpackConf.DistributedTransaction.GrpcPort)))
+						if err != nil {
+							log.Fatalf("unable init transaction manager grpc server: %+v", err)
+						}
+						grpcListeners[appid] = lis
+					}
 				}
 			}
 
-			ctx, cancel := context.WithCancel(context.Background())
 			c := make(chan os.Signal, 2)
 			signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 			go func() {
@@ -191,6 +205,10 @@ var (
 
 			go initServer(ctx, lis)
 
+			for appid, grpcLis := range grpcListeners {
+				go initGrpcServer(ctx, appid, grpcLis)
+			}
+
 			if conf.Tracer != nil {
 				go initTracing(ctx, conf.Tracer.ExporterType, conf.Tracer.ExporterEndpoint)
 			}
@@ -227,6 +245,19 @@ func initServer(ctx context.Context, lis net.Listener) {
 	log.Infof("start api server :  %s", lis.Addr())
 }
 
+func initGrpcServer(ctx context.Context, appid string, lis net.Listener) {
+	grpcS := grpc.NewServer()
+	api.RegisterTransactionManagerServiceServer(grpcS, dt.NewTransactionManagerServer(appid, dt.GetTransactionManager(appid)))
+	go func() {
+		<-ctx.Done()
+		grpcS.GracefulStop()
+	}()
+	log.Infof("start transaction manager grpc server: %s", lis.Addr())
+	if err := grpcS.Serve(lis); err != nil {
+		log.Fatalf("unable create transaction manager grpc server: %+v", err)
+	}
+}
+
 func initTracing(ctx context.Context, exporter string, endpoint *string) {
 	traceCtl, err := tracing.NewTracer(Version, tracing.Exporter(exporter), endpoint)
 	if err != nil {
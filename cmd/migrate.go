@@ -0,0 +1,104 @@
+/*
+ * Copyright 2022 CECTC, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+
+	"github.com/spf13/cobra"
+
+	"github.com/cectc/dbpack/pkg/log"
+	"github.com/cectc/dbpack/pkg/migration"
+)
+
+var (
+	migrateOptions  = &migration.Options{}
+	sourceConfig    string
+	targetConfig    string
+	migrateAppID    string
+	migrateExecutor string
+	verifyOnly      bool
+
+	migrateCommand = &cobra.Command{
+		Use:   "migrate",
+		Short: "offline migration of sharding tables from the source topology to the target topology",
+		Long: `Copy the rows of the sharding tables from the source topology to the target topology, and
+verify the row counts and checksums of the target tables.
+
+The migration is offline: changes made to the source tables while they are copied are not
+captured, so writes to the tables must be stopped before migrating, and dbpack should be
+started with the target configuration after the verification passes.`,
+
+		Run: func(cmd *cobra.Command, args []string) {
+			source, err := migration.LoadCluster(sourceConfig, migrateAppID, migrateExecutor)
+			if err != nil {
+				log.Fatal(err)
+			}
+			defer source.Close()
+			target, err := migration.LoadCluster(targetConfig, migrateAppID, migrateExecutor)
+			if err != nil {
+				log.Fatal(err)
+			}
+			defer target.Close()
+
+			migrator, err := migration.NewMigrator(source, target, migrateOptions)
+			if err != nil {
+				log.Fatal(err)
+			}
+			ctx := context.Background()
+			if !verifyOnly {
+				if err := migrator.Migrate(ctx); err != nil {
+					log.Fatal(err)
+				}
+			}
+			reports, err := migrator.Verify(ctx)
+			if err != nil {
+				log.Fatal(err)
+			}
+			consistent := true
+			for _, report := range reports {
+				if report.Consistent() {
+					log.Infof("%s %s.%s: %d rows, checksum %d", report.LogicTable, report.Database,
+						report.Table, report.ActualRows, report.ActualChecksum)
+					continue
+				}
+				consistent = false
+				log.Errorf("%s %s.%s: expected %d rows checksum %d, actual %d rows checksum %d",
+					report.LogicTable, report.Database, report.Table, report.ExpectedRows,
+					report.ExpectedChecksum, report.ActualRows, report.ActualChecksum)
+			}
+			if !consistent {
+				log.Fatal("verification failed, rows of target tables are inconsistent with source tables")
+			}
+		},
+	}
+)
+
+func init() {
+	flags := migrateCommand.Flags()
+	flags.StringVarP(&sourceConfig, "source", "s", "", "Load source sharding configuration from `FILE`")
+	flags.StringVarP(&targetConfig, "target", "t", "", "Load target sharding configuration from `FILE`")
+	flags.StringVar(&migrateAppID, "app", "", "application id, can be omitted if there is only one application")
+	flags.StringVar(&migrateExecutor, "executor", "", "sharding executor name, can be omitted if there is only one sharding executor")
+	flags.StringSliceVar(&migrateOptions.Tables, "tables", nil, "logic tables to migrate, all logic tables by default")
+	flags.IntVar(&migrateOptions.BatchSize, "batch-size", migration.DefaultBatchSize, "rows copied per batch")
+	flags.StringVar(&migrateOptions.CheckpointPath, "checkpoint", "", "checkpoint `FILE`, an interrupted migration resumes from it")
+	flags.BoolVar(&verifyOnly, "verify-only", false, "only verify row counts and checksums of target tables")
+	migrateCommand.MarkFlagRequired("source")
+	migrateCommand.MarkFlagRequired("target")
+	rootCommand.AddCommand(migrateCommand)
+}
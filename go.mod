@@ -3,6 +3,7 @@ module github.com/cectc/dbpack
 go 1.23
 
 require (
+	github.com/DATA-DOG/go-sqlmock v1.5.0
 	github.com/agiledragon/gomonkey/v2 v2.7.0
 	github.com/antonmedv/expr v1.9.0
 	github.com/cespare/xxhash/v2 v2.1.2
@@ -0,0 +1,278 @@
+/*
+ * Copyright 2022 CECTC, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package auth
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/cectc/dbpack/pkg/constant"
+)
+
+const (
+	// sha2CryptPrefix is the prefix of the caching_sha2_password hash stored in mysql.user
+	sha2CryptPrefix     = "$A$"
+	sha2CryptSaltLength = 20
+	sha2CryptHashLength = 43
+)
+
+// Credential is the stored form of a password, the password itself is not kept.
+type Credential struct {
+	// NativeHash is SHA1(SHA1(password)), used by mysql_native_password
+	NativeHash []byte
+	// SHA2Hash is SHA256(SHA256(password)), used by the fast authentication of caching_sha2_password
+	SHA2Hash []byte
+	// SHA2Crypt is the sha256 crypt hash stored by mysql for caching_sha2_password,
+	// e.g. $A$005$<20 bytes salt><43 bytes hash>
+	SHA2Crypt string
+	// Empty is true if the password is empty
+	Empty bool
+}
+
+// ParseCredential parses a password in configuration, which can be a hash of mysql_native_password
+// (`*` followed by 40 hex digits), a hash of caching_sha2_password (`$A$005$...`), or a plaintext password.
+func ParseCredential(password string) (*Credential, error) {
+	switch {
+	case password == "":
+		return &Credential{Empty: true}, nil
+	case len(password) == 41 && password[0] == '*':
+		hash, err := hex.DecodeString(password[1:])
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid mysql_native_password hash")
+		}
+		return &Credential{NativeHash: hash}, nil
+	case strings.HasPrefix(password, sha2CryptPrefix):
+		if _, _, _, err := parseSHA2Crypt(password); err != nil {
+			return nil, err
+		}
+		return &Credential{SHA2Crypt: password}, nil
+	default:
+		return NewCredential(password), nil
+	}
+}
+
+// NewCredential hashes a plaintext password.
+func NewCredential(password string) *Credential {
+	if password == "" {
+		return &Credential{Empty: true}
+	}
+	return &Credential{
+		NativeHash: NativeHash([]byte(password)),
+		SHA2Hash:   SHA2Hash([]byte(password)),
+	}
+}
+
+// NativeHash returns SHA1(SHA1(password))
+func NativeHash(password []byte) []byte {
+	stage1 := sha1.Sum(password)
+	stage2 := sha1.Sum(stage1[:])
+	return stage2[:]
+}
+
+// SHA2Hash returns SHA256(SHA256(password))
+func SHA2Hash(password []byte) []byte {
+	stage1 := sha256.Sum256(password)
+	stage2 := sha256.Sum256(stage1[:])
+	return stage2[:]
+}
+
+// Supports returns true if the credential can be verified by the auth plugin.
+func (c *Credential) Supports(plugin string) bool {
+	switch plugin {
+	case constant.MysqlNativePassword:
+		return c.Empty || c.NativeHash != nil
+	case constant.CachingSha2Password:
+		return c.Empty || c.SHA2Hash != nil || c.SHA2Crypt != ""
+	default:
+		return false
+	}
+}
+
+// VerifyNative verifies the auth response of mysql_native_password,
+// response = SHA1(password) XOR SHA1(salt + SHA1(SHA1(password))).
+func (c *Credential) VerifyNative(salt, response []byte) bool {
+	if c.Empty {
+		return len(response) == 0
+	}
+	if c.NativeHash == nil || len(response) != sha1.Size {
+		return false
+	}
+	crypt := sha1.New()
+	crypt.Write(salt)
+	crypt.Write(c.NativeHash)
+	stage1 := crypt.Sum(nil)
+	for i := range stage1 {
+		stage1[i] ^= response[i]
+	}
+	stage2 := sha1.Sum(stage1)
+	return subtle.ConstantTimeCompare(stage2[:], c.NativeHash) == 1
+}
+
+// VerifySHA2Scramble verifies the scramble of caching_sha2_password by SHA256(SHA256(password)),
+// scramble = SHA256(password) XOR SHA256(SHA256(SHA256(password)) + salt).
+func VerifySHA2Scramble(hash, salt, scramble []byte) bool {
+	if len(scramble) != sha256.Size {
+		return false
+	}
+	crypt := sha256.New()
+	crypt.Write(hash)
+	crypt.Write(salt)
+	stage1 := crypt.Sum(nil)
+	for i := range stage1 {
+		stage1[i] ^= scramble[i]
+	}
+	stage2 := sha256.Sum256(stage1)
+	return subtle.ConstantTimeCompare(stage2[:], hash) == 1
+}
+
+// VerifyPassword verifies the plaintext password sent by the full authentication of caching_sha2_password.
+func (c *Credential) VerifyPassword(password []byte) bool {
+	switch {
+	case c.Empty:
+		return len(password) == 0
+	case c.SHA2Hash != nil:
+		return subtle.ConstantTimeCompare(SHA2Hash(password), c.SHA2Hash) == 1
+	case c.SHA2Crypt != "":
+		rounds, salt, hash, err := parseSHA2Crypt(c.SHA2Crypt)
+		if err != nil {
+			return false
+		}
+		return subtle.ConstantTimeCompare(sha256Crypt(password, salt, rounds), hash) == 1
+	case c.NativeHash != nil:
+		return subtle.ConstantTimeCompare(NativeHash(password), c.NativeHash) == 1
+	default:
+		return false
+	}
+}
+
+// parseSHA2Crypt parses $A$<rounds/1000 in 3 digits>$<salt><hash>
+func parseSHA2Crypt(crypt string) (int, []byte, []byte, error) {
+	content := []byte(crypt[len(sha2CryptPrefix):])
+	if len(content) != 3+1+sha2CryptSaltLength+sha2CryptHashLength || content[3] != '$' {
+		return 0, nil, nil, errors.New("invalid caching_sha2_password hash")
+	}
+	rounds, err := strconv.Atoi(string(content[:3]))
+	if err != nil {
+		return 0, nil, nil, errors.Wrap(err, "invalid caching_sha2_password hash")
+	}
+	salt := content[4 : 4+sha2CryptSaltLength]
+	return rounds * 1000, salt, content[4+sha2CryptSaltLength:], nil
+}
+
+const cryptAlphabet = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// sha256Crypt implements the SHA-256 based crypt of Ulrich Drepper, which is used by mysql
+// to store the caching_sha2_password, it returns the 43 bytes encoded hash.
+func sha256Crypt(password, salt []byte, rounds int) []byte {
+	alternate := sha256.New()
+	alternate.Write(password)
+	alternate.Write(salt)
+	alternate.Write(password)
+	alternateSum := alternate.Sum(nil)
+
+	digest := sha256.New()
+	digest.Write(password)
+	digest.Write(salt)
+	i := len(password)
+	for ; i > sha256.Size; i -= sha256.Size {
+		digest.Write(alternateSum)
+	}
+	digest.Write(alternateSum[:i])
+	for i = len(password); i > 0; i >>= 1 {
+		if i&1 != 0 {
+			digest.Write(alternateSum)
+		} else {
+			digest.Write(password)
+		}
+	}
+	digestSum := digest.Sum(nil)
+
+	passwordDigest := sha256.New()
+	for i = 0; i < len(password); i++ {
+		passwordDigest.Write(password)
+	}
+	p := repeatBytes(passwordDigest.Sum(nil), len(password))
+
+	saltDigest := sha256.New()
+	for i = 0; i < 16+int(digestSum[0]); i++ {
+		saltDigest.Write(salt)
+	}
+	s := repeatBytes(saltDigest.Sum(nil), len(salt))
+
+	for i = 0; i < rounds; i++ {
+		round := sha256.New()
+		if i&1 != 0 {
+			round.Write(p)
+		} else {
+			round.Write(digestSum)
+		}
+		if i%3 != 0 {
+			round.Write(s)
+		}
+		if i%7 != 0 {
+			round.Write(p)
+		}
+		if i&1 != 0 {
+			round.Write(digestSum)
+		} else {
+			round.Write(p)
+		}
+		digestSum = round.Sum(nil)
+	}
+
+	var buf bytes.Buffer
+	encode := func(b2, b1, b0 byte, n int) {
+		w := uint(b2)<<16 | uint(b1)<<8 | uint(b0)
+		for ; n > 0; n-- {
+			buf.WriteByte(cryptAlphabet[w&0x3f])
+			w >>= 6
+		}
+	}
+	for i = 0; i < 10; i++ {
+		// the bytes are interleaved as (0, 10, 20), (21, 1, 11), (12, 22, 2), ...
+		a, b, c := i, i+10, i+20
+		switch i % 3 {
+		case 1:
+			a, b, c = i+20, i, i+10
+		case 2:
+			a, b, c = i+10, i+20, i
+		}
+		encode(digestSum[a], digestSum[b], digestSum[c], 4)
+	}
+	encode(0, digestSum[31], digestSum[30], 3)
+	return buf.Bytes()
+}
+
+// repeatBytes repeats the sequence to the length
+func repeatBytes(sequence []byte, length int) []byte {
+	result := make([]byte, 0, length)
+	for len(result) < length {
+		n := length - len(result)
+		if n > len(sequence) {
+			n = len(sequence)
+		}
+		result = append(result, sequence[:n]...)
+	}
+	return result
+}
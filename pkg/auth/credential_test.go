@@ -0,0 +1,111 @@
+/*
+ * Copyright 2022 CECTC, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package auth
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/cectc/dbpack/pkg/constant"
+)
+
+var salt = []byte("0123456789abcdefghij")
+
+func nativeScramble(password string) []byte {
+	stage1 := sha1.Sum([]byte(password))
+	stage2 := sha1.Sum(stage1[:])
+	scramble := sha1.Sum(append(append([]byte{}, salt...), stage2[:]...))
+	for i := range scramble {
+		scramble[i] ^= stage1[i]
+	}
+	return scramble[:]
+}
+
+func sha2Scramble(password string) []byte {
+	stage1 := sha256.Sum256([]byte(password))
+	stage2 := sha256.Sum256(stage1[:])
+	scramble := sha256.Sum256(append(stage2[:], salt...))
+	for i := range scramble {
+		scramble[i] ^= stage1[i]
+	}
+	return scramble[:]
+}
+
+func TestSHA256Crypt(t *testing.T) {
+	// the test vector of the SHA-256 crypt specification
+	hash := sha256Crypt([]byte("Hello world!"), []byte("saltstring"), 5000)
+	assert.Equal(t, "5B8vYYiY.CVt1RlTTf8KbXBH3hsxY/GNooZaBBGWEc5", string(hash))
+}
+
+func TestParseCredential(t *testing.T) {
+	testCases := []struct {
+		password string
+		native   bool
+		sha2     bool
+		empty    bool
+		hasError bool
+	}{
+		{password: "123456", native: true, sha2: true},
+		{password: "", native: true, sha2: true, empty: true},
+		{password: "*6BB4837EB74329105EE4568DDA7DC67ED2CA2AD9", native: true},
+		{password: "$A$005$0123456789abcdefghij8JUwnZtR7jdsnhK9/Uh0eOKPK/TzSQjaA3BR/YQgAlD", sha2: true},
+		{password: "*6BB4837EB74329105EE4568DDA7DC67ED2CA2ADX", hasError: true},
+		{password: "$A$005$0123456789", hasError: true},
+	}
+	for _, c := range testCases {
+		t.Run(c.password, func(t *testing.T) {
+			credential, err := ParseCredential(c.password)
+			if c.hasError {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, c.empty, credential.Empty)
+			assert.Equal(t, c.native, credential.Supports(constant.MysqlNativePassword))
+			assert.Equal(t, c.sha2, credential.Supports(constant.CachingSha2Password))
+		})
+	}
+}
+
+func TestVerify(t *testing.T) {
+	credential, err := ParseCredential("123456")
+	assert.Nil(t, err)
+	assert.True(t, credential.VerifyNative(salt, nativeScramble("123456")))
+	assert.False(t, credential.VerifyNative(salt, nativeScramble("654321")))
+	assert.True(t, VerifySHA2Scramble(credential.SHA2Hash, salt, sha2Scramble("123456")))
+	assert.False(t, VerifySHA2Scramble(credential.SHA2Hash, salt, sha2Scramble("654321")))
+	assert.True(t, credential.VerifyPassword([]byte("123456")))
+
+	credential, err = ParseCredential("*6BB4837EB74329105EE4568DDA7DC67ED2CA2AD9")
+	assert.Nil(t, err)
+	assert.True(t, credential.VerifyNative(salt, nativeScramble("123456")))
+	assert.False(t, credential.VerifyNative(salt, nil))
+
+	credential, err = ParseCredential("$A$005$0123456789abcdefghij8JUwnZtR7jdsnhK9/Uh0eOKPK/TzSQjaA3BR/YQgAlD")
+	assert.Nil(t, err)
+	assert.True(t, credential.VerifyPassword([]byte("123456")))
+	assert.False(t, credential.VerifyPassword([]byte("654321")))
+
+	credential, err = ParseCredential("")
+	assert.Nil(t, err)
+	assert.True(t, credential.VerifyNative(salt, nil))
+	assert.True(t, credential.VerifyPassword(nil))
+	assert.False(t, credential.VerifyPassword([]byte("123456")))
+}
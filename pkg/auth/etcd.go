@@ -0,0 +1,65 @@
+/*
+ * Copyright 2022 CECTC, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package auth
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+const defaultEtcdPrefix = "/dbpack/users/"
+
+type EtcdProviderConfig struct {
+	EtcdConfig clientv3.Config `json:"etcd_config"`
+	// Prefix is the prefix of the keys, the key of a user is prefix + user name,
+	// and the value is the password, see ParseCredential.
+	Prefix string `json:"prefix"`
+}
+
+// etcdProvider provides the users stored in etcd
+type etcdProvider struct {
+	client *clientv3.Client
+	prefix string
+}
+
+func NewEtcdProvider(conf EtcdProviderConfig) (Provider, error) {
+	if conf.EtcdConfig.DialTimeout == 0 {
+		conf.EtcdConfig.DialTimeout = 5 * time.Second
+	}
+	if conf.Prefix == "" {
+		conf.Prefix = defaultEtcdPrefix
+	}
+	client, err := clientv3.New(conf.EtcdConfig)
+	if err != nil {
+		return nil, errors.Wrap(err, "create etcd client failed")
+	}
+	return &etcdProvider{client: client, prefix: conf.Prefix}, nil
+}
+
+func (p *etcdProvider) GetCredential(ctx context.Context, user, _ string) (*Credential, error) {
+	resp, err := p.client.Get(ctx, p.prefix+user)
+	if err != nil {
+		return nil, errors.Wrapf(err, "get user %s from etcd failed", user)
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, nil
+	}
+	return ParseCredential(string(resp.Kvs[0].Value))
+}
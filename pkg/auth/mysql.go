@@ -0,0 +1,230 @@
+/*
+ * Copyright 2022 CECTC, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package auth
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/cectc/dbpack/pkg/constant"
+	"github.com/cectc/dbpack/pkg/log"
+	"github.com/cectc/dbpack/pkg/mysql"
+	"github.com/cectc/dbpack/pkg/proto"
+	"github.com/cectc/dbpack/pkg/resource"
+)
+
+// the accounts of the user, the one matching the host of the client is chosen like mysql does
+const selectUser = "SELECT `host`, `plugin`, `authentication_string` FROM `mysql`.`user` WHERE `user` = ?"
+
+// mysqlProvider provides the users of a backend mysql by looking up `mysql.user`
+type mysqlProvider struct {
+	appID      string
+	dataSource string
+}
+
+func NewMysqlProvider(appID, dataSource string) Provider {
+	return &mysqlProvider{appID: appID, dataSource: dataSource}
+}
+
+func (p *mysqlProvider) GetCredential(ctx context.Context, user, host string) (*Credential, error) {
+	db := resource.GetDBManager(p.appID).GetDB(p.dataSource)
+	if db == nil {
+		return nil, errors.Errorf("data source %s of auth provider not found", p.dataSource)
+	}
+	result, err := lookupUser(ctx, db, user)
+	if err != nil {
+		return nil, errors.Wrapf(err, "look up user %s failed", user)
+	}
+
+	var (
+		matched     []*proto.Value
+		specificity = -1
+	)
+	for _, row := range result.(*mysql.Result).Rows {
+		values, err := row.Decode()
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		pattern := valueString(values[0])
+		if !matchHost(pattern, host) {
+			continue
+		}
+		if s := hostSpecificity(pattern); s > specificity {
+			matched, specificity = values, s
+		}
+	}
+	if matched == nil {
+		return nil, nil
+	}
+	plugin, authentication := valueString(matched[1]), valueString(matched[2])
+	if plugin != constant.MysqlNativePassword && plugin != constant.CachingSha2Password {
+		return nil, errors.Errorf("unsupported auth plugin %s of user %s", plugin, user)
+	}
+	if authentication == "" {
+		return &Credential{Empty: true}, nil
+	}
+	return ParseCredential(authentication)
+}
+
+// lookupUser queries the accounts of the user on a connection of its own. The query of the backend
+// connection doesn't stop on the context, so it is killed by the id of the connection when the
+// context is done, and the connection is released once the query returns.
+func lookupUser(ctx context.Context, db proto.DB, user string) (proto.Result, error) {
+	tx, _, err := db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	connectionID, err := queryConnectionID(tx)
+	if err != nil {
+		releaseLookup(tx)
+		return nil, err
+	}
+
+	type lookup struct {
+		result proto.Result
+		err    error
+	}
+	var (
+		done     = make(chan lookup, 1)
+		mu       sync.Mutex
+		finished bool
+	)
+	go func() {
+		result, _, err := tx.ExecuteSqlDirectly(selectUser, user)
+		// the connection is not released while it is being killed, so the kill can't hit another query
+		mu.Lock()
+		finished = true
+		mu.Unlock()
+		releaseLookup(tx)
+		done <- lookup{result: result, err: err}
+	}()
+	select {
+	case <-ctx.Done():
+		go func() {
+			mu.Lock()
+			defer mu.Unlock()
+			if finished {
+				return
+			}
+			if _, _, err := db.QueryDirectly(fmt.Sprintf("KILL QUERY %d", connectionID)); err != nil {
+				log.Warnf("failed to kill the lookup of user %s, connection id: %d, err: %v", user, connectionID, err)
+			}
+		}()
+		return nil, ctx.Err()
+	case l := <-done:
+		return l.result, l.err
+	}
+}
+
+func queryConnectionID(tx proto.Tx) (uint64, error) {
+	result, _, err := tx.QueryDirectly("SELECT CONNECTION_ID()")
+	if err != nil {
+		return 0, err
+	}
+	rows := result.(*mysql.Result).Rows
+	if len(rows) != 1 {
+		return 0, errors.New("connection id not found")
+	}
+	values, err := rows[0].Decode()
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	connectionID, err := strconv.ParseUint(valueString(values[0]), 10, 64)
+	return connectionID, errors.WithStack(err)
+}
+
+func releaseLookup(tx proto.Tx) {
+	if _, err := tx.Rollback(context.Background(), nil); err != nil {
+		log.Warnf("failed to release the connection of user lookup, err: %v", err)
+	}
+}
+
+// matchHost reports whether the client ip matches the host of an account, the host can be
+// an ip, a pattern with wildcards `%` and `_`, an ip with netmask such as 192.168.1.0/255.255.255.0,
+// or localhost which matches the loopback addresses. Host names are not resolved.
+func matchHost(pattern, host string) bool {
+	if strings.EqualFold(pattern, "localhost") {
+		ip := net.ParseIP(host)
+		return ip != nil && ip.IsLoopback()
+	}
+	if idx := strings.IndexByte(pattern, '/'); idx > 0 {
+		network, mask := net.ParseIP(pattern[:idx]).To4(), net.ParseIP(pattern[idx+1:]).To4()
+		ip := net.ParseIP(host).To4()
+		if network == nil || mask == nil || ip == nil {
+			return false
+		}
+		return ip.Mask(net.IPMask(mask)).Equal(network)
+	}
+	return matchWildcard(strings.ToLower(pattern), strings.ToLower(host))
+}
+
+// matchWildcard matches the text with a LIKE pattern, `%` matches any characters, `_` matches
+// one character, and `\` escapes the next character.
+func matchWildcard(pattern, text string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '%':
+			for i := len(text); i >= 0; i-- {
+				if matchWildcard(pattern[1:], text[i:]) {
+					return true
+				}
+			}
+			return false
+		case '_':
+			if len(text) == 0 {
+				return false
+			}
+		case '\\':
+			if len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+		default:
+			if len(text) == 0 || text[0] != pattern[0] {
+				return false
+			}
+		}
+		pattern, text = pattern[1:], text[1:]
+	}
+	return len(text) == 0
+}
+
+// hostSpecificity orders the matched accounts like mysql, hosts without wildcards come first,
+// then the patterns whose first wildcard is later, `%` comes last.
+func hostSpecificity(pattern string) int {
+	if idx := strings.IndexAny(pattern, "%_"); idx >= 0 {
+		return idx
+	}
+	return math.MaxInt32
+}
+
+func valueString(value *proto.Value) string {
+	if value == nil || value.Val == nil {
+		return ""
+	}
+	if val, ok := value.Val.([]byte); ok {
+		return string(val)
+	}
+	return fmt.Sprint(value.Val)
+}
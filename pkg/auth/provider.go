@@ -0,0 +1,172 @@
+/*
+ * Copyright 2022 CECTC, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+
+	"github.com/cectc/dbpack/pkg/config"
+)
+
+// Provider provides the credentials of the users connecting to dbpack
+type Provider interface {
+	// GetCredential returns the credential of the user connecting from the host, or nil if
+	// the user does not exist, the host is the ip of the client, it is ignored by the providers
+	// whose users are not restricted to hosts.
+	GetCredential(ctx context.Context, user, host string) (*Credential, error)
+}
+
+// ProviderConfig is the config of the auth provider of a mysql listener
+type ProviderConfig struct {
+	// Type is one of `file`, `etcd` and `mysql`
+	Type   string            `yaml:"type" json:"type"`
+	Config config.Parameters `yaml:"config" json:"config"`
+}
+
+// NewProvider creates the auth provider, the users in the listener config are used if
+// no provider is configured.
+func NewProvider(appID string, conf *ProviderConfig, users map[string]string) (Provider, error) {
+	if conf == nil {
+		return NewStaticProvider(users)
+	}
+	switch conf.Type {
+	case "file":
+		var fileConf struct {
+			Path string `json:"path"`
+		}
+		if err := unmarshalConfig(conf.Config, &fileConf); err != nil {
+			return nil, err
+		}
+		return NewFileProvider(fileConf.Path)
+	case "etcd":
+		var etcdConf EtcdProviderConfig
+		if err := unmarshalConfig(conf.Config, &etcdConf); err != nil {
+			return nil, err
+		}
+		return NewEtcdProvider(etcdConf)
+	case "mysql":
+		var mysqlConf struct {
+			DataSource string `json:"data_source"`
+		}
+		if err := unmarshalConfig(conf.Config, &mysqlConf); err != nil {
+			return nil, err
+		}
+		return NewMysqlProvider(appID, mysqlConf.DataSource), nil
+	default:
+		return nil, errors.Errorf("unsupported auth provider %s", conf.Type)
+	}
+}
+
+func unmarshalConfig(parameters config.Parameters, v interface{}) error {
+	content, err := json.Marshal(parameters)
+	if err != nil {
+		return errors.Wrap(err, "marshal auth provider config failed")
+	}
+	if err = json.Unmarshal(content, v); err != nil {
+		return errors.Wrap(err, "unmarshal auth provider config failed")
+	}
+	return nil
+}
+
+// staticProvider provides the users configured in the listener config
+type staticProvider struct {
+	credentials map[string]*Credential
+}
+
+// NewStaticProvider creates a provider of the users, the passwords can be plaintext or hashes, see ParseCredential.
+func NewStaticProvider(users map[string]string) (Provider, error) {
+	credentials, err := parseCredentials(users)
+	if err != nil {
+		return nil, err
+	}
+	return &staticProvider{credentials: credentials}, nil
+}
+
+func (p *staticProvider) GetCredential(_ context.Context, user, _ string) (*Credential, error) {
+	return p.credentials[user], nil
+}
+
+func parseCredentials(users map[string]string) (map[string]*Credential, error) {
+	credentials := make(map[string]*Credential, len(users))
+	for user, password := range users {
+		credential, err := ParseCredential(password)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid password of user %s", user)
+		}
+		credentials[user] = credential
+	}
+	return credentials, nil
+}
+
+// fileProvider provides the users in a yaml file of `user: password` pairs, the file
+// is reloaded when it is modified.
+type fileProvider struct {
+	path        string
+	mu          sync.Mutex
+	modTime     time.Time
+	credentials map[string]*Credential
+}
+
+func NewFileProvider(path string) (Provider, error) {
+	p := &fileProvider{path: path}
+	if err := p.reload(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *fileProvider) GetCredential(_ context.Context, user, _ string) (*Credential, error) {
+	if err := p.reload(); err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.credentials[user], nil
+}
+
+func (p *fileProvider) reload() error {
+	info, err := os.Stat(p.path)
+	if err != nil {
+		return errors.Wrap(err, "stat users file failed")
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if info.ModTime().Equal(p.modTime) && p.credentials != nil {
+		return nil
+	}
+	content, err := os.ReadFile(p.path)
+	if err != nil {
+		return errors.Wrap(err, "read users file failed")
+	}
+	var users map[string]string
+	if err = yaml.Unmarshal(content, &users); err != nil {
+		return errors.Wrap(err, "unmarshal users file failed")
+	}
+	credentials, err := parseCredentials(users)
+	if err != nil {
+		return err
+	}
+	p.credentials, p.modTime = credentials, info.ModTime()
+	return nil
+}
@@ -0,0 +1,205 @@
+/*
+ * Copyright 2022 CECTC, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package auth
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/cectc/dbpack/pkg/constant"
+	"github.com/cectc/dbpack/pkg/mysql"
+	"github.com/cectc/dbpack/pkg/proto"
+	"github.com/cectc/dbpack/pkg/resource"
+	"github.com/cectc/dbpack/testdata"
+	"github.com/cectc/dbpack/third_party/parser/ast"
+)
+
+func TestFileProvider(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.yaml")
+	assert.Nil(t, os.WriteFile(path, []byte("dksl: \"123456\"\n"), 0600))
+
+	provider, err := NewProvider("app1", &ProviderConfig{
+		Type:   "file",
+		Config: map[string]interface{}{"path": path},
+	}, nil)
+	assert.Nil(t, err)
+	credential, err := provider.GetCredential(context.Background(), "dksl", "127.0.0.1")
+	assert.Nil(t, err)
+	assert.True(t, credential.VerifyPassword([]byte("123456")))
+	credential, err = provider.GetCredential(context.Background(), "root", "127.0.0.1")
+	assert.Nil(t, err)
+	assert.Nil(t, credential)
+
+	assert.Nil(t, os.WriteFile(path, []byte("dksl: \"654321\"\nroot: \"\"\n"), 0600))
+	modTime := time.Now().Add(time.Second)
+	assert.Nil(t, os.Chtimes(path, modTime, modTime))
+	credential, err = provider.GetCredential(context.Background(), "dksl", "127.0.0.1")
+	assert.Nil(t, err)
+	assert.True(t, credential.VerifyPassword([]byte("654321")))
+	credential, err = provider.GetCredential(context.Background(), "root", "127.0.0.1")
+	assert.Nil(t, err)
+	assert.True(t, credential.Empty)
+}
+
+func TestMysqlProvider(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	userResult := func(accounts ...[3]string) *mysql.Result {
+		fields := []*mysql.Field{
+			{Name: "host", FieldType: constant.FieldTypeVarString},
+			{Name: "plugin", FieldType: constant.FieldTypeVarString},
+			{Name: "authentication_string", FieldType: constant.FieldTypeVarString},
+		}
+		rows := make([]proto.Row, 0, len(accounts))
+		for _, account := range accounts {
+			values := make([]*proto.Value, 0, len(account))
+			for _, value := range account {
+				values = append(values, &proto.Value{Typ: constant.FieldTypeVarString, Val: []byte(value), Raw: []byte(value)})
+			}
+			rows = append(rows, mysql.NewTextRow(fields, values))
+		}
+		return &mysql.Result{Rows: rows}
+	}
+
+	killed := make(chan struct{})
+	tx := testdata.NewMockTx(ctrl)
+	tx.EXPECT().QueryDirectly("SELECT CONNECTION_ID()").AnyTimes().
+		Return(&mysql.Result{Rows: []proto.Row{mysql.NewTextRow(
+			[]*mysql.Field{{Name: "CONNECTION_ID()", FieldType: constant.FieldTypeLongLong}},
+			[]*proto.Value{{Typ: constant.FieldTypeLongLong, Val: []byte("7"), Raw: []byte("7")}},
+		)}}, uint16(0), nil)
+	tx.EXPECT().ExecuteSqlDirectly(selectUser, "dksl").AnyTimes().
+		Return(userResult(
+			[3]string{"%", constant.MysqlNativePassword, "*6BB4837EB74329105EE4568DDA7DC67ED2CA2AD9"},
+			[3]string{"10.0.%", constant.CachingSha2Password, ""},
+			[3]string{"10.0.1.5", "auth_socket", ""},
+		), uint16(0), nil)
+	tx.EXPECT().ExecuteSqlDirectly(selectUser, "root").AnyTimes().
+		Return(userResult(
+			[3]string{"localhost", constant.CachingSha2Password, ""},
+			[3]string{"192.168.1.0/255.255.255.0", constant.MysqlNativePassword, "*6BB4837EB74329105EE4568DDA7DC67ED2CA2AD9"},
+		), uint16(0), nil)
+	tx.EXPECT().ExecuteSqlDirectly(selectUser, "unknown").Return(&mysql.Result{}, uint16(0), nil)
+	tx.EXPECT().ExecuteSqlDirectly(selectUser, "slow").DoAndReturn(func(sql string, args ...interface{}) (proto.Result, uint16, error) {
+		<-killed
+		return nil, 0, errors.New("Query execution was interrupted")
+	})
+	// the connection is released after every lookup, including the killed one
+	released := make(chan struct{}, 8)
+	tx.EXPECT().Rollback(gomock.Any(), nil).Times(8).DoAndReturn(func(ctx context.Context, stmt *ast.RollbackStmt) (proto.Result, error) {
+		released <- struct{}{}
+		return &mysql.Result{}, nil
+	})
+
+	db := testdata.NewMockDB(ctrl)
+	db.EXPECT().Begin(gomock.Any()).Times(8).Return(tx, &mysql.Result{}, nil)
+	db.EXPECT().QueryDirectly("KILL QUERY 7").DoAndReturn(func(query string) (proto.Result, uint16, error) {
+		close(killed)
+		return &mysql.Result{}, uint16(0), nil
+	})
+
+	manager := testdata.NewMockDBManager(ctrl)
+	manager.EXPECT().GetDB("employee").AnyTimes().Return(db)
+	resource.SetDBManager("app1", manager)
+
+	provider, err := NewProvider("app1", &ProviderConfig{
+		Type:   "mysql",
+		Config: map[string]interface{}{"data_source": "employee"},
+	}, nil)
+	assert.Nil(t, err)
+
+	credential, err := provider.GetCredential(context.Background(), "dksl", "172.16.0.1")
+	assert.Nil(t, err)
+	assert.True(t, credential.Supports(constant.MysqlNativePassword))
+	assert.True(t, credential.VerifyPassword([]byte("123456")))
+
+	// the account of the more specific host is chosen
+	credential, err = provider.GetCredential(context.Background(), "dksl", "10.0.2.1")
+	assert.Nil(t, err)
+	assert.True(t, credential.Empty)
+
+	// users of other auth plugins can't login by password
+	_, err = provider.GetCredential(context.Background(), "dksl", "10.0.1.5")
+	assert.NotNil(t, err)
+
+	credential, err = provider.GetCredential(context.Background(), "root", "127.0.0.1")
+	assert.Nil(t, err)
+	assert.True(t, credential.Empty)
+
+	credential, err = provider.GetCredential(context.Background(), "root", "192.168.1.20")
+	assert.Nil(t, err)
+	assert.True(t, credential.VerifyPassword([]byte("123456")))
+
+	credential, err = provider.GetCredential(context.Background(), "root", "192.168.2.20")
+	assert.Nil(t, err)
+	assert.Nil(t, credential)
+
+	credential, err = provider.GetCredential(context.Background(), "unknown", "127.0.0.1")
+	assert.Nil(t, err)
+	assert.Nil(t, credential)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = provider.GetCredential(ctx, "slow", "127.0.0.1")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	select {
+	case <-killed:
+	case <-time.After(time.Second):
+		t.Fatal("the lookup is not killed")
+	}
+	for i := 0; i < 8; i++ {
+		select {
+		case <-released:
+		case <-time.After(time.Second):
+			t.Fatal("the connection of the lookup is not released")
+		}
+	}
+}
+
+func TestMatchHost(t *testing.T) {
+	testCases := []struct {
+		pattern string
+		host    string
+		expect  bool
+	}{
+		{pattern: "%", host: "10.0.0.1", expect: true},
+		{pattern: "10.0.0.1", host: "10.0.0.1", expect: true},
+		{pattern: "10.0.0.1", host: "10.0.0.10", expect: false},
+		{pattern: "10.0.0._", host: "10.0.0.5", expect: true},
+		{pattern: "10.0.0._", host: "10.0.0.15", expect: false},
+		{pattern: "10.%.1", host: "10.2.3.1", expect: true},
+		{pattern: "localhost", host: "127.0.0.1", expect: true},
+		{pattern: "localhost", host: "::1", expect: true},
+		{pattern: "localhost", host: "10.0.0.1", expect: false},
+		{pattern: "10.0.0.0/255.255.0.0", host: "10.0.8.9", expect: true},
+		{pattern: "10.0.0.0/255.255.0.0", host: "10.1.8.9", expect: false},
+		{pattern: "db.example.com", host: "10.0.0.1", expect: false},
+	}
+	for _, c := range testCases {
+		t.Run(c.pattern+" "+c.host, func(t *testing.T) {
+			assert.Equal(t, c.expect, matchHost(c.pattern, c.host))
+		})
+	}
+}
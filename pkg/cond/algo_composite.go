@@ -0,0 +1,209 @@
+/*
+ * Copyright 2022 CECTC, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cond
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+
+	"github.com/cectc/dbpack/pkg/proto"
+	"github.com/cectc/dbpack/pkg/topo"
+)
+
+// CompositeSharding shards the databases and the tables in a database by separate algorithms
+// on different columns, e.g. the database is picked by tenant_id and the table in it by user_id.
+// The database algorithm routes to database indexes, the table algorithm routes to the table
+// positions in a database, so every database must have the same count of tables.
+type CompositeSharding struct {
+	allowFullScan  bool
+	topology       *topo.Topology
+	dbAlgorithm    ShardingAlgorithm
+	tableAlgorithm ShardingAlgorithm
+	// database index -> table indexes of the database
+	dbTables    [][]int
+	idGenerator proto.SequenceGenerator
+}
+
+func NewCompositeSharding(dbAlgorithm, dbShardingKey string, dbConfig map[string]interface{},
+	tableAlgorithm, tableShardingKey string, tableConfig map[string]interface{},
+	allowFullScan bool, topology *topo.Topology, generator proto.SequenceGenerator) (*CompositeSharding, error) {
+	dbCount := len(topology.Config)
+	dbTables := make([][]int, 0, dbCount)
+	for i := 0; i < dbCount; i++ {
+		tables := topology.DBs[fmt.Sprintf("%s_%d", topology.DBName, i)]
+		if i > 0 && len(tables) != len(dbTables[0]) {
+			return nil, errors.New("every database should have the same count of tables when sharding by database and table")
+		}
+		indexes := make([]int, 0, len(tables))
+		for _, table := range tables {
+			index, _ := topology.TableIndex(table)
+			indexes = append(indexes, index)
+		}
+		dbTables = append(dbTables, indexes)
+	}
+
+	// the database algorithm shards a topology whose tables are the databases
+	dbTopologyConfig := make(map[int]string, dbCount)
+	for i := 0; i < dbCount; i++ {
+		dbTopologyConfig[i] = fmt.Sprintf("%d", i)
+	}
+	dbTopology, err := topo.ParseTopology(topology.DBName, topology.DBName, dbTopologyConfig)
+	if err != nil {
+		return nil, err
+	}
+	// the table algorithm shards a topology with the tables of a single database
+	tableTopologyConfig := map[int]string{0: "0"}
+	if tableCount := len(dbTables[0]); tableCount > 1 {
+		tableTopologyConfig[0] = fmt.Sprintf("0-%d", tableCount-1)
+	}
+	tableTopology, err := topo.ParseTopology(topology.DBName, topology.TableName, tableTopologyConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	dbAlg, err := NewShardingAlgorithm(dbAlgorithm, dbShardingKey, allowFullScan, dbTopology, dbConfig, generator)
+	if err != nil {
+		return nil, errors.Wrap(err, "create database sharding algorithm failed")
+	}
+	tableAlg, err := NewShardingAlgorithm(tableAlgorithm, tableShardingKey, allowFullScan, tableTopology, tableConfig, generator)
+	if err != nil {
+		return nil, errors.Wrap(err, "create table sharding algorithm failed")
+	}
+	return &CompositeSharding{
+		allowFullScan:  allowFullScan,
+		topology:       topology,
+		dbAlgorithm:    dbAlg,
+		tableAlgorithm: tableAlg,
+		dbTables:       dbTables,
+		idGenerator:    generator,
+	}, nil
+}
+
+// DBAlgorithm returns the algorithm sharding databases
+func (shard *CompositeSharding) DBAlgorithm() ShardingAlgorithm {
+	return shard.dbAlgorithm
+}
+
+// TableAlgorithm returns the algorithm sharding tables in a database
+func (shard *CompositeSharding) TableAlgorithm() ShardingAlgorithm {
+	return shard.tableAlgorithm
+}
+
+func (shard *CompositeSharding) HasShardingKey(key string) bool {
+	return shard.dbAlgorithm.HasShardingKey(key) || shard.tableAlgorithm.HasShardingKey(key)
+}
+
+// Shard routes the condition of one dimension, the conditions of both dimensions are
+// intersected by ComplexCondition.Shard.
+func (shard *CompositeSharding) Shard(condition *KeyCondition) (Condition, error) {
+	if shard.dbAlgorithm.HasShardingKey(condition.Key) {
+		c, err := shard.dbAlgorithm.Shard(condition)
+		if err != nil {
+			return nil, err
+		}
+		return shard.dbCondition(c), nil
+	}
+	if shard.tableAlgorithm.HasShardingKey(condition.Key) {
+		c, err := shard.tableAlgorithm.Shard(condition)
+		if err != nil {
+			return nil, err
+		}
+		return shard.tableCondition(c), nil
+	}
+	return TrueCondition{}, nil
+}
+
+func (shard *CompositeSharding) ShardRange(cond1, cond2 *KeyCondition) (Condition, error) {
+	if shard.dbAlgorithm.HasShardingKey(cond1.Key) {
+		c, err := shard.dbAlgorithm.ShardRange(cond1, cond2)
+		if err != nil {
+			return nil, err
+		}
+		return shard.dbCondition(c), nil
+	}
+	if shard.tableAlgorithm.HasShardingKey(cond1.Key) {
+		c, err := shard.tableAlgorithm.ShardRange(cond1, cond2)
+		if err != nil {
+			return nil, err
+		}
+		return shard.tableCondition(c), nil
+	}
+	return TrueCondition{}, nil
+}
+
+// dbCondition converts the database indexes to the indexes of all tables in the databases
+func (shard *CompositeSharding) dbCondition(c Condition) Condition {
+	indexes, ok := c.(TableIndexSliceCondition)
+	if !ok {
+		return c
+	}
+	result := make([]int, 0)
+	for _, index := range indexes {
+		if index >= 0 && index < len(shard.dbTables) {
+			result = append(result, shard.dbTables[index]...)
+		}
+	}
+	return TableIndexSliceCondition(result)
+}
+
+// tableCondition converts the table positions to the indexes of the tables at the positions in all databases
+func (shard *CompositeSharding) tableCondition(c Condition) Condition {
+	positions, ok := c.(TableIndexSliceCondition)
+	if !ok {
+		return c
+	}
+	result := make([]int, 0)
+	for _, tables := range shard.dbTables {
+		for _, position := range positions {
+			if position >= 0 && position < len(tables) {
+				result = append(result, tables[position])
+			}
+		}
+	}
+	return TableIndexSliceCondition(result)
+}
+
+func (shard *CompositeSharding) AllShards() Condition {
+	return TableIndexSliceCondition(shard.topology.TableSlice)
+}
+
+func (shard *CompositeSharding) AllowFullScan() bool {
+	return shard.allowFullScan
+}
+
+func (shard *CompositeSharding) Topology() *topo.Topology {
+	return shard.topology
+}
+
+func (shard *CompositeSharding) Equal(algorithm ShardingAlgorithm) bool {
+	if algo, ok := algorithm.(*CompositeSharding); ok {
+		if shard.dbAlgorithm.Equal(algo.dbAlgorithm) &&
+			shard.tableAlgorithm.Equal(algo.tableAlgorithm) &&
+			shard.topology.Equal(algo.topology) {
+			return true
+		}
+	}
+	return false
+}
+
+func (shard *CompositeSharding) NextID() (int64, error) {
+	if shard.idGenerator != nil {
+		return shard.idGenerator.NextID()
+	}
+	return 0, errors.New("there is no sequence generator")
+}
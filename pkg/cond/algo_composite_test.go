@@ -0,0 +1,94 @@
+/*
+ * Copyright 2022 CECTC, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cond
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/cectc/dbpack/pkg/topo"
+	"github.com/cectc/dbpack/third_party/parser"
+	"github.com/cectc/dbpack/third_party/parser/ast"
+)
+
+func mockCompositeSharding(t *testing.T, tableName string) *CompositeSharding {
+	topology, err := topo.ParseTopology("order", tableName, map[int]string{
+		0: "0-3",
+		1: "4-7",
+	})
+	assert.Nil(t, err)
+	alg, err := NewCompositeSharding("NumberMod", "tenant_id", nil,
+		"NumberMod", "user_id", nil, true, topology, nil)
+	assert.Nil(t, err)
+	return alg
+}
+
+func TestCompositeShardingShard(t *testing.T) {
+	alg := mockCompositeSharding(t, "order")
+	testCases := []struct {
+		where  string
+		expect TableIndexSliceCondition
+	}{
+		{where: "tenant_id = 1 and user_id = 6", expect: TableIndexSliceCondition{6}},
+		{where: "user_id = 6 and tenant_id = 1", expect: TableIndexSliceCondition{6}},
+		{where: "tenant_id = 3", expect: TableIndexSliceCondition{4, 5, 6, 7}},
+		{where: "user_id = 5", expect: TableIndexSliceCondition{1, 5}},
+		{where: "tenant_id = 0 and user_id in (1, 2)", expect: TableIndexSliceCondition{1, 2}},
+		{where: "tenant_id = 0 and (user_id = 1 or user_id = 2 or user_id = 3)", expect: TableIndexSliceCondition{1, 2, 3}},
+		{where: "tenant_id = 1 and user_id between 1 and 2", expect: TableIndexSliceCondition{5, 6}},
+		{where: "tenant_id = 1 and user_id = 6 and id = 100", expect: TableIndexSliceCondition{6}},
+		{where: "id = 100", expect: TableIndexSliceCondition{0, 1, 2, 3, 4, 5, 6, 7}},
+	}
+	for _, c := range testCases {
+		t.Run(c.where, func(t *testing.T) {
+			stmt, err := parser.New().ParseOneStmt("select * from t where "+c.where, "", "")
+			assert.Nil(t, err)
+			condition, err := ParseCondition(stmt.(*ast.SelectStmt).Where)
+			assert.Nil(t, err)
+			shards, err := condition.(ConditionShard).Shard(alg)
+			assert.Nil(t, err)
+			assert.ElementsMatch(t, c.expect, shards)
+		})
+	}
+}
+
+func TestCompositeShardingEqual(t *testing.T) {
+	order := mockCompositeSharding(t, "order")
+	item := mockCompositeSharding(t, "order_item")
+	assert.True(t, order.Equal(item))
+	assert.True(t, order.HasShardingKey("o.tenant_id"))
+	assert.True(t, order.HasShardingKey("user_id"))
+	assert.False(t, order.HasShardingKey("id"))
+
+	topology, _ := topo.ParseTopology("order", "order", map[int]string{
+		0: "0-3",
+		1: "4-7",
+	})
+	hashMod, err := NewCompositeSharding("HashMod", "tenant_id", nil,
+		"NumberMod", "user_id", nil, true, topology, nil)
+	assert.Nil(t, err)
+	assert.False(t, order.Equal(hashMod))
+
+	unbalanced, _ := topo.ParseTopology("order", "order", map[int]string{
+		0: "0-3",
+		1: "4-6",
+	})
+	_, err = NewCompositeSharding("NumberMod", "tenant_id", nil,
+		"NumberMod", "user_id", nil, true, unbalanced, nil)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,195 @@
+/*
+ * Copyright 2022 CECTC, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cond
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/cectc/dbpack/pkg/misc"
+	"github.com/cectc/dbpack/pkg/proto"
+	"github.com/cectc/dbpack/pkg/topo"
+	"github.com/cectc/dbpack/third_party/parser/opcode"
+)
+
+const (
+	defaultVirtualNodes = 160
+
+	virtualNodesConfigKey = "virtual_nodes"
+)
+
+type virtualNode struct {
+	hash  uint64
+	index int
+}
+
+// ConsistentHash shards by a hash ring, every table owns `virtual_nodes` virtual nodes on the ring,
+// e.g. config: {"hash": "xxhash", "virtual_nodes": 160}.
+type ConsistentHash struct {
+	shardingKey   string
+	allowFullScan bool
+	topology      *topo.Topology
+	hashName      string
+	hash          hashFunc
+	virtualNodes  int
+	ring          []*virtualNode
+	idGenerator   proto.SequenceGenerator
+}
+
+func NewConsistentHash(shardingKey string,
+	allowFullScan bool,
+	topology *topo.Topology,
+	config map[string]interface{},
+	generator proto.SequenceGenerator) (*ConsistentHash, error) {
+	hashName, hash, err := parseHashConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	virtualNodes, err := parseVirtualNodes(config)
+	if err != nil {
+		return nil, err
+	}
+	algo := &ConsistentHash{
+		shardingKey:   shardingKey,
+		allowFullScan: allowFullScan,
+		topology:      topology,
+		hashName:      hashName,
+		hash:          hash,
+		virtualNodes:  virtualNodes,
+		idGenerator:   generator,
+	}
+	algo.buildRing()
+	return algo, nil
+}
+
+// buildRing places the virtual nodes of the tables on the ring, the virtual nodes are named by
+// table index, so that logic tables with the same topology have the same ring.
+func (shard *ConsistentHash) buildRing() {
+	shard.ring = make([]*virtualNode, 0, shard.topology.TableSliceLen*shard.virtualNodes)
+	for _, index := range shard.topology.TableSlice {
+		for i := 0; i < shard.virtualNodes; i++ {
+			shard.ring = append(shard.ring, &virtualNode{
+				hash:  shard.hash([]byte(fmt.Sprintf("%d#%d", index, i))),
+				index: index,
+			})
+		}
+	}
+	sort.Slice(shard.ring, func(i, j int) bool {
+		if shard.ring[i].hash == shard.ring[j].hash {
+			return shard.ring[i].index < shard.ring[j].index
+		}
+		return shard.ring[i].hash < shard.ring[j].hash
+	})
+}
+
+func (shard *ConsistentHash) HasShardingKey(key string) bool {
+	conditionKey := misc.ParseColumn(key)
+	return strings.EqualFold(shard.shardingKey, conditionKey)
+}
+
+func (shard *ConsistentHash) Shard(condition *KeyCondition) (Condition, error) {
+	conditionKey := misc.ParseColumn(condition.Key)
+	if !strings.EqualFold(shard.shardingKey, conditionKey) {
+		return TrueCondition{}, nil
+	}
+	switch condition.Op {
+	case opcode.EQ:
+		return TableIndexSliceCondition([]int{shard.locate(hashKey(condition.Value))}), nil
+	default:
+		// hash values are not ordered, all shards should be scanned
+		return TrueCondition{}, nil
+	}
+}
+
+// locate returns the table index of the first virtual node clockwise from the hash of the key
+func (shard *ConsistentHash) locate(key []byte) int {
+	hashCode := shard.hash(key)
+	i := sort.Search(len(shard.ring), func(i int) bool {
+		return shard.ring[i].hash >= hashCode
+	})
+	if i == len(shard.ring) {
+		i = 0
+	}
+	return shard.ring[i].index
+}
+
+func (shard *ConsistentHash) ShardRange(cond1, cond2 *KeyCondition) (Condition, error) {
+	return TrueCondition{}, nil
+}
+
+func (shard *ConsistentHash) AllShards() Condition {
+	return TableIndexSliceCondition(shard.topology.TableSlice)
+}
+
+func (shard *ConsistentHash) AllowFullScan() bool {
+	return shard.allowFullScan
+}
+
+func (shard *ConsistentHash) Topology() *topo.Topology {
+	return shard.topology
+}
+
+func (shard *ConsistentHash) Equal(algorithm ShardingAlgorithm) bool {
+	if algo, ok := algorithm.(*ConsistentHash); ok {
+		if shard.hashName == algo.hashName &&
+			shard.virtualNodes == algo.virtualNodes &&
+			shard.topology.Equal(algo.topology) {
+			return true
+		}
+	}
+	return false
+}
+
+func (shard *ConsistentHash) NextID() (int64, error) {
+	if shard.idGenerator != nil {
+		return shard.idGenerator.NextID()
+	}
+	return 0, errors.New("there is no sequence generator")
+}
+
+func parseVirtualNodes(config map[string]interface{}) (int, error) {
+	value, ok := config[virtualNodesConfigKey]
+	if !ok {
+		return defaultVirtualNodes, nil
+	}
+	var (
+		virtualNodes int
+		err          error
+	)
+	switch val := value.(type) {
+	case int:
+		virtualNodes = val
+	case int64:
+		virtualNodes = int(val)
+	case float64:
+		virtualNodes = int(val)
+	case string:
+		if virtualNodes, err = strconv.Atoi(val); err != nil {
+			return 0, errors.Wrapf(err, "incorrect virtual nodes %s", val)
+		}
+	default:
+		return 0, errors.Errorf("incorrect virtual nodes %v", value)
+	}
+	if virtualNodes <= 0 {
+		return 0, errors.Errorf("virtual nodes must be greater than 0")
+	}
+	return virtualNodes, nil
+}
@@ -0,0 +1,115 @@
+/*
+ * Copyright 2022 CECTC, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cond
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/cectc/dbpack/pkg/topo"
+	"github.com/cectc/dbpack/third_party/parser/opcode"
+)
+
+func TestConsistentHash(t *testing.T) {
+	alg, err := NewShardingAlgorithm("ConsistentHash", "code", false, mockHashTopology("city"),
+		map[string]interface{}{"virtual_nodes": 100}, nil)
+	assert.Nil(t, err)
+
+	counts := make(map[int]int)
+	for i := 0; i < 8000; i++ {
+		value := fmt.Sprintf("user-%d", i)
+		condition, err := alg.Shard(&KeyCondition{Key: "code", Op: opcode.EQ, Value: value})
+		assert.Nil(t, err)
+		indexes := condition.(TableIndexSliceCondition)
+		assert.Equal(t, 1, len(indexes))
+		counts[indexes[0]]++
+
+		// the same value is always routed to the same table
+		again, _ := alg.Shard(&KeyCondition{Key: "code", Op: opcode.EQ, Value: []byte(value)})
+		assert.Equal(t, condition, again)
+	}
+	assert.Equal(t, 8, len(counts))
+	for _, count := range counts {
+		assert.Greater(t, count, 500)
+	}
+
+	condition, err := alg.Shard(&KeyCondition{Key: "code", Op: opcode.NE, Value: "a"})
+	assert.Nil(t, err)
+	assert.Equal(t, TrueCondition{}, condition)
+	condition, err = alg.ShardRange(&KeyCondition{Key: "code", Op: opcode.GT, Value: "a"},
+		&KeyCondition{Key: "code", Op: opcode.LT, Value: "b"})
+	assert.Nil(t, err)
+	assert.Equal(t, TrueCondition{}, condition)
+}
+
+func TestConsistentHashAddTable(t *testing.T) {
+	alg, _ := NewConsistentHash("code", false, mockHashTopology("city"), nil, nil)
+	topology, _ := topo.ParseTopology("world", "city", map[int]string{
+		0: "0-3",
+		1: "4-8",
+	})
+	expanded, _ := NewConsistentHash("code", false, topology, nil, nil)
+
+	// only the keys moved to the new table change their tables
+	moved := 0
+	for i := 0; i < 9000; i++ {
+		key := []byte(fmt.Sprintf("user-%d", i))
+		before, after := alg.locate(key), expanded.locate(key)
+		if before != after {
+			assert.Equal(t, 8, after)
+			moved++
+		}
+	}
+	assert.Less(t, moved, 2000)
+}
+
+func TestParseVirtualNodes(t *testing.T) {
+	testCases := []struct {
+		config map[string]interface{}
+		expect int
+		hasErr bool
+	}{
+		{config: nil, expect: defaultVirtualNodes},
+		{config: map[string]interface{}{"virtual_nodes": 10}, expect: 10},
+		{config: map[string]interface{}{"virtual_nodes": float64(20)}, expect: 20},
+		{config: map[string]interface{}{"virtual_nodes": "30"}, expect: 30},
+		{config: map[string]interface{}{"virtual_nodes": 0}, hasErr: true},
+		{config: map[string]interface{}{"virtual_nodes": "a"}, hasErr: true},
+	}
+	for _, c := range testCases {
+		virtualNodes, err := parseVirtualNodes(c.config)
+		if c.hasErr {
+			assert.NotNil(t, err)
+			continue
+		}
+		assert.Nil(t, err)
+		assert.Equal(t, c.expect, virtualNodes)
+	}
+}
+
+func TestConsistentHashEqual(t *testing.T) {
+	city, _ := NewConsistentHash("code", false, mockHashTopology("city"), nil, nil)
+	country, _ := NewConsistentHash("country_code", false, mockHashTopology("country"), nil, nil)
+	language, _ := NewConsistentHash("code", false, mockHashTopology("language"),
+		map[string]interface{}{"virtual_nodes": 10}, nil)
+	assert.True(t, city.Equal(country))
+	assert.False(t, city.Equal(language))
+	hashMod, _ := NewHashMod("code", false, mockHashTopology("city"), nil, nil)
+	assert.False(t, city.Equal(hashMod))
+}
@@ -0,0 +1,411 @@
+/*
+ * Copyright 2022 CECTC, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cond
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/cectc/dbpack/pkg/misc"
+	"github.com/cectc/dbpack/pkg/proto"
+	"github.com/cectc/dbpack/pkg/topo"
+	"github.com/cectc/dbpack/third_party/parser/opcode"
+)
+
+const (
+	DateUnitYear  = "year"
+	DateUnitMonth = "month"
+	DateUnitWeek  = "week"
+	DateUnitDay   = "day"
+
+	dateUnitConfigKey  = "unit"
+	dateStartConfigKey = "start"
+)
+
+var dateLayouts = []string{
+	"2006-01-02 15:04:05.999999",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05Z07:00",
+	"2006-01-02",
+	"20060102150405",
+	"20060102",
+}
+
+// DateRange shards by the count of time units between the sharding key value and the start date,
+// e.g. config: {"unit": "month", "start": "2026-01-01"}, 2026-01-xx is in table 0, 2026-02-xx
+// is in table 1, the values out of the tables are not routed to any table.
+type DateRange struct {
+	shardingKey   string
+	allowFullScan bool
+	topology      *topo.Topology
+	unit          string
+	start         time.Time
+	idGenerator   proto.SequenceGenerator
+}
+
+func NewDateRange(shardingKey string,
+	allowFullScan bool,
+	topology *topo.Topology,
+	config map[string]interface{},
+	generator proto.SequenceGenerator) (*DateRange, error) {
+	unit, err := parseDateUnit(config)
+	if err != nil {
+		return nil, err
+	}
+	value, ok := config[dateStartConfigKey]
+	if !ok {
+		return nil, errors.New("date range sharding algorithm must have a start date")
+	}
+	start, err := parseDate(value)
+	if err != nil {
+		return nil, err
+	}
+	return &DateRange{
+		shardingKey:   shardingKey,
+		allowFullScan: allowFullScan,
+		topology:      topology,
+		unit:          unit,
+		start:         start,
+		idGenerator:   generator,
+	}, nil
+}
+
+func (shard *DateRange) HasShardingKey(key string) bool {
+	conditionKey := misc.ParseColumn(key)
+	return strings.EqualFold(shard.shardingKey, conditionKey)
+}
+
+func (shard *DateRange) Shard(condition *KeyCondition) (Condition, error) {
+	conditionKey := misc.ParseColumn(condition.Key)
+	if !strings.EqualFold(shard.shardingKey, conditionKey) {
+		return TrueCondition{}, nil
+	}
+	date, err := parseDate(condition.Value)
+	if err != nil {
+		return nil, err
+	}
+	idx := shard.index(date)
+	switch condition.Op {
+	case opcode.EQ:
+		return shard.indexRange(idx, idx), nil
+	case opcode.LT, opcode.LE:
+		return shard.indexRange(0, idx), nil
+	case opcode.GT, opcode.GE:
+		return shard.indexRange(idx, shard.topology.TableSliceLen-1), nil
+	}
+	return TrueCondition{}, nil
+}
+
+func (shard *DateRange) ShardRange(cond1, cond2 *KeyCondition) (Condition, error) {
+	conditionKey := misc.ParseColumn(cond1.Key)
+	if !strings.EqualFold(shard.shardingKey, conditionKey) {
+		return TrueCondition{}, nil
+	}
+	if cond1.Op == opcode.NE {
+		// a <> '2026-01-01' and a < '2026-03-01' => a < '2026-03-01'
+		return shard.Shard(cond2)
+	}
+	begin, err := parseDate(cond1.Value)
+	if err != nil {
+		return nil, err
+	}
+	end, err := parseDate(cond2.Value)
+	if err != nil {
+		return nil, err
+	}
+	return shard.indexRange(shard.index(begin), shard.index(end)), nil
+}
+
+// index returns the table index of the date, it may be out of the tables
+func (shard *DateRange) index(date time.Time) int {
+	switch shard.unit {
+	case DateUnitYear:
+		return date.Year() - shard.start.Year()
+	case DateUnitMonth:
+		return (date.Year()-shard.start.Year())*12 + int(date.Month()) - int(shard.start.Month())
+	case DateUnitWeek:
+		// weeks start on monday
+		startWeek := truncateDay(shard.start).AddDate(0, 0, -(int(shard.start.Weekday())+6)%7)
+		return floorDiv(daysBetween(startWeek, date), 7)
+	default:
+		return daysBetween(shard.start, date)
+	}
+}
+
+func (shard *DateRange) indexRange(begin, end int) Condition {
+	if begin < 0 {
+		begin = 0
+	}
+	if end > shard.topology.TableSliceLen-1 {
+		end = shard.topology.TableSliceLen - 1
+	}
+	if begin > end {
+		return FalseCondition{}
+	}
+	result := make([]int, 0, end-begin+1)
+	for i := begin; i <= end; i++ {
+		result = append(result, i)
+	}
+	return TableIndexSliceCondition(result)
+}
+
+func (shard *DateRange) AllShards() Condition {
+	return TableIndexSliceCondition(shard.topology.TableSlice)
+}
+
+func (shard *DateRange) AllowFullScan() bool {
+	return shard.allowFullScan
+}
+
+func (shard *DateRange) Topology() *topo.Topology {
+	return shard.topology
+}
+
+func (shard *DateRange) Equal(algorithm ShardingAlgorithm) bool {
+	if algo, ok := algorithm.(*DateRange); ok {
+		if shard.unit == algo.unit &&
+			shard.start.Equal(algo.start) &&
+			shard.topology.Equal(algo.topology) {
+			return true
+		}
+	}
+	return false
+}
+
+func (shard *DateRange) NextID() (int64, error) {
+	if shard.idGenerator != nil {
+		return shard.idGenerator.NextID()
+	}
+	return 0, errors.New("there is no sequence generator")
+}
+
+// DateMod shards by the time unit of the sharding key value modulo the table count, e.g. config:
+// {"unit": "month"}, the time unit is the year, the month of year, the ISO week of year or the day of month.
+type DateMod struct {
+	shardingKey   string
+	allowFullScan bool
+	topology      *topo.Topology
+	unit          string
+	idGenerator   proto.SequenceGenerator
+}
+
+func NewDateMod(shardingKey string,
+	allowFullScan bool,
+	topology *topo.Topology,
+	config map[string]interface{},
+	generator proto.SequenceGenerator) (*DateMod, error) {
+	unit, err := parseDateUnit(config)
+	if err != nil {
+		return nil, err
+	}
+	return &DateMod{
+		shardingKey:   shardingKey,
+		allowFullScan: allowFullScan,
+		topology:      topology,
+		unit:          unit,
+		idGenerator:   generator,
+	}, nil
+}
+
+func (shard *DateMod) HasShardingKey(key string) bool {
+	conditionKey := misc.ParseColumn(key)
+	return strings.EqualFold(shard.shardingKey, conditionKey)
+}
+
+func (shard *DateMod) Shard(condition *KeyCondition) (Condition, error) {
+	conditionKey := misc.ParseColumn(condition.Key)
+	if !strings.EqualFold(shard.shardingKey, conditionKey) {
+		return TrueCondition{}, nil
+	}
+	if condition.Op != opcode.EQ {
+		return TrueCondition{}, nil
+	}
+	date, err := parseDate(condition.Value)
+	if err != nil {
+		return nil, err
+	}
+	return TableIndexSliceCondition([]int{shard.index(date)}), nil
+}
+
+func (shard *DateMod) ShardRange(cond1, cond2 *KeyCondition) (Condition, error) {
+	conditionKey := misc.ParseColumn(cond1.Key)
+	if !strings.EqualFold(shard.shardingKey, conditionKey) || cond1.Op == opcode.NE {
+		return TrueCondition{}, nil
+	}
+	begin, err := parseDate(cond1.Value)
+	if err != nil {
+		return nil, err
+	}
+	end, err := parseDate(cond2.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		indexMap = make(map[int]bool)
+		result   = make([]int, 0)
+		date     = shard.truncate(begin)
+	)
+	for !date.After(end) {
+		idx := shard.index(date)
+		if !indexMap[idx] {
+			indexMap[idx] = true
+			result = append(result, idx)
+		}
+		if len(result) == shard.topology.TableSliceLen {
+			return TrueCondition{}, nil
+		}
+		date = shard.next(date)
+		// the range covers a whole cycle of the time unit
+		if shard.unit != DateUnitYear && date.Sub(begin) > 366*24*time.Hour {
+			return TrueCondition{}, nil
+		}
+	}
+	return TableIndexSliceCondition(result), nil
+}
+
+func (shard *DateMod) index(date time.Time) int {
+	var value int
+	switch shard.unit {
+	case DateUnitYear:
+		value = date.Year()
+	case DateUnitMonth:
+		value = int(date.Month()) - 1
+	case DateUnitWeek:
+		_, week := date.ISOWeek()
+		value = week - 1
+	default:
+		value = date.Day() - 1
+	}
+	return value % shard.topology.TableSliceLen
+}
+
+// truncate returns the beginning of the time unit of the date
+func (shard *DateMod) truncate(date time.Time) time.Time {
+	switch shard.unit {
+	case DateUnitYear:
+		return time.Date(date.Year(), time.January, 1, 0, 0, 0, 0, date.Location())
+	case DateUnitMonth:
+		return time.Date(date.Year(), date.Month(), 1, 0, 0, 0, 0, date.Location())
+	case DateUnitWeek:
+		return truncateDay(date).AddDate(0, 0, -(int(date.Weekday())+6)%7)
+	default:
+		return truncateDay(date)
+	}
+}
+
+func (shard *DateMod) next(date time.Time) time.Time {
+	switch shard.unit {
+	case DateUnitYear:
+		return date.AddDate(1, 0, 0)
+	case DateUnitMonth:
+		return date.AddDate(0, 1, 0)
+	case DateUnitWeek:
+		return date.AddDate(0, 0, 7)
+	default:
+		return date.AddDate(0, 0, 1)
+	}
+}
+
+func (shard *DateMod) AllShards() Condition {
+	return TableIndexSliceCondition(shard.topology.TableSlice)
+}
+
+func (shard *DateMod) AllowFullScan() bool {
+	return shard.allowFullScan
+}
+
+func (shard *DateMod) Topology() *topo.Topology {
+	return shard.topology
+}
+
+func (shard *DateMod) Equal(algorithm ShardingAlgorithm) bool {
+	if algo, ok := algorithm.(*DateMod); ok {
+		if shard.unit == algo.unit &&
+			shard.topology.Equal(algo.topology) {
+			return true
+		}
+	}
+	return false
+}
+
+func (shard *DateMod) NextID() (int64, error) {
+	if shard.idGenerator != nil {
+		return shard.idGenerator.NextID()
+	}
+	return 0, errors.New("there is no sequence generator")
+}
+
+func parseDateUnit(config map[string]interface{}) (string, error) {
+	value, ok := config[dateUnitConfigKey]
+	if !ok {
+		return "", errors.New("date sharding algorithm must have a time unit")
+	}
+	unit, ok := value.(string)
+	if !ok {
+		return "", errors.Errorf("incorrect time unit %v", value)
+	}
+	unit = strings.ToLower(unit)
+	switch unit {
+	case DateUnitYear, DateUnitMonth, DateUnitWeek, DateUnitDay:
+		return unit, nil
+	}
+	return "", errors.Errorf("unsupported time unit: %s", unit)
+}
+
+// parseDate parses the DATE or DATETIME value, the time zone of the value is ignored.
+func parseDate(value interface{}) (time.Time, error) {
+	var str string
+	switch val := value.(type) {
+	case time.Time:
+		return val, nil
+	case []byte:
+		str = string(val)
+	case string:
+		str = val
+	default:
+		str = fmt.Sprintf("%v", value)
+	}
+	str = strings.Trim(strings.TrimSpace(str), "'\"")
+	for _, layout := range dateLayouts {
+		if date, err := time.Parse(layout, str); err == nil {
+			return date, nil
+		}
+	}
+	return time.Time{}, errors.Errorf("incorrect date value: %v", value)
+}
+
+func truncateDay(date time.Time) time.Time {
+	return time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, date.Location())
+}
+
+// daysBetween returns the count of days from the date of begin to the date of end
+func daysBetween(begin, end time.Time) int {
+	from := time.Date(begin.Year(), begin.Month(), begin.Day(), 0, 0, 0, 0, time.UTC)
+	to := time.Date(end.Year(), end.Month(), end.Day(), 0, 0, 0, 0, time.UTC)
+	return int(to.Sub(from).Hours() / 24)
+}
+
+func floorDiv(a, b int) int {
+	if a < 0 && a%b != 0 {
+		return a/b - 1
+	}
+	return a / b
+}
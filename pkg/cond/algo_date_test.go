@@ -0,0 +1,147 @@
+/*
+ * Copyright 2022 CECTC, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cond
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/cectc/dbpack/pkg/topo"
+	"github.com/cectc/dbpack/third_party/parser/opcode"
+)
+
+func mockMonthTopology() *topo.Topology {
+	topology, _ := topo.ParseTopologyWithSuffixes("log", "log", map[int]string{
+		0: "0-5",
+		1: "6-11",
+	}, []string{"202601", "202602", "202603", "202604", "202605", "202606",
+		"202607", "202608", "202609", "202610", "202611", "202612"})
+	return topology
+}
+
+func TestDateRange(t *testing.T) {
+	alg, err := NewShardingAlgorithm("DateRange", "created_at", false, mockMonthTopology(),
+		map[string]interface{}{"unit": "month", "start": "2026-01-01"}, nil)
+	assert.Nil(t, err)
+
+	testCases := []struct {
+		op     opcode.Op
+		value  interface{}
+		expect Condition
+	}{
+		{op: opcode.EQ, value: "2026-03-15 10:20:30", expect: TableIndexSliceCondition{2}},
+		{op: opcode.EQ, value: []byte("2026-12-31"), expect: TableIndexSliceCondition{11}},
+		{op: opcode.EQ, value: time.Date(2026, 5, 1, 0, 0, 0, 0, time.Local), expect: TableIndexSliceCondition{4}},
+		{op: opcode.EQ, value: "2025-12-31", expect: FalseCondition{}},
+		{op: opcode.LT, value: "2026-03-01", expect: TableIndexSliceCondition{0, 1, 2}},
+		{op: opcode.GE, value: "2026-10-20", expect: TableIndexSliceCondition{9, 10, 11}},
+		{op: opcode.GT, value: "2027-01-01", expect: FalseCondition{}},
+		{op: opcode.NE, value: "2026-01-01", expect: TrueCondition{}},
+	}
+	for _, c := range testCases {
+		condition, err := alg.Shard(&KeyCondition{Key: "created_at", Op: c.op, Value: c.value})
+		assert.Nil(t, err)
+		assert.Equal(t, c.expect, condition)
+	}
+
+	condition, err := alg.ShardRange(&KeyCondition{Key: "created_at", Op: opcode.GE, Value: "2025-11-01"},
+		&KeyCondition{Key: "created_at", Op: opcode.LE, Value: "2026-02-10 23:59:59"})
+	assert.Nil(t, err)
+	assert.Equal(t, TableIndexSliceCondition{0, 1}, condition)
+
+	_, err = alg.Shard(&KeyCondition{Key: "created_at", Op: opcode.EQ, Value: "yesterday"})
+	assert.NotNil(t, err)
+}
+
+func TestDateRangeIndex(t *testing.T) {
+	topology, _ := topo.ParseTopology("log", "log", map[int]string{0: "0-9"})
+	start := "2026-01-07" // wednesday
+	testCases := []struct {
+		unit   string
+		value  string
+		expect int
+	}{
+		{unit: DateUnitYear, value: "2028-06-01", expect: 2},
+		{unit: DateUnitMonth, value: "2027-02-01", expect: 13},
+		{unit: DateUnitWeek, value: "2026-01-05", expect: 0},
+		{unit: DateUnitWeek, value: "2026-01-12", expect: 1},
+		{unit: DateUnitWeek, value: "2026-01-04", expect: -1},
+		{unit: DateUnitDay, value: "2026-01-09 23:00:00", expect: 2},
+		{unit: DateUnitDay, value: "2026-01-06", expect: -1},
+	}
+	for _, c := range testCases {
+		alg, err := NewDateRange("created_at", false, topology,
+			map[string]interface{}{"unit": c.unit, "start": start}, nil)
+		assert.Nil(t, err)
+		date, err := parseDate(c.value)
+		assert.Nil(t, err)
+		assert.Equal(t, c.expect, alg.index(date), c.unit+" "+c.value)
+	}
+}
+
+func TestDateMod(t *testing.T) {
+	topology, _ := topo.ParseTopology("log", "log", map[int]string{0: "0-3"})
+	alg, err := NewShardingAlgorithm("DateMod", "created_at", false, topology,
+		map[string]interface{}{"unit": "Month"}, nil)
+	assert.Nil(t, err)
+
+	condition, err := alg.Shard(&KeyCondition{Key: "created_at", Op: opcode.EQ, Value: "2026-06-15"})
+	assert.Nil(t, err)
+	assert.Equal(t, TableIndexSliceCondition{1}, condition)
+
+	condition, err = alg.Shard(&KeyCondition{Key: "created_at", Op: opcode.GT, Value: "2026-06-15"})
+	assert.Nil(t, err)
+	assert.Equal(t, TrueCondition{}, condition)
+
+	condition, err = alg.ShardRange(&KeyCondition{Key: "created_at", Op: opcode.GE, Value: "2026-01-31"},
+		&KeyCondition{Key: "created_at", Op: opcode.LE, Value: "2026-02-28"})
+	assert.Nil(t, err)
+	assert.Equal(t, TableIndexSliceCondition{0, 1}, condition)
+
+	condition, err = alg.ShardRange(&KeyCondition{Key: "created_at", Op: opcode.GE, Value: "2026-01-01"},
+		&KeyCondition{Key: "created_at", Op: opcode.LT, Value: "2026-12-01"})
+	assert.Nil(t, err)
+	assert.Equal(t, TrueCondition{}, condition)
+
+	dayMod, err := NewDateMod("created_at", false, topology, map[string]interface{}{"unit": "day"}, nil)
+	assert.Nil(t, err)
+	condition, err = dayMod.ShardRange(&KeyCondition{Key: "created_at", Op: opcode.GE, Value: "2026-01-30 12:00:00"},
+		&KeyCondition{Key: "created_at", Op: opcode.LE, Value: "2026-02-01"})
+	assert.Nil(t, err)
+	assert.Equal(t, TableIndexSliceCondition{1, 2, 0}, condition)
+
+	_, err = NewDateMod("created_at", false, topology, map[string]interface{}{"unit": "hour"}, nil)
+	assert.NotNil(t, err)
+	_, err = NewDateRange("created_at", false, topology, map[string]interface{}{"unit": "day"}, nil)
+	assert.NotNil(t, err)
+}
+
+func TestDateAlgorithmEqual(t *testing.T) {
+	topology, _ := topo.ParseTopology("log", "log", map[int]string{0: "0-3"})
+	range1, _ := NewDateRange("created_at", false, topology, map[string]interface{}{"unit": "day", "start": "2026-01-01"}, nil)
+	range2, _ := NewDateRange("updated_at", false, topology, map[string]interface{}{"unit": "day", "start": "2026-01-01 00:00:00"}, nil)
+	range3, _ := NewDateRange("created_at", false, topology, map[string]interface{}{"unit": "day", "start": "2026-01-02"}, nil)
+	mod1, _ := NewDateMod("created_at", false, topology, map[string]interface{}{"unit": "day"}, nil)
+	mod2, _ := NewDateMod("created_at", false, topology, map[string]interface{}{"unit": "week"}, nil)
+	assert.True(t, range1.Equal(range2))
+	assert.False(t, range1.Equal(range3))
+	assert.False(t, range1.Equal(mod1))
+	assert.False(t, mod1.Equal(mod2))
+	assert.False(t, mockMonthTopology().Equal(topology))
+}
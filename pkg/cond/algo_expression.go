@@ -0,0 +1,316 @@
+/*
+ * Copyright 2022 CECTC, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cond
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/dop251/goja"
+	"github.com/pkg/errors"
+
+	"github.com/cectc/dbpack/pkg/function"
+	"github.com/cectc/dbpack/pkg/misc"
+	"github.com/cectc/dbpack/pkg/proto"
+	"github.com/cectc/dbpack/pkg/topo"
+	"github.com/cectc/dbpack/third_party/parser/opcode"
+	"github.com/cectc/dbpack/third_party/types"
+)
+
+const (
+	expressionConfigKey = "expression"
+	scriptConfigKey     = "script"
+	monotonicConfigKey  = "monotonic"
+
+	// maxEnumerateValues is the max count of integers enumerated to prune a range condition
+	maxEnumerateValues = 1024
+)
+
+// ExpressionSharding routes by a javascript expression or function of the sharding key value,
+// the result is a physical table name or a table index, e.g. config: {"expression": "'city_' + (id % 16)"},
+// or {"script": "function(id) { return id % 16; }", "monotonic": true}.
+// `monotonic` declares that the table index never decreases as the sharding key value increases,
+// so that range conditions are pruned by their bounds, otherwise small integer ranges are pruned
+// by enumerating their values, and the others are routed to all tables.
+type ExpressionSharding struct {
+	shardingKey   string
+	allowFullScan bool
+	topology      *topo.Topology
+	source        string
+	program       *goja.Program
+	monotonic     bool
+	idGenerator   proto.SequenceGenerator
+}
+
+func NewExpressionSharding(shardingKey string,
+	allowFullScan bool,
+	topology *topo.Topology,
+	config map[string]interface{},
+	generator proto.SequenceGenerator) (*ExpressionSharding, error) {
+	var source string
+	if expression, ok := config[expressionConfigKey].(string); ok && expression != "" {
+		source = fmt.Sprintf("(function(%s) { return (%s); })", misc.ParseColumn(shardingKey), expression)
+	} else if script, ok := config[scriptConfigKey].(string); ok && script != "" {
+		source = fmt.Sprintf("(%s)", script)
+	} else {
+		return nil, errors.New("expression sharding algorithm must have an expression or a script")
+	}
+	program, err := goja.Compile("", source, true)
+	if err != nil {
+		return nil, errors.Wrapf(err, "compile sharding expression %s failed", source)
+	}
+	monotonic, err := parseBool(config[monotonicConfigKey])
+	if err != nil {
+		return nil, err
+	}
+	return &ExpressionSharding{
+		shardingKey:   shardingKey,
+		allowFullScan: allowFullScan,
+		topology:      topology,
+		source:        source,
+		program:       program,
+		monotonic:     monotonic,
+		idGenerator:   generator,
+	}, nil
+}
+
+func (shard *ExpressionSharding) HasShardingKey(key string) bool {
+	conditionKey := misc.ParseColumn(key)
+	return strings.EqualFold(shard.shardingKey, conditionKey)
+}
+
+func (shard *ExpressionSharding) Shard(condition *KeyCondition) (Condition, error) {
+	conditionKey := misc.ParseColumn(condition.Key)
+	if !strings.EqualFold(shard.shardingKey, conditionKey) {
+		return TrueCondition{}, nil
+	}
+	switch condition.Op {
+	case opcode.EQ:
+		idx, err := shard.eval(condition.Value)
+		if err != nil {
+			return nil, err
+		}
+		return TableIndexSliceCondition([]int{idx}), nil
+	case opcode.LT, opcode.LE:
+		if shard.monotonic {
+			idx, err := shard.index(condition.Value)
+			if err != nil {
+				return nil, err
+			}
+			return shard.indexRange(0, idx), nil
+		}
+	case opcode.GT, opcode.GE:
+		if shard.monotonic {
+			idx, err := shard.index(condition.Value)
+			if err != nil {
+				return nil, err
+			}
+			return shard.indexRange(idx, shard.topology.TableSliceLen-1), nil
+		}
+	}
+	return TrueCondition{}, nil
+}
+
+func (shard *ExpressionSharding) ShardRange(cond1, cond2 *KeyCondition) (Condition, error) {
+	conditionKey := misc.ParseColumn(cond1.Key)
+	if !strings.EqualFold(shard.shardingKey, conditionKey) {
+		return TrueCondition{}, nil
+	}
+	if cond1.Op == opcode.NE {
+		return shard.Shard(cond2)
+	}
+	if shard.monotonic {
+		begin, err := shard.index(cond1.Value)
+		if err != nil {
+			return nil, err
+		}
+		end, err := shard.index(cond2.Value)
+		if err != nil {
+			return nil, err
+		}
+		return shard.indexRange(begin, end), nil
+	}
+
+	val1, err1 := strconv.ParseInt(fmt.Sprintf("%v", cond1.Value), 10, 64)
+	val2, err2 := strconv.ParseInt(fmt.Sprintf("%v", cond2.Value), 10, 64)
+	if err1 != nil || err2 != nil {
+		return TrueCondition{}, nil
+	}
+	if cond1.Op == opcode.GT {
+		val1++
+	}
+	if cond2.Op == opcode.LT {
+		val2--
+	}
+	if val2-val1 >= maxEnumerateValues {
+		return TrueCondition{}, nil
+	}
+	var (
+		indexMap = make(map[int]bool)
+		result   = make([]int, 0)
+	)
+	for val := val1; val <= val2; val++ {
+		idx, err := shard.eval(val)
+		if err != nil {
+			return nil, err
+		}
+		if !indexMap[idx] {
+			indexMap[idx] = true
+			result = append(result, idx)
+		}
+		if len(result) == shard.topology.TableSliceLen {
+			return TrueCondition{}, nil
+		}
+	}
+	return TableIndexSliceCondition(result), nil
+}
+
+// eval evaluates the expression and returns the table index, which must be one of the tables
+func (shard *ExpressionSharding) eval(value interface{}) (int, error) {
+	idx, err := shard.index(value)
+	if err != nil {
+		return 0, err
+	}
+	if _, ok := shard.topology.TableIndexMap[idx]; !ok {
+		return 0, errors.Errorf("sharding expression result %d is out of the tables of %s", idx, shard.topology.TableName)
+	}
+	return idx, nil
+}
+
+// index evaluates the expression and returns the table index, it may be out of the tables
+func (shard *ExpressionSharding) index(value interface{}) (int, error) {
+	js := function.BorrowJsRuntime()
+	defer function.ReturnJsRuntime(js)
+
+	fnValue, err := js.RunProgram(shard.program)
+	if err != nil {
+		return 0, errors.Wrapf(err, "evaluate sharding expression %s failed", shard.source)
+	}
+	fn, ok := goja.AssertFunction(fnValue)
+	if !ok {
+		return 0, errors.Errorf("sharding expression %s should be a function", shard.source)
+	}
+	result, err := fn(goja.Undefined(), js.ToValue(scriptValue(value)))
+	if err != nil {
+		return 0, errors.Wrapf(err, "evaluate sharding expression %s failed", shard.source)
+	}
+	return shard.tableIndex(result.Export())
+}
+
+// tableIndex returns the table index of the result, the result is a physical table name or a table index
+func (shard *ExpressionSharding) tableIndex(result interface{}) (int, error) {
+	var idx int
+	switch val := result.(type) {
+	case int64:
+		idx = int(val)
+	case float64:
+		if val != math.Trunc(val) {
+			return 0, errors.Errorf("sharding expression result %v is not a table index", val)
+		}
+		idx = int(val)
+	case string:
+		if index, ok := shard.topology.TableIndex(val); ok {
+			return index, nil
+		}
+		// a table name beyond the tables, e.g. city_20 of a monotonic range
+		index, err := strconv.Atoi(strings.TrimPrefix(val, shard.topology.TableName+"_"))
+		if err != nil {
+			return 0, errors.Errorf("sharding expression result %s is not a table of %s", val, shard.topology.TableName)
+		}
+		idx = index
+	default:
+		return 0, errors.Errorf("unsupported sharding expression result %v", result)
+	}
+	return idx, nil
+}
+
+// indexRange clamps the bounds of a monotonic range to the tables, e.g. `id > 0` routes to all tables
+func (shard *ExpressionSharding) indexRange(begin, end int) Condition {
+	if begin < 0 {
+		begin = 0
+	}
+	if end > shard.topology.TableSliceLen-1 {
+		end = shard.topology.TableSliceLen - 1
+	}
+	if begin > end {
+		return FalseCondition{}
+	}
+	result := make([]int, 0, end-begin+1)
+	for i := begin; i <= end; i++ {
+		result = append(result, i)
+	}
+	return TableIndexSliceCondition(result)
+}
+
+func (shard *ExpressionSharding) AllShards() Condition {
+	return TableIndexSliceCondition(shard.topology.TableSlice)
+}
+
+func (shard *ExpressionSharding) AllowFullScan() bool {
+	return shard.allowFullScan
+}
+
+func (shard *ExpressionSharding) Topology() *topo.Topology {
+	return shard.topology
+}
+
+func (shard *ExpressionSharding) Equal(algorithm ShardingAlgorithm) bool {
+	if algo, ok := algorithm.(*ExpressionSharding); ok {
+		if shard.source == algo.source &&
+			shard.topology.Equal(algo.topology) {
+			return true
+		}
+	}
+	return false
+}
+
+func (shard *ExpressionSharding) NextID() (int64, error) {
+	if shard.idGenerator != nil {
+		return shard.idGenerator.NextID()
+	}
+	return 0, errors.New("there is no sequence generator")
+}
+
+// scriptValue converts the sharding key value to a javascript value, only values of numeric sql
+// types become numbers, strings are kept as they are, so that '007' is not sharded as 7.
+func scriptValue(value interface{}) interface{} {
+	switch val := value.(type) {
+	case []byte:
+		return string(val)
+	case *types.MyDecimal:
+		if f, err := val.ToFloat64(); err == nil {
+			return f
+		}
+		return val.String()
+	default:
+		return value
+	}
+}
+
+func parseBool(value interface{}) (bool, error) {
+	switch val := value.(type) {
+	case nil:
+		return false, nil
+	case bool:
+		return val, nil
+	case string:
+		return strconv.ParseBool(val)
+	}
+	return false, errors.Errorf("incorrect bool value %v", value)
+}
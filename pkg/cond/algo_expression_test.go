@@ -0,0 +1,158 @@
+/*
+ * Copyright 2022 CECTC, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cond
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/cectc/dbpack/pkg/topo"
+	"github.com/cectc/dbpack/third_party/parser/opcode"
+)
+
+func mockExpressionTopology() *topo.Topology {
+	topology, _ := topo.ParseTopology("world", "city", map[int]string{
+		0: "0-7",
+		1: "8-15",
+	})
+	return topology
+}
+
+func TestExpressionSharding(t *testing.T) {
+	alg, err := NewShardingAlgorithm("Expression", "id", false, mockExpressionTopology(),
+		map[string]interface{}{"expression": "'city_' + (id % 16)"}, nil)
+	assert.Nil(t, err)
+
+	testCases := []struct {
+		op     opcode.Op
+		value  interface{}
+		expect Condition
+	}{
+		{op: opcode.EQ, value: int64(37), expect: TableIndexSliceCondition{5}},
+		{op: opcode.EQ, value: "38", expect: TableIndexSliceCondition{6}},
+		{op: opcode.EQ, value: []byte("15"), expect: TableIndexSliceCondition{15}},
+		{op: opcode.LT, value: int64(15), expect: TrueCondition{}},
+		{op: opcode.NE, value: int64(15), expect: TrueCondition{}},
+	}
+	for _, c := range testCases {
+		condition, err := alg.Shard(&KeyCondition{Key: "id", Op: c.op, Value: c.value})
+		assert.Nil(t, err)
+		assert.Equal(t, c.expect, condition)
+	}
+
+	condition, err := alg.ShardRange(&KeyCondition{Key: "id", Op: opcode.GT, Value: int64(30)},
+		&KeyCondition{Key: "id", Op: opcode.LE, Value: int64(33)})
+	assert.Nil(t, err)
+	assert.Equal(t, TableIndexSliceCondition{15, 0, 1}, condition)
+
+	condition, err = alg.ShardRange(&KeyCondition{Key: "id", Op: opcode.GE, Value: int64(0)},
+		&KeyCondition{Key: "id", Op: opcode.LE, Value: int64(100000)})
+	assert.Nil(t, err)
+	assert.Equal(t, TrueCondition{}, condition)
+}
+
+func TestExpressionShardingScript(t *testing.T) {
+	alg, err := NewExpressionSharding("code", false, mockExpressionTopology(), map[string]interface{}{
+		"script":    "function(code) { return parseInt(code.substring(1)) / 100 | 0; }",
+		"monotonic": true,
+	}, nil)
+	assert.Nil(t, err)
+
+	condition, err := alg.Shard(&KeyCondition{Key: "code", Op: opcode.EQ, Value: "A0250"})
+	assert.Nil(t, err)
+	assert.Equal(t, TableIndexSliceCondition{2}, condition)
+
+	condition, err = alg.Shard(&KeyCondition{Key: "code", Op: opcode.GE, Value: "A1320"})
+	assert.Nil(t, err)
+	assert.Equal(t, TableIndexSliceCondition{13, 14, 15}, condition)
+
+	condition, err = alg.ShardRange(&KeyCondition{Key: "code", Op: opcode.GE, Value: "A0150"},
+		&KeyCondition{Key: "code", Op: opcode.LT, Value: "A0420"})
+	assert.Nil(t, err)
+	assert.Equal(t, TableIndexSliceCondition{1, 2, 3, 4}, condition)
+
+	_, err = alg.Shard(&KeyCondition{Key: "code", Op: opcode.EQ, Value: "A9999"})
+	assert.NotNil(t, err)
+}
+
+func TestExpressionShardingMonotonicBounds(t *testing.T) {
+	alg, err := NewExpressionSharding("id", false, mockExpressionTopology(), map[string]interface{}{
+		"expression": "'city_' + (id / 100 | 0)",
+		"monotonic":  true,
+	}, nil)
+	assert.Nil(t, err)
+
+	condition, err := alg.Shard(&KeyCondition{Key: "id", Op: opcode.GT, Value: int64(0)})
+	assert.Nil(t, err)
+	assert.Equal(t, TableIndexSliceCondition(mockExpressionTopology().TableSlice), condition)
+
+	condition, err = alg.Shard(&KeyCondition{Key: "id", Op: opcode.GE, Value: int64(5000)})
+	assert.Nil(t, err)
+	assert.Equal(t, FalseCondition{}, condition)
+
+	condition, err = alg.Shard(&KeyCondition{Key: "id", Op: opcode.LT, Value: int64(-250)})
+	assert.Nil(t, err)
+	assert.Equal(t, FalseCondition{}, condition)
+
+	condition, err = alg.ShardRange(&KeyCondition{Key: "id", Op: opcode.GE, Value: int64(1320)},
+		&KeyCondition{Key: "id", Op: opcode.LE, Value: int64(99999)})
+	assert.Nil(t, err)
+	assert.Equal(t, TableIndexSliceCondition{13, 14, 15}, condition)
+
+	_, err = alg.Shard(&KeyCondition{Key: "id", Op: opcode.EQ, Value: int64(5000)})
+	assert.NotNil(t, err)
+}
+
+func TestExpressionShardingStringValue(t *testing.T) {
+	alg, err := NewExpressionSharding("code", false, mockExpressionTopology(), map[string]interface{}{
+		"script": "function(code) { return String(code).length; }",
+	}, nil)
+	assert.Nil(t, err)
+
+	testCases := []struct {
+		value  interface{}
+		expect Condition
+	}{
+		{value: "007", expect: TableIndexSliceCondition{3}},
+		{value: []byte("007"), expect: TableIndexSliceCondition{3}},
+		{value: int64(7), expect: TableIndexSliceCondition{1}},
+		{value: 7.25, expect: TableIndexSliceCondition{4}},
+	}
+	for _, c := range testCases {
+		condition, err := alg.Shard(&KeyCondition{Key: "code", Op: opcode.EQ, Value: c.value})
+		assert.Nil(t, err)
+		assert.Equal(t, c.expect, condition)
+	}
+}
+
+func TestExpressionShardingConfig(t *testing.T) {
+	_, err := NewExpressionSharding("id", false, mockExpressionTopology(), nil, nil)
+	assert.NotNil(t, err)
+	_, err = NewExpressionSharding("id", false, mockExpressionTopology(),
+		map[string]interface{}{"expression": "id %"}, nil)
+	assert.NotNil(t, err)
+
+	alg1, _ := NewExpressionSharding("id", false, mockExpressionTopology(),
+		map[string]interface{}{"expression": "id % 16"}, nil)
+	alg2, _ := NewExpressionSharding("id", false, mockExpressionTopology(),
+		map[string]interface{}{"expression": "id % 16", "monotonic": "false"}, nil)
+	alg3, _ := NewExpressionSharding("id", false, mockExpressionTopology(),
+		map[string]interface{}{"expression": "(id + 1) % 16"}, nil)
+	assert.True(t, alg1.Equal(alg2))
+	assert.False(t, alg1.Equal(alg3))
+}
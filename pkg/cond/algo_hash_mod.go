@@ -0,0 +1,161 @@
+/*
+ * Copyright 2022 CECTC, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cond
+
+import (
+	"fmt"
+	"hash/crc32"
+	"strconv"
+	"strings"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/pkg/errors"
+
+	"github.com/cectc/dbpack/pkg/misc"
+	"github.com/cectc/dbpack/pkg/proto"
+	"github.com/cectc/dbpack/pkg/topo"
+	"github.com/cectc/dbpack/third_party/parser/opcode"
+)
+
+const (
+	HashXXHash = "xxhash"
+	HashCRC32  = "crc32"
+
+	hashConfigKey = "hash"
+)
+
+type hashFunc func(data []byte) uint64
+
+// HashMod shards by the hash of the sharding key value modulo the table count,
+// e.g. config: {"hash": "crc32"}, the hash function is xxhash by default.
+type HashMod struct {
+	shardingKey   string
+	allowFullScan bool
+	topology      *topo.Topology
+	hashName      string
+	hash          hashFunc
+	idGenerator   proto.SequenceGenerator
+}
+
+func NewHashMod(shardingKey string,
+	allowFullScan bool,
+	topology *topo.Topology,
+	config map[string]interface{},
+	generator proto.SequenceGenerator) (*HashMod, error) {
+	hashName, hash, err := parseHashConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	return &HashMod{
+		shardingKey:   shardingKey,
+		allowFullScan: allowFullScan,
+		topology:      topology,
+		hashName:      hashName,
+		hash:          hash,
+		idGenerator:   generator,
+	}, nil
+}
+
+func (shard *HashMod) HasShardingKey(key string) bool {
+	conditionKey := misc.ParseColumn(key)
+	return strings.EqualFold(shard.shardingKey, conditionKey)
+}
+
+func (shard *HashMod) Shard(condition *KeyCondition) (Condition, error) {
+	conditionKey := misc.ParseColumn(condition.Key)
+	if !strings.EqualFold(shard.shardingKey, conditionKey) {
+		return TrueCondition{}, nil
+	}
+	switch condition.Op {
+	case opcode.EQ:
+		hashCode := shard.hash(hashKey(condition.Value))
+		idx := int(hashCode % uint64(shard.topology.TableSliceLen))
+		return TableIndexSliceCondition([]int{idx}), nil
+	default:
+		// hash values are not ordered, all shards should be scanned
+		return TrueCondition{}, nil
+	}
+}
+
+func (shard *HashMod) ShardRange(cond1, cond2 *KeyCondition) (Condition, error) {
+	return TrueCondition{}, nil
+}
+
+func (shard *HashMod) AllShards() Condition {
+	return TableIndexSliceCondition(shard.topology.TableSlice)
+}
+
+func (shard *HashMod) AllowFullScan() bool {
+	return shard.allowFullScan
+}
+
+func (shard *HashMod) Topology() *topo.Topology {
+	return shard.topology
+}
+
+func (shard *HashMod) Equal(algorithm ShardingAlgorithm) bool {
+	if algo, ok := algorithm.(*HashMod); ok {
+		if shard.hashName == algo.hashName &&
+			shard.topology.Equal(algo.topology) {
+			return true
+		}
+	}
+	return false
+}
+
+func (shard *HashMod) NextID() (int64, error) {
+	if shard.idGenerator != nil {
+		return shard.idGenerator.NextID()
+	}
+	return 0, errors.New("there is no sequence generator")
+}
+
+func parseHashConfig(config map[string]interface{}) (string, hashFunc, error) {
+	hashName := HashXXHash
+	if value, ok := config[hashConfigKey]; ok {
+		name, ok := value.(string)
+		if !ok {
+			return "", nil, errors.Errorf("incorrect hash function %v", value)
+		}
+		hashName = strings.ToLower(name)
+	}
+	switch hashName {
+	case HashXXHash:
+		return hashName, xxhash.Sum64, nil
+	case HashCRC32:
+		return hashName, func(data []byte) uint64 {
+			return uint64(crc32.ChecksumIEEE(data))
+		}, nil
+	}
+	return "", nil, errors.Errorf("unsupported hash function: %s", hashName)
+}
+
+// hashKey returns the bytes to be hashed of the sharding key value, numbers are hashed
+// by their decimal string, so that 18 and '18' are routed to the same shard.
+func hashKey(value interface{}) []byte {
+	switch val := value.(type) {
+	case []byte:
+		return val
+	case string:
+		return []byte(val)
+	case int64:
+		return []byte(strconv.FormatInt(val, 10))
+	case uint64:
+		return []byte(strconv.FormatUint(val, 10))
+	}
+	return []byte(fmt.Sprintf("%v", value))
+}
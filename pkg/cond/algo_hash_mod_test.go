@@ -0,0 +1,94 @@
+/*
+ * Copyright 2022 CECTC, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cond
+
+import (
+	"hash/crc32"
+	"testing"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/cectc/dbpack/pkg/topo"
+	"github.com/cectc/dbpack/third_party/parser/opcode"
+)
+
+func mockHashTopology(tableName string) *topo.Topology {
+	topology, _ := topo.ParseTopology("world", tableName, map[int]string{
+		0: "0-3",
+		1: "4-7",
+	})
+	return topology
+}
+
+func TestHashMod(t *testing.T) {
+	testCases := []struct {
+		config map[string]interface{}
+		value  interface{}
+		expect int
+	}{
+		{
+			config: nil,
+			value:  "e5b5d1f6-4fd4-4b4c-9a8d-4a1f0c7c5d2e",
+			expect: int(xxhash.Sum64String("e5b5d1f6-4fd4-4b4c-9a8d-4a1f0c7c5d2e") % 8),
+		},
+		{
+			config: map[string]interface{}{"hash": "crc32"},
+			value:  "tenant_a",
+			expect: int(crc32.ChecksumIEEE([]byte("tenant_a")) % 8),
+		},
+		{
+			config: map[string]interface{}{"hash": "CRC32"},
+			value:  int64(1024),
+			expect: int(crc32.ChecksumIEEE([]byte("1024")) % 8),
+		},
+		{
+			config: map[string]interface{}{"hash": "xxhash"},
+			value:  []byte("1024"),
+			expect: int(xxhash.Sum64String("1024") % 8),
+		},
+	}
+	for _, c := range testCases {
+		alg, err := NewShardingAlgorithm("HashMod", "code", false, mockHashTopology("city"), c.config, nil)
+		assert.Nil(t, err)
+		condition, err := alg.Shard(&KeyCondition{Key: "code", Op: opcode.EQ, Value: c.value})
+		assert.Nil(t, err)
+		assert.Equal(t, TableIndexSliceCondition([]int{c.expect}), condition)
+	}
+
+	alg, err := NewHashMod("code", false, mockHashTopology("city"), nil, nil)
+	assert.Nil(t, err)
+	condition, err := alg.Shard(&KeyCondition{Key: "code", Op: opcode.GT, Value: "a"})
+	assert.Nil(t, err)
+	assert.Equal(t, TrueCondition{}, condition)
+	condition, err = alg.ShardRange(&KeyCondition{Key: "code", Op: opcode.GE, Value: "a"},
+		&KeyCondition{Key: "code", Op: opcode.LE, Value: "b"})
+	assert.Nil(t, err)
+	assert.Equal(t, TrueCondition{}, condition)
+
+	_, err = NewHashMod("code", false, mockHashTopology("city"), map[string]interface{}{"hash": "md5"}, nil)
+	assert.NotNil(t, err)
+}
+
+func TestHashModEqual(t *testing.T) {
+	city, _ := NewHashMod("code", false, mockHashTopology("city"), nil, nil)
+	country, _ := NewHashMod("code", false, mockHashTopology("country"), map[string]interface{}{"hash": "xxhash"}, nil)
+	language, _ := NewHashMod("code", false, mockHashTopology("language"), map[string]interface{}{"hash": "crc32"}, nil)
+	assert.True(t, city.Equal(country))
+	assert.False(t, city.Equal(language))
+	assert.False(t, city.Equal(NewNumberMod("code", false, mockHashTopology("city"), nil)))
+}
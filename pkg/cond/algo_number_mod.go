@@ -228,7 +228,7 @@ func (shard *NumberMod) Topology() *topo.Topology {
 
 func (shard *NumberMod) Equal(algorithm ShardingAlgorithm) bool {
 	if algo, ok := algorithm.(*NumberMod); ok {
-		if algo.topology.Equal(algo.topology) {
+		if shard.topology.Equal(algo.topology) {
 			return true
 		}
 	}
@@ -50,6 +50,10 @@ type TrueCondition struct{}
 
 type FalseCondition struct{}
 
+// Parameter is the value of a key condition parsed with the parameters unbound, it refers to
+// the argument of the parameter by the order of the parameter.
+type Parameter int
+
 func (cond *KeyCondition) And(cond2 Condition) Condition {
 	switch c := cond2.(type) {
 	case *KeyCondition:
@@ -301,6 +305,8 @@ func (s ConditionSlice) Swap(i, j int) {
 
 func ParseCondition(cond ast.ExprNode, args ...interface{}) (Condition, error) {
 	switch expr := cond.(type) {
+	case nil:
+		return TrueCondition{}, nil
 	case *ast.BinaryOperationExpr:
 		switch expr.Op {
 		case opcode.EQ, opcode.NE, opcode.GT, opcode.LT, opcode.GE, opcode.LE:
@@ -595,3 +601,38 @@ func getValue(expr ast.ExprNode, args ...interface{}) (interface{}, error) {
 		return nil, errors.Errorf("unsupported %t expression", expr)
 	}
 }
+
+// BindCondition replaces the parameters of the key conditions with the arguments, the condition
+// is not modified, so it can be bound with other arguments again.
+func BindCondition(condition Condition, args []interface{}) (Condition, error) {
+	switch c := condition.(type) {
+	case *KeyCondition:
+		parameter, ok := c.Value.(Parameter)
+		if !ok {
+			return c, nil
+		}
+		if int(parameter) >= len(args) {
+			return nil, errors.Errorf("parameter %d should be bound, args count: %d", parameter, len(args))
+		}
+		return &KeyCondition{
+			Key:   c.Key,
+			Op:    c.Op,
+			Value: args[parameter],
+		}, nil
+	case *ComplexCondition:
+		conditions := make([]Condition, 0, len(c.Conditions))
+		for _, cd := range c.Conditions {
+			bound, err := BindCondition(cd, args)
+			if err != nil {
+				return nil, err
+			}
+			conditions = append(conditions, bound)
+		}
+		return &ComplexCondition{
+			Op:         c.Op,
+			Conditions: conditions,
+		}, nil
+	default:
+		return condition, nil
+	}
+}
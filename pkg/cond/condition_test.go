@@ -679,3 +679,38 @@ func TestParseCondition(t *testing.T) {
 		})
 	}
 }
+
+func TestBindCondition(t *testing.T) {
+	stmt, err := parser.New().ParseOneStmt("select * from student where uid in (?, ?) and age = ?", "", "")
+	assert.Nil(t, err)
+	stmt.Accept(&visitor.ParamVisitor{})
+	template, err := ParseCondition(stmt.(*ast.SelectStmt).Where, Parameter(0), Parameter(1), Parameter(2))
+	assert.Nil(t, err)
+
+	for _, args := range [][]interface{}{{5, 8, 18}, {6, 9, 20}} {
+		condition, err := BindCondition(template, args)
+		assert.Nil(t, err)
+		assert.Equal(t, &ComplexCondition{
+			Op: opcode.Or,
+			Conditions: []Condition{
+				&ComplexCondition{
+					Op: opcode.And,
+					Conditions: []Condition{
+						&KeyCondition{Key: "uid", Op: opcode.EQ, Value: args[0]},
+						&KeyCondition{Key: "age", Op: opcode.EQ, Value: args[2]},
+					},
+				},
+				&ComplexCondition{
+					Op: opcode.And,
+					Conditions: []Condition{
+						&KeyCondition{Key: "uid", Op: opcode.EQ, Value: args[1]},
+						&KeyCondition{Key: "age", Op: opcode.EQ, Value: args[2]},
+					},
+				},
+			},
+		}, condition)
+	}
+
+	_, err = BindCondition(template, []interface{}{5})
+	assert.NotNil(t, err)
+}
@@ -534,7 +534,7 @@ func Or(alg ShardingAlgorithm, condition1, condition2 Condition) (Condition, err
 		if err != nil {
 			return nil, err
 		}
-		return k1.Or(cond2), nil
+		return condition1.Or(cond2), nil
 	}
 	if ok1 && ok2 {
 		cond1, err := k1.Shard(alg)
@@ -41,6 +41,16 @@ func NewShardingAlgorithm(algorithm, shardingKey string,
 		return NewNumberMod(shardingKey, allowFullScan, topology, generator), nil
 	case "NumberRange":
 		return NewNumberRange(shardingKey, allowFullScan, topology, config, generator)
+	case "HashMod":
+		return NewHashMod(shardingKey, allowFullScan, topology, config, generator)
+	case "ConsistentHash":
+		return NewConsistentHash(shardingKey, allowFullScan, topology, config, generator)
+	case "DateRange":
+		return NewDateRange(shardingKey, allowFullScan, topology, config, generator)
+	case "DateMod":
+		return NewDateMod(shardingKey, allowFullScan, topology, config, generator)
+	case "Expression":
+		return NewExpressionSharding(shardingKey, allowFullScan, topology, config, generator)
 	}
 	return nil, errors.Errorf("unsupported sharding algorithm: %s", algorithm)
 }
@@ -60,6 +60,40 @@ func (t *ProtocolType) unmarshalText(text []byte) bool {
 	return true
 }
 
+// StorageDriver is where the transaction manager keeps sessions and row locks
+type StorageDriver int32
+
+const (
+	EtcdStorage StorageDriver = iota
+	MysqlStorage
+	// MemoryStorage keeps sessions in memory of a single node, for development and tests
+	MemoryStorage
+)
+
+func (d *StorageDriver) UnmarshalText(text []byte) error {
+	if d == nil {
+		return errors.New("can't unmarshal a nil *StorageDriver")
+	}
+	if !d.unmarshalText(bytes.ToLower(text)) {
+		return fmt.Errorf("unrecognized storage driver: %q", text)
+	}
+	return nil
+}
+
+func (d *StorageDriver) unmarshalText(text []byte) bool {
+	switch string(text) {
+	case "etcd":
+		*d = EtcdStorage
+	case "mysql":
+		*d = MysqlStorage
+	case "memory":
+		*d = MemoryStorage
+	default:
+		return false
+	}
+	return true
+}
+
 type Configuration struct {
 	ProbePort                int           `default:"18888" yaml:"probe_port" json:"probe_port"`
 	Tracer                   *TracerConfig `yaml:"tracer" json:"tracer"`
@@ -85,12 +119,30 @@ type TracerConfig struct {
 	ExporterEndpoint *string `yaml:"exporter_endpoint" json:"exporter_endpoint"`
 }
 
+// DefaultGrpcBindAddress only accepts grpc requests of the transaction manager from the local host
+const DefaultGrpcBindAddress = "127.0.0.1"
+
 type DistributedTransaction struct {
 	AppID                            string `yaml:"appid" json:"appid"`
 	RetryDeadThreshold               int64  `yaml:"retry_dead_threshold" json:"retry_dead_threshold"`
 	RollbackRetryTimeoutUnlockEnable bool   `yaml:"rollback_retry_timeout_unlock_enable" json:"rollback_retry_timeout_unlock_enable"`
+	// GrpcPort exposes the transaction manager as a grpc service when it is greater than 0
+	GrpcPort int `yaml:"grpc_port" json:"grpc_port"`
+	// GrpcBindAddress is the address the grpc service listens on, the service has neither
+	// authentication nor tls, so it defaults to DefaultGrpcBindAddress
+	GrpcBindAddress string `yaml:"grpc_bind_address" json:"grpc_bind_address"`
+
+	StorageDriver StorageDriver       `yaml:"storage_driver" json:"storage_driver"`
+	EtcdConfig    *clientv3.Config    `yaml:"etcd_config" json:"etcd_config"`
+	MysqlConfig   *MysqlStorageConfig `yaml:"mysql_config" json:"mysql_config"`
+}
 
-	EtcdConfig *clientv3.Config `yaml:"etcd_config" json:"etcd_config"`
+// MysqlStorageConfig is the config of the mysql storage driver, the session tables
+// are created in the database of DSN if they do not exist
+type MysqlStorageConfig struct {
+	DSN string `yaml:"dsn" json:"dsn"`
+	// PollInterval is how often the session watchers poll the session tables
+	PollInterval time.Duration `yaml:"poll_interval" json:"poll_interval"`
 }
 
 type Listener struct {
@@ -155,8 +207,8 @@ func (conf *DBPackConfig) Normalize() error {
 	for _, filter := range conf.Filters {
 		filter.AppID = conf.AppID
 	}
-	if conf.DistributedTransaction != nil {
-		conf.DistributedTransaction.AppID = conf.AppID
+	if err := conf._validateDistributedTransaction(); err != nil {
+		return err
 	}
 	return nil
 }
@@ -208,6 +260,27 @@ func (conf *DBPackConfig) _validateExecutors() error {
 	return nil
 }
 
+func (conf *DBPackConfig) _validateDistributedTransaction() error {
+	if conf.DistributedTransaction == nil {
+		return nil
+	}
+	conf.DistributedTransaction.AppID = conf.AppID
+	if conf.DistributedTransaction.GrpcBindAddress == "" {
+		conf.DistributedTransaction.GrpcBindAddress = DefaultGrpcBindAddress
+	}
+	switch conf.DistributedTransaction.StorageDriver {
+	case EtcdStorage:
+		if conf.DistributedTransaction.EtcdConfig == nil {
+			return errors.Errorf("DistributedTransaction of %s doesn't have a valid etcd config", conf.AppID)
+		}
+	case MysqlStorage:
+		if conf.DistributedTransaction.MysqlConfig == nil || conf.DistributedTransaction.MysqlConfig.DSN == "" {
+			return errors.Errorf("DistributedTransaction of %s doesn't have a valid mysql config", conf.AppID)
+		}
+	}
+	return nil
+}
+
 func (conf *DBPackConfig) _validateDataSources() error {
 	for _, dataSource := range conf.DataSources {
 		for _, filterName := range dataSource.Filters {
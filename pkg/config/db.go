@@ -44,6 +44,12 @@ type (
 
 	SequenceType byte
 
+	// TransactionMode is how a sharding executor commits a transaction across db groups
+	TransactionMode byte
+
+	// ShardingKeyUpdate is how a sharding executor handles the update of a sharding key column
+	ShardingKeyUpdate byte
+
 	// DataSource ...
 	DataSource struct {
 		Name                     string        `yaml:"name" json:"name"`
@@ -96,8 +102,12 @@ type (
 		TableName         string             `yaml:"table_name" json:"table_name"`
 		AllowFullScan     bool               `yaml:"allow_full_scan" json:"allow_full_scan"`
 		ShardingRule      *ShardingRule      `yaml:"sharding_rule" json:"sharding_rule"`
+		DBShardingRule    *ShardingRule      `yaml:"db_sharding_rule,omitempty" json:"db_sharding_rule,omitempty"`
+		TableShardingRule *ShardingRule      `yaml:"table_sharding_rule,omitempty" json:"table_sharding_rule,omitempty"`
 		SequenceGenerator *SequenceGenerator `yaml:"sequence_generator" json:"sequence_generator"`
 		Topology          map[int]string     `yaml:"topology" json:"topology"`
+		TableSuffixes     []string           `yaml:"table_suffixes,omitempty" json:"table_suffixes,omitempty"`
+		ShardingKeyUpdate ShardingKeyUpdate  `yaml:"sharding_key_update" json:"sharding_key_update"`
 	}
 
 	ShardingConfig struct {
@@ -106,6 +116,21 @@ type (
 		LogicTables        []*LogicTable         `yaml:"logic_tables" json:"logic_tables"`
 		ShadowRules        []*ShadowRule         `yaml:"shadow_rules" json:"shadow_rules"`
 		TransactionTimeout int32                 `yaml:"transaction_timeout" json:"transaction_timeout"`
+		TransactionMode    TransactionMode       `yaml:"transaction_mode" json:"transaction_mode"`
+		// PlanCacheSize is the capacity of the statement plan cache, 0 means the default capacity
+		PlanCacheSize int `yaml:"plan_cache_size" json:"plan_cache_size"`
+		// XA is required in XA transaction mode
+		XA *XAConfig `yaml:"xa,omitempty" json:"xa,omitempty"`
+	}
+
+	XAConfig struct {
+		// InstanceID identifies the XA transactions of a dbpack instance, it must be unique among
+		// the instances sharing the db groups and must not change across restarts
+		InstanceID string `yaml:"instance_id" json:"instance_id"`
+		// LogGroup is the db group keeping the xa log table
+		LogGroup string `yaml:"log_group" json:"log_group"`
+		// LogTable is the xa log table, dbpack_xa_log by default
+		LogTable string `yaml:"log_table,omitempty" json:"log_table,omitempty"`
 	}
 )
 
@@ -126,6 +151,24 @@ const (
 	SHD
 )
 
+const (
+	// LocalTransaction commits the local transactions of db groups independently
+	LocalTransaction TransactionMode = iota
+	// XATransaction commits the db groups by mysql XA two phase commit
+	XATransaction
+	// ATTransaction registers the local transactions of db groups as branches of a
+	// distributed transaction, committed branches are compensated by undo logs on rollback
+	ATTransaction
+)
+
+const (
+	// RejectShardingKeyUpdate rejects the update of a sharding key column
+	RejectShardingKeyUpdate ShardingKeyUpdate = iota
+	// MoveShardingKeyUpdate moves the updated rows to the physical tables routed by the new
+	// sharding key, by deleting them from the old tables and inserting them into the new ones
+	MoveShardingKeyUpdate
+)
+
 const (
 	Random LoadBalanceAlgorithm = iota
 	RoundRobin
@@ -220,6 +263,76 @@ func (m *ExecuteMode) unmarshalText(text []byte) bool {
 	return true
 }
 
+func (m TransactionMode) String() string {
+	switch m {
+	case LocalTransaction:
+		return "LOCAL"
+	case XATransaction:
+		return "XA"
+	case ATTransaction:
+		return "AT"
+	default:
+		return fmt.Sprintf("%d", m)
+	}
+}
+
+func (m *TransactionMode) UnmarshalText(text []byte) error {
+	if m == nil {
+		return errors.New("can't unmarshal a nil *TransactionMode")
+	}
+	if !m.unmarshalText(bytes.ToLower(text)) {
+		return fmt.Errorf("unrecognized transaction mode: %q", text)
+	}
+	return nil
+}
+
+func (m *TransactionMode) unmarshalText(text []byte) bool {
+	switch string(text) {
+	case "", "local":
+		*m = LocalTransaction
+	case "xa":
+		*m = XATransaction
+	case "at":
+		*m = ATTransaction
+	default:
+		return false
+	}
+	return true
+}
+
+func (u ShardingKeyUpdate) String() string {
+	switch u {
+	case RejectShardingKeyUpdate:
+		return "REJECT"
+	case MoveShardingKeyUpdate:
+		return "MOVE"
+	default:
+		return fmt.Sprintf("%d", u)
+	}
+}
+
+func (u *ShardingKeyUpdate) UnmarshalText(text []byte) error {
+	if u == nil {
+		return errors.New("can't unmarshal a nil *ShardingKeyUpdate")
+	}
+	if !u.unmarshalText(bytes.ToLower(text)) {
+		return fmt.Errorf("unrecognized sharding key update: %q", text)
+	}
+	return nil
+}
+
+func (u *ShardingKeyUpdate) unmarshalText(text []byte) bool {
+	switch string(text) {
+	case "", "reject":
+		*u = RejectShardingKeyUpdate
+	case "move":
+		*u = MoveShardingKeyUpdate
+	default:
+		return false
+	}
+	return true
+}
+
 func (l *LoadBalanceAlgorithm) UnmarshalText(text []byte) error {
 	if l == nil {
 		return errors.New("can't unmarshal a nil *ProtocolType")
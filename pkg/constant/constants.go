@@ -35,6 +35,18 @@ package constant
 const (
 	DefaultMaxAllowedPacket = 4 << 20 // 4 MiB
 
+	// DefaultStmtCacheSize is the default number of prepared statements
+	// cached by a backend connection.
+	DefaultStmtCacheSize = 256
+
+	// DefaultPlanCacheSize is the default number of statement plan templates
+	// cached by a sharding executor.
+	DefaultPlanCacheSize = 1024
+
+	// DefaultStatementCacheSize is the default number of parsed statements
+	// cached by a mysql listener.
+	DefaultStatementCacheSize = 1024
+
 	// MaxPacketSize is the maximum payload length of a packet
 	// the server supports.
 	MaxPacketSize = (1 << 24) - 1
@@ -51,6 +63,11 @@ const (
 	// MysqlNativePassword uses a salt and transmits a hash on the wire.
 	MysqlNativePassword = "mysql_native_password"
 
+	// CachingSha2Password uses a salt and transmits a SHA256 hash on the wire,
+	// the password is sent over TLS or encrypted by RSA when the full authentication
+	// is required.
+	CachingSha2Password = "caching_sha2_password"
+
 	// MysqlClearPassword transmits the password in the clear.
 	MysqlClearPassword = "mysql_clear_password"
 
@@ -245,6 +262,9 @@ const (
 	// AuthSwitchRequestPacket is used to switch auth method.
 	AuthSwitchRequestPacket = 0xfe
 
+	// AuthMoreDataPacket is sent by server to continue the authentication.
+	AuthMoreDataPacket = 0x01
+
 	// ErrPacket is the header of the error packet.
 	ErrPacket = 0xff
 
@@ -252,6 +272,18 @@ const (
 	NullValue = 0xfb
 )
 
+// The extra data of caching_sha2_password authentication.
+const (
+	// CachingSha2RequestPublicKey is sent by client to request the RSA public key of server.
+	CachingSha2RequestPublicKey = 0x02
+
+	// CachingSha2FastAuthSuccess is sent by server if the scramble matches the cached hash.
+	CachingSha2FastAuthSuccess = 0x03
+
+	// CachingSha2PerformFullAuthentication is sent by server to ask for the password.
+	CachingSha2PerformFullAuthentication = 0x04
+)
+
 // Error codes for client-side errors.
 // Originally found in include/mysql/errmsg.h and
 // https://dev.mysql.com/doc/refman/5.7/en/error-messages-client.html
@@ -360,7 +392,9 @@ const (
 	ERAccessDeniedError         = 1045
 	ERKillDenied                = 1095
 	ERNoPermissionToCreateUsers = 1211
+	ERTableAccessDeniedError    = 1142
 	ERSpecifiedAccessDenied     = 1227
+	ERSecureTransportRequired   = 3159
 
 	// failed precondition
 	ERNoDb                          = 1046
@@ -543,6 +577,24 @@ const (
 	// SSAccessDeniedError is ER_ACCESS_DENIED_ERROR
 	SSAccessDeniedError = "28000"
 
+	// SSNotSupportedYet is ER_NOT_SUPPORTED_YET
+	SSNotSupportedYet = "42000"
+
+	// SSTableAccessDeniedError is ER_TABLEACCESS_DENIED_ERROR
+	SSTableAccessDeniedError = "42000"
+
+	// SSDBAccessDenied is ER_DBACCESS_DENIED_ERROR
+	SSDBAccessDenied = "42000"
+
+	// SSSpecifiedAccessDenied is ER_SPECIFIC_ACCESS_DENIED_ERROR
+	SSSpecifiedAccessDenied = "42000"
+
+	// SSParseError is ER_PARSE_ERROR
+	SSParseError = "42000"
+
+	// SSEmptyQuery is ER_EMPTY_QUERY
+	SSEmptyQuery = "42000"
+
 	// SSLockDeadlock is ER_LOCK_DEADLOCK
 	SSLockDeadlock = "40001"
 )
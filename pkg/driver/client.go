@@ -25,10 +25,13 @@ import (
 
 	"github.com/cectc/dbpack/pkg/constant"
 	err2 "github.com/cectc/dbpack/pkg/errors"
+	"github.com/cectc/dbpack/pkg/log"
 	"github.com/cectc/dbpack/pkg/misc"
 	"github.com/cectc/dbpack/pkg/mysql"
 	"github.com/cectc/dbpack/pkg/packet"
+	"github.com/cectc/dbpack/pkg/proto"
 	"github.com/cectc/dbpack/pkg/tracing"
+	"github.com/cectc/dbpack/third_party/cache"
 	"github.com/cectc/dbpack/third_party/pools"
 )
 
@@ -73,6 +76,14 @@ type BackendConnection struct {
 	serverVersion string
 
 	characterSet uint8
+
+	// session is the session state of the client applied to the connection,
+	// it is nil if the connection is in the state it is created with.
+	session *proto.Session
+
+	// stmts caches the statements prepared on the connection, keyed by
+	// the schema and the sql text.
+	stmts *cache.LRUCache
 }
 
 func (conn *BackendConnection) DataSourceName() string {
@@ -506,11 +517,11 @@ func (conn *BackendConnection) WriteComStmtClose(statementID uint32) (err error)
 	data := conn.StartEphemeralPacket(4 + 1)
 	data[0] = constant.ComStmtClose
 	misc.WriteUint32(data, 1, statementID)
+	// No response is sent back to the client.
 	if err := conn.WriteEphemeralPacket(); err != nil {
 		return err2.NewSQLError(constant.CRServerGone, constant.SSUnknownSQLState, err.Error())
 	}
-
-	return conn.readResultOK()
+	return nil
 }
 
 // ReadQueryResult gets the result from the last written query.
@@ -532,22 +543,54 @@ func (conn *BackendConnection) ReadQueryResult(ctx context.Context, wantFields b
 	result = &mysql.Result{
 		AffectedRows: affectedRows,
 		InsertId:     lastInsertID,
-		Fields:       make([]*mysql.Field, colNumber),
 	}
+	if result.Fields, err = conn.readColumns(colNumber, wantFields); err != nil {
+		return nil, false, 0, err
+	}
+
+	// read each row until EOF or OK packet.
+	for {
+		//// Check we're not over the limit before we add more.
+		//if len(result.Rows) == maxrows {
+		//	if err := conn.DrainResults(); err != nil {
+		//		return nil, false, 0, err
+		//	}
+		//	return nil, false, 0, err2.NewSQLError(constant.ERMaxRowsExceeded, constant.SSUnknownSQLState, "Row count exceeded %d")
+		//}
+
+		row, more, warnings, err := conn.readRow(ctx, result.Fields)
+		if err != nil {
+			return nil, false, 0, err
+		}
+		if row == nil {
+			// Strip the partial Fields before returning.
+			if !wantFields {
+				result.Fields = nil
+			}
+			result.AffectedRows = uint64(len(result.Rows))
+			return result, more, warnings, nil
+		}
+		result.Rows = append(result.Rows, row)
+	}
+}
+
+// readColumns reads the column definitions of a result set, and the EOF packet following them.
+func (conn *BackendConnection) readColumns(colNumber int, wantFields bool) ([]*mysql.Field, error) {
+	fields := make([]*mysql.Field, colNumber)
 
 	// Read column headers. One packet per column.
 	// Build the fields.
 	for i := 0; i < colNumber; i++ {
 		field := &mysql.Field{}
-		result.Fields[i] = field
+		fields[i] = field
 
 		if wantFields {
 			if err := conn.ReadColumnDefinition(field, i); err != nil {
-				return nil, false, 0, err
+				return nil, err
 			}
 		} else {
 			if err := conn.ReadColumnDefinitionType(field, i); err != nil {
-				return nil, false, 0, err
+				return nil, err
 			}
 		}
 	}
@@ -556,7 +599,7 @@ func (conn *BackendConnection) ReadQueryResult(ctx context.Context, wantFields b
 		// EOF is only present here if it's not deprecated.
 		data, err := conn.ReadEphemeralPacket()
 		if err != nil {
-			return nil, false, 0, err2.NewSQLError(constant.CRServerLost, constant.SSUnknownSQLState, "%v", err)
+			return nil, err2.NewSQLError(constant.CRServerLost, constant.SSUnknownSQLState, "%v", err)
 		}
 		if packet.IsEOFPacket(data) {
 
@@ -567,64 +610,51 @@ func (conn *BackendConnection) ReadQueryResult(ctx context.Context, wantFields b
 
 		} else if packet.IsErrorPacket(data) {
 			defer conn.RecycleReadPacket()
-			return nil, false, 0, packet.ParseErrorPacket(data)
+			return nil, packet.ParseErrorPacket(data)
 		} else {
 			defer conn.RecycleReadPacket()
-			return nil, false, 0, fmt.Errorf("unexpected packet after fields: %v", data)
+			return nil, fmt.Errorf("unexpected packet after fields: %v", data)
 		}
 	}
+	return fields, nil
+}
 
-	// read each row until EOF or OK packet.
-	for {
-		data, err := conn.ReadPacket()
-		if err != nil {
-			return nil, false, 0, err
-		}
+// readRow reads a row of the result set, the row is nil if the EOF or OK packet
+// ending the result set is read.
+func (conn *BackendConnection) readRow(ctx context.Context, fields []*mysql.Field) (row proto.Row, more bool, warnings uint16, err error) {
+	data, err := conn.ReadPacket()
+	if err != nil {
+		return nil, false, 0, err
+	}
 
-		if packet.IsEOFPacket(data) {
-			// Strip the partial Fields before returning.
-			if !wantFields {
-				result.Fields = nil
+	if packet.IsEOFPacket(data) {
+		// The deprecated EOF packets change means that this is either an
+		// EOF packet or an OK packet with the EOF type code.
+		if conn.capabilities&constant.CapabilityClientDeprecateEOF == 0 {
+			warnings, more, err = packet.ParseEOFPacket(data)
+			if err != nil {
+				return nil, false, 0, err
 			}
-			result.AffectedRows = uint64(len(result.Rows))
-
-			// The deprecated EOF packets change means that this is either an
-			// EOF packet or an OK packet with the EOF type code.
-			if conn.capabilities&constant.CapabilityClientDeprecateEOF == 0 {
-				warnings, more, err = packet.ParseEOFPacket(data)
-				if err != nil {
-					return nil, false, 0, err
-				}
-			} else {
-				var statusFlags uint16
-				_, _, statusFlags, warnings, err = packet.ParseOKPacket(data)
-				if err != nil {
-					return nil, false, 0, err
-				}
-				more = (statusFlags & constant.ServerMoreResultsExists) != 0
+		} else {
+			var statusFlags uint16
+			_, _, statusFlags, warnings, err = packet.ParseOKPacket(data)
+			if err != nil {
+				return nil, false, 0, err
 			}
-			return result, more, warnings, nil
-
-		} else if packet.IsErrorPacket(data) {
-			// Error packet.
-			return nil, false, 0, packet.ParseErrorPacket(data)
+			more = (statusFlags & constant.ServerMoreResultsExists) != 0
 		}
+		return nil, more, warnings, nil
+	} else if packet.IsErrorPacket(data) {
+		// Error packet.
+		return nil, false, 0, packet.ParseErrorPacket(data)
+	}
 
-		//// Check we're not over the limit before we add more.
-		//if len(result.Rows) == maxrows {
-		//	if err := conn.DrainResults(); err != nil {
-		//		return nil, false, 0, err
-		//	}
-		//	return nil, false, 0, err2.NewSQLError(constant.ERMaxRowsExceeded, constant.SSUnknownSQLState, "Row count exceeded %d")
-		//}
-
-		// Regular row.
-		row, err := conn.ParseRow(ctx, data, result.Fields)
-		if err != nil {
-			return nil, false, 0, err
-		}
-		result.Rows = append(result.Rows, row)
+	// Regular row.
+	row, err = conn.ParseRow(ctx, data, fields)
+	if err != nil {
+		return nil, false, 0, err
 	}
+	return row, false, 0, nil
 }
 
 func (conn *BackendConnection) ReadComQueryResponse() (affectedRows uint64, lastInsertID uint64, status int, more bool, warnings uint16, err error) {
@@ -973,7 +1003,15 @@ func (conn *BackendConnection) PrepareQuery(ctx context.Context, query string, d
 	return stmt.query(ctx, data)
 }
 
+// prepare returns the statement prepared on the connection for the query, the statement is
+// prepared if it is not cached, and it is closed when it is evicted from the cache.
 func (conn *BackendConnection) prepare(query string) (*BackendStatement, error) {
+	stmts := conn.stmtCache()
+	key := conn.currentSchema() + "\x00" + query
+	if stmt, ok := stmts.Get(key); ok {
+		return stmt.(*BackendStatement), nil
+	}
+
 	// This is a new command, need to reset the sequence.
 	conn.ResetSequence()
 
@@ -1002,6 +1040,36 @@ func (conn *BackendConnection) prepare(query string) (*BackendStatement, error)
 			err = conn.DrainResults()
 		}
 	}
+	if err != nil {
+		return nil, err
+	}
+
+	stmts.Set(key, stmt)
+	return stmt, nil
+}
+
+func (conn *BackendConnection) stmtCache() *cache.LRUCache {
+	if conn.stmts == nil {
+		capacity := conn.conf.StmtCacheSize
+		if capacity <= 0 {
+			capacity = constant.DefaultStmtCacheSize
+		}
+		conn.stmts = cache.NewLRUCache(int64(capacity))
+		conn.stmts.SetOnEvicted(func(key string, value cache.Value) {
+			stmt := value.(*BackendStatement)
+			if err := conn.WriteComStmtClose(stmt.id); err != nil {
+				log.Warnf("close statement %d on %s failed, err: %v", stmt.id, conn.dataSourceName, err)
+			}
+		})
+	}
+	return conn.stmts
+}
 
-	return stmt, err
+// currentSchema returns the default database of the connection, statements
+// prepared in different databases are cached separately.
+func (conn *BackendConnection) currentSchema() string {
+	if conn.session != nil {
+		return conn.session.Schema()
+	}
+	return conn.conf.DBName
 }
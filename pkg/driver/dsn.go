@@ -44,6 +44,7 @@ type Config struct {
 	Collation        string            // Connection collation
 	Loc              *time.Location    // Location for time.Time values
 	MaxAllowedPacket int               // Max packet size allowed
+	StmtCacheSize    int               // Max number of prepared statements cached per connection
 	ServerPubKey     string            // Server public key name
 	pubKey           *rsa.PublicKey    // Server public key
 	TLSConfig        string            // TLS configuration name
@@ -354,6 +355,13 @@ func parseDSNParams(cfg *Config, params string) (err error) {
 				return errors.New("invalid bool value: " + value)
 			}
 
+		// Prepared statement cache size
+		case "stmtCacheSize":
+			cfg.StmtCacheSize, err = strconv.Atoi(value)
+			if err != nil {
+				return
+			}
+
 		// Disable client deprecate EOF
 		case "disableClientDeprecateEOF":
 			var isBool bool
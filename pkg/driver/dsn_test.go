@@ -87,6 +87,9 @@ var testDSNs = []struct {
 }, {
 	"user:password@/dbname?allowNativePasswords=false&checkConnLiveness=false&maxAllowedPacket=0",
 	&Config{User: "user", Passwd: "password", Net: "tcp", Addr: "127.0.0.1:3306", DBName: "dbname", Collation: "utf8mb4_general_ci", Loc: time.UTC, MaxAllowedPacket: 0, AllowNativePasswords: false, CheckConnLiveness: false, DisableClientDeprecateEOF: true},
+}, {
+	"user:password@/dbname?stmtCacheSize=16",
+	&Config{User: "user", Passwd: "password", Net: "tcp", Addr: "127.0.0.1:3306", DBName: "dbname", Collation: "utf8mb4_general_ci", Loc: time.UTC, MaxAllowedPacket: constant.DefaultMaxAllowedPacket, StmtCacheSize: 16, AllowNativePasswords: true, CheckConnLiveness: true, DisableClientDeprecateEOF: true},
 }, {
 	"user:p@ss(word)@tcp([de:ad:be:ef::ca:fe]:80)/dbname?loc=Local",
 	&Config{User: "user", Passwd: "p@ss(word)", Net: "tcp", Addr: "[de:ad:be:ef::ca:fe]:80", DBName: "dbname", Collation: "utf8mb4_general_ci", Loc: time.Local, MaxAllowedPacket: constant.DefaultMaxAllowedPacket, AllowNativePasswords: true, CheckConnLiveness: true, DisableClientDeprecateEOF: true},
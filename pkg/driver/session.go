@@ -0,0 +1,116 @@
+/*
+ * Copyright 2022 CECTC, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package driver
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/cectc/dbpack/pkg/proto"
+)
+
+// SyncSession applies the session state of the client to the connection, the variables
+// assigned differently from the applied ones are set with one SET statement.
+func (conn *BackendConnection) SyncSession(ctx context.Context, session *proto.Session) error {
+	applied := conn.appliedSession()
+	if schema := session.Schema(); schema != "" && schema != applied.Schema() {
+		if err := conn.initDB(schema); err != nil {
+			return err
+		}
+		applied.SetSchema(schema)
+	}
+
+	var assignments []string
+	for _, key := range applied.Keys() {
+		if _, ok := session.Assignment(key); !ok {
+			assignments = append(assignments, conn.resetAssignment(key))
+		}
+	}
+	keys := session.Keys()
+	for _, key := range keys {
+		assignment, _ := session.Assignment(key)
+		if current, ok := applied.Assignment(key); !ok || current != assignment {
+			assignments = append(assignments, assignment)
+		}
+	}
+	if len(assignments) == 0 {
+		return nil
+	}
+	if _, err := conn.Execute(ctx, "SET "+strings.Join(assignments, ", "), false); err != nil {
+		return err
+	}
+
+	synced := session.Clone()
+	synced.SetSchema(applied.Schema())
+	conn.session = synced
+	return nil
+}
+
+// ResetSession resets the variables applied to their default values, and switches back
+// to the database of the data source, it is called before the connection is put back to the pool.
+func (conn *BackendConnection) ResetSession() error {
+	if conn.session == nil {
+		return nil
+	}
+	applied := conn.session
+	if keys := applied.Keys(); len(keys) != 0 {
+		assignments := make([]string, 0, len(keys))
+		for _, key := range keys {
+			assignments = append(assignments, conn.resetAssignment(key))
+		}
+		if _, err := conn.Execute(context.Background(), "SET "+strings.Join(assignments, ", "), false); err != nil {
+			return err
+		}
+	}
+	if conn.conf.DBName != "" && applied.Schema() != conn.conf.DBName {
+		if err := conn.initDB(conn.conf.DBName); err != nil {
+			return err
+		}
+	}
+	conn.session = nil
+	return nil
+}
+
+func (conn *BackendConnection) appliedSession() *proto.Session {
+	if conn.session == nil {
+		conn.session = proto.NewSession()
+		conn.session.SetSchema(conn.conf.DBName)
+	}
+	return conn.session
+}
+
+func (conn *BackendConnection) resetAssignment(key string) string {
+	switch {
+	case key == proto.SessionNames:
+		collation := conn.conf.Collation
+		return fmt.Sprintf("NAMES '%s' COLLATE '%s'", strings.SplitN(collation, "_", 2)[0], collation)
+	case strings.HasPrefix(key, "@@"):
+		return fmt.Sprintf("@@SESSION.`%s`=DEFAULT", key[2:])
+	default:
+		return fmt.Sprintf("@`%s`=NULL", key[1:])
+	}
+}
+
+// initDB changes the default database of the connection.
+func (conn *BackendConnection) initDB(schema string) error {
+	if err := conn.WriteComInitDB(schema); err != nil {
+		return err
+	}
+	_, _, _, _, _, err := conn.ReadComQueryResponse()
+	return err
+}
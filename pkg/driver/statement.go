@@ -27,7 +27,6 @@ import (
 
 	"github.com/cectc/dbpack/pkg/constant"
 	"github.com/cectc/dbpack/pkg/errors"
-	"github.com/cectc/dbpack/pkg/log"
 	"github.com/cectc/dbpack/pkg/misc"
 	"github.com/cectc/dbpack/pkg/mysql"
 	"github.com/cectc/dbpack/pkg/packet"
@@ -40,6 +39,11 @@ type BackendStatement struct {
 	sql        string
 }
 
+// Size implements cache.Value, the statement cache is limited by the number of statements.
+func (stmt *BackendStatement) Size() int {
+	return 1
+}
+
 // prepare Result Packets
 // http://dev.mysql.com/doc/internals/en/com-stmt-prepare-response.html
 func (stmt *BackendStatement) readPrepareResultPacket() (uint16, error) {
@@ -416,12 +420,6 @@ func (stmt *BackendStatement) queryArgs(ctx context.Context, args []interface{})
 }
 
 func (stmt *BackendStatement) exec(args []byte) (*mysql.Result, uint16, error) {
-	defer func() {
-		if err := stmt.conn.WriteComStmtClose(stmt.id); err != nil {
-			log.Error(err)
-		}
-	}()
-
 	args[1] = byte(stmt.id)
 	args[2] = byte(stmt.id >> 8)
 	args[3] = byte(stmt.id >> 16)
@@ -0,0 +1,143 @@
+/*
+ * Copyright 2022 CECTC, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package driver
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"io"
+
+	err2 "github.com/cectc/dbpack/pkg/errors"
+	"github.com/cectc/dbpack/pkg/mysql"
+	"github.com/cectc/dbpack/pkg/proto"
+	"github.com/cectc/dbpack/pkg/tracing"
+)
+
+// rowStream reads the rows of a result set from the backend connection one by one.
+type rowStream struct {
+	ctx      context.Context
+	conn     *BackendConnection
+	fields   []*mysql.Field
+	warnings uint16
+	done     bool
+}
+
+func (rs *rowStream) Next() (proto.Row, error) {
+	if rs.done {
+		return nil, io.EOF
+	}
+	row, _, warnings, err := rs.conn.readRow(rs.ctx, rs.fields)
+	if err != nil {
+		rs.done = true
+		return nil, err
+	}
+	if row == nil {
+		rs.done = true
+		rs.warnings = warnings
+		return nil, io.EOF
+	}
+	return row, nil
+}
+
+func (rs *rowStream) Warnings() uint16 {
+	return rs.warnings
+}
+
+// Close drains the rows not read yet, so that the connection can be reused.
+func (rs *rowStream) Close() error {
+	if rs.done {
+		return nil
+	}
+	rs.done = true
+	return rs.conn.DrainResults()
+}
+
+// readStreamResult reads the response of the last written query, the rows of the result set
+// are left on the connection and read by the returned StreamResult.
+func (conn *BackendConnection) readStreamResult(ctx context.Context) (proto.Result, uint16, error) {
+	affectedRows, lastInsertID, colNumber, _, warnings, err := conn.ReadComQueryResponse()
+	if err != nil {
+		return nil, 0, err
+	}
+	if colNumber == 0 {
+		return &mysql.Result{
+			AffectedRows: affectedRows,
+			InsertId:     lastInsertID,
+		}, warnings, nil
+	}
+	fields, err := conn.readColumns(colNumber, true)
+	if err != nil {
+		return nil, 0, err
+	}
+	return &mysql.StreamResult{
+		Fields: fields,
+		Rows: &rowStream{
+			ctx:    ctx,
+			conn:   conn,
+			fields: fields,
+		},
+	}, 0, nil
+}
+
+// ExecuteStream sends the query as a COM_QUERY packet, if the query returns a result set,
+// a *mysql.StreamResult is returned, the connection can not be used before its rows are
+// read to the end or closed.
+func (conn *BackendConnection) ExecuteStream(ctx context.Context, query string) (result proto.Result, warnings uint16, err error) {
+	_, span := tracing.GetTraceSpan(ctx, tracing.ConnQuery)
+	defer func() {
+		if err != nil {
+			if sqlerr, ok := err.(*err2.SQLError); ok {
+				sqlerr.Query = query
+			}
+			span.RecordError(err)
+		}
+		span.End()
+	}()
+
+	if err = conn.WriteComQuery(query); err != nil {
+		return nil, 0, err
+	}
+	return conn.readStreamResult(ctx)
+}
+
+// PrepareQueryArgsStream is the streaming version of PrepareQueryArgs.
+func (conn *BackendConnection) PrepareQueryArgsStream(ctx context.Context, query string, args []interface{}) (result proto.Result, warnings uint16, err error) {
+	_, span := tracing.GetTraceSpan(ctx, tracing.ConnStmtExecute)
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+		}
+		span.End()
+	}()
+
+	stmt, err := conn.prepare(query)
+	if err != nil {
+		return nil, 0, err
+	}
+	nargs := make([]interface{}, len(args))
+	for i, arg := range args {
+		nargs[i], err = driver.DefaultParameterConverter.ConvertValue(arg)
+		if err != nil {
+			return nil, 0, fmt.Errorf("sql: converting argument %t type: %v", arg, err)
+		}
+	}
+	if err = stmt.writeExecutePacket(nargs); err != nil {
+		return nil, 0, err
+	}
+	return conn.readStreamResult(ctx)
+}
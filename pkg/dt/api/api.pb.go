@@ -484,11 +484,17 @@ func (m *GlobalBeginResponse) GetXID() string {
 
 // BranchRegisterRequest represents a branch transaction join in the global transaction
 type BranchRegisterRequest struct {
-	XID             string                   `protobuf:"bytes,1,opt,name=XID,proto3" json:"XID,omitempty"`
-	ResourceID      string                   `protobuf:"bytes,2,opt,name=ResourceID,proto3" json:"ResourceID,omitempty"`
-	LockKey         string                   `protobuf:"bytes,3,opt,name=LockKey,proto3" json:"LockKey,omitempty"`
-	BranchType      BranchSession_BranchType `protobuf:"varint,4,opt,name=BranchType,proto3,enum=api.BranchSession_BranchType" json:"BranchType,omitempty"`
-	ApplicationData []byte                   `protobuf:"bytes,5,opt,name=ApplicationData,proto3" json:"ApplicationData,omitempty"`
+	XID string `protobuf:"bytes,1,opt,name=XID,proto3" json:"XID,omitempty"`
+	// ResourceID is the name of a data source of the application for AT branches
+	ResourceID string                   `protobuf:"bytes,2,opt,name=ResourceID,proto3" json:"ResourceID,omitempty"`
+	LockKey    string                   `protobuf:"bytes,3,opt,name=LockKey,proto3" json:"LockKey,omitempty"`
+	BranchType BranchSession_BranchType `protobuf:"varint,4,opt,name=BranchType,proto3,enum=api.BranchSession_BranchType" json:"BranchType,omitempty"`
+	// ApplicationData is required by TCC branches. It is a dbpack RequestContext in big endian: a uint32
+	//       length followed by the json encoded action context, a uint32 length followed by the json encoded http
+	//       headers, and a uint32 length followed by the http body. The action context must contain "host",
+	//       "tcc_commit_request_path" and "tcc_rollback_request_path", the transaction manager posts the headers
+	//       and the body to them in phase two.
+	ApplicationData []byte `protobuf:"bytes,5,opt,name=ApplicationData,proto3" json:"ApplicationData,omitempty"`
 }
 
 func (m *BranchRegisterRequest) Reset()      { *m = BranchRegisterRequest{} }
@@ -1294,66 +1300,69 @@ func init() {
 func init() { proto.RegisterFile("api.proto", fileDescriptor_00212fb1f9d3bf1c) }
 
 var fileDescriptor_00212fb1f9d3bf1c = []byte{
-	// 938 bytes of a gzipped FileDescriptorProto
+	// 982 bytes of a gzipped FileDescriptorProto
 	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xcc, 0x57, 0xcd, 0x6e, 0xdb, 0x46,
-	0x10, 0xe6, 0x92, 0x92, 0x2c, 0x4d, 0xfc, 0xc3, 0xae, 0xff, 0x18, 0xb5, 0x65, 0x05, 0xa2, 0x40,
-	0xd5, 0x1e, 0x1c, 0xd4, 0x3d, 0x14, 0x6d, 0x90, 0x83, 0x4c, 0x23, 0xa9, 0xd1, 0xa6, 0x3f, 0x94,
-	0x0e, 0x41, 0x6f, 0x6b, 0x7a, 0x21, 0x13, 0xa1, 0x48, 0x86, 0xa4, 0x52, 0xf8, 0x52, 0xe4, 0x11,
-	0xfa, 0x14, 0x45, 0xfa, 0x20, 0x05, 0x7a, 0xe8, 0xc1, 0xe8, 0x29, 0x40, 0x2f, 0xb5, 0x7c, 0xe9,
-	0x31, 0x8f, 0x50, 0x70, 0xc9, 0x15, 0x77, 0x29, 0xc6, 0x15, 0x02, 0x05, 0xc8, 0x4d, 0xf3, 0xed,
-	0x70, 0x67, 0xe6, 0x9b, 0x6f, 0x86, 0x14, 0x74, 0x48, 0xe4, 0x1d, 0x44, 0x71, 0x98, 0x86, 0x58,
-	0x23, 0x91, 0x67, 0xfd, 0xa5, 0xc2, 0xc6, 0x03, 0x3f, 0x3c, 0x25, 0xfe, 0x90, 0x26, 0x89, 0x17,
-	0x06, 0x58, 0x07, 0xed, 0xd1, 0xc9, 0xb1, 0x81, 0x7a, 0xa8, 0xdf, 0x71, 0xb2, 0x9f, 0xf8, 0x43,
-	0xd8, 0x18, 0x44, 0x91, 0xef, 0xb9, 0x24, 0xf5, 0xc2, 0xe0, 0xe4, 0xd8, 0x50, 0xd9, 0x99, 0x0c,
-	0x66, 0x5e, 0xa3, 0x98, 0x04, 0x09, 0x71, 0x0b, 0x2f, 0xad, 0x87, 0xfa, 0x9a, 0x23, 0x83, 0xb8,
-	0x0f, 0x5b, 0x02, 0xf0, 0x2d, 0x99, 0x50, 0xa3, 0xc1, 0x6e, 0xab, 0xc2, 0xd8, 0x80, 0xb5, 0x91,
-	0x37, 0xa1, 0xe1, 0x34, 0x35, 0x9a, 0x3d, 0xd4, 0x6f, 0x3a, 0xdc, 0xc4, 0xef, 0x41, 0xe7, 0x88,
-	0x8e, 0xbd, 0x20, 0xb3, 0x8d, 0x16, 0x8b, 0x52, 0x02, 0xf8, 0x73, 0x68, 0x0d, 0x53, 0x92, 0x4e,
-	0x13, 0x63, 0xad, 0x87, 0xfa, 0x9b, 0x87, 0x1f, 0x1c, 0x64, 0x25, 0x4b, 0x35, 0x72, 0x8b, 0xb9,
-	0x39, 0x85, 0xbb, 0xf5, 0x15, 0xac, 0x8b, 0x38, 0xee, 0x40, 0x93, 0xdd, 0xaa, 0x2b, 0x78, 0x13,
-	0xc0, 0x0e, 0x27, 0x13, 0x2f, 0x4d, 0xbd, 0x60, 0xac, 0x23, 0xbc, 0x05, 0xb7, 0x9c, 0xd0, 0xf7,
-	0x4f, 0x89, 0xfb, 0x38, 0x03, 0x54, 0xbc, 0x0e, 0xed, 0xfb, 0x5e, 0xe0, 0x25, 0xe7, 0xf4, 0x4c,
-	0xd7, 0xac, 0xdf, 0x1b, 0xb0, 0x71, 0x14, 0x93, 0xc0, 0x3d, 0xe7, 0xa4, 0x76, 0xa1, 0x9d, 0x03,
-	0x73, 0x66, 0xe7, 0xf6, 0x92, 0xf4, 0xf6, 0x61, 0x4b, 0xba, 0x72, 0x4e, 0x70, 0x15, 0xe6, 0x0d,
-	0x6c, 0x48, 0x0d, 0x94, 0x5b, 0xd3, 0xac, 0x6b, 0x8d, 0x09, 0xe0, 0xd0, 0x24, 0x9c, 0xc6, 0x2e,
-	0x3d, 0x39, 0x66, 0xbc, 0x76, 0x1c, 0x01, 0xc9, 0x1a, 0xf2, 0x4d, 0xe8, 0x3e, 0xfe, 0x9a, 0x5e,
-	0x30, 0x66, 0x3b, 0x0e, 0x37, 0xf1, 0xa7, 0xd0, 0x18, 0x5d, 0x44, 0xd4, 0x68, 0x33, 0xc2, 0xdf,
-	0x67, 0x84, 0x4b, 0x59, 0x15, 0x56, 0xe6, 0xe4, 0x30, 0x57, 0xa1, 0x4b, 0x1d, 0xa1, 0x4b, 0x75,
-	0x0f, 0xc9, 0x5d, 0xca, 0x78, 0x10, 0x88, 0x39, 0x26, 0x29, 0x31, 0xa0, 0x87, 0xfa, 0xeb, 0x4e,
-	0x15, 0x96, 0x65, 0x72, 0xab, 0x22, 0x13, 0xeb, 0x0e, 0x40, 0x99, 0x14, 0x6e, 0x81, 0x3a, 0x18,
-	0xe9, 0x0a, 0x5e, 0x03, 0x6d, 0x64, 0xdb, 0x3a, 0xc2, 0x6d, 0x68, 0x0c, 0x07, 0x0f, 0x06, 0xba,
-	0x9a, 0x1d, 0x3d, 0x1a, 0xe8, 0x9a, 0xf5, 0x04, 0xd6, 0xc5, 0x84, 0x32, 0x4d, 0x38, 0x74, 0xec,
-	0x25, 0x29, 0x8d, 0xe9, 0x99, 0xae, 0x60, 0x0c, 0x9b, 0xdf, 0x9f, 0x93, 0x84, 0x7e, 0x17, 0xd0,
-	0xfb, 0xc4, 0xf3, 0xe9, 0x99, 0x8e, 0xf0, 0x1e, 0x60, 0x86, 0x8d, 0x7e, 0x0a, 0x05, 0xfd, 0xa8,
-	0x78, 0x1f, 0xb6, 0x39, 0x2e, 0xea, 0x48, 0xcb, 0x74, 0x64, 0x87, 0x93, 0xc8, 0xa7, 0x29, 0xd5,
-	0x1b, 0xd6, 0xcf, 0x80, 0x73, 0x45, 0xb2, 0xb4, 0x1d, 0xfa, 0x64, 0x4a, 0x93, 0x74, 0x51, 0x2f,
-	0xa8, 0x4e, 0x2f, 0xc2, 0xf8, 0xa8, 0xf2, 0xf8, 0xd4, 0x8c, 0xa0, 0x56, 0x3b, 0x82, 0x56, 0x0c,
-	0xdb, 0x52, 0xfc, 0x24, 0x0a, 0x83, 0x84, 0xe2, 0x3b, 0x4c, 0x28, 0x53, 0x3f, 0xb5, 0xc3, 0x33,
-	0xca, 0xa2, 0x6f, 0x1e, 0x6e, 0xb1, 0xfe, 0x95, 0xb0, 0x23, 0xb8, 0x64, 0xb9, 0x3c, 0xa4, 0x49,
-	0x42, 0xc6, 0xb4, 0xd0, 0x36, 0x37, 0x17, 0xb5, 0x6a, 0xfd, 0x89, 0x60, 0x37, 0xe7, 0x99, 0xb3,
-	0xcb, 0xeb, 0x5e, 0x5c, 0x4c, 0xb2, 0x62, 0xd5, 0x9b, 0x14, 0xab, 0xc9, 0x8a, 0xbd, 0x27, 0x76,
-	0x9f, 0x85, 0xff, 0x5f, 0xdd, 0x8a, 0x72, 0xa9, 0x11, 0x61, 0xb3, 0x56, 0x84, 0xd6, 0x6f, 0x08,
-	0xf6, 0xaa, 0xe5, 0xac, 0x9e, 0x46, 0x71, 0xbd, 0x68, 0x95, 0xf5, 0x52, 0xb3, 0x38, 0x1a, 0xb5,
-	0x8b, 0xc3, 0x7a, 0x0a, 0xdb, 0x3c, 0xd5, 0x28, 0x8c, 0x53, 0xce, 0xfb, 0x4d, 0xbb, 0xcb, 0x96,
-	0x87, 0x82, 0xe5, 0xb5, 0xc4, 0x30, 0x4b, 0x0f, 0x59, 0x04, 0x76, 0xe4, 0xb8, 0x2b, 0x27, 0xc8,
-	0x72, 0x60, 0x2f, 0x57, 0x72, 0x26, 0x80, 0x1f, 0xa6, 0x34, 0xbe, 0xe0, 0xd5, 0xc9, 0x1a, 0x42,
-	0x37, 0x69, 0x48, 0x95, 0x34, 0x64, 0x3d, 0x43, 0xb0, 0xbf, 0x70, 0xe9, 0x1b, 0xe9, 0x6d, 0x76,
-	0x3f, 0x39, 0xf5, 0xf3, 0x39, 0x6d, 0x3b, 0x73, 0xdb, 0xfa, 0x88, 0x0f, 0x68, 0xc1, 0xeb, 0xab,
-	0x26, 0xc5, 0xfa, 0x15, 0xc1, 0x8e, 0xec, 0xb9, 0xfa, 0x44, 0x6d, 0xf9, 0xfd, 0xc9, 0x92, 0x5d,
-	0xe2, 0xf5, 0x2b, 0x3d, 0x54, 0x56, 0x94, 0xef, 0xcb, 0x65, 0x2a, 0xe2, 0x9e, 0x6f, 0x69, 0x45,
-	0x1f, 0xc3, 0x6e, 0x6e, 0xf3, 0x4d, 0xff, 0xea, 0x9a, 0x9e, 0x23, 0x2e, 0xd3, 0xd2, 0xf7, 0x2d,
-	0xad, 0xca, 0xe7, 0x7d, 0x92, 0x77, 0xc5, 0xe2, 0x8e, 0xae, 0x46, 0x53, 0x5f, 0x27, 0x5a, 0xd9,
-	0xec, 0x37, 0xb6, 0x22, 0x56, 0x42, 0xcb, 0x27, 0x5f, 0x88, 0xf9, 0xe0, 0x1d, 0xd0, 0x4b, 0xab,
-	0xf8, 0x28, 0x50, 0xf0, 0x2e, 0xbc, 0x53, 0xa2, 0xc3, 0xa9, 0xeb, 0xd2, 0x24, 0xd1, 0xd1, 0xe1,
-	0xdf, 0x08, 0x6e, 0x0b, 0x2f, 0xe0, 0x87, 0x24, 0x20, 0x63, 0x1a, 0x0f, 0x69, 0xfc, 0xd4, 0x73,
-	0x29, 0xfe, 0xb2, 0xf8, 0x18, 0xc5, 0xfb, 0x42, 0x42, 0xe2, 0x67, 0x41, 0xd7, 0x58, 0x3c, 0x28,
-	0x48, 0xba, 0x07, 0xad, 0x7c, 0x46, 0xb0, 0xe8, 0x23, 0x0d, 0x58, 0xf7, 0x76, 0xcd, 0x49, 0xf1,
-	0xb8, 0x0d, 0x6d, 0x2e, 0x47, 0xdc, 0x15, 0xdc, 0x2a, 0x7a, 0xee, 0xbe, 0x5b, 0x7b, 0x96, 0x5f,
-	0x72, 0x74, 0xf7, 0xf2, 0xca, 0x54, 0x5e, 0x5c, 0x99, 0xca, 0xcb, 0x2b, 0x13, 0x3d, 0x9b, 0x99,
-	0xe8, 0xf9, 0xcc, 0x44, 0x7f, 0xcc, 0x4c, 0x74, 0x39, 0x33, 0xd1, 0x3f, 0x33, 0x13, 0xfd, 0x3b,
-	0x33, 0x95, 0x97, 0x33, 0x13, 0xfd, 0x72, 0x6d, 0x2a, 0x97, 0xd7, 0xa6, 0xf2, 0xe2, 0xda, 0x54,
-	0x7e, 0x6c, 0x1e, 0xdc, 0x25, 0x91, 0x77, 0xda, 0x62, 0x7f, 0x58, 0x3e, 0xfb, 0x2f, 0x00, 0x00,
-	0xff, 0xff, 0x03, 0x2f, 0x7e, 0x29, 0xbd, 0x0c, 0x00, 0x00,
+	0x10, 0xe6, 0x92, 0x92, 0x2c, 0x4d, 0x64, 0x89, 0x5d, 0xff, 0xd1, 0x4a, 0xca, 0x0a, 0x44, 0x81,
+	0xaa, 0x3d, 0x38, 0xa8, 0x7b, 0x28, 0xda, 0x20, 0x07, 0x99, 0x46, 0x52, 0xa3, 0x49, 0x7f, 0x28,
+	0x1d, 0x82, 0xde, 0xd6, 0xf4, 0x42, 0x26, 0x42, 0x91, 0x0c, 0x49, 0xa5, 0xf0, 0xa5, 0xc8, 0x23,
+	0xf4, 0x29, 0x8a, 0xf4, 0x11, 0xfa, 0x00, 0x05, 0x7a, 0xe8, 0xc1, 0xe8, 0x29, 0xc7, 0x5a, 0xbe,
+	0xf4, 0x98, 0x47, 0x28, 0xf8, 0xb3, 0xd2, 0x2e, 0xb5, 0x31, 0x8c, 0xc0, 0x01, 0x72, 0xd3, 0xcc,
+	0xce, 0xce, 0xce, 0x7c, 0xf3, 0xcd, 0x0c, 0x05, 0x2d, 0x12, 0x79, 0x7b, 0x51, 0x1c, 0xa6, 0x21,
+	0xd6, 0x48, 0xe4, 0x59, 0xff, 0xa8, 0xb0, 0xfe, 0xd0, 0x0f, 0x8f, 0x89, 0x3f, 0xa2, 0x49, 0xe2,
+	0x85, 0x01, 0xd6, 0x41, 0x7b, 0x72, 0x74, 0x68, 0xa0, 0x3e, 0x1a, 0xb4, 0x9c, 0xec, 0x27, 0xfe,
+	0x18, 0xd6, 0x87, 0x51, 0xe4, 0x7b, 0x2e, 0x49, 0xbd, 0x30, 0x38, 0x3a, 0x34, 0xd4, 0xfc, 0x4c,
+	0x54, 0x66, 0x56, 0xe3, 0x98, 0x04, 0x09, 0x71, 0x4b, 0x2b, 0xad, 0x8f, 0x06, 0x9a, 0x23, 0x2a,
+	0xf1, 0x00, 0xba, 0x9c, 0xe2, 0x3b, 0x32, 0xa5, 0x46, 0x2d, 0xf7, 0x56, 0x55, 0x63, 0x03, 0xd6,
+	0xc6, 0xde, 0x94, 0x86, 0xb3, 0xd4, 0xa8, 0xf7, 0xd1, 0xa0, 0xee, 0x30, 0x11, 0xdf, 0x81, 0xd6,
+	0x01, 0x9d, 0x78, 0x41, 0x26, 0x1b, 0x8d, 0xfc, 0x95, 0xa5, 0x02, 0x7f, 0x09, 0x8d, 0x51, 0x4a,
+	0xd2, 0x59, 0x62, 0xac, 0xf5, 0xd1, 0xa0, 0xb3, 0xff, 0xd1, 0x5e, 0x96, 0xb2, 0x90, 0x23, 0x93,
+	0x72, 0x33, 0xa7, 0x34, 0xb7, 0xbe, 0x81, 0x36, 0xaf, 0xc7, 0x2d, 0xa8, 0xe7, 0x5e, 0x75, 0x05,
+	0x77, 0x00, 0xec, 0x70, 0x3a, 0xf5, 0xd2, 0xd4, 0x0b, 0x26, 0x3a, 0xc2, 0x5d, 0xb8, 0xe5, 0x84,
+	0xbe, 0x7f, 0x4c, 0xdc, 0xa7, 0x99, 0x42, 0xc5, 0x6d, 0x68, 0x3e, 0xf0, 0x02, 0x2f, 0x39, 0xa5,
+	0x27, 0xba, 0x66, 0xfd, 0x59, 0x83, 0xf5, 0x83, 0x98, 0x04, 0xee, 0x29, 0x03, 0xb5, 0x07, 0xcd,
+	0x42, 0xb1, 0x40, 0x76, 0x21, 0x5f, 0x13, 0xde, 0x01, 0x74, 0x05, 0x97, 0x0b, 0x80, 0xab, 0x6a,
+	0x56, 0xc0, 0x9a, 0x50, 0x40, 0xb1, 0x34, 0x75, 0x59, 0x69, 0x4c, 0x00, 0x87, 0x26, 0xe1, 0x2c,
+	0x76, 0xe9, 0xd1, 0x61, 0x8e, 0x6b, 0xcb, 0xe1, 0x34, 0x59, 0x41, 0x1e, 0x85, 0xee, 0xd3, 0x6f,
+	0xe9, 0x59, 0x8e, 0x6c, 0xcb, 0x61, 0x22, 0xfe, 0x1c, 0x6a, 0xe3, 0xb3, 0x88, 0x1a, 0xcd, 0x1c,
+	0xf0, 0x0f, 0x73, 0xc0, 0x85, 0xa8, 0x4a, 0x29, 0x33, 0x72, 0x72, 0x53, 0xae, 0x4a, 0x2d, 0xae,
+	0x4a, 0xb2, 0x4b, 0x62, 0x95, 0x32, 0x1c, 0x38, 0x60, 0x0e, 0x49, 0x4a, 0x0c, 0xe8, 0xa3, 0x41,
+	0xdb, 0xa9, 0xaa, 0x45, 0x9a, 0xdc, 0xaa, 0xd0, 0xc4, 0xba, 0x0b, 0xb0, 0x0c, 0x0a, 0x37, 0x40,
+	0x1d, 0x8e, 0x75, 0x05, 0xaf, 0x81, 0x36, 0xb6, 0x6d, 0x1d, 0xe1, 0x26, 0xd4, 0x46, 0xc3, 0x87,
+	0x43, 0x5d, 0xcd, 0x8e, 0x9e, 0x0c, 0x75, 0xcd, 0x7a, 0x06, 0x6d, 0x3e, 0xa0, 0x8c, 0x13, 0x0e,
+	0x9d, 0x78, 0x49, 0x4a, 0x63, 0x7a, 0xa2, 0x2b, 0x18, 0x43, 0xe7, 0x87, 0x53, 0x92, 0xd0, 0xef,
+	0x03, 0xfa, 0x80, 0x78, 0x3e, 0x3d, 0xd1, 0x11, 0xde, 0x06, 0x9c, 0xeb, 0xc6, 0x3f, 0x87, 0x1c,
+	0x7f, 0x54, 0xbc, 0x03, 0x1b, 0x4c, 0xcf, 0xf3, 0x48, 0xcb, 0x78, 0x64, 0x87, 0xd3, 0xc8, 0xa7,
+	0x29, 0xd5, 0x6b, 0xd6, 0x2f, 0x80, 0x0b, 0x46, 0xe6, 0x61, 0x3b, 0xf4, 0xd9, 0x8c, 0x26, 0xe9,
+	0x2a, 0x5f, 0x90, 0x8c, 0x2f, 0x5c, 0xfb, 0xa8, 0x62, 0xfb, 0x48, 0x5a, 0x50, 0x93, 0xb6, 0xa0,
+	0x15, 0xc3, 0x86, 0xf0, 0x7e, 0x12, 0x85, 0x41, 0x42, 0xf1, 0xdd, 0x9c, 0x28, 0x33, 0x3f, 0xb5,
+	0xc3, 0x13, 0x9a, 0xbf, 0xde, 0xd9, 0xef, 0xe6, 0xf5, 0x5b, 0xaa, 0x1d, 0xce, 0x24, 0x8b, 0xe5,
+	0x31, 0x4d, 0x12, 0x32, 0xa1, 0x25, 0xb7, 0x99, 0xb8, 0xca, 0x55, 0xeb, 0x6f, 0x04, 0x5b, 0x05,
+	0xce, 0x0c, 0x5d, 0x96, 0xf7, 0xea, 0x60, 0x12, 0x19, 0xab, 0x5e, 0xc5, 0x58, 0x4d, 0x64, 0xec,
+	0x7d, 0xbe, 0xfa, 0x46, 0xed, 0x3a, 0xbc, 0xe5, 0xe9, 0x22, 0x21, 0x61, 0x5d, 0x4a, 0x42, 0xeb,
+	0x77, 0x04, 0xdb, 0xd5, 0x74, 0x6e, 0x1e, 0x46, 0x7e, 0xbc, 0x68, 0x95, 0xf1, 0x22, 0x19, 0x1c,
+	0x35, 0xe9, 0xe0, 0xb0, 0x9e, 0xc3, 0x06, 0x0b, 0x35, 0x0a, 0xe3, 0x94, 0xe1, 0x7e, 0xd5, 0xec,
+	0xb2, 0xc5, 0xa6, 0x30, 0xd4, 0xeb, 0x35, 0xb3, 0x70, 0xc9, 0x22, 0xb0, 0x29, 0xbe, 0x7b, 0xe3,
+	0x00, 0x59, 0x0e, 0x6c, 0x17, 0x4c, 0xce, 0x08, 0xf0, 0xe3, 0x8c, 0xc6, 0x67, 0x2c, 0x3b, 0x91,
+	0x43, 0xe8, 0x2a, 0x0e, 0xa9, 0x02, 0x87, 0xac, 0x17, 0x08, 0x76, 0x56, 0x9c, 0xbe, 0x93, 0xda,
+	0x66, 0xfe, 0xc9, 0xb1, 0x5f, 0xf4, 0x69, 0xd3, 0x59, 0xc8, 0xd6, 0x27, 0xac, 0x41, 0x4b, 0x5c,
+	0xdf, 0xd4, 0x29, 0xd6, 0x6f, 0x08, 0x36, 0x45, 0xcb, 0x9b, 0x0f, 0xd4, 0x16, 0xf7, 0xa7, 0xa1,
+	0x71, 0x5c, 0xb8, 0x62, 0xfd, 0x0a, 0x97, 0x96, 0x19, 0x15, 0xf3, 0xf2, 0x3a, 0x19, 0x31, 0xcb,
+	0xf7, 0x34, 0xa3, 0x4f, 0x61, 0xab, 0x90, 0xd9, 0xa4, 0x7f, 0x73, 0x4e, 0x2f, 0x11, 0x6c, 0x57,
+	0x6d, 0xdf, 0xd3, 0xac, 0x7c, 0x56, 0x27, 0x71, 0x56, 0xac, 0xce, 0xe8, 0xea, 0x6b, 0xea, 0xdb,
+	0xbc, 0xb6, 0x2c, 0xf6, 0x3b, 0x1b, 0x11, 0x37, 0x02, 0xcb, 0x67, 0x5f, 0xf1, 0xf1, 0xe0, 0x4d,
+	0xd0, 0x97, 0x52, 0xf9, 0x51, 0xa0, 0xe0, 0x2d, 0xf8, 0x60, 0xa9, 0x1d, 0xcd, 0x5c, 0x97, 0x26,
+	0x89, 0x8e, 0xf6, 0xff, 0xd0, 0x60, 0x97, 0x5b, 0xc0, 0x8f, 0x49, 0x40, 0x26, 0x34, 0x1e, 0xd1,
+	0xf8, 0xb9, 0xe7, 0x52, 0xfc, 0x75, 0xf9, 0x31, 0x8a, 0x77, 0xb8, 0x80, 0xf8, 0xcf, 0x82, 0x9e,
+	0xb1, 0x7a, 0x50, 0x82, 0x74, 0x1f, 0x1a, 0x45, 0x8f, 0x60, 0xde, 0x46, 0x68, 0xb0, 0xde, 0xae,
+	0xe4, 0xa4, 0xbc, 0x6e, 0x43, 0x93, 0xd1, 0x11, 0xf7, 0x38, 0xb3, 0x0a, 0x9f, 0x7b, 0xb7, 0xa5,
+	0x67, 0xa5, 0x93, 0x23, 0xe8, 0x88, 0x6b, 0xb0, 0x74, 0x25, 0x5d, 0xf5, 0xbd, 0xdb, 0xd2, 0xb3,
+	0x45, 0x3c, 0x6d, 0x7e, 0x5d, 0x94, 0x49, 0x49, 0x36, 0x57, 0x6f, 0x57, 0x72, 0x52, 0x3a, 0x79,
+	0x04, 0xdd, 0xca, 0xec, 0xc6, 0x7c, 0xfc, 0xd5, 0x35, 0xd1, 0xbb, 0x23, 0x3f, 0x2c, 0xbc, 0x1d,
+	0xdc, 0x3b, 0xbf, 0x30, 0x95, 0x57, 0x17, 0xa6, 0xf2, 0xfa, 0xc2, 0x44, 0x2f, 0xe6, 0x26, 0x7a,
+	0x39, 0x37, 0xd1, 0x5f, 0x73, 0x13, 0x9d, 0xcf, 0x4d, 0xf4, 0xef, 0xdc, 0x44, 0xff, 0xcd, 0x4d,
+	0xe5, 0xf5, 0xdc, 0x44, 0xbf, 0x5e, 0x9a, 0xca, 0xf9, 0xa5, 0xa9, 0xbc, 0xba, 0x34, 0x95, 0x9f,
+	0xea, 0x7b, 0xf7, 0x48, 0xe4, 0x1d, 0x37, 0xf2, 0xbf, 0x63, 0x5f, 0xfc, 0x3f, 0x00, 0xde, 0x4f,
+	0x11, 0xa4, 0x9b, 0x0d, 0x00, 0x00,
 }
 
 func (x ResultCode) String() string {
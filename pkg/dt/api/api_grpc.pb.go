@@ -38,6 +38,9 @@ type TransactionManagerServiceClient interface {
 	Begin(ctx context.Context, in *GlobalBeginRequest, opts ...grpc.CallOption) (*GlobalBeginResponse, error)
 	Commit(ctx context.Context, in *GlobalCommitRequest, opts ...grpc.CallOption) (*GlobalCommitResponse, error)
 	Rollback(ctx context.Context, in *GlobalRollbackRequest, opts ...grpc.CallOption) (*GlobalRollbackResponse, error)
+	BranchRegister(ctx context.Context, in *BranchRegisterRequest, opts ...grpc.CallOption) (*BranchRegisterResponse, error)
+	BranchReport(ctx context.Context, in *BranchReportRequest, opts ...grpc.CallOption) (*BranchReportResponse, error)
+	GlobalLockQuery(ctx context.Context, in *GlobalLockQueryRequest, opts ...grpc.CallOption) (*GlobalLockQueryResponse, error)
 }
 
 type transactionManagerServiceClient struct {
@@ -75,6 +78,33 @@ func (c *transactionManagerServiceClient) Rollback(ctx context.Context, in *Glob
 	return out, nil
 }
 
+func (c *transactionManagerServiceClient) BranchRegister(ctx context.Context, in *BranchRegisterRequest, opts ...grpc.CallOption) (*BranchRegisterResponse, error) {
+	out := new(BranchRegisterResponse)
+	err := c.cc.Invoke(ctx, "/api.TransactionManagerService/BranchRegister", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *transactionManagerServiceClient) BranchReport(ctx context.Context, in *BranchReportRequest, opts ...grpc.CallOption) (*BranchReportResponse, error) {
+	out := new(BranchReportResponse)
+	err := c.cc.Invoke(ctx, "/api.TransactionManagerService/BranchReport", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *transactionManagerServiceClient) GlobalLockQuery(ctx context.Context, in *GlobalLockQueryRequest, opts ...grpc.CallOption) (*GlobalLockQueryResponse, error) {
+	out := new(GlobalLockQueryResponse)
+	err := c.cc.Invoke(ctx, "/api.TransactionManagerService/GlobalLockQuery", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // TransactionManagerServiceServer is the server API for TransactionManagerService service.
 // All implementations should embed UnimplementedTransactionManagerServiceServer
 // for forward compatibility
@@ -82,6 +112,9 @@ type TransactionManagerServiceServer interface {
 	Begin(context.Context, *GlobalBeginRequest) (*GlobalBeginResponse, error)
 	Commit(context.Context, *GlobalCommitRequest) (*GlobalCommitResponse, error)
 	Rollback(context.Context, *GlobalRollbackRequest) (*GlobalRollbackResponse, error)
+	BranchRegister(context.Context, *BranchRegisterRequest) (*BranchRegisterResponse, error)
+	BranchReport(context.Context, *BranchReportRequest) (*BranchReportResponse, error)
+	GlobalLockQuery(context.Context, *GlobalLockQueryRequest) (*GlobalLockQueryResponse, error)
 }
 
 // UnimplementedTransactionManagerServiceServer should be embedded to have forward compatible implementations.
@@ -97,6 +130,15 @@ func (UnimplementedTransactionManagerServiceServer) Commit(context.Context, *Glo
 func (UnimplementedTransactionManagerServiceServer) Rollback(context.Context, *GlobalRollbackRequest) (*GlobalRollbackResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Rollback not implemented")
 }
+func (UnimplementedTransactionManagerServiceServer) BranchRegister(context.Context, *BranchRegisterRequest) (*BranchRegisterResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BranchRegister not implemented")
+}
+func (UnimplementedTransactionManagerServiceServer) BranchReport(context.Context, *BranchReportRequest) (*BranchReportResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BranchReport not implemented")
+}
+func (UnimplementedTransactionManagerServiceServer) GlobalLockQuery(context.Context, *GlobalLockQueryRequest) (*GlobalLockQueryResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GlobalLockQuery not implemented")
+}
 
 // UnsafeTransactionManagerServiceServer may be embedded to opt out of forward compatibility for this service.
 // Use of this interface is not recommended, as added methods to TransactionManagerServiceServer will
@@ -163,6 +205,60 @@ func _TransactionManagerService_Rollback_Handler(srv interface{}, ctx context.Co
 	return interceptor(ctx, in, info, handler)
 }
 
+func _TransactionManagerService_BranchRegister_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BranchRegisterRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TransactionManagerServiceServer).BranchRegister(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/api.TransactionManagerService/BranchRegister",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TransactionManagerServiceServer).BranchRegister(ctx, req.(*BranchRegisterRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TransactionManagerService_BranchReport_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BranchReportRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TransactionManagerServiceServer).BranchReport(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/api.TransactionManagerService/BranchReport",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TransactionManagerServiceServer).BranchReport(ctx, req.(*BranchReportRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TransactionManagerService_GlobalLockQuery_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GlobalLockQueryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TransactionManagerServiceServer).GlobalLockQuery(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/api.TransactionManagerService/GlobalLockQuery",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TransactionManagerServiceServer).GlobalLockQuery(ctx, req.(*GlobalLockQueryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // TransactionManagerService_ServiceDesc is the grpc.ServiceDesc for TransactionManagerService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -182,6 +278,18 @@ var TransactionManagerService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "Rollback",
 			Handler:    _TransactionManagerService_Rollback_Handler,
 		},
+		{
+			MethodName: "BranchRegister",
+			Handler:    _TransactionManagerService_BranchRegister_Handler,
+		},
+		{
+			MethodName: "BranchReport",
+			Handler:    _TransactionManagerService_BranchReport_Handler,
+		},
+		{
+			MethodName: "GlobalLockQuery",
+			Handler:    _TransactionManagerService_GlobalLockQuery_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "api.proto",
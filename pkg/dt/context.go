@@ -19,10 +19,10 @@ package dt
 import (
 	"bytes"
 	"encoding/json"
+	"io"
 
+	"github.com/pkg/errors"
 	"vimagination.zapto.org/byteio"
-
-	"github.com/cectc/dbpack/pkg/log"
 )
 
 type RequestContext struct {
@@ -99,7 +99,9 @@ func (ctx *RequestContext) Decode(b []byte) error {
 	}
 	if contextLength > 0 {
 		actionContextData = make([]byte, contextLength, contextLength)
-		r.Read(actionContextData)
+		if _, err = io.ReadFull(&r, actionContextData); err != nil {
+			return errors.Wrap(err, "action context is truncated")
+		}
 	}
 
 	headerLength, _, err := r.ReadUint32()
@@ -108,7 +110,9 @@ func (ctx *RequestContext) Decode(b []byte) error {
 	}
 	if headerLength > 0 {
 		headersData = make([]byte, headerLength, headerLength)
-		r.Read(headersData)
+		if _, err = io.ReadFull(&r, headersData); err != nil {
+			return errors.Wrap(err, "headers are truncated")
+		}
 	}
 
 	bodyLength, _, err := r.ReadUint32()
@@ -117,19 +121,21 @@ func (ctx *RequestContext) Decode(b []byte) error {
 	}
 	if bodyLength > 0 {
 		bodyData = make([]byte, bodyLength, bodyLength)
-		r.Read(bodyData)
+		if _, err = io.ReadFull(&r, bodyData); err != nil {
+			return errors.Wrap(err, "body is truncated")
+		}
 	}
 
 	if actionContextData != nil {
 		err = json.Unmarshal(actionContextData, &(ctx.ActionContext))
 		if err != nil {
-			log.Errorf("unmarshal action context failed, %v", err)
+			return errors.Wrap(err, "unmarshal action context failed")
 		}
 	}
 	if headersData != nil {
 		err = json.Unmarshal(headersData, &(ctx.Headers))
 		if err != nil {
-			log.Errorf("unmarshal action context failed, %v", err)
+			return errors.Wrap(err, "unmarshal headers failed")
 		}
 	}
 
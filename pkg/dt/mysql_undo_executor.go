@@ -36,9 +36,9 @@ import (
 
 const (
 	InsertSqlTemplate = "INSERT INTO %s (%s) VALUES (%s)"
-	DeleteSqlTemplate = "DELETE FROM %s WHERE `%s` = ?"
-	UpdateSqlTemplate = "UPDATE %s SET %s WHERE `%s` = ?"
-	SelectSqlTemplate = "SELECT %s FROM %s WHERE `%s` IN %s"
+	DeleteSqlTemplate = "DELETE FROM %s WHERE %s"
+	UpdateSqlTemplate = "UPDATE %s SET %s WHERE %s"
+	SelectSqlTemplate = "SELECT %s FROM %s WHERE %s IN %s"
 )
 
 type BuildUndoSql func(undoLog undolog.SqlUndoLog) string
@@ -53,9 +53,8 @@ func BuildDeleteUndoSql(undoLog *undolog.SqlUndoLog) string {
 
 	row := beforeImageRows[0]
 	fields := row.NonPrimaryKeys()
-	pkField := row.PrimaryKeys()[0]
-	// PK is at last one.
-	fields = append(fields, pkField)
+	// PKs are at last.
+	fields = append(fields, row.PrimaryKeys()...)
 
 	var sbCols, sbVals strings.Builder
 	var size = len(fields)
@@ -80,8 +79,7 @@ func BuildInsertUndoSql(undoLog *undolog.SqlUndoLog) string {
 		return ""
 	}
 	row := afterImageRows[0]
-	pkField := row.PrimaryKeys()[0]
-	return fmt.Sprintf(DeleteSqlTemplate, undoLog.TableName, pkField.Name)
+	return fmt.Sprintf(DeleteSqlTemplate, undoLog.TableName, buildPKCondition(row.PrimaryKeys()))
 }
 
 func BuildUpdateUndoSql(undoLog *undolog.SqlUndoLog) string {
@@ -94,7 +92,6 @@ func BuildUpdateUndoSql(undoLog *undolog.SqlUndoLog) string {
 
 	row := beforeImageRows[0]
 	nonPkFields := row.NonPrimaryKeys()
-	pkField := row.PrimaryKeys()[0]
 
 	var sb strings.Builder
 	var size = len(nonPkFields)
@@ -106,7 +103,19 @@ func BuildUpdateUndoSql(undoLog *undolog.SqlUndoLog) string {
 	}
 	updateColumns := sb.String()
 
-	return fmt.Sprintf(UpdateSqlTemplate, undoLog.TableName, updateColumns, pkField.Name)
+	return fmt.Sprintf(UpdateSqlTemplate, undoLog.TableName, updateColumns, buildPKCondition(row.PrimaryKeys()))
+}
+
+// buildPKCondition builds the condition matches a row by its primary key, e.g. `a` = ? AND `b` = ?
+func buildPKCondition(pkFields []*schema.Field) string {
+	var sb strings.Builder
+	for i, field := range pkFields {
+		if i > 0 {
+			sb.WriteString(" AND ")
+		}
+		fmt.Fprintf(&sb, "`%s` = ?", field.Name)
+	}
+	return sb.String()
 }
 
 type MysqlUndoExecutor struct {
@@ -129,10 +138,10 @@ func (executor MysqlUndoExecutor) Execute(tx proto.Tx) error {
 	var undoSql string
 	var undoRows schema.TableRecords
 
-	// PK is at last one.
-	// INSERT INTO a (x, y, z, pk) VALUES (?, ?, ?, ?)
-	// UPDATE a SET x=?, y=?, z=? WHERE pk = ?
-	// DELETE FROM a WHERE pk = ?
+	// PKs are at last.
+	// INSERT INTO a (x, y, z, pk1, pk2) VALUES (?, ?, ?, ?, ?)
+	// UPDATE a SET x=?, y=?, z=? WHERE pk1 = ? AND pk2 = ?
+	// DELETE FROM a WHERE pk1 = ? AND pk2 = ?
 	switch executor.sqlUndoLog.SqlType {
 	case constant.SQLType_INSERT:
 		undoSql = BuildInsertUndoSql(executor.sqlUndoLog)
@@ -156,19 +165,19 @@ func (executor MysqlUndoExecutor) Execute(tx proto.Tx) error {
 
 	for i := len(undoRows.Rows) - 1; i >= 0; i-- {
 		var args = make([]interface{}, 0)
-		var pkValue interface{}
+		var pkValues = make([]interface{}, 0)
 
 		row := undoRows.Rows[i]
 		for _, field := range row.Fields {
 			if field.KeyType == schema.PrimaryKey {
-				pkValue = field.Value
+				pkValues = append(pkValues, field.Value)
 			} else {
 				if executor.sqlUndoLog.SqlType != constant.SQLType_INSERT {
 					args = append(args, field.Value)
 				}
 			}
 		}
-		args = append(args, pkValue)
+		args = append(args, pkValues...)
 		_, _, err = tx.ExecuteSql(context.Background(), undoSql, args...)
 		if err != nil {
 			return err
@@ -222,28 +231,26 @@ func (executor MysqlUndoExecutor) dataValidationAndGoOn(tx proto.Tx) (bool, erro
 func (executor MysqlUndoExecutor) queryCurrentRecords(tx proto.Tx) (*schema.TableRecords, error) {
 	undoRecords := executor.sqlUndoLog.GetUndoRows()
 	tableMeta := undoRecords.TableMeta
-	pkName := tableMeta.GetPKName()
 
-	pkFields := undoRecords.PKFields()
-	if pkFields == nil || len(pkFields) == 0 {
+	pkValues := undoRecords.PKValues()
+	if len(pkValues) == 0 {
 		return nil, nil
 	}
 
-	var pkValues = make([]interface{}, 0)
-	for _, field := range pkFields {
-		pkValues = append(pkValues, field.Value)
-	}
-
 	if executor.sqlUndoLog.IsBinary {
-		selectSql := executor.buildCurrentRecordsForPrepareSql(tableMeta, pkName, pkValues)
-		dataTable, _, err := tx.ExecuteSqlDirectly(selectSql, pkValues...)
+		var args = make([]interface{}, 0)
+		for _, values := range pkValues {
+			args = append(args, values...)
+		}
+		selectSql := executor.buildCurrentRecordsForPrepareSql(tableMeta, pkValues)
+		dataTable, _, err := tx.ExecuteSqlDirectly(selectSql, args...)
 		if err != nil {
 			return nil, err
 		}
 		dt := dataTable.(*mysql.Result)
 		return schema.BuildTableRecords(tableMeta, dt), nil
 	} else {
-		selectSql := executor.buildCurrentRecordsForQuerySql(tableMeta, pkName, pkValues)
+		selectSql := executor.buildCurrentRecordsForQuerySql(tableMeta, pkValues)
 		dataTable, _, err := tx.QueryDirectly(selectSql)
 		if err != nil {
 			return nil, err
@@ -253,7 +260,7 @@ func (executor MysqlUndoExecutor) queryCurrentRecords(tx proto.Tx) (*schema.Tabl
 	}
 }
 
-func (executor MysqlUndoExecutor) buildCurrentRecordsForPrepareSql(tableMeta schema.TableMeta, pkColumn string, pkValues []interface{}) string {
+func (executor MysqlUndoExecutor) buildCurrentRecordsForPrepareSql(tableMeta schema.TableMeta, pkValues [][]interface{}) string {
 	var b strings.Builder
 	var i = 0
 	columnCount := len(tableMeta.Columns)
@@ -266,13 +273,12 @@ func (executor MysqlUndoExecutor) buildCurrentRecordsForPrepareSql(tableMeta sch
 			b.WriteByte(' ')
 		}
 	}
-	inCondition := misc.MysqlAppendInParam(len(pkValues))
-	return fmt.Sprintf(SelectSqlTemplate, b.String(), tableMeta.TableName, pkColumn, inCondition)
+	inCondition := misc.MysqlAppendInRowParam(len(pkValues), len(tableMeta.GetPrimaryKeyOnlyName()))
+	return fmt.Sprintf(SelectSqlTemplate, b.String(), tableMeta.TableName, tableMeta.GetPKColumns(), inCondition)
 }
 
-func (executor MysqlUndoExecutor) buildCurrentRecordsForQuerySql(tableMeta schema.TableMeta, pkColumn string, pkValues []interface{}) string {
+func (executor MysqlUndoExecutor) buildCurrentRecordsForQuerySql(tableMeta schema.TableMeta, pkValues [][]interface{}) string {
 	var columns strings.Builder
-	var inCondition strings.Builder
 	var i = 0
 	columnCount := len(tableMeta.Columns)
 	for _, columnName := range tableMeta.Columns {
@@ -284,15 +290,6 @@ func (executor MysqlUndoExecutor) buildCurrentRecordsForQuerySql(tableMeta schem
 			columns.WriteByte(' ')
 		}
 	}
-	inCondition.WriteByte('(')
-	pkValuesCount := len(pkValues)
-	for i, pk := range pkValues {
-		if i < pkValuesCount-1 {
-			inCondition.WriteString(fmt.Sprintf("'%s',", pk))
-		} else {
-			inCondition.WriteString(fmt.Sprintf("'%s'", pk))
-		}
-	}
-	inCondition.WriteByte(')')
-	return fmt.Sprintf(SelectSqlTemplate, columns.String(), tableMeta.TableName, pkColumn, inCondition.String())
+	inCondition := misc.MysqlAppendInRowParamWithValue(pkValues)
+	return fmt.Sprintf(SelectSqlTemplate, columns.String(), tableMeta.TableName, tableMeta.GetPKColumns(), inCondition)
 }
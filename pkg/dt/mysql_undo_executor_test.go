@@ -0,0 +1,45 @@
+/*
+ * Copyright 2022 CECTC, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dt
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/cectc/dbpack/pkg/dt/schema"
+	"github.com/cectc/dbpack/pkg/dt/undolog"
+)
+
+func TestBuildUndoSqlWithCompositePK(t *testing.T) {
+	records := &schema.TableRecords{
+		TableName: "t_order",
+		Rows: []*schema.Row{{Fields: []*schema.Field{
+			{Name: "tenant_id", KeyType: schema.PrimaryKey, Value: int64(1)},
+			{Name: "order_no", KeyType: schema.PrimaryKey, Value: "a"},
+			{Name: "amount", KeyType: schema.Null, Value: int64(20)},
+		}}},
+	}
+	undoLog := &undolog.SqlUndoLog{
+		TableName:   "t_order",
+		BeforeImage: records,
+		AfterImage:  records,
+	}
+	assert.Equal(t, "UPDATE t_order SET `amount` = ? WHERE `tenant_id` = ? AND `order_no` = ?", BuildUpdateUndoSql(undoLog))
+	assert.Equal(t, "INSERT INTO t_order (`amount`, `tenant_id`, `order_no`) VALUES (?, ?, ?)", BuildDeleteUndoSql(undoLog))
+	assert.Equal(t, "DELETE FROM t_order WHERE `tenant_id` = ? AND `order_no` = ?", BuildInsertUndoSql(undoLog))
+}
@@ -16,10 +16,6 @@
 
 package schema
 
-import (
-	"github.com/cectc/dbpack/pkg/log"
-)
-
 type Row struct {
 	Fields []*Field
 }
@@ -31,9 +27,6 @@ func (row *Row) PrimaryKeys() []*Field {
 			fields = append(fields, field)
 		}
 	}
-	if len(fields) > 1 {
-		log.Panicf("Multi-PK")
-	}
 	return fields
 }
 
@@ -17,6 +17,9 @@
 package schema
 
 import (
+	"fmt"
+	"strings"
+
 	"github.com/cectc/dbpack/pkg/log"
 )
 
@@ -30,31 +33,66 @@ type TableMeta struct {
 
 func (meta TableMeta) GetPrimaryKeyMap() map[string]ColumnMeta {
 	pk := make(map[string]ColumnMeta)
-	for _, index := range meta.AllIndexes {
-		if index.IndexType == IndexTypePrimary {
-			for _, col := range index.Values {
-				pk[col.ColumnName] = col
-			}
-		}
-	}
-	if len(pk) > 1 {
-		log.Panicf("%s contains multi PK, but current not support.", meta.TableName)
-	}
-	if len(pk) < 1 {
-		log.Panicf("%s needs to contain the primary key.", meta.TableName)
+	for _, col := range meta.primaryKeyColumns() {
+		pk[col.ColumnName] = col
 	}
 	return pk
 }
 
+// GetPrimaryKeyOnlyName returns the columns of the primary key in the order of the index,
+// the images, lock keys and undo sql of a table with composite primary key all follow this order.
 func (meta TableMeta) GetPrimaryKeyOnlyName() []string {
-	list := make([]string, 0)
-	pk := meta.GetPrimaryKeyMap()
-	for key := range pk {
-		list = append(list, key)
+	columns := meta.primaryKeyColumns()
+	list := make([]string, 0, len(columns))
+	for _, col := range columns {
+		list = append(list, col.ColumnName)
 	}
 	return list
 }
 
+// GetPKName returns the first column of the primary key
 func (meta TableMeta) GetPKName() string {
 	return meta.GetPrimaryKeyOnlyName()[0]
 }
+
+// IsPrimaryKey returns true if the column is a part of the primary key
+func (meta TableMeta) IsPrimaryKey(column string) bool {
+	for _, pk := range meta.GetPrimaryKeyOnlyName() {
+		if strings.EqualFold(pk, column) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetPKColumns returns the primary key used in the condition of image queries,
+// e.g. `id` or a row constructor (`tenant_id`,`order_no`) for composite primary key.
+func (meta TableMeta) GetPKColumns() string {
+	pks := meta.GetPrimaryKeyOnlyName()
+	if len(pks) == 1 {
+		return fmt.Sprintf("`%s`", pks[0])
+	}
+	var sb strings.Builder
+	sb.WriteByte('(')
+	for i, pk := range pks {
+		sb.WriteString(fmt.Sprintf("`%s`", pk))
+		if i < len(pks)-1 {
+			sb.WriteByte(',')
+		}
+	}
+	sb.WriteByte(')')
+	return sb.String()
+}
+
+func (meta TableMeta) primaryKeyColumns() []ColumnMeta {
+	var columns []ColumnMeta
+	for _, index := range meta.AllIndexes {
+		if index.IndexType == IndexTypePrimary {
+			columns = append(columns, index.Values...)
+		}
+	}
+	if len(columns) < 1 {
+		log.Panicf("%s needs to contain the primary key.", meta.TableName)
+	}
+	return columns
+}
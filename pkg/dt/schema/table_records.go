@@ -23,6 +23,8 @@ import (
 	"github.com/cectc/dbpack/pkg/mysql"
 )
 
+var pkValueEscaper = strings.NewReplacer(`\`, `\\`, "_", `\_`)
+
 type TableRecords struct {
 	TableMeta TableMeta `json:"-"`
 	TableName string
@@ -43,20 +45,49 @@ func NewTableRecords(meta TableMeta) *TableRecords {
 	}
 }
 
+// PKFields returns the primary key fields of all the rows, row by row, the fields
+// of a row are in the order of the primary key.
 func (records *TableRecords) PKFields() []*Field {
 	pkRows := make([]*Field, 0)
-	pk := records.TableMeta.GetPKName()
+	for _, values := range records.pkFields() {
+		pkRows = append(pkRows, values...)
+	}
+	return pkRows
+}
+
+// PKValues returns the primary key values of every row
+func (records *TableRecords) PKValues() [][]interface{} {
+	pkValues := make([][]interface{}, 0, len(records.Rows))
+	for _, fields := range records.pkFields() {
+		values := make([]interface{}, 0, len(fields))
+		for _, field := range fields {
+			values = append(values, field.Value)
+		}
+		pkValues = append(pkValues, values)
+	}
+	return pkValues
+}
+
+func (records *TableRecords) pkFields() [][]*Field {
+	pks := records.TableMeta.GetPrimaryKeyOnlyName()
+	pkRows := make([][]*Field, 0, len(records.Rows))
 	for _, row := range records.Rows {
-		for _, field := range row.Fields {
-			if strings.EqualFold(field.Name, pk) {
-				pkRows = append(pkRows, field)
-				break
+		fields := make([]*Field, 0, len(pks))
+		for _, pk := range pks {
+			for _, field := range row.Fields {
+				if strings.EqualFold(field.Name, pk) {
+					fields = append(fields, field)
+					break
+				}
 			}
 		}
+		pkRows = append(pkRows, fields)
 	}
 	return pkRows
 }
 
+// BuildLockKey builds the lock key of the records, e.g. t:1,2 for the rows with primary key 1 and 2,
+// the values of composite primary key are joined with underscore, e.g. t:1_a,1_b, see PKStrings.
 func BuildLockKey(lockKeyRecords *TableRecords) string {
 	if lockKeyRecords == nil || lockKeyRecords.Rows == nil || len(lockKeyRecords.Rows) == 0 {
 		return ""
@@ -65,17 +96,10 @@ func BuildLockKey(lockKeyRecords *TableRecords) string {
 	var sb strings.Builder
 	sb.WriteString(lockKeyRecords.TableName)
 	sb.WriteByte(':')
-	fields := lockKeyRecords.PKFields()
-	length := len(fields)
-	for i, field := range fields {
-		switch val := field.Value.(type) {
-		case string:
-			sb.WriteString(fmt.Sprintf("%s", val))
-		case []byte:
-			sb.WriteString(fmt.Sprintf("%s", val))
-		default:
-			sb.WriteString(fmt.Sprintf("%v", val))
-		}
+	pks := lockKeyRecords.PKStrings()
+	length := len(pks)
+	for i, pk := range pks {
+		sb.WriteString(pk)
 		if i < length-1 {
 			sb.WriteByte(',')
 		}
@@ -83,6 +107,37 @@ func BuildLockKey(lockKeyRecords *TableRecords) string {
 	return sb.String()
 }
 
+// PKStrings returns the primary key of every row as a string, the values of
+// composite primary key are joined with underscore, backslashes and underscores
+// in the values are escaped with backslash, so that (a_b, c) and (a, b_c) differ.
+func (records *TableRecords) PKStrings() []string {
+	rows := records.pkFields()
+	pks := make([]string, 0, len(rows))
+	for _, fields := range rows {
+		var sb strings.Builder
+		for j, field := range fields {
+			if j > 0 {
+				sb.WriteByte('_')
+			}
+			var value string
+			switch val := field.Value.(type) {
+			case string:
+				value = val
+			case []byte:
+				value = string(val)
+			default:
+				value = fmt.Sprintf("%v", val)
+			}
+			if len(fields) > 1 {
+				value = pkValueEscaper.Replace(value)
+			}
+			sb.WriteString(value)
+		}
+		pks = append(pks, sb.String())
+	}
+	return pks
+}
+
 func BuildTableRecords(meta TableMeta, result *mysql.Result) *TableRecords {
 	records := NewTableRecords(meta)
 	rs := make([]*Row, 0)
@@ -101,7 +156,7 @@ func BuildTableRecords(meta TableMeta, result *mysql.Result) *TableRecords {
 			if values[i] != nil {
 				field.Value = values[i].Val
 			}
-			if strings.EqualFold(col.FiledName(), meta.GetPKName()) {
+			if meta.IsPrimaryKey(col.FiledName()) {
 				field.KeyType = PrimaryKey
 			}
 			fields = append(fields, field)
@@ -0,0 +1,60 @@
+/*
+ * Copyright 2022 CECTC, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package schema
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func mockRecords(pks []string, rows ...[]interface{}) *TableRecords {
+	columns := make([]ColumnMeta, 0, len(pks))
+	for _, pk := range pks {
+		columns = append(columns, ColumnMeta{TableName: "t", ColumnName: pk})
+	}
+	records := NewTableRecords(TableMeta{
+		TableName: "t",
+		Columns:   pks,
+		AllIndexes: map[string]IndexMeta{
+			"PRIMARY": {Values: columns, IndexName: "PRIMARY", IndexType: IndexTypePrimary},
+		},
+	})
+	for _, values := range rows {
+		fields := make([]*Field, 0, len(values))
+		for i, value := range values {
+			fields = append(fields, &Field{Name: pks[i], KeyType: PrimaryKey, Value: value})
+		}
+		records.Rows = append(records.Rows, &Row{Fields: fields})
+	}
+	return records
+}
+
+func TestPKStrings(t *testing.T) {
+	records := mockRecords([]string{"id"}, []interface{}{int64(1)}, []interface{}{[]byte("a_b")})
+	assert.Equal(t, []string{"1", "a_b"}, records.PKStrings())
+	assert.Equal(t, "t:1,a_b", BuildLockKey(records))
+
+	records = mockRecords([]string{"tenant_id", "order_no"},
+		[]interface{}{"a_b", "c"},
+		[]interface{}{"a", "b_c"},
+		[]interface{}{`a\`, "_c"},
+		[]interface{}{int64(1), []byte("2")})
+	pks := records.PKStrings()
+	assert.Equal(t, []string{`a\_b_c`, `a_b\_c`, `a\\_\_c`, "1_2"}, pks)
+	assert.Len(t, map[string]bool{pks[0]: true, pks[1]: true, pks[2]: true, pks[3]: true}, 4)
+}
@@ -0,0 +1,235 @@
+/*
+ * Copyright 2022 CECTC, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dt
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/cectc/dbpack/pkg/dt/api"
+	"github.com/cectc/dbpack/pkg/log"
+	"github.com/cectc/dbpack/pkg/misc"
+	"github.com/cectc/dbpack/pkg/proto"
+	"github.com/cectc/dbpack/pkg/resource"
+)
+
+// DefaultGlobalTransactionTimeout is the timeout in milliseconds used when a
+// gRPC client begins a global transaction without specifying one
+const DefaultGlobalTransactionTimeout = 60 * 1000
+
+// TransactionManagerServer exposes a DistributedTransactionManager through the
+// TransactionManagerService gRPC service, so that services which can not use the
+// http filter or the in-process interceptors can take part in global transactions.
+type TransactionManagerServer struct {
+	api.UnimplementedTransactionManagerServiceServer
+
+	applicationID string
+	manager       proto.DistributedTransactionManager
+}
+
+func NewTransactionManagerServer(applicationID string, manager proto.DistributedTransactionManager) *TransactionManagerServer {
+	return &TransactionManagerServer{
+		applicationID: applicationID,
+		manager:       manager,
+	}
+}
+
+func (server *TransactionManagerServer) Begin(ctx context.Context, in *api.GlobalBeginRequest) (*api.GlobalBeginResponse, error) {
+	if in.ApplicationID != "" && in.ApplicationID != server.applicationID {
+		return &api.GlobalBeginResponse{
+			ResultCode: api.ResultCodeFailed,
+			Message:    errors.Errorf("application id %s does not match %s", in.ApplicationID, server.applicationID).Error(),
+		}, nil
+	}
+	timeout := in.Timeout
+	if timeout <= 0 {
+		timeout = DefaultGlobalTransactionTimeout
+	}
+	xid, err := server.manager.Begin(ctx, in.TransactionName, timeout)
+	if err != nil {
+		log.Errorf("failed to begin global transaction, transaction name: %s, err: %v", in.TransactionName, err)
+		return &api.GlobalBeginResponse{
+			ResultCode: api.ResultCodeFailed,
+			Message:    err.Error(),
+		}, nil
+	}
+	return &api.GlobalBeginResponse{
+		ResultCode: api.ResultCodeSuccess,
+		XID:        xid,
+	}, nil
+}
+
+func (server *TransactionManagerServer) Commit(ctx context.Context, in *api.GlobalCommitRequest) (*api.GlobalCommitResponse, error) {
+	if err := server.checkXID(in.XID); err != nil {
+		return &api.GlobalCommitResponse{
+			ResultCode: api.ResultCodeFailed,
+			Message:    err.Error(),
+		}, nil
+	}
+	status, err := server.manager.Commit(ctx, in.XID)
+	if err != nil {
+		log.Errorf("failed to commit global transaction, xid: %s, err: %v", in.XID, err)
+		return &api.GlobalCommitResponse{
+			ResultCode:   api.ResultCodeFailed,
+			Message:      err.Error(),
+			GlobalStatus: status,
+		}, nil
+	}
+	return &api.GlobalCommitResponse{
+		ResultCode:   api.ResultCodeSuccess,
+		GlobalStatus: status,
+	}, nil
+}
+
+func (server *TransactionManagerServer) Rollback(ctx context.Context, in *api.GlobalRollbackRequest) (*api.GlobalRollbackResponse, error) {
+	if err := server.checkXID(in.XID); err != nil {
+		return &api.GlobalRollbackResponse{
+			ResultCode: api.ResultCodeFailed,
+			Message:    err.Error(),
+		}, nil
+	}
+	status, err := server.manager.Rollback(ctx, in.XID)
+	if err != nil {
+		log.Errorf("failed to rollback global transaction, xid: %s, err: %v", in.XID, err)
+		return &api.GlobalRollbackResponse{
+			ResultCode:   api.ResultCodeFailed,
+			Message:      err.Error(),
+			GlobalStatus: status,
+		}, nil
+	}
+	return &api.GlobalRollbackResponse{
+		ResultCode:   api.ResultCodeSuccess,
+		GlobalStatus: status,
+	}, nil
+}
+
+func (server *TransactionManagerServer) BranchRegister(ctx context.Context, in *api.BranchRegisterRequest) (*api.BranchRegisterResponse, error) {
+	if err := server.checkBranch(in); err != nil {
+		log.Errorf("refuse to register branch transaction, xid: %s, resource id: %s, err: %v", in.XID, in.ResourceID, err)
+		return &api.BranchRegisterResponse{
+			ResultCode: api.ResultCodeFailed,
+			Message:    err.Error(),
+		}, nil
+	}
+	branchID, branchSessionID, err := server.manager.BranchRegister(ctx, in)
+	if err != nil {
+		log.Errorf("failed to register branch transaction, xid: %s, resource id: %s, err: %v", in.XID, in.ResourceID, err)
+		return &api.BranchRegisterResponse{
+			ResultCode: api.ResultCodeFailed,
+			Message:    err.Error(),
+		}, nil
+	}
+	return &api.BranchRegisterResponse{
+		ResultCode:      api.ResultCodeSuccess,
+		BranchID:        branchID,
+		BranchSessionID: branchSessionID,
+	}, nil
+}
+
+func (server *TransactionManagerServer) BranchReport(ctx context.Context, in *api.BranchReportRequest) (*api.BranchReportResponse, error) {
+	if err := server.checkBranchID(in.BranchID); err != nil {
+		log.Errorf("refuse to report branch transaction status, branch id: %s, err: %v", in.BranchID, err)
+		return &api.BranchReportResponse{
+			ResultCode: api.ResultCodeFailed,
+			Message:    err.Error(),
+		}, nil
+	}
+	if err := server.manager.BranchReport(ctx, in.BranchID, in.BranchStatus); err != nil {
+		log.Errorf("failed to report branch transaction status, branch id: %s, err: %v", in.BranchID, err)
+		return &api.BranchReportResponse{
+			ResultCode: api.ResultCodeFailed,
+			Message:    err.Error(),
+		}, nil
+	}
+	return &api.BranchReportResponse{
+		ResultCode: api.ResultCodeSuccess,
+	}, nil
+}
+
+func (server *TransactionManagerServer) GlobalLockQuery(ctx context.Context, in *api.GlobalLockQueryRequest) (*api.GlobalLockQueryResponse, error) {
+	if err := server.checkResource(in.ResourceID); err != nil {
+		log.Errorf("refuse to query global lock, resource id: %s, lock key: %s, err: %v", in.ResourceID, in.LockKey, err)
+		return &api.GlobalLockQueryResponse{
+			ResultCode: api.ResultCodeFailed,
+			Message:    err.Error(),
+		}, nil
+	}
+	lockable, err := server.manager.IsLockable(ctx, in.ResourceID, in.LockKey)
+	if err != nil {
+		log.Errorf("failed to query global lock, resource id: %s, lock key: %s, err: %v", in.ResourceID, in.LockKey, err)
+		return &api.GlobalLockQueryResponse{
+			ResultCode: api.ResultCodeFailed,
+			Message:    err.Error(),
+		}, nil
+	}
+	return &api.GlobalLockQueryResponse{
+		ResultCode: api.ResultCodeSuccess,
+		Lockable:   lockable,
+	}, nil
+}
+
+// checkXID refuses global transactions that were not begun by the application of this server
+func (server *TransactionManagerServer) checkXID(xid string) error {
+	if misc.GetApplicationID(xid) != server.applicationID {
+		return errors.Errorf("xid %s does not belong to application %s", xid, server.applicationID)
+	}
+	return nil
+}
+
+// checkBranchID refuses branch transactions that were not registered by the application of this server
+func (server *TransactionManagerServer) checkBranchID(branchID string) error {
+	if misc.GetBranchApplicationID(branchID) != server.applicationID {
+		return errors.Errorf("branch id %s does not belong to application %s", branchID, server.applicationID)
+	}
+	return nil
+}
+
+// checkResource refuses resources that are not data sources of the application of this server
+func (server *TransactionManagerServer) checkResource(resourceID string) error {
+	manager := resource.GetDBManager(server.applicationID)
+	if manager == nil || manager.GetDB(resourceID) == nil {
+		return errors.Errorf("resource id %s is not a data source of application %s", resourceID, server.applicationID)
+	}
+	return nil
+}
+
+// checkBranch makes sure the branch can be committed or rolled back in phase two: an AT branch must
+// name a data source of the application, a TCC branch must carry an encoded RequestContext which
+// tells where to send the commit and rollback requests.
+func (server *TransactionManagerServer) checkBranch(in *api.BranchRegisterRequest) error {
+	if err := server.checkXID(in.XID); err != nil {
+		return err
+	}
+	switch in.BranchType {
+	case api.AT:
+		return server.checkResource(in.ResourceID)
+	case api.TCC:
+		requestContext := &RequestContext{}
+		if err := requestContext.Decode(in.ApplicationData); err != nil {
+			return errors.Wrap(err, "application data is not a valid tcc request context")
+		}
+		for _, key := range []string{VarHost, CommitRequestPath, RollbackRequestPath} {
+			if requestContext.ActionContext[key] == "" {
+				return errors.Errorf("tcc request context does not have action context %s", key)
+			}
+		}
+	default:
+		return errors.Errorf("unsupported branch type %s", in.BranchType)
+	}
+	return nil
+}
@@ -0,0 +1,242 @@
+/*
+ * Copyright 2022 CECTC, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dt
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/cectc/dbpack/pkg/dt/api"
+	"github.com/cectc/dbpack/pkg/proto"
+	"github.com/cectc/dbpack/pkg/resource"
+	"github.com/cectc/dbpack/testdata"
+)
+
+type mockTransactionManager struct {
+	proto.DistributedTransactionManager
+
+	timeout    int32
+	registered *api.BranchRegisterRequest
+	reported   api.BranchSession_BranchStatus
+}
+
+func (manager *mockTransactionManager) Begin(ctx context.Context, transactionName string, timeout int32) (string, error) {
+	manager.timeout = timeout
+	return "gs/svc/1", nil
+}
+
+func (manager *mockTransactionManager) Commit(ctx context.Context, xid string) (api.GlobalSession_GlobalStatus, error) {
+	return api.Committing, nil
+}
+
+func (manager *mockTransactionManager) Rollback(ctx context.Context, xid string) (api.GlobalSession_GlobalStatus, error) {
+	return api.Begin, errors.Errorf("global transaction %s not found", xid)
+}
+
+func (manager *mockTransactionManager) BranchRegister(ctx context.Context, in *api.BranchRegisterRequest) (string, int64, error) {
+	manager.registered = in
+	return "bs/svc/2", 2, nil
+}
+
+func (manager *mockTransactionManager) BranchReport(ctx context.Context, branchID string, status api.BranchSession_BranchStatus) error {
+	manager.reported = status
+	return nil
+}
+
+func (manager *mockTransactionManager) IsLockable(ctx context.Context, resourceID, lockKey string) (bool, error) {
+	return lockKey != "t:1", nil
+}
+
+func TestTransactionManagerServer(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	dbManager := testdata.NewMockDBManager(ctrl)
+	dbManager.EXPECT().GetDB("order").AnyTimes().Return(testdata.NewMockDB(ctrl))
+	dbManager.EXPECT().GetDB(gomock.Any()).AnyTimes().Return(nil)
+	resource.SetDBManager("svc", dbManager)
+
+	manager := &mockTransactionManager{}
+	lis := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer()
+	api.RegisterTransactionManagerServiceServer(server, NewTransactionManagerServer("svc", manager))
+	go server.Serve(lis)
+	defer server.Stop()
+
+	conn, err := grpc.DialContext(context.Background(), "bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, s string) (net.Conn, error) {
+			return lis.Dial()
+		}), grpc.WithInsecure())
+	assert.Nil(t, err)
+	defer conn.Close()
+	client := api.NewTransactionManagerServiceClient(conn)
+	ctx := context.Background()
+
+	beginResp, err := client.Begin(ctx, &api.GlobalBeginRequest{TransactionName: "create_order"})
+	assert.Nil(t, err)
+	assert.Equal(t, api.ResultCodeSuccess, beginResp.ResultCode)
+	assert.Equal(t, "gs/svc/1", beginResp.XID)
+	assert.Equal(t, int32(DefaultGlobalTransactionTimeout), manager.timeout)
+
+	beginResp, err = client.Begin(ctx, &api.GlobalBeginRequest{ApplicationID: "other", TransactionName: "create_order"})
+	assert.Nil(t, err)
+	assert.Equal(t, api.ResultCodeFailed, beginResp.ResultCode)
+
+	registerResp, err := client.BranchRegister(ctx, &api.BranchRegisterRequest{
+		XID:        "gs/svc/1",
+		ResourceID: "order",
+		LockKey:    "t:1",
+		BranchType: api.AT,
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, api.ResultCodeSuccess, registerResp.ResultCode)
+	assert.Equal(t, "bs/svc/2", registerResp.BranchID)
+	assert.Equal(t, int64(2), registerResp.BranchSessionID)
+	assert.Equal(t, "order", manager.registered.ResourceID)
+
+	reportResp, err := client.BranchReport(ctx, &api.BranchReportRequest{BranchID: "bs/svc/2", BranchStatus: api.PhaseOneFailed})
+	assert.Nil(t, err)
+	assert.Equal(t, api.ResultCodeSuccess, reportResp.ResultCode)
+	assert.Equal(t, api.PhaseOneFailed, manager.reported)
+
+	manager.reported = api.Registered
+	reportResp, err = client.BranchReport(ctx, &api.BranchReportRequest{BranchID: "bs/other/2", BranchStatus: api.PhaseOneFailed})
+	assert.Nil(t, err)
+	assert.Equal(t, api.ResultCodeFailed, reportResp.ResultCode)
+	assert.Contains(t, reportResp.Message, "does not belong to application svc")
+	assert.Equal(t, api.Registered, manager.reported)
+
+	lockResp, err := client.GlobalLockQuery(ctx, &api.GlobalLockQueryRequest{ResourceID: "order", LockKey: "t:1"})
+	assert.Nil(t, err)
+	assert.Equal(t, api.ResultCodeSuccess, lockResp.ResultCode)
+	assert.False(t, lockResp.Lockable)
+
+	lockResp, err = client.GlobalLockQuery(ctx, &api.GlobalLockQueryRequest{ResourceID: "product", LockKey: "t:1"})
+	assert.Nil(t, err)
+	assert.Equal(t, api.ResultCodeFailed, lockResp.ResultCode)
+	assert.Contains(t, lockResp.Message, "is not a data source of application svc")
+
+	commitResp, err := client.Commit(ctx, &api.GlobalCommitRequest{XID: "gs/svc/1"})
+	assert.Nil(t, err)
+	assert.Equal(t, api.ResultCodeSuccess, commitResp.ResultCode)
+	assert.Equal(t, api.Committing, commitResp.GlobalStatus)
+
+	rollbackResp, err := client.Rollback(ctx, &api.GlobalRollbackRequest{XID: "gs/svc/3"})
+	assert.Nil(t, err)
+	assert.Equal(t, api.ResultCodeFailed, rollbackResp.ResultCode)
+	assert.Contains(t, rollbackResp.Message, "not found")
+
+	commitResp, err = client.Commit(ctx, &api.GlobalCommitRequest{XID: "gs/other/1"})
+	assert.Nil(t, err)
+	assert.Equal(t, api.ResultCodeFailed, commitResp.ResultCode)
+	assert.Contains(t, commitResp.Message, "does not belong to application svc")
+
+	rollbackResp, err = client.Rollback(ctx, &api.GlobalRollbackRequest{XID: "gs/other/1"})
+	assert.Nil(t, err)
+	assert.Equal(t, api.ResultCodeFailed, rollbackResp.ResultCode)
+	assert.Contains(t, rollbackResp.Message, "does not belong to application svc")
+}
+
+func TestTransactionManagerServerBranchRegister(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	dbManager := testdata.NewMockDBManager(ctrl)
+	dbManager.EXPECT().GetDB("order").AnyTimes().Return(testdata.NewMockDB(ctrl))
+	dbManager.EXPECT().GetDB(gomock.Any()).AnyTimes().Return(nil)
+	resource.SetDBManager("svc", dbManager)
+
+	tccContext := &RequestContext{
+		ActionContext: map[string]string{
+			VarHost:             "localhost:8080",
+			CommitRequestPath:   "/commit",
+			RollbackRequestPath: "/rollback",
+		},
+		Body: []byte(`{"id":1}`),
+	}
+	tccData, err := tccContext.Encode()
+	assert.Nil(t, err)
+	tccContext.ActionContext = map[string]string{VarHost: "localhost:8080"}
+	incompleteData, err := tccContext.Encode()
+	assert.Nil(t, err)
+
+	testCases := []struct {
+		name    string
+		request *api.BranchRegisterRequest
+		message string
+	}{
+		{
+			name:    "at",
+			request: &api.BranchRegisterRequest{XID: "gs/svc/1", ResourceID: "order", LockKey: "t:1", BranchType: api.AT},
+		},
+		{
+			name:    "tcc",
+			request: &api.BranchRegisterRequest{XID: "gs/svc/1", BranchType: api.TCC, ApplicationData: tccData},
+		},
+		{
+			name:    "other application",
+			request: &api.BranchRegisterRequest{XID: "gs/other/1", ResourceID: "order", LockKey: "t:1", BranchType: api.AT},
+			message: "does not belong to application svc",
+		},
+		{
+			name:    "unknown resource",
+			request: &api.BranchRegisterRequest{XID: "gs/svc/1", ResourceID: "product", LockKey: "t:1", BranchType: api.AT},
+			message: "is not a data source of application svc",
+		},
+		{
+			name:    "truncated application data",
+			request: &api.BranchRegisterRequest{XID: "gs/svc/1", BranchType: api.TCC, ApplicationData: tccData[:10]},
+			message: "is not a valid tcc request context",
+		},
+		{
+			name:    "protobuf application data",
+			request: &api.BranchRegisterRequest{XID: "gs/svc/1", BranchType: api.TCC, ApplicationData: []byte{0x0a, 0x03, 0x66, 0x6f, 0x6f}},
+			message: "is not a valid tcc request context",
+		},
+		{
+			name:    "incomplete action context",
+			request: &api.BranchRegisterRequest{XID: "gs/svc/1", BranchType: api.TCC, ApplicationData: incompleteData},
+			message: "does not have action context tcc_commit_request_path",
+		},
+		{
+			name:    "saga",
+			request: &api.BranchRegisterRequest{XID: "gs/svc/1", BranchType: api.SAGA},
+			message: "unsupported branch type SAGA",
+		},
+	}
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			manager := &mockTransactionManager{}
+			server := NewTransactionManagerServer("svc", manager)
+			resp, err := server.BranchRegister(context.Background(), c.request)
+			assert.Nil(t, err)
+			if c.message == "" {
+				assert.Equal(t, api.ResultCodeSuccess, resp.ResultCode)
+				assert.Equal(t, c.request, manager.registered)
+			} else {
+				assert.Equal(t, api.ResultCodeFailed, resp.ResultCode)
+				assert.Contains(t, resp.Message, c.message)
+				assert.Nil(t, manager.registered)
+			}
+		})
+	}
+}
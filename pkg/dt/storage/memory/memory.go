@@ -0,0 +1,408 @@
+/*
+ * Copyright 2022 CECTC, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package memory
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/cectc/dbpack/pkg/dt/api"
+	"github.com/cectc/dbpack/pkg/dt/storage"
+	err2 "github.com/cectc/dbpack/pkg/errors"
+	"github.com/cectc/dbpack/pkg/misc"
+)
+
+const outgoingBufSize = 100
+
+// store keeps transaction sessions in the memory of a single dbpack node, it is meant
+// for development and tests, all the sessions are lost when the process exits.
+type store struct {
+	sync.Mutex
+
+	globalSessions     map[string]*api.GlobalSession
+	branchSessions     map[string]*api.BranchSession
+	deadBranchSessions map[string]*api.BranchSession
+	// globalBranches holds the branch ids of a global session in registration order
+	globalBranches map[string][]string
+	// rowLocks maps a row key to the xid which holds the lock
+	rowLocks map[string]string
+
+	globalWatchers []*watchChan
+	branchWatchers []*watchChan
+}
+
+func NewMemoryStore() storage.Driver {
+	return &store{
+		globalSessions:     make(map[string]*api.GlobalSession),
+		branchSessions:     make(map[string]*api.BranchSession),
+		deadBranchSessions: make(map[string]*api.BranchSession),
+		globalBranches:     make(map[string][]string),
+		rowLocks:           make(map[string]string),
+	}
+}
+
+type watchChan struct {
+	applicationID string
+	ctx           context.Context
+	cancel        context.CancelFunc
+	resultChan    chan storage.TransactionSession
+}
+
+// LeaderElection always succeeds, there is only one node sharing the store.
+func (s *store) LeaderElection(applicationID string) bool {
+	return true
+}
+
+func (s *store) AddGlobalSession(ctx context.Context, globalSession *api.GlobalSession) error {
+	s.Lock()
+	defer s.Unlock()
+	s.globalSessions[globalSession.XID] = cloneGlobalSession(globalSession)
+	return nil
+}
+
+func (s *store) AddBranchSession(ctx context.Context, branchSession *api.BranchSession) error {
+	s.Lock()
+	defer s.Unlock()
+
+	gs, ok := s.globalSessions[branchSession.XID]
+	if !ok || gs.Status > api.Begin {
+		return err2.GlobalTransactionFinished
+	}
+
+	if branchSession.Type == api.AT && branchSession.LockKey != "" {
+		rowKeys := misc.CollectRowKeys(branchSession.LockKey, branchSession.ResourceID)
+		for _, rowKey := range rowKeys {
+			if xid, locked := s.rowLocks[rowKey]; locked && xid != branchSession.XID {
+				return errors.Errorf("register branch session failed, xid: %s, resource id: %s", branchSession.XID, branchSession.ResourceID)
+			}
+		}
+		for _, rowKey := range rowKeys {
+			s.rowLocks[rowKey] = branchSession.XID
+		}
+	}
+
+	s.branchSessions[branchSession.BranchID] = cloneBranchSession(branchSession)
+	s.globalBranches[branchSession.XID] = append(s.globalBranches[branchSession.XID], branchSession.BranchID)
+	return nil
+}
+
+func (s *store) GlobalCommit(ctx context.Context, xid string) (api.GlobalSession_GlobalStatus, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	return s.transitGlobalSession(ctx, xid, api.Committing, api.PhaseTwoCommitting)
+}
+
+func (s *store) GlobalRollback(ctx context.Context, xid string) (api.GlobalSession_GlobalStatus, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	return s.transitGlobalSession(ctx, xid, api.Rollbacking, api.PhaseTwoRollbacking)
+}
+
+// transitGlobalSession moves a global session from Begin to status, and its registered
+// branch sessions to branchStatus, the row locks are released once the session is committing.
+// The caller must hold the lock.
+func (s *store) transitGlobalSession(ctx context.Context, xid string,
+	status api.GlobalSession_GlobalStatus, branchStatus api.BranchSession_BranchStatus) (api.GlobalSession_GlobalStatus, error) {
+	gs, ok := s.globalSessions[xid]
+	if !ok {
+		return api.Finished, err2.GlobalTransactionFinished
+	}
+	if gs.Status > api.Begin {
+		if gs.Status == status {
+			return gs.Status, nil
+		}
+		return gs.Status, err2.GlobalTransactionFinished
+	}
+	gs.Status = status
+	s.notify(ctx, s.globalWatchers, gs.ApplicationID, cloneGlobalSession(gs))
+
+	for _, branchID := range s.globalBranches[xid] {
+		bs, ok := s.branchSessions[branchID]
+		if !ok || bs.Status != api.Registered {
+			continue
+		}
+		bs.Status = branchStatus
+		s.notify(ctx, s.branchWatchers, bs.ApplicationID, cloneBranchSession(bs))
+	}
+	if status == api.Committing {
+		for rowKey, holder := range s.rowLocks {
+			if holder == xid {
+				delete(s.rowLocks, rowKey)
+			}
+		}
+	}
+	return status, nil
+}
+
+func (s *store) GetGlobalSession(ctx context.Context, xid string) (*api.GlobalSession, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	gs, ok := s.globalSessions[xid]
+	if !ok {
+		return nil, err2.CouldNotFoundGlobalTransaction
+	}
+	return cloneGlobalSession(gs), nil
+}
+
+func (s *store) ListGlobalSession(ctx context.Context, applicationID string) ([]*api.GlobalSession, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	var result []*api.GlobalSession
+	for _, gs := range s.globalSessions {
+		if gs.ApplicationID == applicationID {
+			result = append(result, cloneGlobalSession(gs))
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].TransactionID < result[j].TransactionID
+	})
+	return result, nil
+}
+
+func (s *store) DeleteGlobalSession(ctx context.Context, xid string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	delete(s.globalSessions, xid)
+	return nil
+}
+
+func (s *store) GetBranchSession(ctx context.Context, branchID string) (*api.BranchSession, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	bs, ok := s.branchSessions[branchID]
+	if !ok {
+		return nil, err2.CouldNotFoundBranchTransaction
+	}
+	return cloneBranchSession(bs), nil
+}
+
+func (s *store) ListBranchSession(ctx context.Context, applicationID string) ([]*api.BranchSession, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	return listBranchSessions(s.branchSessions, applicationID), nil
+}
+
+func (s *store) DeleteBranchSession(ctx context.Context, branchID string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	bs, ok := s.branchSessions[branchID]
+	if !ok {
+		return nil
+	}
+	delete(s.branchSessions, branchID)
+	branchIDs := s.globalBranches[bs.XID]
+	for i, id := range branchIDs {
+		if id == branchID {
+			branchIDs = append(branchIDs[:i], branchIDs[i+1:]...)
+			break
+		}
+	}
+	if len(branchIDs) == 0 {
+		delete(s.globalBranches, bs.XID)
+	} else {
+		s.globalBranches[bs.XID] = branchIDs
+	}
+	return nil
+}
+
+func (s *store) GetBranchSessionKeys(ctx context.Context, xid string) ([]string, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	branchIDs := s.globalBranches[xid]
+	var result []string
+	for i := len(branchIDs) - 1; i >= 0; i-- {
+		result = append(result, branchIDs[i])
+	}
+	return result, nil
+}
+
+func (s *store) BranchReport(ctx context.Context, branchID string, status api.BranchSession_BranchStatus) error {
+	s.Lock()
+	bs, ok := s.branchSessions[branchID]
+	if !ok {
+		s.Unlock()
+		return err2.CouldNotFoundBranchTransaction
+	}
+	if bs.Status == api.Registered {
+		bs.Status = status
+		s.notify(ctx, s.branchWatchers, bs.ApplicationID, cloneBranchSession(bs))
+	}
+	failed := bs.Status == api.PhaseOneFailed
+	s.Unlock()
+
+	if failed {
+		return s.DeleteBranchSession(ctx, branchID)
+	}
+	return nil
+}
+
+func (s *store) IsLockable(ctx context.Context, resourceID string, lockKey string) (bool, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	for _, rowKey := range misc.CollectRowKeys(lockKey, resourceID) {
+		if _, locked := s.rowLocks[rowKey]; locked {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func (s *store) IsLockableWithXID(ctx context.Context, resourceID string, lockKey string, xid string) (bool, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	for _, rowKey := range misc.CollectRowKeys(lockKey, resourceID) {
+		if holder, locked := s.rowLocks[rowKey]; locked && holder != xid {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func (s *store) ReleaseLockKeys(ctx context.Context, resourceID string, lockKeys []string) (bool, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	for _, lockKey := range lockKeys {
+		for _, rowKey := range misc.CollectRowKeys(lockKey, resourceID) {
+			delete(s.rowLocks, rowKey)
+		}
+	}
+	return true, nil
+}
+
+func (s *store) SetBranchSessionDead(ctx context.Context, branchSession *api.BranchSession) error {
+	s.Lock()
+	defer s.Unlock()
+
+	// like the etcd store, the branch id is kept in the branch keys of the global session,
+	// so that the global session is not deleted until the dead branch session is handled
+	s.deadBranchSessions[branchSession.BranchID] = cloneBranchSession(branchSession)
+	delete(s.branchSessions, branchSession.BranchID)
+	return nil
+}
+
+func (s *store) ListDeadBranchSession(ctx context.Context, applicationID string) ([]*api.BranchSession, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	return listBranchSessions(s.deadBranchSessions, applicationID), nil
+}
+
+func (s *store) WatchGlobalSessions(ctx context.Context, applicationID string) storage.Watcher {
+	s.Lock()
+	defer s.Unlock()
+
+	wc := s.createWatchChan(ctx, applicationID)
+	s.globalWatchers = append(s.globalWatchers, wc)
+	return wc
+}
+
+func (s *store) WatchBranchSessions(ctx context.Context, applicationID string) storage.Watcher {
+	s.Lock()
+	defer s.Unlock()
+
+	wc := s.createWatchChan(ctx, applicationID)
+	s.branchWatchers = append(s.branchWatchers, wc)
+	return wc
+}
+
+func (s *store) createWatchChan(ctx context.Context, applicationID string) *watchChan {
+	wc := &watchChan{
+		applicationID: applicationID,
+		resultChan:    make(chan storage.TransactionSession, outgoingBufSize),
+	}
+	wc.ctx, wc.cancel = context.WithCancel(ctx)
+	go func() {
+		<-wc.ctx.Done()
+		s.Lock()
+		defer s.Unlock()
+		s.globalWatchers = removeWatchChan(s.globalWatchers, wc)
+		s.branchWatchers = removeWatchChan(s.branchWatchers, wc)
+		close(wc.resultChan)
+	}()
+	return wc
+}
+
+// notify sends an updated session to the watchers of the application, the caller must hold the lock.
+// Like the etcd store, creations and deletions are not reported.
+func (s *store) notify(ctx context.Context, watchers []*watchChan, applicationID string, session storage.TransactionSession) {
+	for _, wc := range watchers {
+		if wc.applicationID != applicationID {
+			continue
+		}
+		select {
+		case wc.resultChan <- session:
+		case <-wc.ctx.Done():
+		case <-ctx.Done():
+		}
+	}
+}
+
+func (wc *watchChan) Stop() {
+	wc.cancel()
+}
+
+func (wc *watchChan) ResultChan() <-chan storage.TransactionSession {
+	return wc.resultChan
+}
+
+func removeWatchChan(watchers []*watchChan, wc *watchChan) []*watchChan {
+	for i, w := range watchers {
+		if w == wc {
+			return append(watchers[:i], watchers[i+1:]...)
+		}
+	}
+	return watchers
+}
+
+func listBranchSessions(branchSessions map[string]*api.BranchSession, applicationID string) []*api.BranchSession {
+	var result []*api.BranchSession
+	for _, bs := range branchSessions {
+		if bs.ApplicationID == applicationID {
+			result = append(result, cloneBranchSession(bs))
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].BranchSessionID > result[j].BranchSessionID
+	})
+	return result
+}
+
+func cloneGlobalSession(gs *api.GlobalSession) *api.GlobalSession {
+	result := *gs
+	return &result
+}
+
+func cloneBranchSession(bs *api.BranchSession) *api.BranchSession {
+	result := *bs
+	result.ApplicationData = append([]byte(nil), bs.ApplicationData...)
+	return &result
+}
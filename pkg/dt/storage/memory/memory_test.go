@@ -0,0 +1,158 @@
+/*
+ * Copyright 2022 CECTC, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package memory
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/cectc/dbpack/pkg/dt/api"
+	err2 "github.com/cectc/dbpack/pkg/errors"
+)
+
+func TestMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+	assert.True(t, s.LeaderElection("svc"))
+
+	gs := &api.GlobalSession{XID: "gs/svc/1", ApplicationID: "svc", TransactionID: 1, Timeout: 1000}
+	assert.Nil(t, s.AddGlobalSession(ctx, gs))
+	assert.Nil(t, s.AddGlobalSession(ctx, &api.GlobalSession{XID: "gs/svc/2", ApplicationID: "svc", TransactionID: 2}))
+
+	bs1 := &api.BranchSession{BranchID: "bs/svc/11", ApplicationID: "svc", BranchSessionID: 11, XID: gs.XID,
+		ResourceID: "db", LockKey: "t:1,2", Type: api.AT}
+	bs2 := &api.BranchSession{BranchID: "bs/svc/12", ApplicationID: "svc", BranchSessionID: 12, XID: gs.XID,
+		ResourceID: "db", LockKey: "t:2;s:1", Type: api.AT}
+	assert.Nil(t, s.AddBranchSession(ctx, bs1))
+	// rows locked by the same global session can be locked again
+	assert.Nil(t, s.AddBranchSession(ctx, bs2))
+
+	err := s.AddBranchSession(ctx, &api.BranchSession{BranchID: "bs/svc/21", ApplicationID: "svc", BranchSessionID: 21,
+		XID: "gs/svc/2", ResourceID: "db", LockKey: "t:1", Type: api.AT})
+	assert.NotNil(t, err)
+	err = s.AddBranchSession(ctx, &api.BranchSession{BranchID: "bs/svc/31", XID: "gs/svc/3"})
+	assert.Equal(t, err2.GlobalTransactionFinished, err)
+
+	lockable, err := s.IsLockable(ctx, "db", "t:1")
+	assert.Nil(t, err)
+	assert.False(t, lockable)
+	lockable, err = s.IsLockableWithXID(ctx, "db", "t:1;s:1", gs.XID)
+	assert.Nil(t, err)
+	assert.True(t, lockable)
+	lockable, err = s.IsLockableWithXID(ctx, "db", "t:1", "gs/svc/2")
+	assert.Nil(t, err)
+	assert.False(t, lockable)
+
+	keys, err := s.GetBranchSessionKeys(ctx, gs.XID)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"bs/svc/12", "bs/svc/11"}, keys)
+
+	watcher := s.WatchBranchSessions(ctx, "svc")
+	defer watcher.Stop()
+
+	status, err := s.GlobalCommit(ctx, gs.XID)
+	assert.Nil(t, err)
+	assert.Equal(t, api.Committing, status)
+	status, err = s.GlobalCommit(ctx, gs.XID)
+	assert.Nil(t, err)
+	assert.Equal(t, api.Committing, status)
+	status, err = s.GlobalRollback(ctx, gs.XID)
+	assert.Equal(t, err2.GlobalTransactionFinished, err)
+	assert.Equal(t, api.Committing, status)
+
+	for i := 0; i < 2; i++ {
+		select {
+		case session := <-watcher.ResultChan():
+			assert.Equal(t, api.PhaseTwoCommitting, session.(*api.BranchSession).Status)
+		case <-time.After(time.Second):
+			t.Fatal("branch session update is not watched")
+		}
+	}
+
+	lockable, err = s.IsLockable(ctx, "db", "t:1,2;s:1")
+	assert.Nil(t, err)
+	assert.True(t, lockable)
+
+	assert.Nil(t, s.DeleteBranchSession(ctx, bs1.BranchID))
+	assert.Nil(t, s.SetBranchSessionDead(ctx, bs2))
+	_, err = s.GetBranchSession(ctx, bs2.BranchID)
+	assert.Equal(t, err2.CouldNotFoundBranchTransaction, err)
+	deadSessions, err := s.ListDeadBranchSession(ctx, "svc")
+	assert.Nil(t, err)
+	assert.Len(t, deadSessions, 1)
+	keys, err = s.GetBranchSessionKeys(ctx, gs.XID)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"bs/svc/12"}, keys)
+}
+
+func TestMemoryStoreBranchReport(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+
+	assert.Nil(t, s.AddGlobalSession(ctx, &api.GlobalSession{XID: "gs/svc/1", ApplicationID: "svc"}))
+	assert.Nil(t, s.AddBranchSession(ctx, &api.BranchSession{BranchID: "bs/svc/11", ApplicationID: "svc",
+		BranchSessionID: 11, XID: "gs/svc/1", ResourceID: "db", LockKey: "t:1", Type: api.AT}))
+	assert.Nil(t, s.AddBranchSession(ctx, &api.BranchSession{BranchID: "bs/svc/12", ApplicationID: "svc",
+		BranchSessionID: 12, XID: "gs/svc/1", ResourceID: "tcc", Type: api.TCC}))
+
+	assert.Nil(t, s.BranchReport(ctx, "bs/svc/12", api.PhaseOneFailed))
+	_, err := s.GetBranchSession(ctx, "bs/svc/12")
+	assert.Equal(t, err2.CouldNotFoundBranchTransaction, err)
+
+	status, err := s.GlobalRollback(ctx, "gs/svc/1")
+	assert.Nil(t, err)
+	assert.Equal(t, api.Rollbacking, status)
+	branchSessions, err := s.ListBranchSession(ctx, "svc")
+	assert.Nil(t, err)
+	assert.Len(t, branchSessions, 1)
+	assert.Equal(t, api.PhaseTwoRollbacking, branchSessions[0].Status)
+
+	// row locks are kept until the branch session is rolled back
+	lockable, err := s.IsLockable(ctx, "db", "t:1")
+	assert.Nil(t, err)
+	assert.False(t, lockable)
+	released, err := s.ReleaseLockKeys(ctx, "db", []string{"t:1"})
+	assert.Nil(t, err)
+	assert.True(t, released)
+	lockable, err = s.IsLockable(ctx, "db", "t:1")
+	assert.Nil(t, err)
+	assert.True(t, lockable)
+}
+
+func TestMemoryStoreCommitAfterRollback(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+
+	assert.Nil(t, s.AddGlobalSession(ctx, &api.GlobalSession{XID: "gs/svc/1", ApplicationID: "svc"}))
+	assert.Nil(t, s.AddBranchSession(ctx, &api.BranchSession{BranchID: "bs/svc/11", ApplicationID: "svc",
+		BranchSessionID: 11, XID: "gs/svc/1", ResourceID: "db", LockKey: "t:1", Type: api.AT}))
+
+	status, err := s.GlobalRollback(ctx, "gs/svc/1")
+	assert.Nil(t, err)
+	assert.Equal(t, api.Rollbacking, status)
+	status, err = s.GlobalCommit(ctx, "gs/svc/1")
+	assert.Equal(t, err2.GlobalTransactionFinished, err)
+	assert.Equal(t, api.Rollbacking, status)
+
+	// the rejected commit does not release the row locks of the rolling back session
+	lockable, err := s.IsLockable(ctx, "db", "t:1")
+	assert.Nil(t, err)
+	assert.False(t, lockable)
+}
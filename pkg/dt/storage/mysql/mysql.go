@@ -0,0 +1,709 @@
+/*
+ * Copyright 2022 CECTC, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mysql
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/pkg/errors"
+
+	"github.com/cectc/dbpack/pkg/config"
+	"github.com/cectc/dbpack/pkg/dt/api"
+	"github.com/cectc/dbpack/pkg/dt/storage"
+	err2 "github.com/cectc/dbpack/pkg/errors"
+	"github.com/cectc/dbpack/pkg/log"
+	"github.com/cectc/dbpack/pkg/misc"
+)
+
+const (
+	// DefaultPollInterval is how often the watchers poll the session tables
+	DefaultPollInterval = time.Second
+
+	// leaderElectionTimeout is how many seconds a GET_LOCK call waits before retrying
+	leaderElectionTimeout = 10
+
+	// batchSize limits the row keys bound in one statement
+	batchSize = 1000
+
+	outgoingBufSize = 100
+
+	createGlobalSessionTable = "CREATE TABLE IF NOT EXISTS `global_session` (" +
+		"`xid` varchar(128) NOT NULL," +
+		"`application_id` varchar(64) NOT NULL," +
+		"`transaction_id` bigint NOT NULL," +
+		"`transaction_name` varchar(255) NOT NULL DEFAULT ''," +
+		"`timeout` int NOT NULL," +
+		"`begin_time` bigint NOT NULL," +
+		"`status` tinyint NOT NULL," +
+		"`revision` bigint NOT NULL DEFAULT 1," +
+		"PRIMARY KEY (`xid`)," +
+		"KEY `idx_application_id` (`application_id`))"
+	createBranchSessionTable = "CREATE TABLE IF NOT EXISTS `branch_session` (" +
+		"`branch_id` varchar(128) NOT NULL," +
+		"`application_id` varchar(64) NOT NULL," +
+		"`branch_session_id` bigint NOT NULL," +
+		"`xid` varchar(128) NOT NULL," +
+		"`transaction_id` bigint NOT NULL," +
+		"`resource_id` varchar(255) NOT NULL," +
+		"`lock_key` longtext," +
+		"`branch_type` tinyint NOT NULL," +
+		"`status` tinyint NOT NULL," +
+		"`application_data` longblob," +
+		"`begin_time` bigint NOT NULL," +
+		"`dead` tinyint NOT NULL DEFAULT 0," +
+		"`revision` bigint NOT NULL DEFAULT 1," +
+		"PRIMARY KEY (`branch_id`)," +
+		"KEY `idx_xid` (`xid`)," +
+		"KEY `idx_application_id` (`application_id`, `dead`))"
+	// a row key is made of the resource id, the table name and the primary key values, it has
+	// no length limit, so row locks are keyed by the sha256 of the row key
+	createRowLockTable = "CREATE TABLE IF NOT EXISTS `row_lock` (" +
+		"`row_key_hash` char(64) NOT NULL," +
+		"`row_key` text NOT NULL," +
+		"`xid` varchar(128) NOT NULL," +
+		"`branch_id` varchar(128) NOT NULL," +
+		"PRIMARY KEY (`row_key_hash`)," +
+		"KEY `idx_xid` (`xid`))"
+
+	globalSessionColumns = "`xid`, `application_id`, `transaction_id`, `transaction_name`, `timeout`, `begin_time`, `status`"
+	branchSessionColumns = "`branch_id`, `application_id`, `branch_session_id`, `xid`, `transaction_id`, `resource_id`, " +
+		"`lock_key`, `branch_type`, `status`, `application_data`, `begin_time`"
+
+	insertGlobalSession = "INSERT INTO `global_session` (" + globalSessionColumns + ") VALUES (?, ?, ?, ?, ?, ?, ?)"
+	selectGlobalSession = "SELECT " + globalSessionColumns + " FROM `global_session` WHERE `xid` = ?"
+	listGlobalSession   = "SELECT " + globalSessionColumns + ", `revision` FROM `global_session` " +
+		"WHERE `application_id` = ? ORDER BY `transaction_id`"
+	lockGlobalSessionStatus = "SELECT `status` FROM `global_session` WHERE `xid` = ? FOR UPDATE"
+	updateGlobalSession     = "UPDATE `global_session` SET `status` = ?, `revision` = `revision` + 1 WHERE `xid` = ? AND `status` = ?"
+	deleteGlobalSession     = "DELETE FROM `global_session` WHERE `xid` = ?"
+	pollGlobalSession       = "SELECT `xid`, `revision` FROM `global_session` WHERE `application_id` = ?"
+
+	insertBranchSession = "INSERT INTO `branch_session` (" + branchSessionColumns + ") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+	selectBranchSession = "SELECT " + branchSessionColumns + " FROM `branch_session` WHERE `branch_id` = ? AND `dead` = 0"
+	listBranchSession   = "SELECT " + branchSessionColumns + ", `revision` FROM `branch_session` " +
+		"WHERE `application_id` = ? AND `dead` = ? ORDER BY `branch_session_id` DESC"
+	updateBranchSession = "UPDATE `branch_session` SET `status` = ?, `revision` = `revision` + 1 " +
+		"WHERE `branch_id` = ? AND `dead` = 0 AND `status` = ?"
+	updateGlobalBranchSessions = "UPDATE `branch_session` SET `status` = ?, `revision` = `revision` + 1 " +
+		"WHERE `xid` = ? AND `dead` = 0 AND `status` = ?"
+	deleteBranchSession      = "DELETE FROM `branch_session` WHERE `branch_id` = ?"
+	selectBranchSessionKeys  = "SELECT `branch_id` FROM `branch_session` WHERE `xid` = ? ORDER BY `branch_session_id` DESC"
+	setBranchSessionDead     = "UPDATE `branch_session` SET `dead` = 1, `revision` = `revision` + 1 WHERE `branch_id` = ? AND `dead` = 0"
+	pollBranchSession        = "SELECT `branch_id`, `revision` FROM `branch_session` WHERE `application_id` = ? AND `dead` = 0"
+	deleteRowLocksByXID      = "DELETE FROM `row_lock` WHERE `xid` = ?"
+	deleteRowLocks           = "DELETE FROM `row_lock` WHERE `row_key_hash` IN (%s)"
+	selectRowLocksForUpdate  = "SELECT `row_key_hash`, `xid` FROM `row_lock` WHERE `row_key_hash` IN (%s) FOR UPDATE"
+	countRowLocks            = "SELECT COUNT(1) FROM `row_lock` WHERE `row_key_hash` IN (%s)"
+	countRowLocksOfOtherXIDs = "SELECT COUNT(1) FROM `row_lock` WHERE `row_key_hash` IN (%s) AND `xid` <> ?"
+	insertRowLocks           = "INSERT INTO `row_lock` (`row_key_hash`, `row_key`, `xid`, `branch_id`) VALUES %s"
+)
+
+// store keeps transaction sessions and row locks in mysql tables. Every update of a session
+// increases its revision, watchers poll the revisions to report updated sessions.
+type store struct {
+	db           *sql.DB
+	pollInterval time.Duration
+	leaderConn   *sql.Conn
+
+	mu                         sync.Mutex
+	initGlobalSessionRevisions map[string]int64
+	initBranchSessionRevisions map[string]int64
+}
+
+func NewMysqlStore(conf config.MysqlStorageConfig) storage.Driver {
+	if conf.PollInterval == 0 {
+		conf.PollInterval = DefaultPollInterval
+	}
+	db, err := sql.Open("mysql", conf.DSN)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, ddl := range []string{createGlobalSessionTable, createBranchSessionTable, createRowLockTable} {
+		if _, err := db.Exec(ddl); err != nil {
+			log.Fatal(err)
+		}
+	}
+	return &store{
+		db:           db,
+		pollInterval: conf.PollInterval,
+	}
+}
+
+// pollingWatchChan implements storage.Watcher by polling session revisions.
+type pollingWatchChan struct {
+	ctx        context.Context
+	cancel     context.CancelFunc
+	interval   time.Duration
+	revisions  map[string]int64
+	poll       func(ctx context.Context) (map[string]int64, error)
+	get        func(ctx context.Context, key string) (storage.TransactionSession, error)
+	resultChan chan storage.TransactionSession
+}
+
+// LeaderElection blocks until the node holds the mysql named lock of the application. The lock
+// is bound to a dedicated connection, the process exits if the connection is lost, so that
+// two nodes never process sessions at the same time.
+func (s *store) LeaderElection(applicationID string) bool {
+	ctx := context.Background()
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+	name := fmt.Sprintf("%s/leader-election", applicationID)
+	for {
+		var acquired sql.NullInt64
+		if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", name, leaderElectionTimeout).Scan(&acquired); err != nil {
+			log.Fatal(err)
+		}
+		if acquired.Valid && acquired.Int64 == 1 {
+			break
+		}
+	}
+	s.leaderConn = conn
+	go func() {
+		ticker := time.NewTicker(s.pollInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := conn.PingContext(ctx); err != nil {
+				log.Fatalf("lost leader election connection of %s: %v", applicationID, err)
+			}
+		}
+	}()
+	return true
+}
+
+func (s *store) AddGlobalSession(ctx context.Context, globalSession *api.GlobalSession) error {
+	_, err := s.db.ExecContext(ctx, insertGlobalSession, globalSession.XID, globalSession.ApplicationID,
+		globalSession.TransactionID, globalSession.TransactionName, globalSession.Timeout,
+		globalSession.BeginTime, globalSession.Status)
+	return err
+}
+
+func (s *store) AddBranchSession(ctx context.Context, branchSession *api.BranchSession) error {
+	// read committed avoids gap locks when the row locks do not exist yet
+	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelReadCommitted})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var status api.GlobalSession_GlobalStatus
+	if err := tx.QueryRowContext(ctx, lockGlobalSessionStatus, branchSession.XID).Scan(&status); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return err2.GlobalTransactionFinished
+		}
+		return err
+	}
+	if status > api.Begin {
+		return err2.GlobalTransactionFinished
+	}
+
+	if branchSession.Type == api.AT && branchSession.LockKey != "" {
+		rowKeys := misc.CollectRowKeys(branchSession.LockKey, branchSession.ResourceID)
+		if err := acquireRowLocks(ctx, tx, rowKeys, branchSession); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, insertBranchSession, branchSession.BranchID, branchSession.ApplicationID,
+		branchSession.BranchSessionID, branchSession.XID, branchSession.TransactionID, branchSession.ResourceID,
+		branchSession.LockKey, branchSession.Type, branchSession.Status, branchSession.ApplicationData,
+		branchSession.BeginTime); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// acquireRowLocks inserts the row locks not held by the global session yet, it fails if any
+// row is locked by another global session.
+func acquireRowLocks(ctx context.Context, tx *sql.Tx, rowKeys []string, branchSession *api.BranchSession) error {
+	for start := 0; start < len(rowKeys); start += batchSize {
+		batch := rowKeys[start:batchEnd(start, len(rowKeys))]
+		held, err := queryRowLocks(ctx, tx, batch)
+		if err != nil {
+			return err
+		}
+
+		var (
+			values []string
+			args   []interface{}
+		)
+		for _, rowKey := range batch {
+			hash := rowKeyHash(rowKey)
+			if xid, ok := held[hash]; ok {
+				if xid != branchSession.XID {
+					return errors.Errorf("register branch session failed, xid: %s, resource id: %s",
+						branchSession.XID, branchSession.ResourceID)
+				}
+				continue
+			}
+			held[hash] = branchSession.XID
+			values = append(values, "(?, ?, ?, ?)")
+			args = append(args, hash, rowKey, branchSession.XID, branchSession.BranchID)
+		}
+		if len(values) == 0 {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf(insertRowLocks, strings.Join(values, ", ")), args...); err != nil {
+			return errors.Wrapf(err, "register branch session failed, xid: %s, resource id: %s",
+				branchSession.XID, branchSession.ResourceID)
+		}
+	}
+	return nil
+}
+
+// queryRowLocks returns the xid of the row locks held by the hash of their row keys
+func queryRowLocks(ctx context.Context, tx *sql.Tx, rowKeys []string) (map[string]string, error) {
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf(selectRowLocksForUpdate, placeholders(len(rowKeys))), rowKeyHashArgs(rowKeys)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make(map[string]string)
+	for rows.Next() {
+		var hash, xid string
+		if err := rows.Scan(&hash, &xid); err != nil {
+			return nil, err
+		}
+		result[hash] = xid
+	}
+	return result, rows.Err()
+}
+
+func (s *store) GlobalCommit(ctx context.Context, xid string) (api.GlobalSession_GlobalStatus, error) {
+	return s.transitGlobalSession(ctx, xid, api.Committing, api.PhaseTwoCommitting)
+}
+
+func (s *store) GlobalRollback(ctx context.Context, xid string) (api.GlobalSession_GlobalStatus, error) {
+	return s.transitGlobalSession(ctx, xid, api.Rollbacking, api.PhaseTwoRollbacking)
+}
+
+// transitGlobalSession moves a global session from Begin to status, and its registered
+// branch sessions to branchStatus in one transaction, the row locks are released in the
+// transaction too when the global session commits.
+func (s *store) transitGlobalSession(ctx context.Context, xid string,
+	status api.GlobalSession_GlobalStatus, branchStatus api.BranchSession_BranchStatus) (api.GlobalSession_GlobalStatus, error) {
+	gs, err := s.GetGlobalSession(ctx, xid)
+	if err != nil {
+		if errors.Is(err, err2.CouldNotFoundGlobalTransaction) {
+			return api.Finished, err2.GlobalTransactionFinished
+		}
+		return api.Begin, err
+	}
+	if gs.Status > api.Begin {
+		if gs.Status == status {
+			return gs.Status, nil
+		}
+		return gs.Status, err2.GlobalTransactionFinished
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return gs.Status, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, updateGlobalSession, status, xid, api.Begin)
+	if err != nil {
+		return gs.Status, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return gs.Status, err
+	}
+	if affected == 0 {
+		return gs.Status, errors.Errorf("update status to %s failed, xid %s", strings.ToLower(status.String()), xid)
+	}
+	if _, err := tx.ExecContext(ctx, updateGlobalBranchSessions, branchStatus, xid, api.Registered); err != nil {
+		return gs.Status, err
+	}
+	if status == api.Committing {
+		if _, err := tx.ExecContext(ctx, deleteRowLocksByXID, xid); err != nil {
+			return gs.Status, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return gs.Status, err
+	}
+	return status, nil
+}
+
+func (s *store) GetGlobalSession(ctx context.Context, xid string) (*api.GlobalSession, error) {
+	gs := &api.GlobalSession{}
+	err := s.db.QueryRowContext(ctx, selectGlobalSession, xid).Scan(&gs.XID, &gs.ApplicationID, &gs.TransactionID,
+		&gs.TransactionName, &gs.Timeout, &gs.BeginTime, &gs.Status)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, err2.CouldNotFoundGlobalTransaction
+		}
+		return nil, err
+	}
+	return gs, nil
+}
+
+func (s *store) ListGlobalSession(ctx context.Context, applicationID string) ([]*api.GlobalSession, error) {
+	rows, err := s.db.QueryContext(ctx, listGlobalSession, applicationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []*api.GlobalSession
+	revisions := make(map[string]int64)
+	for rows.Next() {
+		var revision int64
+		gs := &api.GlobalSession{}
+		if err := rows.Scan(&gs.XID, &gs.ApplicationID, &gs.TransactionID, &gs.TransactionName,
+			&gs.Timeout, &gs.BeginTime, &gs.Status, &revision); err != nil {
+			return nil, err
+		}
+		revisions[gs.XID] = revision
+		result = append(result, gs)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.initGlobalSessionRevisions = revisions
+	s.mu.Unlock()
+	return result, nil
+}
+
+func (s *store) DeleteGlobalSession(ctx context.Context, xid string) error {
+	_, err := s.db.ExecContext(ctx, deleteGlobalSession, xid)
+	return err
+}
+
+func (s *store) GetBranchSession(ctx context.Context, branchID string) (*api.BranchSession, error) {
+	bs := &api.BranchSession{}
+	var lockKey sql.NullString
+	err := s.db.QueryRowContext(ctx, selectBranchSession, branchID).Scan(&bs.BranchID, &bs.ApplicationID,
+		&bs.BranchSessionID, &bs.XID, &bs.TransactionID, &bs.ResourceID, &lockKey, &bs.Type, &bs.Status,
+		&bs.ApplicationData, &bs.BeginTime)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, err2.CouldNotFoundBranchTransaction
+		}
+		return nil, err
+	}
+	bs.LockKey = lockKey.String
+	return bs, nil
+}
+
+func (s *store) ListBranchSession(ctx context.Context, applicationID string) ([]*api.BranchSession, error) {
+	result, revisions, err := s.listBranchSessions(ctx, applicationID, false)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	s.initBranchSessionRevisions = revisions
+	s.mu.Unlock()
+	return result, nil
+}
+
+func (s *store) listBranchSessions(ctx context.Context, applicationID string, dead bool) ([]*api.BranchSession, map[string]int64, error) {
+	rows, err := s.db.QueryContext(ctx, listBranchSession, applicationID, dead)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var result []*api.BranchSession
+	revisions := make(map[string]int64)
+	for rows.Next() {
+		var (
+			lockKey  sql.NullString
+			revision int64
+		)
+		bs := &api.BranchSession{}
+		if err := rows.Scan(&bs.BranchID, &bs.ApplicationID, &bs.BranchSessionID, &bs.XID, &bs.TransactionID,
+			&bs.ResourceID, &lockKey, &bs.Type, &bs.Status, &bs.ApplicationData, &bs.BeginTime, &revision); err != nil {
+			return nil, nil, err
+		}
+		bs.LockKey = lockKey.String
+		revisions[bs.BranchID] = revision
+		result = append(result, bs)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+	return result, revisions, nil
+}
+
+func (s *store) DeleteBranchSession(ctx context.Context, branchID string) error {
+	_, err := s.db.ExecContext(ctx, deleteBranchSession, branchID)
+	return err
+}
+
+// GetBranchSessionKeys returns dead branch sessions too, like the etcd store, the global
+// session is not deleted until the dead branch sessions are handled.
+func (s *store) GetBranchSessionKeys(ctx context.Context, xid string) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, selectBranchSessionKeys, xid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []string
+	for rows.Next() {
+		var branchID string
+		if err := rows.Scan(&branchID); err != nil {
+			return nil, err
+		}
+		result = append(result, branchID)
+	}
+	return result, rows.Err()
+}
+
+func (s *store) BranchReport(ctx context.Context, branchID string, status api.BranchSession_BranchStatus) error {
+	bs, err := s.GetBranchSession(ctx, branchID)
+	if err != nil {
+		return err
+	}
+	if bs.Status == api.Registered {
+		if _, err := s.db.ExecContext(ctx, updateBranchSession, status, branchID, api.Registered); err != nil {
+			return err
+		}
+		bs.Status = status
+	}
+	if bs.Status == api.PhaseOneFailed {
+		if err := s.DeleteBranchSession(ctx, branchID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *store) IsLockable(ctx context.Context, resourceID string, lockKey string) (bool, error) {
+	return s.isLockable(ctx, misc.CollectRowKeys(lockKey, resourceID), countRowLocks)
+}
+
+func (s *store) IsLockableWithXID(ctx context.Context, resourceID string, lockKey string, xid string) (bool, error) {
+	return s.isLockable(ctx, misc.CollectRowKeys(lockKey, resourceID), countRowLocksOfOtherXIDs, xid)
+}
+
+func (s *store) isLockable(ctx context.Context, rowKeys []string, query string, extraArgs ...interface{}) (bool, error) {
+	for start := 0; start < len(rowKeys); start += batchSize {
+		batch := rowKeys[start:batchEnd(start, len(rowKeys))]
+		var count int64
+		args := append(rowKeyHashArgs(batch), extraArgs...)
+		if err := s.db.QueryRowContext(ctx, fmt.Sprintf(query, placeholders(len(batch))), args...).Scan(&count); err != nil {
+			return false, err
+		}
+		if count > 0 {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func (s *store) ReleaseLockKeys(ctx context.Context, resourceID string, lockKeys []string) (bool, error) {
+	var rowKeys []string
+	for _, lockKey := range lockKeys {
+		rowKeys = append(rowKeys, misc.CollectRowKeys(lockKey, resourceID)...)
+	}
+	for start := 0; start < len(rowKeys); start += batchSize {
+		batch := rowKeys[start:batchEnd(start, len(rowKeys))]
+		if _, err := s.db.ExecContext(ctx, fmt.Sprintf(deleteRowLocks, placeholders(len(batch))), rowKeyHashArgs(batch)...); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func (s *store) SetBranchSessionDead(ctx context.Context, branchSession *api.BranchSession) error {
+	result, err := s.db.ExecContext(ctx, setBranchSessionDead, branchSession.BranchID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return errors.New("failed to set branch session dead")
+	}
+	return nil
+}
+
+func (s *store) ListDeadBranchSession(ctx context.Context, applicationID string) ([]*api.BranchSession, error) {
+	result, _, err := s.listBranchSessions(ctx, applicationID, true)
+	return result, err
+}
+
+func (s *store) WatchGlobalSessions(ctx context.Context, applicationID string) storage.Watcher {
+	s.mu.Lock()
+	revisions := copyRevisions(s.initGlobalSessionRevisions)
+	s.mu.Unlock()
+
+	wc := s.createWatchChan(ctx, revisions,
+		func(ctx context.Context) (map[string]int64, error) {
+			return s.pollRevisions(ctx, pollGlobalSession, applicationID)
+		},
+		func(ctx context.Context, key string) (storage.TransactionSession, error) {
+			return s.GetGlobalSession(ctx, key)
+		})
+	go wc.run()
+	return wc
+}
+
+func (s *store) WatchBranchSessions(ctx context.Context, applicationID string) storage.Watcher {
+	s.mu.Lock()
+	revisions := copyRevisions(s.initBranchSessionRevisions)
+	s.mu.Unlock()
+
+	wc := s.createWatchChan(ctx, revisions,
+		func(ctx context.Context) (map[string]int64, error) {
+			return s.pollRevisions(ctx, pollBranchSession, applicationID)
+		},
+		func(ctx context.Context, key string) (storage.TransactionSession, error) {
+			return s.GetBranchSession(ctx, key)
+		})
+	go wc.run()
+	return wc
+}
+
+func (s *store) createWatchChan(ctx context.Context, revisions map[string]int64,
+	poll func(ctx context.Context) (map[string]int64, error),
+	get func(ctx context.Context, key string) (storage.TransactionSession, error)) *pollingWatchChan {
+	wc := &pollingWatchChan{
+		interval:   s.pollInterval,
+		revisions:  revisions,
+		poll:       poll,
+		get:        get,
+		resultChan: make(chan storage.TransactionSession, outgoingBufSize),
+	}
+	wc.ctx, wc.cancel = context.WithCancel(ctx)
+	return wc
+}
+
+func (s *store) pollRevisions(ctx context.Context, query string, applicationID string) (map[string]int64, error) {
+	rows, err := s.db.QueryContext(ctx, query, applicationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make(map[string]int64)
+	for rows.Next() {
+		var (
+			key      string
+			revision int64
+		)
+		if err := rows.Scan(&key, &revision); err != nil {
+			return nil, err
+		}
+		result[key] = revision
+	}
+	return result, rows.Err()
+}
+
+func (wc *pollingWatchChan) run() {
+	defer close(wc.resultChan)
+
+	ticker := time.NewTicker(wc.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			wc.processRevisions()
+		case <-wc.ctx.Done():
+			return
+		}
+	}
+}
+
+// processRevisions sends the sessions updated since the last poll. Like the etcd store,
+// creations and deletions are not reported: a session first seen at revision 1 has never
+// been updated.
+func (wc *pollingWatchChan) processRevisions() {
+	revisions, err := wc.poll(wc.ctx)
+	if err != nil {
+		log.Errorf("watch chan error: %v", err)
+		return
+	}
+	for key, revision := range revisions {
+		lastRevision, ok := wc.revisions[key]
+		if (ok && revision <= lastRevision) || (!ok && revision <= 1) {
+			continue
+		}
+		session, err := wc.get(wc.ctx, key)
+		if err != nil {
+			if !errors.Is(err, err2.CouldNotFoundGlobalTransaction) && !errors.Is(err, err2.CouldNotFoundBranchTransaction) {
+				log.Errorf("watch chan error: %v", err)
+				revisions[key] = lastRevision
+			}
+			continue
+		}
+		select {
+		case wc.resultChan <- session:
+		case <-wc.ctx.Done():
+			return
+		}
+	}
+	wc.revisions = revisions
+}
+
+func (wc *pollingWatchChan) Stop() {
+	wc.cancel()
+}
+
+func (wc *pollingWatchChan) ResultChan() <-chan storage.TransactionSession {
+	return wc.resultChan
+}
+
+func batchEnd(start, length int) int {
+	if start+batchSize < length {
+		return start + batchSize
+	}
+	return length
+}
+
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+func rowKeyHash(rowKey string) string {
+	hash := sha256.Sum256([]byte(rowKey))
+	return hex.EncodeToString(hash[:])
+}
+
+func rowKeyHashArgs(rowKeys []string) []interface{} {
+	args := make([]interface{}, 0, len(rowKeys))
+	for _, rowKey := range rowKeys {
+		args = append(args, rowKeyHash(rowKey))
+	}
+	return args
+}
+
+func copyRevisions(revisions map[string]int64) map[string]int64 {
+	result := make(map[string]int64, len(revisions))
+	for key, revision := range revisions {
+		result[key] = revision
+	}
+	return result
+}
@@ -0,0 +1,233 @@
+/*
+ * Copyright 2022 CECTC, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mysql
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/cectc/dbpack/pkg/dt/api"
+	"github.com/cectc/dbpack/pkg/dt/storage"
+	err2 "github.com/cectc/dbpack/pkg/errors"
+)
+
+func TestPollingWatchChan(t *testing.T) {
+	var polled map[string]int64
+	wc := &pollingWatchChan{
+		revisions: map[string]int64{"bs/svc/1": 1, "bs/svc/2": 2},
+		poll: func(ctx context.Context) (map[string]int64, error) {
+			return polled, nil
+		},
+		get: func(ctx context.Context, key string) (storage.TransactionSession, error) {
+			if key == "bs/svc/5" {
+				return nil, err2.CouldNotFoundBranchTransaction
+			}
+			return &api.BranchSession{BranchID: key}, nil
+		},
+		resultChan: make(chan storage.TransactionSession, outgoingBufSize),
+	}
+	wc.ctx, wc.cancel = context.WithCancel(context.Background())
+	defer wc.cancel()
+
+	received := func() []string {
+		var result []string
+		for len(wc.resultChan) > 0 {
+			result = append(result, (<-wc.resultChan).(*api.BranchSession).BranchID)
+		}
+		return result
+	}
+
+	// bs/svc/1 is updated, bs/svc/3 is created, bs/svc/4 is created and updated, bs/svc/5 is deleted
+	polled = map[string]int64{"bs/svc/1": 2, "bs/svc/2": 2, "bs/svc/3": 1, "bs/svc/4": 2, "bs/svc/5": 3}
+	wc.processRevisions()
+	assert.ElementsMatch(t, []string{"bs/svc/1", "bs/svc/4"}, received())
+
+	polled = map[string]int64{"bs/svc/1": 2, "bs/svc/3": 2}
+	wc.processRevisions()
+	assert.Equal(t, []string{"bs/svc/3"}, received())
+	assert.Equal(t, polled, wc.revisions)
+}
+
+func TestPlaceholders(t *testing.T) {
+	assert.Equal(t, "?", placeholders(1))
+	assert.Equal(t, "?, ?, ?", placeholders(3))
+	assert.Equal(t, batchSize, batchEnd(0, batchSize+1))
+	assert.Equal(t, batchSize+1, batchEnd(batchSize, batchSize+1))
+}
+
+func TestAddBranchSession(t *testing.T) {
+	branchSession := &api.BranchSession{
+		BranchID:      "bs/svc/2",
+		ApplicationID: "svc",
+		XID:           "gs/svc/1",
+		ResourceID:    "employees",
+		LockKey:       "employee:1,2",
+		Type:          api.AT,
+		Status:        api.Registered,
+	}
+	rowKey1 := rowKeyHash("employees^^^employee^^^1")
+	rowKey2 := rowKeyHash("employees^^^employee^^^2")
+	selectRowLocks := fmt.Sprintf(selectRowLocksForUpdate, placeholders(2))
+
+	testCases := []struct {
+		name        string
+		heldBy      string
+		expect      func(mock sqlmock.Sqlmock)
+		expectedErr bool
+	}{
+		{
+			name: "locked by another xid",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(lockGlobalSessionStatus).WithArgs(branchSession.XID).
+					WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow(api.Begin))
+				mock.ExpectQuery(selectRowLocks).WithArgs(rowKey1, rowKey2).
+					WillReturnRows(sqlmock.NewRows([]string{"row_key_hash", "xid"}).AddRow(rowKey1, "gs/svc/0"))
+				mock.ExpectRollback()
+			},
+			expectedErr: true,
+		},
+		{
+			name: "locked by the same xid",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(lockGlobalSessionStatus).WithArgs(branchSession.XID).
+					WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow(api.Begin))
+				mock.ExpectQuery(selectRowLocks).WithArgs(rowKey1, rowKey2).
+					WillReturnRows(sqlmock.NewRows([]string{"row_key_hash", "xid"}).AddRow(rowKey1, branchSession.XID))
+				mock.ExpectExec(fmt.Sprintf(insertRowLocks, "(?, ?, ?, ?)")).
+					WithArgs(rowKey2, "employees^^^employee^^^2", branchSession.XID, branchSession.BranchID).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(insertBranchSession).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			name: "global session finished",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(lockGlobalSessionStatus).WithArgs(branchSession.XID).
+					WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow(api.Committing))
+				mock.ExpectRollback()
+			},
+			expectedErr: true,
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+			assert.Nil(t, err)
+			defer db.Close()
+
+			c.expect(mock)
+			s := &store{db: db}
+			err = s.AddBranchSession(context.Background(), branchSession)
+			assert.Equal(t, c.expectedErr, err != nil)
+			assert.Nil(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestGlobalCommit(t *testing.T) {
+	xid := "gs/svc/1"
+	globalSessionRows := func(status api.GlobalSession_GlobalStatus) *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"xid", "application_id", "transaction_id", "transaction_name",
+			"timeout", "begin_time", "status"}).AddRow(xid, "svc", 1, "test", 60000, 1, status)
+	}
+
+	testCases := []struct {
+		name           string
+		expect         func(mock sqlmock.Sqlmock)
+		expectedStatus api.GlobalSession_GlobalStatus
+		expectedErr    error
+	}{
+		{
+			name: "commit",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(selectGlobalSession).WithArgs(xid).WillReturnRows(globalSessionRows(api.Begin))
+				mock.ExpectBegin()
+				mock.ExpectExec(updateGlobalSession).WithArgs(api.Committing, xid, api.Begin).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(updateGlobalBranchSessions).WithArgs(api.PhaseTwoCommitting, xid, api.Registered).
+					WillReturnResult(sqlmock.NewResult(0, 2))
+				mock.ExpectExec(deleteRowLocksByXID).WithArgs(xid).WillReturnResult(sqlmock.NewResult(0, 2))
+				mock.ExpectCommit()
+			},
+			expectedStatus: api.Committing,
+		},
+		{
+			name: "already committing",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(selectGlobalSession).WithArgs(xid).WillReturnRows(globalSessionRows(api.Committing))
+			},
+			expectedStatus: api.Committing,
+		},
+		{
+			name: "rollbacking",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(selectGlobalSession).WithArgs(xid).WillReturnRows(globalSessionRows(api.Rollbacking))
+			},
+			expectedStatus: api.Rollbacking,
+			expectedErr:    err2.GlobalTransactionFinished,
+		},
+		{
+			name: "rollbacked concurrently",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(selectGlobalSession).WithArgs(xid).WillReturnRows(globalSessionRows(api.Begin))
+				mock.ExpectBegin()
+				mock.ExpectExec(updateGlobalSession).WithArgs(api.Committing, xid, api.Begin).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectRollback()
+			},
+			expectedStatus: api.Begin,
+			expectedErr:    fmt.Errorf("update status to committing failed, xid %s", xid),
+		},
+		{
+			name: "not found",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(selectGlobalSession).WithArgs(xid).
+					WillReturnRows(sqlmock.NewRows([]string{"xid"}))
+			},
+			expectedStatus: api.Finished,
+			expectedErr:    err2.GlobalTransactionFinished,
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+			assert.Nil(t, err)
+			defer db.Close()
+
+			c.expect(mock)
+			s := &store{db: db}
+			status, err := s.GlobalCommit(context.Background(), xid)
+			assert.Equal(t, c.expectedStatus, status)
+			if c.expectedErr == nil {
+				assert.Nil(t, err)
+			} else {
+				assert.EqualError(t, err, c.expectedErr.Error())
+			}
+			assert.Nil(t, mock.ExpectationsWereMet())
+		})
+	}
+}
@@ -32,6 +32,8 @@ import (
 	"github.com/cectc/dbpack/pkg/dt/metrics"
 	"github.com/cectc/dbpack/pkg/dt/storage"
 	"github.com/cectc/dbpack/pkg/dt/storage/etcd"
+	"github.com/cectc/dbpack/pkg/dt/storage/memory"
+	"github.com/cectc/dbpack/pkg/dt/storage/mysql"
 	"github.com/cectc/dbpack/pkg/log"
 	"github.com/cectc/dbpack/pkg/misc"
 	"github.com/cectc/dbpack/pkg/misc/uuid"
@@ -60,7 +62,7 @@ func RegisterTransactionManager(conf *config.DistributedTransaction) {
 	if conf.RetryDeadThreshold == 0 {
 		conf.RetryDeadThreshold = DefaultRetryDeadThreshold
 	}
-	driver := etcd.NewEtcdStore(*conf.EtcdConfig)
+	driver := newStorageDriver(conf)
 	manager := &DistributedTransactionManager{
 		applicationID:                    conf.AppID,
 		storageDriver:                    driver,
@@ -87,6 +89,17 @@ func RegisterTransactionManager(conf *config.DistributedTransaction) {
 	managers[conf.AppID] = manager
 }
 
+func newStorageDriver(conf *config.DistributedTransaction) storage.Driver {
+	switch conf.StorageDriver {
+	case config.MysqlStorage:
+		return mysql.NewMysqlStore(*conf.MysqlConfig)
+	case config.MemoryStorage:
+		return memory.NewMemoryStore()
+	default:
+		return etcd.NewEtcdStore(*conf.EtcdConfig)
+	}
+}
+
 func GetTransactionManager(appID string) proto.DistributedTransactionManager {
 	return managers[appID]
 }
@@ -17,19 +17,38 @@
 package executor
 
 import (
+	"context"
+	"fmt"
+	"strconv"
 	"strings"
 
+	"github.com/pkg/errors"
+
+	"github.com/cectc/dbpack/pkg/constant"
 	"github.com/cectc/dbpack/pkg/mysql"
 	"github.com/cectc/dbpack/pkg/proto"
 	"github.com/cectc/dbpack/third_party/parser/ast"
+	"github.com/cectc/dbpack/third_party/parser/format"
 	driver "github.com/cectc/dbpack/third_party/types/parser_driver"
 )
 
 const (
 	autocommit = "autocommit"
 	off        = "off"
+
+	txIsolationOneShot = "tx_isolation_one_shot"
+	txReadOnlyOneShot  = "tx_read_only_one_shot"
 )
 
+// transactionVariables maps the transaction variables produced by the parser for SET TRANSACTION
+// to the ones of mysql, tx_isolation and tx_read_only are removed in mysql 8.0.
+var transactionVariables = map[string]string{
+	"tx_isolation":     "transaction_isolation",
+	"tx_read_only":     "transaction_read_only",
+	txIsolationOneShot: "transaction_isolation",
+	txReadOnlyOneShot:  "transaction_read_only",
+}
+
 func shouldStartTransaction(stmt *ast.SetStmt) (shouldStartTransaction bool) {
 	if len(stmt.Variables) == 1 && strings.EqualFold(stmt.Variables[0].Name, autocommit) {
 		switch exprType := stmt.Variables[0].Value.(type) {
@@ -62,3 +81,210 @@ func decodeResult(result proto.Result) (proto.Result, error) {
 	}
 	return result, nil
 }
+
+// streamable returns true if the result set of the stmt can be streamed to the client,
+// post filters and select for update need the whole result set.
+func streamable(stmt ast.StmtNode, postFilters []proto.DBPostFilter) bool {
+	if len(postFilters) != 0 {
+		return false
+	}
+	selectStmt, ok := stmt.(*ast.SelectStmt)
+	return ok && selectStmt.LockInfo == nil
+}
+
+// sessionSet returns true if the stmt only assigns session variables, which are tracked
+// by the session of the client instead of being sent to every backend connection.
+func sessionSet(stmt *ast.SetStmt) bool {
+	for _, variable := range stmt.Variables {
+		if variable.IsGlobal || strings.EqualFold(variable.Name, autocommit) {
+			return false
+		}
+	}
+	return true
+}
+
+// setSessionVariables executes the set stmt with query, and records the assignments to the session
+// of the client on success. The values which are not literals, such as @@sql_mode or CONCAT(@a, 'b'),
+// are evaluated first, so that the assignments can be replayed on other backend connections.
+func setSessionVariables(ctx context.Context, stmt *ast.SetStmt,
+	query func(ctx context.Context, sql string) (proto.Result, uint16, error)) (proto.Result, uint16, error) {
+	normalizeTransactionVariables(stmt)
+	session := proto.ExtractSession(ctx)
+	if isNextTransactionSet(stmt) {
+		characteristics := make([]string, 0, len(stmt.Variables))
+		for _, variable := range stmt.Variables {
+			characteristics = append(characteristics, transactionCharacteristic(variable))
+		}
+		if session == nil {
+			return query(ctx, "SET TRANSACTION "+strings.Join(characteristics, ", "))
+		}
+		// SET TRANSACTION takes effect for the next transaction only, so it is not sent to
+		// a pooled connection, but to the connection beginning the next transaction.
+		for i, variable := range stmt.Variables {
+			session.SetNextTransaction(variable.Name, characteristics[i])
+		}
+		return &mysql.Result{}, 0, nil
+	}
+	if session == nil {
+		var sb strings.Builder
+		if err := stmt.Restore(format.NewRestoreCtx(constant.DBPackRestoreFormat, &sb)); err != nil {
+			return nil, 0, err
+		}
+		return query(ctx, sb.String())
+	}
+	if err := evaluateVariables(ctx, stmt, query); err != nil {
+		return nil, 0, err
+	}
+
+	newSession := session.Clone()
+	assignments := make([]string, 0, len(stmt.Variables))
+	for _, variable := range stmt.Variables {
+		var sb strings.Builder
+		if err := variable.Restore(format.NewRestoreCtx(constant.DBPackRestoreFormat, &sb)); err != nil {
+			return nil, 0, err
+		}
+		key := proto.SessionVariableKey(variable)
+		if _, ok := variable.Value.(*ast.DefaultExpr); ok {
+			newSession.Unset(key)
+		} else {
+			newSession.Assign(key, sb.String())
+		}
+		assignments = append(assignments, sb.String())
+	}
+	result, warns, err := query(proto.WithSession(ctx, newSession), "SET "+strings.Join(assignments, ", "))
+	if err != nil {
+		return nil, 0, err
+	}
+	session.Update(newSession)
+	return result, warns, nil
+}
+
+// normalizeTransactionVariables renames the transaction variables of the stmt to the ones of mysql,
+// except the one-shot ones, which are kept for isNextTransactionSet, and converts the values of
+// transaction_read_only to integers.
+func normalizeTransactionVariables(stmt *ast.SetStmt) {
+	for _, variable := range stmt.Variables {
+		name, ok := transactionVariables[strings.ToLower(variable.Name)]
+		if !ok || !variable.IsSystem {
+			continue
+		}
+		if name == "transaction_read_only" {
+			if value, ok := variable.Value.(*driver.ValueExpr); ok {
+				// the parser assigns '0' or '1', which mysql rejects for a boolean variable
+				if readOnly, ok := value.GetValue().(string); ok {
+					readOnlyValue := int64(1)
+					if readOnly == "0" {
+						readOnlyValue = 0
+					}
+					variable.Value = ast.NewValueExpr(readOnlyValue, "", "")
+				}
+			}
+		}
+		if variable.Name != txIsolationOneShot && variable.Name != txReadOnlyOneShot {
+			variable.Name = name
+		}
+	}
+}
+
+// isNextTransactionSet returns true if the stmt is SET TRANSACTION without GLOBAL or SESSION.
+func isNextTransactionSet(stmt *ast.SetStmt) bool {
+	for _, variable := range stmt.Variables {
+		if variable.Name != txIsolationOneShot && variable.Name != txReadOnlyOneShot {
+			return false
+		}
+	}
+	return len(stmt.Variables) != 0
+}
+
+// transactionCharacteristic returns the characteristic of SET TRANSACTION assigned by the one-shot variable.
+func transactionCharacteristic(variable *ast.VariableAssignment) string {
+	var value string
+	if expr, ok := variable.Value.(*driver.ValueExpr); ok {
+		value = fmt.Sprint(expr.GetValue())
+	}
+	if variable.Name == txReadOnlyOneShot {
+		if value == "0" {
+			return "READ WRITE"
+		}
+		return "READ ONLY"
+	}
+	return "ISOLATION LEVEL " + strings.ReplaceAll(value, "-", " ")
+}
+
+// withNextTransaction binds the characteristics set by SET TRANSACTION to the ctx of the transaction to begin.
+func withNextTransaction(ctx context.Context) context.Context {
+	if session := proto.ExtractSession(ctx); session != nil {
+		if characteristics := session.TakeNextTransaction(); len(characteristics) != 0 {
+			return proto.WithTransactionCharacteristics(ctx, characteristics)
+		}
+	}
+	return ctx
+}
+
+// evaluateVariables replaces the values of the stmt which are not literals with their evaluated results.
+func evaluateVariables(ctx context.Context, stmt *ast.SetStmt,
+	query func(ctx context.Context, sql string) (proto.Result, uint16, error)) error {
+	var (
+		sb        strings.Builder
+		variables []*ast.VariableAssignment
+	)
+	restoreCtx := format.NewRestoreCtx(constant.DBPackRestoreFormat, &sb)
+	for _, variable := range stmt.Variables {
+		if variable.Name == ast.SetNames || variable.Name == ast.SetCharset {
+			continue
+		}
+		switch variable.Value.(type) {
+		case *driver.ValueExpr, *ast.DefaultExpr, *ast.ColumnNameExpr:
+			continue
+		}
+		if len(variables) == 0 {
+			sb.WriteString("SELECT ")
+		} else {
+			sb.WriteString(", ")
+		}
+		if err := variable.Value.Restore(restoreCtx); err != nil {
+			return err
+		}
+		variables = append(variables, variable)
+	}
+	if len(variables) == 0 {
+		return nil
+	}
+
+	result, _, err := query(ctx, sb.String())
+	if err != nil {
+		return err
+	}
+	rlt, ok := result.(*mysql.Result)
+	if !ok || len(rlt.Rows) != 1 {
+		return errors.Errorf("unexpected result of %s", sb.String())
+	}
+	values, err := rlt.Rows[0].Decode()
+	if err != nil {
+		return err
+	}
+	for i, variable := range variables {
+		variable.Value = literalValue(values[i])
+	}
+	return nil
+}
+
+// literalValue converts the value of a result set to a literal expression.
+func literalValue(value *proto.Value) ast.ExprNode {
+	if value == nil || value.Val == nil {
+		return ast.NewValueExpr(nil, "", "")
+	}
+	raw := string(value.Raw)
+	if constant.IsNum(uint8(value.Typ)) {
+		if i, err := strconv.ParseInt(raw, 10, 64); err == nil {
+			return ast.NewValueExpr(i, "", "")
+		}
+		if u, err := strconv.ParseUint(raw, 10, 64); err == nil {
+			return ast.NewValueExpr(u, "", "")
+		}
+		if f, err := strconv.ParseFloat(raw, 64); err == nil {
+			return ast.NewValueExpr(f, "", "")
+		}
+	}
+	return ast.NewValueExpr(raw, "", "")
+}
@@ -17,10 +17,15 @@
 package executor
 
 import (
+	"context"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 
+	"github.com/cectc/dbpack/pkg/constant"
+	"github.com/cectc/dbpack/pkg/mysql"
+	"github.com/cectc/dbpack/pkg/proto"
+	"github.com/cectc/dbpack/third_party/parser"
 	"github.com/cectc/dbpack/third_party/parser/ast"
 	"github.com/cectc/dbpack/third_party/parser/model"
 	driver "github.com/cectc/dbpack/third_party/types/parser_driver"
@@ -59,3 +64,129 @@ func TestShouldStartTransaction(t *testing.T) {
 	stmt.Variables[0].Value = &columnNameExpr
 	assert.True(t, shouldStartTransaction(stmt))
 }
+
+func TestStreamable(t *testing.T) {
+	testCases := []struct {
+		sql      string
+		expected bool
+	}{
+		{sql: "select * from t where id = 1", expected: true},
+		{sql: "select * from t where id = 1 for update", expected: false},
+		{sql: "update t set name = 'a' where id = 1", expected: false},
+	}
+	for _, c := range testCases {
+		stmt, err := parser.New().ParseOneStmt(c.sql, "", "")
+		assert.Nil(t, err)
+		assert.Equal(t, c.expected, streamable(stmt, nil), c.sql)
+	}
+	stmt, err := parser.New().ParseOneStmt("select * from t", "", "")
+	assert.Nil(t, err)
+	assert.False(t, streamable(stmt, []proto.DBPostFilter{nil}))
+}
+
+func TestSessionSet(t *testing.T) {
+	testCases := []struct {
+		sql      string
+		expected bool
+	}{
+		{sql: "set names utf8mb4", expected: true},
+		{sql: "set sql_mode = 'ANSI', @a = 1", expected: true},
+		{sql: "set global sql_mode = 'ANSI'", expected: false},
+		{sql: "set autocommit = 0", expected: false},
+	}
+	for _, c := range testCases {
+		stmt, err := parser.New().ParseOneStmt(c.sql, "", "")
+		assert.Nil(t, err)
+		assert.Equal(t, c.expected, sessionSet(stmt.(*ast.SetStmt)), c.sql)
+	}
+}
+
+func TestSetSessionVariables(t *testing.T) {
+	session := proto.NewSession()
+	ctx := proto.WithSession(context.Background(), session)
+
+	var queries []string
+	query := func(ctx context.Context, sql string) (proto.Result, uint16, error) {
+		queries = append(queries, sql)
+		if sql == "SELECT @@`sql_mode`" {
+			fields := []*mysql.Field{{Name: "@@sql_mode", FieldType: constant.FieldTypeVarString}}
+			return &mysql.Result{
+				Fields: fields,
+				Rows: []proto.Row{mysql.NewTextRow(fields, []*proto.Value{
+					{Typ: constant.FieldTypeVarString, Val: []byte("ANSI"), Raw: []byte("ANSI")},
+				})},
+			}, 0, nil
+		}
+		return &mysql.Result{}, 0, nil
+	}
+
+	stmt, err := parser.New().ParseOneStmt("set sql_mode = 'ANSI', @a = @@sql_mode", "", "")
+	assert.Nil(t, err)
+	_, _, err = setSessionVariables(ctx, stmt.(*ast.SetStmt), query)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"SELECT @@`sql_mode`", "SET @@SESSION.`sql_mode`='ANSI', @`a`='ANSI'"}, queries)
+	assert.Equal(t, []string{"@@sql_mode", "@a"}, session.Keys())
+
+	stmt, err = parser.New().ParseOneStmt("set sql_mode = default", "", "")
+	assert.Nil(t, err)
+	_, _, err = setSessionVariables(ctx, stmt.(*ast.SetStmt), query)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"@a"}, session.Keys())
+
+	session.ResetVariables()
+	assert.Empty(t, session.Keys())
+}
+
+func TestSetSessionTransaction(t *testing.T) {
+	session := proto.NewSession()
+	ctx := proto.WithSession(context.Background(), session)
+
+	var queries []string
+	query := func(ctx context.Context, sql string) (proto.Result, uint16, error) {
+		queries = append(queries, sql)
+		return &mysql.Result{}, 0, nil
+	}
+
+	stmt, err := parser.New().ParseOneStmt("set session transaction isolation level read committed, read only", "", "")
+	assert.Nil(t, err)
+	_, _, err = setSessionVariables(ctx, stmt.(*ast.SetStmt), query)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"SET @@SESSION.`transaction_isolation`='READ-COMMITTED', @@SESSION.`transaction_read_only`=1"}, queries)
+	assert.Equal(t, []string{"@@transaction_isolation", "@@transaction_read_only"}, session.Keys())
+	assert.Empty(t, session.TakeNextTransaction())
+}
+
+func TestSetTransaction(t *testing.T) {
+	session := proto.NewSession()
+	ctx := proto.WithSession(context.Background(), session)
+
+	var queries []string
+	query := func(ctx context.Context, sql string) (proto.Result, uint16, error) {
+		queries = append(queries, sql)
+		return &mysql.Result{}, 0, nil
+	}
+
+	stmt, err := parser.New().ParseOneStmt("set transaction isolation level serializable", "", "")
+	assert.Nil(t, err)
+	_, _, err = setSessionVariables(ctx, stmt.(*ast.SetStmt), query)
+	assert.Nil(t, err)
+	stmt, err = parser.New().ParseOneStmt("set transaction read write", "", "")
+	assert.Nil(t, err)
+	_, _, err = setSessionVariables(ctx, stmt.(*ast.SetStmt), query)
+	assert.Nil(t, err)
+	// the one-shot characteristics are neither sent to a pooled connection nor recorded as variables
+	assert.Empty(t, queries)
+	assert.Empty(t, session.Keys())
+
+	txCtx := withNextTransaction(ctx)
+	assert.Equal(t, []string{"ISOLATION LEVEL SERIALIZABLE", "READ WRITE"}, proto.TransactionCharacteristics(txCtx))
+	// they apply to the next transaction only
+	assert.Empty(t, proto.TransactionCharacteristics(withNextTransaction(ctx)))
+
+	// without a session, the stmt is forwarded as is
+	stmt, err = parser.New().ParseOneStmt("set transaction isolation level read uncommitted", "", "")
+	assert.Nil(t, err)
+	_, _, err = setSessionVariables(context.Background(), stmt.(*ast.SetStmt), query)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"SET TRANSACTION ISOLATION LEVEL READ UNCOMMITTED"}, queries)
+}
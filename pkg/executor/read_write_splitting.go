@@ -171,7 +171,7 @@ func (executor *ReadWriteSplittingExecutor) ExecutorComQuery(
 	case *ast.SetStmt:
 		if shouldStartTransaction(stmt) {
 			// TODO add metrics
-			tx, result, err = executor.dbGroup.Begin(spanCtx)
+			tx, result, err = executor.dbGroup.Begin(withNextTransaction(spanCtx))
 			if err != nil {
 				return nil, 0, err
 			}
@@ -181,14 +181,17 @@ func (executor *ReadWriteSplittingExecutor) ExecutorComQuery(
 			txi, ok := executor.localTransactionMap.Load(connectionID)
 			if ok {
 				tx = txi.(proto.Tx)
-				return tx.Query(spanCtx, sqlText)
+				return setSessionVariables(spanCtx, stmt, tx.Query)
 			}
-			// set to all db
-			return executor.dbGroup.QueryAll(ctx, sqlText)
+			if sessionSet(stmt) {
+				return setSessionVariables(proto.WithMaster(spanCtx), stmt, executor.dbGroup.Query)
+			}
+			// set global variables to all db
+			return executor.dbGroup.QueryAll(spanCtx, sqlText)
 		}
 	case *ast.BeginStmt:
 		// TODO add metrics
-		tx, result, err = executor.dbGroup.Begin(spanCtx)
+		tx, result, err = executor.dbGroup.Begin(withNextTransaction(spanCtx))
 		if err != nil {
 			return nil, 0, err
 		}
@@ -22,6 +22,7 @@ import (
 	"fmt"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/pkg/errors"
 
@@ -40,18 +41,26 @@ import (
 	"github.com/cectc/dbpack/third_party/parser/ast"
 )
 
+// xaRecoverInterval is the interval of resolving the in-doubt XA branches in XA transaction mode
+const xaRecoverInterval = time.Minute
+
 type ShardingExecutor struct {
 	PreFilters  []proto.DBPreFilter
 	PostFilters []proto.DBPostFilter
 
+	appID     string
 	config    *config.ShardingConfig
 	executors []proto.DBGroupExecutor
 	optimizer proto.Optimizer
+	// xaLog is set in XA transaction mode
+	xaLog *group.XALog
 	// map[uint32]proto.DBGroupTx
 	localTransactionMap *sync.Map
 }
 
-func NewShardingExecutor(conf *config.Executor) (proto.Executor, error) {
+// NewShardingExecutor creates the sharding executor, the background tasks of the executor, e.g.
+// resolving the in-doubt XA branches, stop when ctx is done.
+func NewShardingExecutor(ctx context.Context, conf *config.Executor) (proto.Executor, error) {
 	var (
 		err            error
 		content        []byte
@@ -61,6 +70,7 @@ func NewShardingExecutor(conf *config.Executor) (proto.Executor, error) {
 		executorMap    = make(map[string]proto.DBGroupExecutor)
 		algorithms     map[string]cond.ShardingAlgorithm
 		topologies     map[string]*topo.Topology
+		keyUpdates     = make(map[string]config.ShardingKeyUpdate)
 	)
 
 	if content, err = json.Marshal(conf.Config); err != nil {
@@ -90,13 +100,20 @@ func NewShardingExecutor(conf *config.Executor) (proto.Executor, error) {
 		return nil, errors.WithStack(err)
 	}
 
+	for _, table := range shardingConfig.LogicTables {
+		keyUpdates[table.TableName] = table.ShardingKeyUpdate
+	}
+
 	executor := &ShardingExecutor{
 		PreFilters:  make([]proto.DBPreFilter, 0),
 		PostFilters: make([]proto.DBPostFilter, 0),
+		appID:       conf.AppID,
 		config:      shardingConfig,
 		executors:   executorSlice,
-		optimizer: optimize.NewOptimizer(conf.AppID, globalTables, shardingConfig.ShadowRules,
-			executorSlice, executorMap, algorithms, topologies),
+		optimizer: optimize.NewPlanCache(conf.AppID,
+			optimize.NewOptimizer(conf.AppID, globalTables, shardingConfig.ShadowRules,
+				executorSlice, executorMap, algorithms, topologies, keyUpdates),
+			shardingConfig.PlanCacheSize),
 		localTransactionMap: &sync.Map{},
 	}
 
@@ -115,9 +132,58 @@ func NewShardingExecutor(conf *config.Executor) (proto.Executor, error) {
 		}
 	}
 
+	if shardingConfig.TransactionMode == config.XATransaction {
+		if executor.xaLog, err = newXALog(shardingConfig.XA, executorMap); err != nil {
+			return nil, err
+		}
+		go executor.recoverXATransactions(ctx)
+	}
 	return executor, nil
 }
 
+func newXALog(conf *config.XAConfig, executorMap map[string]proto.DBGroupExecutor) (*group.XALog, error) {
+	if conf == nil || conf.InstanceID == "" {
+		return nil, errors.New("xa.instance_id is required in XA transaction mode")
+	}
+	executor, ok := executorMap[conf.LogGroup]
+	if !ok {
+		return nil, errors.Errorf("xa.log_group %q is not a db group", conf.LogGroup)
+	}
+	return group.NewXALog(conf.InstanceID, executor, conf.LogTable)
+}
+
+// recoverXATransactions resolves the XA branches left by the crash of the last run, and
+// the branches failed to commit after the transaction has been recorded.
+func (executor *ShardingExecutor) recoverXATransactions(ctx context.Context) {
+	ticker := time.NewTicker(xaRecoverInterval)
+	defer ticker.Stop()
+	for {
+		if err := group.RecoverXATransactions(ctx, executor.xaLog, executor.executors); err != nil {
+			log.Errorf("recover xa transactions failed, err: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (executor *ShardingExecutor) newComplexTx() proto.DBGroupTx {
+	return group.NewDistributedComplexTx(executor.appID, executor.optimizer,
+		executor.config.TransactionMode, executor.xaLog)
+}
+
+// beginComplexTx creates the ComplexTx of an explicit transaction, the characteristics set by
+// SET TRANSACTION apply to all its branches.
+func (executor *ShardingExecutor) beginComplexTx(ctx context.Context) proto.DBGroupTx {
+	tx := executor.newComplexTx()
+	if characteristics := proto.TransactionCharacteristics(withNextTransaction(ctx)); len(characteristics) != 0 {
+		tx.(*group.ComplexTx).SetCharacteristics(characteristics)
+	}
+	return tx
+}
+
 func convertShardingAlgorithmsAndTopologies(logicTables []*config.LogicTable) (
 	map[string]cond.ShardingAlgorithm,
 	map[string]*topo.Topology,
@@ -128,7 +194,7 @@ func convertShardingAlgorithmsAndTopologies(logicTables []*config.LogicTable) (
 		generator proto.SequenceGenerator
 	)
 	for _, table := range logicTables {
-		topology, err := topo.ParseTopology(table.DBName, table.TableName, table.Topology)
+		topology, err := topo.ParseTopologyWithSuffixes(table.DBName, table.TableName, table.Topology, table.TableSuffixes)
 		if err != nil {
 			return nil, nil, err
 		}
@@ -141,8 +207,7 @@ func convertShardingAlgorithmsAndTopologies(logicTables []*config.LogicTable) (
 			}
 		}
 
-		alg, err := cond.NewShardingAlgorithm(table.ShardingRule.ShardingAlgorithm,
-			table.ShardingRule.Column, table.AllowFullScan, topology, table.ShardingRule.Config, generator)
+		alg, err := CreateShardingAlgorithm(table, topology, generator)
 		if err != nil {
 			return nil, nil, err
 		}
@@ -151,6 +216,25 @@ func convertShardingAlgorithmsAndTopologies(logicTables []*config.LogicTable) (
 	return algs, topos, nil
 }
 
+// CreateShardingAlgorithm creates the sharding algorithm of the logic table, the table is sharded by
+// `sharding_rule`, or by `db_sharding_rule` and `table_sharding_rule` on different columns.
+func CreateShardingAlgorithm(table *config.LogicTable, topology *topo.Topology,
+	generator proto.SequenceGenerator) (cond.ShardingAlgorithm, error) {
+	if table.DBShardingRule != nil || table.TableShardingRule != nil {
+		if table.DBShardingRule == nil || table.TableShardingRule == nil {
+			return nil, errors.Errorf("logic table %s should have both db_sharding_rule and table_sharding_rule", table.TableName)
+		}
+		return cond.NewCompositeSharding(table.DBShardingRule.ShardingAlgorithm, table.DBShardingRule.Column,
+			table.DBShardingRule.Config, table.TableShardingRule.ShardingAlgorithm, table.TableShardingRule.Column,
+			table.TableShardingRule.Config, table.AllowFullScan, topology, generator)
+	}
+	if table.ShardingRule == nil {
+		return nil, errors.Errorf("logic table %s should have a sharding_rule", table.TableName)
+	}
+	return cond.NewShardingAlgorithm(table.ShardingRule.ShardingAlgorithm,
+		table.ShardingRule.Column, table.AllowFullScan, topology, table.ShardingRule.Config, generator)
+}
+
 func (executor *ShardingExecutor) GetPreFilters() []proto.DBPreFilter {
 	return executor.PreFilters
 }
@@ -164,7 +248,7 @@ func (executor *ShardingExecutor) ExecuteMode() config.ExecuteMode {
 }
 
 func (executor *ShardingExecutor) ProcessDistributedTransaction() bool {
-	return false
+	return executor.config.TransactionMode != config.LocalTransaction
 }
 
 func (executor *ShardingExecutor) InLocalTransaction(ctx context.Context) bool {
@@ -191,6 +275,7 @@ func (executor *ShardingExecutor) ExecuteFieldList(ctx context.Context, table, w
 
 func (executor *ShardingExecutor) ExecutorComQuery(ctx context.Context, sql string) (result proto.Result, warn uint16, err error) {
 	proto.WithVariable(ctx, constant.TransactionTimeout, executor.config.TransactionTimeout)
+	ctx = proto.WithDBGroupTxFactory(ctx, executor.newComplexTx)
 	spanCtx, span := tracing.GetTraceSpan(ctx, tracing.SHDComQuery)
 	defer span.End()
 
@@ -219,8 +304,10 @@ func (executor *ShardingExecutor) ExecutorComQuery(ctx context.Context, sql stri
 	switch stmt := queryStmt.(type) {
 	case *ast.SetStmt:
 		if shouldStartTransaction(stmt) {
-			tx := group.NewComplexTx(executor.optimizer)
+			tx := executor.beginComplexTx(spanCtx)
 			executor.localTransactionMap.Store(connectionID, tx)
+		} else if sessionSet(stmt) {
+			return setSessionVariables(proto.WithMaster(spanCtx), stmt, executor.executors[0].Query)
 		} else {
 			for _, db := range executor.executors {
 				go func(dbGroup proto.DBGroupExecutor) {
@@ -245,7 +332,7 @@ func (executor *ShardingExecutor) ExecutorComQuery(ctx context.Context, sql stri
 		}
 		return plan.Execute(spanCtx)
 	case *ast.BeginStmt:
-		tx := group.NewComplexTx(executor.optimizer)
+		tx := executor.beginComplexTx(spanCtx)
 		executor.localTransactionMap.Store(connectionID, tx)
 		return &mysql.Result{
 			AffectedRows: 0,
@@ -290,6 +377,9 @@ func (executor *ShardingExecutor) ExecutorComQuery(ctx context.Context, sql stri
 		if err != nil {
 			return nil, 0, err
 		}
+		if streamPlan, ok := plan.(proto.StreamPlan); ok && streamable(stmt, executor.PostFilters) {
+			return streamPlan.ExecuteStream(spanCtx)
+		}
 		return plan.Execute(spanCtx)
 	default:
 		txi, ok := executor.localTransactionMap.Load(connectionID)
@@ -308,6 +398,7 @@ func (executor *ShardingExecutor) ExecutorComQuery(ctx context.Context, sql stri
 func (executor *ShardingExecutor) ExecutorComStmtExecute(
 	ctx context.Context, stmt *proto.Stmt) (result proto.Result, warns uint16, err error) {
 	proto.WithVariable(ctx, constant.TransactionTimeout, executor.config.TransactionTimeout)
+	ctx = proto.WithDBGroupTxFactory(ctx, executor.newComplexTx)
 	spanCtx, span := tracing.GetTraceSpan(ctx, tracing.SHDComStmtExecute)
 	defer span.End()
 
@@ -346,6 +437,9 @@ func (executor *ShardingExecutor) ExecutorComStmtExecute(
 	if err != nil {
 		return nil, 0, err
 	}
+	if streamPlan, ok := plan.(proto.StreamPlan); ok && streamable(stmt.StmtNode, executor.PostFilters) {
+		return streamPlan.ExecuteStream(spanCtx)
+	}
 	return plan.Execute(spanCtx)
 }
 
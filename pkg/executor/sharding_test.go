@@ -84,7 +84,7 @@ func (suite *_ShardingExecutorTestSuite) SetupSuite() {
 
 	executorConfig := suite.unmarshalExecutorConfig()
 	executorConfig.AppID = "test"
-	shardingExecutor, err := NewShardingExecutor(executorConfig)
+	shardingExecutor, err := NewShardingExecutor(context.Background(), executorConfig)
 	if err != nil {
 		suite.T().Fatal(err)
 	}
@@ -28,6 +28,7 @@ import (
 	"github.com/cectc/dbpack/pkg/constant"
 	"github.com/cectc/dbpack/pkg/filter"
 	"github.com/cectc/dbpack/pkg/log"
+	"github.com/cectc/dbpack/pkg/mysql"
 	"github.com/cectc/dbpack/pkg/proto"
 	"github.com/cectc/dbpack/pkg/resource"
 	"github.com/cectc/dbpack/pkg/tracing"
@@ -118,7 +119,13 @@ func (executor *SingleDBExecutor) InGlobalTransaction(ctx context.Context) bool
 
 func (executor *SingleDBExecutor) ExecuteUseDB(ctx context.Context, schema string) error {
 	db := resource.GetDBManager(executor.conf.AppID).GetDB(executor.dataSource)
-	return db.UseDB(ctx, schema)
+	if err := db.UseDB(ctx, schema); err != nil {
+		return err
+	}
+	if session := proto.ExtractSession(ctx); session != nil {
+		session.SetSchema(schema)
+	}
+	return nil
 }
 
 func (executor *SingleDBExecutor) ExecuteFieldList(ctx context.Context, table, wildcard string) ([]proto.Field, error) {
@@ -167,7 +174,7 @@ func (executor *SingleDBExecutor) ExecutorComQuery(
 	case *ast.SetStmt:
 		if shouldStartTransaction(stmt) {
 			// TODO add metrics
-			tx, result, err = db.Begin(spanCtx)
+			tx, result, err = db.Begin(withNextTransaction(spanCtx))
 			if err != nil {
 				return nil, 0, err
 			}
@@ -177,13 +184,18 @@ func (executor *SingleDBExecutor) ExecutorComQuery(
 			txi, ok := executor.localTransactionMap.Load(connectionID)
 			if ok {
 				tx = txi.(proto.Tx)
-				return tx.Query(spanCtx, sqlText)
+				return setSessionVariables(spanCtx, stmt, tx.Query)
 			}
-			return db.Query(spanCtx, sqlText)
+			return setSessionVariables(spanCtx, stmt, db.Query)
 		}
+	case *ast.UseStmt:
+		if err = executor.ExecuteUseDB(spanCtx, stmt.DBName); err != nil {
+			return nil, 0, err
+		}
+		return &mysql.Result{}, 0, nil
 	case *ast.BeginStmt:
 		// TODO add metrics
-		tx, result, err = db.Begin(spanCtx)
+		tx, result, err = db.Begin(withNextTransaction(spanCtx))
 		if err != nil {
 			return nil, 0, err
 		}
@@ -244,6 +256,9 @@ func (executor *SingleDBExecutor) ExecutorComQuery(
 		}
 		return result, 0, err
 	default:
+		if streamable(queryStmt, executor.PostFilters) {
+			spanCtx = proto.WithStreaming(spanCtx)
+		}
 		txi, ok := executor.localTransactionMap.Load(connectionID)
 		if ok {
 			tx = txi.(proto.Tx)
@@ -273,6 +288,9 @@ func (executor *SingleDBExecutor) ExecutorComStmtExecute(
 
 	connectionID := proto.ConnectionID(ctx)
 	log.Debugf("connectionID: %d, prepare: %s", connectionID, stmt.SqlText)
+	if streamable(stmt.StmtNode, executor.PostFilters) {
+		spanCtx = proto.WithStreaming(spanCtx)
+	}
 	txi, ok := executor.localTransactionMap.Load(connectionID)
 	if ok {
 		tx := txi.(proto.Tx)
@@ -18,6 +18,7 @@ package exec
 
 import (
 	"context"
+	"strings"
 	"time"
 
 	"github.com/cectc/dbpack/pkg/constant"
@@ -61,3 +62,27 @@ func BuildUndoItem(
 	}
 	return sqlUndoLog
 }
+
+// getPKIndexes returns the index of every primary key column in the inserted columns, or in
+// the table columns if the insert statement has no column list, -1 if the column is missing.
+func getPKIndexes(ctx context.Context, executor Executor, insertColumns []string) []int {
+	tableMeta, _ := executor.GetTableMeta(ctx)
+	columns := insertColumns
+	if len(columns) == 0 {
+		columns = tableMeta.Columns
+	}
+
+	pks := tableMeta.GetPrimaryKeyOnlyName()
+	indexes := make([]int, 0, len(pks))
+	for _, pk := range pks {
+		index := -1
+		for i, column := range columns {
+			if strings.EqualFold(pk, column) {
+				index = i
+				break
+			}
+		}
+		indexes = append(indexes, index)
+	}
+	return indexes
+}
@@ -0,0 +1,440 @@
+/*
+ * Copyright 2022 CECTC, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package exec
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/cectc/dbpack/pkg/constant"
+	"github.com/cectc/dbpack/pkg/driver"
+	"github.com/cectc/dbpack/pkg/dt/schema"
+	"github.com/cectc/dbpack/pkg/dt/undolog"
+	"github.com/cectc/dbpack/pkg/log"
+	"github.com/cectc/dbpack/pkg/meta"
+	"github.com/cectc/dbpack/pkg/misc"
+	"github.com/cectc/dbpack/pkg/mysql"
+	"github.com/cectc/dbpack/pkg/resource"
+	"github.com/cectc/dbpack/pkg/tracing"
+	"github.com/cectc/dbpack/third_party/parser/ast"
+	"github.com/cectc/dbpack/third_party/parser/format"
+	driver2 "github.com/cectc/dbpack/third_party/types/parser_driver"
+)
+
+// MultiTableExecutor builds the images of the statements modify several tables,
+// e.g. UPDATE a JOIN b ON ... SET a.x = ..., b.y = ... and DELETE a, b FROM a JOIN b ON ...,
+// the images of a table are in the same position of BeforeImages and AfterImages.
+type MultiTableExecutor interface {
+	BeforeImages(ctx context.Context) ([]*schema.TableRecords, error)
+	AfterImages(ctx context.Context) ([]*schema.TableRecords, error)
+}
+
+// multiTableTarget is a table modified by the statement
+type multiTableTarget struct {
+	// tableName is the restored table name, e.g. `db`.`t`
+	tableName string
+	// qualifier is the alias or the name of the table in the statement
+	qualifier string
+}
+
+type multiTableExecutor struct {
+	appid   string
+	conn    *driver.BackendConnection
+	refs    *ast.TableRefsClause
+	where   ast.ExprNode
+	targets func(ctx context.Context) ([]*multiTableTarget, error)
+	// args is nil if the statement is executed by COM_QUERY
+	args         map[string]interface{}
+	beforeImages []*schema.TableRecords
+}
+
+// IsMultiTableUpdate returns true if the update statement refers to several tables
+func IsMultiTableUpdate(stmt *ast.UpdateStmt) bool {
+	if stmt.TableRefs == nil || stmt.TableRefs.TableRefs == nil {
+		return false
+	}
+	join := stmt.TableRefs.TableRefs
+	if _, ok := join.Left.(*ast.Join); ok {
+		return true
+	}
+	return join.Right != nil
+}
+
+// IsMultiTableDelete returns true if the delete statement refers to several tables
+func IsMultiTableDelete(stmt *ast.DeleteStmt) bool {
+	return stmt.IsMultiTable
+}
+
+func NewQueryMultiUpdateExecutor(
+	appid string,
+	conn *driver.BackendConnection,
+	stmt *ast.UpdateStmt,
+	beforeImages []*schema.TableRecords) MultiTableExecutor {
+	return newMultiUpdateExecutor(appid, conn, stmt, nil, beforeImages)
+}
+
+func NewPrepareMultiUpdateExecutor(
+	appid string,
+	conn *driver.BackendConnection,
+	stmt *ast.UpdateStmt,
+	args map[string]interface{},
+	beforeImages []*schema.TableRecords) MultiTableExecutor {
+	return newMultiUpdateExecutor(appid, conn, stmt, args, beforeImages)
+}
+
+func NewQueryMultiDeleteExecutor(
+	appid string,
+	conn *driver.BackendConnection,
+	stmt *ast.DeleteStmt) MultiTableExecutor {
+	return newMultiDeleteExecutor(appid, conn, stmt, nil)
+}
+
+func NewPrepareMultiDeleteExecutor(
+	appid string,
+	conn *driver.BackendConnection,
+	stmt *ast.DeleteStmt,
+	args map[string]interface{}) MultiTableExecutor {
+	return newMultiDeleteExecutor(appid, conn, stmt, args)
+}
+
+func newMultiUpdateExecutor(appid string, conn *driver.BackendConnection, stmt *ast.UpdateStmt,
+	args map[string]interface{}, beforeImages []*schema.TableRecords) *multiTableExecutor {
+	executor := &multiTableExecutor{
+		appid:        appid,
+		conn:         conn,
+		refs:         stmt.TableRefs,
+		where:        stmt.Where,
+		args:         args,
+		beforeImages: beforeImages,
+	}
+	executor.targets = func(ctx context.Context) ([]*multiTableTarget, error) {
+		var targets []*multiTableTarget
+		for _, assignment := range stmt.List {
+			source, err := executor.resolveColumn(ctx, assignment.Column)
+			if err != nil {
+				return nil, err
+			}
+			targets = appendTarget(targets, source)
+		}
+		return targets, nil
+	}
+	return executor
+}
+
+func newMultiDeleteExecutor(appid string, conn *driver.BackendConnection, stmt *ast.DeleteStmt,
+	args map[string]interface{}) *multiTableExecutor {
+	executor := &multiTableExecutor{
+		appid: appid,
+		conn:  conn,
+		refs:  stmt.TableRefs,
+		where: stmt.Where,
+		args:  args,
+	}
+	executor.targets = func(ctx context.Context) ([]*multiTableTarget, error) {
+		var targets []*multiTableTarget
+		if stmt.Tables == nil {
+			return nil, nil
+		}
+		for _, table := range stmt.Tables.Tables {
+			source := executor.findSource(table.Name.L)
+			if source == nil {
+				return nil, errors.Errorf("unknown table '%s' in MULTI DELETE", table.Name.O)
+			}
+			targets = appendTarget(targets, source)
+		}
+		return targets, nil
+	}
+	return executor
+}
+
+func (executor *multiTableExecutor) BeforeImages(ctx context.Context) ([]*schema.TableRecords, error) {
+	spanCtx, span := tracing.GetTraceSpan(ctx, tracing.ExecutorFetchBeforeImage)
+	defer span.End()
+	targets, err := executor.targets(spanCtx)
+	if err != nil {
+		tracing.RecordErrorSpan(span, err)
+		return nil, err
+	}
+	images := make([]*schema.TableRecords, 0, len(targets))
+	for _, target := range targets {
+		tableMeta, err := executor.getTableMeta(spanCtx, target.tableName)
+		if err != nil {
+			tracing.RecordErrorSpan(span, err)
+			return nil, err
+		}
+		sql, args := executor.buildBeforeImageSql(tableMeta, target)
+		result, err := executor.query(spanCtx, sql, args)
+		if err != nil {
+			tracing.RecordErrorSpan(span, err)
+			return nil, err
+		}
+		images = append(images, distinctRecords(schema.BuildTableRecords(tableMeta, result), tableMeta))
+	}
+	return images, nil
+}
+
+func (executor *multiTableExecutor) AfterImages(ctx context.Context) ([]*schema.TableRecords, error) {
+	spanCtx, span := tracing.GetTraceSpan(ctx, tracing.ExecutorFetchAfterImage)
+	defer span.End()
+	images := make([]*schema.TableRecords, 0, len(executor.beforeImages))
+	for _, beforeImage := range executor.beforeImages {
+		if beforeImage == nil || len(beforeImage.Rows) == 0 {
+			images = append(images, nil)
+			continue
+		}
+		sql, args := executor.buildAfterImageSql(beforeImage)
+		result, err := executor.query(spanCtx, sql, args)
+		if err != nil {
+			tracing.RecordErrorSpan(span, err)
+			return nil, err
+		}
+		images = append(images, schema.BuildTableRecords(beforeImage.TableMeta, result))
+	}
+	return images, nil
+}
+
+func (executor *multiTableExecutor) getTableMeta(ctx context.Context, tableName string) (schema.TableMeta, error) {
+	dbName := executor.conn.DataSourceName()
+	db := resource.GetDBManager(executor.appid).GetDB(dbName)
+	return meta.GetTableMetaCache().GetTableMeta(ctx, db, tableName)
+}
+
+func (executor *multiTableExecutor) query(ctx context.Context, sql string, args []interface{}) (*mysql.Result, error) {
+	if executor.args == nil {
+		result, _, err := executor.conn.ExecuteWithWarningCount(ctx, sql, true)
+		return result, err
+	}
+	result, _, err := executor.conn.PrepareQueryArgs(ctx, sql, args)
+	return result, err
+}
+
+// buildBeforeImageSql selects the columns of the target table from the joined tables.
+func (executor *multiTableExecutor) buildBeforeImageSql(tableMeta schema.TableMeta, target *multiTableTarget) (string, []interface{}) {
+	var b strings.Builder
+	b.WriteString("SELECT ")
+	columnCount := len(tableMeta.Columns)
+	for i, column := range tableMeta.Columns {
+		b.WriteString(fmt.Sprintf("`%s`.%s", target.qualifier, misc.CheckAndReplace(column)))
+		if i < columnCount-1 {
+			b.WriteByte(',')
+		} else {
+			b.WriteByte(' ')
+		}
+	}
+	b.WriteString("FROM ")
+	if err := executor.refs.TableRefs.Restore(format.NewRestoreCtx(constant.DBPackRestoreFormat, &b)); err != nil {
+		log.Panic(err)
+	}
+	if executor.where != nil {
+		b.WriteString(" WHERE ")
+		if err := executor.where.Restore(format.NewRestoreCtx(constant.DBPackRestoreFormat, &b)); err != nil {
+			log.Panic(err)
+		}
+	}
+	b.WriteString(" FOR UPDATE")
+	return b.String(), executor.paramArgs(executor.refs.TableRefs, executor.where)
+}
+
+func (executor *multiTableExecutor) buildAfterImageSql(beforeImage *schema.TableRecords) (string, []interface{}) {
+	var b strings.Builder
+	tableMeta := beforeImage.TableMeta
+	b.WriteString("SELECT ")
+	columnCount := len(tableMeta.Columns)
+	for i, column := range tableMeta.Columns {
+		b.WriteString(misc.CheckAndReplace(column))
+		if i < columnCount-1 {
+			b.WriteByte(',')
+		} else {
+			b.WriteByte(' ')
+		}
+	}
+	b.WriteString(fmt.Sprintf("FROM %s ", beforeImage.TableName))
+	b.WriteString(fmt.Sprintf("WHERE %s IN ", tableMeta.GetPKColumns()))
+	if executor.args == nil {
+		b.WriteString(misc.MysqlAppendInRowParamWithValue(beforeImage.PKValues()))
+		return b.String(), nil
+	}
+	var args []interface{}
+	for _, field := range beforeImage.PKFields() {
+		args = append(args, field.Value)
+	}
+	b.WriteString(misc.MysqlAppendInRowParam(len(beforeImage.Rows), len(tableMeta.GetPrimaryKeyOnlyName())))
+	return b.String(), args
+}
+
+// paramArgs returns the arguments of the parameters in the nodes, in the order of the parameters
+// restored from the nodes.
+func (executor *multiTableExecutor) paramArgs(nodes ...ast.Node) []interface{} {
+	if executor.args == nil {
+		return nil
+	}
+	visitor := &paramCollector{}
+	for _, node := range nodes {
+		if node != nil {
+			node.Accept(visitor)
+		}
+	}
+	args := make([]interface{}, 0, len(visitor.params))
+	for _, param := range visitor.params {
+		args = append(args, executor.args[fmt.Sprintf("v%d", param.Order+1)])
+	}
+	return args
+}
+
+// resolveColumn returns the table source of the column, the column without qualifier
+// belongs to the only table has the column, it is ambiguous if several tables have it.
+func (executor *multiTableExecutor) resolveColumn(ctx context.Context, column *ast.ColumnName) (*ast.TableSource, error) {
+	if column.Table.L != "" {
+		source := executor.findSource(column.Table.L)
+		if source == nil {
+			return nil, errors.Errorf("unknown column '%s.%s' in 'field list'", column.Table.O, column.Name.O)
+		}
+		return source, nil
+	}
+	var result *ast.TableSource
+	for _, source := range tableSources(executor.refs.TableRefs, nil) {
+		tableMeta, err := executor.getTableMeta(ctx, restoreTableName(source))
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range tableMeta.Columns {
+			if strings.EqualFold(name, column.Name.O) {
+				if result != nil {
+					return nil, errors.Errorf("column '%s' in field list is ambiguous", column.Name.O)
+				}
+				result = source
+				break
+			}
+		}
+	}
+	if result == nil {
+		return nil, errors.Errorf("unknown column '%s' in 'field list'", column.Name.O)
+	}
+	return result, nil
+}
+
+func (executor *multiTableExecutor) findSource(qualifier string) *ast.TableSource {
+	for _, source := range tableSources(executor.refs.TableRefs, nil) {
+		if strings.EqualFold(sourceQualifier(source), qualifier) {
+			return source
+		}
+	}
+	return nil
+}
+
+// tableSources returns the tables of the join, the derived tables are skipped since they can not be modified.
+func tableSources(node ast.ResultSetNode, sources []*ast.TableSource) []*ast.TableSource {
+	switch n := node.(type) {
+	case *ast.Join:
+		sources = tableSources(n.Left, sources)
+		if n.Right != nil {
+			sources = tableSources(n.Right, sources)
+		}
+	case *ast.TableSource:
+		if _, ok := n.Source.(*ast.TableName); ok {
+			sources = append(sources, n)
+		}
+	}
+	return sources
+}
+
+func sourceQualifier(source *ast.TableSource) string {
+	if source.AsName.O != "" {
+		return source.AsName.O
+	}
+	return source.Source.(*ast.TableName).Name.O
+}
+
+func restoreTableName(source *ast.TableSource) string {
+	var sb strings.Builder
+	if err := source.Source.Restore(format.NewRestoreCtx(constant.DBPackRestoreFormat, &sb)); err != nil {
+		log.Panic(err)
+	}
+	return sb.String()
+}
+
+func appendTarget(targets []*multiTableTarget, source *ast.TableSource) []*multiTableTarget {
+	qualifier := sourceQualifier(source)
+	for _, target := range targets {
+		if strings.EqualFold(target.qualifier, qualifier) {
+			return targets
+		}
+	}
+	return append(targets, &multiTableTarget{
+		tableName: restoreTableName(source),
+		qualifier: qualifier,
+	})
+}
+
+// distinctRecords removes the duplicated rows, a row of the target table may be joined with several rows.
+func distinctRecords(records *schema.TableRecords, tableMeta schema.TableMeta) *schema.TableRecords {
+	if records == nil {
+		return schema.NewTableRecords(tableMeta)
+	}
+	exists := make(map[string]bool)
+	rows := make([]*schema.Row, 0, len(records.Rows))
+	for i, pk := range records.PKStrings() {
+		if !exists[pk] {
+			exists[pk] = true
+			rows = append(rows, records.Rows[i])
+		}
+	}
+	records.Rows = rows
+	return records
+}
+
+type paramCollector struct {
+	params []*driver2.ParamMarkerExpr
+}
+
+func (v *paramCollector) Enter(in ast.Node) (out ast.Node, skipChildren bool) {
+	if param, ok := in.(*driver2.ParamMarkerExpr); ok {
+		v.params = append(v.params, param)
+	}
+	return in, false
+}
+
+func (v *paramCollector) Leave(in ast.Node) (out ast.Node, ok bool) {
+	return in, true
+}
+
+// BuildMultiTableUndoItems builds an undo log for every modified table, the lock keys of the tables
+// are joined with semicolon, e.g. a:1,2;b:3.
+func BuildMultiTableUndoItems(
+	isBinary bool,
+	sqlType constant.SQLType,
+	schemaName string,
+	beforeImages, afterImages []*schema.TableRecords) (string, []*undolog.SqlUndoLog) {
+	var lockKeys []string
+	items := make([]*undolog.SqlUndoLog, 0, len(beforeImages))
+	for i, beforeImage := range beforeImages {
+		if beforeImage == nil || len(beforeImage.Rows) == 0 {
+			continue
+		}
+		var afterImage *schema.TableRecords
+		if i < len(afterImages) {
+			afterImage = afterImages[i]
+		}
+		lockKey := schema.BuildLockKey(beforeImage)
+		lockKeys = append(lockKeys, lockKey)
+		items = append(items, BuildUndoItem(isBinary, sqlType, schemaName, beforeImage.TableName, lockKey, beforeImage, afterImage))
+	}
+	return strings.Join(lockKeys, ";"), items
+}
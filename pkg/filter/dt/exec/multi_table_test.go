@@ -0,0 +1,159 @@
+/*
+ * Copyright 2022 CECTC, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package exec
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/agiledragon/gomonkey/v2"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/cectc/dbpack/pkg/constant"
+	"github.com/cectc/dbpack/pkg/driver"
+	"github.com/cectc/dbpack/pkg/dt/schema"
+	"github.com/cectc/dbpack/pkg/meta"
+	"github.com/cectc/dbpack/pkg/proto"
+	"github.com/cectc/dbpack/pkg/resource"
+	"github.com/cectc/dbpack/pkg/visitor"
+	"github.com/cectc/dbpack/testdata"
+	"github.com/cectc/dbpack/third_party/parser"
+	"github.com/cectc/dbpack/third_party/parser/ast"
+)
+
+func TestMultiTableUpdate(t *testing.T) {
+	stmt, err := parser.New().ParseOneStmt("update /*+ XID('gs/svc/1') */ t_order o join inventory i on o.sku = i.sku and i.id > ? "+
+		"set o.amount = ?, i.count = i.count - 1 where o.id = ?", "", "")
+	assert.Nil(t, err)
+	stmt.Accept(&visitor.ParamVisitor{})
+	updateStmt := stmt.(*ast.UpdateStmt)
+	assert.True(t, IsMultiTableUpdate(updateStmt))
+
+	executor := NewPrepareMultiUpdateExecutor("app1", &driver.BackendConnection{}, updateStmt, map[string]interface{}{
+		"v1": 0, "v2": 100, "v3": 10,
+	}, nil).(*multiTableExecutor)
+	targets, err := executor.targets(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(targets))
+	assert.Equal(t, &multiTableTarget{tableName: "`t_order`", qualifier: "o"}, targets[0])
+	assert.Equal(t, &multiTableTarget{tableName: "`inventory`", qualifier: "i"}, targets[1])
+
+	sql, args := executor.buildBeforeImageSql(upsertTableMeta, targets[1])
+	assert.Equal(t, "SELECT `i`.id,`i`.sku,`i`.count FROM `t_order` AS `o` JOIN `inventory` AS `i` "+
+		"ON `o`.`sku`=`i`.`sku` AND `i`.`id`>? WHERE `o`.`id`=? FOR UPDATE", sql)
+	assert.Equal(t, []interface{}{0, 10}, args)
+}
+
+func TestMultiTableUpdateColumns(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	manager := testdata.NewMockDBManager(ctrl)
+	manager.EXPECT().GetDB(gomock.Any()).AnyTimes().Return(nil)
+	resource.SetDBManager("app1", manager)
+
+	patches := gomonkey.ApplyMethod(reflect.TypeOf(&meta.MysqlTableMetaCache{}), "GetTableMeta",
+		func(_ *meta.MysqlTableMetaCache, ctx context.Context, db proto.DB, tableName string) (schema.TableMeta, error) {
+			if tableName == "`t_order`" {
+				return schema.TableMeta{TableName: "t_order", Columns: []string{"id", "sku", "amount", "remark"}}, nil
+			}
+			return schema.TableMeta{TableName: "inventory", Columns: []string{"id", "sku", "count", "remark"}}, nil
+		})
+	defer patches.Reset()
+
+	testCases := []struct {
+		set     string
+		targets []string
+		err     string
+	}{
+		{set: "amount = 1", targets: []string{"o"}},
+		{set: "amount = 1, count = count - 1", targets: []string{"o", "i"}},
+		{set: "i.remark = 'x'", targets: []string{"i"}},
+		{set: "remark = 'x'", err: "column 'remark' in field list is ambiguous"},
+		{set: "price = 1", err: "unknown column 'price' in 'field list'"},
+	}
+	for _, c := range testCases {
+		t.Run(c.set, func(t *testing.T) {
+			stmt, err := parser.New().ParseOneStmt("update t_order o join inventory i on o.sku = i.sku set "+c.set, "", "")
+			assert.Nil(t, err)
+			executor := NewQueryMultiUpdateExecutor("app1", &driver.BackendConnection{}, stmt.(*ast.UpdateStmt), nil).(*multiTableExecutor)
+			targets, err := executor.targets(context.Background())
+			if c.err != "" {
+				assert.EqualError(t, err, c.err)
+				return
+			}
+			assert.Nil(t, err)
+			qualifiers := make([]string, 0, len(targets))
+			for _, target := range targets {
+				qualifiers = append(qualifiers, target.qualifier)
+			}
+			assert.Equal(t, c.targets, qualifiers)
+		})
+	}
+}
+
+func TestMultiTableDelete(t *testing.T) {
+	stmt, err := parser.New().ParseOneStmt("delete o, i from t_order o join inventory i on o.sku = i.sku where o.id = 10", "", "")
+	assert.Nil(t, err)
+	deleteStmt := stmt.(*ast.DeleteStmt)
+	assert.True(t, IsMultiTableDelete(deleteStmt))
+
+	executor := NewQueryMultiDeleteExecutor("app1", &driver.BackendConnection{}, deleteStmt).(*multiTableExecutor)
+	targets, err := executor.targets(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"o", "i"}, []string{targets[0].qualifier, targets[1].qualifier})
+
+	sql, args := executor.buildBeforeImageSql(compositeTableMeta, targets[0])
+	assert.Equal(t, "SELECT `o`.tenant_id,`o`.order_no,`o`.amount FROM `t_order` AS `o` JOIN `inventory` AS `i` "+
+		"ON `o`.`sku`=`i`.`sku` WHERE `o`.`id`=10 FOR UPDATE", sql)
+	assert.Nil(t, args)
+}
+
+func TestBuildMultiTableUndoItems(t *testing.T) {
+	orders := &schema.TableRecords{TableMeta: compositeTableMeta, TableName: "`t_order`", Rows: []*schema.Row{{Fields: []*schema.Field{
+		{Name: "tenant_id", KeyType: schema.PrimaryKey, Value: int64(1)},
+		{Name: "order_no", KeyType: schema.PrimaryKey, Value: "a"},
+	}}}}
+	inventories := &schema.TableRecords{TableMeta: upsertTableMeta, TableName: "`inventory`", Rows: []*schema.Row{{Fields: []*schema.Field{
+		{Name: "id", KeyType: schema.PrimaryKey, Value: int64(3)},
+	}}}}
+	empty := schema.NewTableRecords(upsertTableMeta)
+
+	lockKey, undoLogs := BuildMultiTableUndoItems(false, constant.SQLType_DELETE, "db",
+		[]*schema.TableRecords{orders, empty, inventories}, nil)
+	assert.Equal(t, "`t_order`:1_a;`inventory`:3", lockKey)
+	assert.Equal(t, 2, len(undoLogs))
+	assert.Equal(t, "`t_order`", undoLogs[0].TableName)
+	assert.Equal(t, "`t_order`:1_a", undoLogs[0].LockKey)
+	assert.Equal(t, "`inventory`", undoLogs[1].TableName)
+}
+
+func TestDistinctRecords(t *testing.T) {
+	row := func(tenantID, orderNo string) *schema.Row {
+		return &schema.Row{Fields: []*schema.Field{
+			{Name: "tenant_id", KeyType: schema.PrimaryKey, Value: tenantID},
+			{Name: "order_no", KeyType: schema.PrimaryKey, Value: orderNo},
+		}}
+	}
+	records := &schema.TableRecords{TableMeta: compositeTableMeta, TableName: "`t_order`", Rows: []*schema.Row{
+		row("a_b", "c"), row("a", "b_c"), row("a_b", "c"),
+	}}
+	records = distinctRecords(records, compositeTableMeta)
+	assert.Equal(t, 2, len(records.Rows))
+	assert.Equal(t, "a", records.Rows[1].Fields[0].Value)
+}
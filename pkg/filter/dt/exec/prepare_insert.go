@@ -22,6 +22,8 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/pkg/errors"
+
 	"github.com/cectc/dbpack/pkg/constant"
 	"github.com/cectc/dbpack/pkg/driver"
 	"github.com/cectc/dbpack/pkg/dt/schema"
@@ -72,11 +74,13 @@ func (executor *prepareInsertExecutor) AfterImage(ctx context.Context) (*schema.
 		tracing.RecordErrorSpan(span, err)
 		return nil, err
 	}
-	if executor.getPKIndex(ctx) >= 0 {
+	if pkValues != nil {
 		afterImage, err = executor.buildTableRecords(spanCtx, pkValues)
-	} else {
+	} else if len(executor.getPKIndexes(ctx)) == 1 {
 		pk, _ := executor.result.LastInsertId()
-		afterImage, err = executor.buildTableRecords(spanCtx, []interface{}{pk})
+		afterImage, err = executor.buildTableRecords(spanCtx, [][]interface{}{{pk}})
+	} else {
+		err = errors.Errorf("all the columns of the composite primary key of table %s must be specified", executor.GetTableName())
 	}
 	if err != nil {
 		tracing.RecordErrorSpan(span, err)
@@ -99,21 +103,25 @@ func (executor *prepareInsertExecutor) GetTableName() string {
 	return sb.String()
 }
 
-func (executor *prepareInsertExecutor) buildTableRecords(ctx context.Context, pkValues []interface{}) (*schema.TableRecords, error) {
+func (executor *prepareInsertExecutor) buildTableRecords(ctx context.Context, pkValues [][]interface{}) (*schema.TableRecords, error) {
 	tableMeta, err := executor.GetTableMeta(ctx)
 	if err != nil {
 		return nil, err
 	}
 
+	var args []interface{}
+	for _, values := range pkValues {
+		args = append(args, values...)
+	}
 	afterImageSql := executor.buildAfterImageSql(tableMeta, pkValues)
-	result, _, err := executor.conn.PrepareQueryArgs(ctx, afterImageSql, pkValues)
+	result, _, err := executor.conn.PrepareQueryArgs(ctx, afterImageSql, args)
 	if err != nil {
 		return nil, err
 	}
 	return schema.BuildTableRecords(tableMeta, result), nil
 }
 
-func (executor *prepareInsertExecutor) buildAfterImageSql(tableMeta schema.TableMeta, pkValues []interface{}) string {
+func (executor *prepareInsertExecutor) buildAfterImageSql(tableMeta schema.TableMeta, pkValues [][]interface{}) string {
 	var b strings.Builder
 	b.WriteString("SELECT ")
 	columnCount := len(tableMeta.Columns)
@@ -126,49 +134,52 @@ func (executor *prepareInsertExecutor) buildAfterImageSql(tableMeta schema.Table
 		}
 	}
 	b.WriteString(fmt.Sprintf("FROM %s ", executor.GetTableName()))
-	b.WriteString(fmt.Sprintf("WHERE `%s` IN ", tableMeta.GetPKName()))
-	b.WriteString(misc.MysqlAppendInParam(len(pkValues)))
+	b.WriteString(fmt.Sprintf("WHERE %s IN ", tableMeta.GetPKColumns()))
+	b.WriteString(misc.MysqlAppendInRowParam(len(pkValues), len(tableMeta.GetPrimaryKeyOnlyName())))
 	return b.String()
 }
 
-func (executor *prepareInsertExecutor) getPKValuesByColumn(ctx context.Context) ([]interface{}, error) {
-	pkValues := make([]interface{}, 0)
+// getPKValuesByColumn returns the primary key values of every inserted row, nil is returned
+// if any column of the primary key is not specified.
+func (executor *prepareInsertExecutor) getPKValuesByColumn(ctx context.Context) ([][]interface{}, error) {
 	columnLen := executor.getColumnLen(ctx)
-	pkIndex := executor.getPKIndex(ctx)
+	pkIndexes := executor.getPKIndexes(ctx)
+	for _, pkIndex := range pkIndexes {
+		if pkIndex < 0 {
+			return nil, nil
+		}
+	}
+	pkValues := make([][]interface{}, len(executor.stmt.Lists))
+	for i := range pkValues {
+		pkValues[i] = make([]interface{}, len(pkIndexes))
+	}
 	for key, value := range executor.args {
 		i, err := strconv.Atoi(key[1:])
 		if err != nil {
 			return nil, err
 		}
-		if i%columnLen == pkIndex+1 {
-			pkValues = append(pkValues, value)
+		row, column := (i-1)/columnLen, (i-1)%columnLen
+		if row >= len(pkValues) {
+			continue
+		}
+		for j, pkIndex := range pkIndexes {
+			if column == pkIndex {
+				pkValues[row][j] = value
+			}
 		}
 	}
 	return pkValues, nil
 }
 
-func (executor *prepareInsertExecutor) getPKIndex(ctx context.Context) int {
-	insertColumns := executor.GetInsertColumns()
-	tableMeta, _ := executor.GetTableMeta(ctx)
-
-	for i, columnName := range insertColumns {
-		if strings.EqualFold(tableMeta.GetPKName(), columnName) {
-			return i
-		}
-	}
-
-	allColumns := tableMeta.Columns
-	for i, column := range allColumns {
-		if strings.EqualFold(tableMeta.GetPKName(), column) {
-			return i
-		}
-	}
-	return -1
+// getPKIndexes returns the index of every primary key column in the inserted columns, -1 if
+// the column is not specified.
+func (executor *prepareInsertExecutor) getPKIndexes(ctx context.Context) []int {
+	return getPKIndexes(ctx, executor, executor.GetInsertColumns())
 }
 
 func (executor *prepareInsertExecutor) getColumnLen(ctx context.Context) int {
 	insertColumns := executor.GetInsertColumns()
-	if insertColumns != nil {
+	if len(insertColumns) > 0 {
 		return len(insertColumns)
 	}
 	tableMeta, _ := executor.GetTableMeta(ctx)
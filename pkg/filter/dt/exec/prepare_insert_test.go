@@ -17,11 +17,14 @@
 package exec
 
 import (
+	"context"
 	"testing"
 
+	"github.com/agiledragon/gomonkey/v2"
 	"github.com/stretchr/testify/assert"
 
 	"github.com/cectc/dbpack/pkg/driver"
+	"github.com/cectc/dbpack/pkg/dt/schema"
 	"github.com/cectc/dbpack/pkg/visitor"
 	"github.com/cectc/dbpack/third_party/parser"
 	"github.com/cectc/dbpack/third_party/parser/ast"
@@ -63,8 +66,29 @@ func TestPrepareInsert(t *testing.T) {
 			assert.Equal(t, c.expectedTableName, tableName)
 			insertColumns := executor.(*prepareInsertExecutor).GetInsertColumns()
 			assert.Equal(t, c.expectedInsertColumns, insertColumns)
-			afterImageSql := executor.(*prepareInsertExecutor).buildAfterImageSql(tableMeta, []interface{}{10})
+			afterImageSql := executor.(*prepareInsertExecutor).buildAfterImageSql(tableMeta, [][]interface{}{{10}})
 			assert.Equal(t, c.expectedAfterImageSql, afterImageSql)
 		})
 	}
 }
+
+func TestPrepareInsertWithCompositePK(t *testing.T) {
+	stmt, err := parser.New().ParseOneStmt("insert into t_order(amount, tenant_id, order_no) values (?, ?, ?), (?, ?, ?)", "", "")
+	assert.Nil(t, err)
+	stmt.Accept(&visitor.ParamVisitor{})
+
+	executor := NewPrepareInsertExecutor("app1", &driver.BackendConnection{}, stmt.(*ast.InsertStmt), map[string]interface{}{
+		"v1": 10, "v2": 1, "v3": "a",
+		"v4": 20, "v5": 1, "v6": "b",
+	}, nil)
+	patches := gomonkey.ApplyMethodFunc(executor, "GetTableMeta", func(ctx context.Context) (schema.TableMeta, error) {
+		return compositeTableMeta, nil
+	})
+	defer patches.Reset()
+
+	pkValues, err := executor.(*prepareInsertExecutor).getPKValuesByColumn(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, [][]interface{}{{1, "a"}, {1, "b"}}, pkValues)
+	afterImageSql := executor.(*prepareInsertExecutor).buildAfterImageSql(compositeTableMeta, pkValues)
+	assert.Equal(t, "SELECT tenant_id,order_no,amount FROM `t_order` WHERE (`tenant_id`,`order_no`) IN ((?,?),(?,?))", afterImageSql)
+}
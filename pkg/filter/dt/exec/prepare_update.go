@@ -153,8 +153,8 @@ func (executor *prepareUpdateExecutor) buildAfterImageSql(tableMeta schema.Table
 		}
 	}
 	b.WriteString(fmt.Sprintf("FROM %s ", executor.GetTableName()))
-	b.WriteString(fmt.Sprintf("WHERE `%s` IN ", tableMeta.GetPKName()))
-	b.WriteString(misc.MysqlAppendInParam(len(executor.beforeImage.PKFields())))
+	b.WriteString(fmt.Sprintf("WHERE %s IN ", tableMeta.GetPKColumns()))
+	b.WriteString(misc.MysqlAppendInRowParam(len(executor.beforeImage.Rows), len(tableMeta.GetPrimaryKeyOnlyName())))
 	return b.String()
 }
 
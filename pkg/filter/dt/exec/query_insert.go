@@ -21,6 +21,8 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/pkg/errors"
+
 	"github.com/cectc/dbpack/pkg/constant"
 	"github.com/cectc/dbpack/pkg/driver"
 	"github.com/cectc/dbpack/pkg/dt/schema"
@@ -61,7 +63,7 @@ func (executor *queryInsertExecutor) BeforeImage(ctx context.Context) (*schema.T
 func (executor *queryInsertExecutor) AfterImage(ctx context.Context) (*schema.TableRecords, error) {
 	var (
 		afterImage *schema.TableRecords
-		pkValues   []interface{}
+		pkValues   [][]interface{}
 		err        error
 	)
 	spanCtx, span := tracing.GetTraceSpan(ctx, tracing.ExecutorFetchAfterImage)
@@ -72,11 +74,13 @@ func (executor *queryInsertExecutor) AfterImage(ctx context.Context) (*schema.Ta
 		tracing.RecordErrorSpan(span, err)
 		return nil, err
 	}
-	if executor.getPKIndex(spanCtx) >= 0 {
+	if pkValues != nil {
 		afterImage, err = executor.buildTableRecords(spanCtx, pkValues)
-	} else {
+	} else if len(executor.getPKIndexes(spanCtx)) == 1 {
 		pk, _ := executor.result.LastInsertId()
-		afterImage, err = executor.buildTableRecords(spanCtx, []interface{}{pk})
+		afterImage, err = executor.buildTableRecords(spanCtx, [][]interface{}{{pk}})
+	} else {
+		err = errors.Errorf("all the columns of the composite primary key of table %s must be specified", executor.GetTableName())
 	}
 	if err != nil {
 		tracing.RecordErrorSpan(span, err)
@@ -85,7 +89,7 @@ func (executor *queryInsertExecutor) AfterImage(ctx context.Context) (*schema.Ta
 	return afterImage, nil
 }
 
-func (executor *queryInsertExecutor) buildTableRecords(ctx context.Context, pkValues []interface{}) (*schema.TableRecords, error) {
+func (executor *queryInsertExecutor) buildTableRecords(ctx context.Context, pkValues [][]interface{}) (*schema.TableRecords, error) {
 	tableMeta, err := executor.GetTableMeta(ctx)
 	if err != nil {
 		return nil, err
@@ -99,7 +103,7 @@ func (executor *queryInsertExecutor) buildTableRecords(ctx context.Context, pkVa
 	return schema.BuildTableRecords(tableMeta, result), nil
 }
 
-func (executor *queryInsertExecutor) buildAfterImageSql(tableMeta schema.TableMeta, pkValues []interface{}) string {
+func (executor *queryInsertExecutor) buildAfterImageSql(tableMeta schema.TableMeta, pkValues [][]interface{}) string {
 	var b strings.Builder
 	b.WriteString("SELECT ")
 	columnCount := len(tableMeta.Columns)
@@ -112,8 +116,8 @@ func (executor *queryInsertExecutor) buildAfterImageSql(tableMeta schema.TableMe
 		}
 	}
 	b.WriteString(fmt.Sprintf("FROM %s ", executor.GetTableName()))
-	b.WriteString(fmt.Sprintf("WHERE `%s` IN ", tableMeta.GetPKName()))
-	b.WriteString(misc.MysqlAppendInParamWithValue(pkValues))
+	b.WriteString(fmt.Sprintf("WHERE %s IN ", tableMeta.GetPKColumns()))
+	b.WriteString(misc.MysqlAppendInRowParamWithValue(pkValues))
 	return b.String()
 }
 
@@ -131,47 +135,40 @@ func (executor *queryInsertExecutor) GetTableName() string {
 	return sb.String()
 }
 
-func (executor *queryInsertExecutor) getPKValuesByColumn(ctx context.Context) ([]interface{}, error) {
-	pkValues := make([]interface{}, 0)
-	pkIndex := executor.getPKIndex(ctx)
-	for j := range executor.stmt.Lists {
-		for i, value := range executor.stmt.Lists[j] {
-			if i == pkIndex {
-				var sb strings.Builder
-				if err := value.Restore(format.NewRestoreCtx(constant.DBPackRestoreFormat, &sb)); err != nil {
-					log.Panic(err)
-				}
-				pkValues = append(pkValues, sb.String())
-				break
+// getPKValuesByColumn returns the primary key values of every inserted row, nil is returned
+// if any column of the primary key is not specified.
+func (executor *queryInsertExecutor) getPKValuesByColumn(ctx context.Context) ([][]interface{}, error) {
+	pkIndexes := executor.getPKIndexes(ctx)
+	for _, pkIndex := range pkIndexes {
+		if pkIndex < 0 {
+			return nil, nil
+		}
+	}
+	pkValues := make([][]interface{}, 0, len(executor.stmt.Lists))
+	for _, row := range executor.stmt.Lists {
+		values := make([]interface{}, 0, len(pkIndexes))
+		for _, pkIndex := range pkIndexes {
+			if pkIndex >= len(row) {
+				return nil, errors.Errorf("column count doesn't match value count")
+			}
+			var sb strings.Builder
+			if err := row[pkIndex].Restore(format.NewRestoreCtx(constant.DBPackRestoreFormat, &sb)); err != nil {
+				log.Panic(err)
 			}
+			values = append(values, misc.SQLExpr(sb.String()))
 		}
+		pkValues = append(pkValues, values)
 	}
-
 	return pkValues, nil
 }
 
-func (executor *queryInsertExecutor) getPKIndex(ctx context.Context) int {
-	insertColumns := executor.GetInsertColumns()
-	tableMeta, _ := executor.GetTableMeta(ctx)
-
-	for i, columnName := range insertColumns {
-		if strings.EqualFold(tableMeta.GetPKName(), columnName) {
-			return i
-		}
-	}
-
-	allColumns := tableMeta.Columns
-	for i, column := range allColumns {
-		if strings.EqualFold(tableMeta.GetPKName(), column) {
-			return i
-		}
-	}
-	return -1
+func (executor *queryInsertExecutor) getPKIndexes(ctx context.Context) []int {
+	return getPKIndexes(ctx, executor, executor.GetInsertColumns())
 }
 
 func (executor *queryInsertExecutor) getColumnLen(ctx context.Context) int {
 	insertColumns := executor.GetInsertColumns()
-	if insertColumns != nil {
+	if len(insertColumns) > 0 {
 		return len(insertColumns)
 	}
 	tableMeta, _ := executor.GetTableMeta(ctx)
@@ -59,7 +59,7 @@ func TestQueryInsert(t *testing.T) {
 			assert.Equal(t, c.expectedTableName, tableName)
 			insertColumns := executor.(*queryInsertExecutor).GetInsertColumns()
 			assert.Equal(t, c.expectedInsertColumns, insertColumns)
-			afterImageSql := executor.(*queryInsertExecutor).buildAfterImageSql(tableMeta, []interface{}{10})
+			afterImageSql := executor.(*queryInsertExecutor).buildAfterImageSql(tableMeta, [][]interface{}{{10}})
 			assert.Equal(t, c.expectedAfterImageSql, afterImageSql)
 		})
 	}
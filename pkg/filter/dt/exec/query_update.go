@@ -136,22 +136,8 @@ func (executor *queryUpdateExecutor) buildAfterImageSql(tableMeta schema.TableMe
 		}
 	}
 	b.WriteString(fmt.Sprintf("FROM %s ", executor.GetTableName()))
-	b.WriteString(fmt.Sprintf("WHERE `%s` IN (", tableMeta.GetPKName()))
-	pkFields := executor.beforeImage.PKFields()
-	for i, field := range pkFields {
-		switch val := field.Value.(type) {
-		case string:
-			b.WriteString(fmt.Sprintf("'%s'", val))
-		case []byte:
-			b.WriteString(fmt.Sprintf("'%s'", val))
-		default:
-			b.WriteString(fmt.Sprintf("%v", val))
-		}
-		if i < len(pkFields)-1 {
-			b.WriteByte(',')
-		}
-	}
-	b.WriteByte(')')
+	b.WriteString(fmt.Sprintf("WHERE %s IN ", tableMeta.GetPKColumns()))
+	b.WriteString(misc.MysqlAppendInRowParamWithValue(executor.beforeImage.PKValues()))
 	return b.String()
 }
 
@@ -96,3 +96,40 @@ func TestQueryUpdate(t *testing.T) {
 		})
 	}
 }
+
+var compositeTableMeta = schema.TableMeta{
+	SchemaName: "db",
+	TableName:  "t_order",
+	Columns:    []string{"tenant_id", "order_no", "amount"},
+	AllIndexes: map[string]schema.IndexMeta{
+		"PRIMARY": {
+			Values: []schema.ColumnMeta{
+				{TableName: "t_order", ColumnName: "tenant_id"},
+				{TableName: "t_order", ColumnName: "order_no"},
+			},
+			IndexName: "PRIMARY",
+			IndexType: schema.IndexTypePrimary,
+		},
+	},
+}
+
+func TestQueryUpdateWithCompositePK(t *testing.T) {
+	stmt, err := parser.New().ParseOneStmt("update t_order set amount = 10 where tenant_id = 1", "", "")
+	assert.Nil(t, err)
+	row := func(tenantID int64, orderNo string) *schema.Row {
+		return &schema.Row{Fields: []*schema.Field{
+			{Name: "tenant_id", KeyType: schema.PrimaryKey, Value: tenantID},
+			{Name: "order_no", KeyType: schema.PrimaryKey, Value: []byte(orderNo)},
+			{Name: "amount", KeyType: schema.Null, Value: int64(20)},
+		}}
+	}
+	beforeImage := &schema.TableRecords{
+		TableMeta: compositeTableMeta,
+		TableName: "t_order",
+		Rows:      []*schema.Row{row(1, "a"), row(1, "b'), (2, 'c")},
+	}
+	executor := NewQueryUpdateExecutor("app1", &driver.BackendConnection{}, stmt.(*ast.UpdateStmt), beforeImage)
+	afterImageSql := executor.(*queryUpdateExecutor).buildAfterImageSql(compositeTableMeta)
+	assert.Equal(t, "SELECT tenant_id,order_no,amount FROM `t_order` WHERE (`tenant_id`,`order_no`) IN ((1,'a'),(1,'b''), (2, ''c'))", afterImageSql)
+	assert.Equal(t, "t_order:1_a,1_b'), (2, 'c", schema.BuildLockKey(beforeImage))
+}
@@ -0,0 +1,372 @@
+/*
+ * Copyright 2022 CECTC, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package exec
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/cectc/dbpack/pkg/constant"
+	"github.com/cectc/dbpack/pkg/driver"
+	"github.com/cectc/dbpack/pkg/dt/schema"
+	"github.com/cectc/dbpack/pkg/dt/undolog"
+	"github.com/cectc/dbpack/pkg/log"
+	"github.com/cectc/dbpack/pkg/meta"
+	"github.com/cectc/dbpack/pkg/misc"
+	"github.com/cectc/dbpack/pkg/mysql"
+	"github.com/cectc/dbpack/pkg/proto"
+	"github.com/cectc/dbpack/pkg/resource"
+	"github.com/cectc/dbpack/pkg/tracing"
+	"github.com/cectc/dbpack/third_party/parser/ast"
+	"github.com/cectc/dbpack/third_party/parser/format"
+	driver2 "github.com/cectc/dbpack/third_party/types/parser_driver"
+)
+
+// sqlLiteral is a value restored from the statement, it is written into the sql as it is
+type sqlLiteral string
+
+// upsertExecutor builds the images of INSERT ... ON DUPLICATE KEY UPDATE and REPLACE. The rows
+// conflict with the inserted rows on the primary key or any unique key are looked up as the
+// before image, they are updated by ON DUPLICATE KEY UPDATE, or deleted by REPLACE.
+type upsertExecutor struct {
+	appid string
+	conn  *driver.BackendConnection
+	stmt  *ast.InsertStmt
+	// args is nil if the statement is executed by COM_QUERY
+	args        map[string]interface{}
+	result      proto.Result
+	beforeImage *schema.TableRecords
+}
+
+func NewQueryUpsertExecutor(
+	appid string,
+	conn *driver.BackendConnection,
+	stmt *ast.InsertStmt,
+	result proto.Result,
+	beforeImage *schema.TableRecords) Executor {
+	return &upsertExecutor{
+		appid:       appid,
+		conn:        conn,
+		stmt:        stmt,
+		result:      result,
+		beforeImage: beforeImage,
+	}
+}
+
+func NewPrepareUpsertExecutor(
+	appid string,
+	conn *driver.BackendConnection,
+	stmt *ast.InsertStmt,
+	args map[string]interface{},
+	result proto.Result,
+	beforeImage *schema.TableRecords) Executor {
+	return &upsertExecutor{
+		appid:       appid,
+		conn:        conn,
+		stmt:        stmt,
+		args:        args,
+		result:      result,
+		beforeImage: beforeImage,
+	}
+}
+
+// IsUpsert returns true if the insert statement may update or delete the existing rows
+func IsUpsert(stmt *ast.InsertStmt) bool {
+	return stmt.IsReplace || len(stmt.OnDuplicate) > 0
+}
+
+func (executor *upsertExecutor) BeforeImage(ctx context.Context) (*schema.TableRecords, error) {
+	spanCtx, span := tracing.GetTraceSpan(ctx, tracing.ExecutorFetchBeforeImage)
+	defer span.End()
+	tableMeta, err := executor.GetTableMeta(spanCtx)
+	if err != nil {
+		tracing.RecordErrorSpan(span, err)
+		return nil, err
+	}
+	condition, args := executor.buildUniqueKeyCondition(tableMeta)
+	if condition == "" {
+		return nil, nil
+	}
+	sql := executor.buildSelectSql(tableMeta, condition) + " FOR UPDATE"
+	result, err := executor.query(spanCtx, sql, args)
+	if err != nil {
+		tracing.RecordErrorSpan(span, err)
+		return nil, err
+	}
+	return schema.BuildTableRecords(tableMeta, result), nil
+}
+
+func (executor *upsertExecutor) AfterImage(ctx context.Context) (*schema.TableRecords, error) {
+	spanCtx, span := tracing.GetTraceSpan(ctx, tracing.ExecutorFetchAfterImage)
+	defer span.End()
+	tableMeta, err := executor.GetTableMeta(spanCtx)
+	if err != nil {
+		tracing.RecordErrorSpan(span, err)
+		return nil, err
+	}
+	condition, args := executor.buildUniqueKeyCondition(tableMeta)
+	if condition == "" {
+		// no unique key is specified, the statement can only insert rows
+		if executor.args == nil {
+			return NewQueryInsertExecutor(executor.appid, executor.conn, executor.stmt, executor.result).AfterImage(ctx)
+		}
+		return NewPrepareInsertExecutor(executor.appid, executor.conn, executor.stmt, executor.args, executor.result).AfterImage(ctx)
+	}
+	// the updated rows may have changed their unique keys, they are found by the primary keys
+	if executor.beforeImage != nil && len(executor.beforeImage.Rows) > 0 {
+		pkValues := executor.beforeImage.PKValues()
+		if executor.args == nil {
+			condition = fmt.Sprintf("%s OR %s IN %s", condition, tableMeta.GetPKColumns(),
+				misc.MysqlAppendInRowParamWithValue(pkValues))
+		} else {
+			condition = fmt.Sprintf("%s OR %s IN %s", condition, tableMeta.GetPKColumns(),
+				misc.MysqlAppendInRowParam(len(pkValues), len(tableMeta.GetPrimaryKeyOnlyName())))
+			for _, values := range pkValues {
+				args = append(args, values...)
+			}
+		}
+	}
+	result, err := executor.query(spanCtx, executor.buildSelectSql(tableMeta, condition), args)
+	if err != nil {
+		tracing.RecordErrorSpan(span, err)
+		return nil, err
+	}
+	return schema.BuildTableRecords(tableMeta, result), nil
+}
+
+func (executor *upsertExecutor) GetTableMeta(ctx context.Context) (schema.TableMeta, error) {
+	dbName := executor.conn.DataSourceName()
+	db := resource.GetDBManager(executor.appid).GetDB(dbName)
+	return meta.GetTableMetaCache().GetTableMeta(ctx, db, executor.GetTableName())
+}
+
+func (executor *upsertExecutor) GetTableName() string {
+	var sb strings.Builder
+	if err := executor.stmt.Table.TableRefs.Left.Restore(format.NewRestoreCtx(constant.DBPackRestoreFormat, &sb)); err != nil {
+		log.Panic(err)
+	}
+	return sb.String()
+}
+
+func (executor *upsertExecutor) query(ctx context.Context, sql string, args []interface{}) (*mysql.Result, error) {
+	if executor.args == nil {
+		result, _, err := executor.conn.ExecuteWithWarningCount(ctx, sql, true)
+		return result, err
+	}
+	result, _, err := executor.conn.PrepareQueryArgs(ctx, sql, args)
+	return result, err
+}
+
+func (executor *upsertExecutor) buildSelectSql(tableMeta schema.TableMeta, condition string) string {
+	var b strings.Builder
+	b.WriteString("SELECT ")
+	columnCount := len(tableMeta.Columns)
+	for i, column := range tableMeta.Columns {
+		b.WriteString(misc.CheckAndReplace(column))
+		if i < columnCount-1 {
+			b.WriteByte(',')
+		} else {
+			b.WriteByte(' ')
+		}
+	}
+	b.WriteString(fmt.Sprintf("FROM %s WHERE %s", executor.GetTableName(), condition))
+	return b.String()
+}
+
+// buildUniqueKeyCondition builds the condition matches the rows conflict with the inserted rows,
+// e.g. (`id` = 1) OR (`tenant_id` = 1 AND `sku` = 'a'). The unique keys contain NULL are skipped,
+// since NULL never conflicts.
+func (executor *upsertExecutor) buildUniqueKeyCondition(tableMeta schema.TableMeta) (string, []interface{}) {
+	var (
+		conditions []string
+		args       []interface{}
+	)
+	columns := executor.getInsertColumns(tableMeta)
+	rows := executor.getInsertValues()
+	for _, uniqueKey := range uniqueKeys(tableMeta) {
+		indexes := make([]int, 0, len(uniqueKey))
+		for _, key := range uniqueKey {
+			for i, column := range columns {
+				if strings.EqualFold(key, column) {
+					indexes = append(indexes, i)
+					break
+				}
+			}
+		}
+		if len(indexes) < len(uniqueKey) {
+			continue
+		}
+	rowLoop:
+		for _, row := range rows {
+			var (
+				sb      strings.Builder
+				keyArgs []interface{}
+			)
+			sb.WriteByte('(')
+			for i, index := range indexes {
+				if index >= len(row) || isNullValue(row[index]) {
+					continue rowLoop
+				}
+				if i > 0 {
+					sb.WriteString(" AND ")
+				}
+				if literal, ok := row[index].(sqlLiteral); ok {
+					sb.WriteString(fmt.Sprintf("`%s` = %s", uniqueKey[i], literal))
+				} else {
+					sb.WriteString(fmt.Sprintf("`%s` = ?", uniqueKey[i]))
+					keyArgs = append(keyArgs, row[index])
+				}
+			}
+			sb.WriteByte(')')
+			conditions = append(conditions, sb.String())
+			args = append(args, keyArgs...)
+		}
+	}
+	return strings.Join(conditions, " OR "), args
+}
+
+func (executor *upsertExecutor) getInsertColumns(tableMeta schema.TableMeta) []string {
+	if len(executor.stmt.Columns) == 0 {
+		return tableMeta.Columns
+	}
+	columns := make([]string, 0, len(executor.stmt.Columns))
+	for _, col := range executor.stmt.Columns {
+		columns = append(columns, col.Name.String())
+	}
+	return columns
+}
+
+// getInsertValues returns the values of the inserted rows, the parameters are replaced
+// with the arguments, and the other expressions are restored as sqlLiteral.
+func (executor *upsertExecutor) getInsertValues() [][]interface{} {
+	rows := make([][]interface{}, 0, len(executor.stmt.Lists))
+	for _, list := range executor.stmt.Lists {
+		row := make([]interface{}, 0, len(list))
+		for _, expr := range list {
+			if param, ok := expr.(*driver2.ParamMarkerExpr); ok && executor.args != nil {
+				row = append(row, executor.args[fmt.Sprintf("v%d", param.Order+1)])
+				continue
+			}
+			var sb strings.Builder
+			if err := expr.Restore(format.NewRestoreCtx(constant.DBPackRestoreFormat, &sb)); err != nil {
+				log.Panic(err)
+			}
+			row = append(row, sqlLiteral(sb.String()))
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func isNullValue(value interface{}) bool {
+	if literal, ok := value.(sqlLiteral); ok {
+		return strings.EqualFold(string(literal), "NULL")
+	}
+	return value == nil
+}
+
+// uniqueKeys returns the columns of the primary key and the unique keys, the primary key is the first.
+func uniqueKeys(tableMeta schema.TableMeta) [][]string {
+	keys := [][]string{tableMeta.GetPrimaryKeyOnlyName()}
+	names := make([]string, 0)
+	for name, index := range tableMeta.AllIndexes {
+		if index.IndexType == schema.IndexTypeUnique {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		index := tableMeta.AllIndexes[name]
+		columns := make([]string, 0, len(index.Values))
+		for _, column := range index.Values {
+			columns = append(columns, column.ColumnName)
+		}
+		keys = append(keys, columns)
+	}
+	return keys
+}
+
+// BuildUpsertUndoItems splits the images of an upsert into the undo logs of the deleted, updated and
+// inserted rows, the rows are told apart by their primary keys. The undo logs are rolled back in the
+// reverse order, so the inserted rows are deleted before the deleted rows are restored, the unique keys
+// of them may be the same.
+func BuildUpsertUndoItems(
+	isBinary bool,
+	schemaName, tableName string,
+	beforeImage, afterImage *schema.TableRecords) (string, []*undolog.SqlUndoLog) {
+	var (
+		tableMeta schema.TableMeta
+		deleted   *schema.TableRecords
+		updated   *schema.TableRecords
+		inserted  *schema.TableRecords
+		lockRows  *schema.TableRecords
+	)
+	if beforeImage != nil {
+		tableMeta = beforeImage.TableMeta
+	} else if afterImage != nil {
+		tableMeta = afterImage.TableMeta
+	} else {
+		return "", nil
+	}
+	deleted, updated, inserted, lockRows = schema.NewTableRecords(tableMeta), schema.NewTableRecords(tableMeta),
+		schema.NewTableRecords(tableMeta), schema.NewTableRecords(tableMeta)
+	updatedAfter := schema.NewTableRecords(tableMeta)
+
+	afterRows := make(map[string]*schema.Row)
+	if afterImage != nil {
+		for i, pk := range afterImage.PKStrings() {
+			afterRows[pk] = afterImage.Rows[i]
+		}
+	}
+	beforeRows := make(map[string]bool)
+	if beforeImage != nil {
+		for i, pk := range beforeImage.PKStrings() {
+			beforeRows[pk] = true
+			row := beforeImage.Rows[i]
+			lockRows.Rows = append(lockRows.Rows, row)
+			if afterRow, ok := afterRows[pk]; ok {
+				updated.Rows = append(updated.Rows, row)
+				updatedAfter.Rows = append(updatedAfter.Rows, afterRow)
+			} else {
+				deleted.Rows = append(deleted.Rows, row)
+			}
+		}
+	}
+	if afterImage != nil {
+		for i, pk := range afterImage.PKStrings() {
+			if !beforeRows[pk] {
+				inserted.Rows = append(inserted.Rows, afterImage.Rows[i])
+				lockRows.Rows = append(lockRows.Rows, afterImage.Rows[i])
+			}
+		}
+	}
+
+	lockKey := schema.BuildLockKey(lockRows)
+	items := make([]*undolog.SqlUndoLog, 0, 3)
+	if len(deleted.Rows) > 0 {
+		items = append(items, BuildUndoItem(isBinary, constant.SQLType_DELETE, schemaName, tableName, lockKey, deleted, nil))
+	}
+	if len(updated.Rows) > 0 {
+		items = append(items, BuildUndoItem(isBinary, constant.SQLType_UPDATE, schemaName, tableName, lockKey, updated, updatedAfter))
+	}
+	if len(inserted.Rows) > 0 {
+		items = append(items, BuildUndoItem(isBinary, constant.SQLType_INSERT, schemaName, tableName, lockKey, nil, inserted))
+	}
+	return lockKey, items
+}
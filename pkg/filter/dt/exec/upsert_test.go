@@ -0,0 +1,125 @@
+/*
+ * Copyright 2022 CECTC, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package exec
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/cectc/dbpack/pkg/constant"
+	"github.com/cectc/dbpack/pkg/driver"
+	"github.com/cectc/dbpack/pkg/dt/schema"
+	"github.com/cectc/dbpack/pkg/visitor"
+	"github.com/cectc/dbpack/third_party/parser"
+	"github.com/cectc/dbpack/third_party/parser/ast"
+)
+
+var upsertTableMeta = schema.TableMeta{
+	SchemaName: "db",
+	TableName:  "inventory",
+	Columns:    []string{"id", "sku", "count"},
+	AllIndexes: map[string]schema.IndexMeta{
+		"PRIMARY": {
+			Values:    []schema.ColumnMeta{{TableName: "inventory", ColumnName: "id"}},
+			IndexName: "PRIMARY",
+			IndexType: schema.IndexTypePrimary,
+		},
+		"uk_sku": {
+			Values:    []schema.ColumnMeta{{TableName: "inventory", ColumnName: "sku"}},
+			IndexName: "uk_sku",
+			IndexType: schema.IndexTypeUnique,
+		},
+	},
+}
+
+func TestUpsertBeforeImageSql(t *testing.T) {
+	testCases := []*struct {
+		sql               string
+		args              map[string]interface{}
+		expectedCondition string
+		expectedArgs      []interface{}
+	}{
+		{
+			sql:               "insert into inventory(sku, count) values ('a', 1), ('b', 2) on duplicate key update count = count + values(count)",
+			expectedCondition: "(`sku` = 'a') OR (`sku` = 'b')",
+		},
+		{
+			sql:               "replace into inventory(id, sku, count) values (1, 'a', 1), (2, NULL, 2)",
+			expectedCondition: "(`id` = 1) OR (`id` = 2) OR (`sku` = 'a')",
+		},
+		{
+			sql:               "insert into inventory(id, sku, count) values (?, ?, ?) on duplicate key update count = ?",
+			args:              map[string]interface{}{"v1": 1, "v2": "a", "v3": 10, "v4": 10},
+			expectedCondition: "(`id` = ?) OR (`sku` = ?)",
+			expectedArgs:      []interface{}{1, "a"},
+		},
+		{
+			sql:               "replace into inventory(count) values (1)",
+			expectedCondition: "",
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.sql, func(t *testing.T) {
+			stmt, err := parser.New().ParseOneStmt(c.sql, "", "")
+			assert.Nil(t, err)
+			stmt.Accept(&visitor.ParamVisitor{})
+			insertStmt := stmt.(*ast.InsertStmt)
+			assert.True(t, IsUpsert(insertStmt))
+
+			var executor Executor
+			if c.args == nil {
+				executor = NewQueryUpsertExecutor("app1", &driver.BackendConnection{}, insertStmt, nil, nil)
+			} else {
+				executor = NewPrepareUpsertExecutor("app1", &driver.BackendConnection{}, insertStmt, c.args, nil, nil)
+			}
+			condition, args := executor.(*upsertExecutor).buildUniqueKeyCondition(upsertTableMeta)
+			assert.Equal(t, c.expectedCondition, condition)
+			assert.Equal(t, c.expectedArgs, args)
+		})
+	}
+}
+
+func TestBuildUpsertUndoItems(t *testing.T) {
+	row := func(id int64, sku string, count int64) *schema.Row {
+		return &schema.Row{Fields: []*schema.Field{
+			{Name: "id", KeyType: schema.PrimaryKey, Value: id},
+			{Name: "sku", KeyType: schema.Null, Value: sku},
+			{Name: "count", KeyType: schema.Null, Value: count},
+		}}
+	}
+	records := func(rows ...*schema.Row) *schema.TableRecords {
+		return &schema.TableRecords{TableMeta: upsertTableMeta, TableName: "inventory", Rows: rows}
+	}
+
+	// row 1 is updated, row 2 is replaced by row 3 with the same sku, row 4 is inserted
+	beforeImage := records(row(1, "a", 1), row(2, "b", 2))
+	afterImage := records(row(1, "a", 5), row(3, "b", 6), row(4, "c", 7))
+	lockKey, undoLogs := BuildUpsertUndoItems(false, "db", "inventory", beforeImage, afterImage)
+	assert.Equal(t, "inventory:1,2,3,4", lockKey)
+	assert.Equal(t, 3, len(undoLogs))
+
+	assert.Equal(t, constant.SQLType_DELETE, undoLogs[0].SqlType)
+	assert.Equal(t, []string{"2"}, undoLogs[0].BeforeImage.PKStrings())
+	assert.Equal(t, constant.SQLType_UPDATE, undoLogs[1].SqlType)
+	assert.Equal(t, []string{"1"}, undoLogs[1].BeforeImage.PKStrings())
+	assert.Equal(t, []string{"1"}, undoLogs[1].AfterImage.PKStrings())
+	assert.Equal(t, int64(5), undoLogs[1].AfterImage.Rows[0].Fields[2].Value)
+	assert.Equal(t, constant.SQLType_INSERT, undoLogs[2].SqlType)
+	assert.Equal(t, []string{"3", "4"}, undoLogs[2].AfterImage.PKStrings())
+}
@@ -31,6 +31,7 @@ import (
 	"github.com/cectc/dbpack/pkg/dt/api"
 	err2 "github.com/cectc/dbpack/pkg/errors"
 	"github.com/cectc/dbpack/pkg/filter"
+	"github.com/cectc/dbpack/pkg/filter/dt/exec"
 	"github.com/cectc/dbpack/pkg/log"
 	"github.com/cectc/dbpack/pkg/proto"
 	"github.com/cectc/dbpack/third_party/parser/ast"
@@ -103,6 +104,10 @@ func (f *_mysqlFilter) PreHandle(ctx context.Context, conn proto.Connection) err
 		switch stmtNode := stmt.(type) {
 		case *ast.DeleteStmt:
 			err = f.processBeforeQueryDelete(spanCtx, bc, stmtNode)
+		case *ast.InsertStmt:
+			if exec.IsUpsert(stmtNode) {
+				err = f.processBeforeQueryUpsert(spanCtx, bc, stmtNode)
+			}
 		case *ast.UpdateStmt:
 			err = f.processBeforeQueryUpdate(spanCtx, bc, stmtNode)
 		default:
@@ -116,6 +121,10 @@ func (f *_mysqlFilter) PreHandle(ctx context.Context, conn proto.Connection) err
 		switch stmtNode := stmt.StmtNode.(type) {
 		case *ast.DeleteStmt:
 			err = f.processBeforePrepareDelete(spanCtx, bc, stmt, stmtNode)
+		case *ast.InsertStmt:
+			if exec.IsUpsert(stmtNode) {
+				err = f.processBeforePrepareUpsert(spanCtx, bc, stmt, stmtNode)
+			}
 		case *ast.UpdateStmt:
 			err = f.processBeforePrepareUpdate(spanCtx, bc, stmt, stmtNode)
 		default:
@@ -144,7 +153,11 @@ func (f *_mysqlFilter) PostHandle(ctx context.Context, result proto.Result, conn
 		case *ast.DeleteStmt:
 			err = f.processAfterQueryDelete(spanCtx, bc, stmtNode)
 		case *ast.InsertStmt:
-			err = f.processAfterQueryInsert(spanCtx, bc, result, stmtNode)
+			if exec.IsUpsert(stmtNode) {
+				err = f.processAfterQueryUpsert(spanCtx, bc, result, stmtNode)
+			} else {
+				err = f.processAfterQueryInsert(spanCtx, bc, result, stmtNode)
+			}
 		case *ast.UpdateStmt:
 			err = f.processAfterQueryUpdate(spanCtx, bc, stmtNode)
 		case *ast.SelectStmt:
@@ -163,7 +176,11 @@ func (f *_mysqlFilter) PostHandle(ctx context.Context, result proto.Result, conn
 		case *ast.DeleteStmt:
 			err = f.processAfterPrepareDelete(spanCtx, bc, stmt, stmtNode)
 		case *ast.InsertStmt:
-			err = f.processAfterPrepareInsert(spanCtx, bc, result, stmt, stmtNode)
+			if exec.IsUpsert(stmtNode) {
+				err = f.processAfterPrepareUpsert(spanCtx, bc, result, stmt, stmtNode)
+			} else {
+				err = f.processAfterPrepareInsert(spanCtx, bc, result, stmt, stmtNode)
+			}
 		case *ast.UpdateStmt:
 			err = f.processAfterPrepareUpdate(spanCtx, bc, stmt, stmtNode)
 		case *ast.SelectStmt:
@@ -0,0 +1,86 @@
+/*
+ * Copyright 2022 CECTC, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dt
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/cectc/dbpack/pkg/constant"
+	"github.com/cectc/dbpack/pkg/driver"
+	"github.com/cectc/dbpack/pkg/dt"
+	"github.com/cectc/dbpack/pkg/dt/schema"
+	"github.com/cectc/dbpack/pkg/filter/dt/exec"
+	"github.com/cectc/dbpack/pkg/log"
+	"github.com/cectc/dbpack/pkg/proto"
+)
+
+func (f *_mysqlFilter) processBeforeMultiTable(ctx context.Context, executor exec.MultiTableExecutor) error {
+	bi, err := executor.BeforeImages(ctx)
+	if err != nil {
+		return err
+	}
+	if !proto.WithVariable(ctx, beforeImage, bi) {
+		return errors.New("set before image failed")
+	}
+	return nil
+}
+
+// processAfterMultiTable registers the branch with the lock keys of all the modified tables,
+// and inserts an undo log for every table. The executor is nil for multi-table delete, since
+// the deleted rows have no after image.
+func (f *_mysqlFilter) processAfterMultiTable(ctx context.Context, conn *driver.BackendConnection,
+	xid string, isBinary bool, sqlType constant.SQLType, executor exec.MultiTableExecutor) error {
+	bi, ok := proto.Variable(ctx, beforeImage).([]*schema.TableRecords)
+	if !ok {
+		return errors.New("before image should not be nil")
+	}
+	var afterImages []*schema.TableRecords
+	if executor != nil {
+		var err error
+		if afterImages, err = executor.AfterImages(ctx); err != nil {
+			return err
+		}
+	}
+	schemaName := proto.Schema(ctx)
+	if schemaName == "" {
+		return errors.New("schema name should not be nil")
+	}
+
+	undoSqlType := constant.SQLType_UPDATE
+	if sqlType == constant.SQLType_MULTI_DELETE {
+		undoSqlType = constant.SQLType_DELETE
+	}
+	lockKeys, undoLogs := exec.BuildMultiTableUndoItems(isBinary, undoSqlType, schemaName, bi, afterImages)
+	log.Debugf("%s, lockKey: %s", sqlType, lockKeys)
+	if len(undoLogs) == 0 {
+		return nil
+	}
+
+	branchID, err := f.registerBranchTransaction(ctx, xid, conn.DataSourceName(), lockKeys)
+	if err != nil {
+		return err
+	}
+	log.Debugf("%s, branch id: %d", sqlType, branchID)
+	for _, undoLog := range undoLogs {
+		if err = dt.GetUndoLogManager().InsertUndoLogWithNormal(conn, xid, branchID, undoLog); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -47,6 +47,9 @@ func (f *_mysqlFilter) processBeforePrepareDelete(ctx context.Context, conn *dri
 	if has, _ := misc.HasXIDHint(deleteStmt.TableHints); !has {
 		return nil
 	}
+	if exec.IsMultiTableDelete(deleteStmt) {
+		return f.processBeforeMultiTable(ctx, exec.NewPrepareMultiDeleteExecutor(f.applicationID, conn, deleteStmt, stmt.BindVars))
+	}
 	executor := exec.NewPrepareDeleteExecutor(f.applicationID, conn, deleteStmt, stmt.BindVars)
 	bi, err := executor.BeforeImage(ctx)
 	if err != nil {
@@ -73,6 +76,9 @@ func (f *_mysqlFilter) processBeforePrepareUpdate(ctx context.Context, conn *dri
 	if has, _ := misc.HasXIDHint(updateStmt.TableHints); !has {
 		return nil
 	}
+	if exec.IsMultiTableUpdate(updateStmt) {
+		return f.processBeforeMultiTable(ctx, exec.NewPrepareMultiUpdateExecutor(f.applicationID, conn, updateStmt, stmt.BindVars, nil))
+	}
 	executor := exec.NewPrepareUpdateExecutor(f.applicationID, conn, updateStmt, stmt.BindVars, nil)
 	bi, err := executor.BeforeImage(ctx)
 	if err != nil {
@@ -84,12 +90,30 @@ func (f *_mysqlFilter) processBeforePrepareUpdate(ctx context.Context, conn *dri
 	return nil
 }
 
+func (f *_mysqlFilter) processBeforePrepareUpsert(ctx context.Context, conn *driver.BackendConnection, stmt *proto.Stmt, insertStmt *ast.InsertStmt) error {
+	if has, _ := misc.HasXIDHint(insertStmt.TableHints); !has {
+		return nil
+	}
+	executor := exec.NewPrepareUpsertExecutor(f.applicationID, conn, insertStmt, stmt.BindVars, nil, nil)
+	bi, err := executor.BeforeImage(ctx)
+	if err != nil {
+		return err
+	}
+	if !proto.WithVariable(ctx, beforeImage, bi) {
+		return errors.New("set before image failed")
+	}
+	return nil
+}
+
 func (f *_mysqlFilter) processAfterPrepareDelete(ctx context.Context, conn *driver.BackendConnection,
 	stmt *proto.Stmt, deleteStmt *ast.DeleteStmt) error {
 	has, xid := misc.HasXIDHint(deleteStmt.TableHints)
 	if !has {
 		return nil
 	}
+	if exec.IsMultiTableDelete(deleteStmt) {
+		return f.processAfterMultiTable(ctx, conn, xid, true, constant.SQLType_MULTI_DELETE, nil)
+	}
 
 	executor := exec.NewPrepareDeleteExecutor(f.applicationID, conn, deleteStmt, stmt.BindVars)
 	bi := proto.Variable(ctx, beforeImage)
@@ -143,12 +167,50 @@ func (f *_mysqlFilter) processAfterPrepareInsert(ctx context.Context, conn *driv
 	return dt.GetUndoLogManager().InsertUndoLogWithNormal(conn, xid, branchID, undoLog)
 }
 
+func (f *_mysqlFilter) processAfterPrepareUpsert(ctx context.Context, conn *driver.BackendConnection,
+	result proto.Result, stmt *proto.Stmt, insertStmt *ast.InsertStmt) error {
+	has, xid := misc.HasXIDHint(insertStmt.TableHints)
+	if !has {
+		return nil
+	}
+	bi, _ := proto.Variable(ctx, beforeImage).(*schema.TableRecords)
+	executor := exec.NewPrepareUpsertExecutor(f.applicationID, conn, insertStmt, stmt.BindVars, result, bi)
+	afterImage, err := executor.AfterImage(ctx)
+	if err != nil {
+		return err
+	}
+	schemaName := proto.Schema(ctx)
+	if schemaName == "" {
+		return errors.New("schema name should not be nil")
+	}
+
+	lockKeys, undoLogs := exec.BuildUpsertUndoItems(true, schemaName, executor.GetTableName(), bi, afterImage)
+	log.Debugf("upsert, lockKey: %s", lockKeys)
+
+	branchID, err := f.registerBranchTransaction(ctx, xid, conn.DataSourceName(), lockKeys)
+	if err != nil {
+		return err
+	}
+	log.Debugf("upsert, branch id: %d", branchID)
+	for _, undoLog := range undoLogs {
+		if err = dt.GetUndoLogManager().InsertUndoLogWithNormal(conn, xid, branchID, undoLog); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (f *_mysqlFilter) processAfterPrepareUpdate(ctx context.Context, conn *driver.BackendConnection,
 	stmt *proto.Stmt, updateStmt *ast.UpdateStmt) error {
 	has, xid := misc.HasXIDHint(updateStmt.TableHints)
 	if !has {
 		return nil
 	}
+	if exec.IsMultiTableUpdate(updateStmt) {
+		bi, _ := proto.Variable(ctx, beforeImage).([]*schema.TableRecords)
+		return f.processAfterMultiTable(ctx, conn, xid, true, constant.SQLType_MULTI_UPDATE,
+			exec.NewPrepareMultiUpdateExecutor(f.applicationID, conn, updateStmt, stmt.BindVars, bi))
+	}
 	bi := proto.Variable(ctx, beforeImage)
 	if bi == nil {
 		return errors.New("before image should not be nil")
@@ -47,6 +47,9 @@ func (f *_mysqlFilter) processBeforeQueryDelete(ctx context.Context, conn *drive
 	if has, _ := misc.HasXIDHint(deleteStmt.TableHints); !has {
 		return nil
 	}
+	if exec.IsMultiTableDelete(deleteStmt) {
+		return f.processBeforeMultiTable(ctx, exec.NewQueryMultiDeleteExecutor(f.applicationID, conn, deleteStmt))
+	}
 	executor := exec.NewQueryDeleteExecutor(f.applicationID, conn, deleteStmt)
 	bi, err := executor.BeforeImage(ctx)
 	if err != nil {
@@ -73,6 +76,9 @@ func (f *_mysqlFilter) processBeforeQueryUpdate(ctx context.Context, conn *drive
 	if has, _ := misc.HasXIDHint(updateStmt.TableHints); !has {
 		return nil
 	}
+	if exec.IsMultiTableUpdate(updateStmt) {
+		return f.processBeforeMultiTable(ctx, exec.NewQueryMultiUpdateExecutor(f.applicationID, conn, updateStmt, nil))
+	}
 	executor := exec.NewQueryUpdateExecutor(f.applicationID, conn, updateStmt, nil)
 	bi, err := executor.BeforeImage(ctx)
 	if err != nil {
@@ -84,11 +90,29 @@ func (f *_mysqlFilter) processBeforeQueryUpdate(ctx context.Context, conn *drive
 	return nil
 }
 
+func (f *_mysqlFilter) processBeforeQueryUpsert(ctx context.Context, conn *driver.BackendConnection, insertStmt *ast.InsertStmt) error {
+	if has, _ := misc.HasXIDHint(insertStmt.TableHints); !has {
+		return nil
+	}
+	executor := exec.NewQueryUpsertExecutor(f.applicationID, conn, insertStmt, nil, nil)
+	bi, err := executor.BeforeImage(ctx)
+	if err != nil {
+		return err
+	}
+	if !proto.WithVariable(ctx, beforeImage, bi) {
+		return errors.New("set before image failed")
+	}
+	return nil
+}
+
 func (f *_mysqlFilter) processAfterQueryDelete(ctx context.Context, conn *driver.BackendConnection, deleteStmt *ast.DeleteStmt) error {
 	has, xid := misc.HasXIDHint(deleteStmt.TableHints)
 	if !has {
 		return nil
 	}
+	if exec.IsMultiTableDelete(deleteStmt) {
+		return f.processAfterMultiTable(ctx, conn, xid, false, constant.SQLType_MULTI_DELETE, nil)
+	}
 
 	executor := exec.NewQueryDeleteExecutor(f.applicationID, conn, deleteStmt)
 	bi := proto.Variable(ctx, beforeImage)
@@ -141,11 +165,48 @@ func (f *_mysqlFilter) processAfterQueryInsert(ctx context.Context, conn *driver
 	return dt.GetUndoLogManager().InsertUndoLogWithNormal(conn, xid, branchID, undoLog)
 }
 
+func (f *_mysqlFilter) processAfterQueryUpsert(ctx context.Context, conn *driver.BackendConnection, result proto.Result, insertStmt *ast.InsertStmt) error {
+	has, xid := misc.HasXIDHint(insertStmt.TableHints)
+	if !has {
+		return nil
+	}
+	bi, _ := proto.Variable(ctx, beforeImage).(*schema.TableRecords)
+	executor := exec.NewQueryUpsertExecutor(f.applicationID, conn, insertStmt, result, bi)
+	afterImage, err := executor.AfterImage(ctx)
+	if err != nil {
+		return err
+	}
+	schemaName := proto.Schema(ctx)
+	if schemaName == "" {
+		return errors.New("schema name should not be nil")
+	}
+
+	lockKeys, undoLogs := exec.BuildUpsertUndoItems(false, schemaName, executor.GetTableName(), bi, afterImage)
+	log.Debugf("upsert, lockKey: %s", lockKeys)
+
+	branchID, err := f.registerBranchTransaction(ctx, xid, conn.DataSourceName(), lockKeys)
+	if err != nil {
+		return err
+	}
+	log.Debugf("upsert, branch id: %d", branchID)
+	for _, undoLog := range undoLogs {
+		if err = dt.GetUndoLogManager().InsertUndoLogWithNormal(conn, xid, branchID, undoLog); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (f *_mysqlFilter) processAfterQueryUpdate(ctx context.Context, conn *driver.BackendConnection, updateStmt *ast.UpdateStmt) error {
 	has, xid := misc.HasXIDHint(updateStmt.TableHints)
 	if !has {
 		return nil
 	}
+	if exec.IsMultiTableUpdate(updateStmt) {
+		bi, _ := proto.Variable(ctx, beforeImage).([]*schema.TableRecords)
+		return f.processAfterMultiTable(ctx, conn, xid, false, constant.SQLType_MULTI_UPDATE,
+			exec.NewQueryMultiUpdateExecutor(f.applicationID, conn, updateStmt, bi))
+	}
 	bi := proto.Variable(ctx, beforeImage)
 	if bi == nil {
 		return errors.New("before image should not be nil")
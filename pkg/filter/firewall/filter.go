@@ -0,0 +1,270 @@
+/*
+ * Copyright 2022 CECTC, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package firewall
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/cectc/dbpack/pkg/constant"
+	err2 "github.com/cectc/dbpack/pkg/errors"
+	"github.com/cectc/dbpack/pkg/filter"
+	"github.com/cectc/dbpack/pkg/log"
+	"github.com/cectc/dbpack/pkg/proto"
+	"github.com/cectc/dbpack/third_party/parser"
+	"github.com/cectc/dbpack/third_party/parser/ast"
+	"github.com/cectc/dbpack/third_party/parser/format"
+)
+
+const (
+	sqlFirewallFilter = "SQLFirewallFilter"
+
+	// ProtectMode blocks the statements violating the rules, and the statements not in
+	// the allowlist if the allowlist file is configured
+	ProtectMode = "protect"
+	// LearnMode records the digests of the statements not violating the rules into the allowlist file
+	LearnMode = "learn"
+)
+
+type _factory struct{}
+
+func (factory *_factory) NewFilter(_ string, config map[string]interface{}) (proto.Filter, error) {
+	var (
+		err     error
+		content []byte
+		conf    *SQLFirewallFilterConfig
+	)
+	if content, err = json.Marshal(config); err != nil {
+		return nil, errors.Wrap(err, "marshal sql firewall filter config failed.")
+	}
+	if err = json.Unmarshal(content, &conf); err != nil {
+		log.Errorf("unmarshal sql firewall filter failed, %v", err)
+		return nil, err
+	}
+
+	f := &_filter{
+		mode:           conf.Mode,
+		allowedDigests: toSet(conf.AllowedDigests),
+		blockedDigests: toSet(conf.BlockedDigests),
+		rules:          conf.Rules,
+		allowlistFile:  conf.AllowlistFile,
+	}
+	switch f.mode {
+	case "":
+		f.mode = ProtectMode
+	case ProtectMode:
+	case LearnMode:
+		if f.allowlistFile == "" {
+			return nil, errors.New("allowlist file of sql firewall filter is required in learn mode")
+		}
+	default:
+		return nil, errors.Errorf("unsupported sql firewall mode %s", f.mode)
+	}
+	if f.allowedPatterns, err = compilePatterns(conf.AllowedPatterns); err != nil {
+		return nil, err
+	}
+	if f.blockedPatterns, err = compilePatterns(conf.BlockedPatterns); err != nil {
+		return nil, err
+	}
+	if f.allowlistFile != "" {
+		if f.allowlist, err = loadAllowlist(f.allowlistFile, f.mode == LearnMode); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+type SQLFirewallFilterConfig struct {
+	// Mode is `protect` or `learn`, defaults to `protect`
+	Mode string `yaml:"mode" json:"mode"`
+	// AllowlistFile contains the allowed digests, one per line
+	AllowlistFile string `yaml:"allowlist_file" json:"allowlist_file"`
+	// AllowedDigests are always allowed, regardless of the rules
+	AllowedDigests []string `yaml:"allowed_digests" json:"allowed_digests"`
+	BlockedDigests []string `yaml:"blocked_digests" json:"blocked_digests"`
+	// AllowedPatterns and BlockedPatterns are regular expressions matched against the normalized sql,
+	// e.g. "select * from `employee` where `id` = ?"
+	AllowedPatterns []string `yaml:"allowed_patterns" json:"allowed_patterns"`
+	BlockedPatterns []string `yaml:"blocked_patterns" json:"blocked_patterns"`
+	Rules           *Rules   `yaml:"rules" json:"rules"`
+}
+
+type _filter struct {
+	mode            string
+	allowedDigests  map[string]struct{}
+	blockedDigests  map[string]struct{}
+	allowedPatterns []*regexp.Regexp
+	blockedPatterns []*regexp.Regexp
+	rules           *Rules
+
+	allowlistFile string
+	mu            sync.RWMutex
+	// allowlist is nil if the allowlist file is not configured
+	allowlist map[string]struct{}
+}
+
+func (f *_filter) GetKind() string {
+	return sqlFirewallFilter
+}
+
+func (f *_filter) PreHandle(ctx context.Context) error {
+	var stmtNode ast.StmtNode
+	commandType := proto.CommandType(ctx)
+	switch commandType {
+	case constant.ComQuery:
+		stmtNode = proto.QueryStmt(ctx)
+	case constant.ComStmtExecute:
+		stmt := proto.PrepareStmt(ctx)
+		if stmt == nil {
+			return errors.New("prepare stmt should not be nil")
+		}
+		stmtNode = stmt.StmtNode
+	default:
+		return nil
+	}
+	if stmtNode == nil {
+		return nil
+	}
+
+	var sb strings.Builder
+	if err := stmtNode.Restore(format.NewRestoreCtx(constant.DBPackRestoreFormat, &sb)); err != nil {
+		return errors.WithStack(err)
+	}
+	normalized, digest := parser.NormalizeDigest(sb.String())
+	if reason := f.check(stmtNode, normalized, digest.String()); reason != "" {
+		log.Warnf("sql firewall blocked statement of user %s from %s, reason: %s, sql: %s",
+			proto.UserName(ctx), proto.RemoteAddr(ctx), reason, normalized)
+		return err2.NewSQLError(constant.EROptionPreventsStatement, constant.SSUnknownSQLState,
+			"statement blocked by sql firewall: %s", reason)
+	}
+	return nil
+}
+
+// check returns the reason why the statement is blocked, or an empty string if it is allowed.
+func (f *_filter) check(stmt ast.StmtNode, normalized, digest string) string {
+	if _, ok := f.allowedDigests[digest]; ok {
+		return ""
+	}
+	for _, pattern := range f.allowedPatterns {
+		if pattern.MatchString(normalized) {
+			return ""
+		}
+	}
+	if _, ok := f.blockedDigests[digest]; ok {
+		return fmt.Sprintf("digest %s is blocked", digest)
+	}
+	for _, pattern := range f.blockedPatterns {
+		if pattern.MatchString(normalized) {
+			return fmt.Sprintf("matches blocked pattern %s", pattern)
+		}
+	}
+	if reason := f.rules.check(stmt); reason != "" {
+		return reason
+	}
+	if f.allowlist == nil {
+		return ""
+	}
+
+	f.mu.RLock()
+	_, allowed := f.allowlist[digest]
+	f.mu.RUnlock()
+	if allowed {
+		return ""
+	}
+	if f.mode == LearnMode {
+		f.learn(normalized, digest)
+		return ""
+	}
+	return fmt.Sprintf("digest %s is not in allowlist", digest)
+}
+
+// learn appends the digest to the allowlist file, the normalized sql follows the digest for readability.
+func (f *_filter) learn(normalized, digest string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.allowlist[digest]; ok {
+		return
+	}
+	file, err := os.OpenFile(f.allowlistFile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		log.Errorf("open sql firewall allowlist file failed, %v", err)
+		return
+	}
+	defer file.Close()
+	if _, err = fmt.Fprintf(file, "%s %s\n", digest, normalized); err != nil {
+		log.Errorf("write sql firewall allowlist file failed, %v", err)
+		return
+	}
+	f.allowlist[digest] = struct{}{}
+}
+
+// loadAllowlist reads the digests in the allowlist file, lines starting with `#` are comments.
+func loadAllowlist(path string, createIfNotExist bool) (map[string]struct{}, error) {
+	allowlist := make(map[string]struct{})
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) && createIfNotExist {
+			return allowlist, nil
+		}
+		return nil, errors.Wrap(err, "open sql firewall allowlist file failed")
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		allowlist[strings.Fields(line)[0]] = struct{}{}
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "read sql firewall allowlist file failed")
+	}
+	return allowlist, nil
+}
+
+func compilePatterns(patterns []string) ([]*regexp.Regexp, error) {
+	result := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid sql firewall pattern %s", pattern)
+		}
+		result = append(result, re)
+	}
+	return result, nil
+}
+
+func toSet(values []string) map[string]struct{} {
+	set := make(map[string]struct{}, len(values))
+	for _, value := range values {
+		set[value] = struct{}{}
+	}
+	return set
+}
+
+func init() {
+	filter.RegistryFilterFactory(sqlFirewallFilter, &_factory{})
+}
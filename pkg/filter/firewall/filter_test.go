@@ -0,0 +1,175 @@
+/*
+ * Copyright 2022 CECTC, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package firewall
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/cectc/dbpack/pkg/constant"
+	err2 "github.com/cectc/dbpack/pkg/errors"
+	"github.com/cectc/dbpack/pkg/proto"
+	"github.com/cectc/dbpack/pkg/visitor"
+	"github.com/cectc/dbpack/third_party/parser"
+)
+
+func newFilter(t *testing.T, config map[string]interface{}) proto.DBPreFilter {
+	f, err := (&_factory{}).NewFilter("test", config)
+	assert.Nil(t, err)
+	return f.(proto.DBPreFilter)
+}
+
+func queryContext(t *testing.T, sql string) context.Context {
+	stmt, err := parser.New().ParseOneStmt(sql, "", "")
+	assert.Nil(t, err)
+	stmt.Accept(&visitor.ParamVisitor{})
+	ctx := proto.WithCommandType(context.Background(), constant.ComQuery)
+	return proto.WithQueryStmt(ctx, stmt)
+}
+
+func prepareContext(t *testing.T, sql string) context.Context {
+	stmt, err := parser.New().ParseOneStmt(sql, "", "")
+	assert.Nil(t, err)
+	stmt.Accept(&visitor.ParamVisitor{})
+	ctx := proto.WithCommandType(context.Background(), constant.ComStmtExecute)
+	return proto.WithPrepareStmt(ctx, &proto.Stmt{SqlText: sql, StmtNode: stmt})
+}
+
+func assertBlocked(t *testing.T, err error, reason string) {
+	sqlErr, ok := err.(*err2.SQLError)
+	if assert.True(t, ok, "statement should be blocked") {
+		assert.Equal(t, constant.EROptionPreventsStatement, sqlErr.Num)
+		assert.Contains(t, sqlErr.Message, reason)
+	}
+}
+
+func TestRules(t *testing.T) {
+	f := newFilter(t, map[string]interface{}{
+		"rules": map[string]interface{}{
+			"delete_without_where":  true,
+			"update_without_where":  true,
+			"drop":                  true,
+			"select_star_tables":    []string{"employee"},
+			"limit_required_tables": []string{"salary"},
+		},
+	})
+	testCases := []struct {
+		sql    string
+		reason string
+	}{
+		{sql: "delete from employee where id = ?"},
+		{sql: "delete from employee", reason: "DELETE without WHERE"},
+		{sql: "update employee set name = ? where id = ?"},
+		{sql: "update employee set name = ?", reason: "UPDATE without WHERE"},
+		{sql: "drop table employee", reason: "DROP TABLE"},
+		{sql: "drop database employees", reason: "DROP DATABASE"},
+		{sql: "truncate table employee", reason: "TRUNCATE TABLE"},
+		{sql: "select id, name from employee where id = ?"},
+		{sql: "select * from department"},
+		{sql: "select * from employee where id = ?", reason: "SELECT * on table employee"},
+		{sql: "select e.* from department d join employee e on d.id = e.dept_id", reason: "SELECT * on table employee"},
+		{sql: "select amount from salary where emp_id = ? limit 10"},
+		{sql: "select amount from salary where emp_id = ?", reason: "SELECT without LIMIT on table salary"},
+		{sql: "select id from department union select * from employee", reason: "SELECT * on table employee"},
+		{sql: "select id from department union all (select id from salary)", reason: "SELECT without LIMIT on table salary"},
+		{sql: "select id from department union (select id from salary limit 10)"},
+		{sql: "select id from department union select id from salary limit 10"},
+		{
+			sql:    "select id from department union (select id from department union select * from employee)",
+			reason: "SELECT * on table employee",
+		},
+		{sql: "select t.id from (select * from employee) t", reason: "SELECT * on table employee"},
+		{sql: "select t.id from (select amount from salary) t limit 10", reason: "SELECT without LIMIT on table salary"},
+		{sql: "select id from department where id in (select * from employee)", reason: "SELECT * on table employee"},
+		{
+			sql:    "select id from department where exists (select 1 from salary where emp_id = department.id)",
+			reason: "SELECT without LIMIT on table salary",
+		},
+		{sql: "update department set name = ? where id = (select dept_id from salary)", reason: "SELECT without LIMIT on table salary"},
+		{sql: "select t.id from (select id from employee) t where t.id in (select emp_id from salary limit 10)"},
+	}
+	for _, c := range testCases {
+		t.Run(c.sql, func(t *testing.T) {
+			for _, ctx := range []context.Context{queryContext(t, c.sql), prepareContext(t, c.sql)} {
+				err := f.PreHandle(ctx)
+				if c.reason == "" {
+					assert.Nil(t, err)
+				} else {
+					assertBlocked(t, err, c.reason)
+				}
+			}
+		})
+	}
+}
+
+func TestDigestsAndPatterns(t *testing.T) {
+	_, digest := parser.NormalizeDigest("delete from `employee`")
+	f := newFilter(t, map[string]interface{}{
+		"allowed_digests":  []string{digest.String()},
+		"blocked_digests":  []string{parser.DigestNormalized("select * from `salary`").String()},
+		"allowed_patterns": []string{"^update `employee` set"},
+		"blocked_patterns": []string{"`password`"},
+		"rules": map[string]interface{}{
+			"delete_without_where": true,
+			"update_without_where": true,
+		},
+	})
+
+	// allowed digests and patterns take precedence over the rules
+	assert.Nil(t, f.PreHandle(queryContext(t, "DELETE FROM employee")))
+	assert.Nil(t, f.PreHandle(queryContext(t, "update employee set age = age + 1")))
+	assertBlocked(t, f.PreHandle(queryContext(t, "delete from salary")), "DELETE without WHERE")
+
+	assertBlocked(t, f.PreHandle(queryContext(t, "select * from salary")), "is blocked")
+	assert.Nil(t, f.PreHandle(queryContext(t, "select * from salary where id = 1")))
+	assertBlocked(t, f.PreHandle(prepareContext(t, "select name, password from user where id = ?")),
+		"matches blocked pattern")
+}
+
+func TestLearnMode(t *testing.T) {
+	allowlistFile := filepath.Join(t.TempDir(), "allowlist")
+	learn := newFilter(t, map[string]interface{}{
+		"mode":           LearnMode,
+		"allowlist_file": allowlistFile,
+		"rules": map[string]interface{}{
+			"delete_without_where": true,
+		},
+	})
+	assert.Nil(t, learn.PreHandle(queryContext(t, "select id, name from employee where id = 1")))
+	assert.Nil(t, learn.PreHandle(prepareContext(t, "select id, name from employee where id = ?")))
+	assert.Nil(t, learn.PreHandle(queryContext(t, "update employee set name = 'scott' where id = 1")))
+	// statements violating the rules are blocked and not learned
+	assertBlocked(t, learn.PreHandle(queryContext(t, "delete from employee")), "DELETE without WHERE")
+
+	content, err := os.ReadFile(allowlistFile)
+	assert.Nil(t, err)
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	assert.Equal(t, 2, len(lines))
+	assert.True(t, strings.HasSuffix(lines[0], " select `id` , `name` from `employee` where `id` = ?"))
+
+	protect := newFilter(t, map[string]interface{}{
+		"allowlist_file": allowlistFile,
+	})
+	assert.Nil(t, protect.PreHandle(queryContext(t, "select id, name from employee where id = 2")))
+	assert.Nil(t, protect.PreHandle(prepareContext(t, "update employee set name = ? where id = ?")))
+	assertBlocked(t, protect.PreHandle(queryContext(t, "select id, name from employee")), "is not in allowlist")
+}
@@ -0,0 +1,174 @@
+/*
+ * Copyright 2022 CECTC, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package firewall
+
+import (
+	"strings"
+
+	"github.com/cectc/dbpack/third_party/parser/ast"
+)
+
+// allTables matches any table in Rules
+const allTables = "*"
+
+// Rules blocks dangerous statements by their AST
+type Rules struct {
+	DeleteWithoutWhere bool `yaml:"delete_without_where" json:"delete_without_where"`
+	UpdateWithoutWhere bool `yaml:"update_without_where" json:"update_without_where"`
+	// Drop blocks DROP TABLE, DROP DATABASE and TRUNCATE TABLE
+	Drop bool `yaml:"drop" json:"drop"`
+	// SelectStarTables are the large tables on which `SELECT *` is blocked, `*` for all tables
+	SelectStarTables []string `yaml:"select_star_tables" json:"select_star_tables"`
+	// LimitRequiredTables are the tables on which SELECT without LIMIT is blocked, `*` for all tables
+	LimitRequiredTables []string `yaml:"limit_required_tables" json:"limit_required_tables"`
+}
+
+// check returns the rule violated by the statement, or an empty string.
+func (r *Rules) check(stmt ast.StmtNode) string {
+	if r == nil {
+		return ""
+	}
+	switch stmtNode := stmt.(type) {
+	case *ast.DeleteStmt:
+		if r.DeleteWithoutWhere && stmtNode.Where == nil {
+			return "DELETE without WHERE"
+		}
+	case *ast.UpdateStmt:
+		if r.UpdateWithoutWhere && stmtNode.Where == nil {
+			return "UPDATE without WHERE"
+		}
+	case *ast.DropTableStmt:
+		if r.Drop {
+			return "DROP TABLE"
+		}
+	case *ast.DropDatabaseStmt:
+		if r.Drop {
+			return "DROP DATABASE"
+		}
+	case *ast.TruncateTableStmt:
+		if r.Drop {
+			return "TRUNCATE TABLE"
+		}
+	}
+	return r.checkSelects(stmt)
+}
+
+// checkSelects checks the rules of SELECT on every SELECT of the statement, including the SELECTs
+// of set operations, derived tables and subqueries.
+func (r *Rules) checkSelects(stmt ast.StmtNode) string {
+	if len(r.SelectStarTables) == 0 && len(r.LimitRequiredTables) == 0 {
+		return ""
+	}
+	checker := &selectChecker{rules: r, limited: make(map[*ast.SelectStmt]bool)}
+	stmt.Accept(checker)
+	return checker.reason
+}
+
+// checkSelect checks the rules of SELECT, limited is true if the SELECT is a part of a UNION with LIMIT.
+func (r *Rules) checkSelect(stmt *ast.SelectStmt, limited bool) string {
+	if stmt.From == nil {
+		return ""
+	}
+	tables := selectTables(stmt.From.TableRefs)
+	if hasWildCard(stmt) {
+		if table, ok := matchTables(r.SelectStarTables, tables); ok {
+			return "SELECT * on table " + table
+		}
+	}
+	if stmt.Limit == nil && !limited {
+		if table, ok := matchTables(r.LimitRequiredTables, tables); ok {
+			return "SELECT without LIMIT on table " + table
+		}
+	}
+	return ""
+}
+
+// selectChecker visits the SELECTs of a statement and stops at the first violated rule
+type selectChecker struct {
+	rules *Rules
+	// limited are the SELECTs of UNION, EXCEPT and INTERSECT limited by the LIMIT of the set operation
+	limited map[*ast.SelectStmt]bool
+	reason  string
+}
+
+func (v *selectChecker) Enter(in ast.Node) (out ast.Node, skipChildren bool) {
+	switch n := in.(type) {
+	case *ast.SetOprStmt:
+		if n.Limit != nil && n.SelectList != nil {
+			v.markLimited(n.SelectList.Selects)
+		}
+	case *ast.SelectStmt:
+		v.reason = v.rules.checkSelect(n, v.limited[n])
+	}
+	return in, v.reason != ""
+}
+
+func (v *selectChecker) Leave(in ast.Node) (out ast.Node, ok bool) {
+	return in, v.reason == ""
+}
+
+func (v *selectChecker) markLimited(selects []ast.Node) {
+	for _, node := range selects {
+		switch n := node.(type) {
+		case *ast.SelectStmt:
+			v.limited[n] = true
+		case *ast.SetOprStmt:
+			if n.SelectList != nil {
+				v.markLimited(n.SelectList.Selects)
+			}
+		case *ast.SetOprSelectList:
+			v.markLimited(n.Selects)
+		}
+	}
+}
+
+func hasWildCard(stmt *ast.SelectStmt) bool {
+	for _, field := range stmt.Fields.Fields {
+		if field.WildCard != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// selectTables returns the tables in the FROM clause, tables in derived tables are excluded.
+func selectTables(node ast.ResultSetNode) []string {
+	switch n := node.(type) {
+	case *ast.Join:
+		tables := selectTables(n.Left)
+		if n.Right != nil {
+			tables = append(tables, selectTables(n.Right)...)
+		}
+		return tables
+	case *ast.TableSource:
+		return selectTables(n.Source)
+	case *ast.TableName:
+		return []string{n.Name.O}
+	}
+	return nil
+}
+
+func matchTables(configured, tables []string) (string, bool) {
+	for _, c := range configured {
+		for _, table := range tables {
+			if c == allTables || strings.EqualFold(c, table) {
+				return table, true
+			}
+		}
+	}
+	return "", false
+}
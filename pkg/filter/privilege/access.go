@@ -0,0 +1,239 @@
+/*
+ * Copyright 2022 CECTC, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package privilege
+
+import (
+	"github.com/cectc/dbpack/third_party/parser/ast"
+	"github.com/cectc/dbpack/third_party/parser/model"
+)
+
+// tableAccess is the privileges required on a table by a statement
+type tableAccess struct {
+	table      *ast.TableName
+	privileges []Privilege
+	// anyTable requires any privilege on any table of the database, such as SHOW TABLES
+	anyTable bool
+	// global requires ALL privileges on all databases, it is required by the statements that are
+	// not mapped to table privileges, such as KILL and FLUSH
+	global bool
+}
+
+// tableAccesses returns the tables accessed by the statement and the required privileges, the tables
+// modified by a DML statement require the privilege of the statement, the others require SELECT.
+// The statements of other kinds are denied unless the user has ALL privileges on all databases.
+func tableAccesses(stmt ast.StmtNode) []*tableAccess {
+	var targets map[*ast.TableName][]Privilege
+	switch stmtNode := stmt.(type) {
+	case *ast.BeginStmt, *ast.CommitStmt, *ast.RollbackStmt, *ast.SavepointStmt, *ast.ReleaseSavepointStmt,
+		*ast.XAStartStmt, *ast.XAEndStmt, *ast.XAPrepareStmt, *ast.XACommitStmt, *ast.XARollbackStmt:
+		// transaction control statements don't access tables
+		return nil
+	case *ast.UseStmt:
+		return []*tableAccess{{table: &ast.TableName{Schema: model.NewCIStr(stmtNode.DBName)}, anyTable: true}}
+	case *ast.CallStmt:
+		// a stored procedure may run any statement on its database
+		return []*tableAccess{{
+			table:      &ast.TableName{Schema: stmtNode.Procedure.Schema},
+			privileges: []Privilege{All},
+		}}
+	case *ast.ExplainStmt:
+		// explaining a statement requires the privileges of the statement
+		return tableAccesses(stmtNode.Stmt)
+	case *ast.ShowStmt:
+		return showAccesses(stmtNode)
+	case *ast.LoadDataStmt:
+		privileges := []Privilege{Insert}
+		if stmtNode.OnDuplicate == ast.OnDuplicateKeyHandlingReplace {
+			privileges = append(privileges, Delete)
+		}
+		return []*tableAccess{{table: stmtNode.Table, privileges: privileges}}
+	case *ast.SelectStmt, *ast.SetOprStmt, *ast.DoStmt, *ast.SetStmt:
+		// the subqueries of DO and SET require SELECT
+	case *ast.InsertStmt:
+		privileges := []Privilege{Insert}
+		if stmtNode.IsReplace {
+			privileges = append(privileges, Delete)
+		}
+		if len(stmtNode.OnDuplicate) != 0 {
+			privileges = append(privileges, Update)
+		}
+		targets = make(map[*ast.TableName][]Privilege)
+		for _, source := range tableSources(stmtNode.Table.TableRefs) {
+			targets[source.Source.(*ast.TableName)] = privileges
+		}
+	case *ast.UpdateStmt:
+		targets = updateTargets(stmtNode)
+	case *ast.DeleteStmt:
+		targets = deleteTargets(stmtNode)
+	case *ast.CreateDatabaseStmt:
+		return []*tableAccess{databaseAccess(stmtNode.Name)}
+	case *ast.AlterDatabaseStmt:
+		return []*tableAccess{databaseAccess(stmtNode.Name)}
+	case *ast.DropDatabaseStmt:
+		return []*tableAccess{databaseAccess(stmtNode.Name)}
+	case ast.DDLNode:
+		collector := &tableCollector{}
+		stmt.Accept(collector)
+		accesses := make([]*tableAccess, 0, len(collector.tables))
+		for _, table := range collector.physicalTables() {
+			accesses = append(accesses, &tableAccess{table: table, privileges: []Privilege{DDL}})
+		}
+		return accesses
+	default:
+		return []*tableAccess{{global: true}}
+	}
+
+	collector := &tableCollector{}
+	stmt.Accept(collector)
+	accesses := make([]*tableAccess, 0, len(collector.tables))
+	for _, table := range collector.physicalTables() {
+		privileges, ok := targets[table]
+		if !ok {
+			privileges = []Privilege{Select}
+		}
+		accesses = append(accesses, &tableAccess{table: table, privileges: privileges})
+	}
+	return accesses
+}
+
+// showAccesses requires SELECT on the table shown, or any privilege on the database
+// whose tables are listed, the other SHOW statements are not checked.
+func showAccesses(stmt *ast.ShowStmt) []*tableAccess {
+	if stmt.Table != nil {
+		table := stmt.Table
+		if table.Schema.L == "" && stmt.DBName != "" {
+			// SHOW COLUMNS FROM t FROM db
+			table = &ast.TableName{Schema: model.NewCIStr(stmt.DBName), Name: table.Name}
+		}
+		return []*tableAccess{{table: table, privileges: []Privilege{Select}}}
+	}
+	switch stmt.Tp {
+	case ast.ShowTables, ast.ShowTableStatus, ast.ShowTriggers, ast.ShowCreateDatabase:
+		return []*tableAccess{{table: &ast.TableName{Schema: model.NewCIStr(stmt.DBName)}, anyTable: true}}
+	}
+	return nil
+}
+
+func databaseAccess(database string) *tableAccess {
+	return &tableAccess{
+		table:      &ast.TableName{Schema: model.NewCIStr(database)},
+		privileges: []Privilege{DDL},
+	}
+}
+
+// updateTargets returns the tables whose columns are assigned, all tables are regarded as
+// modified if the table of an assigned column is not specified in a multiple table update.
+func updateTargets(stmt *ast.UpdateStmt) map[*ast.TableName][]Privilege {
+	sources := tableSources(stmt.TableRefs.TableRefs)
+	targets := make(map[*ast.TableName][]Privilege)
+	for _, assignment := range stmt.List {
+		for _, source := range sources {
+			if len(sources) == 1 || assignment.Column.Table.L == "" || matchSource(source, assignment.Column.Table) {
+				targets[source.Source.(*ast.TableName)] = []Privilege{Update}
+			}
+		}
+	}
+	return targets
+}
+
+func deleteTargets(stmt *ast.DeleteStmt) map[*ast.TableName][]Privilege {
+	sources := tableSources(stmt.TableRefs.TableRefs)
+	targets := make(map[*ast.TableName][]Privilege)
+	for _, source := range sources {
+		if !stmt.IsMultiTable {
+			targets[source.Source.(*ast.TableName)] = []Privilege{Delete}
+			continue
+		}
+		for _, table := range stmt.Tables.Tables {
+			if matchSource(source, table.Name) {
+				targets[source.Source.(*ast.TableName)] = []Privilege{Delete}
+			}
+		}
+	}
+	return targets
+}
+
+// tableSources returns the table sources of table names in the join, derived tables are excluded.
+func tableSources(node ast.ResultSetNode) []*ast.TableSource {
+	switch n := node.(type) {
+	case *ast.Join:
+		sources := tableSources(n.Left)
+		if n.Right != nil {
+			sources = append(sources, tableSources(n.Right)...)
+		}
+		return sources
+	case *ast.TableSource:
+		if _, ok := n.Source.(*ast.TableName); ok {
+			return []*ast.TableSource{n}
+		}
+		if join, ok := n.Source.(*ast.Join); ok {
+			return tableSources(join)
+		}
+	}
+	return nil
+}
+
+// matchSource returns true if the name is the alias of the table source, or the table name if it has no alias.
+func matchSource(source *ast.TableSource, name model.CIStr) bool {
+	if source.AsName.L != "" {
+		return source.AsName.L == name.L
+	}
+	return source.Source.(*ast.TableName).Name.L == name.L
+}
+
+// tableCollector collects the table names in a statement
+type tableCollector struct {
+	tables []*ast.TableName
+	ctes   map[string]bool
+}
+
+func (v *tableCollector) Enter(in ast.Node) (out ast.Node, skipChildren bool) {
+	switch node := in.(type) {
+	case *ast.DeleteTableList:
+		// the tables to delete from are the aliases of the table sources
+		return in, true
+	case *ast.WithClause:
+		if v.ctes == nil {
+			v.ctes = make(map[string]bool)
+		}
+		for _, cte := range node.CTEs {
+			v.ctes[cte.Name.L] = true
+		}
+	case *ast.TableName:
+		v.tables = append(v.tables, node)
+	}
+	return in, false
+}
+
+// physicalTables returns the collected tables except the references to common table expressions
+func (v *tableCollector) physicalTables() []*ast.TableName {
+	if len(v.ctes) == 0 {
+		return v.tables
+	}
+	tables := make([]*ast.TableName, 0, len(v.tables))
+	for _, table := range v.tables {
+		if table.Schema.L == "" && v.ctes[table.Name.L] {
+			continue
+		}
+		tables = append(tables, table)
+	}
+	return tables
+}
+
+func (v *tableCollector) Leave(in ast.Node) (out ast.Node, ok bool) {
+	return in, true
+}
@@ -0,0 +1,232 @@
+/*
+ * Copyright 2022 CECTC, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package privilege
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/cectc/dbpack/pkg/constant"
+	err2 "github.com/cectc/dbpack/pkg/errors"
+	"github.com/cectc/dbpack/pkg/filter"
+	"github.com/cectc/dbpack/pkg/log"
+	"github.com/cectc/dbpack/pkg/proto"
+	"github.com/cectc/dbpack/third_party/parser/ast"
+)
+
+const (
+	privilegeFilter = "PrivilegeFilter"
+
+	// wildcard matches any database or table
+	wildcard = "*"
+)
+
+// Privilege is the kind of statement a user is allowed to run
+type Privilege string
+
+const (
+	Select Privilege = "SELECT"
+	Insert Privilege = "INSERT"
+	Update Privilege = "UPDATE"
+	Delete Privilege = "DELETE"
+	DDL    Privilege = "DDL"
+	All    Privilege = "ALL"
+)
+
+type _factory struct{}
+
+func (factory *_factory) NewFilter(_ string, config map[string]interface{}) (proto.Filter, error) {
+	var (
+		err     error
+		content []byte
+		conf    *PrivilegeFilterConfig
+	)
+	if content, err = json.Marshal(config); err != nil {
+		return nil, errors.Wrap(err, "marshal privilege filter config failed.")
+	}
+	if err = json.Unmarshal(content, &conf); err != nil {
+		log.Errorf("unmarshal privilege filter failed, %v", err)
+		return nil, err
+	}
+	grants := make(map[string][]*Grant)
+	for _, grant := range conf.Grants {
+		for i, privilege := range grant.Privileges {
+			grant.Privileges[i] = Privilege(strings.ToUpper(string(privilege)))
+			switch grant.Privileges[i] {
+			case Select, Insert, Update, Delete, DDL, All:
+			default:
+				return nil, errors.Errorf("unsupported privilege %s of user %s", privilege, grant.User)
+			}
+		}
+		grants[grant.User] = append(grants[grant.User], grant)
+	}
+	return &_filter{grants: grants}, nil
+}
+
+// PrivilegeFilterConfig grants privileges to users, a user without any grant can't access any table.
+type PrivilegeFilterConfig struct {
+	Grants []*Grant `yaml:"grants" json:"grants"`
+}
+
+// Grant grants privileges on tables of a database to a user
+type Grant struct {
+	User string `yaml:"user" json:"user"`
+	// Database is `*` or empty for all databases
+	Database string `yaml:"database" json:"database"`
+	// Tables are the logic tables, empty or `*` for all tables of the database
+	Tables     []string    `yaml:"tables" json:"tables"`
+	Privileges []Privilege `yaml:"privileges" json:"privileges"`
+}
+
+func (g *Grant) matches(database, table string, privilege Privilege) bool {
+	if g.Database != "" && g.Database != wildcard && !strings.EqualFold(g.Database, database) {
+		return false
+	}
+	if len(g.Tables) != 0 {
+		matched := false
+		for _, t := range g.Tables {
+			if t == wildcard || strings.EqualFold(t, table) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	for _, p := range g.Privileges {
+		if p == All || p == privilege {
+			return true
+		}
+	}
+	return false
+}
+
+type _filter struct {
+	grants map[string][]*Grant
+}
+
+func (f *_filter) GetKind() string {
+	return privilegeFilter
+}
+
+func (f *_filter) PreHandle(ctx context.Context) error {
+	var stmtNode ast.StmtNode
+	commandType := proto.CommandType(ctx)
+	switch commandType {
+	case constant.ComQuery:
+		stmtNode = proto.QueryStmt(ctx)
+	case constant.ComStmtExecute:
+		stmt := proto.PrepareStmt(ctx)
+		if stmt == nil {
+			return errors.New("prepare stmt should not be nil")
+		}
+		stmtNode = stmt.StmtNode
+	default:
+		return nil
+	}
+	if stmtNode == nil {
+		return nil
+	}
+
+	user := proto.UserName(ctx)
+	schema := proto.Schema(ctx)
+	for _, access := range tableAccesses(stmtNode) {
+		if access.global {
+			if !f.granted(user, wildcard, wildcard, All) {
+				return err2.NewSQLError(constant.ERSpecifiedAccessDenied, constant.SSSpecifiedAccessDenied,
+					"Access denied; you need (at least one of) the %s privilege(s) for this operation", All)
+			}
+			continue
+		}
+		database := access.table.Schema.O
+		if database == "" {
+			database = schema
+		}
+		if access.anyTable {
+			if !f.grantedDatabase(user, database) {
+				return err2.NewSQLError(constant.ERDBAccessDenied, constant.SSDBAccessDenied,
+					"Access denied for user '%s'@'%s' to database '%s'", user, remoteHost(ctx), database)
+			}
+			continue
+		}
+		table := access.table.Name.O
+		if access.table.Name.L == "" {
+			// database level ddl, such as CREATE DATABASE
+			table = wildcard
+		}
+		for _, privilege := range access.privileges {
+			if !f.granted(user, database, table, privilege) {
+				return err2.NewSQLError(constant.ERTableAccessDeniedError, constant.SSTableAccessDeniedError,
+					"%s command denied to user '%s'@'%s' for table '%s'",
+					privilege, user, remoteHost(ctx), table)
+			}
+		}
+	}
+	return nil
+}
+
+func (f *_filter) granted(user, database, table string, privilege Privilege) bool {
+	for _, grant := range f.grants[user] {
+		if table == wildcard {
+			// database level privileges require a grant of all tables
+			if len(grant.Tables) != 0 && !contains(grant.Tables, wildcard) {
+				continue
+			}
+		}
+		if grant.matches(database, table, privilege) {
+			return true
+		}
+	}
+	return false
+}
+
+// grantedDatabase returns true if the user has any privilege on the database
+func (f *_filter) grantedDatabase(user, database string) bool {
+	for _, grant := range f.grants[user] {
+		if grant.Database == "" || grant.Database == wildcard || strings.EqualFold(grant.Database, database) {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(tables []string, table string) bool {
+	for _, t := range tables {
+		if t == table {
+			return true
+		}
+	}
+	return false
+}
+
+func remoteHost(ctx context.Context) string {
+	addr := proto.RemoteAddr(ctx)
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
+
+func init() {
+	filter.RegistryFilterFactory(privilegeFilter, &_factory{})
+}
@@ -0,0 +1,242 @@
+/*
+ * Copyright 2022 CECTC, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package privilege
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/cectc/dbpack/pkg/constant"
+	err2 "github.com/cectc/dbpack/pkg/errors"
+	"github.com/cectc/dbpack/pkg/proto"
+	"github.com/cectc/dbpack/pkg/visitor"
+	"github.com/cectc/dbpack/third_party/parser"
+)
+
+func TestPrivilegeFilter(t *testing.T) {
+	f, err := (&_factory{}).NewFilter("test", map[string]interface{}{
+		"grants": []interface{}{
+			map[string]interface{}{
+				"user":       "dksl",
+				"database":   "employees",
+				"tables":     []string{"employee"},
+				"privileges": []string{"select", "insert", "update"},
+			},
+			map[string]interface{}{
+				"user":       "dksl",
+				"database":   "employees",
+				"tables":     []string{"salary"},
+				"privileges": []string{"select"},
+			},
+			map[string]interface{}{
+				"user":       "root",
+				"privileges": []string{"all"},
+			},
+		},
+	})
+	assert.Nil(t, err)
+	filter := f.(proto.DBPreFilter)
+
+	testCases := []struct {
+		user    string
+		sql     string
+		message string
+	}{
+		{user: "dksl", sql: "select * from employee where id = ?"},
+		{user: "dksl", sql: "select * from employee e join salary s on e.id = s.emp_id where e.id = ?"},
+		{user: "dksl", sql: "insert into employee (id, name) values (?, ?)"},
+		{user: "dksl", sql: "update employee set name = ? where id = ?"},
+		{user: "dksl", sql: "update employee e join salary s on e.id = s.emp_id set e.name = ? where s.amount > ?"},
+		{user: "dksl", sql: "insert into employee (id, name) select id, name from salary where id = ?"},
+		{user: "dksl", sql: "set names utf8mb4"},
+		{
+			user:    "dksl",
+			sql:     "delete from employee where id = ?",
+			message: "DELETE command denied to user 'dksl'@'127.0.0.1' for table 'employee'",
+		},
+		{
+			user:    "dksl",
+			sql:     "update employee e join salary s on e.id = s.emp_id set s.amount = ? where e.id = ?",
+			message: "UPDATE command denied to user 'dksl'@'127.0.0.1' for table 'salary'",
+		},
+		{
+			user:    "dksl",
+			sql:     "delete e, s from employee e join salary s on e.id = s.emp_id where e.id = ?",
+			message: "DELETE command denied to user 'dksl'@'127.0.0.1' for table 'employee'",
+		},
+		{
+			user:    "dksl",
+			sql:     "replace into employee (id, name) values (?, ?)",
+			message: "DELETE command denied to user 'dksl'@'127.0.0.1' for table 'employee'",
+		},
+		{
+			user:    "dksl",
+			sql:     "select * from department where id in (select dept_id from employee where id = ?)",
+			message: "SELECT command denied to user 'dksl'@'127.0.0.1' for table 'department'",
+		},
+		{
+			user:    "dksl",
+			sql:     "select * from hr.employee where id = ?",
+			message: "SELECT command denied to user 'dksl'@'127.0.0.1' for table 'employee'",
+		},
+		{
+			user:    "dksl",
+			sql:     "alter table employee add column age int",
+			message: "DDL command denied to user 'dksl'@'127.0.0.1' for table 'employee'",
+		},
+		{
+			user:    "dksl",
+			sql:     "drop database employees",
+			message: "DDL command denied to user 'dksl'@'127.0.0.1' for table '*'",
+		},
+		{
+			user:    "scott",
+			sql:     "select * from employee where id = ?",
+			message: "SELECT command denied to user 'scott'@'127.0.0.1' for table 'employee'",
+		},
+		{user: "root", sql: "delete from hr.employee where id = ?"},
+		{user: "root", sql: "drop database employees"},
+		{user: "dksl", sql: "explain select * from employee where id = ?"},
+		{
+			user:    "dksl",
+			sql:     "explain select * from department where id = ?",
+			message: "SELECT command denied to user 'dksl'@'127.0.0.1' for table 'department'",
+		},
+		{
+			user:    "dksl",
+			sql:     "explain delete from employee where id = ?",
+			message: "DELETE command denied to user 'dksl'@'127.0.0.1' for table 'employee'",
+		},
+		{user: "dksl", sql: "desc employee"},
+		{
+			user:    "dksl",
+			sql:     "desc department",
+			message: "SELECT command denied to user 'dksl'@'127.0.0.1' for table 'department'",
+		},
+		{user: "dksl", sql: "load data infile '/tmp/employee.csv' into table employee"},
+		{
+			user:    "dksl",
+			sql:     "load data infile '/tmp/employee.csv' replace into table employee",
+			message: "DELETE command denied to user 'dksl'@'127.0.0.1' for table 'employee'",
+		},
+		{
+			user:    "dksl",
+			sql:     "load data infile '/tmp/salary.csv' into table salary",
+			message: "INSERT command denied to user 'dksl'@'127.0.0.1' for table 'salary'",
+		},
+		{user: "dksl", sql: "show create table employee"},
+		{user: "dksl", sql: "show columns from employee from employees"},
+		{
+			user:    "dksl",
+			sql:     "show index from department",
+			message: "SELECT command denied to user 'dksl'@'127.0.0.1' for table 'department'",
+		},
+		{
+			user:    "dksl",
+			sql:     "show columns from employee from hr",
+			message: "SELECT command denied to user 'dksl'@'127.0.0.1' for table 'employee'",
+		},
+		{user: "dksl", sql: "show tables"},
+		{
+			user:    "dksl",
+			sql:     "show tables from hr",
+			message: "Access denied for user 'dksl'@'127.0.0.1' to database 'hr'",
+		},
+		{user: "dksl", sql: "show variables like 'sql_mode'"},
+		{user: "dksl", sql: "with e as (select * from employee) select * from e where id = ?"},
+		{user: "dksl", sql: "with recursive s as (select 1 as n union all select n + 1 from s where n < 3) select * from s"},
+		{
+			user:    "dksl",
+			sql:     "with d as (select * from department) select * from d",
+			message: "SELECT command denied to user 'dksl'@'127.0.0.1' for table 'department'",
+		},
+		{user: "dksl", sql: "begin"},
+		{user: "dksl", sql: "xa start 'gs/svc/1'"},
+		{user: "dksl", sql: "use employees"},
+		{
+			user:    "dksl",
+			sql:     "use hr",
+			message: "Access denied for user 'dksl'@'127.0.0.1' to database 'hr'",
+		},
+		{user: "dksl", sql: "do sleep(1)"},
+		{
+			user:    "dksl",
+			sql:     "do (select count(*) from department)",
+			message: "SELECT command denied to user 'dksl'@'127.0.0.1' for table 'department'",
+		},
+		{
+			user:    "dksl",
+			sql:     "set @count = (select count(*) from department)",
+			message: "SELECT command denied to user 'dksl'@'127.0.0.1' for table 'department'",
+		},
+		{
+			user:    "dksl",
+			sql:     "call raise_salary(?)",
+			message: "ALL command denied to user 'dksl'@'127.0.0.1' for table '*'",
+		},
+		{user: "root", sql: "call employees.raise_salary(?)"},
+		{
+			user:    "dksl",
+			sql:     "kill 10",
+			message: "Access denied; you need (at least one of) the ALL privilege(s) for this operation",
+		},
+		{
+			user:    "dksl",
+			sql:     "flush tables",
+			message: "Access denied; you need (at least one of) the ALL privilege(s) for this operation",
+		},
+		{user: "root", sql: "kill 10"},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.sql, func(t *testing.T) {
+			p := parser.New()
+			stmt, err := p.ParseOneStmt(c.sql, "", "")
+			assert.Nil(t, err)
+			stmt.Accept(&visitor.ParamVisitor{})
+
+			ctx := proto.WithUserName(context.Background(), c.user)
+			ctx = proto.WithSchema(ctx, "employees")
+			ctx = proto.WithRemoteAddr(ctx, "127.0.0.1:36812")
+			queryCtx := proto.WithCommandType(ctx, constant.ComQuery)
+			queryCtx = proto.WithQueryStmt(queryCtx, stmt)
+			prepareCtx := proto.WithCommandType(ctx, constant.ComStmtExecute)
+			prepareCtx = proto.WithPrepareStmt(prepareCtx, &proto.Stmt{StmtNode: stmt})
+
+			for _, ctx := range []context.Context{queryCtx, prepareCtx} {
+				err = filter.PreHandle(ctx)
+				if c.message == "" {
+					assert.Nil(t, err)
+					continue
+				}
+				sqlErr, ok := err.(*err2.SQLError)
+				assert.True(t, ok)
+				if strings.HasPrefix(c.message, "Access denied;") {
+					assert.Equal(t, constant.ERSpecifiedAccessDenied, sqlErr.Num)
+				} else if strings.HasPrefix(c.message, "Access denied") {
+					assert.Equal(t, constant.ERDBAccessDenied, sqlErr.Num)
+				} else {
+					assert.Equal(t, constant.ERTableAccessDeniedError, sqlErr.Num)
+				}
+				assert.Equal(t, c.message, sqlErr.Message)
+			}
+		})
+	}
+}
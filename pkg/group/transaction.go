@@ -18,14 +18,19 @@ package group
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/pkg/errors"
 	"github.com/uber-go/atomic"
 	"go.opentelemetry.io/otel/attribute"
 	"golang.org/x/sync/errgroup"
 
+	"github.com/cectc/dbpack/pkg/config"
+	"github.com/cectc/dbpack/pkg/constant"
+	"github.com/cectc/dbpack/pkg/dt"
 	err2 "github.com/cectc/dbpack/pkg/errors"
 	"github.com/cectc/dbpack/pkg/log"
+	"github.com/cectc/dbpack/pkg/misc"
 	"github.com/cectc/dbpack/pkg/mysql"
 	"github.com/cectc/dbpack/pkg/proto"
 	"github.com/cectc/dbpack/pkg/tracing"
@@ -37,20 +42,49 @@ var (
 )
 
 type ComplexTx struct {
-	closed    *atomic.Bool
-	id        uint32
-	txs       map[string]proto.Tx
+	closed *atomic.Bool
+	id     uint32
+	appID  string
+	mode   config.TransactionMode
+	// xid is the distributed transaction id in AT mode, or the gtrid of XA branches in XA mode
+	xid string
+	txs map[string]proto.Tx
+	// executors are the db groups in the order of joining the transaction
+	executors []proto.DBGroupExecutor
 	optimizer proto.Optimizer
+	// xaLog records the commit decisions in XA mode
+	xaLog *XALog
+	// characteristics are set by SET TRANSACTION before the transaction begins
+	characteristics []string
 }
 
 func NewComplexTx(optimizer proto.Optimizer) proto.DBGroupTx {
+	return NewDistributedComplexTx("", optimizer, config.LocalTransaction, nil)
+}
+
+// NewDistributedComplexTx creates a ComplexTx which commits the db groups atomically in XA or AT mode,
+// xaLog is required in XA mode.
+func NewDistributedComplexTx(appID string, optimizer proto.Optimizer, mode config.TransactionMode, xaLog *XALog) proto.DBGroupTx {
 	txID.Inc()
-	return &ComplexTx{
+	tx := &ComplexTx{
 		closed:    atomic.NewBool(false),
 		id:        txID.Load(),
+		appID:     appID,
+		mode:      mode,
 		txs:       make(map[string]proto.Tx),
 		optimizer: optimizer,
+		xaLog:     xaLog,
 	}
+	if mode == config.XATransaction {
+		tx.xid = xaLog.newGtrid(tx.id)
+	}
+	return tx
+}
+
+// SetCharacteristics sets the characteristics set by SET TRANSACTION, they are applied to every
+// branch of the transaction.
+func (tx *ComplexTx) SetCharacteristics(characteristics []string) {
+	tx.characteristics = characteristics
 }
 
 func (tx *ComplexTx) Query(ctx context.Context, query string) (proto.Result, uint16, error) {
@@ -65,8 +99,7 @@ func (tx *ComplexTx) Query(ctx context.Context, query string) (proto.Result, uin
 	if err != nil {
 		return nil, 0, err
 	}
-	txCtx := proto.WithDBGroupTx(spanCtx, tx)
-	return plan.Execute(txCtx)
+	return tx.execute(spanCtx, plan)
 }
 
 func (tx *ComplexTx) Execute(ctx context.Context, stmt ast.StmtNode, args ...interface{}) (proto.Result, uint16, error) {
@@ -77,8 +110,35 @@ func (tx *ComplexTx) Execute(ctx context.Context, stmt ast.StmtNode, args ...int
 	if err != nil {
 		return nil, 0, err
 	}
-	txCtx := proto.WithDBGroupTx(spanCtx, tx)
-	return plan.Execute(txCtx)
+	return tx.execute(spanCtx, plan)
+}
+
+func (tx *ComplexTx) ExecutePlan(ctx context.Context, plan proto.Plan) (proto.Result, uint16, error) {
+	spanCtx, span := tracing.GetTraceSpan(ctx, tracing.GroupExecute)
+	defer span.End()
+
+	return tx.execute(spanCtx, plan)
+}
+
+// execute executes the plan in the transaction, in AT mode the distributed transaction
+// begins before the first statement, and the statements carry its xid.
+func (tx *ComplexTx) execute(ctx context.Context, plan proto.Plan) (proto.Result, uint16, error) {
+	txCtx := proto.WithDBGroupTx(ctx, tx)
+	if tx.mode != config.ATTransaction {
+		return plan.Execute(txCtx)
+	}
+	if tx.xid == "" {
+		timeout, ok := proto.Variable(ctx, constant.TransactionTimeout).(int32)
+		if !ok {
+			return nil, 0, errors.New("transaction timeout must be of type int32")
+		}
+		xid, err := dt.GetTransactionManager(tx.appID).Begin(ctx, fmt.Sprintf("COMPLEX_TX_%d", tx.id), timeout)
+		if err != nil {
+			return nil, 0, err
+		}
+		tx.xid = xid
+	}
+	return plan.Execute(txCtx, misc.NewXIDHint(tx.xid))
 }
 
 func (tx *ComplexTx) Begin(ctx context.Context, executor proto.DBGroupExecutor) (proto.Tx, error) {
@@ -90,12 +150,24 @@ func (tx *ComplexTx) Begin(ctx context.Context, executor proto.DBGroupExecutor)
 		return childTx, nil
 	}
 	masterCtx := proto.WithMaster(spanCtx)
-	childTx, _, err := executor.Begin(masterCtx)
+	if len(tx.characteristics) != 0 {
+		masterCtx = proto.WithTransactionCharacteristics(masterCtx, tx.characteristics)
+	}
+	var (
+		childTx proto.Tx
+		err     error
+	)
+	if tx.mode == config.XATransaction {
+		childTx, _, err = executor.XAStart(masterCtx, fmt.Sprintf("XA START %s", branchXID(tx.xid, executor.GroupName())))
+	} else {
+		childTx, _, err = executor.Begin(masterCtx)
+	}
 	if err != nil {
 		return nil, err
 	}
 	log.Debugf("DBGroup %s has begun local transaction!", executor.GroupName())
 	tx.txs[executor.GroupName()] = childTx
+	tx.executors = append(tx.executors, executor)
 	return childTx, nil
 }
 
@@ -108,12 +180,30 @@ func (tx *ComplexTx) Commit(ctx context.Context) (result proto.Result, err error
 	}
 	defer tx.Close()
 
+	switch tx.mode {
+	case config.XATransaction:
+		err = tx.commitXA(spanCtx)
+	case config.ATTransaction:
+		err = tx.commitAT(spanCtx)
+	default:
+		err = tx.commitLocal(spanCtx)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &mysql.Result{
+		AffectedRows: 0,
+		InsertId:     0,
+	}, nil
+}
+
+func (tx *ComplexTx) commitLocal(ctx context.Context) error {
 	var g errgroup.Group
 	for group, child := range tx.txs {
 		// https://golang.org/doc/faq#closures_and_goroutines
 		group, child := group, child
 		g.Go(func() error {
-			_, err := child.Commit(spanCtx)
+			_, err := child.Commit(ctx)
 			if err != nil {
 				log.Errorf("commit failed, db group: %s, err: %v", group, err)
 				return err
@@ -122,14 +212,26 @@ func (tx *ComplexTx) Commit(ctx context.Context) (result proto.Result, err error
 			return nil
 		})
 	}
+	return g.Wait()
+}
 
-	if err := g.Wait(); err != nil {
-		return nil, err
+// commitAT commits the local transactions, then commits the distributed transaction. If any of
+// the local transactions fails to commit, the distributed transaction is rolled back, and the
+// committed local transactions are compensated by undo logs.
+func (tx *ComplexTx) commitAT(ctx context.Context) error {
+	err := tx.commitLocal(ctx)
+	if tx.xid == "" {
+		return err
 	}
-	return &mysql.Result{
-		AffectedRows: 0,
-		InsertId:     0,
-	}, nil
+	transactionManager := dt.GetTransactionManager(tx.appID)
+	if err != nil {
+		if _, rollbackErr := transactionManager.Rollback(ctx, tx.xid); rollbackErr != nil {
+			log.Errorf("rollback distributed transaction %s failed, err: %v", tx.xid, rollbackErr)
+		}
+		return err
+	}
+	_, err = transactionManager.Commit(ctx, tx.xid)
+	return err
 }
 
 func (tx *ComplexTx) Rollback(ctx context.Context) (result proto.Result, err error) {
@@ -141,11 +243,34 @@ func (tx *ComplexTx) Rollback(ctx context.Context) (result proto.Result, err err
 	}
 	defer tx.Close()
 
+	switch tx.mode {
+	case config.XATransaction:
+		err = tx.rollbackXA(spanCtx)
+	case config.ATTransaction:
+		err = tx.rollbackLocal(spanCtx)
+		if tx.xid != "" {
+			if _, rollbackErr := dt.GetTransactionManager(tx.appID).Rollback(spanCtx, tx.xid); rollbackErr != nil && err == nil {
+				err = rollbackErr
+			}
+		}
+	default:
+		err = tx.rollbackLocal(spanCtx)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &mysql.Result{
+		AffectedRows: 0,
+		InsertId:     0,
+	}, nil
+}
+
+func (tx *ComplexTx) rollbackLocal(ctx context.Context) error {
 	var g errgroup.Group
 	for group, child := range tx.txs {
 		group, child := group, child
 		g.Go(func() error {
-			_, err := child.Rollback(spanCtx, nil)
+			_, err := child.Rollback(ctx, nil)
 			if err != nil {
 				log.Errorf("rollback failed, db group: %s, err: %v", group, err)
 				return err
@@ -154,17 +279,11 @@ func (tx *ComplexTx) Rollback(ctx context.Context) (result proto.Result, err err
 			return nil
 		})
 	}
-
-	if err := g.Wait(); err != nil {
-		return nil, err
-	}
-	return &mysql.Result{
-		AffectedRows: 0,
-		InsertId:     0,
-	}, nil
+	return g.Wait()
 }
 
 func (tx *ComplexTx) Close() {
 	tx.closed.Swap(true)
 	tx.txs = nil
+	tx.executors = nil
 }
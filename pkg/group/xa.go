@@ -0,0 +1,398 @@
+/*
+ * Copyright 2022 CECTC, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package group
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sync/errgroup"
+
+	err2 "github.com/cectc/dbpack/pkg/errors"
+	"github.com/cectc/dbpack/pkg/log"
+	"github.com/cectc/dbpack/pkg/mysql"
+	"github.com/cectc/dbpack/pkg/proto"
+	mysql2 "github.com/cectc/dbpack/third_party/parser/mysql"
+)
+
+// The XA branches of a ComplexTx share the gtrid `<instance id>:<boot time>:<tx id>`, and the bqual
+// of a branch is its db group name. The gtrid is written to the xa log table of the configured
+// db group after all branches are prepared, which is the commit point of the transaction. The
+// prepared branches left by a crash are committed if their gtrid is in the xa log, otherwise
+// rolled back.
+// A branch is committed or rolled back on the connection which prepared it, the connection is
+// released after the second phase, so it does not depend on xa_detach_on_prepare. The branches
+// whose connections are lost are resolved by RecoverXATransactions on other connections.
+const (
+	// DefaultXALogTable is the xa log table if it is not configured
+	DefaultXALogTable = "dbpack_xa_log"
+
+	createXALogTable = "CREATE TABLE IF NOT EXISTS `%s` (" +
+		"`gtrid` VARCHAR(128) NOT NULL," +
+		"`gmt_create` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP," +
+		"PRIMARY KEY (`gtrid`))"
+	insertXALog = "INSERT INTO `%s` (`gtrid`) VALUES ('%s')"
+	deleteXALog = "DELETE FROM `%s` WHERE `gtrid` = '%s'"
+	selectXALog = "SELECT `gtrid` FROM `%s` WHERE `gtrid` LIKE '%s%%'"
+	xaRecover   = "XA RECOVER"
+)
+
+var (
+	xaBootTime = time.Now().UnixNano()
+
+	// the instance id is a part of the gtrid, which is limited to 64 bytes, and a prefix of
+	// the LIKE pattern selecting the xa log, so `:`, `_` and `%` are not allowed.
+	xaInstanceIDPattern = regexp.MustCompile(`^[0-9A-Za-z.-]{1,32}$`)
+	xaLogTablePattern   = regexp.MustCompile(`^[0-9A-Za-z_$]{1,64}$`)
+)
+
+// XALog records the commit decisions of the XA transactions started by a dbpack instance.
+// The instance id must be unique among the dbpack instances sharing the db groups, and must not
+// change across restarts, otherwise the in-doubt branches of an instance could be resolved by
+// another one, or never be resolved.
+type XALog struct {
+	instanceID string
+	table      string
+	executor   proto.DBGroupExecutor
+	// committing holds the recorded gtrids being committed by their ComplexTx,
+	// RecoverXATransactions leaves them alone
+	committing sync.Map
+}
+
+// NewXALog creates the XALog of the instance, the xa log table is kept in the db group of executor.
+func NewXALog(instanceID string, executor proto.DBGroupExecutor, table string) (*XALog, error) {
+	if !xaInstanceIDPattern.MatchString(instanceID) {
+		return nil, errors.Errorf("invalid xa instance id %q, it should be 1 to 32 letters, digits, '.' or '-'", instanceID)
+	}
+	if executor == nil {
+		return nil, errors.New("xa log db group should not be nil")
+	}
+	if table == "" {
+		table = DefaultXALogTable
+	}
+	if !xaLogTablePattern.MatchString(table) {
+		return nil, errors.Errorf("invalid xa log table %q", table)
+	}
+	return &XALog{instanceID: instanceID, table: table, executor: executor}, nil
+}
+
+func (l *XALog) newGtrid(id uint32) string {
+	return fmt.Sprintf("%s:%s:%d", l.instanceID, strconv.FormatInt(xaBootTime, 36), id)
+}
+
+// parseGtrid returns the boot time of the instance which created the gtrid, ok is false
+// if the gtrid was not created by this instance.
+func (l *XALog) parseGtrid(gtrid string) (bootTime int64, ok bool) {
+	parts := strings.Split(gtrid, ":")
+	if len(parts) != 3 || parts[0] != l.instanceID {
+		return 0, false
+	}
+	bootTime, err := strconv.ParseInt(parts[1], 36, 64)
+	if err != nil {
+		return 0, false
+	}
+	return bootTime, true
+}
+
+func (l *XALog) record(ctx context.Context, gtrid string) error {
+	l.committing.Store(gtrid, struct{}{})
+	if _, _, err := l.executor.Query(proto.WithMaster(ctx), fmt.Sprintf(insertXALog, l.table, gtrid)); err != nil {
+		l.committing.Delete(gtrid)
+		return err
+	}
+	return nil
+}
+
+func (l *XALog) remove(ctx context.Context, gtrid string) error {
+	_, _, err := l.executor.Query(proto.WithMaster(ctx), fmt.Sprintf(deleteXALog, l.table, gtrid))
+	return err
+}
+
+// branchXID returns the xid of the branch in XA statements.
+func branchXID(gtrid, group string) string {
+	return fmt.Sprintf("'%s','%s'", gtrid, group)
+}
+
+func isXAErrNota(err error) bool {
+	sqlErr, ok := errors.Cause(err).(*err2.SQLError)
+	return ok && sqlErr.Num == mysql2.ErrXaerNota
+}
+
+// commitXA ends and prepares all branches, then records the commit decision and commits them.
+// If any branch fails to prepare, all branches are rolled back.
+func (tx *ComplexTx) commitXA(ctx context.Context) error {
+	var g errgroup.Group
+	for _, executor := range tx.executors {
+		group, child := executor.GroupName(), tx.txs[executor.GroupName()]
+		g.Go(func() error {
+			xid := branchXID(tx.xid, group)
+			if _, _, err := child.QueryDirectly(fmt.Sprintf("XA END %s", xid)); err != nil {
+				// the connection is still in the XA transaction, roll it back and release it
+				if _, rollbackErr := child.XAPrepare(ctx, fmt.Sprintf("XA ROLLBACK %s", xid)); rollbackErr != nil {
+					log.Errorf("rollback xa branch %s failed, err: %v", xid, rollbackErr)
+				}
+				return errors.Wrapf(err, "end xa branch %s failed", xid)
+			}
+			// the connection is kept until the branch is committed or rolled back
+			if _, _, err := child.QueryDirectly(fmt.Sprintf("XA PREPARE %s", xid)); err != nil {
+				return errors.Wrapf(err, "prepare xa branch %s failed", xid)
+			}
+			log.Debugf("DBGroup %s has prepared xa branch %s", group, xid)
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		if rollbackErr := tx.finishXABranches(ctx, false); rollbackErr != nil {
+			log.Errorf("rollback xa transaction %s failed, err: %v", tx.xid, rollbackErr)
+		}
+		return err
+	}
+
+	// a single branch is committed by XA COMMIT, which is the commit point itself
+	if len(tx.executors) > 1 {
+		if err := tx.xaLog.record(ctx, tx.xid); err != nil {
+			if rollbackErr := tx.finishXABranches(ctx, false); rollbackErr != nil {
+				log.Errorf("rollback xa transaction %s failed, err: %v", tx.xid, rollbackErr)
+			}
+			return errors.Wrapf(err, "record xa transaction %s failed", tx.xid)
+		}
+		defer tx.xaLog.committing.Delete(tx.xid)
+	}
+	if err := tx.finishXABranches(ctx, true); err != nil {
+		// the xa log is kept, the branches failed to commit are committed by RecoverXATransactions,
+		// except the ones unknown to mysql, they were rolled back and the transaction is partially committed
+		if isXAErrNota(err) || len(tx.executors) == 1 {
+			return errors.Wrapf(err, "commit xa transaction %s failed", tx.xid)
+		}
+		return nil
+	}
+	if len(tx.executors) > 1 {
+		if err := tx.xaLog.remove(ctx, tx.xid); err != nil {
+			log.Warnf("delete xa log %s failed, err: %v", tx.xid, err)
+		}
+	}
+	return nil
+}
+
+// finishXABranches commits or rolls back the prepared branches on their connections and releases
+// the connections, the failed ones are left to RecoverXATransactions. XAER_NOTA means the branch
+// failed to prepare and has been rolled back by mysql, it is an error on commit, and the error is
+// returned in preference to the others.
+func (tx *ComplexTx) finishXABranches(ctx context.Context, commit bool) error {
+	format := "XA ROLLBACK %s"
+	if commit {
+		format = "XA COMMIT %s"
+	}
+	var (
+		g    errgroup.Group
+		mu   sync.Mutex
+		nota error
+	)
+	for _, executor := range tx.executors {
+		group, child := executor.GroupName(), tx.txs[executor.GroupName()]
+		g.Go(func() error {
+			sql := fmt.Sprintf(format, branchXID(tx.xid, group))
+			// XAPrepare executes the statement and releases the connection, it does nothing if
+			// the branch has been rolled back and released on failure of XA END
+			if _, err := child.XAPrepare(ctx, sql); err != nil {
+				if isXAErrNota(err) {
+					if !commit {
+						return nil
+					}
+					mu.Lock()
+					nota = err
+					mu.Unlock()
+				}
+				log.Errorf("%s failed, err: %v", sql, err)
+				return err
+			}
+			return nil
+		})
+	}
+	err := g.Wait()
+	if nota != nil {
+		return nota
+	}
+	return err
+}
+
+// rollbackXA ends and rolls back all branches on their connections.
+func (tx *ComplexTx) rollbackXA(ctx context.Context) error {
+	var g errgroup.Group
+	for _, executor := range tx.executors {
+		group, child := executor.GroupName(), tx.txs[executor.GroupName()]
+		g.Go(func() error {
+			xid := branchXID(tx.xid, group)
+			if _, _, err := child.QueryDirectly(fmt.Sprintf("XA END %s", xid)); err != nil {
+				log.Warnf("end xa branch %s failed, err: %v", xid, err)
+			}
+			// XAPrepare executes the statement and releases the connection
+			if _, err := child.XAPrepare(ctx, fmt.Sprintf("XA ROLLBACK %s", xid)); err != nil {
+				log.Errorf("rollback xa branch %s failed, err: %v", xid, err)
+				return err
+			}
+			log.Debugf("DBGroup %s has rollbacked xa branch %s", group, xid)
+			return nil
+		})
+	}
+	return g.Wait()
+}
+
+// RecoverXATransactions resolves the prepared XA branches of this instance: branches whose gtrid
+// is in the xa log are committed; branches created before this instance started whose gtrid is
+// not in the xa log are rolled back. Branches of running transactions are not touched, so it is
+// safe to call it periodically.
+func RecoverXATransactions(ctx context.Context, xaLog *XALog, executors []proto.DBGroupExecutor) error {
+	ctx = proto.WithMaster(ctx)
+	if _, _, err := xaLog.executor.Query(ctx, fmt.Sprintf(createXALogTable, xaLog.table)); err != nil {
+		return errors.Wrapf(err, "create xa log table of db group %s failed", xaLog.executor.GroupName())
+	}
+	gtrids, err := queryStrings(ctx, xaLog.executor, fmt.Sprintf(selectXALog, xaLog.table, xaLog.instanceID+":"))
+	if err != nil {
+		return err
+	}
+	committed := make(map[string]bool)
+	for _, gtrid := range gtrids {
+		if _, ok := xaLog.committing.Load(gtrid); !ok {
+			committed[gtrid] = true
+		}
+	}
+
+	var lastErr error
+	for _, executor := range executors {
+		branches, err := recoverBranches(ctx, executor)
+		if err != nil {
+			return err
+		}
+		for _, branch := range branches {
+			bootTime, ok := xaLog.parseGtrid(branch.gtrid)
+			if !ok {
+				continue
+			}
+			var sql string
+			switch {
+			case committed[branch.gtrid]:
+				sql = fmt.Sprintf("XA COMMIT %s", branchXID(branch.gtrid, branch.bqual))
+			case bootTime != xaBootTime:
+				sql = fmt.Sprintf("XA ROLLBACK %s", branchXID(branch.gtrid, branch.bqual))
+			default:
+				continue
+			}
+			if _, _, err := executor.Query(ctx, sql); err != nil {
+				log.Errorf("recover xa branch failed, %s, err: %v", sql, err)
+				lastErr = err
+				continue
+			}
+			log.Infof("recover xa branch, %s", sql)
+		}
+	}
+	if lastErr != nil {
+		return lastErr
+	}
+
+	// the branches of the recorded transactions have been committed
+	for gtrid := range committed {
+		if err := xaLog.remove(ctx, gtrid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type xaBranch struct {
+	gtrid string
+	bqual string
+}
+
+// recoverBranches returns the prepared branches of the db group.
+func recoverBranches(ctx context.Context, executor proto.DBGroupExecutor) ([]*xaBranch, error) {
+	rows, err := queryRows(ctx, executor, xaRecover)
+	if err != nil {
+		return nil, err
+	}
+	var branches []*xaBranch
+	for _, row := range rows {
+		// formatID, gtrid_length, bqual_length, data
+		if len(row) != 4 {
+			return nil, errors.Errorf("unexpected columns of %s", xaRecover)
+		}
+		gtridLength, err := strconv.Atoi(row[1])
+		if err != nil {
+			return nil, err
+		}
+		bqualLength, err := strconv.Atoi(row[2])
+		if err != nil {
+			return nil, err
+		}
+		if gtridLength+bqualLength != len(row[3]) {
+			continue
+		}
+		branches = append(branches, &xaBranch{gtrid: row[3][:gtridLength], bqual: row[3][gtridLength:]})
+	}
+	return branches, nil
+}
+
+func queryStrings(ctx context.Context, executor proto.DBGroupExecutor, sql string) ([]string, error) {
+	rows, err := queryRows(ctx, executor, sql)
+	if err != nil {
+		return nil, err
+	}
+	values := make([]string, 0, len(rows))
+	for _, row := range rows {
+		values = append(values, row[0])
+	}
+	return values, nil
+}
+
+func queryRows(ctx context.Context, executor proto.DBGroupExecutor, sql string) ([][]string, error) {
+	result, _, err := executor.Query(ctx, sql)
+	if err != nil {
+		return nil, errors.Wrapf(err, "%s on db group %s failed", sql, executor.GroupName())
+	}
+	rlt, ok := result.(*mysql.Result)
+	if !ok {
+		return nil, errors.Errorf("unexpected result of %s", sql)
+	}
+	rows := make([][]string, 0, len(rlt.Rows))
+	for _, row := range rlt.Rows {
+		values, err := row.Decode()
+		if err != nil {
+			return nil, err
+		}
+		columns := make([]string, 0, len(values))
+		for _, value := range values {
+			if value == nil || value.Val == nil {
+				columns = append(columns, "")
+				continue
+			}
+			switch val := value.Val.(type) {
+			case []byte:
+				columns = append(columns, string(val))
+			default:
+				columns = append(columns, fmt.Sprintf("%v", val))
+			}
+		}
+		rows = append(rows, columns)
+	}
+	return rows, nil
+}
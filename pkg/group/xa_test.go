@@ -0,0 +1,256 @@
+/*
+ * Copyright 2022 CECTC, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package group
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/cectc/dbpack/pkg/config"
+	"github.com/cectc/dbpack/pkg/constant"
+	err2 "github.com/cectc/dbpack/pkg/errors"
+	"github.com/cectc/dbpack/pkg/mysql"
+	"github.com/cectc/dbpack/pkg/proto"
+)
+
+type mockXAExecutor struct {
+	proto.DBGroupExecutor
+	name string
+	// sqls executed on the group
+	sqls []string
+	// sqls executed in the XA transaction
+	txSqls      []string
+	prepareFail bool
+	commitNota  bool
+	recovered   [][]string
+	logs        []string
+}
+
+func (e *mockXAExecutor) GroupName() string {
+	return e.name
+}
+
+func (e *mockXAExecutor) XAStart(ctx context.Context, sql string) (proto.Tx, proto.Result, error) {
+	e.txSqls = append(e.txSqls, sql)
+	return &mockXATx{executor: e}, nil, nil
+}
+
+func (e *mockXAExecutor) Query(ctx context.Context, query string) (proto.Result, uint16, error) {
+	e.sqls = append(e.sqls, query)
+	switch {
+	case query == xaRecover:
+		return mockStringResult(e.recovered), 0, nil
+	case strings.HasPrefix(query, "SELECT"):
+		var rows [][]string
+		for _, gtrid := range e.logs {
+			rows = append(rows, []string{gtrid})
+		}
+		return mockStringResult(rows), 0, nil
+	}
+	return &mysql.Result{}, 0, nil
+}
+
+// mockXATx is the connection of an XA branch, XAPrepare releases it
+type mockXATx struct {
+	proto.Tx
+	executor *mockXAExecutor
+	released bool
+}
+
+func (tx *mockXATx) QueryDirectly(query string) (proto.Result, uint16, error) {
+	tx.executor.txSqls = append(tx.executor.txSqls, query)
+	if tx.executor.prepareFail && strings.HasPrefix(query, "XA PREPARE") {
+		return nil, 0, &err2.SQLError{Num: 1614, Message: "XA_RBDEADLOCK: Transaction branch was rolled back: deadlock was detected"}
+	}
+	return &mysql.Result{}, 0, nil
+}
+
+func (tx *mockXATx) XAPrepare(ctx context.Context, sql string) (proto.Result, error) {
+	if tx.released {
+		return nil, nil
+	}
+	tx.released = true
+	tx.executor.txSqls = append(tx.executor.txSqls, sql)
+	if strings.HasPrefix(sql, "XA ROLLBACK") && tx.executor.prepareFail ||
+		strings.HasPrefix(sql, "XA COMMIT") && tx.executor.commitNota {
+		return nil, &err2.SQLError{Num: 1397, Message: "XAER_NOTA: Unknown XID"}
+	}
+	return &mysql.Result{}, nil
+}
+
+func mockStringResult(rows [][]string) *mysql.Result {
+	result := &mysql.Result{}
+	for _, row := range rows {
+		fields := make([]*mysql.Field, len(row))
+		values := make([]*proto.Value, len(row))
+		for i, val := range row {
+			fields[i] = &mysql.Field{FieldType: constant.FieldTypeVarString}
+			values[i] = &proto.Value{Typ: constant.FieldTypeVarString, Val: []byte(val), Raw: []byte(val)}
+		}
+		result.Rows = append(result.Rows, mysql.NewTextRow(fields, values))
+	}
+	return result
+}
+
+func newTestXALog(t *testing.T, executor proto.DBGroupExecutor) *XALog {
+	xaLog, err := NewXALog("dbpack-1", executor, "")
+	assert.Nil(t, err)
+	return xaLog
+}
+
+func TestNewXALog(t *testing.T) {
+	executor := &mockXAExecutor{name: "world_0"}
+	_, err := NewXALog("", executor, "")
+	assert.NotNil(t, err)
+	_, err = NewXALog("dbpack_1", executor, "")
+	assert.NotNil(t, err)
+	_, err = NewXALog("dbpack:1", executor, "")
+	assert.NotNil(t, err)
+	_, err = NewXALog("dbpack-1", nil, "")
+	assert.NotNil(t, err)
+	_, err = NewXALog("dbpack-1", executor, "xa log")
+	assert.NotNil(t, err)
+	xaLog, err := NewXALog("dbpack-1", executor, "xa_log")
+	assert.Nil(t, err)
+	assert.Equal(t, "xa_log", xaLog.table)
+}
+
+func TestGtrid(t *testing.T) {
+	xaLog := newTestXALog(t, &mockXAExecutor{name: "world_0"})
+	gtrid := xaLog.newGtrid(12)
+	assert.LessOrEqual(t, len(gtrid), 64)
+	bootTime, ok := xaLog.parseGtrid(gtrid)
+	assert.True(t, ok)
+	assert.Equal(t, xaBootTime, bootTime)
+	assert.Equal(t, fmt.Sprintf("'%s','world_0'", gtrid), branchXID(gtrid, "world_0"))
+
+	_, ok = xaLog.parseGtrid("dbpack-2:abc:12")
+	assert.False(t, ok)
+	_, ok = xaLog.parseGtrid("gtrid")
+	assert.False(t, ok)
+}
+
+func TestComplexTxCommitXA(t *testing.T) {
+	logExecutor := &mockXAExecutor{name: "world_log"}
+	executors := []*mockXAExecutor{{name: "world_0"}, {name: "world_1"}}
+	tx := NewDistributedComplexTx("svc", nil, config.XATransaction, newTestXALog(t, logExecutor)).(*ComplexTx)
+	gtrid := tx.xid
+	for _, executor := range executors {
+		_, err := tx.Begin(context.Background(), executor)
+		assert.Nil(t, err)
+	}
+	_, err := tx.Commit(context.Background())
+	assert.Nil(t, err)
+
+	// the branches are committed on the connections which prepared them
+	for _, executor := range executors {
+		xid := branchXID(gtrid, executor.name)
+		assert.Equal(t, []string{"XA START " + xid, "XA END " + xid, "XA PREPARE " + xid, "XA COMMIT " + xid}, executor.txSqls)
+		assert.Empty(t, executor.sqls)
+	}
+	for _, child := range tx.txs {
+		assert.True(t, child.(*mockXATx).released)
+	}
+	assert.Equal(t, []string{
+		fmt.Sprintf(insertXALog, DefaultXALogTable, gtrid),
+		fmt.Sprintf(deleteXALog, DefaultXALogTable, gtrid),
+	}, logExecutor.sqls)
+	_, committing := tx.xaLog.committing.Load(gtrid)
+	assert.False(t, committing)
+}
+
+func TestComplexTxCommitXANota(t *testing.T) {
+	logExecutor := &mockXAExecutor{name: "world_log"}
+	executors := []*mockXAExecutor{{name: "world_0"}, {name: "world_1", commitNota: true}}
+	tx := NewDistributedComplexTx("svc", nil, config.XATransaction, newTestXALog(t, logExecutor)).(*ComplexTx)
+	gtrid := tx.xid
+	for _, executor := range executors {
+		_, err := tx.Begin(context.Background(), executor)
+		assert.Nil(t, err)
+	}
+	_, err := tx.Commit(context.Background())
+	assert.NotNil(t, err)
+	assert.True(t, isXAErrNota(err))
+	// the xa log is kept
+	assert.Equal(t, []string{fmt.Sprintf(insertXALog, DefaultXALogTable, gtrid)}, logExecutor.sqls)
+}
+
+func TestComplexTxCommitXAPrepareFailed(t *testing.T) {
+	logExecutor := &mockXAExecutor{name: "world_log"}
+	executors := []*mockXAExecutor{{name: "world_0"}, {name: "world_1", prepareFail: true}}
+	tx := NewDistributedComplexTx("svc", nil, config.XATransaction, newTestXALog(t, logExecutor)).(*ComplexTx)
+	gtrid := tx.xid
+	for _, executor := range executors {
+		_, err := tx.Begin(context.Background(), executor)
+		assert.Nil(t, err)
+	}
+	_, err := tx.Commit(context.Background())
+	assert.NotNil(t, err)
+	for _, executor := range executors {
+		xid := branchXID(gtrid, executor.name)
+		assert.Equal(t, []string{"XA START " + xid, "XA END " + xid, "XA PREPARE " + xid, "XA ROLLBACK " + xid}, executor.txSqls)
+		assert.Empty(t, executor.sqls)
+	}
+	assert.Empty(t, logExecutor.sqls)
+}
+
+func TestComplexTxRollbackXA(t *testing.T) {
+	executor := &mockXAExecutor{name: "world_0"}
+	tx := NewDistributedComplexTx("svc", nil, config.XATransaction, newTestXALog(t, executor)).(*ComplexTx)
+	xid := branchXID(tx.xid, "world_0")
+	_, err := tx.Begin(context.Background(), executor)
+	assert.Nil(t, err)
+	_, err = tx.Rollback(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"XA START " + xid, "XA END " + xid, "XA ROLLBACK " + xid}, executor.txSqls)
+	assert.Empty(t, executor.sqls)
+}
+
+func TestRecoverXATransactions(t *testing.T) {
+	executors := []*mockXAExecutor{{name: "world_0"}, {name: "world_1"}}
+	xaLog := newTestXALog(t, executors[0])
+	committed := xaLog.newGtrid(1)
+	running := xaLog.newGtrid(2)
+	committing := xaLog.newGtrid(3)
+	xaLog.committing.Store(committing, struct{}{})
+	crashed := fmt.Sprintf("%s:%s:%d", xaLog.instanceID, "abc", 4)
+	other := "dbpack-2:abc:5"
+	branch := func(gtrid, bqual string) []string {
+		return []string{"1", fmt.Sprint(len(gtrid)), fmt.Sprint(len(bqual)), gtrid + bqual}
+	}
+	executors[0].logs = []string{committed, committing}
+	executors[0].recovered = [][]string{branch(running, "world_0"), branch(crashed, "world_0"), branch(committing, "world_0")}
+	executors[1].recovered = [][]string{branch(committed, "world_1"), branch(other, "world_1")}
+
+	err := RecoverXATransactions(context.Background(), xaLog, []proto.DBGroupExecutor{executors[0], executors[1]})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		fmt.Sprintf(createXALogTable, DefaultXALogTable),
+		fmt.Sprintf(selectXALog, DefaultXALogTable, "dbpack-1:"),
+		xaRecover,
+		"XA ROLLBACK " + branchXID(crashed, "world_0"),
+		fmt.Sprintf(deleteXALog, DefaultXALogTable, committed),
+	}, executors[0].sqls)
+	assert.Equal(t, []string{
+		xaRecover,
+		"XA COMMIT " + branchXID(committed, "world_1"),
+	}, executors[1].sqls)
+}
@@ -0,0 +1,247 @@
+/*
+ * Copyright 2022 CECTC, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package listener
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/pem"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/cectc/dbpack/pkg/auth"
+	"github.com/cectc/dbpack/pkg/constant"
+	err2 "github.com/cectc/dbpack/pkg/errors"
+	"github.com/cectc/dbpack/pkg/log"
+	"github.com/cectc/dbpack/pkg/mysql"
+)
+
+const (
+	rsaKeyBits = 2048
+
+	// getCredentialTimeout bounds looking up the credential of a user from the auth provider
+	getCredentialTimeout = 5 * time.Second
+)
+
+// rsaKey is the key pair used by the full authentication of caching_sha2_password
+// on insecure connections, the key is generated on first use if not configured.
+type rsaKey struct {
+	once      sync.Once
+	key       *rsa.PrivateKey
+	publicKey []byte
+	err       error
+}
+
+func newRSAKey(path string) (*rsaKey, error) {
+	key := &rsaKey{}
+	if path == "" {
+		return key, nil
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "read rsa private key failed")
+	}
+	block, _ := pem.Decode(content)
+	if block == nil {
+		return nil, errors.Errorf("no pem data found in %s", path)
+	}
+	var privateKey interface{}
+	if block.Type == "RSA PRIVATE KEY" {
+		privateKey, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	} else {
+		privateKey, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "parse rsa private key failed")
+	}
+	rsaPrivateKey, ok := privateKey.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.Errorf("%s is not a rsa private key", path)
+	}
+	key.once.Do(func() {
+		key.key = rsaPrivateKey
+		key.publicKey, key.err = encodePublicKey(rsaPrivateKey)
+	})
+	if key.err != nil {
+		return nil, key.err
+	}
+	return key, nil
+}
+
+func (k *rsaKey) get() (*rsa.PrivateKey, []byte, error) {
+	k.once.Do(func() {
+		k.key, k.err = rsa.GenerateKey(rand.Reader, rsaKeyBits)
+		if k.err == nil {
+			k.publicKey, k.err = encodePublicKey(k.key)
+		}
+	})
+	return k.key, k.publicKey, k.err
+}
+
+func encodePublicKey(key *rsa.PrivateKey) ([]byte, error) {
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "marshal rsa public key failed")
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), nil
+}
+
+// authenticate verifies the auth response of the client, if the auth method of the client can't
+// verify the credential of the user, the client is asked to switch to another auth method.
+func (l *MysqlListener) authenticate(c *mysql.Conn, user, authMethod string, authResponse, salt []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), getCredentialTimeout)
+	defer cancel()
+	credential, err := l.authProvider.GetCredential(ctx, user, remoteHost(c))
+	if err != nil {
+		log.Errorf("get credential of user %s failed, err: %v", user, err)
+		return accessDenied(user)
+	}
+	if credential == nil {
+		return accessDenied(user)
+	}
+
+	if !credential.Supports(authMethod) {
+		authMethod = l.authPlugin
+		if !credential.Supports(authMethod) {
+			if authMethod == constant.MysqlNativePassword {
+				authMethod = constant.CachingSha2Password
+			} else {
+				authMethod = constant.MysqlNativePassword
+			}
+		}
+		if authResponse, err = l.switchAuthMethod(c, authMethod, salt); err != nil {
+			return err
+		}
+	}
+
+	switch authMethod {
+	case constant.MysqlNativePassword:
+		if credential.VerifyNative(salt, authResponse) {
+			return nil
+		}
+	case constant.CachingSha2Password:
+		return l.cachingSha2Authenticate(c, user, credential, authResponse, salt)
+	}
+	return accessDenied(user)
+}
+
+// switchAuthMethod sends AuthSwitchRequest, and returns the auth response of the new method.
+func (l *MysqlListener) switchAuthMethod(c *mysql.Conn, authMethod string, salt []byte) ([]byte, error) {
+	data := make([]byte, 0, 1+len(authMethod)+1+len(salt)+1)
+	data = append(data, constant.AuthSwitchRequestPacket)
+	data = append(data, authMethod...)
+	data = append(data, 0)
+	data = append(data, salt...)
+	data = append(data, 0)
+	if err := c.WritePacket(data); err != nil {
+		return nil, err
+	}
+	return c.ReadPacket()
+}
+
+// cachingSha2Authenticate performs the fast authentication of caching_sha2_password if the
+// SHA256(SHA256(password)) of the user is known, otherwise the full authentication, in which the
+// password is sent over TLS, or encrypted by the RSA public key on insecure connections.
+func (l *MysqlListener) cachingSha2Authenticate(c *mysql.Conn, user string, credential *auth.Credential,
+	authResponse, salt []byte) error {
+	if credential.Empty {
+		if len(authResponse) == 0 {
+			return nil
+		}
+		return accessDenied(user)
+	}
+
+	cacheKey := user + "\x00" + credential.SHA2Crypt
+	hash := credential.SHA2Hash
+	if hash == nil {
+		if cached, ok := l.sha2Cache.Load(cacheKey); ok {
+			hash = cached.([]byte)
+		}
+	}
+	if hash != nil {
+		if !auth.VerifySHA2Scramble(hash, salt, authResponse) {
+			return accessDenied(user)
+		}
+		return c.WritePacket([]byte{constant.AuthMoreDataPacket, constant.CachingSha2FastAuthSuccess})
+	}
+
+	if err := c.WritePacket([]byte{constant.AuthMoreDataPacket, constant.CachingSha2PerformFullAuthentication}); err != nil {
+		return err
+	}
+	data, err := c.ReadPacket()
+	if err != nil {
+		return err
+	}
+	var password []byte
+	if c.IsTLS() {
+		password = bytes.TrimRight(data, "\x00")
+	} else {
+		key, publicKey, err := l.rsaKey.get()
+		if err != nil {
+			return errors.Wrap(err, "generate rsa key failed")
+		}
+		// a client configured with the public key, e.g. by --server-public-key-path, sends the
+		// encrypted password without requesting the public key
+		if len(data) == 1 && data[0] == constant.CachingSha2RequestPublicKey {
+			if err = c.WritePacket(append([]byte{constant.AuthMoreDataPacket}, publicKey...)); err != nil {
+				return err
+			}
+			if data, err = c.ReadPacket(); err != nil {
+				return err
+			}
+		} else if len(data) != key.Size() {
+			return accessDenied(user)
+		}
+		plain, err := rsa.DecryptOAEP(sha1.New(), rand.Reader, key, data, nil)
+		if err != nil {
+			log.Warnf("decrypt password of user %s failed, err: %v", user, err)
+			return accessDenied(user)
+		}
+		for i := range plain {
+			plain[i] ^= salt[i%len(salt)]
+		}
+		password = bytes.TrimRight(plain, "\x00")
+	}
+
+	if !credential.VerifyPassword(password) {
+		return accessDenied(user)
+	}
+	l.sha2Cache.Store(cacheKey, auth.SHA2Hash(password))
+	return nil
+}
+
+func accessDenied(user string) error {
+	return err2.NewSQLError(constant.ERAccessDeniedError, constant.SSAccessDeniedError, "Access denied for user '%v'", user)
+}
+
+// remoteHost returns the ip of the client
+func remoteHost(c *mysql.Conn) string {
+	addr := c.RemoteAddr().String()
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
@@ -0,0 +1,151 @@
+/*
+ * Copyright 2022 CECTC, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package listener
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/cectc/dbpack/pkg/constant"
+	"github.com/cectc/dbpack/pkg/driver"
+	err2 "github.com/cectc/dbpack/pkg/errors"
+)
+
+// sha2Crypt is the caching_sha2_password hash of "123456" stored in mysql.user
+const sha2Crypt = "$A$005$0123456789abcdefghij8JUwnZtR7jdsnhK9/Uh0eOKPK/TzSQjaA3BR/YQgAlD"
+
+func connectByDriver(l *MysqlListener, user, password string) error {
+	connector, err := driver.NewConnector("test", fmt.Sprintf("%s:%s@tcp(%s)/", user, password, l.listener.Addr()))
+	if err != nil {
+		return err
+	}
+	conn, err := connector.NewBackendConnection(context.Background())
+	if err != nil {
+		return err
+	}
+	conn.Close()
+	return nil
+}
+
+func countCachedHashes(l *MysqlListener) int {
+	count := 0
+	l.sha2Cache.Range(func(key, value interface{}) bool {
+		count++
+		return true
+	})
+	return count
+}
+
+func TestCachingSha2PasswordAuthentication(t *testing.T) {
+	l := startListener(t, map[string]interface{}{
+		"default_auth_plugin": constant.CachingSha2Password,
+	})
+
+	// SHA256(SHA256(password)) of plaintext passwords is known, clients pass the fast authentication
+	assert.Nil(t, connectByDriver(l, "dksl", "123456"))
+	assert.Equal(t, 0, countCachedHashes(l))
+
+	err := connectByDriver(l, "dksl", "654321")
+	assert.NotNil(t, err)
+	sqlErr, ok := err.(*err2.SQLError)
+	assert.True(t, ok)
+	assert.Equal(t, constant.ERAccessDeniedError, sqlErr.Num)
+
+	err = connectByDriver(l, "unknown", "123456")
+	assert.NotNil(t, err)
+}
+
+func TestCachingSha2PasswordCrypt(t *testing.T) {
+	l := startListener(t, map[string]interface{}{
+		"users":               map[string]string{"dksl": sha2Crypt},
+		"default_auth_plugin": constant.CachingSha2Password,
+	})
+	// the first connection performs the full authentication with the rsa public key
+	assert.Nil(t, connectByDriver(l, "dksl", "123456"))
+	assert.Equal(t, 1, countCachedHashes(l))
+	// the following connections pass the fast authentication
+	assert.Nil(t, connectByDriver(l, "dksl", "123456"))
+	assert.NotNil(t, connectByDriver(l, "dksl", "654321"))
+	assert.Equal(t, 1, countCachedHashes(l))
+}
+
+func TestCachingSha2PasswordServerPublicKey(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, rsaKeyBits)
+	assert.Nil(t, err)
+	path := filepath.Join(t.TempDir(), "private_key.pem")
+	assert.Nil(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(key),
+	}), 0600))
+	l := startListener(t, map[string]interface{}{
+		"users":                map[string]string{"dksl": sha2Crypt},
+		"default_auth_plugin":  constant.CachingSha2Password,
+		"rsa_private_key_file": path,
+	})
+
+	// the client knowing the public key sends the encrypted password without requesting the key
+	driver.RegisterServerPubKey("listener", &key.PublicKey)
+	defer driver.DeregisterServerPubKey("listener")
+	connector, err := driver.NewConnector("test",
+		fmt.Sprintf("dksl:123456@tcp(%s)/?serverPubKey=listener", l.listener.Addr()))
+	assert.Nil(t, err)
+	conn, err := connector.NewBackendConnection(context.Background())
+	assert.Nil(t, err)
+	conn.Close()
+	assert.Equal(t, 1, countCachedHashes(l))
+}
+
+func TestAuthSwitch(t *testing.T) {
+	// the native hash of "123456", the client is asked to switch to mysql_native_password
+	l := startListener(t, map[string]interface{}{
+		"users":               map[string]string{"dksl": "*6BB4837EB74329105EE4568DDA7DC67ED2CA2AD9"},
+		"default_auth_plugin": constant.CachingSha2Password,
+	})
+	assert.Nil(t, connectByDriver(l, "dksl", "123456"))
+	assert.NotNil(t, connectByDriver(l, "dksl", "654321"))
+	assert.Equal(t, 0, countCachedHashes(l))
+
+	// the client starts with mysql_native_password, and is asked to switch to caching_sha2_password
+	l = startListener(t, map[string]interface{}{
+		"users": map[string]string{"dksl": sha2Crypt},
+	})
+	response, err := connect(l.listener.Addr().String(), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, byte(constant.AuthSwitchRequestPacket), response[0])
+
+	assert.Nil(t, connectByDriver(l, "dksl", "123456"))
+}
+
+func TestAccessDeniedPacket(t *testing.T) {
+	l := startListener(t, map[string]interface{}{
+		"users": map[string]string{"dksl": "654321"},
+	})
+	response, err := connect(l.listener.Addr().String(), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, byte(constant.ErrPacket), response[0])
+	assert.Equal(t, uint16(constant.ERAccessDeniedError), binary.LittleEndian.Uint16(response[1:]))
+}
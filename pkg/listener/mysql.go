@@ -20,18 +20,20 @@ import (
 	"bytes"
 	"context"
 	"crypto/rand"
-	"crypto/sha1"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/binary"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net"
+	"os"
 	"strings"
 	"sync"
 
 	"github.com/pkg/errors"
-	"github.com/uber-go/atomic"
 
+	"github.com/cectc/dbpack/pkg/auth"
 	"github.com/cectc/dbpack/pkg/config"
 	"github.com/cectc/dbpack/pkg/constant"
 	err2 "github.com/cectc/dbpack/pkg/errors"
@@ -43,13 +45,38 @@ import (
 	"github.com/cectc/dbpack/pkg/tracing"
 	"github.com/cectc/dbpack/pkg/visitor"
 	"github.com/cectc/dbpack/third_party/parser"
+	"github.com/cectc/dbpack/third_party/parser/ast"
 )
 
 const initClientConnStatus = constant.ServerStatusAutocommit
 
 type MysqlConfig struct {
-	Users         map[string]string `yaml:"users" json:"users"`
-	ServerVersion string            `yaml:"server_version" json:"server_version"`
+	// Users is the password of users, a password can be plaintext, or the hash of
+	// mysql_native_password and caching_sha2_password stored in mysql.user
+	Users         map[string]string    `yaml:"users" json:"users"`
+	ServerVersion string               `yaml:"server_version" json:"server_version"`
+	TLS           *TLSConfig           `yaml:"tls" json:"tls"`
+	AuthProvider  *auth.ProviderConfig `yaml:"auth_provider" json:"auth_provider"`
+	// DefaultAuthPlugin is the auth plugin in the initial handshake, mysql_native_password
+	// or caching_sha2_password, defaults to mysql_native_password
+	DefaultAuthPlugin string `yaml:"default_auth_plugin" json:"default_auth_plugin"`
+	// RSAPrivateKeyFile is used to decrypt the password of caching_sha2_password full
+	// authentication on insecure connections, a key is generated if not specified
+	RSAPrivateKeyFile string `yaml:"rsa_private_key_file" json:"rsa_private_key_file"`
+	// StatementCacheSize is the capacity of the parsed statement cache, 0 means the default capacity
+	StatementCacheSize int `yaml:"statement_cache_size" json:"statement_cache_size"`
+}
+
+// TLSConfig is the TLS settings of the mysql listener
+type TLSConfig struct {
+	CertFile string `yaml:"cert_file" json:"cert_file"`
+	KeyFile  string `yaml:"key_file" json:"key_file"`
+	// CAFile is the certificate authority to verify the client certificates
+	CAFile string `yaml:"ca_file" json:"ca_file"`
+	// RequireSecureTransport rejects the clients not using TLS
+	RequireSecureTransport bool `yaml:"require_secure_transport" json:"require_secure_transport"`
+	// VerifyClientCert requires the clients to present certificates signed by the CA
+	VerifyClientCert bool `yaml:"verify_client_cert" json:"verify_client_cert"`
 }
 
 type MysqlListener struct {
@@ -59,6 +86,18 @@ type MysqlListener struct {
 	// This is the main listener socket.
 	listener net.Listener
 
+	// tlsConfig is nil if TLS is not enabled
+	tlsConfig *tls.Config
+
+	authProvider auth.Provider
+	authPlugin   string
+	rsaKey       *rsaKey
+	// sha2Cache caches SHA256(SHA256(password)) of the users passed the full authentication
+	// of caching_sha2_password, so that they can pass the fast authentication next time
+	sha2Cache *sync.Map
+	// statements caches the parsed statements of COM_QUERY
+	statements *statementCache
+
 	executor proto.Executor
 
 	// Incrementing ID for connection id.
@@ -67,15 +106,6 @@ type MysqlListener struct {
 	// Reads are unbuffered if it's <=0.
 	connReadBufferSize int
 
-	// capabilities is the current set of features this connection
-	// is using.  It is the features that are both supported by
-	// the client and the server, and currently in use.
-	// It is set during the initial handshake.
-	//
-	// It is only used for CapabilityClientDeprecateEOF
-	// and CapabilityClientFoundRows.
-	capabilities uint32
-
 	// characterSet is the character set used by the other side of the
 	// connection.
 	// It is set during the initial handshake.
@@ -88,12 +118,6 @@ type MysqlListener struct {
 	// non-authoritative: the client can change the schema name
 	// through the 'USE' statement, which will bypass this variable.
 	schemaName string
-
-	// statementID is the prepared statement ID.
-	statementID *atomic.Uint32
-
-	// stmts is the map to use a prepared statement.
-	stmts *sync.Map
 }
 
 func NewMysqlListener(conf *config.Listener) (proto.Listener, error) {
@@ -111,6 +135,27 @@ func NewMysqlListener(conf *config.Listener) (proto.Listener, error) {
 		return nil, err
 	}
 
+	tlsConfig, err := newTLSConfig(cfg.TLS)
+	if err != nil {
+		return nil, err
+	}
+
+	authProvider, err := auth.NewProvider(conf.AppID, cfg.AuthProvider, cfg.Users)
+	if err != nil {
+		return nil, err
+	}
+	switch cfg.DefaultAuthPlugin {
+	case "":
+		cfg.DefaultAuthPlugin = constant.MysqlNativePassword
+	case constant.MysqlNativePassword, constant.CachingSha2Password:
+	default:
+		return nil, errors.Errorf("unsupported auth plugin %s", cfg.DefaultAuthPlugin)
+	}
+	key, err := newRSAKey(cfg.RSAPrivateKeyFile)
+	if err != nil {
+		return nil, err
+	}
+
 	l, err := net.Listen("tcp", fmt.Sprintf("%s:%d", conf.SocketAddress.Address, conf.SocketAddress.Port))
 	if err != nil {
 		log.Errorf("listen %s:%d error, %s", conf.SocketAddress.Address, conf.SocketAddress.Port, err)
@@ -118,14 +163,52 @@ func NewMysqlListener(conf *config.Listener) (proto.Listener, error) {
 	}
 
 	listener := &MysqlListener{
-		conf:        cfg,
-		listener:    l,
-		statementID: atomic.NewUint32(0),
-		stmts:       &sync.Map{},
+		conf:         cfg,
+		listener:     l,
+		tlsConfig:    tlsConfig,
+		authProvider: authProvider,
+		authPlugin:   cfg.DefaultAuthPlugin,
+		rsaKey:       key,
+		sha2Cache:    &sync.Map{},
+		statements:   newStatementCache(cfg.StatementCacheSize),
 	}
 	return listener, nil
 }
 
+// newTLSConfig loads the certificates of the mysql listener, it returns nil if TLS is not configured.
+func newTLSConfig(conf *TLSConfig) (*tls.Config, error) {
+	if conf == nil {
+		return nil, nil
+	}
+	cert, err := tls.LoadX509KeyPair(conf.CertFile, conf.KeyFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "load mysql listener certificate failed")
+	}
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if conf.CAFile != "" {
+		ca, err := os.ReadFile(conf.CAFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "read mysql listener ca failed")
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, errors.Errorf("no certificate found in %s", conf.CAFile)
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	if conf.VerifyClientCert {
+		if tlsConfig.ClientCAs == nil {
+			return nil, errors.New("ca_file is required to verify client certificates")
+		}
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return tlsConfig, nil
+}
+
 func (l *MysqlListener) SetExecutor(executor proto.Executor) {
 	l.executor = executor
 }
@@ -163,6 +246,7 @@ func (l *MysqlListener) handle(conn net.Conn, connectionID uint32) {
 		if err := conn.Close(); err != nil {
 			log.Errorf("connection close error, connection id: %v, error: %s", l.connectionID, err)
 		}
+		c.ClearStmts()
 		l.executor.ConnectionClose(proto.WithConnectionID(context.Background(), l.connectionID))
 	}()
 
@@ -183,6 +267,9 @@ func (l *MysqlListener) handle(conn net.Conn, connectionID uint32) {
 	}
 	log.Debugf("connection established, id: %d", connectionID)
 
+	// session keeps the session variables and schema of the client, they are applied to
+	// the backend connections borrowed for the client.
+	session := proto.NewSession()
 	for {
 		c.ResetSequence()
 		var data []byte
@@ -199,6 +286,7 @@ func (l *MysqlListener) handle(conn net.Conn, connectionID uint32) {
 		ctx = proto.WithUserName(ctx, c.UserName())
 		ctx = proto.WithRemoteAddr(ctx, c.RemoteAddr().String())
 		ctx = proto.WithSchema(ctx, l.schemaName)
+		ctx = proto.WithSession(ctx, session)
 		err = l.ExecuteCommand(ctx, c, content)
 		if err != nil {
 			return
@@ -212,7 +300,7 @@ func (l *MysqlListener) handshake(c *mysql.Conn) error {
 		return err
 	}
 	// First build and send the server handshake packet.
-	err = l.writeHandshakeV10(c, false, salt)
+	err = l.writeHandshakeV10(c, l.tlsConfig != nil, salt)
 	if err != nil {
 		if err != io.EOF {
 			log.Errorf("Cannot send HandshakeV10 packet to %s: %v", c, err)
@@ -233,15 +321,35 @@ func (l *MysqlListener) handshake(c *mysql.Conn) error {
 
 	c.RecycleReadPacket()
 
-	user, _, authResponse, err := l.parseClientHandshakePacket(true, response)
+	user, authMethod, authResponse, err := l.parseClientHandshakePacket(c, true, response)
 	if err != nil {
 		log.Errorf("Cannot parse client handshake response from %s: %v", c, err)
 		return err
 	}
 
-	err = l.ValidateHash(user, salt, authResponse)
+	if c.IsTLS() {
+		// SSL was enabled, the client sends the handshake response again over TLS.
+		response, err = c.ReadEphemeralPacket()
+		if err != nil {
+			if err != io.EOF {
+				log.Infof("Cannot read client handshake response from %s over TLS: %v", c, err)
+			}
+			return err
+		}
+		user, authMethod, authResponse, err = l.parseClientHandshakePacket(c, false, response)
+		c.RecycleReadPacket()
+		if err != nil {
+			log.Errorf("Cannot parse client handshake response from %s: %v", c, err)
+			return err
+		}
+	} else if l.conf.TLS != nil && l.conf.TLS.RequireSecureTransport {
+		return err2.NewSQLError(constant.ERSecureTransportRequired, constant.SSUnknownSQLState,
+			"Connections using insecure transport are prohibited while --require_secure_transport=ON.")
+	}
+
+	err = l.authenticate(c, user, authMethod, authResponse, salt)
 	if err != nil {
-		log.Errorf("Error authenticating user using MySQL native password: %v", err)
+		log.Errorf("Error authenticating user %s: %v", user, err)
 		return err
 	}
 	c.SetUserName(user)
@@ -281,7 +389,7 @@ func (l *MysqlListener) writeHandshakeV10(c *mysql.Conn, enableTLS bool, salt []
 			1 + // length of auth plugin Content
 			10 + // reserved (0)
 			13 + // auth-plugin-Content
-			misc.LenNullString(constant.MysqlNativePassword) // auth-plugin-name
+			misc.LenNullString(l.authPlugin) // auth-plugin-name
 
 	data := c.StartEphemeralPacket(length)
 	pos := 0
@@ -324,8 +432,8 @@ func (l *MysqlListener) writeHandshakeV10(c *mysql.Conn, enableTLS bool, salt []
 	data[pos] = 0
 	pos++
 
-	// Copy authPluginName. We always start with mysql_native_password.
-	pos = misc.WriteNullString(data, pos, constant.MysqlNativePassword)
+	// Copy authPluginName.
+	pos = misc.WriteNullString(data, pos, l.authPlugin)
 
 	// Sanity check.
 	if pos != len(data) {
@@ -348,7 +456,7 @@ func (l *MysqlListener) writeHandshakeV10(c *mysql.Conn, enableTLS bool, salt []
 // parseClientHandshakePacket parses the handshake sent by the client.
 // Returns the username, auth method, auth Content, error.
 // The original Content is not pointed at, and can be freed.
-func (l *MysqlListener) parseClientHandshakePacket(firstTime bool, data []byte) (string, string, []byte, error) {
+func (l *MysqlListener) parseClientHandshakePacket(c *mysql.Conn, firstTime bool, data []byte) (string, string, []byte, error) {
 	pos := 0
 
 	// Client flags, 4 bytes.
@@ -364,12 +472,12 @@ func (l *MysqlListener) parseClientHandshakePacket(firstTime bool, data []byte)
 	// later in the protocol. If we re-received the handshake packet
 	// after SSL negotiation, do not overwrite capabilities.
 	if firstTime {
-		l.capabilities = clientFlags & (constant.CapabilityClientDeprecateEOF | constant.CapabilityClientFoundRows)
+		c.SetCapabilities(clientFlags & (constant.CapabilityClientDeprecateEOF | constant.CapabilityClientFoundRows))
 	}
 
 	// set connection capability for executing multi statements
 	if clientFlags&constant.CapabilityClientMultiStatements > 0 {
-		l.capabilities |= constant.CapabilityClientMultiStatements
+		c.SetCapabilities(c.Capabilities() | constant.CapabilityClientMultiStatements)
 	}
 
 	// Max packet size. Don't do anything with this now.
@@ -389,15 +497,13 @@ func (l *MysqlListener) parseClientHandshakePacket(firstTime bool, data []byte)
 	// 23x reserved zero bytes.
 	pos += 23
 
-	//// Check for SSL.
-	//if firstTime && l.TLSConfig != nil && clientFlags&CapabilityClientSSL > 0 {
-	//	// Need to switch to TLS, and then re-read the packet.
-	//	conn := tls.Server(c.conn, l.TLSConfig)
-	//	c.conn = conn
-	//	c.bufferedReader.Reset(conn)
-	//	l.capabilities |= CapabilityClientSSL
-	//	return "", "", nil, nil
-	//}
+	// Check for SSL.
+	if firstTime && l.tlsConfig != nil && clientFlags&constant.CapabilityClientSSL > 0 {
+		// Need to switch to TLS, and then re-read the packet.
+		c.UpgradeToTLS(l.tlsConfig)
+		c.SetCapabilities(c.Capabilities() | constant.CapabilityClientSSL)
+		return "", "", nil, nil
+	}
 
 	// username
 	username, pos, ok := misc.ReadNullString(data, pos)
@@ -472,48 +578,6 @@ func (l *MysqlListener) parseClientHandshakePacket(firstTime bool, data []byte)
 	return username, authMethod, authResponse, nil
 }
 
-func (l *MysqlListener) ValidateHash(user string, salt []byte, authResponse []byte) error {
-	password, ok := l.conf.Users[user]
-	if !ok {
-		return err2.NewSQLError(constant.ERAccessDeniedError, constant.SSAccessDeniedError, "Access denied for user '%v'", user)
-	}
-	computedAuthResponse := scramblePassword(salt, password)
-	if bytes.Equal(authResponse, computedAuthResponse) {
-		return nil
-	}
-	return err2.NewSQLError(constant.ERAccessDeniedError, constant.SSAccessDeniedError, "Access denied for user '%v'", user)
-}
-
-// Hash password using 4.1+ method (SHA1)
-func scramblePassword(scramble []byte, password string) []byte {
-	if len(password) == 0 {
-		return nil
-	}
-
-	// stage1Hash = SHA1(password)
-	crypt := sha1.New()
-	crypt.Write([]byte(password))
-	stage1 := crypt.Sum(nil)
-
-	// scrambleHash = SHA1(scramble + SHA1(stage1Hash))
-	// inner Hash
-	crypt.Reset()
-	crypt.Write(stage1)
-	hash := crypt.Sum(nil)
-
-	// outer Hash
-	crypt.Reset()
-	crypt.Write(scramble)
-	crypt.Write(hash)
-	scramble = crypt.Sum(nil)
-
-	// token = scrambleHash XOR stage1Hash
-	for i := range scramble {
-		scramble[i] ^= stage1[i]
-	}
-	return scramble
-}
-
 func (l *MysqlListener) ExecuteCommand(ctx context.Context, c *mysql.Conn, data []byte) error {
 	commandType := data[0]
 	switch commandType {
@@ -546,25 +610,15 @@ func (l *MysqlListener) ExecuteCommand(ctx context.Context, c *mysql.Conn, data
 			}()
 			query := string(data[1:])
 			c.RecycleReadPacket()
-			p := parser.New()
-			stmt, err := p.ParseOneStmt(query, "", "")
-			if err != nil {
-				if writeErr := c.WriteErrorPacketFromError(err); writeErr != nil {
-					log.Error("Error writing query error to client %v: %v", l.connectionID, writeErr)
-					return writeErr
-				}
-				return nil
+			stmts, release, err := l.statements.Parse(query)
+			defer release()
+			if err == nil && len(stmts) == 0 {
+				err = err2.NewSQLError(constant.EREmptyQuery, constant.SSEmptyQuery, "Query was empty")
+			}
+			if err == nil && len(stmts) > 1 && c.Capabilities()&constant.CapabilityClientMultiStatements == 0 {
+				err = err2.NewSQLError(constant.ERParseError, constant.SSParseError,
+					"multi statements are not enabled by the client, query: %s", query)
 			}
-
-			traceCtx := tracing.BuildContextFromSQLHint(ctx, stmt)
-			spanCtx, span := tracing.GetTraceSpan(traceCtx, tracing.MySQLListenerComQuery)
-			defer span.End()
-
-			stmt.Accept(&visitor.ParamVisitor{})
-			spanCtx = proto.WithCommandType(spanCtx, commandType)
-			spanCtx = proto.WithQueryStmt(spanCtx, stmt)
-			spanCtx = proto.WithSqlText(spanCtx, query)
-			result, warn, err := l.executor.ExecutorComQuery(spanCtx, query)
 			if err != nil {
 				if writeErr := c.WriteErrorPacketFromError(err); writeErr != nil {
 					log.Error("Error writing query error to client %v: %v", l.connectionID, writeErr)
@@ -572,36 +626,22 @@ func (l *MysqlListener) ExecuteCommand(ctx context.Context, c *mysql.Conn, data
 				}
 				return nil
 			}
-			if rlt, ok := result.(*mysql.Result); ok {
-				if len(rlt.Fields) == 0 {
-					// A successful callback with no fields means that this was a
-					// DML or other write-only operation.
-					//
-					// We should not send any more packets after this, but make sure
-					// to extract the affected rows and last insert id from the result
-					// struct here since clients expect it.
-					flag := c.StatusFlags()
-					if l.executor.InLocalTransaction(ctx) {
-						flag = flag | constant.ServerStatusInTrans
-					}
-					return c.WriteOKPacket(rlt.AffectedRows, rlt.InsertId, flag, warn)
+
+			// Each statement of a multi statements query is executed in order, the results are sent
+			// with SERVER_MORE_RESULTS_EXISTS except the last one, the first failed statement ends the query.
+			for i, stmt := range stmts {
+				sql := query
+				if len(stmts) > 1 {
+					sql = strings.TrimSpace(stmt.Text())
 				}
-				err = c.WriteFields(l.capabilities, rlt.Fields)
+				succeed, err := l.executeQuery(ctx, c, stmt, sql, i < len(stmts)-1)
 				if err != nil {
-					tracing.RecordErrorSpan(span, err)
 					return err
 				}
-				err = c.WriteRows(rlt)
-				if err != nil {
-					tracing.RecordErrorSpan(span, err)
-					return err
+				if !succeed {
+					break
 				}
 			}
-			if err = c.WriteEndResult(l.capabilities, false, 0, 0, warn); err != nil {
-				log.Errorf("Error writing result to %s: %v", c, err)
-				tracing.RecordErrorSpan(span, err)
-				return err
-			}
 			return nil
 		}()
 		if err != nil {
@@ -634,7 +674,7 @@ func (l *MysqlListener) ExecuteCommand(ctx context.Context, c *mysql.Conn, data
 			fld := field.(*mysql.Field)
 			result.Fields[i] = fld
 		}
-		err = c.WriteFields(l.capabilities, result.Fields)
+		err = c.WriteFields(c.Capabilities(), result.Fields)
 		if err != nil {
 			return err
 		}
@@ -643,9 +683,8 @@ func (l *MysqlListener) ExecuteCommand(ctx context.Context, c *mysql.Conn, data
 		c.RecycleReadPacket()
 
 		// Populate PrepareData
-		l.statementID.Inc()
 		stmt := &proto.Stmt{
-			StatementID: l.statementID.Load(),
+			StatementID: c.NextStatementID(),
 			SqlText:     query,
 		}
 		p := parser.New()
@@ -658,6 +697,7 @@ func (l *MysqlListener) ExecuteCommand(ctx context.Context, c *mysql.Conn, data
 				log.Errorf("Conn %v: Error writing prepared statement error: %v", c, writeErr)
 				return writeErr
 			}
+			return nil
 		}
 		act.Accept(&visitor.ParamVisitor{})
 
@@ -671,9 +711,9 @@ func (l *MysqlListener) ExecuteCommand(ctx context.Context, c *mysql.Conn, data
 			stmt.BindVars = make(map[string]interface{}, paramsCount)
 		}
 
-		l.stmts.Store(stmt.StatementID, stmt)
+		c.StoreStmt(stmt)
 
-		if err = c.WritePrepare(l.capabilities, stmt); err != nil {
+		if err = c.WritePrepare(c.Capabilities(), stmt); err != nil {
 			return err
 		}
 	case constant.ComStmtExecute:
@@ -684,15 +724,15 @@ func (l *MysqlListener) ExecuteCommand(ctx context.Context, c *mysql.Conn, data
 					log.Errorf("conn %v: flush() failed: %v", c.ID(), err)
 				}
 			}()
-			stmtID, _, err := packet.ParseComStmtExecute(l.stmts, data)
+			stmtID, _, err := packet.ParseComStmtExecute(c.Stmts(), data)
 			c.RecycleReadPacket()
 
 			if stmtID != uint32(0) {
 				defer func() {
 					// Allocate a new bindvar map every time since executor.Execute() mutates it.
-					pi, _ := l.stmts.Load(stmtID)
-					prepare := pi.(*proto.Stmt)
-					prepare.BindVars = make(map[string]interface{}, prepare.ParamsCount)
+					if prepare, ok := c.Stmt(stmtID); ok {
+						prepare.BindVars = make(map[string]interface{}, prepare.ParamsCount)
+					}
 				}()
 			}
 
@@ -705,8 +745,7 @@ func (l *MysqlListener) ExecuteCommand(ctx context.Context, c *mysql.Conn, data
 				return nil
 			}
 
-			si, _ := l.stmts.Load(stmtID)
-			stmt := si.(*proto.Stmt)
+			stmt, _ := c.Stmt(stmtID)
 			stmt.ParamData = data
 
 			traceCtx := tracing.BuildContextFromSQLHint(ctx, stmt.StmtNode)
@@ -725,6 +764,14 @@ func (l *MysqlListener) ExecuteCommand(ctx context.Context, c *mysql.Conn, data
 				}
 				return nil
 			}
+			if rlt, ok := result.(*mysql.StreamResult); ok {
+				if _, err = l.writeStreamResult(c, rlt, false); err != nil {
+					log.Errorf("Error writing result to %s: %v", c, err)
+					tracing.RecordErrorSpan(span, err)
+					return err
+				}
+				return nil
+			}
 			if rlt, ok := result.(*mysql.Result); ok {
 				if len(rlt.Fields) == 0 {
 					// A successful callback with no fields means that this was a
@@ -740,7 +787,7 @@ func (l *MysqlListener) ExecuteCommand(ctx context.Context, c *mysql.Conn, data
 					return c.WriteOKPacket(rlt.AffectedRows, rlt.InsertId, flag, warn)
 				}
 
-				err = c.WriteFields(l.capabilities, rlt.Fields)
+				err = c.WriteFields(c.Capabilities(), rlt.Fields)
 				if err != nil {
 					tracing.RecordErrorSpan(span, err)
 					return err
@@ -751,7 +798,7 @@ func (l *MysqlListener) ExecuteCommand(ctx context.Context, c *mysql.Conn, data
 					return err
 				}
 			}
-			if err = c.WriteEndResult(l.capabilities, false, 0, 0, warn); err != nil {
+			if err = c.WriteEndResult(c.Capabilities(), false, 0, 0, warn); err != nil {
 				log.Errorf("Error writing result to %s: %v", c, err)
 				tracing.RecordErrorSpan(span, err)
 				return err
@@ -765,31 +812,30 @@ func (l *MysqlListener) ExecuteCommand(ctx context.Context, c *mysql.Conn, data
 		stmtID, _, ok := misc.ReadUint32(data, 1)
 		c.RecycleReadPacket()
 		if ok {
-			l.stmts.Delete(stmtID)
+			c.DeleteStmt(stmtID)
 		}
 	case constant.ComStmtSendLongData: // no response
-		if len(data) < 6 {
+		if len(data) < 7 {
 			return err2.ErrMalformedPkt
 		}
 
-		stmtID := int(binary.LittleEndian.Uint32(data[0:4]))
+		stmtID := binary.LittleEndian.Uint32(data[1:5])
 
-		si, ok := l.stmts.Load(stmtID)
+		stmt, ok := c.Stmt(stmtID)
 		if !ok {
 			return errors.Errorf("statement not found, statement id: %v", stmtID)
 		}
-		stmt := si.(*proto.Stmt)
 
-		paramID := int(binary.LittleEndian.Uint16(data[4:6]))
+		paramID := int(binary.LittleEndian.Uint16(data[5:7]))
 		parameterID := fmt.Sprintf("v%d", paramID+1)
 		stmt.HasLongDataParam = true
-		stmt.BindVars[parameterID] = data[6:]
+		// the parameter may be sent in several chunks
+		chunk, _ := stmt.BindVars[parameterID].([]byte)
+		stmt.BindVars[parameterID] = append(chunk, data[7:]...)
 	case constant.ComStmtReset:
 		stmtID, _, ok := misc.ReadUint32(data, 1)
 		c.RecycleReadPacket()
-		if ok {
-			si, _ := l.stmts.Load(stmtID)
-			stmt := si.(*proto.Stmt)
+		if stmt, found := c.Stmt(stmtID); ok && found {
 			stmt.BindVars = make(map[string]interface{}, 0)
 		}
 		return c.WriteOKPacket(0, 0, c.StatusFlags(), 0)
@@ -799,9 +845,9 @@ func (l *MysqlListener) ExecuteCommand(ctx context.Context, c *mysql.Conn, data
 		if ok {
 			switch operation {
 			case 0:
-				l.capabilities |= constant.CapabilityClientMultiStatements
+				c.SetCapabilities(c.Capabilities() | constant.CapabilityClientMultiStatements)
 			case 1:
-				l.capabilities &^= constant.CapabilityClientMultiStatements
+				c.SetCapabilities(c.Capabilities() &^ constant.CapabilityClientMultiStatements)
 			default:
 				log.Errorf("Got unhandled packet (ComSetOption default) from client %v, returning error: %v", l.connectionID, data)
 				if err := c.WriteErrorPacket(constant.ERUnknownComError, constant.SSUnknownComError, "error handling packet: %v", data); err != nil {
@@ -809,7 +855,7 @@ func (l *MysqlListener) ExecuteCommand(ctx context.Context, c *mysql.Conn, data
 					return err
 				}
 			}
-			if err := c.WriteEndResult(l.capabilities, false, 0, 0, 0); err != nil {
+			if err := c.WriteEndResult(c.Capabilities(), false, 0, 0, 0); err != nil {
 				log.Errorf("Error writeEndResult error %v ", err)
 				return err
 			}
@@ -822,11 +868,105 @@ func (l *MysqlListener) ExecuteCommand(ctx context.Context, c *mysql.Conn, data
 		}
 	case constant.ComResetConnection:
 		c.RecycleReadPacket()
+		if session := proto.ExtractSession(ctx); session != nil {
+			session.ResetVariables()
+		}
+		c.ClearStmts()
 		return c.WriteOKPacket(0, 0, c.StatusFlags(), 0)
 	}
 	return nil
 }
 
+// executeQuery executes a statement of COM_QUERY and writes its result, more is true if the result
+// is followed by the results of other statements. It returns false if the statement failed.
+func (l *MysqlListener) executeQuery(ctx context.Context, c *mysql.Conn, stmt ast.StmtNode, query string, more bool) (bool, error) {
+	traceCtx := tracing.BuildContextFromSQLHint(ctx, stmt)
+	spanCtx, span := tracing.GetTraceSpan(traceCtx, tracing.MySQLListenerComQuery)
+	defer span.End()
+
+	stmt.Accept(&visitor.ParamVisitor{})
+	spanCtx = proto.WithCommandType(spanCtx, constant.ComQuery)
+	spanCtx = proto.WithQueryStmt(spanCtx, stmt)
+	spanCtx = proto.WithSqlText(spanCtx, query)
+	result, warn, err := l.executor.ExecutorComQuery(spanCtx, query)
+	if err != nil {
+		if writeErr := c.WriteErrorPacketFromError(err); writeErr != nil {
+			log.Error("Error writing query error to client %v: %v", l.connectionID, writeErr)
+			return false, writeErr
+		}
+		return false, nil
+	}
+	if rlt, ok := result.(*mysql.StreamResult); ok {
+		succeed, err := l.writeStreamResult(c, rlt, more)
+		if err != nil {
+			log.Errorf("Error writing result to %s: %v", c, err)
+			tracing.RecordErrorSpan(span, err)
+		}
+		return succeed, err
+	}
+	if rlt, ok := result.(*mysql.Result); ok {
+		if len(rlt.Fields) == 0 {
+			// A successful callback with no fields means that this was a
+			// DML or other write-only operation.
+			//
+			// We should not send any more packets after this, but make sure
+			// to extract the affected rows and last insert id from the result
+			// struct here since clients expect it.
+			flag := c.StatusFlags()
+			if l.executor.InLocalTransaction(ctx) {
+				flag = flag | constant.ServerStatusInTrans
+			}
+			if more {
+				flag = flag | constant.ServerMoreResultsExists
+			}
+			return true, c.WriteOKPacket(rlt.AffectedRows, rlt.InsertId, flag, warn)
+		}
+		err = c.WriteFields(c.Capabilities(), rlt.Fields)
+		if err != nil {
+			tracing.RecordErrorSpan(span, err)
+			return false, err
+		}
+		err = c.WriteRows(rlt)
+		if err != nil {
+			tracing.RecordErrorSpan(span, err)
+			return false, err
+		}
+	}
+	if err = c.WriteEndResult(c.Capabilities(), more, 0, 0, warn); err != nil {
+		log.Errorf("Error writing result to %s: %v", c, err)
+		tracing.RecordErrorSpan(span, err)
+		return false, err
+	}
+	return true, nil
+}
+
+// writeStreamResult forwards the rows of the stream result to the client as they are read from
+// the backend, an error reading the rows is sent to the client in place of the end of the result set,
+// and false is returned.
+func (l *MysqlListener) writeStreamResult(c *mysql.Conn, rlt *mysql.StreamResult, more bool) (bool, error) {
+	defer func() {
+		if err := rlt.Rows.Close(); err != nil {
+			log.Errorf("conn %v: close stream result failed: %v", c.ID(), err)
+		}
+	}()
+	if err := c.WriteFields(c.Capabilities(), rlt.Fields); err != nil {
+		return false, err
+	}
+	for {
+		row, err := rlt.Rows.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return false, c.WriteErrorPacketFromError(err)
+		}
+		if err = c.WriteRow(rlt.Fields, row); err != nil {
+			return false, err
+		}
+	}
+	return true, c.WriteEndResult(c.Capabilities(), more, 0, 0, rlt.Rows.Warnings())
+}
+
 func parseConnAttrs(data []byte, pos int) (map[string]string, int, error) {
 	var attrLen uint64
 
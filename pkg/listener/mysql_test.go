@@ -0,0 +1,553 @@
+/*
+ * Copyright 2022 CECTC, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package listener
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/cectc/dbpack/pkg/config"
+	"github.com/cectc/dbpack/pkg/constant"
+	"github.com/cectc/dbpack/pkg/driver"
+	err2 "github.com/cectc/dbpack/pkg/errors"
+	"github.com/cectc/dbpack/pkg/mysql"
+	"github.com/cectc/dbpack/pkg/proto"
+	"github.com/cectc/dbpack/third_party/parser/ast"
+)
+
+type mockExecutor struct {
+	proto.Executor
+}
+
+func (e *mockExecutor) ConnectionClose(ctx context.Context) {
+}
+
+type testCerts struct {
+	caFile, certFile, keyFile string
+	clientCert                tls.Certificate
+	rootCAs                   *x509.CertPool
+}
+
+// generateCerts generates a self-signed ca, a server certificate for 127.0.0.1 and a client certificate
+func generateCerts(t *testing.T) *testCerts {
+	dir := t.TempDir()
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "dbpack test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	assert.Nil(t, err)
+	caCert, err := x509.ParseCertificate(caDER)
+	assert.Nil(t, err)
+
+	issue := func(serial int64, usage x509.ExtKeyUsage) ([]byte, []byte) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		assert.Nil(t, err)
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      pkix.Name{CommonName: "dbpack"},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+			IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, caCert, &key.PublicKey, caKey)
+		assert.Nil(t, err)
+		keyDER, err := x509.MarshalECPrivateKey(key)
+		assert.Nil(t, err)
+		return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+			pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	}
+
+	certs := &testCerts{
+		caFile:   filepath.Join(dir, "ca.pem"),
+		certFile: filepath.Join(dir, "server-cert.pem"),
+		keyFile:  filepath.Join(dir, "server-key.pem"),
+		rootCAs:  x509.NewCertPool(),
+	}
+	certs.rootCAs.AddCert(caCert)
+	assert.Nil(t, os.WriteFile(certs.caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER}), 0600))
+	serverCert, serverKey := issue(2, x509.ExtKeyUsageServerAuth)
+	assert.Nil(t, os.WriteFile(certs.certFile, serverCert, 0600))
+	assert.Nil(t, os.WriteFile(certs.keyFile, serverKey, 0600))
+	clientCert, clientKey := issue(3, x509.ExtKeyUsageClientAuth)
+	certs.clientCert, err = tls.X509KeyPair(clientCert, clientKey)
+	assert.Nil(t, err)
+	return certs
+}
+
+func startListener(t *testing.T, conf map[string]interface{}) *MysqlListener {
+	listenerConf := map[string]interface{}{
+		"users":          map[string]string{"dksl": "123456"},
+		"server_version": "8.0.27",
+	}
+	for key, value := range conf {
+		listenerConf[key] = value
+	}
+	l, err := NewMysqlListener(&config.Listener{
+		ProtocolType:  config.Mysql,
+		SocketAddress: config.SocketAddress{Address: "127.0.0.1", Port: 0},
+		Config:        listenerConf,
+	})
+	assert.Nil(t, err)
+	listener := l.(*MysqlListener)
+	listener.SetExecutor(&mockExecutor{})
+	go listener.Listen()
+	t.Cleanup(listener.Close)
+	return listener
+}
+
+func writeTestPacket(w io.Writer, sequence byte, payload []byte) error {
+	header := make([]byte, 4)
+	binary.LittleEndian.PutUint32(header, uint32(len(payload)))
+	header[3] = sequence
+	_, err := w.Write(append(header, payload...))
+	return err
+}
+
+func readTestPacket(r io.Reader) ([]byte, error) {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	payload := make([]byte, int(header[0])|int(header[1])<<8|int(header[2])<<16)
+	_, err := io.ReadFull(r, payload)
+	return payload, err
+}
+
+// Hash password using 4.1+ method (SHA1)
+func scramblePassword(scramble []byte, password string) []byte {
+	if len(password) == 0 {
+		return nil
+	}
+
+	// stage1Hash = SHA1(password)
+	crypt := sha1.New()
+	crypt.Write([]byte(password))
+	stage1 := crypt.Sum(nil)
+
+	// scrambleHash = SHA1(scramble + SHA1(stage1Hash))
+	// inner Hash
+	crypt.Reset()
+	crypt.Write(stage1)
+	hash := crypt.Sum(nil)
+
+	// outer Hash
+	crypt.Reset()
+	crypt.Write(scramble)
+	crypt.Write(hash)
+	scramble = crypt.Sum(nil)
+
+	// token = scrambleHash XOR stage1Hash
+	for i := range scramble {
+		scramble[i] ^= stage1[i]
+	}
+	return scramble
+}
+
+// connect performs the client side of the handshake, it returns the response packet of the
+// handshake, an OK packet or an ERR packet.
+func connect(addr string, tlsConfig *tls.Config) ([]byte, error) {
+	conn, response, err := dial(addr, tlsConfig)
+	if conn != nil {
+		conn.Close()
+	}
+	return response, err
+}
+
+// dial performs the client side of the handshake without CLIENT_MULTI_STATEMENTS, it returns
+// the connection and the response packet of the handshake.
+func dial(addr string, tlsConfig *tls.Config) (net.Conn, []byte, error) {
+	var conn net.Conn
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	handshake, err := readTestPacket(conn)
+	if err != nil {
+		return conn, nil, err
+	}
+	pos := 1
+	for handshake[pos] != 0 {
+		pos++
+	}
+	pos += 1 + 4
+	salt := append([]byte{}, handshake[pos:pos+8]...)
+	pos += 8 + 1
+	capabilities := uint32(binary.LittleEndian.Uint16(handshake[pos:]))
+	pos += 2 + 1 + 2
+	capabilities |= uint32(binary.LittleEndian.Uint16(handshake[pos:])) << 16
+	pos += 2 + 1 + 10
+	salt = append(salt, handshake[pos:pos+12]...)
+
+	flags := uint32(constant.CapabilityClientProtocol41 | constant.CapabilityClientSecureConnection |
+		constant.CapabilityClientPluginAuth)
+	header := make([]byte, 32)
+	header[8] = constant.CharacterSetUtf8
+	sequence := byte(1)
+	if tlsConfig != nil {
+		if capabilities&constant.CapabilityClientSSL == 0 {
+			return conn, nil, io.ErrUnexpectedEOF
+		}
+		flags |= constant.CapabilityClientSSL
+		binary.LittleEndian.PutUint32(header, flags)
+		if err = writeTestPacket(conn, sequence, header); err != nil {
+			return conn, nil, err
+		}
+		sequence++
+		tlsConn := tls.Client(conn, tlsConfig)
+		if err = tlsConn.Handshake(); err != nil {
+			return conn, nil, err
+		}
+		conn = tlsConn
+	}
+
+	binary.LittleEndian.PutUint32(header, flags)
+	authResponse := scramblePassword(salt, "123456")
+	payload := append(header, []byte("dksl\x00")...)
+	payload = append(payload, byte(len(authResponse)))
+	payload = append(payload, authResponse...)
+	payload = append(payload, []byte(constant.MysqlNativePassword+"\x00")...)
+	if err = writeTestPacket(conn, sequence, payload); err != nil {
+		return conn, nil, err
+	}
+	response, err := readTestPacket(conn)
+	return conn, response, err
+}
+
+func TestMysqlListenerTLS(t *testing.T) {
+	certs := generateCerts(t)
+	clientTLS := &tls.Config{RootCAs: certs.rootCAs, ServerName: "127.0.0.1"}
+
+	l := startListener(t, map[string]interface{}{
+		"tls": map[string]interface{}{
+			"cert_file": certs.certFile,
+			"key_file":  certs.keyFile,
+		},
+	})
+	response, err := connect(l.listener.Addr().String(), clientTLS)
+	assert.Nil(t, err)
+	assert.Equal(t, byte(constant.OKPacket), response[0])
+
+	// plaintext connections are allowed if secure transport is not required
+	response, err = connect(l.listener.Addr().String(), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, byte(constant.OKPacket), response[0])
+}
+
+func TestMysqlListenerRequireSecureTransport(t *testing.T) {
+	certs := generateCerts(t)
+	l := startListener(t, map[string]interface{}{
+		"tls": map[string]interface{}{
+			"cert_file":                certs.certFile,
+			"key_file":                 certs.keyFile,
+			"require_secure_transport": true,
+		},
+	})
+	response, err := connect(l.listener.Addr().String(), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, byte(constant.ErrPacket), response[0])
+	assert.Equal(t, uint16(constant.ERSecureTransportRequired), binary.LittleEndian.Uint16(response[1:]))
+
+	response, err = connect(l.listener.Addr().String(), &tls.Config{RootCAs: certs.rootCAs, ServerName: "127.0.0.1"})
+	assert.Nil(t, err)
+	assert.Equal(t, byte(constant.OKPacket), response[0])
+}
+
+func TestMysqlListenerVerifyClientCert(t *testing.T) {
+	certs := generateCerts(t)
+	l := startListener(t, map[string]interface{}{
+		"tls": map[string]interface{}{
+			"cert_file":          certs.certFile,
+			"key_file":           certs.keyFile,
+			"ca_file":            certs.caFile,
+			"verify_client_cert": true,
+		},
+	})
+	// the tls 1.3 server verifies the client certificate after the client handshake completes,
+	// so the failure may be reported by reading the response.
+	_, err := connect(l.listener.Addr().String(), &tls.Config{RootCAs: certs.rootCAs, ServerName: "127.0.0.1"})
+	assert.NotNil(t, err)
+
+	response, err := connect(l.listener.Addr().String(), &tls.Config{
+		RootCAs:      certs.rootCAs,
+		ServerName:   "127.0.0.1",
+		Certificates: []tls.Certificate{certs.clientCert},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, byte(constant.OKPacket), response[0])
+}
+
+type errorRowIterator struct {
+	mysql.RowIterator
+	err error
+}
+
+func (iter *errorRowIterator) Next() (proto.Row, error) {
+	row, err := iter.RowIterator.Next()
+	if err == io.EOF {
+		return nil, iter.err
+	}
+	return row, err
+}
+
+type mockStreamExecutor struct {
+	mockExecutor
+	closed int
+}
+
+func (e *mockStreamExecutor) ExecutorComQuery(ctx context.Context, sql string) (proto.Result, uint16, error) {
+	fields := []*mysql.Field{{Name: "id", Table: "t", FieldType: constant.FieldTypeVarString, CharSet: 33}}
+	rows := []proto.Row{
+		mysql.NewTextRow(fields, []*proto.Value{{Typ: constant.FieldTypeVarString, Val: []byte("1")}}),
+		mysql.NewTextRow(fields, []*proto.Value{{Typ: constant.FieldTypeVarString, Val: []byte("2")}}),
+	}
+	var iter mysql.RowIterator = mysql.NewRowsIterator(rows, 2)
+	if sql == "select id from broken" {
+		iter = &errorRowIterator{
+			RowIterator: iter,
+			err:         err2.NewSQLError(constant.ERUnknownError, constant.SSUnknownSQLState, "connection lost"),
+		}
+	}
+	return &mysql.StreamResult{
+		Fields: fields,
+		Rows: mysql.WithCloseHook(iter, func() error {
+			e.closed++
+			return nil
+		}),
+	}, 0, nil
+}
+
+func TestStreamResult(t *testing.T) {
+	l := startListener(t, nil)
+	executor := &mockStreamExecutor{}
+	l.SetExecutor(executor)
+
+	connector, err := driver.NewConnector("test", fmt.Sprintf("dksl:123456@tcp(%s)/", l.listener.Addr()))
+	assert.Nil(t, err)
+	conn, err := connector.NewBackendConnection(context.Background())
+	assert.Nil(t, err)
+	defer conn.Close()
+	backendConn := conn.(*driver.BackendConnection)
+	ctx := proto.WithCommandType(context.Background(), constant.ComQuery)
+
+	result, _, err := backendConn.ExecuteStream(ctx, "select id from t")
+	assert.Nil(t, err)
+	buffered, warnings, err := result.(*mysql.StreamResult).Buffer()
+	assert.Nil(t, err)
+	assert.Equal(t, uint16(2), warnings)
+	assert.Equal(t, 2, len(buffered.Rows))
+	for i, row := range buffered.Rows {
+		values, err := row.Decode()
+		assert.Nil(t, err)
+		assert.Equal(t, fmt.Sprintf("%d", i+1), string(values[0].Val.([]byte)))
+	}
+
+	// the error is sent to the client in place of the end of the result set
+	result, _, err = backendConn.ExecuteStream(ctx, "select id from broken")
+	assert.Nil(t, err)
+	_, _, err = result.(*mysql.StreamResult).Buffer()
+	sqlErr, ok := err.(*err2.SQLError)
+	assert.True(t, ok)
+	assert.Equal(t, constant.ERUnknownError, sqlErr.Num)
+
+	// the connection can be reused after the rows are closed
+	result, _, err = backendConn.ExecuteStream(ctx, "select id from t")
+	assert.Nil(t, err)
+	assert.Nil(t, result.(*mysql.StreamResult).Rows.Close())
+	result, err = backendConn.Execute(ctx, "select id from t", true)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(result.(*mysql.Result).Rows))
+	assert.Equal(t, 4, executor.closed)
+}
+
+type mockQueryExecutor struct {
+	mockExecutor
+	queries []string
+}
+
+func (e *mockQueryExecutor) InLocalTransaction(ctx context.Context) bool {
+	return false
+}
+
+func (e *mockQueryExecutor) ExecutorComQuery(ctx context.Context, sql string) (proto.Result, uint16, error) {
+	e.queries = append(e.queries, sql)
+	switch stmt := proto.QueryStmt(ctx).(type) {
+	case *ast.InsertStmt:
+		return &mysql.Result{AffectedRows: 1}, 0, nil
+	case *ast.SelectStmt:
+		if stmt.From != nil {
+			return nil, 0, err2.NewSQLError(constant.ERNoSuchTable, constant.SSUnknownSQLState, "Table 't' doesn't exist")
+		}
+		fields := []*mysql.Field{{Name: "1", FieldType: constant.FieldTypeVarString, CharSet: 33}}
+		return &mysql.Result{
+			Fields: fields,
+			Rows:   []proto.Row{mysql.NewTextRow(fields, []*proto.Value{{Typ: constant.FieldTypeVarString, Val: []byte("1")}})},
+		}, 0, nil
+	}
+	return &mysql.Result{}, 0, nil
+}
+
+func TestMultiStatements(t *testing.T) {
+	l := startListener(t, nil)
+	executor := &mockQueryExecutor{}
+	l.SetExecutor(executor)
+
+	connector, err := driver.NewConnector("test", fmt.Sprintf("dksl:123456@tcp(%s)/", l.listener.Addr()))
+	assert.Nil(t, err)
+	conn, err := connector.NewBackendConnection(context.Background())
+	assert.Nil(t, err)
+	defer conn.Close()
+	backendConn := conn.(*driver.BackendConnection)
+	ctx := proto.WithCommandType(context.Background(), constant.ComQuery)
+
+	result, more, err := backendConn.ExecuteMulti(ctx, "select 1; insert into t values (1); select 1", true)
+	assert.Nil(t, err)
+	assert.True(t, more)
+	assert.Equal(t, 1, len(result.Rows))
+	result, more, _, err = backendConn.ReadQueryResult(ctx, true)
+	assert.Nil(t, err)
+	assert.True(t, more)
+	assert.Equal(t, uint64(1), result.AffectedRows)
+	result, more, _, err = backendConn.ReadQueryResult(ctx, true)
+	assert.Nil(t, err)
+	assert.False(t, more)
+	assert.Equal(t, 1, len(result.Rows))
+	assert.Equal(t, []string{"select 1;", "insert into t values (1);", "select 1"}, executor.queries)
+
+	// the first failed statement ends the query
+	executor.queries = nil
+	_, more, err = backendConn.ExecuteMulti(ctx, "insert into t values (1); select * from t; select 1", true)
+	assert.Nil(t, err)
+	assert.True(t, more)
+	_, _, _, err = backendConn.ReadQueryResult(ctx, true)
+	sqlErr, ok := err.(*err2.SQLError)
+	assert.True(t, ok)
+	assert.Equal(t, constant.ERNoSuchTable, sqlErr.Num)
+	assert.Equal(t, 2, len(executor.queries))
+
+	// a single statement is executed with the query text as it is
+	executor.queries = nil
+	result, more, err = backendConn.ExecuteMulti(ctx, "select 1;", true)
+	assert.Nil(t, err)
+	assert.False(t, more)
+	assert.Equal(t, 1, len(result.Rows))
+	assert.Equal(t, []string{"select 1;"}, executor.queries)
+
+	_, err = backendConn.Execute(ctx, "", true)
+	sqlErr, ok = err.(*err2.SQLError)
+	assert.True(t, ok)
+	assert.Equal(t, constant.EREmptyQuery, sqlErr.Num)
+}
+
+func TestMultiStatementsCapabilityPerConnection(t *testing.T) {
+	l := startListener(t, nil)
+	l.SetExecutor(&mockQueryExecutor{})
+
+	conn, response, err := dial(l.listener.Addr().String(), nil)
+	assert.Nil(t, err)
+	defer conn.Close()
+	assert.Equal(t, byte(constant.OKPacket), response[0])
+
+	// the handshake of another client enabling multi statements does not affect the connection
+	connector, err := driver.NewConnector("test", fmt.Sprintf("dksl:123456@tcp(%s)/", l.listener.Addr()))
+	assert.Nil(t, err)
+	other, err := connector.NewBackendConnection(context.Background())
+	assert.Nil(t, err)
+	defer other.Close()
+
+	assert.Nil(t, writeTestPacket(conn, 0, append([]byte{constant.ComQuery}, []byte("select 1; select 1")...)))
+	response, err = readTestPacket(conn)
+	assert.Nil(t, err)
+	assert.Equal(t, byte(constant.ErrPacket), response[0])
+}
+
+type mockStmtExecutor struct {
+	mockExecutor
+	statements []uint32
+}
+
+func (e *mockStmtExecutor) InLocalTransaction(ctx context.Context) bool {
+	return false
+}
+
+func (e *mockStmtExecutor) ExecutorComStmtExecute(ctx context.Context, stmt *proto.Stmt) (proto.Result, uint16, error) {
+	e.statements = append(e.statements, stmt.StatementID)
+	return &mysql.Result{AffectedRows: 1}, 0, nil
+}
+
+func TestPreparedStatements(t *testing.T) {
+	l := startListener(t, nil)
+	executor := &mockStmtExecutor{}
+	l.SetExecutor(executor)
+
+	connector, err := driver.NewConnector("test", fmt.Sprintf("dksl:123456@tcp(%s)/?stmtCacheSize=1", l.listener.Addr()))
+	assert.Nil(t, err)
+	newConn := func() *driver.BackendConnection {
+		conn, err := connector.NewBackendConnection(context.Background())
+		assert.Nil(t, err)
+		t.Cleanup(conn.Close)
+		return conn.(*driver.BackendConnection)
+	}
+	ctx := context.Background()
+
+	conn := newConn()
+	for _, sql := range []string{
+		"insert into t values (?)",
+		"insert into t values (?)", // the backend statement is cached
+		"update t set id = ?",      // the first statement is evicted and closed
+		"insert into t values (?)",
+	} {
+		result, _, err := conn.PrepareExecuteArgs(ctx, sql, []interface{}{1})
+		assert.Nil(t, err)
+		assert.Equal(t, uint64(1), result.AffectedRows)
+	}
+	assert.Equal(t, []uint32{1, 1, 2, 3}, executor.statements)
+
+	// statement ids are allocated by each client connection
+	executor.statements = nil
+	_, _, err = newConn().PrepareExecuteArgs(ctx, "insert into t values (?)", []interface{}{1})
+	assert.Nil(t, err)
+	assert.Equal(t, []uint32{1}, executor.statements)
+}
@@ -0,0 +1,334 @@
+/*
+ * Copyright 2022 CECTC, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package listener
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/cectc/dbpack/pkg/constant"
+	"github.com/cectc/dbpack/third_party/cache"
+	"github.com/cectc/dbpack/third_party/parser"
+	"github.com/cectc/dbpack/third_party/parser/ast"
+	"github.com/cectc/dbpack/third_party/parser/format"
+	"github.com/cectc/dbpack/third_party/types"
+	driver "github.com/cectc/dbpack/third_party/types/parser_driver"
+)
+
+// statementInstances is the number of the parsed statements of an entry kept for reuse, the
+// queries of an entry executed concurrently parse the other statements they need.
+const statementInstances = 8
+
+// statementCache caches the parsed statements of COM_QUERY by the normalized digest of the
+// queries. The queries only differ in literals share an entry, a statement parsed for the entry
+// is reused by binding the literals of the query to it, so the query is not parsed again.
+// Only single select, insert, update and delete statements are cached. A statement is not cached
+// if its literals can not be bound, e.g. a literal is a part of the name of a select field, or
+// the parsed statement differs from the statement parsed from the query.
+type statementCache struct {
+	entries *cache.LRUCache
+}
+
+func newStatementCache(capacity int) *statementCache {
+	if capacity <= 0 {
+		capacity = constant.DefaultStatementCacheSize
+	}
+	return &statementCache{entries: cache.NewLRUCache(int64(capacity))}
+}
+
+// statementEntry is the statement of the queries with the same parameterized sql, the literals of
+// the queries are the parameters.
+type statementEntry struct {
+	// sql is the parameterized sql of the queries
+	sql string
+	// cacheable is false if the literals of the queries can not be bound to a parsed statement
+	cacheable bool
+	// kinds are the kinds of the parameters, the queries with literals of other kinds are parsed
+	kinds []byte
+	// unsigned marks the parameters parsed as unsigned integers, e.g. the count of LIMIT
+	unsigned []bool
+	// prefix and suffix are the lengths of the query text around the statement text
+	prefix, suffix int
+	// instances are the parsed statements not used by any query at the moment
+	instances chan *statementInstance
+}
+
+// statementInstance is a statement parsed from the parameterized sql, the parameters are replaced
+// by value expressions, slots are the value expressions in the order of the parameters.
+type statementInstance struct {
+	stmt  ast.StmtNode
+	slots []*driver.ValueExpr
+}
+
+// Size implements cache.Value
+func (entry *statementEntry) Size() int {
+	return 1
+}
+
+// Parse parses the query, or binds the literals of the query to a cached statement. release
+// should be called when the statements are executed, so that the cached statement can be reused.
+func (c *statementCache) Parse(query string) (stmts []ast.StmtNode, release func(), err error) {
+	release = func() {}
+	sql, literals, ok := parser.Parameterize(query)
+	if !ok {
+		stmts, _, err = parser.New().Parse(query, "", "")
+		return stmts, release, err
+	}
+	values := make([]*driver.ValueExpr, 0, len(literals))
+	for _, literal := range literals {
+		// a query with parameter markers is not a valid statement, it is rejected by mysql
+		if literal.Marker {
+			stmts, _, err = parser.New().Parse(query, "", "")
+			return stmts, release, err
+		}
+		if !literal.Fixed {
+			values = append(values, literal.Value.(*driver.ValueExpr))
+		}
+	}
+
+	_, digest := parser.NormalizeDigest(query)
+	key := digest.String()
+	if value, ok := c.entries.Get(key); ok {
+		entry := value.(*statementEntry)
+		if entry.sql == sql && entry.match(values) {
+			if !entry.cacheable {
+				stmts, _, err = parser.New().Parse(query, "", "")
+				return stmts, release, err
+			}
+			if instance, ok := entry.get(); ok {
+				entry.bind(instance, query, values)
+				return []ast.StmtNode{instance.stmt}, func() {
+					entry.put(instance)
+				}, nil
+			}
+		}
+	}
+
+	stmts, _, err = parser.New().Parse(query, "", "")
+	if err != nil {
+		return nil, release, err
+	}
+	c.entries.Set(key, newStatementEntry(query, sql, values, stmts))
+	return stmts, release, nil
+}
+
+// newStatementEntry makes the entry of the parameterized sql, the statement parsed for the entry
+// is bound with the values of the query, and compared with the statements parsed from the query.
+func newStatementEntry(query, sql string, values []*driver.ValueExpr, stmts []ast.StmtNode) *statementEntry {
+	entry := &statementEntry{
+		sql:       sql,
+		instances: make(chan *statementInstance, statementInstances),
+	}
+	for _, value := range values {
+		entry.kinds = append(entry.kinds, value.Kind())
+	}
+	if len(stmts) != 1 {
+		return entry
+	}
+	switch stmts[0].(type) {
+	case *ast.SelectStmt, *ast.InsertStmt, *ast.UpdateStmt, *ast.DeleteStmt:
+	default:
+		return entry
+	}
+	text := stmts[0].Text()
+	prefix := strings.Index(query, text)
+	if text == "" || prefix < 0 {
+		return entry
+	}
+	entry.prefix, entry.suffix = prefix, len(query)-prefix-len(text)
+
+	instance, ok := entry.parse()
+	if !ok {
+		return entry
+	}
+	entry.unsigned = make([]bool, len(instance.slots))
+	entry.bind(instance, query, values)
+
+	expected, actual := collectValueExprs(stmts[0]), collectValueExprs(instance.stmt)
+	if len(expected) != len(actual) {
+		return entry
+	}
+	slots := make(map[*driver.ValueExpr]int, len(instance.slots))
+	for i, slot := range instance.slots {
+		slots[slot] = i
+	}
+	for i := range expected {
+		if equalValueExpr(expected[i], actual[i]) {
+			continue
+		}
+		j, isSlot := slots[actual[i]]
+		if !isSlot || expected[i].Kind() != types.KindUint64 || actual[i].Kind() != types.KindInt64 {
+			return entry
+		}
+		entry.unsigned[j] = true
+		entry.bind(instance, query, values)
+		if !equalValueExpr(expected[i], actual[i]) {
+			return entry
+		}
+	}
+	// the text of a node is lost if it has literals, e.g. the text of a select field is its name
+	if !reflect.DeepEqual(collectTexts(stmts[0]), collectTexts(instance.stmt)) {
+		return entry
+	}
+	restored, err := restore(stmts[0])
+	if err != nil {
+		return entry
+	}
+	if bound, err := restore(instance.stmt); err != nil || bound != restored {
+		return entry
+	}
+	entry.cacheable = true
+	entry.put(instance)
+	return entry
+}
+
+// match reports whether the values can be bound to the statement of the entry
+func (entry *statementEntry) match(values []*driver.ValueExpr) bool {
+	if len(values) != len(entry.kinds) {
+		return false
+	}
+	for i, value := range values {
+		if value.Kind() != entry.kinds[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// get returns a statement not used by other queries
+func (entry *statementEntry) get() (*statementInstance, bool) {
+	select {
+	case instance := <-entry.instances:
+		return instance, true
+	default:
+		return entry.parse()
+	}
+}
+
+// put returns the statement for reuse, it is dropped if there are enough statements already
+func (entry *statementEntry) put(instance *statementInstance) {
+	select {
+	case entry.instances <- instance:
+	default:
+	}
+}
+
+// parse parses the parameterized sql, and replaces the parameter markers with value expressions.
+func (entry *statementEntry) parse() (*statementInstance, bool) {
+	stmt, err := parser.New().ParseOneStmt(entry.sql, "", "")
+	if err != nil {
+		return nil, false
+	}
+	replacer := &markerReplacer{}
+	node, ok := stmt.Accept(replacer)
+	if !ok || len(replacer.slots) != len(entry.kinds) {
+		return nil, false
+	}
+	sort.Slice(replacer.slots, func(i, j int) bool {
+		return replacer.slots[i].offset < replacer.slots[j].offset
+	})
+	instance := &statementInstance{stmt: node.(ast.StmtNode)}
+	for _, slot := range replacer.slots {
+		instance.slots = append(instance.slots, slot.value)
+	}
+	return instance, true
+}
+
+// bind sets the values of the query to the statement
+func (entry *statementEntry) bind(instance *statementInstance, query string, values []*driver.ValueExpr) {
+	for i, value := range values {
+		if entry.unsigned[i] {
+			*instance.slots[i] = *ast.NewValueExpr(uint64(value.GetInt64()), "", "").(*driver.ValueExpr)
+			continue
+		}
+		*instance.slots[i] = *value
+	}
+	instance.stmt.SetText(query[entry.prefix : len(query)-entry.suffix])
+}
+
+type markerSlot struct {
+	offset int
+	value  *driver.ValueExpr
+}
+
+// markerReplacer replaces the parameter markers with value expressions
+type markerReplacer struct {
+	slots []markerSlot
+}
+
+func (v *markerReplacer) Enter(in ast.Node) (out ast.Node, skipChildren bool) {
+	return in, false
+}
+
+func (v *markerReplacer) Leave(in ast.Node) (out ast.Node, ok bool) {
+	if marker, ok := in.(*driver.ParamMarkerExpr); ok {
+		value := &driver.ValueExpr{}
+		v.slots = append(v.slots, markerSlot{offset: marker.Offset, value: value})
+		return value, true
+	}
+	return in, true
+}
+
+// nodeCollector collects the value expressions and the texts of the nodes except the root
+type nodeCollector struct {
+	root   bool
+	values []*driver.ValueExpr
+	texts  []string
+}
+
+func (v *nodeCollector) Enter(in ast.Node) (out ast.Node, skipChildren bool) {
+	if !v.root {
+		v.root = true
+		return in, false
+	}
+	if value, ok := in.(*driver.ValueExpr); ok {
+		v.values = append(v.values, value)
+	}
+	if text := in.Text(); text != "" {
+		v.texts = append(v.texts, text)
+	}
+	return in, false
+}
+
+func (v *nodeCollector) Leave(in ast.Node) (out ast.Node, ok bool) {
+	return in, true
+}
+
+func collectValueExprs(stmt ast.StmtNode) []*driver.ValueExpr {
+	collector := &nodeCollector{}
+	stmt.Accept(collector)
+	return collector.values
+}
+
+func collectTexts(stmt ast.StmtNode) []string {
+	collector := &nodeCollector{}
+	stmt.Accept(collector)
+	return collector.texts
+}
+
+func equalValueExpr(expected, actual *driver.ValueExpr) bool {
+	return reflect.DeepEqual(expected.Datum, actual.Datum) && reflect.DeepEqual(expected.Type, actual.Type)
+}
+
+func restore(stmt ast.StmtNode) (string, error) {
+	var sb strings.Builder
+	if err := stmt.Restore(format.NewRestoreCtx(format.DefaultRestoreFlags, &sb)); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
@@ -0,0 +1,134 @@
+/*
+ * Copyright 2022 CECTC, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package listener
+
+import (
+	"testing"
+
+	"github.com/agiledragon/gomonkey/v2"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/cectc/dbpack/third_party/parser"
+	"github.com/cectc/dbpack/third_party/parser/ast"
+)
+
+func TestStatementCache(t *testing.T) {
+	testCases := []struct {
+		first     string
+		second    string
+		cacheable bool
+	}{
+		{
+			first:     "select * from student where id = 1 and name = 'a' order by 2 limit 10",
+			second:    "select * from student where id = 2 and name = 'it''s' order by 2 limit 20",
+			cacheable: true,
+		},
+		{
+			first:     "select id, name from student where id in (1, 2) and age between 18 and 20 and deleted is not null",
+			second:    "select id, name from student where id in (3, 4) and age between 16 and 18 and deleted is not null",
+			cacheable: true,
+		},
+		{
+			first:     "insert into student(id, name, gender) values(1, 'a', null)",
+			second:    "insert into student(id, name, gender) values(2, 'b', null)",
+			cacheable: true,
+		},
+		{
+			first:     "update student set name = 'a', age = age + 1 where id = 1 limit 1",
+			second:    "update student set name = 'b', age = age + 2 where id = 2 limit 2",
+			cacheable: true,
+		},
+		{
+			first:     "  delete from student where id = 1.5  ",
+			second:    "  delete from student where id = 2.5  ",
+			cacheable: true,
+		},
+		{
+			// the literals of the select fields are the names of the fields
+			first:  "select id, 1 from student where id = 1",
+			second: "select id, 2 from student where id = 2",
+		},
+		{
+			first:  "show tables like 'a'",
+			second: "show tables like 'b'",
+		},
+	}
+	for _, c := range testCases {
+		t.Run(c.first, func(t *testing.T) {
+			statements := newStatementCache(0)
+			stmts, release, err := statements.Parse(c.first)
+			assert.Nil(t, err)
+			release()
+			assert.Len(t, stmts, 1)
+
+			expected, err := parser.New().ParseOneStmt(c.second, "", "")
+			assert.Nil(t, err)
+			var parsed int
+			patches := gomonkey.ApplyMethodFunc(parser.New(), "Parse", func(sql, charset, collation string) ([]ast.StmtNode, []error, error) {
+				parsed++
+				return nil, nil, errors.New("query should not be parsed")
+			})
+			defer patches.Reset()
+
+			stmts, release, err = statements.Parse(c.second)
+			defer release()
+			if !c.cacheable {
+				assert.Equal(t, 1, parsed)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, 0, parsed)
+			assert.Len(t, stmts, 1)
+			assert.Equal(t, expected.Text(), stmts[0].Text())
+			assert.Equal(t, restoreStmt(t, expected), restoreStmt(t, stmts[0]))
+			values := collectValueExprs(stmts[0])
+			for i, value := range collectValueExprs(expected) {
+				assert.True(t, equalValueExpr(value, values[i]))
+			}
+		})
+	}
+}
+
+func TestStatementCacheMismatch(t *testing.T) {
+	statements := newStatementCache(0)
+	_, release, err := statements.Parse("select * from student where id in (1, 2)")
+	assert.Nil(t, err)
+	release()
+
+	// the in list of another length has the same digest, and the literal of another kind
+	// is parsed as another value expression
+	for _, sql := range []string{
+		"select * from student where id in (1, 2, 3)",
+		"select * from student where id in (1, 2.5)",
+		"select * from student where id in (1, 18446744073709551615)",
+	} {
+		stmts, release, err := statements.Parse(sql)
+		assert.Nil(t, err)
+		expected, err := parser.New().ParseOneStmt(sql, "", "")
+		assert.Nil(t, err)
+		assert.Equal(t, restoreStmt(t, expected), restoreStmt(t, stmts[0]))
+		release()
+	}
+	assert.Equal(t, int64(1), statements.entries.Length())
+}
+
+func restoreStmt(t *testing.T, stmt ast.StmtNode) string {
+	sql, err := restore(stmt)
+	assert.Nil(t, err)
+	return sql
+}
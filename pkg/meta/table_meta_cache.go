@@ -20,6 +20,7 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/google/go-cmp/cmp"
@@ -40,12 +41,39 @@ var tableMetaCache = &MysqlTableMetaCache{
 	tableMetaCache: cache.New(ExpireTime, 10*ExpireTime),
 }
 
+func init() {
+	tableMetaCache.tableMetaCache.OnEvicted(func(key string, value interface{}) {
+		if meta, ok := value.(schema.TableMeta); ok {
+			tableMetaCache.notifyChanged(meta.SchemaName, meta.TableName)
+		}
+	})
+}
+
 func GetTableMetaCache() *MysqlTableMetaCache {
 	return tableMetaCache
 }
 
 type MysqlTableMetaCache struct {
 	tableMetaCache *cache.Cache
+
+	mu        sync.RWMutex
+	listeners []func(schemaName, tableName string)
+}
+
+// OnChanged registers a function called when the meta of a table is changed or evicted,
+// the caches built from the table meta should be invalidated by it.
+func (cache *MysqlTableMetaCache) OnChanged(f func(schemaName, tableName string)) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	cache.listeners = append(cache.listeners, f)
+}
+
+func (cache *MysqlTableMetaCache) notifyChanged(schemaName, tableName string) {
+	cache.mu.RLock()
+	defer cache.mu.RUnlock()
+	for _, f := range cache.listeners {
+		f(schemaName, tableName)
+	}
 }
 
 func (cache *MysqlTableMetaCache) GetTableMeta(ctx context.Context, db proto.DB, tableName string) (schema.TableMeta, error) {
@@ -83,6 +111,7 @@ func (cache *MysqlTableMetaCache) Refresh(db proto.DB) error {
 			}
 			if !cmp.Equal(tMeta, meta) {
 				cache.tableMetaCache.Set(key, tMeta, ExpireTime)
+				cache.notifyChanged(meta.SchemaName, meta.TableName)
 				log.Info("table meta change was found, update table meta cache automatically.")
 			}
 		}
@@ -241,7 +270,8 @@ func GetIndexes(ctx context.Context, db proto.DB, tableName string) ([]schema.In
 	//`COLUMN_NAME`, `COLLATION`, `CARDINALITY`, `SUB_PART`, `PACKED`, `NULLABLE`, `INDEX_TYPE`, `COMMENT`,
 	//`INDEX_COMMENT`, `IS_VISIBLE`, `EXPRESSION`
 	s := "SELECT `INDEX_NAME`, `COLUMN_NAME`, `NON_UNIQUE`, `INDEX_TYPE`, `SEQ_IN_INDEX`, `COLLATION`, `CARDINALITY` " +
-		"FROM `INFORMATION_SCHEMA`.`STATISTICS` WHERE `TABLE_SCHEMA` = ? AND `TABLE_NAME` = ?"
+		"FROM `INFORMATION_SCHEMA`.`STATISTICS` WHERE `TABLE_SCHEMA` = ? AND `TABLE_NAME` = ? " +
+		"ORDER BY `INDEX_NAME`, `SEQ_IN_INDEX`"
 
 	if dbName == "" {
 		dbName = schemaName
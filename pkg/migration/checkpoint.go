@@ -0,0 +1,104 @@
+/*
+ * Copyright 2022 CECTC, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package migration
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// Checkpoint records the progress of every source physical table, so that an interrupted
+// migration continues from the last copied batch.
+type Checkpoint struct {
+	path string
+	// "db.table" of the source physical table -> progress
+	Tables map[string]*TableProgress `json:"tables"`
+}
+
+// TableProgress is the progress of a source physical table.
+type TableProgress struct {
+	// LastPK is the primary key of the last copied row, valid if Rows > 0
+	LastPK   string `json:"last_pk"`
+	Rows     int64  `json:"rows"`
+	Finished bool   `json:"finished"`
+}
+
+// LoadCheckpoint loads the checkpoint file, an empty checkpoint is returned if the file
+// does not exist. The checkpoint is kept in memory only if path is empty.
+func LoadCheckpoint(path string) (*Checkpoint, error) {
+	checkpoint := &Checkpoint{
+		path:   path,
+		Tables: make(map[string]*TableProgress),
+	}
+	if path == "" {
+		return checkpoint, nil
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return checkpoint, nil
+		}
+		return nil, errors.Wrapf(err, "read checkpoint %s failed", path)
+	}
+	if err := json.Unmarshal(content, checkpoint); err != nil {
+		return nil, errors.Wrapf(err, "unmarshal checkpoint %s failed", path)
+	}
+	if checkpoint.Tables == nil {
+		checkpoint.Tables = make(map[string]*TableProgress)
+	}
+	return checkpoint, nil
+}
+
+// Progress returns the progress of the source physical table.
+func (c *Checkpoint) Progress(table string) *TableProgress {
+	progress, ok := c.Tables[table]
+	if !ok {
+		progress = &TableProgress{}
+		c.Tables[table] = progress
+	}
+	return progress
+}
+
+// Save writes the checkpoint to a temporary file and renames it, so the checkpoint file
+// is never half written.
+func (c *Checkpoint) Save() error {
+	if c.path == "" {
+		return nil
+	}
+	content, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(c.path), filepath.Base(c.path)+".*")
+	if err != nil {
+		return errors.Wrap(err, "create checkpoint failed")
+	}
+	if _, err = tmp.Write(content); err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return errors.Wrap(err, "write checkpoint failed")
+	}
+	return os.Rename(tmp.Name(), c.path)
+}
@@ -0,0 +1,50 @@
+/*
+ * Copyright 2022 CECTC, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package migration
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckpoint(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+	checkpoint, err := LoadCheckpoint(path)
+	assert.Nil(t, err)
+	progress := checkpoint.Progress("school_0.student_0")
+	assert.Equal(t, &TableProgress{}, progress)
+	progress.LastPK = "100"
+	progress.Rows = 100
+	assert.Nil(t, checkpoint.Save())
+	progress.Finished = true
+	assert.Nil(t, checkpoint.Save())
+
+	checkpoint, err = LoadCheckpoint(path)
+	assert.Nil(t, err)
+	assert.Equal(t, &TableProgress{LastPK: "100", Rows: 100, Finished: true},
+		checkpoint.Progress("school_0.student_0"))
+	matches, err := filepath.Glob(path + ".*")
+	assert.Nil(t, err)
+	assert.Empty(t, matches)
+
+	checkpoint, err = LoadCheckpoint("")
+	assert.Nil(t, err)
+	checkpoint.Progress("school_0.student_0").Rows = 1
+	assert.Nil(t, checkpoint.Save())
+}
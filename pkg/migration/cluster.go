@@ -0,0 +1,188 @@
+/*
+ * Copyright 2022 CECTC, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package migration
+
+import (
+	"database/sql"
+	"encoding/json"
+
+	"github.com/pkg/errors"
+
+	"github.com/cectc/dbpack/pkg/cond"
+	"github.com/cectc/dbpack/pkg/config"
+	"github.com/cectc/dbpack/pkg/executor"
+	"github.com/cectc/dbpack/pkg/topo"
+)
+
+// Cluster is the set of physical databases described by a sharding executor config.
+type Cluster struct {
+	Sharding *config.ShardingConfig
+	tables   map[string]*logicTable
+	// db group name -> write data source
+	dbs map[string]*sql.DB
+}
+
+type logicTable struct {
+	config    *config.LogicTable
+	topology  *topo.Topology
+	algorithm cond.ShardingAlgorithm
+}
+
+// LoadCluster loads the sharding executor `executorName` of the application `appID` from the
+// config file, appID and executorName can be empty if there is only one application or one
+// sharding executor.
+func LoadCluster(path, appID, executorName string) (*Cluster, error) {
+	conf, err := config.Load(path)
+	if err != nil {
+		return nil, err
+	}
+	var dbpackConf *config.DBPackConfig
+	if appID != "" {
+		dbpackConf = conf.AppConfig[appID]
+	} else if len(conf.AppConfig) == 1 {
+		for _, appConf := range conf.AppConfig {
+			dbpackConf = appConf
+		}
+	}
+	if dbpackConf == nil {
+		return nil, errors.Errorf("%s: application should be specified, found %d", path, len(conf.AppConfig))
+	}
+
+	var executorConf *config.Executor
+	for _, ec := range dbpackConf.Executors {
+		if ec.Mode != config.SHD || (executorName != "" && ec.Name != executorName) {
+			continue
+		}
+		if executorConf != nil {
+			return nil, errors.Errorf("%s: more than one sharding executor, executor should be specified", path)
+		}
+		executorConf = ec
+	}
+	if executorConf == nil {
+		return nil, errors.Errorf("%s: sharding executor %s not found", path, executorName)
+	}
+
+	var (
+		content        []byte
+		shardingConfig *config.ShardingConfig
+	)
+	if content, err = json.Marshal(executorConf.Config); err != nil {
+		return nil, errors.Wrap(err, "marshal sharding executor config failed.")
+	}
+	if err = json.Unmarshal(content, &shardingConfig); err != nil {
+		return nil, errors.Wrap(err, "unmarshal sharding executor config failed.")
+	}
+	return NewCluster(shardingConfig, dbpackConf.DataSources)
+}
+
+// NewCluster creates the cluster of the sharding config, the rows of a db group are read from
+// and written to the data source which has write weight.
+func NewCluster(shardingConfig *config.ShardingConfig, dataSources []*config.DataSource) (*Cluster, error) {
+	cluster := &Cluster{
+		Sharding: shardingConfig,
+		tables:   make(map[string]*logicTable),
+		dbs:      make(map[string]*sql.DB),
+	}
+	for _, table := range shardingConfig.LogicTables {
+		topology, err := topo.ParseTopologyWithSuffixes(table.DBName, table.TableName, table.Topology, table.TableSuffixes)
+		if err != nil {
+			return nil, err
+		}
+		// rows are copied with their primary keys, sequence generators are not needed
+		alg, err := executor.CreateShardingAlgorithm(table, topology, nil)
+		if err != nil {
+			return nil, err
+		}
+		cluster.tables[table.TableName] = &logicTable{
+			config:    table,
+			topology:  topology,
+			algorithm: alg,
+		}
+	}
+
+	dataSourceMap := make(map[string]*config.DataSource, len(dataSources))
+	for _, ds := range dataSources {
+		dataSourceMap[ds.Name] = ds
+	}
+	for _, group := range shardingConfig.DBGroups {
+		dataSource, err := writeDataSource(group, dataSourceMap)
+		if err != nil {
+			cluster.Close()
+			return nil, err
+		}
+		db, err := sql.Open("mysql", dataSource.DSN)
+		if err != nil {
+			cluster.Close()
+			return nil, err
+		}
+		cluster.dbs[group.Name] = db
+	}
+	return cluster, nil
+}
+
+func writeDataSource(group *config.DataSourceRefGroup, dataSources map[string]*config.DataSource) (*config.DataSource, error) {
+	for _, ref := range group.DataSources {
+		_, writeWeight, err := ref.ParseWeight()
+		if err != nil {
+			return nil, err
+		}
+		if writeWeight == 0 {
+			continue
+		}
+		dataSource, ok := dataSources[ref.Name]
+		if !ok {
+			return nil, errors.Errorf("data source %s of db group %s not found", ref.Name, group.Name)
+		}
+		return dataSource, nil
+	}
+	return nil, errors.Errorf("db group %s has no writable data source", group.Name)
+}
+
+// DB returns the write data source of the physical database.
+func (c *Cluster) DB(database string) (*sql.DB, error) {
+	db, ok := c.dbs[database]
+	if !ok {
+		return nil, errors.Errorf("db group %s not found", database)
+	}
+	return db, nil
+}
+
+// Close closes the data sources of the cluster.
+func (c *Cluster) Close() {
+	for _, db := range c.dbs {
+		db.Close()
+	}
+}
+
+// physicalTables returns the physical tables of the logic table in table index order.
+func (t *logicTable) physicalTables() []physicalTable {
+	result := make([]physicalTable, 0, t.topology.TableSliceLen)
+	for _, index := range t.topology.TableSlice {
+		table := t.topology.TableIndexMap[index]
+		result = append(result, physicalTable{database: t.topology.Tables[table], table: table})
+	}
+	return result
+}
+
+type physicalTable struct {
+	database string
+	table    string
+}
+
+func (t physicalTable) String() string {
+	return t.database + "." + t.table
+}
@@ -0,0 +1,193 @@
+/*
+ * Copyright 2022 CECTC, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package migration
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/cectc/dbpack/pkg/log"
+)
+
+const DefaultBatchSize = 1000
+
+// Options of the migration.
+type Options struct {
+	// Tables are the logic tables to migrate, all logic tables in both the source
+	// and the target configs are migrated if empty.
+	Tables    []string
+	BatchSize int
+	// CheckpointPath is the file which records the progress, the progress is not
+	// persisted if empty.
+	CheckpointPath string
+}
+
+// Migrator copies the rows of the source physical tables to the physical tables of the
+// target topology. The target physical tables must be created before migrating, and
+// should be different from the source physical tables.
+//
+// The migration is offline, the rows are copied as they are when read, changes made to
+// the source tables during the migration are not captured, writes to the migrating
+// tables must be stopped until the target tables are verified.
+//
+// Rows are read in primary key order in batches, and written by INSERT ... ON DUPLICATE
+// KEY UPDATE, the progress is saved after every batch, so the migration can be safely
+// re-run after it was interrupted.
+type Migrator struct {
+	source     *Cluster
+	target     *Cluster
+	tables     []string
+	batchSize  int
+	checkpoint *Checkpoint
+}
+
+func NewMigrator(source, target *Cluster, options *Options) (*Migrator, error) {
+	checkpoint, err := LoadCheckpoint(options.CheckpointPath)
+	if err != nil {
+		return nil, err
+	}
+	batchSize := options.BatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+	tables := options.Tables
+	if len(tables) == 0 {
+		for _, table := range source.Sharding.LogicTables {
+			if _, ok := target.tables[table.TableName]; ok {
+				tables = append(tables, table.TableName)
+			}
+		}
+	}
+	for _, table := range tables {
+		if _, ok := source.tables[table]; !ok {
+			return nil, errors.Errorf("logic table %s not found in source config", table)
+		}
+		if _, ok := target.tables[table]; !ok {
+			return nil, errors.Errorf("logic table %s not found in target config", table)
+		}
+	}
+	if len(tables) == 0 {
+		return nil, errors.New("no logic table to migrate")
+	}
+	return &Migrator{
+		source:     source,
+		target:     target,
+		tables:     tables,
+		batchSize:  batchSize,
+		checkpoint: checkpoint,
+	}, nil
+}
+
+// Migrate copies the rows of all logic tables.
+func (m *Migrator) Migrate(ctx context.Context) error {
+	for _, table := range m.tables {
+		for _, source := range m.source.tables[table].physicalTables() {
+			if err := m.migrateTable(ctx, table, source); err != nil {
+				return errors.Wrapf(err, "migrate %s failed", source)
+			}
+		}
+	}
+	return nil
+}
+
+func (m *Migrator) migrateTable(ctx context.Context, logicTable string, source physicalTable) error {
+	progress := m.checkpoint.Progress(source.String())
+	if progress.Finished {
+		log.Infof("%s has been migrated, %d rows", source, progress.Rows)
+		return nil
+	}
+	db, err := m.source.DB(source.database)
+	if err != nil {
+		return err
+	}
+	meta, err := loadTableMeta(ctx, db, source.table)
+	if err != nil {
+		return err
+	}
+	target := m.target.tables[logicTable]
+	router, err := newRowRouter(target.algorithm, target.topology, meta)
+	if err != nil {
+		return err
+	}
+
+	var lastPK *string
+	if progress.Rows > 0 {
+		lastPK = &progress.LastPK
+	}
+	for {
+		rows, err := selectBatch(ctx, db, source.table, meta, lastPK, m.batchSize)
+		if err != nil {
+			return err
+		}
+		if len(rows) == 0 {
+			break
+		}
+		if err := m.writeBatch(ctx, router, meta, rows); err != nil {
+			return err
+		}
+		last := string(rows[len(rows)-1][meta.pkIndex])
+		lastPK = &last
+		progress.LastPK = last
+		progress.Rows += int64(len(rows))
+		if err := m.checkpoint.Save(); err != nil {
+			return err
+		}
+		log.Infof("%s: %d rows migrated", source, progress.Rows)
+		if len(rows) < m.batchSize {
+			break
+		}
+	}
+	progress.Finished = true
+	return m.checkpoint.Save()
+}
+
+func (m *Migrator) writeBatch(ctx context.Context, router *rowRouter, meta *tableMeta, rows []record) error {
+	shards := make(map[physicalTable][]record)
+	var order []physicalTable
+	for _, row := range rows {
+		target, err := router.route(row)
+		if err != nil {
+			return err
+		}
+		if _, ok := shards[target]; !ok {
+			order = append(order, target)
+		}
+		shards[target] = append(shards[target], row)
+	}
+	for _, target := range order {
+		db, err := m.target.DB(target.database)
+		if err != nil {
+			return err
+		}
+		shardRows := shards[target]
+		args := make([]interface{}, 0, len(shardRows)*len(meta.columns))
+		for _, row := range shardRows {
+			for _, value := range row {
+				if value == nil {
+					args = append(args, nil)
+				} else {
+					args = append(args, value)
+				}
+			}
+		}
+		if _, err := db.ExecContext(ctx, upsertSQL(target.table, meta.columns, meta.pk, len(shardRows)), args...); err != nil {
+			return errors.Wrapf(err, "write %s failed", target)
+		}
+	}
+	return nil
+}
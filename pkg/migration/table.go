@@ -0,0 +1,275 @@
+/*
+ * Copyright 2022 CECTC, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/cectc/dbpack/pkg/cond"
+	"github.com/cectc/dbpack/pkg/topo"
+	"github.com/cectc/dbpack/third_party/parser/opcode"
+)
+
+const selectColumns = "SELECT `COLUMN_NAME`, `DATA_TYPE`, `COLUMN_KEY` FROM `information_schema`.`COLUMNS` " +
+	"WHERE `TABLE_SCHEMA` = DATABASE() AND `TABLE_NAME` = ? ORDER BY `ORDINAL_POSITION`"
+
+// record is a row of the table, NULL values are nil.
+type record [][]byte
+
+type tableMeta struct {
+	columns []string
+	// integer columns are sharded by integer values, others by string values
+	integers []bool
+	pk       string
+	pkIndex  int
+}
+
+func loadTableMeta(ctx context.Context, db *sql.DB, table string) (*tableMeta, error) {
+	rows, err := db.QueryContext(ctx, selectColumns, table)
+	if err != nil {
+		return nil, errors.Wrapf(err, "query columns of %s failed", table)
+	}
+	defer rows.Close()
+
+	meta := &tableMeta{pkIndex: -1}
+	for rows.Next() {
+		var name, dataType, columnKey string
+		if err := rows.Scan(&name, &dataType, &columnKey); err != nil {
+			return nil, err
+		}
+		if strings.EqualFold(columnKey, "PRI") {
+			if meta.pkIndex >= 0 {
+				return nil, errors.Errorf("table %s has a composite primary key, which is not supported", table)
+			}
+			meta.pk = name
+			meta.pkIndex = len(meta.columns)
+		}
+		meta.columns = append(meta.columns, name)
+		meta.integers = append(meta.integers, isIntegerType(dataType))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(meta.columns) == 0 {
+		return nil, errors.Errorf("table %s does not exist", table)
+	}
+	if meta.pkIndex < 0 {
+		return nil, errors.Errorf("table %s has no primary key", table)
+	}
+	return meta, nil
+}
+
+func isIntegerType(dataType string) bool {
+	switch strings.ToLower(dataType) {
+	case "tinyint", "smallint", "mediumint", "int", "integer", "bigint":
+		return true
+	}
+	return false
+}
+
+// selectBatch reads at most `limit` rows whose primary keys are greater than lastPK,
+// rows are read from the beginning of the table if lastPK is nil.
+func selectBatch(ctx context.Context, db *sql.DB, table string, meta *tableMeta,
+	lastPK *string, limit int) ([]record, error) {
+	args := []interface{}{}
+	if lastPK != nil {
+		args = append(args, *lastPK)
+	}
+	args = append(args, limit)
+	rows, err := db.QueryContext(ctx, selectBatchSQL(table, meta.columns, meta.pk, lastPK != nil), args...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "read %s failed", table)
+	}
+	defer rows.Close()
+
+	var result []record
+	for rows.Next() {
+		row := make(record, len(meta.columns))
+		dest := make([]interface{}, len(row))
+		for i := range row {
+			dest[i] = &row[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		result = append(result, row)
+	}
+	return result, rows.Err()
+}
+
+// scanTable calls fn with every row of the table in primary key order.
+func scanTable(ctx context.Context, db *sql.DB, table string, meta *tableMeta,
+	batchSize int, fn func(row record) error) error {
+	var lastPK *string
+	for {
+		rows, err := selectBatch(ctx, db, table, meta, lastPK, batchSize)
+		if err != nil {
+			return err
+		}
+		for _, row := range rows {
+			if err := fn(row); err != nil {
+				return err
+			}
+		}
+		if len(rows) < batchSize {
+			return nil
+		}
+		last := string(rows[len(rows)-1][meta.pkIndex])
+		lastPK = &last
+	}
+}
+
+func selectBatchSQL(table string, columns []string, pk string, hasCursor bool) string {
+	var sb strings.Builder
+	sb.WriteString("SELECT ")
+	for i, column := range columns {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		sb.WriteString(quote(column))
+	}
+	fmt.Fprintf(&sb, " FROM %s", quote(table))
+	if hasCursor {
+		fmt.Fprintf(&sb, " WHERE %s > ?", quote(pk))
+	}
+	fmt.Fprintf(&sb, " ORDER BY %s LIMIT ?", quote(pk))
+	return sb.String()
+}
+
+// upsertSQL builds the statement which inserts `rows` rows, the existing rows are
+// overwritten so that copying a batch again has no side effect.
+func upsertSQL(table string, columns []string, pk string, rows int) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "INSERT INTO %s (", quote(table))
+	for i, column := range columns {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		sb.WriteString(quote(column))
+	}
+	sb.WriteString(") VALUES ")
+	placeholders := "(" + strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ") + ")"
+	for i := 0; i < rows; i++ {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		sb.WriteString(placeholders)
+	}
+	sb.WriteString(" ON DUPLICATE KEY UPDATE ")
+	first := true
+	for _, column := range columns {
+		if column == pk {
+			continue
+		}
+		if !first {
+			sb.WriteString(", ")
+		}
+		first = false
+		fmt.Fprintf(&sb, "%s = VALUES(%s)", quote(column), quote(column))
+	}
+	if first {
+		// the table only has the primary key column
+		fmt.Fprintf(&sb, "%s = %s", quote(pk), quote(pk))
+	}
+	return sb.String()
+}
+
+func quote(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+// rowRouter routes rows to the physical tables of the target topology.
+type rowRouter struct {
+	algorithm cond.ShardingAlgorithm
+	topology  *topo.Topology
+	meta      *tableMeta
+	// indexes of the sharding columns
+	indexes []int
+}
+
+func newRowRouter(algorithm cond.ShardingAlgorithm, topology *topo.Topology, meta *tableMeta) (*rowRouter, error) {
+	router := &rowRouter{
+		algorithm: algorithm,
+		topology:  topology,
+		meta:      meta,
+	}
+	for i, column := range meta.columns {
+		if algorithm.HasShardingKey(column) {
+			router.indexes = append(router.indexes, i)
+		}
+	}
+	if len(router.indexes) == 0 {
+		return nil, errors.Errorf("sharding key of table %s not found", topology.TableName)
+	}
+	return router, nil
+}
+
+func (r *rowRouter) route(row record) (physicalTable, error) {
+	var indexes cond.TableIndexSliceCondition
+	for i, index := range r.indexes {
+		value, err := r.shardingValue(row, index)
+		if err != nil {
+			return physicalTable{}, err
+		}
+		cd := &cond.KeyCondition{
+			Key:   r.meta.columns[index],
+			Op:    opcode.EQ,
+			Value: value,
+		}
+		shardIndexes, err := cd.Shard(r.algorithm)
+		if err != nil {
+			return physicalTable{}, errors.Wrap(err, "compute shards failed")
+		}
+		if i == 0 {
+			indexes = shardIndexes
+		} else {
+			indexes = indexes.And(shardIndexes).(cond.TableIndexSliceCondition)
+		}
+	}
+	_, shardMap := indexes.ParseTopology(r.topology)
+	if len(shardMap) == 1 {
+		for database, tables := range shardMap {
+			if len(tables) == 1 {
+				return physicalTable{database: database, table: tables[0]}, nil
+			}
+		}
+	}
+	return physicalTable{}, errors.Errorf("row with %s = %s should be routed to exactly one table",
+		r.meta.pk, row[r.meta.pkIndex])
+}
+
+func (r *rowRouter) shardingValue(row record, index int) (interface{}, error) {
+	value := row[index]
+	if value == nil {
+		return nil, errors.Errorf("sharding key %s of row with %s = %s is null",
+			r.meta.columns[index], r.meta.pk, row[r.meta.pkIndex])
+	}
+	if r.meta.integers[index] {
+		if val, err := strconv.ParseInt(string(value), 10, 64); err == nil {
+			return val, nil
+		}
+		// unsigned bigint out of int64 range
+		return strconv.ParseUint(string(value), 10, 64)
+	}
+	return string(value), nil
+}
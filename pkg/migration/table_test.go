@@ -0,0 +1,85 @@
+/*
+ * Copyright 2022 CECTC, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package migration
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/cectc/dbpack/pkg/cond"
+	"github.com/cectc/dbpack/pkg/topo"
+)
+
+func TestSelectBatchSQL(t *testing.T) {
+	columns := []string{"id", "name", "age"}
+	assert.Equal(t, "SELECT `id`, `name`, `age` FROM `student_0` ORDER BY `id` LIMIT ?",
+		selectBatchSQL("student_0", columns, "id", false))
+	assert.Equal(t, "SELECT `id`, `name`, `age` FROM `student_0` WHERE `id` > ? ORDER BY `id` LIMIT ?",
+		selectBatchSQL("student_0", columns, "id", true))
+}
+
+func TestUpsertSQL(t *testing.T) {
+	assert.Equal(t, "INSERT INTO `student_1` (`id`, `name`, `age`) VALUES (?, ?, ?), (?, ?, ?) "+
+		"ON DUPLICATE KEY UPDATE `name` = VALUES(`name`), `age` = VALUES(`age`)",
+		upsertSQL("student_1", []string{"id", "name", "age"}, "id", 2))
+	assert.Equal(t, "INSERT INTO `seq` (`id`) VALUES (?) ON DUPLICATE KEY UPDATE `id` = `id`",
+		upsertSQL("seq", []string{"id"}, "id", 1))
+}
+
+func TestRowRouter(t *testing.T) {
+	topology, err := topo.ParseTopology("school", "student", map[int]string{0: "0-3", 1: "4-7"})
+	assert.Nil(t, err)
+	alg := cond.NewNumberMod("uid", false, topology, nil)
+	meta := &tableMeta{
+		columns:  []string{"id", "uid", "name"},
+		integers: []bool{true, true, false},
+		pk:       "id",
+	}
+	router, err := newRowRouter(alg, topology, meta)
+	assert.Nil(t, err)
+	assert.Equal(t, []int{1}, router.indexes)
+
+	shard, err := router.route(record{[]byte("1"), []byte("13"), []byte("scott")})
+	assert.Nil(t, err)
+	assert.Equal(t, physicalTable{database: "school_1", table: "student_5"}, shard)
+
+	_, err = router.route(record{[]byte("2"), nil, []byte("tiger")})
+	assert.NotNil(t, err)
+
+	_, err = newRowRouter(alg, topology, &tableMeta{columns: []string{"id", "name"}})
+	assert.NotNil(t, err)
+}
+
+func TestRowChecksum(t *testing.T) {
+	row := record{[]byte("1"), []byte("scott"), nil}
+	assert.Equal(t, rowChecksum(row), rowChecksum(record{[]byte("1"), []byte("scott"), nil}))
+	assert.NotEqual(t, rowChecksum(row), rowChecksum(record{[]byte("1"), []byte("scott"), []byte("")}))
+	assert.NotEqual(t, rowChecksum(record{[]byte("ab"), []byte("c")}), rowChecksum(record{[]byte("a"), []byte("bc")}))
+
+	report1, report2 := &ShardReport{}, &ShardReport{}
+	rows := []record{row, {[]byte("2"), []byte("tiger"), []byte("18")}}
+	for i := range rows {
+		report1.add(rowChecksum(rows[i]), true)
+		report2.add(rowChecksum(rows[len(rows)-1-i]), true)
+		report1.add(rowChecksum(rows[len(rows)-1-i]), false)
+	}
+	assert.True(t, report1.Consistent())
+	assert.Equal(t, report1.ExpectedChecksum, report2.ExpectedChecksum)
+	report1.add(rowChecksum(row), false)
+	assert.False(t, report1.Consistent())
+}
@@ -0,0 +1,160 @@
+/*
+ * Copyright 2022 CECTC, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package migration
+
+import (
+	"context"
+	"encoding/binary"
+	"hash/crc32"
+
+	"github.com/pkg/errors"
+)
+
+// ShardReport compares the rows which should be in a target physical table with the rows in it.
+type ShardReport struct {
+	LogicTable       string
+	Database         string
+	Table            string
+	ExpectedRows     int64
+	ActualRows       int64
+	ExpectedChecksum uint64
+	ActualChecksum   uint64
+}
+
+// Consistent returns true if the row count and the checksum are equal.
+func (r *ShardReport) Consistent() bool {
+	return r.ExpectedRows == r.ActualRows && r.ExpectedChecksum == r.ActualChecksum
+}
+
+// add accumulates the row, the checksum is the sum of the row checksums, so it does not
+// depend on the order of the rows.
+func (r *ShardReport) add(checksum uint32, expected bool) {
+	if expected {
+		r.ExpectedRows++
+		r.ExpectedChecksum += uint64(checksum)
+	} else {
+		r.ActualRows++
+		r.ActualChecksum += uint64(checksum)
+	}
+}
+
+func rowChecksum(row record) uint32 {
+	var length [4]byte
+	hash := crc32.NewIEEE()
+	for _, value := range row {
+		if value == nil {
+			// distinguish NULL from empty string
+			hash.Write([]byte{0xff, 0xff, 0xff, 0xff})
+			continue
+		}
+		binary.BigEndian.PutUint32(length[:], uint32(len(value)))
+		hash.Write(length[:])
+		hash.Write(value)
+	}
+	return hash.Sum32()
+}
+
+// Verify routes every source row by the target topology, then compares the row count and
+// the checksum of every target physical table with the rows routed to it. The columns of
+// the source tables are compared, the target tables may have more columns.
+func (m *Migrator) Verify(ctx context.Context) ([]*ShardReport, error) {
+	var reports []*ShardReport
+	for _, table := range m.tables {
+		tableReports, err := m.verifyTable(ctx, table)
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, tableReports...)
+	}
+	return reports, nil
+}
+
+func (m *Migrator) verifyTable(ctx context.Context, logicTable string) ([]*ShardReport, error) {
+	var (
+		target  = m.target.tables[logicTable]
+		meta    *tableMeta
+		router  *rowRouter
+		reports []*ShardReport
+		shards  = make(map[physicalTable]*ShardReport)
+	)
+	for _, shard := range target.physicalTables() {
+		report := &ShardReport{LogicTable: logicTable, Database: shard.database, Table: shard.table}
+		reports = append(reports, report)
+		shards[shard] = report
+	}
+
+	for _, source := range m.source.tables[logicTable].physicalTables() {
+		db, err := m.source.DB(source.database)
+		if err != nil {
+			return nil, err
+		}
+		sourceMeta, err := loadTableMeta(ctx, db, source.table)
+		if err != nil {
+			return nil, err
+		}
+		if meta == nil {
+			meta = sourceMeta
+			if router, err = newRowRouter(target.algorithm, target.topology, meta); err != nil {
+				return nil, err
+			}
+		} else if !equalColumns(meta.columns, sourceMeta.columns) {
+			return nil, errors.Errorf("columns of %s are different from other source tables", source)
+		}
+		err = scanTable(ctx, db, source.table, meta, m.batchSize, func(row record) error {
+			shard, err := router.route(row)
+			if err != nil {
+				return err
+			}
+			shards[shard].add(rowChecksum(row), true)
+			return nil
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "verify %s failed", source)
+		}
+	}
+	if meta == nil {
+		return reports, nil
+	}
+
+	for _, shard := range target.physicalTables() {
+		db, err := m.target.DB(shard.database)
+		if err != nil {
+			return nil, err
+		}
+		targetMeta := &tableMeta{columns: meta.columns, pk: meta.pk, pkIndex: meta.pkIndex}
+		err = scanTable(ctx, db, shard.table, targetMeta, m.batchSize, func(row record) error {
+			shards[shard].add(rowChecksum(row), false)
+			return nil
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "verify %s failed", shard)
+		}
+	}
+	return reports, nil
+}
+
+func equalColumns(columns1, columns2 []string) bool {
+	if len(columns1) != len(columns2) {
+		return false
+	}
+	for i := range columns1 {
+		if columns1[i] != columns2[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -115,7 +115,7 @@ func Compare(a, b interface{}) int {
 
 	if _floatReg.MatchString(s1) && _floatReg.MatchString(s2) {
 		f1, _ := strconv.ParseFloat(s1, 64)
-		f2, _ := strconv.ParseFloat(s1, 64)
+		f2, _ := strconv.ParseFloat(s2, 64)
 		switch {
 		case f1 > f2:
 			return 1
@@ -19,8 +19,13 @@ package misc
 import (
 	"fmt"
 	"strings"
+
+	"github.com/cectc/dbpack/third_party/parser/format"
 )
 
+// SQLExpr is an expression written into the sql as it is, e.g. a value restored from a statement.
+type SQLExpr string
+
 func MysqlAppendInParam(size int) string {
 	var sb strings.Builder
 	sb.WriteByte('(')
@@ -51,18 +56,7 @@ func MysqlAppendInParamWithValue(values []interface{}) string {
 	var sb strings.Builder
 	sb.WriteByte('(')
 	for i, value := range values {
-		switch val := value.(type) {
-		case string:
-			if strings.HasPrefix(val, "'") {
-				sb.WriteString(fmt.Sprintf("%s", val))
-			} else {
-				sb.WriteString(fmt.Sprintf("'%s'", val))
-			}
-		case []byte:
-			sb.WriteString(fmt.Sprintf("'%s'", val))
-		default:
-			sb.WriteString(fmt.Sprintf("%v", val))
-		}
+		writeMysqlValue(&sb, value)
 		if i < len(values)-1 {
 			sb.WriteByte(',')
 		}
@@ -70,3 +64,56 @@ func MysqlAppendInParamWithValue(values []interface{}) string {
 	sb.WriteByte(')')
 	return sb.String()
 }
+
+// writeMysqlValue writes the value as a literal, strings are quoted and escaped the same way as
+// the string literals of the restored statements.
+func writeMysqlValue(sb *strings.Builder, value interface{}) {
+	switch val := value.(type) {
+	case nil:
+		sb.WriteString("NULL")
+	case SQLExpr:
+		sb.WriteString(string(val))
+	case string:
+		format.NewRestoreCtx(format.RestoreStringSingleQuotes|format.RestoreStringEscapeBackslash, sb).WriteString(val)
+	case []byte:
+		format.NewRestoreCtx(format.RestoreStringSingleQuotes|format.RestoreStringEscapeBackslash, sb).WriteString(string(val))
+	default:
+		sb.WriteString(fmt.Sprintf("%v", val))
+	}
+}
+
+// MysqlAppendInRowParam returns the placeholders of rows, a row constructor is used
+// for every row if a row has more than one column, e.g. ((?,?),(?,?)).
+func MysqlAppendInRowParam(rows, columns int) string {
+	if columns == 1 {
+		return MysqlAppendInParam(rows)
+	}
+	var sb strings.Builder
+	sb.WriteByte('(')
+	for i := 0; i < rows; i++ {
+		sb.WriteString(MysqlAppendInParam(columns))
+		if i < rows-1 {
+			sb.WriteByte(',')
+		}
+	}
+	sb.WriteByte(')')
+	return sb.String()
+}
+
+// MysqlAppendInRowParamWithValue is the same as MysqlAppendInRowParam, but writes the values.
+func MysqlAppendInRowParamWithValue(rows [][]interface{}) string {
+	var sb strings.Builder
+	sb.WriteByte('(')
+	for i, row := range rows {
+		if len(row) == 1 {
+			writeMysqlValue(&sb, row[0])
+		} else {
+			sb.WriteString(MysqlAppendInParamWithValue(row))
+		}
+		if i < len(rows)-1 {
+			sb.WriteByte(',')
+		}
+	}
+	sb.WriteByte(')')
+	return sb.String()
+}
@@ -82,8 +82,8 @@ func TestMysqlAppendInParamWithValue(t *testing.T) {
 			out: "('abc','xyz')",
 		},
 		"1": {
-			in:  []interface{}{"'abc'", "'xyz'"},
-			out: "('abc','xyz')",
+			in:  []interface{}{"'abc'", `x\'yz`},
+			out: `('''abc''','x\\''yz')`,
 		},
 		"2": {
 			in:  []interface{}{[]byte("abc"), []byte("xyz")},
@@ -97,6 +97,10 @@ func TestMysqlAppendInParamWithValue(t *testing.T) {
 			in:  []interface{}{int64(1), int64(2), int64(3)},
 			out: "(1,2,3)",
 		},
+		"5": {
+			in:  []interface{}{SQLExpr("'abc'"), SQLExpr("-1"), nil},
+			out: "('abc',-1,NULL)",
+		},
 	}
 	for caseTitle, tc := range cases {
 		t.Run(caseTitle, func(t *testing.T) {
@@ -105,3 +109,17 @@ func TestMysqlAppendInParamWithValue(t *testing.T) {
 		})
 	}
 }
+
+func TestMysqlAppendInRowParam(t *testing.T) {
+	assert.Equal(t, "(?,?)", MysqlAppendInRowParam(2, 1))
+	assert.Equal(t, "((?,?),(?,?),(?,?))", MysqlAppendInRowParam(3, 2))
+}
+
+func TestMysqlAppendInRowParamWithValue(t *testing.T) {
+	assert.Equal(t, "(1,'abc')", MysqlAppendInRowParamWithValue([][]interface{}{{1}, {"abc"}}))
+	assert.Equal(t, "((1,'abc'),(2,'xyz'))",
+		MysqlAppendInRowParamWithValue([][]interface{}{{1, "abc"}, {int64(2), []byte("xyz")}}))
+	// the quotes in a composite varchar key do not end the literals
+	assert.Equal(t, "((1,'o''brien'),(2,''') or 1=1 -- '))",
+		MysqlAppendInRowParamWithValue([][]interface{}{{1, "o'brien"}, {2, []byte("') or 1=1 -- ")}}))
+}
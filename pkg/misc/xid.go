@@ -33,3 +33,21 @@ func GetTransactionID(xid string) int64 {
 	tranID, _ := strconv.ParseInt(xid[idx+1:], 10, 64)
 	return tranID
 }
+
+// GetApplicationID returns the application id of a xid formatted as gs/{appid}/{transaction id}
+func GetApplicationID(xid string) string {
+	return getApplicationID(xid, "gs")
+}
+
+// GetBranchApplicationID returns the application id of a branch id formatted as bs/{appid}/{branch session id}
+func GetBranchApplicationID(branchID string) string {
+	return getApplicationID(branchID, "bs")
+}
+
+func getApplicationID(id, prefix string) string {
+	parts := strings.Split(id, "/")
+	if len(parts) != 3 || parts[0] != prefix {
+		return ""
+	}
+	return parts[1]
+}
@@ -43,3 +43,53 @@ func TestGetTransactionID(t *testing.T) {
 		})
 	}
 }
+
+func TestGetApplicationID(t *testing.T) {
+	testCases := []struct {
+		in     string
+		expect string
+	}{
+		{
+			in:     "gs/aggregationSvc/2612341069705662465",
+			expect: "aggregationSvc",
+		},
+		{
+			in:     "bs/aggregationSvc/2612341069705662465",
+			expect: "",
+		},
+		{
+			in:     "aggregationSvc",
+			expect: "",
+		},
+	}
+	for _, c := range testCases {
+		t.Run(c.in, func(t *testing.T) {
+			assert.Equal(t, c.expect, GetApplicationID(c.in))
+		})
+	}
+}
+
+func TestGetBranchApplicationID(t *testing.T) {
+	testCases := []struct {
+		in     string
+		expect string
+	}{
+		{
+			in:     "bs/aggregationSvc/2612341069705662465",
+			expect: "aggregationSvc",
+		},
+		{
+			in:     "gs/aggregationSvc/2612341069705662465",
+			expect: "",
+		},
+		{
+			in:     "bs/aggregationSvc",
+			expect: "",
+		},
+	}
+	for _, c := range testCases {
+		t.Run(c.in, func(t *testing.T) {
+			assert.Equal(t, c.expect, GetBranchApplicationID(c.in))
+		})
+	}
+}
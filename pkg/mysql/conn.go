@@ -100,6 +100,10 @@ type Conn struct {
 	// by Handler methods.
 	statusFlags uint16
 
+	// capabilities is the subset of the capabilities negotiated with the client which
+	// are used later in the protocol. It is only used by the server.
+	capabilities uint32
+
 	// Packet encoding variables.
 	sequence       uint8
 	bufferedReader *bufio.Reader
@@ -121,6 +125,13 @@ type Conn struct {
 
 	ReadTimeout  time.Duration // I/O read timeout
 	WriteTimeout time.Duration // I/O write timeout
+
+	// statementID is the id of the last statement prepared by the client,
+	// it is only used by the server.
+	statementID uint32
+	// stmts is the prepared statements of the client, keyed by statement id.
+	// They are freed when the client closes them, resets or closes the connection.
+	stmts *sync.Map
 }
 
 // NewConn is an internal method to create a Conn. Used by client and server
@@ -131,7 +142,46 @@ func NewConn(conn net.Conn) *Conn {
 		closed:         sync2.NewAtomicBool(false),
 		bufferedReader: bufio.NewReaderSize(conn, connBufferSize),
 		statusFlags:    constant.ServerStatusAutocommit,
+		stmts:          &sync.Map{},
+	}
+}
+
+// NextStatementID returns a new id for the statement prepared by the client.
+func (c *Conn) NextStatementID() uint32 {
+	c.statementID++
+	return c.statementID
+}
+
+// Stmts returns the prepared statements of the client.
+func (c *Conn) Stmts() *sync.Map {
+	return c.stmts
+}
+
+// Stmt returns the prepared statement with the statement id.
+func (c *Conn) Stmt(statementID uint32) (*proto.Stmt, bool) {
+	stmt, ok := c.stmts.Load(statementID)
+	if !ok {
+		return nil, false
 	}
+	return stmt.(*proto.Stmt), true
+}
+
+// StoreStmt keeps the statement prepared by the client.
+func (c *Conn) StoreStmt(stmt *proto.Stmt) {
+	c.stmts.Store(stmt.StatementID, stmt)
+}
+
+// DeleteStmt frees the prepared statement, it is called on COM_STMT_CLOSE.
+func (c *Conn) DeleteStmt(statementID uint32) {
+	c.stmts.Delete(statementID)
+}
+
+// ClearStmts frees all the prepared statements of the client.
+func (c *Conn) ClearStmts() {
+	c.stmts.Range(func(key, value interface{}) bool {
+		c.stmts.Delete(key)
+		return true
+	})
 }
 
 // StartWriterBuffering starts using buffered writes. This should
@@ -886,6 +936,21 @@ func (c *Conn) WriteRows(result *Result) error {
 	return nil
 }
 
+// WriteRow writes a row of a StreamResult, rows read from the backend are forwarded as they are,
+// rows built by dbpack are encoded from their values.
+func (c *Conn) WriteRow(fields []*Field, row proto.Row) error {
+	if data := row.Data(); len(data) != 0 {
+		return c.WritePacket(data)
+	}
+	switch r := row.(type) {
+	case *TextRow:
+		return c.writeTextRow(r.Values)
+	case *BinaryRow:
+		return c.writeBinaryRows(fields, r.Values)
+	}
+	return nil
+}
+
 // WriteEndResult concludes the sending of a Result.
 // if more is set to true, then it means there are more results afterwords
 func (c *Conn) WriteEndResult(capabilities uint32, more bool, affectedRows, lastInsertID uint64, warnings uint16) error {
@@ -1001,6 +1066,20 @@ func (c *Conn) WriteEOFPacket(flags uint16, warnings uint16) error {
 	return c.WriteEphemeralPacket()
 }
 
+// UpgradeToTLS switches the server side connection to TLS after the client asks for SSL
+// in the handshake, the TLS handshake is performed by the next read.
+func (c *Conn) UpgradeToTLS(config *tls.Config) {
+	conn := tls.Server(c.conn, config)
+	c.conn = conn
+	c.bufferedReader.Reset(conn)
+}
+
+// IsTLS returns true if the connection is using TLS.
+func (c *Conn) IsTLS() bool {
+	_, ok := c.conn.(*tls.Conn)
+	return ok
+}
+
 // GetTLSClientCerts gets TLS certificates.
 func (c *Conn) GetTLSClientCerts() []*x509.Certificate {
 	if tlsConn, ok := c.conn.(*tls.Conn); ok {
@@ -1043,6 +1122,15 @@ func (c *Conn) StatusFlags() uint16 {
 	return c.statusFlags
 }
 
+// Capabilities returns the capabilities negotiated with the client.
+func (c *Conn) Capabilities() uint32 {
+	return c.capabilities
+}
+
+func (c *Conn) SetCapabilities(capabilities uint32) {
+	c.capabilities = capabilities
+}
+
 // Ident returns a useful identification string for error logging
 func (c *Conn) String() string {
 	return fmt.Sprintf("client %v (%s)", c.connectionID, c.RemoteAddr().String())
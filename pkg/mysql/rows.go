@@ -50,6 +50,29 @@ type TextRow struct {
 	Values  []*proto.Value
 }
 
+// NewTextRow builds a decoded text protocol row from values, it is used when
+// dbpack produces rows itself, such as merging or joining results.
+func NewTextRow(fields []*Field, values []*proto.Value) *TextRow {
+	return &TextRow{
+		row: &row{
+			ResultSet: &ResultSet{Columns: fields},
+		},
+		decoded: true,
+		Values:  values,
+	}
+}
+
+// NewBinaryRow builds a decoded binary protocol row from values.
+func NewBinaryRow(fields []*Field, values []*proto.Value) *BinaryRow {
+	return &BinaryRow{
+		row: &row{
+			ResultSet: &ResultSet{Columns: fields},
+		},
+		decoded: true,
+		Values:  values,
+	}
+}
+
 func (row *row) Columns() []string {
 	if row.ResultSet.ColumnNames != nil {
 		return row.ResultSet.ColumnNames
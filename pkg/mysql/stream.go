@@ -0,0 +1,118 @@
+/*
+ * Copyright 2022 CECTC, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mysql
+
+import (
+	"io"
+
+	"github.com/cectc/dbpack/pkg/proto"
+)
+
+// RowIterator iterates the rows of a result set.
+type RowIterator interface {
+	// Next returns the next row, io.EOF is returned if there are no more rows.
+	Next() (proto.Row, error)
+	// Warnings returns the warning count of the result set, it is valid after Next returns io.EOF.
+	Warnings() uint16
+	// Close discards the rows not read yet and releases the resources held by the iterator.
+	Close() error
+}
+
+// StreamResult is a result set whose rows are read from the backend when they are iterated,
+// so that the rows can be forwarded to the client without buffering the whole result set.
+// The rows must be iterated to the end or be closed, or the backend connection leaks.
+type StreamResult struct {
+	Fields []*Field
+	Rows   RowIterator
+}
+
+func (res *StreamResult) LastInsertId() (uint64, error) {
+	return 0, nil
+}
+
+func (res *StreamResult) RowsAffected() (uint64, error) {
+	return 0, nil
+}
+
+// Buffer reads all rows of the stream into a Result.
+func (res *StreamResult) Buffer() (*Result, uint16, error) {
+	defer res.Rows.Close()
+	result := &Result{Fields: res.Fields}
+	for {
+		row, err := res.Rows.Next()
+		if err == io.EOF {
+			result.AffectedRows = uint64(len(result.Rows))
+			return result, res.Rows.Warnings(), nil
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		result.Rows = append(result.Rows, row)
+	}
+}
+
+type rowsIterator struct {
+	rows     []proto.Row
+	index    int
+	warnings uint16
+}
+
+// NewRowsIterator returns an iterator of the rows in memory.
+func NewRowsIterator(rows []proto.Row, warnings uint16) RowIterator {
+	return &rowsIterator{rows: rows, warnings: warnings}
+}
+
+func (iter *rowsIterator) Next() (proto.Row, error) {
+	if iter.index == len(iter.rows) {
+		return nil, io.EOF
+	}
+	row := iter.rows[iter.index]
+	iter.index++
+	return row, nil
+}
+
+func (iter *rowsIterator) Warnings() uint16 {
+	return iter.warnings
+}
+
+func (iter *rowsIterator) Close() error {
+	iter.index = len(iter.rows)
+	return nil
+}
+
+type closeHookIterator struct {
+	RowIterator
+	hook   func() error
+	closed bool
+}
+
+// WithCloseHook returns an iterator calling the hook once after the iterator is closed.
+func WithCloseHook(iter RowIterator, hook func() error) RowIterator {
+	return &closeHookIterator{RowIterator: iter, hook: hook}
+}
+
+func (iter *closeHookIterator) Close() error {
+	if iter.closed {
+		return nil
+	}
+	iter.closed = true
+	err := iter.RowIterator.Close()
+	if hookErr := iter.hook(); err == nil {
+		err = hookErr
+	}
+	return err
+}
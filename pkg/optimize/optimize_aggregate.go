@@ -0,0 +1,296 @@
+/*
+ * Copyright 2022 CECTC, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package optimize
+
+import (
+	"strings"
+
+	"github.com/huandu/go-clone"
+	"github.com/pkg/errors"
+
+	"github.com/cectc/dbpack/pkg/plan"
+	"github.com/cectc/dbpack/pkg/proto"
+	"github.com/cectc/dbpack/third_party/parser/ast"
+)
+
+// aggregateRewriter rewrites a select statement with aggregate functions into the
+// statement executed on every shard, and records how the partial results are merged.
+type aggregateRewriter struct {
+	origin  *ast.SelectStmt
+	stmt    *ast.SelectStmt
+	fields  []*ast.SelectField
+	columns []*plan.AggregateColumn
+	refs    map[string]int
+	// avgColumns are the AVG columns whose COUNT fields are appended after the selected fields
+	avgColumns []*plan.AggregateColumn
+	avgArgs    [][]ast.ExprNode
+}
+
+// needAggregate returns true if the rows returned by shards should be merged by groups.
+func needAggregate(stmt *ast.SelectStmt) bool {
+	if stmt.GroupBy != nil || stmt.Having != nil {
+		return true
+	}
+	for _, field := range stmt.Fields.Fields {
+		if field.Expr != nil && hasAggregateFunc(field.Expr) {
+			return true
+		}
+	}
+	return false
+}
+
+// isFanOut returns true if the query is executed on more than one physical table.
+func isFanOut(shardMap map[string][]string) bool {
+	if len(shardMap) > 1 {
+		return true
+	}
+	for _, tables := range shardMap {
+		return len(tables) > 1
+	}
+	return false
+}
+
+// optimizeAggregate e.g. select country_code, avg(population) from city group by country_code having count(*) > ?,
+// the shards execute `select country_code, sum(population), count(population), count(*) from city group by country_code`,
+// dbpack merges the partial results, then applies the HAVING, ORDER BY and LIMIT clauses.
+func (o Optimizer) optimizeAggregate(stmt *ast.SelectStmt, args []interface{},
+	pk string, shardMap map[string][]string) (proto.Plan, error) {
+	if stmt.Distinct {
+		return nil, errors.New("cross shard aggregate does not support distinct")
+	}
+	rewriter := &aggregateRewriter{
+		origin: stmt,
+		stmt:   clone.Clone(stmt).(*ast.SelectStmt),
+		refs:   make(map[string]int),
+	}
+	for i, field := range stmt.Fields.Fields {
+		if err := rewriter.addField(i, field); err != nil {
+			return nil, err
+		}
+	}
+	fieldCount := len(rewriter.columns)
+	rewriter.appendAvgCounts()
+
+	var groupBy []int
+	if stmt.GroupBy != nil {
+		for _, item := range stmt.GroupBy.Items {
+			index, err := rewriter.resolve(item.Expr)
+			if err != nil {
+				return nil, err
+			}
+			groupBy = append(groupBy, index)
+		}
+	}
+	var having ast.ExprNode
+	if stmt.Having != nil {
+		having = stmt.Having.Expr
+		vi := &aggregateRefVisitor{}
+		having.Accept(vi)
+		for _, expr := range vi.exprs {
+			if _, err := rewriter.resolve(expr); err != nil {
+				return nil, err
+			}
+		}
+	}
+	var orderBy []*plan.OrderByColumn
+	if stmt.OrderBy != nil {
+		for _, item := range stmt.OrderBy.Items {
+			index, err := rewriter.resolve(item.Expr)
+			if err != nil {
+				return nil, err
+			}
+			orderBy = append(orderBy, &plan.OrderByColumn{Index: index, Desc: item.Desc})
+		}
+	}
+
+	shardStmt := rewriter.stmt
+	shardStmt.Fields.Fields = rewriter.fields
+	shardStmt.Having = nil
+	shardStmt.OrderBy = nil
+	shardStmt.Limit = nil
+	// the HAVING and LIMIT parameters are not sent to shards, so the parameters are replaced by values
+	node, _ := shardStmt.Accept(&paramValueVisitor{args: args})
+	shardStmt = node.(*ast.SelectStmt)
+
+	shardPlan, err := o.buildQueryPlan(shardStmt, nil, pk, shardMap)
+	if err != nil {
+		return nil, err
+	}
+	return &plan.AggregatePlan{
+		Plan:       shardPlan,
+		Columns:    rewriter.columns,
+		FieldCount: fieldCount,
+		GroupBy:    groupBy,
+		Having:     having,
+		ColumnRefs: rewriter.refs,
+		OrderBy:    orderBy,
+		Limit:      stmt.Limit,
+		Args:       args,
+	}, nil
+}
+
+func (r *aggregateRewriter) addField(index int, field *ast.SelectField) error {
+	if field.WildCard != nil {
+		return errors.New("cross shard aggregate does not support wildcard fields")
+	}
+	var column *plan.AggregateColumn
+	if agg, ok := field.Expr.(*ast.AggregateFuncExpr); ok {
+		var err error
+		if column, err = r.addAggregate(agg, r.stmt.Fields.Fields[index]); err != nil {
+			return err
+		}
+		// hidden fields must be after the selected fields
+		if column.Func == ast.AggFuncAvg {
+			r.avgColumns = append(r.avgColumns, column)
+			r.avgArgs = append(r.avgArgs, agg.Args)
+		}
+		if column.Func == ast.AggFuncAvg && field.AsName.String() == "" {
+			column.Name = fieldName(field)
+		}
+	} else {
+		if hasAggregateFunc(field.Expr) {
+			return errors.Errorf("cross shard aggregate does not support expression %s", fieldName(field))
+		}
+		column = &plan.AggregateColumn{}
+		r.fields = append(r.fields, r.stmt.Fields.Fields[index])
+		r.columns = append(r.columns, column)
+	}
+	r.refs[plan.ExprKey(field.Expr)] = index
+	if field.AsName.String() != "" {
+		r.refs[strings.ToLower(field.AsName.String())] = index
+	}
+	return nil
+}
+
+// addAggregate appends the aggregate function to the shard select fields, AVG is
+// rewritten into SUM, the COUNT field of AVG is appended by appendAvgCount.
+func (r *aggregateRewriter) addAggregate(agg *ast.AggregateFuncExpr, field *ast.SelectField) (*plan.AggregateColumn, error) {
+	if agg.Distinct {
+		return nil, errors.Errorf("cross shard aggregate does not support %s(distinct)", agg.F)
+	}
+	funcName := strings.ToLower(agg.F)
+	column := &plan.AggregateColumn{Func: funcName}
+	switch funcName {
+	case ast.AggFuncCount, ast.AggFuncSum, ast.AggFuncMin, ast.AggFuncMax:
+		r.fields = append(r.fields, field)
+		r.columns = append(r.columns, column)
+	case ast.AggFuncAvg:
+		shardAgg := field.Expr.(*ast.AggregateFuncExpr)
+		field.Expr = &ast.AggregateFuncExpr{F: ast.AggFuncSum, Args: shardAgg.Args}
+		r.fields = append(r.fields, field)
+		r.columns = append(r.columns, column)
+	default:
+		return nil, errors.Errorf("cross shard aggregate does not support function %s", agg.F)
+	}
+	return column, nil
+}
+
+// resolve returns the index of the expression in the shard select fields, the expression
+// is appended as a hidden field if it is not selected.
+func (r *aggregateRewriter) resolve(expr ast.ExprNode) (int, error) {
+	if pos, ok := expr.(*ast.PositionExpr); ok {
+		// GROUP BY 1, ORDER BY 1
+		if pos.P != nil {
+			return 0, errors.New("cross shard aggregate does not support parameterized position")
+		}
+		position := pos.N
+		if position < 1 || position > len(r.origin.Fields.Fields) {
+			return 0, errors.Errorf("unknown column '%d'", position)
+		}
+		return r.refs[plan.ExprKey(r.origin.Fields.Fields[position-1].Expr)], nil
+	}
+	key := plan.ExprKey(expr)
+	if index, ok := r.refs[key]; ok {
+		return index, nil
+	}
+	index := len(r.columns)
+	field := &ast.SelectField{Expr: clone.Clone(expr).(ast.ExprNode)}
+	if agg, ok := field.Expr.(*ast.AggregateFuncExpr); ok {
+		column, err := r.addAggregate(agg, field)
+		if err != nil {
+			return 0, err
+		}
+		if column.Func == ast.AggFuncAvg {
+			r.appendAvgCount(column, agg.Args)
+		}
+	} else {
+		if hasAggregateFunc(expr) {
+			return 0, errors.Errorf("cross shard aggregate does not support expression %s", key)
+		}
+		r.fields = append(r.fields, field)
+		r.columns = append(r.columns, &plan.AggregateColumn{})
+	}
+	r.refs[key] = index
+	return index, nil
+}
+
+func (r *aggregateRewriter) appendAvgCounts() {
+	for i, column := range r.avgColumns {
+		r.appendAvgCount(column, r.avgArgs[i])
+	}
+}
+
+func (r *aggregateRewriter) appendAvgCount(column *plan.AggregateColumn, args []ast.ExprNode) {
+	column.CountIndex = len(r.columns)
+	r.fields = append(r.fields, &ast.SelectField{
+		Expr: &ast.AggregateFuncExpr{F: ast.AggFuncCount, Args: clone.Clone(args).([]ast.ExprNode)},
+	})
+	r.columns = append(r.columns, &plan.AggregateColumn{Func: ast.AggFuncCount})
+}
+
+func fieldName(field *ast.SelectField) string {
+	if field.AsName.String() != "" {
+		return field.AsName.String()
+	}
+	if text := strings.TrimSpace(field.Text()); text != "" {
+		return text
+	}
+	return plan.ExprKey(field.Expr)
+}
+
+func hasAggregateFunc(expr ast.ExprNode) bool {
+	vi := &aggregateRefVisitor{}
+	expr.Accept(vi)
+	for _, e := range vi.exprs {
+		if _, ok := e.(*ast.AggregateFuncExpr); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// aggregateRefVisitor collects the aggregate functions and the columns out of aggregate functions.
+type aggregateRefVisitor struct {
+	exprs []ast.ExprNode
+}
+
+func (v *aggregateRefVisitor) Enter(n ast.Node) (node ast.Node, skipChildren bool) {
+	switch expr := n.(type) {
+	case *ast.AggregateFuncExpr:
+		v.exprs = append(v.exprs, expr)
+		return n, true
+	case *ast.ColumnNameExpr:
+		v.exprs = append(v.exprs, expr)
+		return n, true
+	}
+	return n, false
+}
+
+// Leave implement ast.Visitor
+func (v *aggregateRefVisitor) Leave(n ast.Node) (node ast.Node, ok bool) {
+	return n, true
+}
@@ -0,0 +1,147 @@
+/*
+ * Copyright 2022 CECTC, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package optimize
+
+import (
+	"context"
+	"testing"
+
+	"github.com/agiledragon/gomonkey/v2"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/cectc/dbpack/pkg/meta"
+	"github.com/cectc/dbpack/pkg/plan"
+	"github.com/cectc/dbpack/pkg/resource"
+	"github.com/cectc/dbpack/pkg/visitor"
+	"github.com/cectc/dbpack/third_party/parser"
+	"github.com/cectc/dbpack/third_party/parser/ast"
+)
+
+func TestOptimizeAggregate(t *testing.T) {
+	o := mockJoinOptimizer()
+	resource.SetDBManager("app1", &resource.DBManager{})
+	var cache *meta.MysqlTableMetaCache
+	patches := gomonkey.ApplyMethodFunc(cache, "GetTableMeta", mockJoinTableMeta)
+	defer patches.Reset()
+
+	testCases := []struct {
+		sql        string
+		args       []interface{}
+		shardSql   string
+		columns    []*plan.AggregateColumn
+		fieldCount int
+		groupBy    []int
+		orderBy    []*plan.OrderByColumn
+	}{
+		{
+			sql:      "select age, count(*), avg(score) as avg_score from student where id > ? group by age having max(score) > ? order by 3 desc",
+			args:     []interface{}{10, 60},
+			shardSql: "SELECT `age`,COUNT(1),SUM(`score`) AS `avg_score`,COUNT(`score`),MAX(`score`) FROM `student` WHERE `id`>10 GROUP BY `age`",
+			columns: []*plan.AggregateColumn{
+				{},
+				{Func: ast.AggFuncCount},
+				{Func: ast.AggFuncAvg, CountIndex: 3},
+				{Func: ast.AggFuncCount},
+				{Func: ast.AggFuncMax},
+			},
+			fieldCount: 3,
+			groupBy:    []int{0},
+			orderBy:    []*plan.OrderByColumn{{Index: 2, Desc: true}},
+		},
+		{
+			sql:      "select sum(score), min(age) from student order by class_id",
+			shardSql: "SELECT SUM(`score`),MIN(`age`),`class_id` FROM `student`",
+			columns: []*plan.AggregateColumn{
+				{Func: ast.AggFuncSum},
+				{Func: ast.AggFuncMin},
+				{},
+			},
+			fieldCount: 2,
+			orderBy:    []*plan.OrderByColumn{{Index: 2}},
+		},
+		{
+			sql:      "select class_id, avg(age) from student group by class_id",
+			shardSql: "SELECT `class_id`,SUM(`age`),COUNT(`age`) FROM `student` GROUP BY `class_id`",
+			columns: []*plan.AggregateColumn{
+				{},
+				{Func: ast.AggFuncAvg, CountIndex: 2, Name: "avg(age)"},
+				{Func: ast.AggFuncCount},
+			},
+			fieldCount: 2,
+			groupBy:    []int{0},
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.sql, func(t *testing.T) {
+			p := parser.New()
+			stmt, err := p.ParseOneStmt(c.sql, "", "")
+			assert.Nil(t, err)
+			stmt.Accept(&visitor.ParamVisitor{})
+
+			pl, err := o.Optimize(context.Background(), stmt, c.args...)
+			assert.Nil(t, err)
+			aggregatePlan, ok := pl.(*plan.AggregatePlan)
+			if !assert.True(t, ok) {
+				return
+			}
+			assert.Equal(t, c.shardSql, restoreJoinSide(t, aggregatePlan.Plan))
+			assert.Equal(t, c.columns, aggregatePlan.Columns)
+			assert.Equal(t, c.fieldCount, aggregatePlan.FieldCount)
+			assert.Equal(t, c.groupBy, aggregatePlan.GroupBy)
+			assert.Equal(t, c.orderBy, aggregatePlan.OrderBy)
+		})
+	}
+}
+
+func TestOptimizeAggregateOnSingleShard(t *testing.T) {
+	o := mockJoinOptimizer()
+	resource.SetDBManager("app1", &resource.DBManager{})
+	var cache *meta.MysqlTableMetaCache
+	patches := gomonkey.ApplyMethodFunc(cache, "GetTableMeta", mockJoinTableMeta)
+	defer patches.Reset()
+
+	stmt, err := parser.New().ParseOneStmt("select count(*) from student where id = 1", "", "")
+	assert.Nil(t, err)
+	pl, err := o.Optimize(context.Background(), stmt)
+	assert.Nil(t, err)
+	_, ok := pl.(*plan.QueryOnSingleDBPlan)
+	assert.True(t, ok)
+}
+
+func TestOptimizeAggregateUnsupported(t *testing.T) {
+	o := mockJoinOptimizer()
+	resource.SetDBManager("app1", &resource.DBManager{})
+	var cache *meta.MysqlTableMetaCache
+	patches := gomonkey.ApplyMethodFunc(cache, "GetTableMeta", mockJoinTableMeta)
+	defer patches.Reset()
+
+	testCases := []string{
+		"select count(distinct age) from student",
+		"select sum(age) / count(age) from student",
+		"select *, count(*) from student group by age",
+		"select group_concat(age) from student",
+	}
+	for _, sql := range testCases {
+		t.Run(sql, func(t *testing.T) {
+			stmt, err := parser.New().ParseOneStmt(sql, "", "")
+			assert.Nil(t, err)
+			_, err = o.Optimize(context.Background(), stmt)
+			assert.NotNil(t, err)
+		})
+	}
+}
@@ -24,25 +24,33 @@ import (
 	"github.com/cectc/dbpack/pkg/cond"
 	"github.com/cectc/dbpack/pkg/plan"
 	"github.com/cectc/dbpack/pkg/proto"
-	"github.com/cectc/dbpack/pkg/topo"
 	"github.com/cectc/dbpack/third_party/parser/ast"
 )
 
 func (o Optimizer) optimizeDelete(ctx context.Context, stmt *ast.DeleteStmt, args []interface{}) (proto.Plan, error) {
-	var (
-		alg      cond.ShardingAlgorithm
-		topology *topo.Topology
-		exists   bool
-	)
 	tableName := stmt.TableRefs.TableRefs.Left.(*ast.TableSource).Source.(*ast.TableName).Name.String()
-	if alg, exists = o.algorithms[tableName]; !exists {
-		return nil, errors.New("sharding algorithm should not be nil")
+
+	route, err := o.resolveRoute(ctx, tableName, false)
+	if err != nil {
+		return nil, err
+	}
+	return o.routeDelete(ctx, stmt, args, route, nil)
+}
+
+func (o Optimizer) routeDelete(ctx context.Context, stmt *ast.DeleteStmt, args []interface{},
+	route *tableRoute, condition cond.Condition) (proto.Plan, error) {
+	if route.global {
+		return &plan.BroadcastPlan{
+			Stmt:      stmt,
+			Args:      args,
+			Executors: o.executors,
+		}, nil
 	}
-	topology = alg.Topology()
+	alg := route.alg
 
-	condition, err := cond.ParseCondition(stmt.Where, args...)
+	condition, err := whereCondition(stmt.Where, args, condition)
 	if err != nil {
-		return nil, errors.Wrap(err, "parse condition failed")
+		return nil, err
 	}
 	cd := condition.(cond.ConditionShard)
 	shards, err := cd.Shard(alg)
@@ -50,7 +58,7 @@ func (o Optimizer) optimizeDelete(ctx context.Context, stmt *ast.DeleteStmt, arg
 		return nil, errors.Wrap(err, "compute shards failed")
 	}
 
-	fullScan, shardMap := shards.ParseTopology(topology)
+	fullScan, shardMap := shards.ParseTopology(route.topology)
 	if fullScan && !alg.AllowFullScan() {
 		return nil, errors.New("full scan not allowed")
 	}
@@ -22,158 +22,238 @@ import (
 	"strings"
 
 	"github.com/antonmedv/expr"
-	"github.com/antonmedv/expr/vm"
 	"github.com/pkg/errors"
 
 	"github.com/cectc/dbpack/pkg/cond"
 	"github.com/cectc/dbpack/pkg/config"
 	"github.com/cectc/dbpack/pkg/constant"
-	"github.com/cectc/dbpack/pkg/dt/schema"
 	"github.com/cectc/dbpack/pkg/log"
-	"github.com/cectc/dbpack/pkg/meta"
 	"github.com/cectc/dbpack/pkg/misc"
 	"github.com/cectc/dbpack/pkg/plan"
 	"github.com/cectc/dbpack/pkg/proto"
-	"github.com/cectc/dbpack/pkg/resource"
-	"github.com/cectc/dbpack/pkg/topo"
 	"github.com/cectc/dbpack/third_party/parser/ast"
 	"github.com/cectc/dbpack/third_party/parser/format"
-	"github.com/cectc/dbpack/third_party/parser/model"
 	"github.com/cectc/dbpack/third_party/parser/opcode"
 	"github.com/cectc/dbpack/third_party/types"
 	driver "github.com/cectc/dbpack/third_party/types/parser_driver"
 )
 
+// insertShard is the rows of a multi-row insert routed to the same physical table
+type insertShard struct {
+	database string
+	table    string
+	rows     [][]ast.ExprNode
+	args     []interface{}
+}
+
+// optimizeInsert splits the rows of the insert statement by sharding key, the rows routed to the
+// same physical table are inserted by one statement. If the primary key is not specified, every
+// row gets its own id from the sequence generator of the sharding algorithm.
 func (o Optimizer) optimizeInsert(ctx context.Context, stmt *ast.InsertStmt, args []interface{}) (proto.Plan, error) {
-	var (
-		alg        cond.ShardingAlgorithm
-		topology   *topo.Topology
-		tableMeta  schema.TableMeta
-		shadowRule *config.ShadowRule
-		shadow     bool
-		columns    []string
-		exists     bool
-		err        error
-	)
 	tableName := stmt.Table.TableRefs.Left.(*ast.TableSource).Source.(*ast.TableName).Name.String()
 
-	if alg, exists = o.algorithms[tableName]; !exists {
-		return nil, errors.New("sharding algorithm should not be nil")
+	route, err := o.resolveRoute(ctx, tableName, true)
+	if err != nil {
+		return nil, err
+	}
+	return o.routeInsert(ctx, stmt, args, route)
+}
+
+func (o Optimizer) routeInsert(ctx context.Context, stmt *ast.InsertStmt, args []interface{},
+	route *tableRoute) (proto.Plan, error) {
+	var (
+		shadowRule   *config.ShadowRule
+		shadowHint   bool
+		columns      []string
+		lastInsertID uint64
+		exists       bool
+	)
+	if route.global {
+		return &plan.BroadcastPlan{
+			Stmt:      stmt,
+			Args:      args,
+			Executors: o.executors,
+		}, nil
 	}
-	topology = alg.Topology()
+	alg, tableName := route.alg, route.tableName
 
 	if shadowRule, exists = o.shadowRules[tableName]; exists {
-		if misc.HasShadowHint(stmt.TableHints) {
-			shadow = true
-		}
-		if !shadow {
-			for i, column := range stmt.Columns {
-				if strings.EqualFold(column.Name.String(), shadowRule.Column) && shadowRule.Expr != "" {
-					var (
-						out     interface{}
-						program *vm.Program
-					)
-
-					shadowExpr := fmt.Sprintf(shadowRule.Expr, shadowRule.Column)
-					columnValue := getColumnValue(ctx, stmt, i, args)
-					env := map[string]interface{}{
-						shadowRule.Column: columnValue,
-					}
-					program, err = expr.Compile(shadowExpr, expr.Env(env), expr.AsBool())
-					if err != nil {
-						return nil, errors.Wrapf(err, "expr %s should return bool", shadowExpr)
-					}
-					out, err = expr.Run(program, env)
-					if err != nil {
-						return nil, err
-					}
-					shadow = out.(bool)
-				}
-			}
-		}
+		shadowHint = misc.HasShadowHint(stmt.TableHints)
 	}
 
 	for _, column := range stmt.Columns {
 		columns = append(columns, column.Name.String())
 	}
 
-	for db, tables := range topology.DBs {
-		sqlDB := resource.GetDBManager(o.appid).GetDB(db)
-		tableMeta, err = meta.GetTableMetaCache().GetTableMeta(ctx, sqlDB, tables[0])
-		if err != nil {
-			continue
-		} else {
-			break
+	// the statement may be a cached prepared statement, so the generated primary keys
+	// are appended to copies of the rows instead of the statement.
+	rows := stmt.Lists
+	pk := route.tableMeta.GetPKName()
+	if findColumnIndex(stmt, pk) == -1 {
+		columns = append(columns, pk)
+		rows = make([][]ast.ExprNode, 0, len(stmt.Lists))
+		for i, row := range stmt.Lists {
+			id, err := alg.NextID()
+			if err != nil {
+				return nil, fmt.Errorf("failed to automatically generate a primary key: %w", err)
+			}
+			if i == 0 {
+				lastInsertID = uint64(id)
+			}
+			// generated ids are written as literals, so that the parameters of the rows keep their orders
+			generated := make([]ast.ExprNode, 0, len(row)+1)
+			generated = append(generated, row...)
+			generated = append(generated, &driver.ValueExpr{
+				Datum: types.NewDatum(id),
+			})
+			rows = append(rows, generated)
 		}
 	}
 
-	pk := tableMeta.GetPKName()
-	index := findColumnIndex(stmt, pk)
-	var pkValue interface{}
+	// a table may be sharded by several columns, e.g. databases by tenant_id and tables by user_id
+	var shardingIndexes []int
+	for i, column := range columns {
+		if alg.HasShardingKey(column) {
+			shardingIndexes = append(shardingIndexes, i)
+		}
+	}
+	if len(shardingIndexes) == 0 {
+		return nil, errors.Errorf("sharding key of table %s must be specified", tableName)
+	}
 
-	if index == -1 {
-		pkValue, err = alg.NextID()
+	var shards []*insertShard
+	for i, row := range rows {
+		var indexes cond.TableIndexSliceCondition
+		for j, shardingIndex := range shardingIndexes {
+			cd := &cond.KeyCondition{
+				Key:   columns[shardingIndex],
+				Op:    opcode.EQ,
+				Value: getExprValue(ctx, row[shardingIndex], args),
+			}
+			shardIndexes, err := cd.Shard(alg)
+			if err != nil {
+				return nil, errors.Wrap(err, "compute shards failed")
+			}
+			if j == 0 {
+				indexes = shardIndexes
+			} else {
+				indexes = indexes.And(shardIndexes).(cond.TableIndexSliceCondition)
+			}
+		}
+		_, shardMap := indexes.ParseTopology(route.topology)
+		database, table, err := singleShard(shardMap)
 		if err != nil {
-			return nil, fmt.Errorf("failed to automatically generate a primary key: %w", err)
+			return nil, errors.Wrapf(err, "row %d", i+1)
 		}
-		columns = append(columns, pk)
-		stmt.Columns = append(stmt.Columns, &ast.ColumnName{
-			Name: model.CIStr{
-				O: pk,
-			},
-		})
-		commandType := proto.CommandType(ctx)
-		switch commandType {
-		case constant.ComQuery:
-			stmt.Lists[0] = append(stmt.Lists[0], &driver.ValueExpr{
-				Datum: types.NewDatum(pkValue),
-			})
-		case constant.ComStmtExecute:
-			args = append(args, pkValue)
-		default:
-			log.Panicf("should never happen!")
+
+		if shadowRule != nil {
+			shadow, err := isShadowRow(ctx, shadowRule, shadowHint, columns, row, args)
+			if err != nil {
+				return nil, err
+			}
+			if shadow {
+				table = fmt.Sprintf("%s%s", shadowRule.ShadowTablePrefix, table)
+			}
 		}
-	} else {
-		pkValue = getColumnValue(ctx, stmt, index, args)
-	}
 
-	cd := &cond.KeyCondition{
-		Key:   pk,
-		Op:    opcode.EQ,
-		Value: pkValue,
+		var shard *insertShard
+		for _, s := range shards {
+			if s.database == database && s.table == table {
+				shard = s
+				break
+			}
+		}
+		if shard == nil {
+			shard = &insertShard{database: database, table: table}
+			shards = append(shards, shard)
+		}
+		shard.rows = append(shard.rows, row)
+		if proto.CommandType(ctx) == constant.ComStmtExecute {
+			shard.args = append(shard.args, rowArgs(row, args)...)
+		}
 	}
 
-	shards, err := cd.Shard(alg)
-	if err != nil {
-		return nil, errors.Wrap(err, "compute shards failed")
+	plans := make([]*plan.InsertPlan, 0, len(shards))
+	for i, shard := range shards {
+		executor, exists := o.dbGroupExecutors[shard.database]
+		if !exists {
+			return nil, errors.Errorf("db group %s should not be nil", shard.database)
+		}
+		shardStmt := *stmt
+		shardStmt.Lists = shard.rows
+		insertPlan := &plan.InsertPlan{
+			Database: shard.database,
+			Table:    shard.table,
+			Columns:  columns,
+			Stmt:     &shardStmt,
+			Args:     shard.args,
+			Executor: executor,
+		}
+		if i == 0 {
+			insertPlan.LastInsertID = lastInsertID
+		}
+		plans = append(plans, insertPlan)
 	}
-	fullScan, shardMap := shards.ParseTopology(topology)
-	if fullScan && !alg.AllowFullScan() {
-		return nil, errors.New("full scan not allowed")
+	if len(plans) == 1 {
+		return plans[0], nil
 	}
+	return &plan.MultiInsertPlan{Plans: plans}, nil
+}
 
-	if len(shardMap) == 1 {
-		for k, v := range shardMap {
-			executor, exists := o.dbGroupExecutors[k]
-			if !exists {
-				return nil, errors.Errorf("db group %s should not be nil", k)
-			}
+// singleShard returns the physical table of a row
+func singleShard(shardMap map[string][]string) (string, string, error) {
+	if len(shardMap) != 1 {
+		return "", "", errors.New("the row should be routed to exactly one table")
+	}
+	for db, tables := range shardMap {
+		if len(tables) != 1 {
+			return "", "", errors.New("the row should be routed to exactly one table")
+		}
+		return db, tables[0], nil
+	}
+	return "", "", errors.New("should never happen!")
+}
 
-			tbl := v[0]
-			if shadow {
-				tbl = fmt.Sprintf("%s%s", shadowRule.ShadowTablePrefix, tbl)
-			}
-			return &plan.InsertPlan{
-				Database: k,
-				Table:    tbl,
-				Columns:  columns,
-				Stmt:     stmt,
-				Args:     args,
-				Executor: executor,
-			}, nil
+func isShadowRow(ctx context.Context, shadowRule *config.ShadowRule, shadowHint bool,
+	columns []string, row []ast.ExprNode, args []interface{}) (bool, error) {
+	if shadowHint {
+		return true, nil
+	}
+	if shadowRule.Expr == "" {
+		return false, nil
+	}
+	for i, column := range columns {
+		if !strings.EqualFold(column, shadowRule.Column) {
+			continue
+		}
+		shadowExpr := fmt.Sprintf(shadowRule.Expr, shadowRule.Column)
+		env := map[string]interface{}{
+			shadowRule.Column: getExprValue(ctx, row[i], args),
 		}
+		program, err := expr.Compile(shadowExpr, expr.Env(env), expr.AsBool())
+		if err != nil {
+			return false, errors.Wrapf(err, "expr %s should return bool", shadowExpr)
+		}
+		out, err := expr.Run(program, env)
+		if err != nil {
+			return false, err
+		}
+		return out.(bool), nil
 	}
-	return nil, errors.New("should never happen!")
+	return false, nil
+}
+
+// rowArgs returns the arguments of the parameters in the row
+func rowArgs(row []ast.ExprNode, args []interface{}) []interface{} {
+	vi := &paramMarkerVisitor{}
+	for _, expr := range row {
+		expr.Accept(vi)
+	}
+	result := make([]interface{}, 0, len(vi.markers))
+	for _, marker := range vi.markers {
+		result = append(result, args[marker.Order])
+	}
+	return result
 }
 
 func findColumnIndex(stmt *ast.InsertStmt, columnName string) int {
@@ -185,21 +265,21 @@ func findColumnIndex(stmt *ast.InsertStmt, columnName string) int {
 	return -1
 }
 
-func getColumnValue(ctx context.Context, stmt *ast.InsertStmt, index int, args []interface{}) interface{} {
+// getExprValue returns the value of an expression in the VALUES list
+func getExprValue(ctx context.Context, exprNode ast.ExprNode, args []interface{}) interface{} {
 	var value interface{}
-	commandType := proto.CommandType(ctx)
-	switch commandType {
-	case constant.ComQuery:
+	switch node := exprNode.(type) {
+	case *driver.ValueExpr:
+		value = node.GetValue()
+	case *driver.ParamMarkerExpr:
+		value = args[node.Order]
+	default:
 		var sb strings.Builder
 		ctx := format.NewRestoreCtx(constant.DBPackRestoreFormat, &sb)
-		if err := stmt.Lists[0][index].Restore(ctx); err != nil {
+		if err := exprNode.Restore(ctx); err != nil {
 			log.Panic(err)
 		}
 		value = sb.String()
-	case constant.ComStmtExecute:
-		value = args[index]
-	default:
-		log.Panicf("should never happen!")
 	}
 
 	switch val := value.(type) {
@@ -211,3 +291,21 @@ func getColumnValue(ctx context.Context, stmt *ast.InsertStmt, index int, args [
 		return val
 	}
 }
+
+// paramMarkerVisitor collects the parameter markers in order
+type paramMarkerVisitor struct {
+	markers []*driver.ParamMarkerExpr
+}
+
+func (v *paramMarkerVisitor) Enter(n ast.Node) (node ast.Node, skipChildren bool) {
+	if marker, ok := n.(*driver.ParamMarkerExpr); ok {
+		v.markers = append(v.markers, marker)
+		return n, true
+	}
+	return n, false
+}
+
+// Leave implement ast.Visitor
+func (v *paramMarkerVisitor) Leave(n ast.Node) (node ast.Node, ok bool) {
+	return n, true
+}
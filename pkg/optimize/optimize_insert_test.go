@@ -0,0 +1,143 @@
+/*
+ * Copyright 2022 CECTC, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package optimize
+
+import (
+	"context"
+	"testing"
+
+	"github.com/agiledragon/gomonkey/v2"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/cectc/dbpack/pkg/constant"
+	"github.com/cectc/dbpack/pkg/meta"
+	"github.com/cectc/dbpack/pkg/plan"
+	"github.com/cectc/dbpack/pkg/proto"
+	"github.com/cectc/dbpack/pkg/resource"
+	"github.com/cectc/dbpack/pkg/visitor"
+	"github.com/cectc/dbpack/third_party/parser"
+	"github.com/cectc/dbpack/third_party/parser/ast"
+	driver "github.com/cectc/dbpack/third_party/types/parser_driver"
+)
+
+func TestOptimizeMultiRowInsert(t *testing.T) {
+	o := mockJoinOptimizer()
+	resource.SetDBManager("app1", &resource.DBManager{})
+	var cache *meta.MysqlTableMetaCache
+	patches := gomonkey.ApplyMethodFunc(cache, "GetTableMeta", mockJoinTableMeta)
+	defer patches.Reset()
+
+	t.Run("text protocol", func(t *testing.T) {
+		stmt, err := parser.New().ParseOneStmt("insert into student(id, name) values (1, 'scott'), (15, 'lily'), (101, 'jack')", "", "")
+		assert.Nil(t, err)
+		ctx := proto.WithCommandType(context.Background(), constant.ComQuery)
+		pl, err := o.Optimize(ctx, stmt)
+		assert.Nil(t, err)
+		multiPlan, ok := pl.(*plan.MultiInsertPlan)
+		if !assert.True(t, ok) {
+			return
+		}
+		assert.Equal(t, 2, len(multiPlan.Plans))
+		assert.Equal(t, "school_0", multiPlan.Plans[0].Database)
+		assert.Equal(t, "student_1", multiPlan.Plans[0].Table)
+		assert.Equal(t, 2, len(multiPlan.Plans[0].Stmt.Lists))
+		assert.Equal(t, "school_1", multiPlan.Plans[1].Database)
+		assert.Equal(t, "student_15", multiPlan.Plans[1].Table)
+		assert.Equal(t, 1, len(multiPlan.Plans[1].Stmt.Lists))
+		assert.Equal(t, uint64(0), multiPlan.Plans[0].LastInsertID)
+	})
+
+	t.Run("binary protocol with generated ids", func(t *testing.T) {
+		stmt, err := parser.New().ParseOneStmt("insert into score(student_id, score) values (?, ?), (?, ?), (?, ?)", "", "")
+		assert.Nil(t, err)
+		stmt.Accept(&visitor.ParamVisitor{})
+		insertStmt := stmt.(*ast.InsertStmt)
+		ctx := proto.WithCommandType(context.Background(), constant.ComStmtExecute)
+		pl, err := o.Optimize(ctx, stmt, 1, 90, 15, 80, 2, 70)
+		assert.Nil(t, err)
+		multiPlan, ok := pl.(*plan.MultiInsertPlan)
+		if !assert.True(t, ok) {
+			return
+		}
+		// the prepared statement should not be modified
+		assert.Equal(t, 2, len(insertStmt.Columns))
+		assert.Equal(t, 2, len(insertStmt.Lists[0]))
+
+		expected := []struct {
+			database string
+			table    string
+			args     []interface{}
+		}{
+			{database: "school_0", table: "score_1", args: []interface{}{1, 90}},
+			{database: "school_1", table: "score_15", args: []interface{}{15, 80}},
+			{database: "school_0", table: "score_2", args: []interface{}{2, 70}},
+		}
+		assert.Equal(t, len(expected), len(multiPlan.Plans))
+		ids := make(map[int64]bool)
+		for i, p := range multiPlan.Plans {
+			assert.Equal(t, expected[i].database, p.Database)
+			assert.Equal(t, expected[i].table, p.Table)
+			assert.Equal(t, expected[i].args, p.Args)
+			assert.Equal(t, []string{"student_id", "score", "id"}, p.Columns)
+			id := p.Stmt.Lists[0][2].(*driver.ValueExpr).GetInt64()
+			assert.False(t, ids[id])
+			ids[id] = true
+			if i == 0 {
+				assert.Equal(t, uint64(id), p.LastInsertID)
+			} else {
+				assert.Equal(t, uint64(0), p.LastInsertID)
+			}
+		}
+	})
+
+	t.Run("without sharding key", func(t *testing.T) {
+		stmt, err := parser.New().ParseOneStmt("insert into score(score) values (90), (80)", "", "")
+		assert.Nil(t, err)
+		ctx := proto.WithCommandType(context.Background(), constant.ComQuery)
+		_, err = o.Optimize(ctx, stmt)
+		assert.NotNil(t, err)
+	})
+}
+
+func TestOptimizeInsertWithCompositeShardingKey(t *testing.T) {
+	o := mockJoinOptimizer()
+	resource.SetDBManager("app1", &resource.DBManager{})
+	var cache *meta.MysqlTableMetaCache
+	patches := gomonkey.ApplyMethodFunc(cache, "GetTableMeta", mockJoinTableMeta)
+	defer patches.Reset()
+
+	stmt, err := parser.New().ParseOneStmt("insert into orders(id, tenant_id, user_id) values (1, 1, 6), (2, 0, 6), (3, 1, 2)", "", "")
+	assert.Nil(t, err)
+	ctx := proto.WithCommandType(context.Background(), constant.ComQuery)
+	pl, err := o.Optimize(ctx, stmt)
+	assert.Nil(t, err)
+	multiPlan, ok := pl.(*plan.MultiInsertPlan)
+	if !assert.True(t, ok) {
+		return
+	}
+	assert.Equal(t, 2, len(multiPlan.Plans))
+	assert.Equal(t, "school_1", multiPlan.Plans[0].Database)
+	assert.Equal(t, "orders_6", multiPlan.Plans[0].Table)
+	assert.Equal(t, 2, len(multiPlan.Plans[0].Stmt.Lists))
+	assert.Equal(t, "school_0", multiPlan.Plans[1].Database)
+	assert.Equal(t, "orders_2", multiPlan.Plans[1].Table)
+
+	stmt, err = parser.New().ParseOneStmt("insert into orders(id, tenant_id) values (1, 1)", "", "")
+	assert.Nil(t, err)
+	_, err = o.Optimize(ctx, stmt)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,391 @@
+/*
+ * Copyright 2022 CECTC, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package optimize
+
+import (
+	"context"
+	"strings"
+
+	"github.com/huandu/go-clone"
+	"github.com/pkg/errors"
+
+	"github.com/cectc/dbpack/pkg/cond"
+	"github.com/cectc/dbpack/pkg/constant"
+	"github.com/cectc/dbpack/pkg/plan"
+	"github.com/cectc/dbpack/pkg/proto"
+	"github.com/cectc/dbpack/third_party/parser/ast"
+	"github.com/cectc/dbpack/third_party/parser/format"
+	"github.com/cectc/dbpack/third_party/parser/model"
+	"github.com/cectc/dbpack/third_party/parser/opcode"
+	driver "github.com/cectc/dbpack/third_party/types/parser_driver"
+)
+
+const (
+	sideNone = iota
+	sideLeft
+	sideRight
+	sideBoth
+)
+
+type joinSide struct {
+	// name is the alias or table name which qualifies the columns of the table
+	name      string
+	tableName string
+	filters   []ast.ExprNode
+}
+
+// isCrossShardJoin returns true when the two tables of the join can not be joined
+// inside a single physical database, that is the right table is a sharded table and
+// the left table is a global table, or the two tables are not sharded in the same way,
+// or they are not joined on their sharding keys.
+func (o Optimizer) isCrossShardJoin(join *ast.Join) bool {
+	if join == nil || join.Right == nil {
+		return false
+	}
+	left, leftOk := joinTableSource(join.Left)
+	right, rightOk := joinTableSource(join.Right)
+	if !leftOk || !rightOk {
+		return false
+	}
+	leftTable := left.Source.(*ast.TableName).Name.String()
+	rightTable := right.Source.(*ast.TableName).Name.String()
+	if o.globalTables[strings.ToLower(rightTable)] {
+		return false
+	}
+	rightAlg, exists := o.algorithms[rightTable]
+	if !exists {
+		return false
+	}
+	if o.globalTables[strings.ToLower(leftTable)] {
+		return true
+	}
+	leftAlg, exists := o.algorithms[leftTable]
+	if !exists {
+		return false
+	}
+	if !leftAlg.Equal(rightAlg) {
+		return true
+	}
+
+	leftName, rightName := tableSourceName(left), tableSourceName(right)
+	var pairs [][2]string
+	for _, column := range join.Using {
+		pairs = append(pairs, [2]string{column.Name.String(), column.Name.String()})
+	}
+	if join.On != nil {
+		for _, expr := range splitConjunction(join.On.Expr) {
+			leftColumn, rightColumn, ok := equalJoinColumns(expr, leftName, rightName)
+			if ok {
+				pairs = append(pairs, [2]string{leftColumn, rightColumn})
+			}
+		}
+	}
+	return !joinedOnShardingKeys(leftAlg, rightAlg, pairs)
+}
+
+// joinedOnShardingKeys returns true if the equal join columns contain the sharding keys of both tables,
+// the tables sharded by database and table should be joined on the sharding keys of both dimensions.
+func joinedOnShardingKeys(leftAlg, rightAlg cond.ShardingAlgorithm, pairs [][2]string) bool {
+	leftComposite, leftOk := leftAlg.(*cond.CompositeSharding)
+	rightComposite, rightOk := rightAlg.(*cond.CompositeSharding)
+	if leftOk && rightOk {
+		return joinedOnShardingKeys(leftComposite.DBAlgorithm(), rightComposite.DBAlgorithm(), pairs) &&
+			joinedOnShardingKeys(leftComposite.TableAlgorithm(), rightComposite.TableAlgorithm(), pairs)
+	}
+	for _, pair := range pairs {
+		if leftAlg.HasShardingKey(pair[0]) && rightAlg.HasShardingKey(pair[1]) {
+			return true
+		}
+	}
+	return false
+}
+
+// optimizeJoin splits the join into two single table queries, the conditions which only
+// reference one table are pushed down to the query of that table, the rows are joined by plan.JoinPlan.
+func (o Optimizer) optimizeJoin(ctx context.Context, stmt *ast.SelectStmt, args []interface{}) (proto.Plan, error) {
+	if stmt.Distinct || stmt.GroupBy != nil || stmt.Having != nil {
+		return nil, errors.New("cross shard join does not support distinct, group by or having")
+	}
+	for _, field := range stmt.Fields.Fields {
+		if field.Expr == nil {
+			continue
+		}
+		if _, ok := field.Expr.(*ast.ColumnNameExpr); !ok {
+			return nil, errors.New("cross shard join only support selecting columns")
+		}
+	}
+
+	join := stmt.From.TableRefs
+	leftSource, _ := joinTableSource(join.Left)
+	rightSource, _ := joinTableSource(join.Right)
+	left := &joinSide{
+		name:      tableSourceName(leftSource),
+		tableName: leftSource.Source.(*ast.TableName).Name.String(),
+	}
+	right := &joinSide{
+		name:      tableSourceName(rightSource),
+		tableName: rightSource.Source.(*ast.TableName).Name.String(),
+	}
+	if strings.EqualFold(left.name, right.name) {
+		return nil, errors.Errorf("not unique table/alias: '%s'", left.name)
+	}
+
+	var leftKeys, rightKeys []string
+	for _, column := range join.Using {
+		leftKeys = append(leftKeys, column.Name.String())
+		rightKeys = append(rightKeys, column.Name.String())
+	}
+
+	if join.On != nil {
+		for _, expr := range splitConjunction(join.On.Expr) {
+			if leftColumn, rightColumn, ok := equalJoinColumns(expr, left.name, right.name); ok {
+				leftKeys = append(leftKeys, leftColumn)
+				rightKeys = append(rightKeys, rightColumn)
+				continue
+			}
+			side, err := exprSide(expr, left.name, right.name)
+			if err != nil {
+				return nil, err
+			}
+			switch {
+			case side == sideLeft && join.Tp != ast.LeftJoin:
+				left.filters = append(left.filters, expr)
+			case side == sideRight && join.Tp != ast.RightJoin:
+				right.filters = append(right.filters, expr)
+			default:
+				return nil, errors.Errorf("cross shard join does not support on condition: %s", restoreExpr(expr))
+			}
+		}
+	}
+
+	if stmt.Where != nil {
+		for _, expr := range splitConjunction(stmt.Where) {
+			side, err := exprSide(expr, left.name, right.name)
+			if err != nil {
+				return nil, err
+			}
+			switch {
+			case side == sideNone && join.Tp == ast.RightJoin:
+				right.filters = append(right.filters, expr)
+			case side == sideNone:
+				left.filters = append(left.filters, expr)
+			case side == sideLeft && join.Tp != ast.RightJoin:
+				left.filters = append(left.filters, expr)
+			case side == sideRight && join.Tp != ast.LeftJoin:
+				right.filters = append(right.filters, expr)
+			default:
+				return nil, errors.Errorf("cross shard join does not support where condition: %s", restoreExpr(expr))
+			}
+		}
+	}
+
+	leftPlan, err := o.optimizeJoinSide(ctx, stmt, left, args)
+	if err != nil {
+		return nil, err
+	}
+	rightPlan, err := o.optimizeJoinSide(ctx, stmt, right, args)
+	if err != nil {
+		return nil, err
+	}
+	return &plan.JoinPlan{
+		Stmt:      stmt,
+		JoinType:  join.Tp,
+		Left:      &plan.JoinTable{Name: left.name, Plan: leftPlan},
+		Right:     &plan.JoinTable{Name: right.name, Plan: rightPlan},
+		LeftKeys:  leftKeys,
+		RightKeys: rightKeys,
+		Args:      args,
+	}, nil
+}
+
+func (o Optimizer) optimizeJoinSide(ctx context.Context, join *ast.SelectStmt, side *joinSide, args []interface{}) (proto.Plan, error) {
+	var where ast.ExprNode
+	for _, filter := range side.filters {
+		// statements may be cached and executed again, so the origin conditions should not be changed
+		node, _ := clone.Clone(filter).(ast.ExprNode).Accept(&paramValueVisitor{args: args})
+		node, _ = node.Accept(&columnQualifierVisitor{})
+		expr := node.(ast.ExprNode)
+		if where == nil {
+			where = expr
+			continue
+		}
+		where = &ast.BinaryOperationExpr{Op: opcode.LogicAnd, L: where, R: expr}
+	}
+	// the options of the join apply to the side, except SQL_CALC_FOUND_ROWS which counts the joined rows
+	opts := &ast.SelectStmtOpts{SQLCache: true}
+	if join.SelectStmtOpts != nil {
+		*opts = *join.SelectStmtOpts
+		opts.CalcFoundRows = false
+	}
+	stmt := &ast.SelectStmt{
+		SelectStmtOpts: opts,
+		Fields: &ast.FieldList{
+			Fields: []*ast.SelectField{{WildCard: &ast.WildCardField{}}},
+		},
+		From: &ast.TableRefsClause{
+			TableRefs: &ast.Join{
+				Left: &ast.TableSource{
+					Source: &ast.TableName{Name: model.NewCIStr(side.tableName)},
+				},
+			},
+		},
+		Where: where,
+		Kind:  ast.SelectStmtKindSelect,
+	}
+	return o.optimizeSelect(ctx, stmt, nil)
+}
+
+func joinTableSource(node ast.ResultSetNode) (*ast.TableSource, bool) {
+	source, ok := node.(*ast.TableSource)
+	if !ok {
+		return nil, false
+	}
+	if _, ok = source.Source.(*ast.TableName); !ok {
+		return nil, false
+	}
+	return source, true
+}
+
+func tableSourceName(source *ast.TableSource) string {
+	if source.AsName.String() != "" {
+		return source.AsName.String()
+	}
+	return source.Source.(*ast.TableName).Name.String()
+}
+
+func splitConjunction(expr ast.ExprNode) []ast.ExprNode {
+	switch e := expr.(type) {
+	case *ast.BinaryOperationExpr:
+		if e.Op == opcode.LogicAnd {
+			return append(splitConjunction(e.L), splitConjunction(e.R)...)
+		}
+	case *ast.ParenthesesExpr:
+		if inner, ok := e.Expr.(*ast.BinaryOperationExpr); ok && inner.Op == opcode.LogicAnd {
+			return splitConjunction(inner)
+		}
+	}
+	return []ast.ExprNode{expr}
+}
+
+// equalJoinColumns returns the column names of the left table and the right table
+// if the expression is `left.column = right.column`.
+func equalJoinColumns(expr ast.ExprNode, leftName, rightName string) (string, string, bool) {
+	binary, ok := expr.(*ast.BinaryOperationExpr)
+	if !ok || binary.Op != opcode.EQ {
+		return "", "", false
+	}
+	l, ok := binary.L.(*ast.ColumnNameExpr)
+	if !ok {
+		return "", "", false
+	}
+	r, ok := binary.R.(*ast.ColumnNameExpr)
+	if !ok {
+		return "", "", false
+	}
+	switch {
+	case strings.EqualFold(l.Name.Table.String(), leftName) && strings.EqualFold(r.Name.Table.String(), rightName):
+		return l.Name.Name.String(), r.Name.Name.String(), true
+	case strings.EqualFold(l.Name.Table.String(), rightName) && strings.EqualFold(r.Name.Table.String(), leftName):
+		return r.Name.Name.String(), l.Name.Name.String(), true
+	}
+	return "", "", false
+}
+
+// exprSide returns which tables the columns in the expression belong to.
+func exprSide(expr ast.ExprNode, leftName, rightName string) (int, error) {
+	vi := &joinColumnVisitor{leftName: leftName, rightName: rightName}
+	expr.Accept(vi)
+	return vi.side, vi.err
+}
+
+func restoreExpr(expr ast.ExprNode) string {
+	var sb strings.Builder
+	if err := expr.Restore(format.NewRestoreCtx(constant.DBPackRestoreFormat, &sb)); err != nil {
+		return ""
+	}
+	return sb.String()
+}
+
+type joinColumnVisitor struct {
+	leftName  string
+	rightName string
+	side      int
+	err       error
+}
+
+func (v *joinColumnVisitor) Enter(n ast.Node) (node ast.Node, skipChildren bool) {
+	if _, ok := n.(*ast.SubqueryExpr); ok {
+		v.err = errors.New("cross shard join does not support subquery")
+		return n, true
+	}
+	return n, false
+}
+
+// Leave implement ast.Visitor
+func (v *joinColumnVisitor) Leave(n ast.Node) (node ast.Node, ok bool) {
+	column, ok := n.(*ast.ColumnNameExpr)
+	if !ok || v.err != nil {
+		return n, true
+	}
+	table := column.Name.Table.String()
+	switch {
+	case table == "":
+		v.err = errors.Errorf("column '%s' should be qualified with table name in cross shard join", column.Name.Name.String())
+	case strings.EqualFold(table, v.leftName):
+		v.side |= sideLeft
+	case strings.EqualFold(table, v.rightName):
+		v.side |= sideRight
+	default:
+		v.err = errors.Errorf("unknown column '%s'", column.Name.String())
+	}
+	return n, true
+}
+
+// columnQualifierVisitor removes the table qualifiers of the columns, so that
+// the conditions can be used in a single table query.
+type columnQualifierVisitor struct{}
+
+func (v *columnQualifierVisitor) Enter(n ast.Node) (node ast.Node, skipChildren bool) {
+	return n, false
+}
+
+// Leave implement ast.Visitor
+func (v *columnQualifierVisitor) Leave(n ast.Node) (node ast.Node, ok bool) {
+	if column, ok := n.(*ast.ColumnNameExpr); ok {
+		column.Name.Schema = model.CIStr{}
+		column.Name.Table = model.CIStr{}
+	}
+	return n, true
+}
+
+// paramValueVisitor replaces the parameter markers with the values of args, it is used when
+// a statement is rewritten and the parameter markers are no longer in the origin order.
+type paramValueVisitor struct {
+	args []interface{}
+}
+
+func (v *paramValueVisitor) Enter(n ast.Node) (node ast.Node, skipChildren bool) {
+	return n, false
+}
+
+// Leave implement ast.Visitor
+func (v *paramValueVisitor) Leave(n ast.Node) (node ast.Node, ok bool) {
+	if param, ok := n.(*driver.ParamMarkerExpr); ok && param.Order < len(v.args) {
+		return ast.NewValueExpr(v.args[param.Order], "", ""), true
+	}
+	return n, true
+}
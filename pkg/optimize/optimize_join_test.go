@@ -0,0 +1,234 @@
+/*
+ * Copyright 2022 CECTC, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package optimize
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/agiledragon/gomonkey/v2"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/cectc/dbpack/pkg/cond"
+	"github.com/cectc/dbpack/pkg/constant"
+	"github.com/cectc/dbpack/pkg/dt/schema"
+	"github.com/cectc/dbpack/pkg/meta"
+	"github.com/cectc/dbpack/pkg/plan"
+	"github.com/cectc/dbpack/pkg/proto"
+	"github.com/cectc/dbpack/pkg/resource"
+	"github.com/cectc/dbpack/pkg/sequence"
+	"github.com/cectc/dbpack/pkg/topo"
+	"github.com/cectc/dbpack/pkg/visitor"
+	"github.com/cectc/dbpack/third_party/parser"
+	"github.com/cectc/dbpack/third_party/parser/ast"
+	"github.com/cectc/dbpack/third_party/parser/format"
+)
+
+func TestOptimizeCrossShardJoin(t *testing.T) {
+	o := mockJoinOptimizer()
+	resource.SetDBManager("app1", &resource.DBManager{})
+	var cache *meta.MysqlTableMetaCache
+	patches := gomonkey.ApplyMethodFunc(cache, "GetTableMeta", mockJoinTableMeta)
+	defer patches.Reset()
+
+	testCases := []struct {
+		sql       string
+		args      []interface{}
+		leftKeys  []string
+		rightKeys []string
+		leftSql   string
+		rightSql  string
+	}{
+		{
+			sql:       "select s.id, c.score from student s join score c on s.id = c.student_id where s.id = ? and c.score > ?",
+			args:      []interface{}{1, 60},
+			leftKeys:  []string{"id"},
+			rightKeys: []string{"student_id"},
+			leftSql:   "SELECT * FROM `student` WHERE `id`=1",
+			rightSql:  "SELECT * FROM `score` WHERE `score`>60",
+		},
+		{
+			sql:       "select * from student s left join score c on s.id = c.id and c.score > 60 where s.age > 18",
+			leftKeys:  []string{"id"},
+			rightKeys: []string{"id"},
+			leftSql:   "SELECT * FROM `student` WHERE `age`>18",
+			rightSql:  "SELECT * FROM `score` WHERE `score`>60",
+		},
+		{
+			sql:       "select * from student join score using (id)",
+			leftKeys:  []string{"id"},
+			rightKeys: []string{"id"},
+			leftSql:   "SELECT * FROM `student`",
+			rightSql:  "SELECT * FROM `score`",
+		},
+		{
+			// the options of the join are kept, except SQL_CALC_FOUND_ROWS which counts the joined rows
+			sql:       "select high_priority sql_no_cache sql_calc_found_rows * from student join score using (id)",
+			leftKeys:  []string{"id"},
+			rightKeys: []string{"id"},
+			leftSql:   "SELECT HIGH_PRIORITY SQL_NO_CACHE * FROM `student`",
+			rightSql:  "SELECT HIGH_PRIORITY SQL_NO_CACHE * FROM `score`",
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.sql, func(t *testing.T) {
+			p := parser.New()
+			stmt, err := p.ParseOneStmt(c.sql, "", "")
+			assert.Nil(t, err)
+			stmt.Accept(&visitor.ParamVisitor{})
+
+			pl, err := o.Optimize(context.Background(), stmt, c.args...)
+			assert.Nil(t, err)
+			joinPlan, ok := pl.(*plan.JoinPlan)
+			assert.True(t, ok)
+			assert.Equal(t, c.leftKeys, joinPlan.LeftKeys)
+			assert.Equal(t, c.rightKeys, joinPlan.RightKeys)
+			assert.Equal(t, c.leftSql, restoreJoinSide(t, joinPlan.Left.Plan))
+			assert.Equal(t, c.rightSql, restoreJoinSide(t, joinPlan.Right.Plan))
+		})
+	}
+}
+
+func TestOptimizeCrossShardJoinUnsupported(t *testing.T) {
+	o := mockJoinOptimizer()
+	resource.SetDBManager("app1", &resource.DBManager{})
+	var cache *meta.MysqlTableMetaCache
+	patches := gomonkey.ApplyMethodFunc(cache, "GetTableMeta", mockJoinTableMeta)
+	defer patches.Reset()
+
+	testCases := []string{
+		"select count(*) from student s join score c on s.id = c.student_id",
+		"select s.id from student s join score c on s.id = c.student_id group by s.id",
+		"select * from student s left join score c on s.id = c.student_id where c.score > 60",
+		"select * from student s join score c on s.id = c.student_id where s.age > c.score",
+		"select * from student s join score c on s.id = c.student_id where age > 18",
+	}
+	for _, sql := range testCases {
+		t.Run(sql, func(t *testing.T) {
+			p := parser.New()
+			stmt, err := p.ParseOneStmt(sql, "", "")
+			assert.Nil(t, err)
+			_, err = o.Optimize(context.Background(), stmt)
+			assert.NotNil(t, err)
+		})
+	}
+}
+
+func TestIsCrossShardJoin(t *testing.T) {
+	o := mockJoinOptimizer()
+	testCases := []struct {
+		sql       string
+		crossJoin bool
+	}{
+		{"select * from student", false},
+		{"select * from student s join class c on s.class_id = c.id", false},
+		{"select * from class c join student s on s.class_id = c.id", true},
+		{"select * from student s join score c on s.id = c.student_id", true},
+		{"select * from student s join teacher c on s.id = c.id", false},
+		{"select * from student s join teacher c on s.age = c.id", true},
+		{"select * from orders o join order_item i on o.tenant_id = i.tenant_id and o.user_id = i.user_id", false},
+		{"select * from orders o join order_item i using (user_id, tenant_id)", false},
+		{"select * from orders o join order_item i on o.tenant_id = i.tenant_id", true},
+		{"select * from orders o join order_item i on o.tenant_id = i.user_id and o.user_id = i.tenant_id", true},
+	}
+	for _, c := range testCases {
+		t.Run(c.sql, func(t *testing.T) {
+			p := parser.New()
+			stmt, err := p.ParseOneStmt(c.sql, "", "")
+			assert.Nil(t, err)
+			assert.Equal(t, c.crossJoin, o.isCrossShardJoin(stmt.(*ast.SelectStmt).From.TableRefs))
+		})
+	}
+}
+
+func restoreJoinSide(t *testing.T, pl proto.Plan) string {
+	var single *plan.QueryOnSingleDBPlan
+	switch p := pl.(type) {
+	case *plan.QueryOnSingleDBPlan:
+		single = p
+	case *plan.QueryOnMultiDBPlan:
+		single = p.Plans[0]
+	default:
+		t.Fatalf("unexpected plan type %T", pl)
+	}
+	var sb strings.Builder
+	assert.Nil(t, single.Stmt.Restore(format.NewRestoreCtx(constant.DBPackRestoreFormat, &sb)))
+	return sb.String()
+}
+
+func mockJoinOptimizer() *Optimizer {
+	generator, _ := sequence.NewWorker(123)
+	studentTopology := mockTopology()
+	scoreTopology, _ := topo.ParseTopology("school", "score", map[int]string{
+		0: "0-9",
+		1: "10-19",
+		2: "20-29",
+		3: "30-39",
+		4: "40-49",
+	})
+	teacherTopology, _ := topo.ParseTopology("school", "teacher", studentTopology.Config)
+	ordersTopology, _ := topo.ParseTopology("school", "orders", map[int]string{0: "0-3", 1: "4-7"})
+	orderItemTopology, _ := topo.ParseTopology("school", "order_item", ordersTopology.Config)
+	orders, _ := cond.NewCompositeSharding("NumberMod", "tenant_id", nil,
+		"NumberMod", "user_id", nil, true, ordersTopology, generator)
+	orderItem, _ := cond.NewCompositeSharding("NumberMod", "tenant_id", nil,
+		"NumberMod", "user_id", nil, true, orderItemTopology, generator)
+	return &Optimizer{
+		appid:            "app1",
+		globalTables:     map[string]bool{"class": true},
+		dbGroupExecutors: mockDBGroupExecutors(),
+		algorithms: map[string]cond.ShardingAlgorithm{
+			"student":    cond.NewNumberMod("id", true, studentTopology, generator),
+			"score":      cond.NewNumberMod("student_id", true, scoreTopology, generator),
+			"teacher":    cond.NewNumberMod("id", true, teacherTopology, generator),
+			"orders":     orders,
+			"order_item": orderItem,
+		},
+		topologies: map[string]*topo.Topology{
+			"student":    studentTopology,
+			"score":      scoreTopology,
+			"teacher":    teacherTopology,
+			"orders":     ordersTopology,
+			"order_item": orderItemTopology,
+		},
+	}
+}
+
+func mockJoinTableMeta(ctx context.Context, db proto.DB, tableName string) (schema.TableMeta, error) {
+	id := schema.ColumnMeta{
+		TableSchemeName: "school",
+		TableName:       tableName,
+		ColumnName:      "id",
+		DataTypeName:    "bigint",
+	}
+	return schema.TableMeta{
+		SchemaName: "school",
+		TableName:  tableName,
+		Columns:    []string{"id"},
+		AllColumns: map[string]schema.ColumnMeta{"id": id},
+		AllIndexes: map[string]schema.IndexMeta{
+			"id": {
+				Values:     []schema.ColumnMeta{id},
+				IndexName:  "PRIMARY",
+				ColumnName: "id",
+				IndexType:  schema.IndexTypePrimary,
+			},
+		},
+	}, nil
+}
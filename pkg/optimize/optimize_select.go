@@ -19,68 +19,62 @@ package optimize
 import (
 	"context"
 	"sort"
-	"strings"
 
 	"github.com/pkg/errors"
 
 	"github.com/cectc/dbpack/pkg/cond"
-	"github.com/cectc/dbpack/pkg/dt/schema"
-	"github.com/cectc/dbpack/pkg/meta"
 	"github.com/cectc/dbpack/pkg/plan"
 	"github.com/cectc/dbpack/pkg/proto"
-	"github.com/cectc/dbpack/pkg/resource"
-	"github.com/cectc/dbpack/pkg/topo"
 	"github.com/cectc/dbpack/third_party/parser/ast"
 )
 
 func (o Optimizer) optimizeSelect(ctx context.Context, stmt *ast.SelectStmt, args []interface{}) (proto.Plan, error) {
-	var (
-		alg       cond.ShardingAlgorithm
-		topology  *topo.Topology
-		tableMeta schema.TableMeta
-		exists    bool
-		err       error
-	)
+	if stmt.From != nil && o.isCrossShardJoin(stmt.From.TableRefs) {
+		return o.optimizeJoin(ctx, stmt, args)
+	}
 	tableName := stmt.From.TableRefs.Left.(*ast.TableSource).Source.(*ast.TableName).Name.String()
 
-	if o.globalTables[strings.ToLower(tableName)] {
-		return &plan.DirectQueryPlan{
-			Stmt:     stmt,
-			Args:     args,
-			Executor: o.executors[0],
-		}, nil
-	}
-	if alg, exists = o.algorithms[tableName]; !exists {
-		return nil, errors.New("sharding algorithm should not be nil")
+	route, err := o.resolveRoute(ctx, tableName, true)
+	if err != nil {
+		return nil, err
 	}
-	topology = alg.Topology()
-
-	for db, tables := range topology.DBs {
-		sqlDB := resource.GetDBManager(o.appid).GetDB(db)
-		tableMeta, err = meta.GetTableMetaCache().GetTableMeta(ctx, sqlDB, tables[0])
-		if err != nil {
-			continue
-		} else {
-			break
-		}
+	return o.routeSelect(ctx, stmt, args, route, nil)
+}
+
+func (o Optimizer) routeSelect(ctx context.Context, stmt *ast.SelectStmt, args []interface{},
+	route *tableRoute, condition cond.Condition) (proto.Plan, error) {
+	if route.global {
+		return &plan.GlobalQueryPlan{
+			Stmt:      stmt,
+			Args:      args,
+			Executors: o.executors,
+		}, nil
 	}
-	pk := tableMeta.GetPKName()
+	pk := route.tableMeta.GetPKName()
 
-	condition, err := cond.ParseCondition(stmt.Where, args...)
+	condition, err := whereCondition(stmt.Where, args, condition)
 	if err != nil {
-		return nil, errors.Wrap(err, "parse condition failed")
+		return nil, err
 	}
 	cd := condition.(cond.ConditionShard)
-	shards, err := cd.Shard(alg)
+	shards, err := cd.Shard(route.alg)
 	if err != nil {
 		return nil, errors.Wrap(err, "compute shards failed")
 	}
 
-	fullScan, shardMap := shards.ParseTopology(topology)
-	if fullScan && !alg.AllowFullScan() {
+	fullScan, shardMap := shards.ParseTopology(route.topology)
+	if fullScan && !route.alg.AllowFullScan() {
 		return nil, errors.New("full scan not allowed")
 	}
 
+	if needAggregate(stmt) && isFanOut(shardMap) {
+		return o.optimizeAggregate(stmt, args, pk, shardMap)
+	}
+	return o.buildQueryPlan(stmt, args, pk, shardMap)
+}
+
+func (o Optimizer) buildQueryPlan(stmt *ast.SelectStmt, args []interface{},
+	pk string, shardMap map[string][]string) (proto.Plan, error) {
 	if len(shardMap) == 1 {
 		for k, v := range shardMap {
 			executor, exists := o.dbGroupExecutors[k]
@@ -101,7 +95,7 @@ func (o Optimizer) optimizeSelect(ctx context.Context, stmt *ast.SelectStmt, arg
 		}
 	}
 
-	plans := make([]*plan.QueryOnSingleDBPlan, 0, len(shards))
+	plans := make([]*plan.QueryOnSingleDBPlan, 0, len(shardMap))
 
 	keys := make([]string, 0)
 	for k := range shardMap {
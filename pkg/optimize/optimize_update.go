@@ -22,27 +22,38 @@ import (
 	"github.com/pkg/errors"
 
 	"github.com/cectc/dbpack/pkg/cond"
+	"github.com/cectc/dbpack/pkg/config"
+	"github.com/cectc/dbpack/pkg/constant"
+	err2 "github.com/cectc/dbpack/pkg/errors"
 	"github.com/cectc/dbpack/pkg/plan"
 	"github.com/cectc/dbpack/pkg/proto"
-	"github.com/cectc/dbpack/pkg/topo"
 	"github.com/cectc/dbpack/third_party/parser/ast"
 )
 
 func (o Optimizer) optimizeUpdate(ctx context.Context, stmt *ast.UpdateStmt, args []interface{}) (proto.Plan, error) {
-	var (
-		alg      cond.ShardingAlgorithm
-		topology *topo.Topology
-		exists   bool
-	)
 	tableName := stmt.TableRefs.TableRefs.Left.(*ast.TableSource).Source.(*ast.TableName).Name.String()
-	if alg, exists = o.algorithms[tableName]; !exists {
-		return nil, errors.New("sharding algorithm should not be nil")
+
+	route, err := o.resolveRoute(ctx, tableName, false)
+	if err != nil {
+		return nil, err
+	}
+	return o.routeUpdate(ctx, stmt, args, route, nil)
+}
+
+func (o Optimizer) routeUpdate(ctx context.Context, stmt *ast.UpdateStmt, args []interface{},
+	route *tableRoute, condition cond.Condition) (proto.Plan, error) {
+	if route.global {
+		return &plan.BroadcastPlan{
+			Stmt:      stmt,
+			Args:      args,
+			Executors: o.executors,
+		}, nil
 	}
-	topology = alg.Topology()
+	alg := route.alg
 
-	condition, err := cond.ParseCondition(stmt.Where, args...)
+	condition, err := whereCondition(stmt.Where, args, condition)
 	if err != nil {
-		return nil, errors.Wrap(err, "parse condition failed")
+		return nil, err
 	}
 	cd := condition.(cond.ConditionShard)
 	shards, err := cd.Shard(alg)
@@ -50,11 +61,30 @@ func (o Optimizer) optimizeUpdate(ctx context.Context, stmt *ast.UpdateStmt, arg
 		return nil, errors.Wrap(err, "compute shards failed")
 	}
 
-	fullScan, shardMap := shards.ParseTopology(topology)
+	fullScan, shardMap := shards.ParseTopology(route.topology)
 	if fullScan && !alg.AllowFullScan() {
 		return nil, errors.New("full scan not allowed")
 	}
 
+	// the rows would stay in the old physical tables if the sharding key is updated in place
+	for _, assignment := range stmt.List {
+		column := assignment.Column.Name.String()
+		if !alg.HasShardingKey(column) {
+			continue
+		}
+		if o.shardingKeyUpdates[route.tableName] != config.MoveShardingKeyUpdate {
+			return nil, err2.NewSQLError(constant.ERNotSupportedYet, constant.SSNotSupportedYet,
+				"This version of dbpack doesn't yet support 'updating sharding key column %s of table %s'", column, route.tableName)
+		}
+		return &plan.ShardingKeyUpdatePlan{
+			Stmt:      stmt,
+			Args:      args,
+			Shards:    shardMap,
+			Algorithm: alg,
+			Executors: o.dbGroupExecutors,
+		}, nil
+	}
+
 	if len(shardMap) == 1 {
 		for k, v := range shardMap {
 			executor, exists := o.dbGroupExecutors[k]
@@ -39,6 +39,8 @@ type Optimizer struct {
 	algorithms map[string]cond.ShardingAlgorithm
 	// tableName -> topology
 	topologies map[string]*topo.Topology
+	// tableName -> how to handle the update of sharding key
+	shardingKeyUpdates map[string]config.ShardingKeyUpdate
 }
 
 func NewOptimizer(appid string,
@@ -47,19 +49,21 @@ func NewOptimizer(appid string,
 	executors []proto.DBGroupExecutor,
 	dbGroupExecutors map[string]proto.DBGroupExecutor,
 	algorithms map[string]cond.ShardingAlgorithm,
-	topologies map[string]*topo.Topology) proto.Optimizer {
+	topologies map[string]*topo.Topology,
+	shardingKeyUpdates map[string]config.ShardingKeyUpdate) proto.Optimizer {
 	shadowRuleMap := make(map[string]*config.ShadowRule)
 	for _, rule := range shadowRules {
 		shadowRuleMap[rule.TableName] = rule
 	}
 	return &Optimizer{
-		appid:            appid,
-		globalTables:     globalTables,
-		shadowRules:      shadowRuleMap,
-		executors:        executors,
-		dbGroupExecutors: dbGroupExecutors,
-		algorithms:       algorithms,
-		topologies:       topologies,
+		appid:              appid,
+		globalTables:       globalTables,
+		shadowRules:        shadowRuleMap,
+		executors:          executors,
+		dbGroupExecutors:   dbGroupExecutors,
+		algorithms:         algorithms,
+		topologies:         topologies,
+		shardingKeyUpdates: shardingKeyUpdates,
 	}
 }
 
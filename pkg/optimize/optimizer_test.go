@@ -24,8 +24,10 @@ import (
 	"github.com/stretchr/testify/assert"
 
 	"github.com/cectc/dbpack/pkg/cond"
+	"github.com/cectc/dbpack/pkg/config"
 	"github.com/cectc/dbpack/pkg/constant"
 	"github.com/cectc/dbpack/pkg/dt/schema"
+	err2 "github.com/cectc/dbpack/pkg/errors"
 	"github.com/cectc/dbpack/pkg/meta"
 	"github.com/cectc/dbpack/pkg/plan"
 	"github.com/cectc/dbpack/pkg/proto"
@@ -411,6 +413,67 @@ func TestOptimizeInsert(t *testing.T) {
 	assert.Equal(t, "student_18", insertPlan.Table)
 }
 
+func TestOptimizeShardingKeyUpdate(t *testing.T) {
+	o := mockOptimizer()
+
+	stmt, err := parser.New().ParseOneStmt("update student set id = ? where id = ?", "", "")
+	assert.Nil(t, err)
+	stmt.Accept(&visitor.ParamVisitor{})
+	_, err = o.Optimize(context.Background(), stmt, 15, 1)
+	sqlErr, ok := err.(*err2.SQLError)
+	assert.True(t, ok)
+	assert.Equal(t, constant.ERNotSupportedYet, sqlErr.Num)
+
+	o.shardingKeyUpdates = map[string]config.ShardingKeyUpdate{"student": config.MoveShardingKeyUpdate}
+	pl, err := o.Optimize(context.Background(), stmt, 15, 1)
+	assert.Nil(t, err)
+	movePlan, ok := pl.(*plan.ShardingKeyUpdatePlan)
+	assert.True(t, ok)
+	assert.Equal(t, map[string][]string{"school_0": {"student_1"}}, movePlan.Shards)
+
+	stmt, err = parser.New().ParseOneStmt("update student set name = ? where id = ?", "", "")
+	assert.Nil(t, err)
+	stmt.Accept(&visitor.ParamVisitor{})
+	pl, err = o.Optimize(context.Background(), stmt, "scott", 1)
+	assert.Nil(t, err)
+	_, ok = pl.(*plan.UpdatePlan)
+	assert.True(t, ok)
+}
+
+func TestOptimizeGlobalTable(t *testing.T) {
+	o := mockOptimizer()
+	o.globalTables = map[string]bool{"country": true}
+	o.executors = []proto.DBGroupExecutor{nil, nil}
+
+	testCases := []struct {
+		sql       string
+		broadcast bool
+	}{
+		{sql: "insert into country(id, name) values(?, ?)", broadcast: true},
+		{sql: "update country set name = ? where id = ?", broadcast: true},
+		{sql: "delete from Country where id = ?", broadcast: true},
+		{sql: "select name from country where id = ?"},
+	}
+	for _, c := range testCases {
+		t.Run(c.sql, func(t *testing.T) {
+			stmt, err := parser.New().ParseOneStmt(c.sql, "", "")
+			assert.Nil(t, err)
+			stmt.Accept(&visitor.ParamVisitor{})
+			pl, err := o.Optimize(context.Background(), stmt, 1, "china")
+			assert.Nil(t, err)
+			if c.broadcast {
+				broadcastPlan, ok := pl.(*plan.BroadcastPlan)
+				assert.True(t, ok)
+				assert.Equal(t, 2, len(broadcastPlan.Executors))
+			} else {
+				queryPlan, ok := pl.(*plan.GlobalQueryPlan)
+				assert.True(t, ok)
+				assert.Equal(t, 2, len(queryPlan.Executors))
+			}
+		})
+	}
+}
+
 func mockOptimizer() *Optimizer {
 	tp := mockTopology()
 	generator, _ := sequence.NewWorker(123)
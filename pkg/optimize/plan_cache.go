@@ -0,0 +1,367 @@
+/*
+ * Copyright 2022 CECTC, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package optimize
+
+import (
+	"context"
+	"sort"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/cectc/dbpack/pkg/cond"
+	"github.com/cectc/dbpack/pkg/constant"
+	"github.com/cectc/dbpack/pkg/meta"
+	"github.com/cectc/dbpack/pkg/proto"
+	"github.com/cectc/dbpack/third_party/cache"
+	"github.com/cectc/dbpack/third_party/parser"
+	"github.com/cectc/dbpack/third_party/parser/ast"
+	"github.com/cectc/dbpack/third_party/parser/opcode"
+	driver "github.com/cectc/dbpack/third_party/types/parser_driver"
+)
+
+const (
+	planCacheHit  = "hit"
+	planCacheMiss = "miss"
+)
+
+var PlanCacheCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "dbpack",
+	Subsystem: "plan_cache",
+	Name:      "count",
+	Help:      "statement plan cache lookup count",
+}, []string{"appid", "result"})
+
+func init() {
+	prometheus.MustRegister(PlanCacheCounter)
+}
+
+type planBuilder func(ctx context.Context, stmt ast.StmtNode, args []interface{},
+	route *tableRoute, condition cond.Condition) (proto.Plan, error)
+
+// PlanTemplate is the optimization of a statement with its literals turned into parameters. It
+// holds the route of the logic table and the condition of the where clause parsed with the
+// parameters unbound, the plan of a statement is built by binding its own literals and arguments
+// to the condition, so the statements only differ in literals skip parsing the condition.
+// A template without build marks the statements which are not routed by a single logic table,
+// e.g. joins and show statements, they are optimized as usual.
+type PlanTemplate struct {
+	// sql is the parameterized sql of the statements sharing the template
+	sql   string
+	route *tableRoute
+	// condition is nil if the where clause can not be parsed with the parameters unbound,
+	// e.g. a parameter is an operand of a function, it is parsed with the literals then.
+	condition  cond.Condition
+	parameters int
+	build      planBuilder
+}
+
+// Size implements cache.Value
+func (template *PlanTemplate) Size() int {
+	return 1
+}
+
+// bind builds the plan of the statement from the template, literals are the literals of the
+// statement returned by parser.Parameterize.
+func (template *PlanTemplate) bind(ctx context.Context, stmt ast.StmtNode, args []interface{},
+	literals []*parser.Literal) (proto.Plan, error) {
+	var condition cond.Condition
+	if template.condition != nil {
+		if values, ok := literalValues(literals, args); ok && len(values) == template.parameters {
+			bound, err := cond.BindCondition(template.condition, values)
+			if err != nil {
+				return nil, err
+			}
+			condition = bound
+		}
+	}
+	return template.build(ctx, stmt, args, template.route, condition)
+}
+
+// literalValues returns the values of the parameters of the parameterized sql, the literals are
+// kept as they are, the parameter markers are replaced by the arguments.
+func literalValues(literals []*parser.Literal, args []interface{}) ([]interface{}, bool) {
+	var (
+		values = make([]interface{}, 0, len(literals))
+		j      int
+	)
+	for _, literal := range literals {
+		switch {
+		case literal.Fixed:
+		case literal.Marker:
+			if j >= len(args) {
+				return nil, false
+			}
+			values = append(values, args[j])
+			j++
+		default:
+			values = append(values, literal.Value.GetValue())
+		}
+	}
+	return values, true
+}
+
+// prepare resolves the plan template of the parameterized sql, nil is returned if the table meta
+// of the logic table is unavailable for the moment.
+func (o Optimizer) prepare(ctx context.Context, stmt ast.StmtNode, sql string) (*PlanTemplate, error) {
+	var (
+		tableRefs *ast.TableRefsClause
+		loadMeta  bool
+		build     planBuilder
+	)
+	switch t := stmt.(type) {
+	case *ast.SelectStmt:
+		tableRefs, loadMeta = t.From, true
+		build = func(ctx context.Context, stmt ast.StmtNode, args []interface{}, route *tableRoute,
+			condition cond.Condition) (proto.Plan, error) {
+			return o.routeSelect(ctx, stmt.(*ast.SelectStmt), args, route, condition)
+		}
+	case *ast.InsertStmt:
+		tableRefs, loadMeta = t.Table, true
+		build = func(ctx context.Context, stmt ast.StmtNode, args []interface{}, route *tableRoute,
+			condition cond.Condition) (proto.Plan, error) {
+			return o.routeInsert(ctx, stmt.(*ast.InsertStmt), args, route)
+		}
+	case *ast.UpdateStmt:
+		tableRefs = t.TableRefs
+		build = func(ctx context.Context, stmt ast.StmtNode, args []interface{}, route *tableRoute,
+			condition cond.Condition) (proto.Plan, error) {
+			return o.routeUpdate(ctx, stmt.(*ast.UpdateStmt), args, route, condition)
+		}
+	case *ast.DeleteStmt:
+		tableRefs = t.TableRefs
+		build = func(ctx context.Context, stmt ast.StmtNode, args []interface{}, route *tableRoute,
+			condition cond.Condition) (proto.Plan, error) {
+			return o.routeDelete(ctx, stmt.(*ast.DeleteStmt), args, route, condition)
+		}
+	default:
+		return &PlanTemplate{sql: sql}, nil
+	}
+	if tableRefs == nil || tableRefs.TableRefs == nil || tableRefs.TableRefs.Right != nil {
+		return &PlanTemplate{sql: sql}, nil
+	}
+	source, ok := tableRefs.TableRefs.Left.(*ast.TableSource)
+	if !ok {
+		return &PlanTemplate{sql: sql}, nil
+	}
+	table, ok := source.Source.(*ast.TableName)
+	if !ok {
+		return &PlanTemplate{sql: sql}, nil
+	}
+	route, err := o.resolveRoute(ctx, table.Name.String(), loadMeta)
+	if err != nil {
+		return nil, err
+	}
+	// the table meta may be unavailable for the moment, resolve it again next time
+	if !route.global && loadMeta && !route.metaLoaded {
+		return nil, nil
+	}
+	condition, parameters := parameterizedCondition(sql)
+	return &PlanTemplate{
+		sql:        sql,
+		route:      route,
+		condition:  condition,
+		parameters: parameters,
+		build:      build,
+	}, nil
+}
+
+// parameterizedCondition parses the where clause of the parameterized sql with the parameters
+// unbound, nil is returned if any parameter is not a value compared with a column directly.
+// It returns the number of the parameters of the sql as well.
+func parameterizedCondition(sql string) (cond.Condition, int) {
+	stmt, err := parser.New().ParseOneStmt(sql, "", "")
+	if err != nil {
+		return nil, 0
+	}
+	var where ast.ExprNode
+	switch t := stmt.(type) {
+	case *ast.SelectStmt:
+		where = t.Where
+	case *ast.UpdateStmt:
+		where = t.Where
+	case *ast.DeleteStmt:
+		where = t.Where
+	}
+
+	// the parameters are numbered in the order they appear in the sql, as the literals are
+	markers := &markerVisitor{}
+	stmt.Accept(markers)
+	sort.Slice(markers.markers, func(i, j int) bool {
+		return markers.markers[i].Offset < markers.markers[j].Offset
+	})
+	parameters := make([]interface{}, 0, len(markers.markers))
+	for i, marker := range markers.markers {
+		marker.SetOrder(i)
+		parameters = append(parameters, cond.Parameter(i))
+	}
+
+	if where != nil {
+		inWhere := &markerVisitor{}
+		where.Accept(inWhere)
+		if parameterizedOperands(where) != len(inWhere.markers) {
+			return nil, 0
+		}
+	}
+	condition, err := cond.ParseCondition(where, parameters...)
+	if err != nil {
+		return nil, 0
+	}
+	return condition, len(parameters)
+}
+
+// parameterizedOperands counts the parameters of the expression which are compared with a
+// column directly, the other parameters are evaluated when the condition is parsed.
+func parameterizedOperands(expr ast.ExprNode) int {
+	switch e := expr.(type) {
+	case *ast.BinaryOperationExpr:
+		switch e.Op {
+		case opcode.LogicAnd, opcode.LogicOr:
+			return parameterizedOperands(e.L) + parameterizedOperands(e.R)
+		case opcode.EQ, opcode.NE, opcode.GT, opcode.LT, opcode.GE, opcode.LE:
+			if isColumn(e.L) && isMarker(e.R) || isMarker(e.L) && isColumn(e.R) {
+				return 1
+			}
+		}
+	case *ast.ParenthesesExpr:
+		return parameterizedOperands(e.Expr)
+	case *ast.PatternInExpr:
+		if !isColumn(e.Expr) || e.Sel != nil {
+			return 0
+		}
+		var count int
+		for _, item := range e.List {
+			if isMarker(item) {
+				count++
+			}
+		}
+		return count
+	case *ast.BetweenExpr:
+		if !isColumn(e.Expr) {
+			return 0
+		}
+		var count int
+		for _, bound := range []ast.ExprNode{e.Left, e.Right} {
+			if isMarker(bound) {
+				count++
+			}
+		}
+		return count
+	}
+	return 0
+}
+
+func isColumn(expr ast.ExprNode) bool {
+	_, ok := expr.(*ast.ColumnNameExpr)
+	return ok
+}
+
+func isMarker(expr ast.ExprNode) bool {
+	_, ok := expr.(*driver.ParamMarkerExpr)
+	return ok
+}
+
+type markerVisitor struct {
+	markers []*driver.ParamMarkerExpr
+}
+
+func (v *markerVisitor) Enter(in ast.Node) (out ast.Node, skipChildren bool) {
+	if marker, ok := in.(*driver.ParamMarkerExpr); ok {
+		v.markers = append(v.markers, marker)
+	}
+	return in, false
+}
+
+func (v *markerVisitor) Leave(in ast.Node) (out ast.Node, ok bool) {
+	return in, true
+}
+
+// PlanCache caches the plan templates by the normalized digest of statements, so that the
+// statements only differ in literals, or the executions of a prepared statement, skip resolving
+// the sharding algorithm, topology and table meta of the logic table, and parsing the condition
+// of the where clause. The shards and the plan of a statement are computed from the template
+// bound with its own literals and arguments.
+// The templates are purged when any table meta changes. The sharding config is not reloaded at
+// runtime, the cache is owned by the executor built from the config and is dropped with it.
+type PlanCache struct {
+	appid     string
+	optimizer *Optimizer
+	templates *cache.LRUCache
+}
+
+// NewPlanCache wraps the optimizer with a plan cache, the optimizer is returned as it is
+// if it is not an *Optimizer.
+func NewPlanCache(appid string, optimizer proto.Optimizer, capacity int) proto.Optimizer {
+	o, ok := optimizer.(*Optimizer)
+	if !ok {
+		return optimizer
+	}
+	if capacity <= 0 {
+		capacity = constant.DefaultPlanCacheSize
+	}
+	planCache := &PlanCache{
+		appid:     appid,
+		optimizer: o,
+		templates: cache.NewLRUCache(int64(capacity)),
+	}
+	meta.GetTableMetaCache().OnChanged(func(schemaName, tableName string) {
+		planCache.Purge()
+	})
+	return planCache
+}
+
+func (c *PlanCache) Optimize(ctx context.Context, stmt ast.StmtNode, args ...interface{}) (proto.Plan, error) {
+	text := stmt.Text()
+	if text == "" {
+		return c.optimizer.Optimize(ctx, stmt, args...)
+	}
+	sql, literals, ok := parser.Parameterize(text)
+	if !ok {
+		return c.optimizer.Optimize(ctx, stmt, args...)
+	}
+	// statements with the same digest may differ in more than literals, e.g. the length of
+	// an in list, the parameterized sql tells them apart
+	_, digest := parser.NormalizeDigest(text)
+	key := proto.Schema(ctx) + "\x00" + digest.String()
+	if value, ok := c.templates.Get(key); ok && value.(*PlanTemplate).sql == sql {
+		PlanCacheCounter.WithLabelValues(c.appid, planCacheHit).Inc()
+		return c.build(ctx, value.(*PlanTemplate), stmt, args, literals)
+	}
+	PlanCacheCounter.WithLabelValues(c.appid, planCacheMiss).Inc()
+
+	template, err := c.optimizer.prepare(ctx, stmt, sql)
+	if err != nil {
+		return nil, err
+	}
+	if template == nil {
+		return c.optimizer.Optimize(ctx, stmt, args...)
+	}
+	c.templates.Set(key, template)
+	return c.build(ctx, template, stmt, args, literals)
+}
+
+func (c *PlanCache) build(ctx context.Context, template *PlanTemplate, stmt ast.StmtNode, args []interface{},
+	literals []*parser.Literal) (proto.Plan, error) {
+	if template.build == nil {
+		return c.optimizer.Optimize(ctx, stmt, args...)
+	}
+	return template.bind(ctx, stmt, args, literals)
+}
+
+// Purge removes all the plan templates
+func (c *PlanCache) Purge() {
+	c.templates.Clear()
+}
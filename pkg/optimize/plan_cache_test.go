@@ -0,0 +1,132 @@
+/*
+ * Copyright 2022 CECTC, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package optimize
+
+import (
+	"context"
+	"testing"
+
+	"github.com/agiledragon/gomonkey/v2"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/cectc/dbpack/pkg/cond"
+	"github.com/cectc/dbpack/pkg/dt/schema"
+	"github.com/cectc/dbpack/pkg/meta"
+	"github.com/cectc/dbpack/pkg/plan"
+	"github.com/cectc/dbpack/pkg/proto"
+	"github.com/cectc/dbpack/pkg/resource"
+	"github.com/cectc/dbpack/pkg/visitor"
+	"github.com/cectc/dbpack/third_party/parser"
+	"github.com/cectc/dbpack/third_party/parser/ast"
+)
+
+func TestPlanCache(t *testing.T) {
+	resource.SetDBManager("app1", &resource.DBManager{})
+	var (
+		tableMetaCache *meta.MysqlTableMetaCache
+		fetched        int
+	)
+	patches := gomonkey.ApplyMethodFunc(tableMetaCache, "GetTableMeta", func(ctx context.Context, db proto.DB, tableName string) (schema.TableMeta, error) {
+		fetched++
+		id := schema.ColumnMeta{TableName: "student", ColumnName: "id"}
+		return schema.TableMeta{
+			SchemaName: "school",
+			TableName:  "student",
+			Columns:    []string{"id", "age"},
+			AllColumns: map[string]schema.ColumnMeta{"id": id},
+			AllIndexes: map[string]schema.IndexMeta{
+				"PRIMARY": {
+					Values:     []schema.ColumnMeta{id},
+					IndexName:  "PRIMARY",
+					ColumnName: "id",
+					IndexType:  schema.IndexTypePrimary,
+				},
+			},
+		}, nil
+	})
+	defer patches.Reset()
+
+	planCache := NewPlanCache("app1", mockOptimizer(), 0).(*PlanCache)
+	optimize := func(sql string, args ...interface{}) *plan.QueryOnSingleDBPlan {
+		stmt, err := parser.New().ParseOneStmt(sql, "", "")
+		assert.Nil(t, err)
+		stmt.Accept(&visitor.ParamVisitor{})
+		pl, err := planCache.Optimize(context.Background(), stmt, args...)
+		assert.Nil(t, err)
+		queryPlan, ok := pl.(*plan.QueryOnSingleDBPlan)
+		assert.True(t, ok)
+		return queryPlan
+	}
+
+	queryPlan := optimize("select * from student where id = 1")
+	assert.Equal(t, "school_0", queryPlan.Database)
+	assert.Equal(t, []string{"student_1"}, queryPlan.Tables)
+	optimize("select * from student where id in (1, 2) and age > 18")
+	optimize("select * from student where id = ? and age > 18", 1)
+	assert.Equal(t, 3, fetched)
+	assert.Equal(t, int64(3), planCache.templates.Length())
+
+	// the statements only differ in literals reuse the templates, the conditions are bound with
+	// their own literals and arguments rather than parsed
+	var parsed int
+	conditionPatches := gomonkey.ApplyFunc(cond.ParseCondition, func(expr ast.ExprNode, args ...interface{}) (cond.Condition, error) {
+		parsed++
+		return nil, errors.New("condition should not be parsed")
+	})
+	queryPlan = optimize("select * from student where id = 15")
+	assert.Equal(t, "school_1", queryPlan.Database)
+	assert.Equal(t, []string{"student_15"}, queryPlan.Tables)
+	assert.Equal(t, "id", queryPlan.PK)
+	queryPlan = optimize("select * from student where id in (3, 5) and age > 20")
+	assert.Equal(t, "school_0", queryPlan.Database)
+	assert.Equal(t, []string{"student_3", "student_5"}, queryPlan.Tables)
+	queryPlan = optimize("select * from student where id = ? and age > 20", 15)
+	assert.Equal(t, "school_1", queryPlan.Database)
+	assert.Equal(t, []string{"student_15"}, queryPlan.Tables)
+	assert.Equal(t, 0, parsed)
+	assert.Equal(t, 3, fetched)
+	conditionPatches.Reset()
+
+	// the in list of another length has the same digest, but not the same template
+	queryPlan = optimize("select * from student where id in (1, 2, 3)")
+	assert.Equal(t, []string{"student_1", "student_2", "student_3"}, queryPlan.Tables)
+	assert.Equal(t, 4, fetched)
+
+	// joins are not built from a template, but are cached as such, so they are not prepared again
+	hits := testutil.ToFloat64(PlanCacheCounter.WithLabelValues("app1", planCacheHit))
+	for _, sql := range []string{
+		"select * from student a join student b on a.id = b.id where a.id = 1",
+		"select * from student a join student b on a.id = b.id where a.id = 2",
+	} {
+		_, _ = planCache.Optimize(context.Background(), mustParse(t, sql))
+	}
+	assert.Equal(t, hits+1, testutil.ToFloat64(PlanCacheCounter.WithLabelValues("app1", planCacheHit)))
+
+	fetched = 0
+	planCache.Purge()
+	assert.Equal(t, int64(0), planCache.templates.Length())
+	optimize("select * from student where id = 15")
+	assert.Equal(t, 1, fetched)
+}
+
+func mustParse(t *testing.T, sql string) ast.StmtNode {
+	stmt, err := parser.New().ParseOneStmt(sql, "", "")
+	assert.Nil(t, err)
+	return stmt
+}
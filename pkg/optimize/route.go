@@ -0,0 +1,85 @@
+/*
+ * Copyright 2022 CECTC, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package optimize
+
+import (
+	"context"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/cectc/dbpack/pkg/cond"
+	"github.com/cectc/dbpack/pkg/dt/schema"
+	"github.com/cectc/dbpack/pkg/meta"
+	"github.com/cectc/dbpack/pkg/resource"
+	"github.com/cectc/dbpack/pkg/topo"
+	"github.com/cectc/dbpack/third_party/parser/ast"
+)
+
+// tableRoute is the routing information of a logic table. It does not depend on
+// the literal values of a statement, so it is shared by the statements of a plan template.
+type tableRoute struct {
+	tableName string
+	// global is true if the table is a global table, which has no sharding algorithm.
+	global   bool
+	alg      cond.ShardingAlgorithm
+	topology *topo.Topology
+	// tableMeta is only loaded for the statements need the primary key.
+	tableMeta  schema.TableMeta
+	metaLoaded bool
+}
+
+func (o Optimizer) resolveRoute(ctx context.Context, tableName string, loadMeta bool) (*tableRoute, error) {
+	if o.globalTables[strings.ToLower(tableName)] {
+		return &tableRoute{tableName: tableName, global: true}, nil
+	}
+	alg, exists := o.algorithms[tableName]
+	if !exists {
+		return nil, errors.New("sharding algorithm should not be nil")
+	}
+	route := &tableRoute{
+		tableName: tableName,
+		alg:       alg,
+		topology:  alg.Topology(),
+	}
+	if loadMeta {
+		for db, tables := range route.topology.DBs {
+			sqlDB := resource.GetDBManager(o.appid).GetDB(db)
+			tableMeta, err := meta.GetTableMetaCache().GetTableMeta(ctx, sqlDB, tables[0])
+			if err != nil {
+				continue
+			}
+			route.tableMeta = tableMeta
+			route.metaLoaded = true
+			break
+		}
+	}
+	return route, nil
+}
+
+// whereCondition parses the condition of the where clause, unless the condition is bound from
+// a plan template already.
+func whereCondition(where ast.ExprNode, args []interface{}, bound cond.Condition) (cond.Condition, error) {
+	if bound != nil {
+		return bound, nil
+	}
+	condition, err := cond.ParseCondition(where, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse condition failed")
+	}
+	return condition, nil
+}
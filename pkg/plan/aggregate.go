@@ -0,0 +1,420 @@
+/*
+ * Copyright 2022 CECTC, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package plan
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/cectc/dbpack/pkg/constant"
+	"github.com/cectc/dbpack/pkg/mysql"
+	"github.com/cectc/dbpack/pkg/proto"
+	"github.com/cectc/dbpack/pkg/visitor"
+	"github.com/cectc/dbpack/third_party/parser/ast"
+	"github.com/cectc/dbpack/third_party/parser/format"
+)
+
+// AggregateColumn describes how a column of the shard results is merged.
+type AggregateColumn struct {
+	// Func is the aggregate function name, empty for group by columns and other plain columns
+	Func string
+	// CountIndex is the index of the COUNT column when AVG is rewritten into SUM and COUNT
+	CountIndex int
+	// Name overrides the column name returned by shards, e.g. AVG(x) is queried as SUM(x)
+	Name string
+}
+
+type OrderByColumn struct {
+	Index int
+	Desc  bool
+}
+
+// AggregatePlan merges the partial aggregate results of the shards, the statement executed
+// on shards has no HAVING, ORDER BY and LIMIT, they are applied after the results are merged.
+type AggregatePlan struct {
+	Plan    proto.Plan
+	Columns []*AggregateColumn
+	// FieldCount is the count of the columns returned to the client, the rest are hidden columns
+	// appended for AVG, GROUP BY, HAVING and ORDER BY
+	FieldCount int
+	GroupBy    []int
+	Having     ast.ExprNode
+	// ColumnRefs maps the column names, aliases and aggregate expressions referenced by HAVING
+	// to the column indexes, keys are generated by ExprKey
+	ColumnRefs map[string]int
+	OrderBy    []*OrderByColumn
+	Limit      *ast.Limit
+	Args       []interface{}
+}
+
+type aggregateGroup struct {
+	values []*proto.Value
+	sums   []*big.Rat
+}
+
+func (p *AggregatePlan) Execute(ctx context.Context, _ ...*ast.TableOptimizerHint) (proto.Result, uint16, error) {
+	proto.WithVariable(ctx, FuncColumns, p.funcColumns())
+	res, warning, err := p.Plan.Execute(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	result, ok := res.(*mysql.Result)
+	if !ok {
+		return nil, 0, errors.New("unexpected result type of aggregate query")
+	}
+	rows, err := decodeRows(result)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	binaryProtocol := proto.CommandType(ctx) == constant.ComStmtExecute
+	merged, err := p.merge(result.Fields, rows, binaryProtocol)
+	if err != nil {
+		return nil, 0, err
+	}
+	if merged, err = p.having(merged); err != nil {
+		return nil, 0, err
+	}
+	if len(p.OrderBy) != 0 {
+		sort.SliceStable(merged, func(i, j int) bool {
+			for _, item := range p.OrderBy {
+				result := compareValue(merged[i][item.Index], merged[j][item.Index])
+				if result == 0 {
+					continue
+				}
+				if item.Desc {
+					return result > 0
+				}
+				return result < 0
+			}
+			return false
+		})
+	}
+	if merged, err = p.limit(merged); err != nil {
+		return nil, 0, err
+	}
+
+	fields := make([]*mysql.Field, 0, p.FieldCount)
+	for i := 0; i < p.FieldCount; i++ {
+		field := *result.Fields[i]
+		column := p.Columns[i]
+		if column.Name != "" {
+			field.Name = column.Name
+		}
+		if column.Func == ast.AggFuncAvg && isDecimalType(field.FieldType) {
+			field.Decimals = avgDecimals(field.Decimals)
+		}
+		fields = append(fields, &field)
+	}
+	resultRows := make([]proto.Row, 0, len(merged))
+	for _, values := range merged {
+		if binaryProtocol {
+			resultRows = append(resultRows, mysql.NewBinaryRow(fields, values[:p.FieldCount]))
+		} else {
+			resultRows = append(resultRows, mysql.NewTextRow(fields, values[:p.FieldCount]))
+		}
+	}
+	return &mysql.Result{
+		Fields: fields,
+		Rows:   resultRows,
+	}, warning, nil
+}
+
+func (p *AggregatePlan) funcColumns() []*visitor.FuncColumn {
+	funcColumns := make([]*visitor.FuncColumn, 0)
+	for i, column := range p.Columns {
+		if column.Func != "" {
+			funcColumns = append(funcColumns, &visitor.FuncColumn{FuncName: column.Func, ColumnIndex: i})
+		}
+	}
+	return funcColumns
+}
+
+// merge recombines the partial aggregate values of the rows which belong to the same group.
+func (p *AggregatePlan) merge(fields []*mysql.Field, rows [][]*proto.Value, binaryProtocol bool) ([][]*proto.Value, error) {
+	var (
+		groups = make(map[string]*aggregateGroup)
+		keys   = make([]string, 0)
+	)
+	for _, row := range rows {
+		key := groupKey(row, p.GroupBy)
+		group, exists := groups[key]
+		if !exists {
+			group = &aggregateGroup{
+				values: make([]*proto.Value, len(p.Columns)),
+				sums:   make([]*big.Rat, len(p.Columns)),
+			}
+			groups[key] = group
+			keys = append(keys, key)
+			for i, column := range p.Columns {
+				if column.Func == "" {
+					group.values[i] = row[i]
+				}
+			}
+		}
+		for i, column := range p.Columns {
+			switch column.Func {
+			case ast.AggFuncCount, ast.AggFuncSum, ast.AggFuncAvg:
+				if row[i] == nil || row[i].Val == nil {
+					continue
+				}
+				val, err := valueToRat(row[i].Val)
+				if err != nil {
+					return nil, err
+				}
+				if group.sums[i] == nil {
+					group.sums[i] = new(big.Rat)
+				}
+				group.sums[i].Add(group.sums[i], val)
+			case ast.AggFuncMin, ast.AggFuncMax:
+				if row[i] == nil || row[i].Val == nil {
+					continue
+				}
+				if group.values[i] == nil {
+					group.values[i] = row[i]
+					continue
+				}
+				result := compareValue(row[i], group.values[i])
+				if (column.Func == ast.AggFuncMin && result < 0) ||
+					(column.Func == ast.AggFuncMax && result > 0) {
+					group.values[i] = row[i]
+				}
+			}
+		}
+	}
+
+	// aggregate without group by always returns one row
+	if len(keys) == 0 && len(p.GroupBy) == 0 {
+		group := &aggregateGroup{
+			values: make([]*proto.Value, len(p.Columns)),
+			sums:   make([]*big.Rat, len(p.Columns)),
+		}
+		keys = append(keys, "")
+		groups[""] = group
+	}
+
+	merged := make([][]*proto.Value, 0, len(keys))
+	for _, key := range keys {
+		group := groups[key]
+		for i, column := range p.Columns {
+			switch column.Func {
+			case ast.AggFuncCount:
+				sum := group.sums[i]
+				if sum == nil {
+					sum = new(big.Rat)
+				}
+				group.values[i] = ratToValue(fields[i], sum, fields[i].Decimals, binaryProtocol)
+			case ast.AggFuncSum:
+				if group.sums[i] == nil {
+					group.values[i] = nil
+					continue
+				}
+				group.values[i] = ratToValue(fields[i], group.sums[i], fields[i].Decimals, binaryProtocol)
+			}
+		}
+		for i, column := range p.Columns {
+			if column.Func != ast.AggFuncAvg {
+				continue
+			}
+			count := group.sums[column.CountIndex]
+			if group.sums[i] == nil || count == nil || count.Sign() == 0 {
+				group.values[i] = nil
+				continue
+			}
+			avg := new(big.Rat).Quo(group.sums[i], count)
+			group.values[i] = ratToValue(fields[i], avg, avgDecimals(fields[i].Decimals), binaryProtocol)
+		}
+		merged = append(merged, group.values)
+	}
+	return merged, nil
+}
+
+func (p *AggregatePlan) having(rows [][]*proto.Value) ([][]*proto.Value, error) {
+	if p.Having == nil {
+		return rows, nil
+	}
+	result := make([][]*proto.Value, 0, len(rows))
+	for _, row := range rows {
+		eval := &havingEvaluator{row: row, refs: p.ColumnRefs, args: p.Args}
+		val, err := eval.eval(p.Having)
+		if err != nil {
+			return nil, err
+		}
+		if isTrue(val) {
+			result = append(result, row)
+		}
+	}
+	return result, nil
+}
+
+func (p *AggregatePlan) limit(rows [][]*proto.Value) ([][]*proto.Value, error) {
+	if p.Limit == nil {
+		return rows, nil
+	}
+	offset, err := limitValue(p.Limit.Offset, p.Args)
+	if err != nil {
+		return nil, err
+	}
+	count, err := limitValue(p.Limit.Count, p.Args)
+	if err != nil {
+		return nil, err
+	}
+	total := int64(len(rows))
+	if offset >= total {
+		return rows[:0], nil
+	}
+	end := offset + count
+	if end > total {
+		end = total
+	}
+	return rows[offset:end], nil
+}
+
+// ExprKey returns the key of the expression in AggregatePlan.ColumnRefs, columns are
+// identified by their names, other expressions by the restored sql text.
+func ExprKey(expr ast.ExprNode) string {
+	if column, ok := expr.(*ast.ColumnNameExpr); ok {
+		return strings.ToLower(column.Name.Name.O)
+	}
+	var sb strings.Builder
+	if err := expr.Restore(format.NewRestoreCtx(format.RestoreKeyWordUppercase|format.RestoreNameBackQuotes, &sb)); err != nil {
+		return ""
+	}
+	return strings.ToLower(sb.String())
+}
+
+func groupKey(row []*proto.Value, indexes []int) string {
+	var sb strings.Builder
+	for _, index := range indexes {
+		value := row[index]
+		if value == nil || value.Val == nil {
+			sb.WriteString("N;")
+			continue
+		}
+		var s string
+		switch val := value.Val.(type) {
+		case []byte:
+			s = string(val)
+		default:
+			s = fmt.Sprintf("%v", val)
+		}
+		sb.WriteString(strconv.Itoa(len(s)))
+		sb.WriteByte(':')
+		sb.WriteString(s)
+	}
+	return sb.String()
+}
+
+func avgDecimals(decimals byte) byte {
+	// mysql div_precision_increment defaults to 4
+	decimals += 4
+	if decimals > 30 {
+		decimals = 30
+	}
+	return decimals
+}
+
+func isIntegerType(typ constant.FieldType) bool {
+	switch typ {
+	case constant.FieldTypeTiny, constant.FieldTypeShort, constant.FieldTypeLong, constant.FieldTypeLongLong,
+		constant.FieldTypeInt24, constant.FieldTypeYear, constant.FieldTypeUint8, constant.FieldTypeUint16,
+		constant.FieldTypeUint24, constant.FieldTypeUint32, constant.FieldTypeUint64:
+		return true
+	}
+	return false
+}
+
+func isDecimalType(typ constant.FieldType) bool {
+	return typ == constant.FieldTypeDecimal || typ == constant.FieldTypeNewDecimal
+}
+
+func isNumericType(typ constant.FieldType) bool {
+	return isIntegerType(typ) || isDecimalType(typ) ||
+		typ == constant.FieldTypeFloat || typ == constant.FieldTypeDouble
+}
+
+func valueToRat(val interface{}) (*big.Rat, error) {
+	result := new(big.Rat)
+	switch v := val.(type) {
+	case int64:
+		return result.SetInt64(v), nil
+	case uint64:
+		return result.SetUint64(v), nil
+	case float32:
+		return result.SetFloat64(float64(v)), nil
+	case float64:
+		return result.SetFloat64(v), nil
+	case []byte:
+		if _, ok := result.SetString(string(v)); ok {
+			return result, nil
+		}
+	case string:
+		if _, ok := result.SetString(v); ok {
+			return result, nil
+		}
+	}
+	return nil, errors.Errorf("can not merge aggregate value %v", val)
+}
+
+// ratToValue converts the merged number to a value of the field type, text protocol values are
+// []byte, binary protocol values are of the go types which packet.BinaryVal2MySQL requires.
+func ratToValue(field *mysql.Field, val *big.Rat, decimals byte, binaryProtocol bool) *proto.Value {
+	var (
+		text   string
+		binary interface{}
+	)
+	switch {
+	case isIntegerType(field.FieldType):
+		num := new(big.Int).Quo(val.Num(), val.Denom())
+		text = num.String()
+		binary = num.Int64()
+		if field.FieldType == constant.FieldTypeUint64 && !num.IsInt64() {
+			binary = text
+		}
+	case field.FieldType == constant.FieldTypeFloat:
+		f, _ := val.Float32()
+		text = strconv.FormatFloat(float64(f), 'f', -1, 32)
+		binary = f
+	case field.FieldType == constant.FieldTypeDouble:
+		f, _ := val.Float64()
+		text = strconv.FormatFloat(f, 'f', -1, 64)
+		binary = f
+	default:
+		if decimals > 30 {
+			decimals = 30
+		}
+		text = val.FloatString(int(decimals))
+		binary = []byte(text)
+	}
+	value := &proto.Value{
+		Typ:   field.FieldType,
+		Flags: field.Flags,
+		Len:   len(text),
+		Val:   []byte(text),
+		Raw:   []byte(text),
+	}
+	if binaryProtocol {
+		value.Val = binary
+	}
+	return value
+}
@@ -0,0 +1,131 @@
+/*
+ * Copyright 2022 CECTC, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package plan
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/cectc/dbpack/pkg/constant"
+	"github.com/cectc/dbpack/pkg/mysql"
+	"github.com/cectc/dbpack/pkg/proto"
+	"github.com/cectc/dbpack/third_party/parser"
+	"github.com/cectc/dbpack/third_party/parser/ast"
+)
+
+// country_code, COUNT(*), SUM(population) AS avg_population, MAX(population), COUNT(population)
+func mockAggregateResult() *mysql.Result {
+	fields := []*mysql.Field{
+		{Name: "country_code", FieldType: constant.FieldTypeVarString},
+		{Name: "COUNT(*)", FieldType: constant.FieldTypeLongLong},
+		{Name: "avg_population", FieldType: constant.FieldTypeNewDecimal},
+		{Name: "MAX(population)", FieldType: constant.FieldTypeLong},
+		{Name: "COUNT(population)", FieldType: constant.FieldTypeLongLong},
+	}
+	rows := [][]string{
+		{"CHN", "2", "300", "200", "2"},
+		{"USA", "1", "50", "50", "1"},
+		{"CHN", "1", "90", "90", "1"},
+		{"JPN", "3", "30", "20", "3"},
+		{"USA", "2", "150", "100", "2"},
+	}
+	result := &mysql.Result{Fields: fields}
+	for _, row := range rows {
+		values := make([]*proto.Value, 0, len(row))
+		for i, val := range row {
+			values = append(values, &proto.Value{Typ: fields[i].FieldType, Val: []byte(val), Raw: []byte(val)})
+		}
+		result.Rows = append(result.Rows, mysql.NewTextRow(fields, values))
+	}
+	return result
+}
+
+func TestAggregatePlan(t *testing.T) {
+	having, err := parser.New().ParseOneStmt("select 1 from t having count(*) > 2", "", "")
+	assert.Nil(t, err)
+	p := &AggregatePlan{
+		Plan: &resultPlan{result: mockAggregateResult()},
+		Columns: []*AggregateColumn{
+			{},
+			{Func: ast.AggFuncCount},
+			{Func: ast.AggFuncAvg, CountIndex: 4},
+			{Func: ast.AggFuncMax},
+			{Func: ast.AggFuncCount},
+		},
+		FieldCount: 4,
+		GroupBy:    []int{0},
+		Having:     having.(*ast.SelectStmt).Having.Expr,
+		ColumnRefs: map[string]int{"country_code": 0, "count(1)": 1, "avg_population": 2},
+		OrderBy:    []*OrderByColumn{{Index: 2, Desc: true}},
+	}
+	result, _, err := p.Execute(context.Background())
+	assert.Nil(t, err)
+	rlt := result.(*mysql.Result)
+	assert.Equal(t, 4, len(rlt.Fields))
+	assert.Equal(t, byte(4), rlt.Fields[2].Decimals)
+
+	expected := [][]string{
+		{"CHN", "3", "130.0000", "200"},
+		{"USA", "3", "66.6667", "100"},
+		{"JPN", "3", "10.0000", "20"},
+	}
+	assert.Equal(t, len(expected), len(rlt.Rows))
+	for i, row := range rlt.Rows {
+		values, err := row.Decode()
+		assert.Nil(t, err)
+		for j, value := range values {
+			assert.Equal(t, expected[i][j], string(value.Val.([]byte)))
+		}
+	}
+}
+
+func TestAggregatePlanWithoutGroupBy(t *testing.T) {
+	fields := []*mysql.Field{
+		{Name: "COUNT(*)", FieldType: constant.FieldTypeLongLong},
+		{Name: "SUM(age)", FieldType: constant.FieldTypeNewDecimal},
+		{Name: "MIN(name)", FieldType: constant.FieldTypeVarString},
+	}
+	result := &mysql.Result{Fields: fields}
+	for _, row := range [][]interface{}{{int64(2), []byte("9"), []byte("b")}, {int64(0), nil, nil}, {int64(1), []byte("10"), []byte("ab")}} {
+		values := make([]*proto.Value, 0, len(row))
+		for i, val := range row {
+			values = append(values, &proto.Value{Typ: fields[i].FieldType, Val: val})
+		}
+		result.Rows = append(result.Rows, mysql.NewBinaryRow(fields, values))
+	}
+	p := &AggregatePlan{
+		Plan: &resultPlan{result: result},
+		Columns: []*AggregateColumn{
+			{Func: ast.AggFuncCount},
+			{Func: ast.AggFuncSum},
+			{Func: ast.AggFuncMin},
+		},
+		FieldCount: 3,
+	}
+	ctx := proto.WithCommandType(context.Background(), constant.ComStmtExecute)
+	rlt, _, err := p.Execute(ctx)
+	assert.Nil(t, err)
+	rows := rlt.(*mysql.Result).Rows
+	assert.Equal(t, 1, len(rows))
+	values, err := rows[0].Decode()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), values[0].Val)
+	assert.Equal(t, []byte("19"), values[1].Val)
+	assert.Equal(t, []byte("ab"), values[2].Val)
+}
@@ -0,0 +1,175 @@
+/*
+ * Copyright 2022 CECTC, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package plan
+
+import (
+	"context"
+	"math/rand"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/cectc/dbpack/pkg/constant"
+	"github.com/cectc/dbpack/pkg/group"
+	"github.com/cectc/dbpack/pkg/log"
+	"github.com/cectc/dbpack/pkg/proto"
+	"github.com/cectc/dbpack/third_party/parser/ast"
+	"github.com/cectc/dbpack/third_party/parser/format"
+)
+
+// BroadcastPlan writes a global table, the statement is executed on every db group in a
+// ComplexTx so that the copies of the global table are consistent. If the statement is not
+// in a transaction, it is executed in a ComplexTx of the configured transaction mode, which is
+// committed after the statement is executed on all db groups, and rolled back if any of them fails.
+type BroadcastPlan struct {
+	Stmt      ast.StmtNode
+	Args      []interface{}
+	Executors []proto.DBGroupExecutor
+}
+
+func (p *BroadcastPlan) Execute(ctx context.Context, hints ...*ast.TableOptimizerHint) (result proto.Result, warnings uint16, err error) {
+	complexTx := proto.ExtractDBGroupTx(ctx)
+	if complexTx == nil {
+		return executeInComplexTx(ctx, p)
+	}
+
+	var sb strings.Builder
+	stmtNode := withTableHints(p.Stmt, hints)
+	restoreCtx := format.NewRestoreCtx(constant.DBPackRestoreFormat, &sb)
+	if err = stmtNode.Restore(restoreCtx); err != nil {
+		return nil, 0, errors.WithStack(err)
+	}
+	sql := sb.String()
+
+	for i, executor := range p.Executors {
+		log.Debugf("broadcast, db name: %s, sql: %s", executor.GroupName(), sql)
+		tx, err := complexTx.Begin(ctx, executor)
+		if err != nil {
+			return nil, 0, errors.WithStack(err)
+		}
+		var (
+			rlt   proto.Result
+			warns uint16
+		)
+		switch proto.CommandType(ctx) {
+		case constant.ComQuery:
+			rlt, warns, err = tx.Query(proto.WithQueryStmt(ctx, stmtNode), sql)
+		case constant.ComStmtExecute:
+			stmt := generateStatement(sql, stmtNode, p.Args)
+			rlt, warns, err = tx.ExecuteSql(proto.WithPrepareStmt(ctx, stmt), sql, p.Args...)
+		default:
+			return nil, 0, nil
+		}
+		if err != nil {
+			return nil, 0, errors.Wrapf(err, "broadcast to db group %s failed", executor.GroupName())
+		}
+		// every db group has a copy of the global table, the result of the first one is returned
+		if i == 0 {
+			result, warnings = rlt, warns
+		}
+	}
+	return result, warnings, nil
+}
+
+// executeInComplexTx executes the plan writing multiple db groups outside a transaction in a ComplexTx
+// of the transaction mode of the executor, it is committed if the plan succeeds, and rolled back otherwise.
+func executeInComplexTx(ctx context.Context, plan proto.Plan) (proto.Result, uint16, error) {
+	complexTx := proto.NewDBGroupTx(ctx)
+	if complexTx == nil {
+		complexTx = group.NewComplexTx(nil)
+	}
+	result, warnings, err := complexTx.ExecutePlan(ctx, plan)
+	if err != nil {
+		if _, rollbackErr := complexTx.Rollback(ctx); rollbackErr != nil {
+			log.Errorf("rollback complex transaction failed, err: %v", rollbackErr)
+		}
+		return nil, 0, err
+	}
+	if _, err = complexTx.Commit(ctx); err != nil {
+		return nil, 0, err
+	}
+	return result, warnings, nil
+}
+
+// withTableHints returns a copy of the statement with the hints appended, e.g. the xid hint of a
+// distributed transaction.
+func withTableHints(stmt ast.StmtNode, hints []*ast.TableOptimizerHint) ast.StmtNode {
+	if len(hints) == 0 {
+		return stmt
+	}
+	switch node := stmt.(type) {
+	case *ast.InsertStmt:
+		n := *node
+		n.TableHints = append(append([]*ast.TableOptimizerHint{}, node.TableHints...), hints...)
+		return &n
+	case *ast.UpdateStmt:
+		n := *node
+		n.TableHints = append(append([]*ast.TableOptimizerHint{}, node.TableHints...), hints...)
+		return &n
+	case *ast.DeleteStmt:
+		n := *node
+		n.TableHints = append(append([]*ast.TableOptimizerHint{}, node.TableHints...), hints...)
+		return &n
+	}
+	return stmt
+}
+
+// GlobalQueryPlan reads a global table. In a ComplexTx the first db group is read through the
+// transaction, so that the writes of the transaction are visible, otherwise the db group is
+// chosen randomly to balance the load.
+type GlobalQueryPlan struct {
+	Stmt      *ast.SelectStmt
+	Args      []interface{}
+	Executors []proto.DBGroupExecutor
+}
+
+func (p *GlobalQueryPlan) Execute(ctx context.Context, _ ...*ast.TableOptimizerHint) (proto.Result, uint16, error) {
+	var sb strings.Builder
+	restoreCtx := format.NewRestoreCtx(constant.DBPackRestoreFormat, &sb)
+	if err := p.Stmt.Restore(restoreCtx); err != nil {
+		return nil, 0, errors.WithStack(err)
+	}
+	sql := sb.String()
+
+	if complexTx := proto.ExtractDBGroupTx(ctx); complexTx != nil {
+		executor := p.Executors[0]
+		log.Debugf("query global table, db name: %s, sql: %s", executor.GroupName(), sql)
+		tx, err := complexTx.Begin(ctx, executor)
+		if err != nil {
+			return nil, 0, errors.WithStack(err)
+		}
+		switch proto.CommandType(ctx) {
+		case constant.ComQuery:
+			return tx.Query(ctx, sql)
+		case constant.ComStmtExecute:
+			return tx.ExecuteSql(ctx, sql, p.Args...)
+		default:
+			return nil, 0, nil
+		}
+	}
+
+	executor := p.Executors[rand.Intn(len(p.Executors))]
+	log.Debugf("query global table, db name: %s, sql: %s", executor.GroupName(), sql)
+	switch proto.CommandType(ctx) {
+	case constant.ComQuery:
+		return executor.Query(ctx, sql)
+	case constant.ComStmtExecute:
+		return executor.PrepareQuery(ctx, sql, p.Args...)
+	default:
+		return nil, 0, nil
+	}
+}
@@ -0,0 +1,115 @@
+/*
+ * Copyright 2022 CECTC, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package plan
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/cectc/dbpack/pkg/constant"
+	"github.com/cectc/dbpack/pkg/group"
+	"github.com/cectc/dbpack/pkg/mysql"
+	"github.com/cectc/dbpack/pkg/proto"
+	"github.com/cectc/dbpack/pkg/visitor"
+	"github.com/cectc/dbpack/third_party/parser"
+	"github.com/cectc/dbpack/third_party/parser/ast"
+)
+
+type mockBroadcastExecutor struct {
+	proto.DBGroupExecutor
+	name string
+	tx   *mockBroadcastTx
+	fail bool
+}
+
+func (e *mockBroadcastExecutor) GroupName() string {
+	return e.name
+}
+
+func (e *mockBroadcastExecutor) Begin(ctx context.Context) (proto.Tx, proto.Result, error) {
+	e.tx = &mockBroadcastTx{fail: e.fail}
+	return e.tx, nil, nil
+}
+
+type mockBroadcastTx struct {
+	proto.Tx
+	fail       bool
+	sqls       []string
+	committed  bool
+	rollbacked bool
+}
+
+func (tx *mockBroadcastTx) ExecuteSql(ctx context.Context, sql string, args ...interface{}) (proto.Result, uint16, error) {
+	if tx.fail {
+		return nil, 0, errors.New("duplicate entry")
+	}
+	tx.sqls = append(tx.sqls, sql)
+	return &mysql.Result{AffectedRows: 1}, 0, nil
+}
+
+func (tx *mockBroadcastTx) Commit(ctx context.Context) (proto.Result, error) {
+	tx.committed = true
+	return nil, nil
+}
+
+func (tx *mockBroadcastTx) Rollback(ctx context.Context, stmt *ast.RollbackStmt) (proto.Result, error) {
+	tx.rollbacked = true
+	return nil, nil
+}
+
+func TestBroadcastPlan(t *testing.T) {
+	stmt, err := parser.New().ParseOneStmt("insert into country(id, name) values (?, ?)", "", "")
+	assert.Nil(t, err)
+	stmt.Accept(&visitor.ParamVisitor{})
+	ctx := proto.WithCommandType(context.Background(), constant.ComStmtExecute)
+
+	executors := []*mockBroadcastExecutor{{name: "world_0"}, {name: "world_1"}}
+	p := &BroadcastPlan{
+		Stmt:      stmt,
+		Args:      []interface{}{1, "china"},
+		Executors: []proto.DBGroupExecutor{executors[0], executors[1]},
+	}
+	result, _, err := p.Execute(ctx)
+	assert.Nil(t, err)
+	affected, _ := result.RowsAffected()
+	assert.Equal(t, uint64(1), affected)
+	for _, executor := range executors {
+		assert.Equal(t, []string{"INSERT INTO `country` (`id`,`name`) VALUES (?,?)"}, executor.tx.sqls)
+		assert.True(t, executor.tx.committed)
+	}
+
+	// the ComplexTx is created in the transaction mode of the executor
+	var created int
+	factoryCtx := proto.WithDBGroupTxFactory(ctx, func() proto.DBGroupTx {
+		created++
+		return group.NewComplexTx(nil)
+	})
+	_, _, err = p.Execute(factoryCtx)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, created)
+
+	executors[1].fail = true
+	_, _, err = p.Execute(ctx)
+	assert.NotNil(t, err)
+	for _, executor := range executors {
+		assert.False(t, executor.tx.committed)
+		assert.True(t, executor.tx.rollbacked)
+	}
+}
@@ -147,19 +147,13 @@ func (p *DeletePlan) generate(sb *strings.Builder, table string, hints ...*ast.T
 			return errors.Wrap(err, "An error occurred while restoring DeleteStmt.Order")
 		}
 	}
-	if p.Stmt.Order != nil {
+
+	if p.Stmt.Limit != nil {
 		ctx.WritePlain(" ")
-		if err := p.Stmt.Order.Restore(ctx); err != nil {
-			return errors.Wrap(err, "An error occurred while restore DeleteStmt.Order")
+		if err := p.Stmt.Limit.Restore(ctx); err != nil {
+			return errors.Wrap(err, "An error occurred while restoring DeleteStmt.Limit")
 		}
 	}
-
-	//if p.Stmt.Limit != nil {
-	//	ctx.WritePlain(" ")
-	//	if err := p.Stmt.Limit.Restore(ctx); err != nil {
-	//		return errors.Wrap(err, "An error occurred while restoring DeleteStmt.Limit")
-	//	}
-	//}
 	return nil
 }
 
@@ -169,13 +163,12 @@ type MultiDeletePlan struct {
 	Plans []*DeletePlan
 }
 
-func (p *MultiDeletePlan) Execute(ctx context.Context, _ ...*ast.TableOptimizerHint) (result proto.Result, warns uint16, err error) {
+func (p *MultiDeletePlan) Execute(ctx context.Context, hints ...*ast.TableOptimizerHint) (result proto.Result, warns uint16, err error) {
 	var (
 		affectedRows  uint64
 		warnings      uint16
 		affected      uint64
 		inTransaction bool
-		hints         []*ast.TableOptimizerHint
 	)
 	if complexTx := proto.ExtractDBGroupTx(ctx); complexTx != nil {
 		inTransaction = true
@@ -58,6 +58,11 @@ func (p *DirectQueryPlan) Execute(ctx context.Context, hints ...*ast.TableOptimi
 	}
 }
 
+// ExecuteStream executes the plan, the rows of the result set are streamed from the backend.
+func (p *DirectQueryPlan) ExecuteStream(ctx context.Context, hints ...*ast.TableOptimizerHint) (proto.Result, uint16, error) {
+	return p.Execute(proto.WithStreaming(ctx), hints...)
+}
+
 type MultiDirectlyQueryPlan struct {
 	Stmt  ast.Node
 	Plans []*DirectQueryPlan
@@ -0,0 +1,293 @@
+/*
+ * Copyright 2022 CECTC, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package plan
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/cectc/dbpack/pkg/proto"
+	"github.com/cectc/dbpack/third_party/parser/ast"
+	"github.com/cectc/dbpack/third_party/parser/opcode"
+	driver "github.com/cectc/dbpack/third_party/types/parser_driver"
+)
+
+// havingEvaluator evaluates the HAVING condition against a merged row, numbers are
+// evaluated as float64, predicates as bool, and NULL as nil.
+type havingEvaluator struct {
+	row  []*proto.Value
+	refs map[string]int
+	args []interface{}
+}
+
+func (e *havingEvaluator) eval(expr ast.ExprNode) (interface{}, error) {
+	switch n := expr.(type) {
+	case *ast.ColumnNameExpr, *ast.AggregateFuncExpr:
+		index, ok := e.refs[ExprKey(expr)]
+		if !ok {
+			return nil, errors.Errorf("unknown column '%s' in 'having clause'", ExprKey(expr))
+		}
+		return normalizeValue(e.row[index]), nil
+	case *driver.ValueExpr:
+		return normalizeValue(n.GetValue()), nil
+	case *driver.ParamMarkerExpr:
+		if n.Order >= len(e.args) {
+			return nil, errors.New("missing parameter of having clause")
+		}
+		return normalizeValue(e.args[n.Order]), nil
+	case *ast.ParenthesesExpr:
+		return e.eval(n.Expr)
+	case *ast.UnaryOperationExpr:
+		val, err := e.eval(n.V)
+		if err != nil || val == nil {
+			return nil, err
+		}
+		switch n.Op {
+		case opcode.Not, opcode.Not2:
+			return !isTrue(val), nil
+		case opcode.Minus:
+			f, ok := toFloat(val)
+			if !ok {
+				return nil, errors.Errorf("unsupported value %v of unary minus", val)
+			}
+			return -f, nil
+		case opcode.Plus:
+			return val, nil
+		}
+		return nil, errors.Errorf("unsupported unary operator %s in having clause", n.Op)
+	case *ast.BinaryOperationExpr:
+		return e.evalBinary(n)
+	case *ast.IsNullExpr:
+		val, err := e.eval(n.Expr)
+		if err != nil {
+			return nil, err
+		}
+		return (val == nil) != n.Not, nil
+	case *ast.BetweenExpr:
+		val, err := e.eval(n.Expr)
+		if err != nil {
+			return nil, err
+		}
+		left, err := e.eval(n.Left)
+		if err != nil {
+			return nil, err
+		}
+		right, err := e.eval(n.Right)
+		if err != nil {
+			return nil, err
+		}
+		if val == nil || left == nil || right == nil {
+			return nil, nil
+		}
+		between := compareAny(val, left) >= 0 && compareAny(val, right) <= 0
+		return between != n.Not, nil
+	case *ast.PatternInExpr:
+		if n.Sel != nil {
+			return nil, errors.New("unsupported subquery in having clause")
+		}
+		val, err := e.eval(n.Expr)
+		if err != nil || val == nil {
+			return nil, err
+		}
+		for _, item := range n.List {
+			v, err := e.eval(item)
+			if err != nil {
+				return nil, err
+			}
+			if v != nil && compareAny(val, v) == 0 {
+				return !n.Not, nil
+			}
+		}
+		return n.Not, nil
+	}
+	return nil, errors.Errorf("unsupported expression %T in having clause", expr)
+}
+
+func (e *havingEvaluator) evalBinary(expr *ast.BinaryOperationExpr) (interface{}, error) {
+	left, err := e.eval(expr.L)
+	if err != nil {
+		return nil, err
+	}
+	right, err := e.eval(expr.R)
+	if err != nil {
+		return nil, err
+	}
+	switch expr.Op {
+	case opcode.LogicAnd:
+		if (left != nil && !isTrue(left)) || (right != nil && !isTrue(right)) {
+			return false, nil
+		}
+		if left == nil || right == nil {
+			return nil, nil
+		}
+		return true, nil
+	case opcode.LogicOr:
+		if (left != nil && isTrue(left)) || (right != nil && isTrue(right)) {
+			return true, nil
+		}
+		if left == nil || right == nil {
+			return nil, nil
+		}
+		return false, nil
+	case opcode.NullEQ:
+		if left == nil || right == nil {
+			return left == nil && right == nil, nil
+		}
+		return compareAny(left, right) == 0, nil
+	}
+
+	if left == nil || right == nil {
+		return nil, nil
+	}
+	switch expr.Op {
+	case opcode.EQ:
+		return compareAny(left, right) == 0, nil
+	case opcode.NE:
+		return compareAny(left, right) != 0, nil
+	case opcode.LT:
+		return compareAny(left, right) < 0, nil
+	case opcode.LE:
+		return compareAny(left, right) <= 0, nil
+	case opcode.GT:
+		return compareAny(left, right) > 0, nil
+	case opcode.GE:
+		return compareAny(left, right) >= 0, nil
+	case opcode.Plus, opcode.Minus, opcode.Mul, opcode.Div:
+		l, ok1 := toFloat(left)
+		r, ok2 := toFloat(right)
+		if !ok1 || !ok2 {
+			return nil, errors.Errorf("unsupported arithmetic between %v and %v", left, right)
+		}
+		switch expr.Op {
+		case opcode.Plus:
+			return l + r, nil
+		case opcode.Minus:
+			return l - r, nil
+		case opcode.Mul:
+			return l * r, nil
+		default:
+			if r == 0 {
+				return nil, nil
+			}
+			return l / r, nil
+		}
+	}
+	return nil, errors.Errorf("unsupported operator %s in having clause", expr.Op)
+}
+
+func normalizeValue(val interface{}) interface{} {
+	switch v := val.(type) {
+	case nil:
+		return nil
+	case *proto.Value:
+		if v == nil || v.Val == nil {
+			return nil
+		}
+		if b, ok := v.Val.([]byte); ok {
+			if isNumericType(v.Typ) {
+				if f, err := strconv.ParseFloat(string(b), 64); err == nil {
+					return f
+				}
+			}
+			return string(b)
+		}
+		return normalizeValue(v.Val)
+	case bool:
+		return v
+	case int64:
+		return float64(v)
+	case int:
+		return float64(v)
+	case uint64:
+		return float64(v)
+	case float32:
+		return float64(v)
+	case float64:
+		return v
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case time.Time:
+		return v
+	case fmt.Stringer:
+		// *types.MyDecimal and other literal types
+		if f, err := strconv.ParseFloat(v.String(), 64); err == nil {
+			return f
+		}
+		return v.String()
+	}
+	return fmt.Sprintf("%v", val)
+}
+
+func toFloat(val interface{}) (float64, bool) {
+	switch v := val.(type) {
+	case float64:
+		return v, true
+	case bool:
+		if v {
+			return 1, true
+		}
+		return 0, true
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func isTrue(val interface{}) bool {
+	if b, ok := val.(bool); ok {
+		return b
+	}
+	f, ok := toFloat(val)
+	return ok && f != 0
+}
+
+func compareAny(v1, v2 interface{}) int {
+	if t1, ok := v1.(time.Time); ok {
+		if t2, ok := v2.(time.Time); ok {
+			switch {
+			case t1.Before(t2):
+				return -1
+			case t1.After(t2):
+				return 1
+			}
+			return 0
+		}
+	}
+	_, isString1 := v1.(string)
+	_, isString2 := v2.(string)
+	if !isString1 || !isString2 {
+		f1, ok1 := toFloat(v1)
+		f2, ok2 := toFloat(v2)
+		if ok1 && ok2 {
+			switch {
+			case f1 < f2:
+				return -1
+			case f1 > f2:
+				return 1
+			}
+			return 0
+		}
+	}
+	return strings.Compare(fmt.Sprintf("%v", v1), fmt.Sprintf("%v", v2))
+}
@@ -24,7 +24,10 @@ import (
 
 	"github.com/cectc/dbpack/pkg/constant"
 	"github.com/cectc/dbpack/pkg/log"
+	"github.com/cectc/dbpack/pkg/mysql"
 	"github.com/cectc/dbpack/pkg/proto"
+	"github.com/cectc/dbpack/pkg/visitor"
+	"github.com/cectc/dbpack/third_party/parser"
 	"github.com/cectc/dbpack/third_party/parser/ast"
 	"github.com/cectc/dbpack/third_party/parser/format"
 )
@@ -36,15 +39,29 @@ type InsertPlan struct {
 	Stmt     *ast.InsertStmt
 	Args     []interface{}
 	Executor proto.DBGroupExecutor
+	// LastInsertID is the primary key generated by dbpack for the first row, it is
+	// returned to the client as LAST_INSERT_ID instead of the one returned by mysql.
+	LastInsertID uint64
 }
 
-func (p *InsertPlan) Execute(ctx context.Context, _ ...*ast.TableOptimizerHint) (proto.Result, uint16, error) {
+func (p *InsertPlan) Execute(ctx context.Context, hints ...*ast.TableOptimizerHint) (proto.Result, uint16, error) {
+	result, warns, err := p.execute(ctx, hints...)
+	if err != nil {
+		return nil, 0, err
+	}
+	if mysqlResult, ok := result.(*mysql.Result); ok && p.LastInsertID != 0 {
+		mysqlResult.InsertId = p.LastInsertID
+	}
+	return result, warns, nil
+}
+
+func (p *InsertPlan) execute(ctx context.Context, hints ...*ast.TableOptimizerHint) (proto.Result, uint16, error) {
 	var (
 		sb  strings.Builder
 		tx  proto.Tx
 		err error
 	)
-	if err = p.generate(&sb); err != nil {
+	if err = p.generate(&sb, hints...); err != nil {
 		return nil, 0, errors.WithStack(err)
 	}
 	sql := sb.String()
@@ -56,6 +73,19 @@ func (p *InsertPlan) Execute(ctx context.Context, _ ...*ast.TableOptimizerHint)
 			return nil, 0, errors.WithStack(err)
 		}
 		commandType := proto.CommandType(ctx)
+		if len(hints) != 0 {
+			// the distributed transaction filter reads the xid hint and the physical table from the statement
+			stmtNode, err := parser.New().ParseOneStmt(sql, "", "")
+			if err != nil {
+				return nil, 0, errors.WithStack(err)
+			}
+			stmtNode.Accept(&visitor.ParamVisitor{})
+			if commandType == constant.ComQuery {
+				ctx = proto.WithQueryStmt(ctx, stmtNode)
+			} else {
+				ctx = proto.WithPrepareStmt(ctx, generateStatement(sql, stmtNode, p.Args))
+			}
+		}
 		switch commandType {
 		case constant.ComQuery:
 			return tx.Query(ctx, sql)
@@ -77,10 +107,23 @@ func (p *InsertPlan) Execute(ctx context.Context, _ ...*ast.TableOptimizerHint)
 	}
 }
 
-func (p *InsertPlan) generate(sb *strings.Builder) (err error) {
+func (p *InsertPlan) generate(sb *strings.Builder, hints ...*ast.TableOptimizerHint) (err error) {
 	ctx := format.NewRestoreCtx(constant.DBPackRestoreFormat, sb)
 
 	ctx.WriteKeyWord("INSERT ")
+	if len(hints) != 0 {
+		ctx.WritePlain("/*+ ")
+		for i, tableHint := range hints {
+			if i != 0 {
+				ctx.WritePlain(" ")
+			}
+			if err := tableHint.Restore(ctx); err != nil {
+				return errors.Wrapf(err, "An error occurred while restoring InsertStmt.TableHints[%d], HintName: %s",
+					i, tableHint.HintName.String())
+			}
+		}
+		ctx.WritePlain("*/ ")
+	}
 	ctx.WriteKeyWord("INTO ")
 
 	ctx.WritePlain(p.Table)
@@ -115,3 +158,42 @@ func (p *InsertPlan) generate(sb *strings.Builder) (err error) {
 	}
 	return nil
 }
+
+// MultiInsertPlan executes a multi-row insert whose rows are routed to several physical tables,
+// the rows of each physical table are inserted by an InsertPlan. If the statement is not in a
+// transaction, the InsertPlans are executed in a ComplexTx of the configured transaction mode,
+// so that the rows are inserted atomically.
+type MultiInsertPlan struct {
+	Plans []*InsertPlan
+}
+
+func (p *MultiInsertPlan) Execute(ctx context.Context, hints ...*ast.TableOptimizerHint) (proto.Result, uint16, error) {
+	if len(p.Plans) > 1 && proto.ExtractDBGroupTx(ctx) == nil {
+		return executeInComplexTx(ctx, p)
+	}
+
+	var (
+		affectedRows uint64
+		lastInsertID uint64
+		warnings     uint16
+	)
+	for i, pl := range p.Plans {
+		result, warns, err := pl.Execute(ctx, hints...)
+		if err != nil {
+			return nil, 0, err
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return nil, 0, errors.WithStack(err)
+		}
+		// the first plan contains the first row, LAST_INSERT_ID is the id of the first inserted row
+		if i == 0 {
+			if lastInsertID, err = result.LastInsertId(); err != nil {
+				return nil, 0, errors.WithStack(err)
+			}
+		}
+		affectedRows += affected
+		warnings += warns
+	}
+	return &mysql.Result{AffectedRows: affectedRows, InsertId: lastInsertID}, warnings, nil
+}
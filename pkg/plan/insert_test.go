@@ -17,11 +17,17 @@
 package plan
 
 import (
+	"context"
 	"strings"
 	"testing"
 
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 
+	"github.com/cectc/dbpack/pkg/constant"
+	"github.com/cectc/dbpack/pkg/misc"
+	"github.com/cectc/dbpack/pkg/mysql"
+	"github.com/cectc/dbpack/pkg/proto"
 	"github.com/cectc/dbpack/pkg/visitor"
 	"github.com/cectc/dbpack/third_party/parser"
 	"github.com/cectc/dbpack/third_party/parser/ast"
@@ -31,6 +37,7 @@ func TestInsertPlan(t *testing.T) {
 	testCases := []struct {
 		insertSql           string
 		table               string
+		hints               []*ast.TableOptimizerHint
 		expectedGenerateSql string
 	}{
 		{
@@ -38,6 +45,12 @@ func TestInsertPlan(t *testing.T) {
 			table:               "student_5",
 			expectedGenerateSql: "INSERT INTO student_5(id,name,gender,age) VALUES (?,?,?,?)",
 		},
+		{
+			insertSql:           "insert into student(id, name, gender, age) values(?,?,?,?)",
+			table:               "student_5",
+			hints:               []*ast.TableOptimizerHint{misc.NewXIDHint("gs/svc/1")},
+			expectedGenerateSql: "INSERT /*+ XID('gs/svc/1')*/ INTO student_5(id,name,gender,age) VALUES (?,?,?,?)",
+		},
 	}
 
 	for _, c := range testCases {
@@ -59,9 +72,105 @@ func TestInsertPlan(t *testing.T) {
 				Executor: nil,
 			}
 			var sb strings.Builder
-			err = plan.generate(&sb)
+			err = plan.generate(&sb, c.hints...)
 			assert.Nil(t, err)
 			assert.Equal(t, c.expectedGenerateSql, sb.String())
 		})
 	}
 }
+
+type mockInsertExecutor struct {
+	proto.DBGroupExecutor
+	tx   *mockInsertTx
+	fail bool
+}
+
+func (e *mockInsertExecutor) GroupName() string {
+	return "school_0"
+}
+
+func (e *mockInsertExecutor) Begin(ctx context.Context) (proto.Tx, proto.Result, error) {
+	e.tx = &mockInsertTx{fail: e.fail}
+	return e.tx, nil, nil
+}
+
+type mockInsertTx struct {
+	proto.Tx
+	fail       bool
+	sqls       []string
+	args       [][]interface{}
+	committed  bool
+	rollbacked bool
+}
+
+func (tx *mockInsertTx) ExecuteSql(ctx context.Context, sql string, args ...interface{}) (proto.Result, uint16, error) {
+	tx.sqls = append(tx.sqls, sql)
+	tx.args = append(tx.args, args)
+	if tx.fail && len(tx.sqls) > 1 {
+		return nil, 0, errors.New("duplicate entry")
+	}
+	return &mysql.Result{AffectedRows: uint64(len(args) / 2)}, 0, nil
+}
+
+func (tx *mockInsertTx) Commit(ctx context.Context) (proto.Result, error) {
+	tx.committed = true
+	return nil, nil
+}
+
+func (tx *mockInsertTx) Rollback(ctx context.Context, stmt *ast.RollbackStmt) (proto.Result, error) {
+	tx.rollbacked = true
+	return nil, nil
+}
+
+func TestMultiInsertPlan(t *testing.T) {
+	stmt, err := parser.New().ParseOneStmt("insert into student(id, name) values (?, ?), (?, ?), (?, ?)", "", "")
+	assert.Nil(t, err)
+	stmt.Accept(&visitor.ParamVisitor{})
+	insertStmt := stmt.(*ast.InsertStmt)
+	first, second := *insertStmt, *insertStmt
+	first.Lists = [][]ast.ExprNode{insertStmt.Lists[0], insertStmt.Lists[2]}
+	second.Lists = [][]ast.ExprNode{insertStmt.Lists[1]}
+
+	executor := &mockInsertExecutor{}
+	p := &MultiInsertPlan{
+		Plans: []*InsertPlan{
+			{
+				Database:     "school_0",
+				Table:        "student_1",
+				Columns:      []string{"id", "name"},
+				Stmt:         &first,
+				Args:         []interface{}{1, "scott", 101, "lily"},
+				Executor:     executor,
+				LastInsertID: 1,
+			},
+			{
+				Database: "school_0",
+				Table:    "student_2",
+				Columns:  []string{"id", "name"},
+				Stmt:     &second,
+				Args:     []interface{}{2, "jack"},
+				Executor: executor,
+			},
+		},
+	}
+	ctx := proto.WithCommandType(context.Background(), constant.ComStmtExecute)
+	result, _, err := p.Execute(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		"INSERT INTO student_1(id,name) VALUES (?,?),(?,?)",
+		"INSERT INTO student_2(id,name) VALUES (?,?)",
+	}, executor.tx.sqls)
+	assert.Equal(t, [][]interface{}{{1, "scott", 101, "lily"}, {2, "jack"}}, executor.tx.args)
+	assert.True(t, executor.tx.committed)
+	affected, _ := result.RowsAffected()
+	assert.Equal(t, uint64(3), affected)
+	lastInsertID, _ := result.LastInsertId()
+	assert.Equal(t, uint64(1), lastInsertID)
+
+	// the rows inserted are rolled back if any InsertPlan fails
+	executor.fail = true
+	_, _, err = p.Execute(ctx)
+	assert.NotNil(t, err)
+	assert.False(t, executor.tx.committed)
+	assert.True(t, executor.tx.rollbacked)
+}
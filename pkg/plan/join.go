@@ -0,0 +1,474 @@
+/*
+ * Copyright 2022 CECTC, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package plan
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/cectc/dbpack/pkg/constant"
+	"github.com/cectc/dbpack/pkg/misc"
+	"github.com/cectc/dbpack/pkg/mysql"
+	"github.com/cectc/dbpack/pkg/proto"
+	"github.com/cectc/dbpack/third_party/parser/ast"
+	driver "github.com/cectc/dbpack/third_party/types/parser_driver"
+)
+
+// JoinTable is one side of a JoinPlan.
+type JoinTable struct {
+	// Name is the table alias or table name used to qualify columns
+	Name string
+	Plan proto.Plan
+}
+
+// JoinPlan joins two logic tables which are not located on the same shards,
+// the rows of each table are fetched by their own plan, then joined by dbpack.
+// If the join has equal conditions, a hash join is used, otherwise a nested loop join.
+type JoinPlan struct {
+	Stmt     *ast.SelectStmt
+	JoinType ast.JoinType
+	Left     *JoinTable
+	Right    *JoinTable
+	// LeftKeys[i] = RightKeys[i]
+	LeftKeys  []string
+	RightKeys []string
+	Args      []interface{}
+}
+
+type joinedResult struct {
+	leftFields  []*mysql.Field
+	rightFields []*mysql.Field
+	rows        [][]*proto.Value
+}
+
+func (p *JoinPlan) Execute(ctx context.Context, _ ...*ast.TableOptimizerHint) (proto.Result, uint16, error) {
+	results := make([]*ResultWithErr, 2)
+	var wg sync.WaitGroup
+	wg.Add(2)
+	for i, table := range []*JoinTable{p.Left, p.Right} {
+		go func(i int, table *JoinTable) {
+			defer wg.Done()
+			result, warn, err := table.Plan.Execute(ctx)
+			results[i] = &ResultWithErr{
+				Database: table.Name,
+				Result:   result,
+				Warning:  warn,
+				Error:    err,
+			}
+		}(i, table)
+	}
+	wg.Wait()
+
+	var warning uint16
+	for _, rlt := range results {
+		if rlt.Error != nil {
+			return nil, 0, rlt.Error
+		}
+		warning += rlt.Warning
+	}
+	leftResult, ok := results[0].Result.(*mysql.Result)
+	if !ok {
+		return nil, 0, errors.Errorf("unexpected result type of table %s", p.Left.Name)
+	}
+	rightResult, ok := results[1].Result.(*mysql.Result)
+	if !ok {
+		return nil, 0, errors.Errorf("unexpected result type of table %s", p.Right.Name)
+	}
+
+	joined, err := p.join(leftResult, rightResult)
+	if err != nil {
+		return nil, 0, err
+	}
+	if err = p.orderBy(joined); err != nil {
+		return nil, 0, err
+	}
+	if err = p.limit(joined); err != nil {
+		return nil, 0, err
+	}
+	fields, indexes, err := p.project(joined)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	commandType := proto.CommandType(ctx)
+	rows := make([]proto.Row, 0, len(joined.rows))
+	for _, values := range joined.rows {
+		projected := make([]*proto.Value, 0, len(indexes))
+		for _, index := range indexes {
+			projected = append(projected, values[index])
+		}
+		if commandType == constant.ComStmtExecute {
+			rows = append(rows, mysql.NewBinaryRow(fields, projected))
+		} else {
+			rows = append(rows, mysql.NewTextRow(fields, projected))
+		}
+	}
+	return &mysql.Result{
+		Fields: fields,
+		Rows:   rows,
+	}, warning, nil
+}
+
+func (p *JoinPlan) join(leftResult, rightResult *mysql.Result) (*joinedResult, error) {
+	leftRows, err := decodeRows(leftResult)
+	if err != nil {
+		return nil, err
+	}
+	rightRows, err := decodeRows(rightResult)
+	if err != nil {
+		return nil, err
+	}
+	joined := &joinedResult{
+		leftFields:  leftResult.Fields,
+		rightFields: rightResult.Fields,
+	}
+
+	leftKeyIndexes, err := fieldIndexes(leftResult.Fields, p.LeftKeys)
+	if err != nil {
+		return nil, err
+	}
+	rightKeyIndexes, err := fieldIndexes(rightResult.Fields, p.RightKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	// the outer side of the join is probed, the other side is used to build the hash table
+	var (
+		outerRows, innerRows       [][]*proto.Value
+		outerIndexes, innerIndexes []int
+		outerIsLeft                = true
+		keepUnmatched              = false
+	)
+	switch p.JoinType {
+	case ast.RightJoin:
+		outerRows, innerRows = rightRows, leftRows
+		outerIndexes, innerIndexes = rightKeyIndexes, leftKeyIndexes
+		outerIsLeft = false
+		keepUnmatched = true
+	case ast.LeftJoin:
+		outerRows, innerRows = leftRows, rightRows
+		outerIndexes, innerIndexes = leftKeyIndexes, rightKeyIndexes
+		keepUnmatched = true
+	default:
+		outerRows, innerRows = leftRows, rightRows
+		outerIndexes, innerIndexes = leftKeyIndexes, rightKeyIndexes
+	}
+	innerWidth := len(rightResult.Fields)
+	if !outerIsLeft {
+		innerWidth = len(leftResult.Fields)
+	}
+
+	combine := func(outer, inner []*proto.Value) []*proto.Value {
+		if inner == nil {
+			inner = make([]*proto.Value, innerWidth)
+		}
+		row := make([]*proto.Value, 0, len(outer)+len(inner))
+		if outerIsLeft {
+			row = append(row, outer...)
+			return append(row, inner...)
+		}
+		row = append(row, inner...)
+		return append(row, outer...)
+	}
+
+	if len(outerIndexes) == 0 {
+		// nested loop join
+		for _, outer := range outerRows {
+			for _, inner := range innerRows {
+				joined.rows = append(joined.rows, combine(outer, inner))
+			}
+			if len(innerRows) == 0 && keepUnmatched {
+				joined.rows = append(joined.rows, combine(outer, nil))
+			}
+		}
+		return joined, nil
+	}
+
+	// hash join
+	hashTable := make(map[string][][]*proto.Value, len(innerRows))
+	for _, inner := range innerRows {
+		key, ok := joinKey(inner, innerIndexes)
+		if !ok {
+			continue
+		}
+		hashTable[key] = append(hashTable[key], inner)
+	}
+	for _, outer := range outerRows {
+		var matched [][]*proto.Value
+		if key, ok := joinKey(outer, outerIndexes); ok {
+			matched = hashTable[key]
+		}
+		for _, inner := range matched {
+			joined.rows = append(joined.rows, combine(outer, inner))
+		}
+		if len(matched) == 0 && keepUnmatched {
+			joined.rows = append(joined.rows, combine(outer, nil))
+		}
+	}
+	return joined, nil
+}
+
+func (p *JoinPlan) orderBy(joined *joinedResult) error {
+	if p.Stmt.OrderBy == nil {
+		return nil
+	}
+	var (
+		indexes = make([]int, 0, len(p.Stmt.OrderBy.Items))
+		desc    = make([]bool, 0, len(p.Stmt.OrderBy.Items))
+	)
+	for _, item := range p.Stmt.OrderBy.Items {
+		column, ok := item.Expr.(*ast.ColumnNameExpr)
+		if !ok {
+			return errors.New("cross shard join only support order by columns")
+		}
+		index, err := p.resolveOrderByColumn(joined, column.Name)
+		if err != nil {
+			return err
+		}
+		indexes = append(indexes, index)
+		desc = append(desc, item.Desc)
+	}
+	sort.SliceStable(joined.rows, func(i, j int) bool {
+		for k, index := range indexes {
+			result := compareValue(joined.rows[i][index], joined.rows[j][index])
+			if result == 0 {
+				continue
+			}
+			if desc[k] {
+				return result > 0
+			}
+			return result < 0
+		}
+		return false
+	})
+	return nil
+}
+
+func (p *JoinPlan) limit(joined *joinedResult) error {
+	if p.Stmt.Limit == nil {
+		return nil
+	}
+	offset, err := limitValue(p.Stmt.Limit.Offset, p.Args)
+	if err != nil {
+		return err
+	}
+	count, err := limitValue(p.Stmt.Limit.Count, p.Args)
+	if err != nil {
+		return err
+	}
+	total := int64(len(joined.rows))
+	if offset >= total {
+		joined.rows = joined.rows[:0]
+		return nil
+	}
+	end := offset + count
+	if end > total {
+		end = total
+	}
+	joined.rows = joined.rows[offset:end]
+	return nil
+}
+
+// project returns the result fields and the indexes of their values in joined rows
+func (p *JoinPlan) project(joined *joinedResult) ([]*mysql.Field, []int, error) {
+	var (
+		fields  []*mysql.Field
+		indexes []int
+	)
+	leftWidth := len(joined.leftFields)
+	for _, field := range p.Stmt.Fields.Fields {
+		if field.WildCard != nil {
+			table := field.WildCard.Table.String()
+			if table == "" || strings.EqualFold(table, p.Left.Name) {
+				for i, fd := range joined.leftFields {
+					fields = append(fields, fd)
+					indexes = append(indexes, i)
+				}
+			}
+			if table == "" || strings.EqualFold(table, p.Right.Name) {
+				for i, fd := range joined.rightFields {
+					fields = append(fields, fd)
+					indexes = append(indexes, leftWidth+i)
+				}
+			}
+			continue
+		}
+		column, ok := field.Expr.(*ast.ColumnNameExpr)
+		if !ok {
+			return nil, nil, errors.New("cross shard join only support selecting columns")
+		}
+		index, err := p.resolveColumn(joined, column.Name)
+		if err != nil {
+			return nil, nil, err
+		}
+		var fd mysql.Field
+		if index < leftWidth {
+			fd = *joined.leftFields[index]
+		} else {
+			fd = *joined.rightFields[index-leftWidth]
+		}
+		if field.AsName.String() != "" {
+			fd.Name = field.AsName.String()
+		}
+		fields = append(fields, &fd)
+		indexes = append(indexes, index)
+	}
+	return fields, indexes, nil
+}
+
+func (p *JoinPlan) resolveOrderByColumn(joined *joinedResult, column *ast.ColumnName) (int, error) {
+	if column.Table.String() == "" {
+		for _, field := range p.Stmt.Fields.Fields {
+			if field.AsName.String() == "" || !strings.EqualFold(field.AsName.String(), column.Name.String()) {
+				continue
+			}
+			if expr, ok := field.Expr.(*ast.ColumnNameExpr); ok {
+				return p.resolveColumn(joined, expr.Name)
+			}
+		}
+	}
+	return p.resolveColumn(joined, column)
+}
+
+func (p *JoinPlan) resolveColumn(joined *joinedResult, column *ast.ColumnName) (int, error) {
+	table := column.Table.String()
+	name := column.Name.String()
+	leftIndex, rightIndex := -1, -1
+	if table == "" || strings.EqualFold(table, p.Left.Name) {
+		leftIndex = fieldIndex(joined.leftFields, name)
+	}
+	if table == "" || strings.EqualFold(table, p.Right.Name) {
+		rightIndex = fieldIndex(joined.rightFields, name)
+	}
+	switch {
+	case leftIndex >= 0 && rightIndex >= 0:
+		return 0, errors.Errorf("column '%s' in field list is ambiguous", name)
+	case leftIndex >= 0:
+		return leftIndex, nil
+	case rightIndex >= 0:
+		return len(joined.leftFields) + rightIndex, nil
+	}
+	return 0, errors.Errorf("unknown column '%s'", column.String())
+}
+
+func decodeRows(result *mysql.Result) ([][]*proto.Value, error) {
+	rows := make([][]*proto.Value, 0, len(result.Rows))
+	for _, row := range result.Rows {
+		values, err := row.Decode()
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, values)
+	}
+	return rows, nil
+}
+
+func fieldIndex(fields []*mysql.Field, name string) int {
+	for i, field := range fields {
+		if strings.EqualFold(field.Name, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+func fieldIndexes(fields []*mysql.Field, names []string) ([]int, error) {
+	indexes := make([]int, 0, len(names))
+	for _, name := range names {
+		index := fieldIndex(fields, name)
+		if index < 0 {
+			return nil, errors.Errorf("unknown join column '%s'", name)
+		}
+		indexes = append(indexes, index)
+	}
+	return indexes, nil
+}
+
+// joinKey returns the hash key of a row, the second return value is false if any key is null,
+// as null never equals to anything.
+func joinKey(row []*proto.Value, indexes []int) (string, bool) {
+	var sb strings.Builder
+	for i, index := range indexes {
+		value := row[index]
+		if value == nil || value.Val == nil {
+			return "", false
+		}
+		if i != 0 {
+			sb.WriteByte(0)
+		}
+		switch val := value.Val.(type) {
+		case []byte:
+			sb.Write(val)
+		default:
+			sb.WriteString(fmt.Sprintf("%v", val))
+		}
+	}
+	return sb.String(), true
+}
+
+func compareValue(v1, v2 *proto.Value) int {
+	if v1 == nil || v1.Val == nil {
+		if v2 == nil || v2.Val == nil {
+			return 0
+		}
+		return -1
+	}
+	if v2 == nil || v2.Val == nil {
+		return 1
+	}
+	val1, val2 := v1.Val, v2.Val
+	b1, ok1 := val1.([]byte)
+	b2, ok2 := val2.([]byte)
+	if ok1 && ok2 {
+		if !isNumericType(v1.Typ) {
+			return strings.Compare(string(b1), string(b2))
+		}
+		// text protocol and decimal values of numeric columns
+		f1, err1 := strconv.ParseFloat(string(b1), 64)
+		f2, err2 := strconv.ParseFloat(string(b2), 64)
+		if err1 == nil && err2 == nil {
+			switch {
+			case f1 > f2:
+				return 1
+			case f1 < f2:
+				return -1
+			default:
+				return 0
+			}
+		}
+		return strings.Compare(string(b1), string(b2))
+	}
+	return misc.Compare(val1, val2)
+}
+
+func limitValue(expr ast.ExprNode, args []interface{}) (int64, error) {
+	switch val := expr.(type) {
+	case nil:
+		return 0, nil
+	case *driver.ValueExpr:
+		return val.GetInt64(), nil
+	case *driver.ParamMarkerExpr:
+		return strconv.ParseInt(fmt.Sprintf("%v", args[val.Order]), 10, 64)
+	}
+	return 0, errors.Errorf("unsupported limit expression %T", expr)
+}
@@ -0,0 +1,151 @@
+/*
+ * Copyright 2022 CECTC, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package plan
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/cectc/dbpack/pkg/mysql"
+	"github.com/cectc/dbpack/pkg/proto"
+	"github.com/cectc/dbpack/pkg/visitor"
+	"github.com/cectc/dbpack/third_party/parser"
+	"github.com/cectc/dbpack/third_party/parser/ast"
+)
+
+type resultPlan struct {
+	result *mysql.Result
+}
+
+func (p *resultPlan) Execute(ctx context.Context, _ ...*ast.TableOptimizerHint) (proto.Result, uint16, error) {
+	return p.result, 0, nil
+}
+
+func newTextResult(columns []string, rows ...[]interface{}) *mysql.Result {
+	fields := make([]*mysql.Field, 0, len(columns))
+	for _, column := range columns {
+		fields = append(fields, &mysql.Field{Name: column})
+	}
+	result := &mysql.Result{Fields: fields}
+	for _, row := range rows {
+		values := make([]*proto.Value, 0, len(row))
+		for _, val := range row {
+			if val == nil {
+				values = append(values, nil)
+				continue
+			}
+			values = append(values, &proto.Value{Val: []byte(val.(string))})
+		}
+		result.Rows = append(result.Rows, mysql.NewTextRow(fields, values))
+	}
+	return result
+}
+
+func TestJoinPlan(t *testing.T) {
+	orders := newTextResult([]string{"id", "user_id"},
+		[]interface{}{"1", "10"},
+		[]interface{}{"2", "9"},
+		[]interface{}{"3", "11"},
+		[]interface{}{"4", nil},
+	)
+	items := newTextResult([]string{"id", "order_id", "sku"},
+		[]interface{}{"100", "1", "apple"},
+		[]interface{}{"101", "1", "banana"},
+		[]interface{}{"102", "3", "cherry"},
+	)
+
+	testCases := []struct {
+		sql      string
+		args     []interface{}
+		joinType ast.JoinType
+		columns  []string
+		expected [][]interface{}
+	}{
+		{
+			sql:      "select o.id, i.sku as name from orders o join order_item i on o.id = i.order_id order by i.id desc",
+			joinType: ast.CrossJoin,
+			columns:  []string{"id", "name"},
+			expected: [][]interface{}{{"3", "cherry"}, {"1", "banana"}, {"1", "apple"}},
+		},
+		{
+			sql:      "select o.*, sku from orders o left join order_item i on o.id = i.order_id order by o.user_id limit 1, 3",
+			joinType: ast.LeftJoin,
+			columns:  []string{"id", "user_id", "sku"},
+			expected: [][]interface{}{{"2", "9", nil}, {"1", "10", "apple"}, {"1", "10", "banana"}},
+		},
+		{
+			sql:      "select i.id, o.id from orders o right join order_item i on o.id = i.order_id order by i.id",
+			joinType: ast.RightJoin,
+			columns:  []string{"id", "id"},
+			expected: [][]interface{}{{"100", "1"}, {"101", "1"}, {"102", "3"}},
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.sql, func(t *testing.T) {
+			stmt, err := parser.New().ParseOneStmt(c.sql, "", "")
+			assert.Nil(t, err)
+			stmt.Accept(&visitor.ParamVisitor{})
+			selectStmt := stmt.(*ast.SelectStmt)
+			p := &JoinPlan{
+				Stmt:      selectStmt,
+				JoinType:  c.joinType,
+				Left:      &JoinTable{Name: "o", Plan: &resultPlan{result: orders}},
+				Right:     &JoinTable{Name: "i", Plan: &resultPlan{result: items}},
+				LeftKeys:  []string{"id"},
+				RightKeys: []string{"order_id"},
+				Args:      c.args,
+			}
+			result, _, err := p.Execute(context.Background())
+			assert.Nil(t, err)
+			rlt := result.(*mysql.Result)
+			columns := make([]string, 0, len(rlt.Fields))
+			for _, field := range rlt.Fields {
+				columns = append(columns, field.Name)
+			}
+			assert.Equal(t, c.columns, columns)
+			assert.Equal(t, len(c.expected), len(rlt.Rows))
+			for i, row := range rlt.Rows {
+				values, err := row.Decode()
+				assert.Nil(t, err)
+				for j, value := range values {
+					if c.expected[i][j] == nil {
+						assert.Nil(t, value)
+						continue
+					}
+					assert.Equal(t, c.expected[i][j], string(value.Val.([]byte)))
+				}
+			}
+		})
+	}
+}
+
+func TestJoinPlanAmbiguousColumn(t *testing.T) {
+	stmt, err := parser.New().ParseOneStmt("select id from orders o join order_item i on o.id = i.order_id", "", "")
+	assert.Nil(t, err)
+	p := &JoinPlan{
+		Stmt:      stmt.(*ast.SelectStmt),
+		Left:      &JoinTable{Name: "o", Plan: &resultPlan{result: newTextResult([]string{"id"}, []interface{}{"1"})}},
+		Right:     &JoinTable{Name: "i", Plan: &resultPlan{result: newTextResult([]string{"id", "order_id"}, []interface{}{"2", "1"})}},
+		LeftKeys:  []string{"id"},
+		RightKeys: []string{"order_id"},
+	}
+	_, _, err = p.Execute(context.Background())
+	assert.NotNil(t, err)
+}
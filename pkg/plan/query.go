@@ -30,6 +30,7 @@ import (
 	"github.com/cectc/dbpack/pkg/cond"
 	"github.com/cectc/dbpack/pkg/constant"
 	"github.com/cectc/dbpack/pkg/log"
+	"github.com/cectc/dbpack/pkg/mysql"
 	"github.com/cectc/dbpack/pkg/proto"
 	"github.com/cectc/dbpack/pkg/visitor"
 	"github.com/cectc/dbpack/third_party/parser/ast"
@@ -100,6 +101,11 @@ func (p *QueryOnSingleDBPlan) Execute(ctx context.Context, hints ...*ast.TableOp
 	}
 }
 
+// ExecuteStream executes the plan, the rows of the result set are streamed from the backend.
+func (p *QueryOnSingleDBPlan) ExecuteStream(ctx context.Context, hints ...*ast.TableOptimizerHint) (proto.Result, uint16, error) {
+	return p.Execute(proto.WithStreaming(ctx), hints...)
+}
+
 func (p *QueryOnSingleDBPlan) generate(ctx context.Context, sb *strings.Builder, args *[]interface{}) (err error) {
 	stmtVal := deepcopy.Copy(p.Stmt)
 	stmt := stmtVal.(*ast.SelectStmt)
@@ -149,7 +155,7 @@ func (p *QueryOnSingleDBPlan) generate(ctx context.Context, sb *strings.Builder,
 			if funcColumns != nil {
 				funcColumnList = funcColumns.([]*visitor.FuncColumn)
 			}
-			if len(funcColumnList) == 0 {
+			if len(funcColumnList) == 0 && stmt.GroupBy == nil {
 				sb.WriteString(fmt.Sprintf("ORDER BY `t`.`%s` ASC", p.PK))
 			}
 		}
@@ -238,10 +244,60 @@ func (p *QueryOnMultiDBPlan) Execute(ctx context.Context, _ ...*ast.TableOptimiz
 	}
 	sort.Sort(ResultWithErrs(resultList))
 	result, warn := mergeResult(ctx, resultList, p.Stmt.OrderBy, p.Plans[0].Limit)
-	aggregateResult(ctx, result)
 	return result, warn, nil
 }
 
+// ExecuteStream streams the result sets of the sub plans, and merges them with a k-way merge
+// when the query is ordered, other queries fall back to Execute.
+func (p *QueryOnMultiDBPlan) ExecuteStream(ctx context.Context, hints ...*ast.TableOptimizerHint) (proto.Result, uint16, error) {
+	funcColumns := visitFuncColumn(p.Stmt)
+	if p.Stmt.OrderBy == nil || p.Stmt.GroupBy != nil || len(funcColumns) != 0 {
+		return p.Execute(ctx, hints...)
+	}
+	proto.WithVariable(ctx, FuncColumns, funcColumns)
+	resultChan := make(chan *ResultWithErr, len(p.Plans))
+	var wg sync.WaitGroup
+	wg.Add(len(p.Plans))
+	for _, plan := range p.Plans {
+		go func(plan *QueryOnSingleDBPlan) {
+			result, warn, err := plan.ExecuteStream(ctx)
+			resultChan <- &ResultWithErr{
+				Database: plan.Database,
+				Result:   result,
+				Warning:  warn,
+				Error:    err,
+			}
+			wg.Done()
+		}(plan)
+	}
+	wg.Wait()
+	close(resultChan)
+
+	var err error
+	resultList := make([]*ResultWithErr, 0, len(p.Plans))
+	for rlt := range resultChan {
+		if rlt.Error != nil {
+			if err == nil {
+				err = rlt.Error
+			}
+			continue
+		}
+		resultList = append(resultList, rlt)
+	}
+	if err != nil {
+		for _, rlt := range resultList {
+			if stream, ok := rlt.Result.(*mysql.StreamResult); ok {
+				if closeErr := stream.Rows.Close(); closeErr != nil {
+					log.Error(closeErr)
+				}
+			}
+		}
+		return nil, 0, err
+	}
+	sort.Sort(ResultWithErrs(resultList))
+	return mergeStreamResults(resultList, p.Stmt.OrderBy, p.Plans[0].Limit), 0, nil
+}
+
 func (p *QueryOnSingleDBPlan) generateSelect(table string, stmt *ast.SelectStmt, sb *strings.Builder, limit *Limit) error {
 	vi := &JoinVisitor{
 		fieldList:    stmt.Fields,
@@ -382,8 +438,8 @@ func (s *JoinVisitor) Leave(n ast.Node) (node ast.Node, ok bool) {
 		if secondAlgo, found := s.algorithms[strings.ToLower(secondTable.Name.O)]; found {
 			if firstAlgo, exists := s.algorithms[strings.ToLower(firstTable.Name.O)]; exists {
 				if firstAlgo.Equal(secondAlgo) {
-					index := strings.LastIndex(s.table, "_")
-					joinTable := fmt.Sprintf("%s_%s", secondAlgo.Topology().TableName, s.table[index+1:])
+					index, _ := firstAlgo.Topology().TableIndex(s.table)
+					joinTable := secondAlgo.Topology().TableIndexMap[index]
 
 					if from.TableRefs.On != nil {
 						visitor1 := &ColumnNameVisitor{
@@ -20,14 +20,10 @@ import (
 	"context"
 	"fmt"
 	"sort"
-	"strconv"
 	"strings"
 	"time"
 
-	"github.com/pkg/errors"
-
 	"github.com/cectc/dbpack/pkg/log"
-	"github.com/cectc/dbpack/pkg/misc"
 	"github.com/cectc/dbpack/pkg/mysql"
 	"github.com/cectc/dbpack/pkg/proto"
 	"github.com/cectc/dbpack/pkg/visitor"
@@ -74,16 +70,21 @@ type OrderByCells []*OrderByCell
 func (c OrderByCells) Len() int { return len(c) }
 
 func (c OrderByCells) Less(i, j int) bool {
+	return lessOrderFields(c[i].orderField, c[j].orderField)
+}
+
+// lessOrderFields reports whether the row with order fields a sorts before the row with order fields b.
+func lessOrderFields(a, b []*OrderField) bool {
 	var (
 		index = 0
 		res   int
 	)
-	for index < len(c[i].orderField) {
-		isAsc := c[i].orderField[index].asc
+	for index < len(a) {
+		isAsc := a[index].asc
 		if isAsc {
-			res = compare(c[j].orderField[index].value, c[i].orderField[index].value)
+			res = compare(b[index].value, a[index].value)
 		} else {
-			res = compare(c[i].orderField[index].value, c[j].orderField[index].value)
+			res = compare(a[index].value, b[index].value)
 		}
 		if res != 0 {
 			return res > 0
@@ -453,50 +454,6 @@ func mergeResultWithOrderBy(ctx context.Context,
 	return result, warning
 }
 
-func aggregateResult(ctx context.Context, result *mysql.Result) {
-	sqlText := proto.SqlText(ctx)
-	funcColumns := proto.Variable(ctx, FuncColumns)
-	if funcColumns == nil {
-		return
-	}
-	funcColumnList := funcColumns.([]*visitor.FuncColumn)
-	if len(funcColumnList) == 0 {
-		return
-	}
-	if len(funcColumnList) > 1 {
-		log.Warnf("unsupported multiple aggregated columns, sql: %s", sqlText)
-	}
-	switch funcColumnList[0].FuncName {
-	case ast.AggFuncCount:
-		var count int64 = 0
-		for _, row := range result.Rows {
-			val, err := castCountCellToInt64(row)
-			if err != nil {
-				log.Warn(err)
-				return
-			}
-			count += val
-		}
-		if err := writeCountToRow(result.Rows[0], count); err != nil {
-			log.Warn(err)
-			return
-		}
-		result.Rows = []proto.Row{
-			result.Rows[0],
-		}
-	case ast.AggFuncSum:
-		// todo
-	case ast.AggFuncAvg:
-		// todo
-	case ast.AggFuncMin:
-		// todo
-	case ast.AggFuncMax:
-		// todo
-	default:
-		log.Warnf("unsupported aggregate type, sql: %s", sqlText)
-	}
-}
-
 func countOrderByCells(cells []*OrderByCell) int {
 	count := 0
 	for _, cell := range cells {
@@ -574,35 +531,3 @@ func visitFuncColumn(stmt *ast.SelectStmt) []*visitor.FuncColumn {
 	stmt.Accept(funcVisitor)
 	return funcVisitor.FuncColumns
 }
-
-func castCountCellToInt64(row proto.Row) (int64, error) {
-	switch r := row.(type) {
-	case *mysql.TextRow:
-		val, err := strconv.ParseInt(fmt.Sprintf("%s", r.Values[0].Val), 10, 64)
-		if err != nil {
-			return 0, err
-		}
-		return val, nil
-	case *mysql.BinaryRow:
-		if v, ok := r.Values[0].Val.(int64); ok {
-			return v, nil
-		}
-		return 0, errors.New("count column value must be of type int64")
-	default:
-		return 0, errors.New("unsupported row type")
-	}
-}
-
-func writeCountToRow(row proto.Row, count int64) error {
-	switch r := row.(type) {
-	case *mysql.TextRow:
-		var out []byte
-		misc.WriteUint64(out, 0, uint64(count))
-		r.Values[0].Val = out
-	case *mysql.BinaryRow:
-		r.Values[0].Val = count
-	default:
-		return errors.New("unsupported row type")
-	}
-	return nil
-}
@@ -0,0 +1,365 @@
+/*
+ * Copyright 2022 CECTC, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package plan
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/cectc/dbpack/pkg/cond"
+	"github.com/cectc/dbpack/pkg/constant"
+	"github.com/cectc/dbpack/pkg/log"
+	"github.com/cectc/dbpack/pkg/mysql"
+	"github.com/cectc/dbpack/pkg/proto"
+	"github.com/cectc/dbpack/pkg/visitor"
+	"github.com/cectc/dbpack/third_party/parser"
+	"github.com/cectc/dbpack/third_party/parser/ast"
+	"github.com/cectc/dbpack/third_party/parser/format"
+	"github.com/cectc/dbpack/third_party/parser/opcode"
+	driver "github.com/cectc/dbpack/third_party/types/parser_driver"
+)
+
+// ShardingKeyUpdatePlan updates the sharding key of rows. The new sharding key may route a row
+// to another physical table, so the rows are moved instead of updated in place: the matched rows
+// are selected for update with their new values computed by mysql, deleted from the old tables,
+// then inserted into the tables routed by the new values. The ORDER BY and LIMIT of the update
+// statement apply to the rows selected and deleted of each physical table. All the statements are
+// executed in a ComplexTx, if the statement is not in a transaction, it is executed in a ComplexTx
+// of the configured transaction mode, which is committed after the rows are moved, and rolled back
+// if any statement fails.
+type ShardingKeyUpdatePlan struct {
+	Stmt *ast.UpdateStmt
+	Args []interface{}
+	// dbName -> physical tables matched by the where condition
+	Shards    map[string][]string
+	Algorithm cond.ShardingAlgorithm
+	// dbName -> DBGroupExecutor
+	Executors map[string]proto.DBGroupExecutor
+}
+
+// movedRows is the rows moved to the same physical table
+type movedRows struct {
+	database string
+	table    string
+	columns  []string
+	rows     [][]interface{}
+}
+
+func (p *ShardingKeyUpdatePlan) Execute(ctx context.Context, hints ...*ast.TableOptimizerHint) (result proto.Result, warnings uint16, err error) {
+	var (
+		affectedRows uint64
+		moves        []*movedRows
+	)
+	complexTx := proto.ExtractDBGroupTx(ctx)
+	if complexTx == nil {
+		return executeInComplexTx(ctx, p)
+	}
+
+	// the parameters of the set list come before the parameters of the where condition
+	var whereArgs []interface{}
+	if len(p.Args) != 0 {
+		counter := &paramMarkerCounter{}
+		for _, assignment := range p.Stmt.List {
+			assignment.Expr.Accept(counter)
+		}
+		whereArgs = p.Args[counter.count:]
+	}
+
+	databases := make([]string, 0, len(p.Shards))
+	for database := range p.Shards {
+		databases = append(databases, database)
+	}
+	sort.Strings(databases)
+
+	// all the matched rows are deleted before inserting, otherwise a row moved to a table
+	// matched by the where condition would be deleted again.
+	for _, database := range databases {
+		executor, exists := p.Executors[database]
+		if !exists {
+			return nil, 0, errors.Errorf("db group %s should not be nil", database)
+		}
+		for _, table := range p.Shards[database] {
+			columns, rows, warns, err := p.selectForUpdate(ctx, complexTx, executor, table)
+			if err != nil {
+				return nil, 0, err
+			}
+			warnings += warns
+			if len(rows) == 0 {
+				continue
+			}
+			deletePlan := &DeletePlan{
+				Database: database,
+				Tables:   []string{table},
+				Stmt: &ast.DeleteStmt{
+					Where: p.Stmt.Where,
+					Order: p.Stmt.Order,
+					Limit: p.Stmt.Limit,
+				},
+				Args:     whereArgs,
+				Executor: executor,
+			}
+			if _, warns, err = deletePlan.Execute(ctx, hints...); err != nil {
+				return nil, 0, err
+			}
+			warnings += warns
+
+			for _, row := range rows {
+				targetDB, targetTable, err := p.route(columns, row)
+				if err != nil {
+					return nil, 0, err
+				}
+				var move *movedRows
+				for _, m := range moves {
+					if m.database == targetDB && m.table == targetTable {
+						move = m
+						break
+					}
+				}
+				if move == nil {
+					move = &movedRows{database: targetDB, table: targetTable, columns: columns}
+					moves = append(moves, move)
+				}
+				move.rows = append(move.rows, row)
+			}
+			affectedRows += uint64(len(rows))
+		}
+	}
+
+	for _, move := range moves {
+		executor, exists := p.Executors[move.database]
+		if !exists {
+			return nil, 0, errors.Errorf("db group %s should not be nil", move.database)
+		}
+		insertPlan := move.insertPlan(executor)
+		log.Debugf("move rows of sharding key update, db name: %s, table: %s, rows: %d",
+			move.database, move.table, len(move.rows))
+		// the values are bound as parameters, whatever the command type of the update statement is
+		_, warns, err := insertPlan.Execute(proto.WithCommandType(ctx, constant.ComStmtExecute), hints...)
+		if err != nil {
+			return nil, 0, err
+		}
+		warnings += warns
+	}
+	return &mysql.Result{AffectedRows: affectedRows}, warnings, nil
+}
+
+// selectForUpdate locks the matched rows of the physical table, returns the columns of the table
+// and the rows with the assignments of the set list applied.
+func (p *ShardingKeyUpdatePlan) selectForUpdate(ctx context.Context, complexTx proto.DBGroupTx,
+	executor proto.DBGroupExecutor, table string) ([]string, [][]interface{}, uint16, error) {
+	var (
+		sb     strings.Builder
+		result proto.Result
+		warns  uint16
+	)
+	if err := p.generateSelect(&sb, table); err != nil {
+		return nil, nil, 0, errors.Wrap(err, "failed to generate sql for sharding key update")
+	}
+	sql := sb.String()
+	log.Debugf("select rows of sharding key update, db name: %s, sql: %s", executor.GroupName(), sql)
+
+	tx, err := complexTx.Begin(ctx, executor)
+	if err != nil {
+		return nil, nil, 0, errors.WithStack(err)
+	}
+	stmtNode, err := parser.New().ParseOneStmt(sql, "", "")
+	if err != nil {
+		return nil, nil, 0, errors.WithStack(err)
+	}
+	stmtNode.Accept(&visitor.ParamVisitor{})
+	switch proto.CommandType(ctx) {
+	case constant.ComQuery:
+		result, warns, err = tx.Query(proto.WithQueryStmt(ctx, stmtNode), sql)
+	case constant.ComStmtExecute:
+		stmt := generateStatement(sql, stmtNode, p.Args)
+		result, warns, err = tx.ExecuteSql(proto.WithPrepareStmt(ctx, stmt), sql, p.Args...)
+	default:
+		return nil, nil, 0, nil
+	}
+	if err != nil {
+		return nil, nil, 0, errors.WithStack(err)
+	}
+	mysqlResult, ok := result.(*mysql.Result)
+	if !ok {
+		return nil, nil, 0, errors.Errorf("unexpected result type of table %s", table)
+	}
+
+	// the values of the set list are selected after the columns of the table
+	width := len(mysqlResult.Fields) - len(p.Stmt.List)
+	if width <= 0 {
+		return nil, nil, 0, errors.Errorf("unexpected columns of table %s", table)
+	}
+	columns := make([]string, 0, width)
+	for _, field := range mysqlResult.Fields[:width] {
+		columns = append(columns, field.Name)
+	}
+	assigned := make([]int, 0, len(p.Stmt.List))
+	for _, assignment := range p.Stmt.List {
+		index := fieldIndex(mysqlResult.Fields[:width], assignment.Column.Name.String())
+		if index < 0 {
+			return nil, nil, 0, errors.Errorf("unknown column '%s' in 'field list'", assignment.Column.Name.String())
+		}
+		assigned = append(assigned, index)
+	}
+
+	values, err := decodeRows(mysqlResult)
+	if err != nil {
+		return nil, nil, 0, errors.WithStack(err)
+	}
+	rows := make([][]interface{}, 0, len(values))
+	for _, value := range values {
+		row := make([]interface{}, width)
+		for i := 0; i < width; i++ {
+			row[i] = valueOf(value[i])
+		}
+		for i, index := range assigned {
+			row[index] = valueOf(value[width+i])
+		}
+		rows = append(rows, row)
+	}
+	return columns, rows, warns, nil
+}
+
+// generateSelect generates `SELECT *, expr1, expr2 ... FROM table WHERE ... ORDER BY ... LIMIT ... FOR UPDATE`,
+// the expressions of the set list are evaluated by mysql, and the order of the parameters is the
+// same as the update statement.
+func (p *ShardingKeyUpdatePlan) generateSelect(sb *strings.Builder, table string) error {
+	ctx := format.NewRestoreCtx(constant.DBPackRestoreFormat, sb)
+	ctx.WriteKeyWord("SELECT ")
+	ctx.WritePlain("*")
+	for i, assignment := range p.Stmt.List {
+		ctx.WritePlain(",")
+		if err := assignment.Expr.Restore(ctx); err != nil {
+			return errors.Wrapf(err, "An error occurred while restoring UpdateStmt.List[%d].Expr", i)
+		}
+	}
+	ctx.WriteKeyWord(" FROM ")
+	ctx.WritePlain(table)
+	if p.Stmt.Where != nil {
+		ctx.WriteKeyWord(" WHERE ")
+		if err := p.Stmt.Where.Restore(ctx); err != nil {
+			return errors.Wrap(err, "An error occurred while restoring UpdateStmt.Where")
+		}
+	}
+	if p.Stmt.Order != nil {
+		ctx.WritePlain(" ")
+		if err := p.Stmt.Order.Restore(ctx); err != nil {
+			return errors.Wrap(err, "An error occurred while restoring UpdateStmt.Order")
+		}
+	}
+	if p.Stmt.Limit != nil {
+		ctx.WritePlain(" ")
+		if err := p.Stmt.Limit.Restore(ctx); err != nil {
+			return errors.Wrap(err, "An error occurred while restoring UpdateStmt.Limit")
+		}
+	}
+	ctx.WriteKeyWord(" FOR UPDATE")
+	return nil
+}
+
+// route returns the physical table of a row by its new sharding key
+func (p *ShardingKeyUpdatePlan) route(columns []string, row []interface{}) (string, string, error) {
+	var (
+		indexes cond.TableIndexSliceCondition
+		sharded bool
+	)
+	for i, column := range columns {
+		if !p.Algorithm.HasShardingKey(column) {
+			continue
+		}
+		value := row[i]
+		if val, ok := value.([]byte); ok {
+			value = string(val)
+		}
+		cd := &cond.KeyCondition{
+			Key:   column,
+			Op:    opcode.EQ,
+			Value: value,
+		}
+		shardIndexes, err := cd.Shard(p.Algorithm)
+		if err != nil {
+			return "", "", errors.Wrap(err, "compute shards failed")
+		}
+		if !sharded {
+			indexes, sharded = shardIndexes, true
+		} else {
+			indexes = indexes.And(shardIndexes).(cond.TableIndexSliceCondition)
+		}
+	}
+	if !sharded {
+		return "", "", errors.New("sharding key of the moved row not found")
+	}
+	_, shardMap := indexes.ParseTopology(p.Algorithm.Topology())
+	if len(shardMap) == 1 {
+		for database, tables := range shardMap {
+			if len(tables) == 1 {
+				return database, tables[0], nil
+			}
+		}
+	}
+	return "", "", errors.Errorf("the moved row should be routed to exactly one table, but got %v", shardMap)
+}
+
+// insertPlan inserts the moved rows, the values are bound as parameters
+func (m *movedRows) insertPlan(executor proto.DBGroupExecutor) *InsertPlan {
+	lists := make([][]ast.ExprNode, 0, len(m.rows))
+	args := make([]interface{}, 0, len(m.rows)*len(m.columns))
+	for _, row := range m.rows {
+		list := make([]ast.ExprNode, 0, len(row))
+		for _, value := range row {
+			list = append(list, &driver.ParamMarkerExpr{Order: len(args)})
+			args = append(args, value)
+		}
+		lists = append(lists, list)
+	}
+	return &InsertPlan{
+		Database: m.database,
+		Table:    m.table,
+		Columns:  m.columns,
+		Stmt:     &ast.InsertStmt{Lists: lists},
+		Args:     args,
+		Executor: executor,
+	}
+}
+
+func valueOf(value *proto.Value) interface{} {
+	if value == nil {
+		return nil
+	}
+	return value.Val
+}
+
+// paramMarkerCounter counts the parameter markers of an expression
+type paramMarkerCounter struct {
+	count int
+}
+
+func (v *paramMarkerCounter) Enter(n ast.Node) (node ast.Node, skipChildren bool) {
+	if _, ok := n.(*driver.ParamMarkerExpr); ok {
+		v.count++
+		return n, true
+	}
+	return n, false
+}
+
+// Leave implement ast.Visitor
+func (v *paramMarkerCounter) Leave(n ast.Node) (node ast.Node, ok bool) {
+	return n, true
+}
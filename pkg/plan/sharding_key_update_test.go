@@ -0,0 +1,145 @@
+/*
+ * Copyright 2022 CECTC, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package plan
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/cectc/dbpack/pkg/cond"
+	"github.com/cectc/dbpack/pkg/constant"
+	"github.com/cectc/dbpack/pkg/mysql"
+	"github.com/cectc/dbpack/pkg/proto"
+	"github.com/cectc/dbpack/pkg/topo"
+	"github.com/cectc/dbpack/pkg/visitor"
+	"github.com/cectc/dbpack/third_party/parser"
+	"github.com/cectc/dbpack/third_party/parser/ast"
+)
+
+type mockMoveExecutor struct {
+	proto.DBGroupExecutor
+	name string
+	tx   *mockMoveTx
+}
+
+func (e *mockMoveExecutor) GroupName() string {
+	return e.name
+}
+
+func (e *mockMoveExecutor) Begin(ctx context.Context) (proto.Tx, proto.Result, error) {
+	e.tx = &mockMoveTx{}
+	return e.tx, nil, nil
+}
+
+type mockMoveTx struct {
+	proto.Tx
+	sqls      []string
+	args      [][]interface{}
+	committed bool
+}
+
+func (tx *mockMoveTx) ExecuteSql(ctx context.Context, sql string, args ...interface{}) (proto.Result, uint16, error) {
+	tx.sqls = append(tx.sqls, sql)
+	tx.args = append(tx.args, args)
+	if strings.HasPrefix(sql, "SELECT") {
+		fields := []*mysql.Field{
+			{Name: "id", FieldType: constant.FieldTypeLongLong},
+			{Name: "name", FieldType: constant.FieldTypeVarString},
+			{Name: "?", FieldType: constant.FieldTypeLongLong},
+		}
+		row := mysql.NewBinaryRow(fields, []*proto.Value{
+			{Typ: constant.FieldTypeLongLong, Val: int64(2)},
+			{Typ: constant.FieldTypeVarString, Val: []byte("scott")},
+			{Typ: constant.FieldTypeLongLong, Val: int64(17)},
+		})
+		return &mysql.Result{Fields: fields, Rows: []proto.Row{row}}, 0, nil
+	}
+	return &mysql.Result{AffectedRows: 1}, 0, nil
+}
+
+func (tx *mockMoveTx) Commit(ctx context.Context) (proto.Result, error) {
+	tx.committed = true
+	return nil, nil
+}
+
+func TestShardingKeyUpdatePlan(t *testing.T) {
+	stmt, err := parser.New().ParseOneStmt("update student set id = ? where id = ?", "", "")
+	assert.Nil(t, err)
+	stmt.Accept(&visitor.ParamVisitor{})
+	tp, err := topo.ParseTopology("school", "student", map[int]string{0: "0-9", 1: "10-19"})
+	assert.Nil(t, err)
+
+	executors := []*mockMoveExecutor{{name: "school_0"}, {name: "school_1"}}
+	p := &ShardingKeyUpdatePlan{
+		Stmt:      stmt.(*ast.UpdateStmt),
+		Args:      []interface{}{17, 2},
+		Shards:    map[string][]string{"school_0": {"student_2"}},
+		Algorithm: cond.NewNumberMod("id", false, tp, nil),
+		Executors: map[string]proto.DBGroupExecutor{
+			"school_0": executors[0],
+			"school_1": executors[1],
+		},
+	}
+	ctx := proto.WithCommandType(context.Background(), constant.ComStmtExecute)
+	result, _, err := p.Execute(ctx)
+	assert.Nil(t, err)
+	affected, _ := result.RowsAffected()
+	assert.Equal(t, uint64(1), affected)
+
+	assert.Equal(t, []string{
+		"SELECT *,? FROM student_2 WHERE `id`=? FOR UPDATE",
+		"DELETE FROM student_2 WHERE `id`=?",
+	}, executors[0].tx.sqls)
+	assert.Equal(t, [][]interface{}{{17, 2}, {2}}, executors[0].tx.args)
+	assert.Equal(t, []string{"INSERT INTO student_17(id,name) VALUES (?,?)"}, executors[1].tx.sqls)
+	assert.Equal(t, [][]interface{}{{int64(17), []byte("scott")}}, executors[1].tx.args)
+	for _, executor := range executors {
+		assert.True(t, executor.tx.committed)
+	}
+}
+
+func TestShardingKeyUpdatePlanWithOrderByAndLimit(t *testing.T) {
+	stmt, err := parser.New().ParseOneStmt("update student set id = ? where id > ? order by id desc limit ?", "", "")
+	assert.Nil(t, err)
+	stmt.Accept(&visitor.ParamVisitor{})
+	tp, err := topo.ParseTopology("school", "student", map[int]string{0: "0-9", 1: "10-19"})
+	assert.Nil(t, err)
+
+	executors := []*mockMoveExecutor{{name: "school_0"}, {name: "school_1"}}
+	p := &ShardingKeyUpdatePlan{
+		Stmt:      stmt.(*ast.UpdateStmt),
+		Args:      []interface{}{17, 1, 1},
+		Shards:    map[string][]string{"school_0": {"student_2"}},
+		Algorithm: cond.NewNumberMod("id", false, tp, nil),
+		Executors: map[string]proto.DBGroupExecutor{
+			"school_0": executors[0],
+			"school_1": executors[1],
+		},
+	}
+	ctx := proto.WithCommandType(context.Background(), constant.ComStmtExecute)
+	_, _, err = p.Execute(ctx)
+	assert.Nil(t, err)
+
+	assert.Equal(t, []string{
+		"SELECT *,? FROM student_2 WHERE `id`>? ORDER BY `id` DESC LIMIT ? FOR UPDATE",
+		"DELETE FROM student_2 WHERE `id`>? ORDER BY `id` DESC LIMIT ?",
+	}, executors[0].tx.sqls)
+	assert.Equal(t, [][]interface{}{{17, 1, 1}, {1, 1}}, executors[0].tx.args)
+}
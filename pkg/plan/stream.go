@@ -0,0 +1,183 @@
+/*
+ * Copyright 2022 CECTC, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package plan
+
+import (
+	"container/heap"
+	"io"
+
+	"github.com/cectc/dbpack/pkg/mysql"
+	"github.com/cectc/dbpack/pkg/proto"
+	"github.com/cectc/dbpack/third_party/parser/ast"
+)
+
+// mergeStreamResults merges the ordered result sets of the shards into a stream result,
+// only the current row of every shard is held in memory.
+func mergeStreamResults(results []*ResultWithErr, orderBy *ast.OrderByClause, limit *Limit) *mysql.StreamResult {
+	var fields []*mysql.Field
+	iters := make([]mysql.RowIterator, 0, len(results))
+	for _, rlt := range results {
+		switch result := rlt.Result.(type) {
+		case *mysql.StreamResult:
+			fields = result.Fields
+			iters = append(iters, result.Rows)
+		case *mysql.Result:
+			fields = result.Fields
+			iters = append(iters, mysql.NewRowsIterator(result.Rows, rlt.Warning))
+		}
+	}
+	iter := &mergeIterator{
+		iters:         iters,
+		orderByFields: castOrderByItemsToOrderField(orderBy, fields),
+		count:         -1,
+	}
+	if limit != nil {
+		iter.offset = limit.Offset
+		iter.count = limit.Count
+	}
+	return &mysql.StreamResult{
+		Fields: fields,
+		Rows:   iter,
+	}
+}
+
+type mergeItem struct {
+	index      int
+	orderField []*OrderField
+	row        proto.Row
+}
+
+type mergeHeap []*mergeItem
+
+func (h mergeHeap) Len() int { return len(h) }
+
+func (h mergeHeap) Less(i, j int) bool {
+	if lessOrderFields(h[i].orderField, h[j].orderField) {
+		return true
+	}
+	if lessOrderFields(h[j].orderField, h[i].orderField) {
+		return false
+	}
+	return h[i].index < h[j].index
+}
+
+func (h mergeHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *mergeHeap) Push(x interface{}) { *h = append(*h, x.(*mergeItem)) }
+
+func (h *mergeHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return item
+}
+
+// mergeIterator merges the ordered rows of the shards with a k-way merge,
+// the offset and count of the limit are applied to the merged rows.
+type mergeIterator struct {
+	iters         []mysql.RowIterator
+	orderByFields []*OrderField
+	heap          mergeHeap
+	started       bool
+	offset        int64
+	// count is the max row count to return, -1 means no limit.
+	count    int64
+	returned int64
+}
+
+func (iter *mergeIterator) Next() (proto.Row, error) {
+	if !iter.started {
+		iter.started = true
+		for i := range iter.iters {
+			if err := iter.fill(i); err != nil {
+				return nil, err
+			}
+		}
+		for ; iter.offset > 0; iter.offset-- {
+			if _, err := iter.pop(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if iter.count >= 0 && iter.returned >= iter.count {
+		return nil, io.EOF
+	}
+	row, err := iter.pop()
+	if err != nil {
+		return nil, err
+	}
+	iter.returned++
+	return row, nil
+}
+
+// pop returns the least row of the shards, and reads the next row of the shard it belongs to.
+func (iter *mergeIterator) pop() (proto.Row, error) {
+	if len(iter.heap) == 0 {
+		return nil, io.EOF
+	}
+	item := heap.Pop(&iter.heap).(*mergeItem)
+	if err := iter.fill(item.index); err != nil {
+		return nil, err
+	}
+	return item.row, nil
+}
+
+// fill reads the next row of the shard at index into the heap.
+func (iter *mergeIterator) fill(index int) error {
+	row, err := iter.iters[index].Next()
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	values, err := row.Decode()
+	if err != nil {
+		return err
+	}
+	orderFields := copyOrderFields(iter.orderByFields)
+	for _, of := range orderFields {
+		of.value = values[of.fieldValueIndex].Val
+	}
+	heap.Push(&iter.heap, &mergeItem{
+		index:      index,
+		orderField: orderFields,
+		row:        row,
+	})
+	return nil
+}
+
+func (iter *mergeIterator) Warnings() uint16 {
+	var warnings uint16
+	for _, it := range iter.iters {
+		warnings += it.Warnings()
+	}
+	return warnings
+}
+
+func (iter *mergeIterator) Close() error {
+	var err error
+	for _, it := range iter.iters {
+		if closeErr := it.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	iter.heap = nil
+	return err
+}
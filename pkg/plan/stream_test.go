@@ -0,0 +1,114 @@
+/*
+ * Copyright 2022 CECTC, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package plan
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/cectc/dbpack/pkg/constant"
+	"github.com/cectc/dbpack/pkg/mysql"
+	"github.com/cectc/dbpack/pkg/proto"
+	"github.com/cectc/dbpack/third_party/parser"
+	"github.com/cectc/dbpack/third_party/parser/ast"
+)
+
+var streamFields = []*mysql.Field{
+	{Name: "id", FieldType: constant.FieldTypeLongLong},
+	{Name: "name", FieldType: constant.FieldTypeVarString},
+}
+
+func mockStreamResult(ids []int64, closed *int) *mysql.StreamResult {
+	rows := make([]proto.Row, 0, len(ids))
+	for _, id := range ids {
+		rows = append(rows, mysql.NewBinaryRow(streamFields, []*proto.Value{
+			{Typ: constant.FieldTypeLongLong, Val: id},
+			{Typ: constant.FieldTypeVarString, Val: []byte("city")},
+		}))
+	}
+	return &mysql.StreamResult{
+		Fields: streamFields,
+		Rows: mysql.WithCloseHook(mysql.NewRowsIterator(rows, 1), func() error {
+			*closed++
+			return nil
+		}),
+	}
+}
+
+func mergedIDs(t *testing.T, result *mysql.StreamResult) []int64 {
+	buffered, warnings, err := result.Buffer()
+	assert.Nil(t, err)
+	assert.Equal(t, uint16(3), warnings)
+	ids := make([]int64, 0, len(buffered.Rows))
+	for _, row := range buffered.Rows {
+		values, err := row.Decode()
+		assert.Nil(t, err)
+		ids = append(ids, values[0].Val.(int64))
+	}
+	return ids
+}
+
+func TestMergeStreamResults(t *testing.T) {
+	testCases := []struct {
+		sql      string
+		shards   [][]int64
+		limit    *Limit
+		expected []int64
+	}{
+		{
+			sql:      "select id, name from city order by id",
+			shards:   [][]int64{{1, 4, 7}, {2, 5, 8}, {3, 6, 9}},
+			expected: []int64{1, 2, 3, 4, 5, 6, 7, 8, 9},
+		},
+		{
+			sql:      "select id, name from city order by id desc",
+			shards:   [][]int64{{9, 3}, {8, 7, 1}, {}},
+			expected: []int64{9, 8, 7, 3, 1},
+		},
+		{
+			sql:      "select id, name from city order by id limit 2, 3",
+			shards:   [][]int64{{1, 4, 7}, {2, 5, 8}, {3, 6, 9}},
+			limit:    &Limit{Offset: 2, Count: 3},
+			expected: []int64{3, 4, 5},
+		},
+		{
+			sql:      "select id, name from city order by id limit 10, 3",
+			shards:   [][]int64{{1, 4, 7}, {2, 5, 8}, {3, 6, 9}},
+			limit:    &Limit{Offset: 10, Count: 3},
+			expected: []int64{},
+		},
+	}
+	for _, c := range testCases {
+		t.Run(c.sql, func(t *testing.T) {
+			stmt, err := parser.New().ParseOneStmt(c.sql, "", "")
+			assert.Nil(t, err)
+			closed := 0
+			results := make([]*ResultWithErr, 0, len(c.shards))
+			for _, ids := range c.shards {
+				results = append(results, &ResultWithErr{Result: mockStreamResult(ids, &closed)})
+			}
+			result := mergeStreamResults(results, stmt.(*ast.SelectStmt).OrderBy, c.limit)
+			assert.Equal(t, streamFields, result.Fields)
+			assert.Equal(t, c.expected, mergedIDs(t, result))
+			assert.Equal(t, len(c.shards), closed)
+			// closing twice does not call the close hooks again
+			assert.Nil(t, result.Rows.Close())
+			assert.Equal(t, len(c.shards), closed)
+		})
+	}
+}
@@ -179,13 +179,12 @@ type MultiUpdatePlan struct {
 	Plans []*UpdatePlan
 }
 
-func (p *MultiUpdatePlan) Execute(ctx context.Context, _ ...*ast.TableOptimizerHint) (result proto.Result, warns uint16, err error) {
+func (p *MultiUpdatePlan) Execute(ctx context.Context, hints ...*ast.TableOptimizerHint) (result proto.Result, warns uint16, err error) {
 	var (
 		affectedRows  uint64
 		warnings      uint16
 		affected      uint64
 		inTransaction bool
-		hints         []*ast.TableOptimizerHint
 	)
 	if complexTx := proto.ExtractDBGroupTx(ctx); complexTx != nil {
 		inTransaction = true
@@ -25,20 +25,24 @@ import (
 const (
 	_flagMaster cFlag = 1 << iota
 	_flagSlave
+	_flagStreaming
 )
 
 type (
-	keyFlag         struct{}
-	keyConnectionID struct{}
-	keyUserName     struct{}
-	keySchema       struct{}
-	keyCommandType  struct{}
-	keyQueryStmt    struct{}
-	keyPrepareStmt  struct{}
-	keyVariableMap  struct{}
-	keySqlText      struct{}
-	keyRemoteAddr   struct{}
-	keyComplexTx    struct{}
+	keyFlag                       struct{}
+	keyConnectionID               struct{}
+	keyUserName                   struct{}
+	keySchema                     struct{}
+	keyCommandType                struct{}
+	keyQueryStmt                  struct{}
+	keyPrepareStmt                struct{}
+	keyVariableMap                struct{}
+	keySqlText                    struct{}
+	keyRemoteAddr                 struct{}
+	keyComplexTx                  struct{}
+	keyComplexTxFactory           struct{}
+	keySession                    struct{}
+	keyTransactionCharacteristics struct{}
 )
 
 type cFlag uint8
@@ -63,6 +67,16 @@ func IsSlave(ctx context.Context) bool {
 	return hasFlag(ctx, _flagSlave)
 }
 
+// WithStreaming streams the rows of the result set instead of buffering them.
+func WithStreaming(ctx context.Context) context.Context {
+	return context.WithValue(ctx, keyFlag{}, _flagStreaming|getFlag(ctx))
+}
+
+// IsStreaming returns true if the rows of the result set should be streamed.
+func IsStreaming(ctx context.Context) bool {
+	return hasFlag(ctx, _flagStreaming)
+}
+
 // WithConnectionID binds connection id
 func WithConnectionID(ctx context.Context, connectionID uint32) context.Context {
 	return context.WithValue(ctx, keyConnectionID{}, connectionID)
@@ -213,6 +227,46 @@ func ExtractDBGroupTx(ctx context.Context) DBGroupTx {
 	return nil
 }
 
+// WithDBGroupTxFactory binds the factory of the DBGroupTx in the transaction mode of the executor,
+// it is used by the plans which write multiple db groups outside a transaction.
+func WithDBGroupTxFactory(ctx context.Context, factory func() DBGroupTx) context.Context {
+	return context.WithValue(ctx, keyComplexTxFactory{}, factory)
+}
+
+// NewDBGroupTx creates a DBGroupTx by the factory bound to the ctx, it returns nil if there is no factory.
+func NewDBGroupTx(ctx context.Context) DBGroupTx {
+	factory, ok := ctx.Value(keyComplexTxFactory{}).(func() DBGroupTx)
+	if ok {
+		return factory()
+	}
+	return nil
+}
+
+// WithSession binds the session state of the client connection
+func WithSession(ctx context.Context, session *Session) context.Context {
+	return context.WithValue(ctx, keySession{}, session)
+}
+
+// ExtractSession extracts the session state of the client connection
+func ExtractSession(ctx context.Context) *Session {
+	session, ok := ctx.Value(keySession{}).(*Session)
+	if ok {
+		return session
+	}
+	return nil
+}
+
+// WithTransactionCharacteristics binds the characteristics set by SET TRANSACTION to the transaction to begin
+func WithTransactionCharacteristics(ctx context.Context, characteristics []string) context.Context {
+	return context.WithValue(ctx, keyTransactionCharacteristics{}, characteristics)
+}
+
+// TransactionCharacteristics extracts the characteristics of the transaction to begin
+func TransactionCharacteristics(ctx context.Context) []string {
+	characteristics, _ := ctx.Value(keyTransactionCharacteristics{}).([]string)
+	return characteristics
+}
+
 func hasFlag(ctx context.Context, flag cFlag) bool {
 	return getFlag(ctx)&flag != 0
 }
@@ -201,6 +201,8 @@ type (
 		Begin(ctx context.Context, executor DBGroupExecutor) (Tx, error)
 		Query(ctx context.Context, query string) (Result, uint16, error)
 		Execute(ctx context.Context, stmt ast.StmtNode, args ...interface{}) (Result, uint16, error)
+		// ExecutePlan executes the plan in the transaction
+		ExecutePlan(ctx context.Context, plan Plan) (Result, uint16, error)
 		Commit(ctx context.Context) (result Result, err error)
 		Rollback(ctx context.Context) (result Result, err error)
 	}
@@ -211,6 +213,14 @@ type (
 		Execute(ctx context.Context, hints ...*ast.TableOptimizerHint) (Result, uint16, error)
 	}
 
+	// StreamPlan represents a Plan whose result set can be streamed to the client.
+	StreamPlan interface {
+		Plan
+		// ExecuteStream executes the current Plan, the rows of the returned result set may be read
+		// from the backend lazily, the result must be closed after use if it is a stream result.
+		ExecuteStream(ctx context.Context, hints ...*ast.TableOptimizerHint) (Result, uint16, error)
+	}
+
 	// Optimizer represents a sql statement optimizer which can be used to create QueryPlan or ExecPlan.
 	Optimizer interface {
 		// Optimize optimizes the sql with arguments then returns a Plan.
@@ -0,0 +1,177 @@
+/*
+ * Copyright 2022 CECTC, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proto
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/cectc/dbpack/third_party/parser/ast"
+)
+
+// SessionNames is the session variable key of SET NAMES and SET CHARACTER SET.
+const SessionNames = "names"
+
+// Session is the session state of a client connection, it is applied to the pooled
+// backend connections borrowed for the client.
+type Session struct {
+	mu     sync.RWMutex
+	schema string
+	// keys keeps the order the variables are assigned in, so that the assignments
+	// depending on other variables are applied after them.
+	keys        []string
+	assignments map[string]string
+	// nextTransaction holds the characteristics set by SET TRANSACTION, which apply to
+	// the next transaction only, they are not applied to the backend connections with the variables.
+	nextTransaction map[string]string
+}
+
+func NewSession() *Session {
+	return &Session{assignments: make(map[string]string)}
+}
+
+// SessionVariableKey returns the key of the variable assigned, system variables are prefixed with @@,
+// user variables are prefixed with @.
+func SessionVariableKey(assignment *ast.VariableAssignment) string {
+	switch {
+	case assignment.Name == ast.SetNames || assignment.Name == ast.SetCharset:
+		return SessionNames
+	case assignment.IsSystem:
+		return "@@" + strings.ToLower(assignment.Name)
+	default:
+		return "@" + strings.ToLower(assignment.Name)
+	}
+}
+
+func (s *Session) Schema() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.schema
+}
+
+func (s *Session) SetSchema(schema string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.schema = schema
+}
+
+// Assign records the assignment of the variable, the assignment is a restored VariableAssignment
+// such as @@SESSION.`sql_mode`='ANSI'.
+func (s *Session) Assign(key, assignment string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.assignments[key]; !ok {
+		s.keys = append(s.keys, key)
+	}
+	s.assignments[key] = assignment
+}
+
+// Unset removes the variable, it is reset to its default value on the backend connections.
+func (s *Session) Unset(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.assignments[key]; !ok {
+		return
+	}
+	delete(s.assignments, key)
+	for i, k := range s.keys {
+		if k == key {
+			s.keys = append(s.keys[:i:i], s.keys[i+1:]...)
+			break
+		}
+	}
+}
+
+// Assignment returns the assignment of the variable.
+func (s *Session) Assignment(key string) (string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	assignment, ok := s.assignments[key]
+	return assignment, ok
+}
+
+// Keys returns the keys of the variables in the order they are assigned.
+func (s *Session) Keys() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	keys := make([]string, len(s.keys))
+	copy(keys, s.keys)
+	return keys
+}
+
+// SetNextTransaction records a characteristic of the next transaction, such as ISOLATION LEVEL READ COMMITTED,
+// the key is the variable the characteristic sets.
+func (s *Session) SetNextTransaction(key, characteristic string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.nextTransaction == nil {
+		s.nextTransaction = make(map[string]string)
+	}
+	s.nextTransaction[key] = characteristic
+}
+
+// TakeNextTransaction returns the characteristics of the next transaction and clears them.
+func (s *Session) TakeNextTransaction() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := make([]string, 0, len(s.nextTransaction))
+	for key := range s.nextTransaction {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	characteristics := make([]string, 0, len(keys))
+	for _, key := range keys {
+		characteristics = append(characteristics, s.nextTransaction[key])
+	}
+	s.nextTransaction = nil
+	return characteristics
+}
+
+// ResetVariables clears the variables, the schema is kept, as COM_RESET_CONNECTION does.
+func (s *Session) ResetVariables() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = nil
+	s.assignments = make(map[string]string)
+	s.nextTransaction = nil
+}
+
+func (s *Session) Clone() *Session {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	session := &Session{
+		schema:      s.schema,
+		keys:        make([]string, len(s.keys)),
+		assignments: make(map[string]string, len(s.assignments)),
+	}
+	copy(session.keys, s.keys)
+	for key, assignment := range s.assignments {
+		session.assignments[key] = assignment
+	}
+	return session
+}
+
+// Update replaces the state with the state of the session.
+func (s *Session) Update(session *Session) {
+	clone := session.Clone()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.schema = clone.schema
+	s.keys = clone.keys
+	s.assignments = clone.assignments
+}
@@ -19,6 +19,7 @@ package sql
 import (
 	"context"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/pkg/errors"
@@ -28,6 +29,7 @@ import (
 	"github.com/cectc/dbpack/pkg/constant"
 	"github.com/cectc/dbpack/pkg/driver"
 	"github.com/cectc/dbpack/pkg/log"
+	"github.com/cectc/dbpack/pkg/mysql"
 	"github.com/cectc/dbpack/pkg/proto"
 	"github.com/cectc/dbpack/pkg/tracing"
 	"github.com/cectc/dbpack/third_party/pools"
@@ -256,15 +258,18 @@ func (db *DB) UseDB(ctx context.Context, schema string) error {
 	db.inflightRequests.Inc()
 	defer db.inflightRequests.Dec()
 
-	r, err := db.pool.Get(spanCtx)
+	// the schema is validated by applying it to a connection
+	session := proto.NewSession()
+	if s := proto.ExtractSession(spanCtx); s != nil {
+		session = s.Clone()
+	}
+	session.SetSchema(schema)
+	conn, err := db.getConn(proto.WithSession(spanCtx, session))
 	if err != nil {
-		err = errors.WithStack(err)
 		return err
 	}
-	defer db.pool.Put(r)
-
-	conn := r.(*driver.BackendConnection)
-	return conn.WriteComInitDB(schema)
+	db.putConn(conn)
+	return nil
 }
 
 func (db *DB) ExecuteFieldList(ctx context.Context, table, wildcard string) ([]proto.Field, error) {
@@ -275,14 +280,12 @@ func (db *DB) ExecuteFieldList(ctx context.Context, table, wildcard string) ([]p
 	db.inflightRequests.Inc()
 	defer db.inflightRequests.Dec()
 
-	r, err := db.pool.Get(spanCtx)
+	conn, err := db.getConn(spanCtx)
 	if err != nil {
-		err = errors.WithStack(err)
 		return nil, err
 	}
-	defer db.pool.Put(r)
+	defer db.putConn(conn)
 
-	conn := r.(*driver.BackendConnection)
 	if err := conn.WriteComFieldList(table, wildcard); err != nil {
 		return nil, err
 	}
@@ -308,14 +311,17 @@ func (db *DB) Query(ctx context.Context, query string) (proto.Result, uint16, er
 	db.inflightRequests.Inc()
 	defer db.inflightRequests.Dec()
 
-	r, err := db.pool.Get(spanCtx)
+	conn, err := db.getConn(spanCtx)
 	if err != nil {
-		err = errors.WithStack(err)
 		return nil, 0, err
 	}
-	defer db.pool.Put(r)
+	if proto.IsStreaming(ctx) {
+		return db.stream(spanCtx, conn, func() { db.putConn(conn) }, func() (proto.Result, uint16, error) {
+			return conn.ExecuteStream(spanCtx, query)
+		})
+	}
+	defer db.putConn(conn)
 
-	conn := r.(*driver.BackendConnection)
 	if err := db.doConnectionPreFilter(spanCtx, conn); err != nil {
 		return nil, 0, err
 	}
@@ -364,21 +370,24 @@ func (db *DB) ExecuteStmt(ctx context.Context, stmt *proto.Stmt) (proto.Result,
 		err    error
 	)
 
-	r, err := db.pool.Get(ctx)
+	conn, err := db.getConn(spanCtx)
 	if err != nil {
-		err = errors.WithStack(err)
-		return nil, 0, err
-	}
-	defer db.pool.Put(r)
-
-	conn := r.(*driver.BackendConnection)
-	if err := db.doConnectionPreFilter(spanCtx, conn); err != nil {
 		return nil, 0, err
 	}
 	for i := 0; i < len(stmt.BindVars); i++ {
 		parameterID := fmt.Sprintf("v%d", i+1)
 		args = append(args, stmt.BindVars[parameterID])
 	}
+	if proto.IsStreaming(ctx) {
+		return db.stream(spanCtx, conn, func() { db.putConn(conn) }, func() (proto.Result, uint16, error) {
+			return conn.PrepareQueryArgsStream(spanCtx, query, args)
+		})
+	}
+	defer db.putConn(conn)
+
+	if err := db.doConnectionPreFilter(spanCtx, conn); err != nil {
+		return nil, 0, err
+	}
 	result, warn, err = conn.PrepareQueryArgs(spanCtx, query, args)
 	if err != nil {
 		return result, warn, err
@@ -398,13 +407,16 @@ func (db *DB) ExecuteSql(ctx context.Context, sql string, args ...interface{}) (
 	db.inflightRequests.Inc()
 	defer db.inflightRequests.Dec()
 
-	r, err := db.pool.Get(spanCtx)
+	conn, err := db.getConn(spanCtx)
 	if err != nil {
-		err = errors.WithStack(err)
 		return nil, 0, err
 	}
-	defer db.pool.Put(r)
-	conn := r.(*driver.BackendConnection)
+	if proto.IsStreaming(ctx) {
+		return db.stream(spanCtx, conn, func() { db.putConn(conn) }, func() (proto.Result, uint16, error) {
+			return conn.PrepareQueryArgsStream(spanCtx, sql, args)
+		})
+	}
+	defer db.putConn(conn)
 	if err := db.doConnectionPreFilter(spanCtx, conn); err != nil {
 		return nil, 0, err
 	}
@@ -445,15 +457,17 @@ func (db *DB) Begin(ctx context.Context) (proto.Tx, proto.Result, error) {
 	span.SetAttributes(attribute.KeyValue{Key: "db", Value: attribute.StringValue(db.name)})
 	defer span.End()
 
-	r, err := db.pool.Get(spanCtx)
+	conn, err = db.getConn(spanCtx)
 	if err != nil {
-		err = errors.WithStack(err)
 		return nil, nil, err
 	}
-	conn = r.(*driver.BackendConnection)
 
+	if err = setTransactionCharacteristics(ctx, conn); err != nil {
+		db.putConn(conn)
+		return nil, nil, err
+	}
 	if result, err = conn.Execute(ctx, "START TRANSACTION", false); err != nil {
-		db.pool.Put(r)
+		db.putConn(conn)
 		return nil, nil, err
 	}
 
@@ -475,15 +489,17 @@ func (db *DB) XAStart(ctx context.Context, sql string) (proto.Tx, proto.Result,
 	span.SetAttributes(attribute.KeyValue{Key: "db", Value: attribute.StringValue(db.name)})
 	defer span.End()
 
-	r, err := db.pool.Get(spanCtx)
+	conn, err = db.getConn(spanCtx)
 	if err != nil {
-		err = errors.WithStack(err)
 		return nil, nil, err
 	}
-	conn = r.(*driver.BackendConnection)
 
+	if err = setTransactionCharacteristics(ctx, conn); err != nil {
+		db.putConn(conn)
+		return nil, nil, err
+	}
 	if result, err = conn.Execute(ctx, sql, false); err != nil {
-		db.pool.Put(r)
+		db.putConn(conn)
 		return nil, nil, err
 	}
 
@@ -502,6 +518,73 @@ func (db *DB) SetConnectionPostFilters(filters []proto.DBConnectionPostFilter) {
 	db.connectionPostFilters = filters
 }
 
+// getConn gets a connection from the pool, and applies the session state of the client to it.
+func (db *DB) getConn(ctx context.Context) (*driver.BackendConnection, error) {
+	r, err := db.pool.Get(ctx)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	conn := r.(*driver.BackendConnection)
+	if session := proto.ExtractSession(ctx); session != nil {
+		if err := conn.SyncSession(ctx, session); err != nil {
+			db.putConn(conn)
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// setTransactionCharacteristics applies the characteristics set by SET TRANSACTION to the transaction
+// about to begin on the connection, they take effect for that transaction only.
+func setTransactionCharacteristics(ctx context.Context, conn *driver.BackendConnection) error {
+	characteristics := proto.TransactionCharacteristics(ctx)
+	if len(characteristics) == 0 {
+		return nil
+	}
+	_, err := conn.Execute(ctx, "SET TRANSACTION "+strings.Join(characteristics, ", "), false)
+	return err
+}
+
+// putConn resets the session state of the connection and puts it back to the pool,
+// the connection is closed if its session state can not be reset.
+func (db *DB) putConn(conn *driver.BackendConnection) {
+	if err := conn.ResetSession(); err != nil {
+		log.Warnf("reset session of connection to %s failed, the connection is closed, err: %v", db.name, err)
+		conn.Close()
+		db.pool.Put(nil)
+		return
+	}
+	db.pool.Put(conn)
+}
+
+// stream runs the connection filters around execute, if execute returns a *mysql.StreamResult,
+// the connection post filters run and the connection is released after its rows are closed.
+func (db *DB) stream(ctx context.Context, conn *driver.BackendConnection, release func(),
+	execute func() (proto.Result, uint16, error)) (proto.Result, uint16, error) {
+	if err := db.doConnectionPreFilter(ctx, conn); err != nil {
+		release()
+		return nil, 0, err
+	}
+	result, warn, err := execute()
+	if err != nil {
+		release()
+		return result, warn, err
+	}
+	rlt, ok := result.(*mysql.StreamResult)
+	if !ok {
+		defer release()
+		if err := db.doConnectionPostFilter(ctx, result, conn); err != nil {
+			return nil, 0, err
+		}
+		return result, warn, nil
+	}
+	rlt.Rows = mysql.WithCloseHook(rlt.Rows, func() error {
+		defer release()
+		return db.doConnectionPostFilter(ctx, rlt, conn)
+	})
+	return rlt, warn, nil
+}
+
 func (db *DB) doConnectionPreFilter(ctx context.Context, conn proto.Connection) error {
 	for i := 0; i < len(db.connectionPreFilters); i++ {
 		f := db.connectionPreFilters[i]
@@ -46,6 +46,15 @@ func (tx *Tx) Query(ctx context.Context, query string) (proto.Result, uint16, er
 	tx.db.inflightRequests.Inc()
 	defer tx.db.inflightRequests.Dec()
 
+	if err := tx.syncSession(spanCtx); err != nil {
+		return nil, 0, err
+	}
+
+	if proto.IsStreaming(ctx) {
+		return tx.db.stream(spanCtx, tx.conn, func() {}, func() (proto.Result, uint16, error) {
+			return tx.conn.ExecuteStream(spanCtx, query)
+		})
+	}
 	if err := tx.db.doConnectionPreFilter(spanCtx, tx.conn); err != nil {
 		return nil, 0, err
 	}
@@ -78,7 +87,7 @@ func (tx *Tx) ExecuteStmt(ctx context.Context, stmt *proto.Stmt) (proto.Result,
 	tx.db.inflightRequests.Inc()
 	defer tx.db.inflightRequests.Dec()
 
-	if err := tx.db.doConnectionPreFilter(spanCtx, tx.conn); err != nil {
+	if err := tx.syncSession(spanCtx); err != nil {
 		return nil, 0, err
 	}
 
@@ -92,6 +101,15 @@ func (tx *Tx) ExecuteStmt(ctx context.Context, stmt *proto.Stmt) (proto.Result,
 		parameterID := fmt.Sprintf("v%d", i+1)
 		args = append(args, stmt.BindVars[parameterID])
 	}
+	if proto.IsStreaming(ctx) {
+		return tx.db.stream(spanCtx, tx.conn, func() {}, func() (proto.Result, uint16, error) {
+			return tx.conn.PrepareQueryArgsStream(spanCtx, query, args)
+		})
+	}
+
+	if err := tx.db.doConnectionPreFilter(spanCtx, tx.conn); err != nil {
+		return nil, 0, err
+	}
 	result, warn, err = tx.conn.PrepareQueryArgs(spanCtx, query, args)
 	if err != nil {
 		return result, warn, err
@@ -111,6 +129,15 @@ func (tx *Tx) ExecuteSql(ctx context.Context, sql string, args ...interface{}) (
 	tx.db.inflightRequests.Inc()
 	defer tx.db.inflightRequests.Dec()
 
+	if err := tx.syncSession(spanCtx); err != nil {
+		return nil, 0, err
+	}
+
+	if proto.IsStreaming(ctx) {
+		return tx.db.stream(spanCtx, tx.conn, func() {}, func() (proto.Result, uint16, error) {
+			return tx.conn.PrepareQueryArgsStream(spanCtx, sql, args)
+		})
+	}
 	if err := tx.db.doConnectionPreFilter(spanCtx, tx.conn); err != nil {
 		return nil, 0, err
 	}
@@ -145,7 +172,7 @@ func (tx *Tx) Commit(ctx context.Context) (result proto.Result, err error) {
 		return nil, err2.ErrInvalidConn
 	}
 	result, err = tx.conn.Execute(ctx, "COMMIT", false)
-	tx.db.pool.Put(tx.conn)
+	tx.db.putConn(tx.conn)
 	tx.Close()
 	return
 }
@@ -165,7 +192,7 @@ func (tx *Tx) Rollback(ctx context.Context, stmt *ast.RollbackStmt) (result prot
 		result, err = tx.conn.Execute(ctx, fmt.Sprintf("ROLLBACK TO %s", stmt.SavepointName), false)
 	} else {
 		result, err = tx.conn.Execute(ctx, "ROLLBACK", false)
-		tx.db.pool.Put(tx.conn)
+		tx.db.putConn(tx.conn)
 		tx.Close()
 	}
 	return
@@ -183,7 +210,7 @@ func (tx *Tx) XAPrepare(ctx context.Context, sql string) (result proto.Result, e
 		return nil, err2.ErrInvalidConn
 	}
 	result, err = tx.conn.Execute(ctx, sql, false)
-	tx.db.pool.Put(tx.conn)
+	tx.db.putConn(tx.conn)
 	tx.Close()
 	return
 }
@@ -203,6 +230,14 @@ func (tx *Tx) ReleaseSavepoint(ctx context.Context, savepoint string) (result pr
 	return
 }
 
+// syncSession applies the session state of the client to the connection of the transaction.
+func (tx *Tx) syncSession(ctx context.Context) error {
+	if session := proto.ExtractSession(ctx); session != nil {
+		return tx.conn.SyncSession(ctx, session)
+	}
+	return nil
+}
+
 func (tx *Tx) Close() {
 	tx.closed.Swap(true)
 	tx.db = nil
@@ -47,9 +47,18 @@ type Topology struct {
 	TableIndexMap map[int]string
 	TableSlice    []int
 	TableSliceLen int
+	// Suffixes are the table suffixes by table index, e.g. log_202601, log_202602,
+	// nil if the tables are suffixed by table index, e.g. log_0, log_1.
+	Suffixes []string
 }
 
 func ParseTopology(dbName, tableName string, topology map[int]string) (*Topology, error) {
+	return ParseTopologyWithSuffixes(dbName, tableName, topology, nil)
+}
+
+// ParseTopologyWithSuffixes parses the topology whose table names are suffixed by
+// `suffixes[table index]` instead of table index, the topology still maps table indexes to dbs.
+func ParseTopologyWithSuffixes(dbName, tableName string, topology map[int]string, suffixes []string) (*Topology, error) {
 	var (
 		dbLen           = len(topology)
 		dbs             = make(map[string][]string, 0)
@@ -72,7 +81,7 @@ func ParseTopology(dbName, tableName string, topology map[int]string) (*Topology
 			if err != nil {
 				return nil, err
 			}
-			realTable := fmt.Sprintf("%s_%d", tableName, index)
+			realTable := physicalTableName(tableName, index, suffixes)
 			tables[realTable] = realDB
 			tableIndexMap[index] = realTable
 			tableIndexSlice = append(tableIndexSlice, index)
@@ -96,7 +105,7 @@ func ParseTopology(dbName, tableName string, topology map[int]string) (*Topology
 			}
 			for j := begin; j <= end; j++ {
 				index := j
-				realTable := fmt.Sprintf("%s_%d", tableName, index)
+				realTable := physicalTableName(tableName, index, suffixes)
 				tables[realTable] = realDB
 				tableIndexMap[index] = realTable
 				tableIndexSlice = append(tableIndexSlice, index)
@@ -109,6 +118,14 @@ func ParseTopology(dbName, tableName string, topology map[int]string) (*Topology
 	if max != len(tableIndexSlice)-1 {
 		return nil, errors.Errorf("table index must from 0 to %d", len(tableIndexSlice)-1)
 	}
+	if suffixes != nil {
+		if len(suffixes) != len(tableIndexSlice) {
+			return nil, errors.Errorf("the count of table suffixes must be %d", len(tableIndexSlice))
+		}
+		if len(tables) != len(tableIndexSlice) {
+			return nil, errors.Errorf("table suffixes must be unique")
+		}
+	}
 	return &Topology{
 		Config:        topology,
 		DBName:        dbName,
@@ -118,10 +135,39 @@ func ParseTopology(dbName, tableName string, topology map[int]string) (*Topology
 		TableIndexMap: tableIndexMap,
 		TableSlice:    tableIndexSlice,
 		TableSliceLen: len(tableIndexSlice),
+		Suffixes:      suffixes,
 	}, nil
 }
 
+func physicalTableName(tableName string, index int, suffixes []string) string {
+	if suffixes != nil && index < len(suffixes) {
+		return fmt.Sprintf("%s_%s", tableName, suffixes[index])
+	}
+	return fmt.Sprintf("%s_%d", tableName, index)
+}
+
+// TableIndex returns the table index of the physical table
+func (topology *Topology) TableIndex(table string) (int, bool) {
+	for index, tbl := range topology.TableIndexMap {
+		if tbl == table {
+			return index, true
+		}
+	}
+	return 0, false
+}
+
 func (topology *Topology) Equal(tp *Topology) bool {
+	if len(topology.Config) != len(tp.Config) {
+		return false
+	}
+	if len(topology.Suffixes) != len(tp.Suffixes) {
+		return false
+	}
+	for i, suffix := range tp.Suffixes {
+		if topology.Suffixes[i] != suffix {
+			return false
+		}
+	}
 	for k, v := range tp.Config {
 		if value, ok := topology.Config[k]; ok {
 			if v != value {
@@ -49,3 +49,25 @@ func Test_ParseTopology(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, 4, tp.TableSliceLen)
 }
+
+func TestParseTopologyWithSuffixes(t *testing.T) {
+	tp, err := ParseTopologyWithSuffixes("log", "log", map[int]string{
+		0: "0-1",
+		1: "2",
+	}, []string{"202601", "202602", "202603"})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, tp.TableSliceLen)
+	assert.Equal(t, map[string][]string{
+		"log_0": {"log_202601", "log_202602"},
+		"log_1": {"log_202603"},
+	}, tp.DBs)
+	assert.Equal(t, "log_202603", tp.TableIndexMap[2])
+	index, ok := tp.TableIndex("log_202602")
+	assert.True(t, ok)
+	assert.Equal(t, 1, index)
+
+	_, err = ParseTopologyWithSuffixes("log", "log", map[int]string{0: "0-1"}, []string{"202601"})
+	assert.NotNil(t, err)
+	_, err = ParseTopologyWithSuffixes("log", "log", map[int]string{0: "0-1"}, []string{"202601", "202601"})
+	assert.NotNil(t, err)
+}
@@ -44,6 +44,9 @@ type LRUCache struct {
 	size      int64
 	capacity  int64
 	evictions int64
+
+	// onEvicted is called with the entries evicted for capacity.
+	onEvicted func(key string, value Value)
 }
 
 // Value is the interface values that go into LRUCache need to satisfy
@@ -75,6 +78,14 @@ func NewLRUCache(capacity int64) *LRUCache {
 	}
 }
 
+// SetOnEvicted sets the function called when an entry is evicted
+// from the cache for capacity. It is not called on Delete and Clear.
+func (lru *LRUCache) SetOnEvicted(f func(key string, value Value)) {
+	lru.mu.Lock()
+	defer lru.mu.Unlock()
+	lru.onEvicted = f
+}
+
 // Get returns a value from the cache, and marks the entry as most
 // recently used.
 func (lru *LRUCache) Get(key string) (v Value, ok bool) {
@@ -280,5 +291,8 @@ func (lru *LRUCache) checkCapacity() {
 		delete(lru.table, delValue.key)
 		lru.size -= delValue.size
 		lru.evictions++
+		if lru.onEvicted != nil {
+			lru.onEvicted(delValue.key, delValue.value)
+		}
 	}
 }
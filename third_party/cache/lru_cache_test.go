@@ -301,3 +301,24 @@ func TestLRUIsEvicted(t *testing.T) {
 		t.Errorf("evictions: %d, want: %d", e, want)
 	}
 }
+
+func TestOnEvicted(t *testing.T) {
+	cache := NewLRUCache(2)
+	var evicted []string
+	cache.SetOnEvicted(func(key string, value Value) {
+		evicted = append(evicted, key)
+	})
+	value := &CacheValue{1}
+	cache.Set("key1", value)
+	cache.Set("key2", value)
+	cache.Get("key1")
+	cache.Set("key3", value)
+	if len(evicted) != 1 || evicted[0] != "key2" {
+		t.Errorf("evicted = %v, expected [key2]", evicted)
+	}
+	cache.Delete("key1")
+	cache.Clear()
+	if len(evicted) != 1 {
+		t.Errorf("evicted = %v, expected only evictions for capacity", evicted)
+	}
+}
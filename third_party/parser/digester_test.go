@@ -168,3 +168,37 @@ func BenchmarkDigestSprintf(b *testing.B) {
 		fmt.Sprintf("%x", digest1)
 	}
 }
+
+func (s *testSQLDigestSuite) TestParameterize(c *C) {
+	tests := []struct {
+		input    string
+		expect   string
+		literals []interface{}
+	}{
+		{"select * from t where a = 1 and b in ('x', ?)", "select * from t where a = ? and b in (?, ?)", []interface{}{int64(1), "x", "?"}},
+		{"select a, b from t where c = -1.5 order by 1, 2 limit 10", "select a, b from t where c = -? order by 1, 2 limit ?", []interface{}{"1.5", int64(10)}},
+		{"select a from t group by 1 having count(*) > 2", "select a from t group by 1 having count(*) > ?", []interface{}{int64(2)}},
+		{"select * from t where a is not null and b = null and c = true", "select * from t where a is not null and b = null and c = true", []interface{}{nil, int64(1)}},
+		{"select _utf8mb4'x', 'y' /* 3 */", "select _utf8mb4'x', ? /* 3 */", []interface{}{"x", "y"}},
+		{"insert into t values (1, 'it''s')", "insert into t values (?, ?)", []interface{}{int64(1), "it's"}},
+	}
+	for _, test := range tests {
+		parameterized, literals, ok := parser.Parameterize(test.input)
+		c.Assert(ok, IsTrue)
+		c.Assert(parameterized, Equals, test.expect)
+		c.Assert(literals, HasLen, len(test.literals))
+		for i, literal := range literals {
+			switch {
+			case literal.Marker:
+				c.Assert(test.literals[i], Equals, "?")
+			case literal.Value.GetValue() == nil:
+				c.Assert(test.literals[i], IsNil)
+			default:
+				c.Assert(fmt.Sprint(literal.Value.GetValue()), Equals, fmt.Sprint(test.literals[i]))
+			}
+		}
+	}
+
+	_, _, ok := parser.Parameterize("select 'x")
+	c.Assert(ok, IsFalse)
+}
@@ -0,0 +1,122 @@
+/*
+ * Copyright 2022 CECTC, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package parser
+
+import (
+	"strings"
+
+	"github.com/cectc/dbpack/third_party/parser/ast"
+	"github.com/cectc/dbpack/third_party/parser/mysql"
+)
+
+// Literal is a literal or a parameter marker of a statement.
+type Literal struct {
+	// Value is the value expression of the literal, it is nil for parameter markers.
+	Value ast.ValueExpr
+	// Marker is true if the literal is a parameter marker of a prepared statement.
+	Marker bool
+	// Fixed literals are kept in the parameterized sql, they are NULL, TRUE, FALSE and
+	// the strings with a charset introducer.
+	Fixed bool
+}
+
+// Parameterize replaces the literals of the sql with parameter markers, so that statements only
+// differ in literals have the same parameterized sql. Unlike Normalize, the parameterized sql keeps
+// the text of the sql except the literals, it can be parsed and has a marker for every literal.
+//
+// The literals and the parameter markers are returned in the order they appear in the sql, the
+// values of the literals are parsed with the default charset and collation as Parse does. The
+// integers of ORDER BY and GROUP BY are column positions rather than literals, they are kept in
+// the parameterized sql and are not returned.
+//
+// for example: Parameterize("select * from t where a = 1 and b in ('x', ?) order by 2")
+// => "select * from t where a = ? and b in (?, ?) order by 2", [1, 'x', ?]
+func Parameterize(sql string) (parameterized string, literals []*Literal, ok bool) {
+	var (
+		s      = NewScanner(sql)
+		v      yySymType
+		buf    strings.Builder
+		last   int
+		prev   []int
+		byList bool
+	)
+	for {
+		tok := s.Lex(&v)
+		if tok == 0 {
+			break
+		}
+		if tok == invalid {
+			return "", nil, false
+		}
+		start, end := v.offset, s.r.pos().Offset
+
+		var literal *Literal
+		switch tok {
+		case intLit:
+			if byList && len(prev) > 0 && (prev[len(prev)-1] == by || prev[len(prev)-1] == ',') {
+				break
+			}
+			literal = &Literal{Value: ast.NewValueExpr(v.item, mysql.DefaultCharset, mysql.DefaultCollationName)}
+		case floatLit, decLit, hexLit, bitLit:
+			literal = &Literal{Value: ast.NewValueExpr(v.item, mysql.DefaultCharset, mysql.DefaultCollationName), Fixed: lastToken(prev, 1) == underscoreCS}
+		case stringLit:
+			literal = &Literal{Value: ast.NewValueExpr(v.ident, mysql.DefaultCharset, mysql.DefaultCollationName), Fixed: lastToken(prev, 1) == underscoreCS}
+		case null, trueKwd, falseKwd:
+			// IS NULL, IS TRUE and IS FALSE are not value expressions
+			if lastToken(prev, 1) == is || (lastToken(prev, 1) == not && lastToken(prev, 2) == is) {
+				break
+			}
+			var value interface{}
+			switch tok {
+			case trueKwd:
+				value = true
+			case falseKwd:
+				value = false
+			}
+			literal = &Literal{Value: ast.NewValueExpr(value, mysql.DefaultCharset, mysql.DefaultCollationName), Fixed: true}
+		case paramMarker:
+			literal = &Literal{Marker: true}
+		case by:
+			byList = lastToken(prev, 1) == order || lastToken(prev, 1) == group
+		case limit, having, window, union, ')', ';':
+			byList = false
+		}
+		prev = append(prev, tok)
+
+		if literal == nil {
+			continue
+		}
+		literals = append(literals, literal)
+		if literal.Value != nil && !literal.Fixed {
+			buf.WriteString(sql[last:start])
+			buf.WriteByte('?')
+			last = end
+		}
+	}
+	if _, errs := s.Errors(); len(errs) > 0 {
+		return "", nil, false
+	}
+	buf.WriteString(sql[last:])
+	return buf.String(), literals, true
+}
+
+func lastToken(tokens []int, n int) int {
+	if len(tokens) < n {
+		return 0
+	}
+	return tokens[len(tokens)-n]
+}
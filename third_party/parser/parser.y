@@ -9661,6 +9661,9 @@ SetStmt:
 			if assigns[i].Name == "tx_isolation" {
 				// A special session variable that make setting tx_isolation take effect one time.
 				assigns[i].Name = "tx_isolation_one_shot"
+			} else if assigns[i].Name == "tx_read_only" {
+				// A special session variable that make setting tx_read_only take effect one time.
+				assigns[i].Name = "tx_read_only_one_shot"
 			}
 		}
 		$$ = &ast.SetStmt{Variables: assigns}